@@ -3,8 +3,8 @@ module github.com/facebookincubator/prometheus-edge-hub
 go 1.14
 
 require (
-	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
 	github.com/golang/protobuf v1.3.3
+	github.com/golang/snappy v0.0.4
 	github.com/labstack/echo v3.3.10+incompatible
 	github.com/labstack/gommon v0.3.0 // indirect
 	github.com/pkg/profile v1.5.0
@@ -12,5 +12,7 @@ require (
 	github.com/prometheus/client_model v0.2.0
 	github.com/prometheus/common v0.9.1
 	github.com/stretchr/testify v1.5.1
+	google.golang.org/genproto v0.0.0-20190819201941-24fa4b261c55
 	google.golang.org/grpc v1.31.0
+	gopkg.in/yaml.v2 v2.2.5
 )
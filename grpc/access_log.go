@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package grpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/hub"
+	"google.golang.org/grpc/peer"
+)
+
+// logAccess writes an entry of kind for a call started at t0 with err to the
+// access log of metricHub. Entries of pushes take their result from result
+// and err, and of scrapes from err only.
+func logAccess(ctx context.Context, metricHub *hub.MetricHub, entry hub.AccessLogEntry, t0 time.Time, result hub.ReceiveResult, err error) {
+	entry.Transport = "grpc"
+	entry.DurationSeconds = time.Since(t0).Seconds()
+	if p, ok := peer.FromContext(ctx); ok {
+		entry.Source = p.Addr.String()
+	}
+	if err != nil {
+		if resp, ok := ParseErrorResponse(err); ok {
+			entry.Code = resp.Code
+		}
+	}
+	switch {
+	case entry.Kind == hub.AccessKindScrape && err != nil:
+		entry.Result = hub.AccessResultFailed
+	case entry.Kind == hub.AccessKindScrape:
+		entry.Result = hub.AccessResultServed
+	case err != nil:
+		entry.Result = hub.AccessResultRejected
+		entry.RejectedDatapoints = entry.Datapoints
+	case result.RejectedDatapoints > 0:
+		entry.Result = hub.AccessResultPartial
+		entry.RejectedDatapoints = result.RejectedDatapoints
+	default:
+		entry.Result = hub.AccessResultAccepted
+	}
+	metricHub.LogAccess(entry)
+}
@@ -0,0 +1,1088 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: edgehub/v1/edgehub.proto
+
+package edgehubv1
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	_go "github.com/prometheus/client_model/go"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type RejectReason int32
+
+const (
+	RejectReason_REJECT_REASON_UNSPECIFIED RejectReason = 0
+	// Accepting the datapoints would exceed the hub limit
+	RejectReason_REJECT_REASON_LIMIT_EXCEEDED RejectReason = 1
+	// The datapoints were over the quota of one of their label values
+	RejectReason_REJECT_REASON_QUOTA_EXCEEDED RejectReason = 2
+	// The push had datapoints without a tenant on the tenant allowlist
+	RejectReason_REJECT_REASON_UNKNOWN_TENANT RejectReason = 3
+	// The datapoints were of new series of a source or family over its series
+	// churn limit
+	RejectReason_REJECT_REASON_SERIES_CHURN RejectReason = 4
+	// The push had datapoints without a timestamp and the hub rejects those
+	RejectReason_REJECT_REASON_MISSING_TIMESTAMP RejectReason = 5
+	// The push had datapoints without one of the identity labels of the hub
+	RejectReason_REJECT_REASON_MISSING_IDENTITY RejectReason = 6
+)
+
+var RejectReason_name = map[int32]string{
+	0: "REJECT_REASON_UNSPECIFIED",
+	1: "REJECT_REASON_LIMIT_EXCEEDED",
+	2: "REJECT_REASON_QUOTA_EXCEEDED",
+	3: "REJECT_REASON_UNKNOWN_TENANT",
+	4: "REJECT_REASON_SERIES_CHURN",
+	5: "REJECT_REASON_MISSING_TIMESTAMP",
+	6: "REJECT_REASON_MISSING_IDENTITY",
+}
+
+var RejectReason_value = map[string]int32{
+	"REJECT_REASON_UNSPECIFIED":       0,
+	"REJECT_REASON_LIMIT_EXCEEDED":    1,
+	"REJECT_REASON_QUOTA_EXCEEDED":    2,
+	"REJECT_REASON_UNKNOWN_TENANT":    3,
+	"REJECT_REASON_SERIES_CHURN":      4,
+	"REJECT_REASON_MISSING_TIMESTAMP": 5,
+	"REJECT_REASON_MISSING_IDENTITY":  6,
+}
+
+func (x RejectReason) String() string {
+	return proto.EnumName(RejectReason_name, int32(x))
+}
+
+func (RejectReason) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_e63a647ffb32a3ba, []int{0}
+}
+
+type HealthStatus int32
+
+const (
+	HealthStatus_HEALTH_STATUS_UNSPECIFIED HealthStatus = 0
+	// The hub accepts pushes and scrapes
+	HealthStatus_HEALTH_STATUS_SERVING HealthStatus = 1
+	// The hub accepts pushes but refuses scrapes until its warm-up period is over
+	HealthStatus_HEALTH_STATUS_WARMING_UP HealthStatus = 2
+)
+
+var HealthStatus_name = map[int32]string{
+	0: "HEALTH_STATUS_UNSPECIFIED",
+	1: "HEALTH_STATUS_SERVING",
+	2: "HEALTH_STATUS_WARMING_UP",
+}
+
+var HealthStatus_value = map[string]int32{
+	"HEALTH_STATUS_UNSPECIFIED": 0,
+	"HEALTH_STATUS_SERVING":     1,
+	"HEALTH_STATUS_WARMING_UP":  2,
+}
+
+func (x HealthStatus) String() string {
+	return proto.EnumName(HealthStatus_name, int32(x))
+}
+
+func (HealthStatus) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_e63a647ffb32a3ba, []int{1}
+}
+
+// Ack acknowledges a batch of pushed metrics
+type Ack struct {
+	// batch_id of the acknowledged request
+	BatchId string `protobuf:"bytes,1,opt,name=batch_id,json=batchId,proto3" json:"batch_id,omitempty"`
+	// Number of pushed datapoints stored in the hub
+	AcceptedDatapoints int64 `protobuf:"varint,2,opt,name=accepted_datapoints,json=acceptedDatapoints,proto3" json:"accepted_datapoints,omitempty"`
+	// Number of pushed datapoints the hub did not store
+	RejectedDatapoints int64 `protobuf:"varint,3,opt,name=rejected_datapoints,json=rejectedDatapoints,proto3" json:"rejected_datapoints,omitempty"`
+	// Why datapoints were rejected. Empty if everything was accepted
+	Reasons []RejectReason `protobuf:"varint,4,rep,packed,name=reasons,proto3,enum=edgehub.v1.RejectReason" json:"reasons,omitempty"`
+	// Hub utilization (percent of the limit) after the push. 0 if the hub has no limit
+	Utilization          float64  `protobuf:"fixed64,5,opt,name=utilization,proto3" json:"utilization,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Ack) Reset()         { *m = Ack{} }
+func (m *Ack) String() string { return proto.CompactTextString(m) }
+func (*Ack) ProtoMessage()    {}
+func (*Ack) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e63a647ffb32a3ba, []int{0}
+}
+
+func (m *Ack) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Ack.Unmarshal(m, b)
+}
+func (m *Ack) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Ack.Marshal(b, m, deterministic)
+}
+func (m *Ack) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Ack.Merge(m, src)
+}
+func (m *Ack) XXX_Size() int {
+	return xxx_messageInfo_Ack.Size(m)
+}
+func (m *Ack) XXX_DiscardUnknown() {
+	xxx_messageInfo_Ack.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Ack proto.InternalMessageInfo
+
+func (m *Ack) GetBatchId() string {
+	if m != nil {
+		return m.BatchId
+	}
+	return ""
+}
+
+func (m *Ack) GetAcceptedDatapoints() int64 {
+	if m != nil {
+		return m.AcceptedDatapoints
+	}
+	return 0
+}
+
+func (m *Ack) GetRejectedDatapoints() int64 {
+	if m != nil {
+		return m.RejectedDatapoints
+	}
+	return 0
+}
+
+func (m *Ack) GetReasons() []RejectReason {
+	if m != nil {
+		return m.Reasons
+	}
+	return nil
+}
+
+func (m *Ack) GetUtilization() float64 {
+	if m != nil {
+		return m.Utilization
+	}
+	return 0
+}
+
+type CollectRequest struct {
+	Families []*_go.MetricFamily `protobuf:"bytes,1,rep,name=families,proto3" json:"families,omitempty"`
+	// Optional client-chosen ID echoed back in the Ack. A hub with batch
+	// deduplication stores a request with a given ID at most once
+	BatchId              string   `protobuf:"bytes,2,opt,name=batch_id,json=batchId,proto3" json:"batch_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CollectRequest) Reset()         { *m = CollectRequest{} }
+func (m *CollectRequest) String() string { return proto.CompactTextString(m) }
+func (*CollectRequest) ProtoMessage()    {}
+func (*CollectRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e63a647ffb32a3ba, []int{1}
+}
+
+func (m *CollectRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CollectRequest.Unmarshal(m, b)
+}
+func (m *CollectRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CollectRequest.Marshal(b, m, deterministic)
+}
+func (m *CollectRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CollectRequest.Merge(m, src)
+}
+func (m *CollectRequest) XXX_Size() int {
+	return xxx_messageInfo_CollectRequest.Size(m)
+}
+func (m *CollectRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CollectRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CollectRequest proto.InternalMessageInfo
+
+func (m *CollectRequest) GetFamilies() []*_go.MetricFamily {
+	if m != nil {
+		return m.Families
+	}
+	return nil
+}
+
+func (m *CollectRequest) GetBatchId() string {
+	if m != nil {
+		return m.BatchId
+	}
+	return ""
+}
+
+type CollectResponse struct {
+	Ack                  *Ack     `protobuf:"bytes,1,opt,name=ack,proto3" json:"ack,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CollectResponse) Reset()         { *m = CollectResponse{} }
+func (m *CollectResponse) String() string { return proto.CompactTextString(m) }
+func (*CollectResponse) ProtoMessage()    {}
+func (*CollectResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e63a647ffb32a3ba, []int{2}
+}
+
+func (m *CollectResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CollectResponse.Unmarshal(m, b)
+}
+func (m *CollectResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CollectResponse.Marshal(b, m, deterministic)
+}
+func (m *CollectResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CollectResponse.Merge(m, src)
+}
+func (m *CollectResponse) XXX_Size() int {
+	return xxx_messageInfo_CollectResponse.Size(m)
+}
+func (m *CollectResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_CollectResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CollectResponse proto.InternalMessageInfo
+
+func (m *CollectResponse) GetAck() *Ack {
+	if m != nil {
+		return m.Ack
+	}
+	return nil
+}
+
+type CollectStreamRequest struct {
+	Families []*_go.MetricFamily `protobuf:"bytes,1,rep,name=families,proto3" json:"families,omitempty"`
+	// Optional client-chosen ID echoed back in the Ack. A hub with batch
+	// deduplication stores a request with a given ID at most once
+	BatchId              string   `protobuf:"bytes,2,opt,name=batch_id,json=batchId,proto3" json:"batch_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CollectStreamRequest) Reset()         { *m = CollectStreamRequest{} }
+func (m *CollectStreamRequest) String() string { return proto.CompactTextString(m) }
+func (*CollectStreamRequest) ProtoMessage()    {}
+func (*CollectStreamRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e63a647ffb32a3ba, []int{3}
+}
+
+func (m *CollectStreamRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CollectStreamRequest.Unmarshal(m, b)
+}
+func (m *CollectStreamRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CollectStreamRequest.Marshal(b, m, deterministic)
+}
+func (m *CollectStreamRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CollectStreamRequest.Merge(m, src)
+}
+func (m *CollectStreamRequest) XXX_Size() int {
+	return xxx_messageInfo_CollectStreamRequest.Size(m)
+}
+func (m *CollectStreamRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CollectStreamRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CollectStreamRequest proto.InternalMessageInfo
+
+func (m *CollectStreamRequest) GetFamilies() []*_go.MetricFamily {
+	if m != nil {
+		return m.Families
+	}
+	return nil
+}
+
+func (m *CollectStreamRequest) GetBatchId() string {
+	if m != nil {
+		return m.BatchId
+	}
+	return ""
+}
+
+type CollectStreamResponse struct {
+	Ack                  *Ack     `protobuf:"bytes,1,opt,name=ack,proto3" json:"ack,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CollectStreamResponse) Reset()         { *m = CollectStreamResponse{} }
+func (m *CollectStreamResponse) String() string { return proto.CompactTextString(m) }
+func (*CollectStreamResponse) ProtoMessage()    {}
+func (*CollectStreamResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e63a647ffb32a3ba, []int{4}
+}
+
+func (m *CollectStreamResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CollectStreamResponse.Unmarshal(m, b)
+}
+func (m *CollectStreamResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CollectStreamResponse.Marshal(b, m, deterministic)
+}
+func (m *CollectStreamResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CollectStreamResponse.Merge(m, src)
+}
+func (m *CollectStreamResponse) XXX_Size() int {
+	return xxx_messageInfo_CollectStreamResponse.Size(m)
+}
+func (m *CollectStreamResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_CollectStreamResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CollectStreamResponse proto.InternalMessageInfo
+
+func (m *CollectStreamResponse) GetAck() *Ack {
+	if m != nil {
+		return m.Ack
+	}
+	return nil
+}
+
+type ScrapeRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ScrapeRequest) Reset()         { *m = ScrapeRequest{} }
+func (m *ScrapeRequest) String() string { return proto.CompactTextString(m) }
+func (*ScrapeRequest) ProtoMessage()    {}
+func (*ScrapeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e63a647ffb32a3ba, []int{5}
+}
+
+func (m *ScrapeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ScrapeRequest.Unmarshal(m, b)
+}
+func (m *ScrapeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ScrapeRequest.Marshal(b, m, deterministic)
+}
+func (m *ScrapeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ScrapeRequest.Merge(m, src)
+}
+func (m *ScrapeRequest) XXX_Size() int {
+	return xxx_messageInfo_ScrapeRequest.Size(m)
+}
+func (m *ScrapeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ScrapeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ScrapeRequest proto.InternalMessageInfo
+
+type ScrapeResponse struct {
+	// All datapoints that were in the hub, sorted by family name. They are
+	// removed from the hub just like an HTTP scrape
+	Families             []*_go.MetricFamily `protobuf:"bytes,1,rep,name=families,proto3" json:"families,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
+	XXX_unrecognized     []byte              `json:"-"`
+	XXX_sizecache        int32               `json:"-"`
+}
+
+func (m *ScrapeResponse) Reset()         { *m = ScrapeResponse{} }
+func (m *ScrapeResponse) String() string { return proto.CompactTextString(m) }
+func (*ScrapeResponse) ProtoMessage()    {}
+func (*ScrapeResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e63a647ffb32a3ba, []int{6}
+}
+
+func (m *ScrapeResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ScrapeResponse.Unmarshal(m, b)
+}
+func (m *ScrapeResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ScrapeResponse.Marshal(b, m, deterministic)
+}
+func (m *ScrapeResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ScrapeResponse.Merge(m, src)
+}
+func (m *ScrapeResponse) XXX_Size() int {
+	return xxx_messageInfo_ScrapeResponse.Size(m)
+}
+func (m *ScrapeResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ScrapeResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ScrapeResponse proto.InternalMessageInfo
+
+func (m *ScrapeResponse) GetFamilies() []*_go.MetricFamily {
+	if m != nil {
+		return m.Families
+	}
+	return nil
+}
+
+type HealthRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *HealthRequest) Reset()         { *m = HealthRequest{} }
+func (m *HealthRequest) String() string { return proto.CompactTextString(m) }
+func (*HealthRequest) ProtoMessage()    {}
+func (*HealthRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e63a647ffb32a3ba, []int{7}
+}
+
+func (m *HealthRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HealthRequest.Unmarshal(m, b)
+}
+func (m *HealthRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HealthRequest.Marshal(b, m, deterministic)
+}
+func (m *HealthRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HealthRequest.Merge(m, src)
+}
+func (m *HealthRequest) XXX_Size() int {
+	return xxx_messageInfo_HealthRequest.Size(m)
+}
+func (m *HealthRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_HealthRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HealthRequest proto.InternalMessageInfo
+
+type HealthResponse struct {
+	Status HealthStatus `protobuf:"varint,1,opt,name=status,proto3,enum=edgehub.v1.HealthStatus" json:"status,omitempty"`
+	// Number of datapoints currently in the hub
+	Datapoints int64 `protobuf:"varint,2,opt,name=datapoints,proto3" json:"datapoints,omitempty"`
+	// Hub utilization (percent of the limit). 0 if the hub has no limit
+	Utilization          float64  `protobuf:"fixed64,3,opt,name=utilization,proto3" json:"utilization,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *HealthResponse) Reset()         { *m = HealthResponse{} }
+func (m *HealthResponse) String() string { return proto.CompactTextString(m) }
+func (*HealthResponse) ProtoMessage()    {}
+func (*HealthResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e63a647ffb32a3ba, []int{8}
+}
+
+func (m *HealthResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HealthResponse.Unmarshal(m, b)
+}
+func (m *HealthResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HealthResponse.Marshal(b, m, deterministic)
+}
+func (m *HealthResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HealthResponse.Merge(m, src)
+}
+func (m *HealthResponse) XXX_Size() int {
+	return xxx_messageInfo_HealthResponse.Size(m)
+}
+func (m *HealthResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_HealthResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HealthResponse proto.InternalMessageInfo
+
+func (m *HealthResponse) GetStatus() HealthStatus {
+	if m != nil {
+		return m.Status
+	}
+	return HealthStatus_HEALTH_STATUS_UNSPECIFIED
+}
+
+func (m *HealthResponse) GetDatapoints() int64 {
+	if m != nil {
+		return m.Datapoints
+	}
+	return 0
+}
+
+func (m *HealthResponse) GetUtilization() float64 {
+	if m != nil {
+		return m.Utilization
+	}
+	return 0
+}
+
+type CapabilitiesRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CapabilitiesRequest) Reset()         { *m = CapabilitiesRequest{} }
+func (m *CapabilitiesRequest) String() string { return proto.CompactTextString(m) }
+func (*CapabilitiesRequest) ProtoMessage()    {}
+func (*CapabilitiesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e63a647ffb32a3ba, []int{9}
+}
+
+func (m *CapabilitiesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CapabilitiesRequest.Unmarshal(m, b)
+}
+func (m *CapabilitiesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CapabilitiesRequest.Marshal(b, m, deterministic)
+}
+func (m *CapabilitiesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CapabilitiesRequest.Merge(m, src)
+}
+func (m *CapabilitiesRequest) XXX_Size() int {
+	return xxx_messageInfo_CapabilitiesRequest.Size(m)
+}
+func (m *CapabilitiesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CapabilitiesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CapabilitiesRequest proto.InternalMessageInfo
+
+// Limits the hub enforces on pushes. 0 means no limit
+type Limits struct {
+	Datapoints            int64    `protobuf:"varint,1,opt,name=datapoints,proto3" json:"datapoints,omitempty"`
+	ImportDatapoints      int64    `protobuf:"varint,2,opt,name=import_datapoints,json=importDatapoints,proto3" json:"import_datapoints,omitempty"`
+	ImportMaxBytes        int64    `protobuf:"varint,3,opt,name=import_max_bytes,json=importMaxBytes,proto3" json:"import_max_bytes,omitempty"`
+	GrpcMaxMsgSizeBytes   int64    `protobuf:"varint,4,opt,name=grpc_max_msg_size_bytes,json=grpcMaxMsgSizeBytes,proto3" json:"grpc_max_msg_size_bytes,omitempty"`
+	GrpcMaxPushDatapoints int64    `protobuf:"varint,5,opt,name=grpc_max_push_datapoints,json=grpcMaxPushDatapoints,proto3" json:"grpc_max_push_datapoints,omitempty"`
+	GrpcMaxPushBytes      int64    `protobuf:"varint,6,opt,name=grpc_max_push_bytes,json=grpcMaxPushBytes,proto3" json:"grpc_max_push_bytes,omitempty"`
+	XXX_NoUnkeyedLiteral  struct{} `json:"-"`
+	XXX_unrecognized      []byte   `json:"-"`
+	XXX_sizecache         int32    `json:"-"`
+}
+
+func (m *Limits) Reset()         { *m = Limits{} }
+func (m *Limits) String() string { return proto.CompactTextString(m) }
+func (*Limits) ProtoMessage()    {}
+func (*Limits) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e63a647ffb32a3ba, []int{10}
+}
+
+func (m *Limits) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Limits.Unmarshal(m, b)
+}
+func (m *Limits) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Limits.Marshal(b, m, deterministic)
+}
+func (m *Limits) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Limits.Merge(m, src)
+}
+func (m *Limits) XXX_Size() int {
+	return xxx_messageInfo_Limits.Size(m)
+}
+func (m *Limits) XXX_DiscardUnknown() {
+	xxx_messageInfo_Limits.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Limits proto.InternalMessageInfo
+
+func (m *Limits) GetDatapoints() int64 {
+	if m != nil {
+		return m.Datapoints
+	}
+	return 0
+}
+
+func (m *Limits) GetImportDatapoints() int64 {
+	if m != nil {
+		return m.ImportDatapoints
+	}
+	return 0
+}
+
+func (m *Limits) GetImportMaxBytes() int64 {
+	if m != nil {
+		return m.ImportMaxBytes
+	}
+	return 0
+}
+
+func (m *Limits) GetGrpcMaxMsgSizeBytes() int64 {
+	if m != nil {
+		return m.GrpcMaxMsgSizeBytes
+	}
+	return 0
+}
+
+func (m *Limits) GetGrpcMaxPushDatapoints() int64 {
+	if m != nil {
+		return m.GrpcMaxPushDatapoints
+	}
+	return 0
+}
+
+func (m *Limits) GetGrpcMaxPushBytes() int64 {
+	if m != nil {
+		return m.GrpcMaxPushBytes
+	}
+	return 0
+}
+
+type CapabilitiesResponse struct {
+	// Protocols the hub is served on, e.g. http and grpc
+	Protocols []string `protobuf:"bytes,1,rep,name=protocols,proto3" json:"protocols,omitempty"`
+	// Content types accepted by HTTP pushes
+	PushFormats []string `protobuf:"bytes,2,rep,name=push_formats,json=pushFormats,proto3" json:"push_formats,omitempty"`
+	// Content types returned by HTTP scrapes
+	ScrapeFormats []string `protobuf:"bytes,3,rep,name=scrape_formats,json=scrapeFormats,proto3" json:"scrape_formats,omitempty"`
+	// Content types and encodings accepted by HTTP imports
+	ImportFormats   []string `protobuf:"bytes,4,rep,name=import_formats,json=importFormats,proto3" json:"import_formats,omitempty"`
+	ImportEncodings []string `protobuf:"bytes,5,rep,name=import_encodings,json=importEncodings,proto3" json:"import_encodings,omitempty"`
+	// Fully qualified names of the gRPC services the hub serves
+	GrpcServices []string `protobuf:"bytes,6,rep,name=grpc_services,json=grpcServices,proto3" json:"grpc_services,omitempty"`
+	Limits       *Limits  `protobuf:"bytes,7,opt,name=limits,proto3" json:"limits,omitempty"`
+	// Names of the optional features the hub supports or has enabled
+	Features             []string `protobuf:"bytes,8,rep,name=features,proto3" json:"features,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CapabilitiesResponse) Reset()         { *m = CapabilitiesResponse{} }
+func (m *CapabilitiesResponse) String() string { return proto.CompactTextString(m) }
+func (*CapabilitiesResponse) ProtoMessage()    {}
+func (*CapabilitiesResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_e63a647ffb32a3ba, []int{11}
+}
+
+func (m *CapabilitiesResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CapabilitiesResponse.Unmarshal(m, b)
+}
+func (m *CapabilitiesResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CapabilitiesResponse.Marshal(b, m, deterministic)
+}
+func (m *CapabilitiesResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CapabilitiesResponse.Merge(m, src)
+}
+func (m *CapabilitiesResponse) XXX_Size() int {
+	return xxx_messageInfo_CapabilitiesResponse.Size(m)
+}
+func (m *CapabilitiesResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_CapabilitiesResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CapabilitiesResponse proto.InternalMessageInfo
+
+func (m *CapabilitiesResponse) GetProtocols() []string {
+	if m != nil {
+		return m.Protocols
+	}
+	return nil
+}
+
+func (m *CapabilitiesResponse) GetPushFormats() []string {
+	if m != nil {
+		return m.PushFormats
+	}
+	return nil
+}
+
+func (m *CapabilitiesResponse) GetScrapeFormats() []string {
+	if m != nil {
+		return m.ScrapeFormats
+	}
+	return nil
+}
+
+func (m *CapabilitiesResponse) GetImportFormats() []string {
+	if m != nil {
+		return m.ImportFormats
+	}
+	return nil
+}
+
+func (m *CapabilitiesResponse) GetImportEncodings() []string {
+	if m != nil {
+		return m.ImportEncodings
+	}
+	return nil
+}
+
+func (m *CapabilitiesResponse) GetGrpcServices() []string {
+	if m != nil {
+		return m.GrpcServices
+	}
+	return nil
+}
+
+func (m *CapabilitiesResponse) GetLimits() *Limits {
+	if m != nil {
+		return m.Limits
+	}
+	return nil
+}
+
+func (m *CapabilitiesResponse) GetFeatures() []string {
+	if m != nil {
+		return m.Features
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterEnum("edgehub.v1.RejectReason", RejectReason_name, RejectReason_value)
+	proto.RegisterEnum("edgehub.v1.HealthStatus", HealthStatus_name, HealthStatus_value)
+	proto.RegisterType((*Ack)(nil), "edgehub.v1.Ack")
+	proto.RegisterType((*CollectRequest)(nil), "edgehub.v1.CollectRequest")
+	proto.RegisterType((*CollectResponse)(nil), "edgehub.v1.CollectResponse")
+	proto.RegisterType((*CollectStreamRequest)(nil), "edgehub.v1.CollectStreamRequest")
+	proto.RegisterType((*CollectStreamResponse)(nil), "edgehub.v1.CollectStreamResponse")
+	proto.RegisterType((*ScrapeRequest)(nil), "edgehub.v1.ScrapeRequest")
+	proto.RegisterType((*ScrapeResponse)(nil), "edgehub.v1.ScrapeResponse")
+	proto.RegisterType((*HealthRequest)(nil), "edgehub.v1.HealthRequest")
+	proto.RegisterType((*HealthResponse)(nil), "edgehub.v1.HealthResponse")
+	proto.RegisterType((*CapabilitiesRequest)(nil), "edgehub.v1.CapabilitiesRequest")
+	proto.RegisterType((*Limits)(nil), "edgehub.v1.Limits")
+	proto.RegisterType((*CapabilitiesResponse)(nil), "edgehub.v1.CapabilitiesResponse")
+}
+
+func init() { proto.RegisterFile("edgehub/v1/edgehub.proto", fileDescriptor_e63a647ffb32a3ba) }
+
+var fileDescriptor_e63a647ffb32a3ba = []byte{
+	// 998 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x56, 0x5f, 0x6f, 0xe3, 0x44,
+	0x10, 0x3f, 0x27, 0xbd, 0xb4, 0x9d, 0xb6, 0x69, 0xd8, 0x5e, 0x85, 0x6b, 0x4a, 0x2f, 0xcd, 0x09,
+	0x29, 0x14, 0x35, 0xb9, 0x96, 0x93, 0x90, 0x40, 0x42, 0xf2, 0x25, 0xee, 0xd5, 0x47, 0xe3, 0x16,
+	0xdb, 0xe1, 0xe0, 0x5e, 0xac, 0x8d, 0xb3, 0x4d, 0x96, 0xc6, 0xb1, 0xcf, 0xbb, 0xae, 0xda, 0x3e,
+	0xf3, 0xca, 0x47, 0xe0, 0xa3, 0xf0, 0x3d, 0xf8, 0x30, 0x3c, 0x20, 0xaf, 0xed, 0xd4, 0x4e, 0x02,
+	0x42, 0x42, 0xe2, 0x2d, 0xfe, 0xfd, 0x99, 0x99, 0x1d, 0xcf, 0x4e, 0x0c, 0x32, 0x19, 0x8e, 0xc8,
+	0x38, 0x1a, 0xb4, 0x6f, 0x4f, 0xda, 0xe9, 0xcf, 0x56, 0x10, 0xfa, 0xdc, 0x47, 0x90, 0x3d, 0xde,
+	0x9e, 0x28, 0x7b, 0x7c, 0x4c, 0xc3, 0xe1, 0x71, 0x80, 0x43, 0x7e, 0xdf, 0xf6, 0x08, 0x0f, 0xa9,
+	0xcb, 0x12, 0x59, 0xe3, 0x0f, 0x09, 0xca, 0xaa, 0x7b, 0x83, 0xf6, 0x60, 0x6d, 0x80, 0xb9, 0x3b,
+	0x76, 0xe8, 0x50, 0x96, 0xea, 0x52, 0x73, 0xdd, 0x5c, 0x15, 0xcf, 0xfa, 0x10, 0xb5, 0x61, 0x07,
+	0xbb, 0x2e, 0x09, 0x38, 0x19, 0x3a, 0x43, 0xcc, 0x71, 0xe0, 0xd3, 0x29, 0x67, 0x72, 0xa9, 0x2e,
+	0x35, 0xcb, 0x26, 0xca, 0xa8, 0xee, 0x8c, 0x89, 0x0d, 0x21, 0xf9, 0x99, 0xb8, 0x73, 0x86, 0x72,
+	0x62, 0xc8, 0xa8, 0x9c, 0xe1, 0x14, 0x56, 0x43, 0x82, 0x99, 0x3f, 0x65, 0xf2, 0x4a, 0xbd, 0xdc,
+	0xac, 0x9e, 0xca, 0xad, 0xc7, 0xea, 0x5b, 0xa6, 0x30, 0x98, 0x42, 0x60, 0x66, 0x42, 0x54, 0x87,
+	0x8d, 0x88, 0xd3, 0x09, 0x7d, 0xc0, 0x9c, 0xfa, 0x53, 0xf9, 0x69, 0x5d, 0x6a, 0x4a, 0x66, 0x1e,
+	0x6a, 0xdc, 0x40, 0xb5, 0xe3, 0x4f, 0x26, 0xc2, 0xfb, 0x21, 0x22, 0x8c, 0xa3, 0x6f, 0x61, 0xed,
+	0x1a, 0x7b, 0x74, 0x42, 0x09, 0x93, 0xa5, 0x7a, 0xb9, 0xb9, 0x71, 0xda, 0x68, 0x51, 0x3f, 0xee,
+	0x84, 0x47, 0xf8, 0x98, 0x44, 0xac, 0xe5, 0x4e, 0x28, 0x99, 0xf2, 0x56, 0x4f, 0xf4, 0xe8, 0x2c,
+	0xd6, 0xde, 0x9b, 0x33, 0x4f, 0xa1, 0x49, 0xa5, 0x42, 0x93, 0x1a, 0xaf, 0x60, 0x7b, 0x96, 0x8c,
+	0x05, 0xfe, 0x94, 0x11, 0x74, 0x08, 0x65, 0xec, 0xde, 0x88, 0x6e, 0x6e, 0x9c, 0x6e, 0xe7, 0x4f,
+	0xa4, 0xba, 0x37, 0x66, 0xcc, 0x35, 0x3e, 0xc0, 0xb3, 0xd4, 0x65, 0xf1, 0x90, 0x60, 0xef, 0x7f,
+	0x28, 0xf4, 0x6b, 0xd8, 0x9d, 0x4b, 0xf9, 0xef, 0xcb, 0xdd, 0x86, 0x2d, 0xcb, 0x0d, 0x71, 0x40,
+	0xd2, 0x3a, 0x1b, 0x57, 0x50, 0xcd, 0x80, 0x34, 0xca, 0x7f, 0xac, 0x3c, 0x4e, 0x71, 0x4e, 0xf0,
+	0x84, 0x8f, 0xb3, 0x14, 0xbf, 0x48, 0x50, 0xcd, 0x90, 0x34, 0xc7, 0x4b, 0xa8, 0x30, 0x8e, 0x79,
+	0xc4, 0x44, 0xb1, 0x73, 0xd3, 0x92, 0x68, 0x2d, 0xc1, 0x9b, 0xa9, 0x0e, 0x1d, 0x00, 0x2c, 0x4c,
+	0x6e, 0x0e, 0x99, 0x1f, 0xa6, 0xf2, 0xe2, 0x30, 0xed, 0xc2, 0x4e, 0x07, 0x07, 0x78, 0x40, 0x27,
+	0x94, 0x53, 0xc2, 0xb2, 0xea, 0x7e, 0x2b, 0x41, 0xe5, 0x82, 0x7a, 0x94, 0xcf, 0xe7, 0x90, 0x16,
+	0x72, 0x7c, 0x01, 0x1f, 0x51, 0x2f, 0xf0, 0x43, 0xbe, 0x78, 0x89, 0x6a, 0x09, 0x91, 0xbb, 0x11,
+	0x4d, 0x48, 0x31, 0xc7, 0xc3, 0x77, 0xce, 0xe0, 0x9e, 0x93, 0xec, 0xfe, 0x54, 0x13, 0xbc, 0x87,
+	0xef, 0x5e, 0xc7, 0x28, 0x7a, 0x05, 0x1f, 0x8f, 0xc2, 0xc0, 0x15, 0x3a, 0x8f, 0x8d, 0x1c, 0x46,
+	0x1f, 0x48, 0x6a, 0x58, 0x11, 0x86, 0x9d, 0x98, 0xee, 0xe1, 0xbb, 0x1e, 0x1b, 0x59, 0xf4, 0x81,
+	0x24, 0xae, 0xaf, 0x40, 0x9e, 0xb9, 0x82, 0x88, 0x8d, 0xf3, 0x35, 0x3d, 0x15, 0xb6, 0xdd, 0xd4,
+	0x76, 0x15, 0xb1, 0x71, 0xae, 0xb0, 0x63, 0xd8, 0x29, 0x1a, 0x93, 0x54, 0x95, 0xe4, 0x1c, 0x39,
+	0x8f, 0xc8, 0xd3, 0xf8, 0xbd, 0x04, 0xcf, 0x8a, 0x7d, 0x4b, 0xdf, 0xe1, 0x3e, 0xac, 0x8b, 0x05,
+	0xe4, 0xfa, 0x93, 0x64, 0x50, 0xd6, 0xcd, 0x47, 0x00, 0x1d, 0xc2, 0xa6, 0x08, 0x7e, 0xed, 0x87,
+	0x1e, 0x16, 0x6d, 0x8a, 0x05, 0x1b, 0x31, 0x76, 0x96, 0x40, 0xe8, 0x33, 0xa8, 0x32, 0x31, 0x7a,
+	0x33, 0x51, 0x59, 0x88, 0xb6, 0x12, 0x34, 0x27, 0x4b, 0x1b, 0x99, 0xc9, 0x56, 0x12, 0x59, 0x82,
+	0x66, 0xb2, 0xcf, 0x67, 0xfd, 0x26, 0x53, 0xd7, 0x1f, 0xd2, 0xe9, 0x28, 0xee, 0x43, 0x2c, 0xdc,
+	0x4e, 0x70, 0x2d, 0x83, 0xd1, 0x0b, 0xd8, 0x12, 0x1d, 0x60, 0x24, 0xbc, 0xa5, 0xae, 0x38, 0x7b,
+	0xac, 0xdb, 0x8c, 0x41, 0x2b, 0xc5, 0xd0, 0x11, 0x54, 0x26, 0x62, 0x2c, 0xe4, 0x55, 0x71, 0x9f,
+	0x50, 0x7e, 0x44, 0x93, 0x81, 0x31, 0x53, 0x05, 0x52, 0x60, 0xed, 0x9a, 0x60, 0x1e, 0x85, 0x84,
+	0xc9, 0x6b, 0x22, 0xd6, 0xec, 0xf9, 0xe8, 0x4f, 0x09, 0x36, 0xf3, 0xfb, 0x0f, 0x7d, 0x0a, 0x7b,
+	0xa6, 0xf6, 0x56, 0xeb, 0xd8, 0x8e, 0xa9, 0xa9, 0xd6, 0xa5, 0xe1, 0xf4, 0x0d, 0xeb, 0x4a, 0xeb,
+	0xe8, 0x67, 0xba, 0xd6, 0xad, 0x3d, 0x41, 0x75, 0xd8, 0x2f, 0xd2, 0x17, 0x7a, 0x4f, 0xb7, 0x1d,
+	0xed, 0xc7, 0x8e, 0xa6, 0x75, 0xb5, 0x6e, 0x4d, 0x5a, 0x54, 0x7c, 0xdf, 0xbf, 0xb4, 0xd5, 0x47,
+	0x45, 0x69, 0x51, 0xd1, 0x37, 0xbe, 0x33, 0x2e, 0xdf, 0x19, 0x8e, 0xad, 0x19, 0xaa, 0x61, 0xd7,
+	0xca, 0xe8, 0x00, 0x94, 0xa2, 0xc2, 0xd2, 0x4c, 0x5d, 0xb3, 0x9c, 0xce, 0x79, 0xdf, 0x34, 0x6a,
+	0x2b, 0xe8, 0x05, 0x3c, 0x2f, 0xf2, 0x3d, 0xdd, 0xb2, 0x74, 0xe3, 0x8d, 0x63, 0xeb, 0x3d, 0xcd,
+	0xb2, 0xd5, 0xde, 0x55, 0xed, 0x29, 0x6a, 0xc0, 0xc1, 0x72, 0x91, 0xde, 0xd5, 0x0c, 0x5b, 0xb7,
+	0x7f, 0xaa, 0x55, 0x8e, 0xae, 0x61, 0x33, 0x7f, 0x9f, 0xe3, 0xd3, 0x9f, 0x6b, 0xea, 0x85, 0x7d,
+	0xee, 0x58, 0xb6, 0x6a, 0xf7, 0xad, 0xb9, 0xd3, 0xef, 0xc1, 0x6e, 0x91, 0xb6, 0x34, 0xf3, 0x07,
+	0xdd, 0x78, 0x53, 0x93, 0xd0, 0x3e, 0xc8, 0x45, 0xea, 0x9d, 0x6a, 0xf6, 0xe2, 0x6c, 0xfd, 0xab,
+	0x5a, 0xe9, 0xf4, 0xd7, 0x32, 0x54, 0xb5, 0xe1, 0x88, 0x9c, 0x47, 0x83, 0xf4, 0x15, 0xa2, 0x2e,
+	0xac, 0xa6, 0x7b, 0x12, 0x29, 0xf9, 0x97, 0x57, 0xfc, 0x4b, 0x51, 0x3e, 0x59, 0xca, 0x25, 0x43,
+	0xde, 0x78, 0x82, 0xde, 0xc3, 0x56, 0x61, 0xdb, 0xa2, 0xfa, 0x12, 0x7d, 0x61, 0xf7, 0x2b, 0x87,
+	0xff, 0xa0, 0xc8, 0xe2, 0x36, 0xa5, 0x97, 0x12, 0x52, 0xa1, 0x92, 0x2c, 0x5f, 0xb4, 0x97, 0xb7,
+	0x14, 0x36, 0xb4, 0xa2, 0x2c, 0xa3, 0x66, 0xe5, 0xa9, 0x50, 0x49, 0xfa, 0x5b, 0x0c, 0x51, 0xd8,
+	0xc0, 0x8a, 0xb2, 0x8c, 0x9a, 0x85, 0xb0, 0x60, 0x33, 0x7f, 0xc1, 0xd1, 0xf3, 0x42, 0xf9, 0x8b,
+	0x2b, 0x53, 0xa9, 0xff, 0xbd, 0x20, 0x0b, 0xfa, 0xfa, 0xe2, 0xfd, 0xdb, 0x11, 0xe5, 0xb1, 0xc6,
+	0xf5, 0xbd, 0xf6, 0x35, 0x76, 0xc9, 0xc0, 0xf7, 0x6f, 0xe8, 0xd4, 0x8d, 0x06, 0x98, 0xfb, 0x61,
+	0xfb, 0xf1, 0xef, 0xe4, 0x38, 0x0e, 0x76, 0x1c, 0x7f, 0x01, 0xc5, 0xf7, 0xaf, 0xfd, 0xf8, 0x39,
+	0xf4, 0x4d, 0xfa, 0xf3, 0xf6, 0x64, 0x50, 0x11, 0x8b, 0xe5, 0xcb, 0xbf, 0x06, 0x00, 0x0c, 0x93,
+	0x61, 0x88, 0x2d, 0x09, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// EdgeHubServiceClient is the client API for EdgeHubService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type EdgeHubServiceClient interface {
+	// Push a batch of metrics to the hub
+	Collect(ctx context.Context, in *CollectRequest, opts ...grpc.CallOption) (*CollectResponse, error)
+	// Push a stream of batches, each acknowledged as soon as it is stored
+	CollectStream(ctx context.Context, opts ...grpc.CallOption) (EdgeHubService_CollectStreamClient, error)
+	// Remove and return all metrics in the hub
+	Scrape(ctx context.Context, in *ScrapeRequest, opts ...grpc.CallOption) (*ScrapeResponse, error)
+	// Report whether the hub is ready and how full it is
+	Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error)
+	// Report the formats, protocols, limits and features the hub supports
+	Capabilities(ctx context.Context, in *CapabilitiesRequest, opts ...grpc.CallOption) (*CapabilitiesResponse, error)
+}
+
+type edgeHubServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewEdgeHubServiceClient(cc *grpc.ClientConn) EdgeHubServiceClient {
+	return &edgeHubServiceClient{cc}
+}
+
+func (c *edgeHubServiceClient) Collect(ctx context.Context, in *CollectRequest, opts ...grpc.CallOption) (*CollectResponse, error) {
+	out := new(CollectResponse)
+	err := c.cc.Invoke(ctx, "/edgehub.v1.EdgeHubService/Collect", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *edgeHubServiceClient) CollectStream(ctx context.Context, opts ...grpc.CallOption) (EdgeHubService_CollectStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_EdgeHubService_serviceDesc.Streams[0], "/edgehub.v1.EdgeHubService/CollectStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &edgeHubServiceCollectStreamClient{stream}
+	return x, nil
+}
+
+type EdgeHubService_CollectStreamClient interface {
+	Send(*CollectStreamRequest) error
+	Recv() (*CollectStreamResponse, error)
+	grpc.ClientStream
+}
+
+type edgeHubServiceCollectStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *edgeHubServiceCollectStreamClient) Send(m *CollectStreamRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *edgeHubServiceCollectStreamClient) Recv() (*CollectStreamResponse, error) {
+	m := new(CollectStreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *edgeHubServiceClient) Scrape(ctx context.Context, in *ScrapeRequest, opts ...grpc.CallOption) (*ScrapeResponse, error) {
+	out := new(ScrapeResponse)
+	err := c.cc.Invoke(ctx, "/edgehub.v1.EdgeHubService/Scrape", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *edgeHubServiceClient) Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error) {
+	out := new(HealthResponse)
+	err := c.cc.Invoke(ctx, "/edgehub.v1.EdgeHubService/Health", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *edgeHubServiceClient) Capabilities(ctx context.Context, in *CapabilitiesRequest, opts ...grpc.CallOption) (*CapabilitiesResponse, error) {
+	out := new(CapabilitiesResponse)
+	err := c.cc.Invoke(ctx, "/edgehub.v1.EdgeHubService/Capabilities", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EdgeHubServiceServer is the server API for EdgeHubService service.
+type EdgeHubServiceServer interface {
+	// Push a batch of metrics to the hub
+	Collect(context.Context, *CollectRequest) (*CollectResponse, error)
+	// Push a stream of batches, each acknowledged as soon as it is stored
+	CollectStream(EdgeHubService_CollectStreamServer) error
+	// Remove and return all metrics in the hub
+	Scrape(context.Context, *ScrapeRequest) (*ScrapeResponse, error)
+	// Report whether the hub is ready and how full it is
+	Health(context.Context, *HealthRequest) (*HealthResponse, error)
+	// Report the formats, protocols, limits and features the hub supports
+	Capabilities(context.Context, *CapabilitiesRequest) (*CapabilitiesResponse, error)
+}
+
+// UnimplementedEdgeHubServiceServer can be embedded to have forward compatible implementations.
+type UnimplementedEdgeHubServiceServer struct {
+}
+
+func (*UnimplementedEdgeHubServiceServer) Collect(ctx context.Context, req *CollectRequest) (*CollectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Collect not implemented")
+}
+func (*UnimplementedEdgeHubServiceServer) CollectStream(srv EdgeHubService_CollectStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method CollectStream not implemented")
+}
+func (*UnimplementedEdgeHubServiceServer) Scrape(ctx context.Context, req *ScrapeRequest) (*ScrapeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Scrape not implemented")
+}
+func (*UnimplementedEdgeHubServiceServer) Health(ctx context.Context, req *HealthRequest) (*HealthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Health not implemented")
+}
+func (*UnimplementedEdgeHubServiceServer) Capabilities(ctx context.Context, req *CapabilitiesRequest) (*CapabilitiesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Capabilities not implemented")
+}
+
+func RegisterEdgeHubServiceServer(s *grpc.Server, srv EdgeHubServiceServer) {
+	s.RegisterService(&_EdgeHubService_serviceDesc, srv)
+}
+
+func _EdgeHubService_Collect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CollectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EdgeHubServiceServer).Collect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/edgehub.v1.EdgeHubService/Collect",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EdgeHubServiceServer).Collect(ctx, req.(*CollectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EdgeHubService_CollectStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EdgeHubServiceServer).CollectStream(&edgeHubServiceCollectStreamServer{stream})
+}
+
+type EdgeHubService_CollectStreamServer interface {
+	Send(*CollectStreamResponse) error
+	Recv() (*CollectStreamRequest, error)
+	grpc.ServerStream
+}
+
+type edgeHubServiceCollectStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *edgeHubServiceCollectStreamServer) Send(m *CollectStreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *edgeHubServiceCollectStreamServer) Recv() (*CollectStreamRequest, error) {
+	m := new(CollectStreamRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _EdgeHubService_Scrape_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScrapeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EdgeHubServiceServer).Scrape(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/edgehub.v1.EdgeHubService/Scrape",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EdgeHubServiceServer).Scrape(ctx, req.(*ScrapeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EdgeHubService_Health_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EdgeHubServiceServer).Health(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/edgehub.v1.EdgeHubService/Health",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EdgeHubServiceServer).Health(ctx, req.(*HealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EdgeHubService_Capabilities_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CapabilitiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EdgeHubServiceServer).Capabilities(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/edgehub.v1.EdgeHubService/Capabilities",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EdgeHubServiceServer).Capabilities(ctx, req.(*CapabilitiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _EdgeHubService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "edgehub.v1.EdgeHubService",
+	HandlerType: (*EdgeHubServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Collect",
+			Handler:    _EdgeHubService_Collect_Handler,
+		},
+		{
+			MethodName: "Scrape",
+			Handler:    _EdgeHubService_Scrape_Handler,
+		},
+		{
+			MethodName: "Health",
+			Handler:    _EdgeHubService_Health_Handler,
+		},
+		{
+			MethodName: "Capabilities",
+			Handler:    _EdgeHubService_Capabilities_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CollectStream",
+			Handler:       _EdgeHubService_CollectStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "edgehub/v1/edgehub.proto",
+}
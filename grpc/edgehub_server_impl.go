@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package grpc
+
+import (
+	"context"
+	"io"
+	"time"
+
+	edgehubv1 "github.com/facebookincubator/prometheus-edge-hub/grpc/edgehub/v1"
+	"github.com/facebookincubator/prometheus-edge-hub/hub"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+)
+
+// EdgeHubServerImpl implements the versioned edgehub.v1 API. The unversioned
+// MetricsController service is kept for existing clients.
+type EdgeHubServerImpl struct {
+	MetricHub *hub.MetricHub
+	Limits    PushLimits
+}
+
+func (e *EdgeHubServerImpl) Collect(ctx context.Context, req *edgehubv1.CollectRequest) (*edgehubv1.CollectResponse, error) {
+	defer setThrottleTrailer(ctx, e.MetricHub)
+	result, err := e.Limits.push(ctx, e.MetricHub, req.GetBatchId(), req.GetFamilies(), req)
+	if err != nil {
+		return nil, err
+	}
+	return &edgehubv1.CollectResponse{Ack: toAck(req.GetBatchId(), result)}, nil
+}
+
+func (e *EdgeHubServerImpl) CollectStream(stream edgehubv1.EdgeHubService_CollectStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		result, err := e.Limits.push(stream.Context(), e.MetricHub, req.GetBatchId(), req.GetFamilies(), req)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&edgehubv1.CollectStreamResponse{Ack: toAck(req.GetBatchId(), result)}); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *EdgeHubServerImpl) Scrape(ctx context.Context, req *edgehubv1.ScrapeRequest) (resp *edgehubv1.ScrapeResponse, err error) {
+	entry := hub.AccessLogEntry{Kind: hub.AccessKindScrape}
+	defer func(t0 time.Time) {
+		if resp != nil {
+			entry.Bytes = proto.Size(resp)
+			entry.Families = len(resp.Families)
+			entry.Datapoints = countDatapoints(resp.Families)
+		}
+		logAccess(ctx, e.MetricHub, entry, t0, hub.ReceiveResult{}, err)
+	}(time.Now())
+	families, err := e.MetricHub.ScrapeFamilies()
+	if err == hub.ErrWarmingUp {
+		return nil, errorStatus(codes.Unavailable, hub.ErrorCodeWarmingUp, err.Error(), nil)
+	}
+	if err != nil {
+		return nil, errorStatus(codes.Internal, hub.ErrorCodeInternal, err.Error(), nil)
+	}
+	return &edgehubv1.ScrapeResponse{Families: families}, nil
+}
+
+func (e *EdgeHubServerImpl) Health(ctx context.Context, req *edgehubv1.HealthRequest) (*edgehubv1.HealthResponse, error) {
+	hubStatus := e.MetricHub.Status()
+	healthStatus := edgehubv1.HealthStatus_HEALTH_STATUS_SERVING
+	if hubStatus.WarmUpRemaining > 0 {
+		healthStatus = edgehubv1.HealthStatus_HEALTH_STATUS_WARMING_UP
+	}
+	return &edgehubv1.HealthResponse{
+		Status:      healthStatus,
+		Datapoints:  int64(hubStatus.Datapoints),
+		Utilization: hubStatus.Utilization,
+	}, nil
+}
+
+func (e *EdgeHubServerImpl) Capabilities(ctx context.Context, req *edgehubv1.CapabilitiesRequest) (*edgehubv1.CapabilitiesResponse, error) {
+	capabilities := e.MetricHub.Capabilities()
+	return &edgehubv1.CapabilitiesResponse{
+		Protocols:       capabilities.Protocols,
+		PushFormats:     capabilities.PushFormats,
+		ScrapeFormats:   capabilities.ScrapeFormats,
+		ImportFormats:   capabilities.ImportFormats,
+		ImportEncodings: capabilities.ImportEncodings,
+		GrpcServices:    capabilities.GRPCServices,
+		Limits: &edgehubv1.Limits{
+			Datapoints:            int64(capabilities.Limits.Datapoints),
+			ImportDatapoints:      int64(capabilities.Limits.ImportDatapoints),
+			ImportMaxBytes:        capabilities.Limits.ImportMaxBytes,
+			GrpcMaxMsgSizeBytes:   int64(capabilities.Limits.GRPCMaxMsgSizeBytes),
+			GrpcMaxPushDatapoints: int64(capabilities.Limits.GRPCMaxPushDatapoints),
+			GrpcMaxPushBytes:      int64(capabilities.Limits.GRPCMaxPushBytes),
+		},
+		Features: capabilities.Features,
+	}, nil
+}
+
+func toAck(batchID string, result hub.ReceiveResult) *edgehubv1.Ack {
+	reasons := make([]edgehubv1.RejectReason, 0, len(result.Reasons))
+	for _, reason := range result.Reasons {
+		switch reason {
+		case hub.RejectLimitExceeded:
+			reasons = append(reasons, edgehubv1.RejectReason_REJECT_REASON_LIMIT_EXCEEDED)
+		case hub.RejectQuotaExceeded:
+			reasons = append(reasons, edgehubv1.RejectReason_REJECT_REASON_QUOTA_EXCEEDED)
+		case hub.RejectUnknownTenant:
+			reasons = append(reasons, edgehubv1.RejectReason_REJECT_REASON_UNKNOWN_TENANT)
+		case hub.RejectSeriesChurn:
+			reasons = append(reasons, edgehubv1.RejectReason_REJECT_REASON_SERIES_CHURN)
+		case hub.RejectMissingTimestamp:
+			reasons = append(reasons, edgehubv1.RejectReason_REJECT_REASON_MISSING_TIMESTAMP)
+		case hub.RejectMissingIdentity:
+			reasons = append(reasons, edgehubv1.RejectReason_REJECT_REASON_MISSING_IDENTITY)
+		default:
+			reasons = append(reasons, edgehubv1.RejectReason_REJECT_REASON_UNSPECIFIED)
+		}
+	}
+	return &edgehubv1.Ack{
+		BatchId:            batchID,
+		AcceptedDatapoints: int64(result.AcceptedDatapoints),
+		RejectedDatapoints: int64(result.RejectedDatapoints),
+		Reasons:            reasons,
+		Utilization:        result.Utilization,
+	}
+}
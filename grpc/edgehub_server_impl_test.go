@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	edgehubv1 "github.com/facebookincubator/prometheus-edge-hub/grpc/edgehub/v1"
+	"github.com/facebookincubator/prometheus-edge-hub/hub"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectDeduplicatesBatches(t *testing.T) {
+	server := EdgeHubServerImpl{MetricHub: hub.NewMetricHub(0, 10, hub.WithBatchDeduplication(time.Minute))}
+	push := func(batchID string) *edgehubv1.CollectRequest {
+		return &edgehubv1.CollectRequest{Families: []*dto.MetricFamily{makeFamily("fam1", 2)}, BatchId: batchID}
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := server.Collect(context.Background(), push("a-1"))
+		assert.NoError(t, err)
+		assert.Equal(t, "a-1", resp.GetAck().GetBatchId())
+		assert.Equal(t, int64(2), resp.GetAck().GetAcceptedDatapoints())
+	}
+	assert.Equal(t, 2, server.MetricHub.Status().Datapoints)
+
+	// pushes without an ID are always stored
+	_, err := server.Collect(context.Background(), push(""))
+	assert.NoError(t, err)
+	_, err = server.Collect(context.Background(), push(""))
+	assert.NoError(t, err)
+	assert.Equal(t, 6, server.MetricHub.Status().Datapoints)
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package grpc
+
+import (
+	"github.com/facebookincubator/prometheus-edge-hub/hub"
+	"github.com/golang/protobuf/proto"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorStatus returns a gRPC error with grpcCode whose details are the
+// ErrorResponse of the HTTP API as a google.protobuf.Struct, after any other
+// details, so clients of both APIs can branch on the same error codes
+func errorStatus(grpcCode codes.Code, code hub.ErrorCode, message string, details map[string]string, other ...proto.Message) error {
+	hub.RecordErrorResponse("grpc", code)
+	st := status.New(grpcCode, message)
+	detailed, err := st.WithDetails(append(other, errorResponseStruct(code, message, details))...)
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+func errorResponseStruct(code hub.ErrorCode, message string, details map[string]string) *structpb.Struct {
+	fields := map[string]*structpb.Value{
+		"code":    stringValue(string(code)),
+		"message": stringValue(message),
+	}
+	if len(details) > 0 {
+		detailFields := make(map[string]*structpb.Value, len(details))
+		for key, value := range details {
+			detailFields[key] = stringValue(value)
+		}
+		fields["details"] = &structpb.Value{Kind: &structpb.Value_StructValue{StructValue: &structpb.Struct{Fields: detailFields}}}
+	}
+	return &structpb.Struct{Fields: fields}
+}
+
+func stringValue(s string) *structpb.Value {
+	return &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: s}}
+}
+
+// ParseErrorResponse returns the ErrorResponse in the details of a gRPC error from
+// the hub, or false if it has none
+func ParseErrorResponse(err error) (hub.ErrorResponse, bool) {
+	for _, detail := range status.Convert(err).Details() {
+		s, ok := detail.(*structpb.Struct)
+		if !ok {
+			continue
+		}
+		resp := hub.ErrorResponse{
+			Code:    hub.ErrorCode(s.GetFields()["code"].GetStringValue()),
+			Message: s.GetFields()["message"].GetStringValue(),
+		}
+		if details := s.GetFields()["details"].GetStructValue(); details != nil {
+			resp.Details = make(map[string]string, len(details.GetFields()))
+			for key, value := range details.GetFields() {
+				resp.Details[key] = value.GetStringValue()
+			}
+		}
+		return resp, true
+	}
+	return hub.ErrorResponse{}, false
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+// Package grpctest serves a hub over an in-memory gRPC connection, so code
+// pushing metrics to a hub can be unit tested without sockets
+package grpctest
+
+import (
+	"context"
+	"net"
+
+	hubgrpc "github.com/facebookincubator/prometheus-edge-hub/grpc"
+	edgehubv1 "github.com/facebookincubator/prometheus-edge-hub/grpc/edgehub/v1"
+	"github.com/facebookincubator/prometheus-edge-hub/hub"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// bufferSize is the in-memory buffer of each connection
+const bufferSize = 1024 * 1024
+
+// Server serves a hub with the MetricsController and EdgeHubService services
+// like a hub started with -grpc-port, over an in-memory listener. Pushes go
+// through the same push limits, access log and throttle hints as over a
+// socket.
+type Server struct {
+	// Hub is the hub the server stores pushes in, for tests to scrape or
+	// check the Status of
+	Hub      *hub.MetricHub
+	listener *bufconn.Listener
+	server   *grpc.Server
+}
+
+// NewServer serves metricHub with limits until Close is called. opts are
+// passed to the gRPC server, e.g. grpc.MaxRecvMsgSize.
+func NewServer(metricHub *hub.MetricHub, limits hubgrpc.PushLimits, opts ...grpc.ServerOption) *Server {
+	s := &Server{
+		Hub:      metricHub,
+		listener: bufconn.Listen(bufferSize),
+		server:   grpc.NewServer(opts...),
+	}
+	hubgrpc.RegisterMetricsControllerServer(s.server, &hubgrpc.MetricsControllerServerImpl{MetricHub: metricHub, Limits: limits})
+	edgehubv1.RegisterEdgeHubServiceServer(s.server, &hubgrpc.EdgeHubServerImpl{MetricHub: metricHub, Limits: limits})
+	go s.server.Serve(s.listener)
+	return s
+}
+
+// Dial returns a connection to the server for the clients of both services.
+// Callers close it.
+func (s *Server) Dial(ctx context.Context, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	dialer := func(context.Context, string) (net.Conn, error) {
+		return s.listener.Dial()
+	}
+	opts = append([]grpc.DialOption{grpc.WithContextDialer(dialer), grpc.WithInsecure()}, opts...)
+	return grpc.DialContext(ctx, "bufconn", opts...)
+}
+
+// Close stops the server, closing the connections to it
+func (s *Server) Close() {
+	s.server.Stop()
+}
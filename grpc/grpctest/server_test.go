@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package grpctest
+
+import (
+	"context"
+	"testing"
+
+	hubgrpc "github.com/facebookincubator/prometheus-edge-hub/grpc"
+	edgehubv1 "github.com/facebookincubator/prometheus-edge-hub/grpc/edgehub/v1"
+	"github.com/facebookincubator/prometheus-edge-hub/hub"
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func gaugeFamily(name string, values ...float64) *dto.MetricFamily {
+	family := &dto.MetricFamily{Name: proto.String(name), Type: dto.MetricType_GAUGE.Enum()}
+	for i, value := range values {
+		family.Metric = append(family.Metric, &dto.Metric{
+			Gauge:       &dto.Gauge{Value: proto.Float64(value)},
+			TimestampMs: proto.Int64(int64(i)),
+		})
+	}
+	return family
+}
+
+func TestServer(t *testing.T) {
+	server := NewServer(hub.NewMetricHub(0, 10), hubgrpc.PushLimits{MaxDatapoints: 2})
+	defer server.Close()
+	conn, err := server.Dial(context.Background())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	_, err = hubgrpc.NewMetricsControllerClient(conn).Collect(context.Background(), &hubgrpc.MetricFamilies{Families: []*dto.MetricFamily{gaugeFamily("a", 1, 2)}})
+	assert.NoError(t, err)
+	_, err = hubgrpc.NewMetricsControllerClient(conn).Collect(context.Background(), &hubgrpc.MetricFamilies{Families: []*dto.MetricFamily{gaugeFamily("b", 1, 2, 3)}})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	client := edgehubv1.NewEdgeHubServiceClient(conn)
+	resp, err := client.Collect(context.Background(), &edgehubv1.CollectRequest{Families: []*dto.MetricFamily{gaugeFamily("c", 1)}, BatchId: "batch1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "batch1", resp.GetAck().GetBatchId())
+	assert.Equal(t, 3, server.Hub.Status().Datapoints)
+
+	scraped, err := client.Scrape(context.Background(), &edgehubv1.ScrapeRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, []string{scraped.Families[0].GetName(), scraped.Families[1].GetName()})
+	assert.Equal(t, 0, server.Hub.Status().Datapoints)
+}
+
+func TestServerClose(t *testing.T) {
+	server := NewServer(hub.NewMetricHub(0, 10), hubgrpc.PushLimits{})
+	conn, err := server.Dial(context.Background())
+	assert.NoError(t, err)
+	defer conn.Close()
+	server.Close()
+
+	_, err = edgehubv1.NewEdgeHubServiceClient(conn).Health(context.Background(), &edgehubv1.HealthRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
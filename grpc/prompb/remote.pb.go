@@ -0,0 +1,367 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: prompb/remote.proto
+
+package prompb
+
+import (
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type MetricMetadata_MetricType int32
+
+const (
+	MetricMetadata_UNKNOWN        MetricMetadata_MetricType = 0
+	MetricMetadata_COUNTER        MetricMetadata_MetricType = 1
+	MetricMetadata_GAUGE          MetricMetadata_MetricType = 2
+	MetricMetadata_HISTOGRAM      MetricMetadata_MetricType = 3
+	MetricMetadata_GAUGEHISTOGRAM MetricMetadata_MetricType = 4
+	MetricMetadata_SUMMARY        MetricMetadata_MetricType = 5
+	MetricMetadata_INFO           MetricMetadata_MetricType = 6
+	MetricMetadata_STATESET       MetricMetadata_MetricType = 7
+)
+
+var MetricMetadata_MetricType_name = map[int32]string{
+	0: "UNKNOWN",
+	1: "COUNTER",
+	2: "GAUGE",
+	3: "HISTOGRAM",
+	4: "GAUGEHISTOGRAM",
+	5: "SUMMARY",
+	6: "INFO",
+	7: "STATESET",
+}
+
+var MetricMetadata_MetricType_value = map[string]int32{
+	"UNKNOWN":        0,
+	"COUNTER":        1,
+	"GAUGE":          2,
+	"HISTOGRAM":      3,
+	"GAUGEHISTOGRAM": 4,
+	"SUMMARY":        5,
+	"INFO":           6,
+	"STATESET":       7,
+}
+
+func (x MetricMetadata_MetricType) String() string {
+	return proto.EnumName(MetricMetadata_MetricType_name, int32(x))
+}
+
+func (MetricMetadata_MetricType) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_3bf1d8cb056dddb5, []int{1, 0}
+}
+
+type WriteRequest struct {
+	Timeseries           []*TimeSeries     `protobuf:"bytes,1,rep,name=timeseries,proto3" json:"timeseries,omitempty"`
+	Metadata             []*MetricMetadata `protobuf:"bytes,3,rep,name=metadata,proto3" json:"metadata,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *WriteRequest) Reset()         { *m = WriteRequest{} }
+func (m *WriteRequest) String() string { return proto.CompactTextString(m) }
+func (*WriteRequest) ProtoMessage()    {}
+func (*WriteRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3bf1d8cb056dddb5, []int{0}
+}
+
+func (m *WriteRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WriteRequest.Unmarshal(m, b)
+}
+func (m *WriteRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WriteRequest.Marshal(b, m, deterministic)
+}
+func (m *WriteRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WriteRequest.Merge(m, src)
+}
+func (m *WriteRequest) XXX_Size() int {
+	return xxx_messageInfo_WriteRequest.Size(m)
+}
+func (m *WriteRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_WriteRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WriteRequest proto.InternalMessageInfo
+
+func (m *WriteRequest) GetTimeseries() []*TimeSeries {
+	if m != nil {
+		return m.Timeseries
+	}
+	return nil
+}
+
+func (m *WriteRequest) GetMetadata() []*MetricMetadata {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+type MetricMetadata struct {
+	Type                 MetricMetadata_MetricType `protobuf:"varint,1,opt,name=type,proto3,enum=prometheus.MetricMetadata_MetricType" json:"type,omitempty"`
+	MetricFamilyName     string                    `protobuf:"bytes,2,opt,name=metric_family_name,json=metricFamilyName,proto3" json:"metric_family_name,omitempty"`
+	Help                 string                    `protobuf:"bytes,4,opt,name=help,proto3" json:"help,omitempty"`
+	Unit                 string                    `protobuf:"bytes,5,opt,name=unit,proto3" json:"unit,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                  `json:"-"`
+	XXX_unrecognized     []byte                    `json:"-"`
+	XXX_sizecache        int32                     `json:"-"`
+}
+
+func (m *MetricMetadata) Reset()         { *m = MetricMetadata{} }
+func (m *MetricMetadata) String() string { return proto.CompactTextString(m) }
+func (*MetricMetadata) ProtoMessage()    {}
+func (*MetricMetadata) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3bf1d8cb056dddb5, []int{1}
+}
+
+func (m *MetricMetadata) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MetricMetadata.Unmarshal(m, b)
+}
+func (m *MetricMetadata) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MetricMetadata.Marshal(b, m, deterministic)
+}
+func (m *MetricMetadata) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MetricMetadata.Merge(m, src)
+}
+func (m *MetricMetadata) XXX_Size() int {
+	return xxx_messageInfo_MetricMetadata.Size(m)
+}
+func (m *MetricMetadata) XXX_DiscardUnknown() {
+	xxx_messageInfo_MetricMetadata.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MetricMetadata proto.InternalMessageInfo
+
+func (m *MetricMetadata) GetType() MetricMetadata_MetricType {
+	if m != nil {
+		return m.Type
+	}
+	return MetricMetadata_UNKNOWN
+}
+
+func (m *MetricMetadata) GetMetricFamilyName() string {
+	if m != nil {
+		return m.MetricFamilyName
+	}
+	return ""
+}
+
+func (m *MetricMetadata) GetHelp() string {
+	if m != nil {
+		return m.Help
+	}
+	return ""
+}
+
+func (m *MetricMetadata) GetUnit() string {
+	if m != nil {
+		return m.Unit
+	}
+	return ""
+}
+
+type Sample struct {
+	Value float64 `protobuf:"fixed64,1,opt,name=value,proto3" json:"value,omitempty"`
+	// Milliseconds since the epoch
+	Timestamp            int64    `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Sample) Reset()         { *m = Sample{} }
+func (m *Sample) String() string { return proto.CompactTextString(m) }
+func (*Sample) ProtoMessage()    {}
+func (*Sample) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3bf1d8cb056dddb5, []int{2}
+}
+
+func (m *Sample) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Sample.Unmarshal(m, b)
+}
+func (m *Sample) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Sample.Marshal(b, m, deterministic)
+}
+func (m *Sample) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Sample.Merge(m, src)
+}
+func (m *Sample) XXX_Size() int {
+	return xxx_messageInfo_Sample.Size(m)
+}
+func (m *Sample) XXX_DiscardUnknown() {
+	xxx_messageInfo_Sample.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Sample proto.InternalMessageInfo
+
+func (m *Sample) GetValue() float64 {
+	if m != nil {
+		return m.Value
+	}
+	return 0
+}
+
+func (m *Sample) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+type TimeSeries struct {
+	Labels               []*Label  `protobuf:"bytes,1,rep,name=labels,proto3" json:"labels,omitempty"`
+	Samples              []*Sample `protobuf:"bytes,2,rep,name=samples,proto3" json:"samples,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *TimeSeries) Reset()         { *m = TimeSeries{} }
+func (m *TimeSeries) String() string { return proto.CompactTextString(m) }
+func (*TimeSeries) ProtoMessage()    {}
+func (*TimeSeries) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3bf1d8cb056dddb5, []int{3}
+}
+
+func (m *TimeSeries) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TimeSeries.Unmarshal(m, b)
+}
+func (m *TimeSeries) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TimeSeries.Marshal(b, m, deterministic)
+}
+func (m *TimeSeries) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TimeSeries.Merge(m, src)
+}
+func (m *TimeSeries) XXX_Size() int {
+	return xxx_messageInfo_TimeSeries.Size(m)
+}
+func (m *TimeSeries) XXX_DiscardUnknown() {
+	xxx_messageInfo_TimeSeries.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TimeSeries proto.InternalMessageInfo
+
+func (m *TimeSeries) GetLabels() []*Label {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *TimeSeries) GetSamples() []*Sample {
+	if m != nil {
+		return m.Samples
+	}
+	return nil
+}
+
+type Label struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value                string   `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Label) Reset()         { *m = Label{} }
+func (m *Label) String() string { return proto.CompactTextString(m) }
+func (*Label) ProtoMessage()    {}
+func (*Label) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3bf1d8cb056dddb5, []int{4}
+}
+
+func (m *Label) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Label.Unmarshal(m, b)
+}
+func (m *Label) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Label.Marshal(b, m, deterministic)
+}
+func (m *Label) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Label.Merge(m, src)
+}
+func (m *Label) XXX_Size() int {
+	return xxx_messageInfo_Label.Size(m)
+}
+func (m *Label) XXX_DiscardUnknown() {
+	xxx_messageInfo_Label.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Label proto.InternalMessageInfo
+
+func (m *Label) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Label) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterEnum("prometheus.MetricMetadata_MetricType", MetricMetadata_MetricType_name, MetricMetadata_MetricType_value)
+	proto.RegisterType((*WriteRequest)(nil), "prometheus.WriteRequest")
+	proto.RegisterType((*MetricMetadata)(nil), "prometheus.MetricMetadata")
+	proto.RegisterType((*Sample)(nil), "prometheus.Sample")
+	proto.RegisterType((*TimeSeries)(nil), "prometheus.TimeSeries")
+	proto.RegisterType((*Label)(nil), "prometheus.Label")
+}
+
+func init() { proto.RegisterFile("prompb/remote.proto", fileDescriptor_3bf1d8cb056dddb5) }
+
+var fileDescriptor_3bf1d8cb056dddb5 = []byte{
+	// 464 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x52, 0x5f, 0x8b, 0xd3, 0x40,
+	0x10, 0x37, 0x6d, 0xfa, 0x6f, 0xee, 0x2c, 0x71, 0x14, 0x09, 0xe2, 0x43, 0x09, 0x08, 0x15, 0xee,
+	0x1a, 0x3c, 0xe1, 0x40, 0xf4, 0xa5, 0x1e, 0xb9, 0x7a, 0x6a, 0x52, 0xd8, 0xa4, 0x1c, 0xfa, 0x72,
+	0x6c, 0x72, 0x73, 0x6d, 0x30, 0xdb, 0xc4, 0x64, 0x23, 0xf4, 0xdd, 0x8f, 0xe1, 0x87, 0x95, 0xec,
+	0xf6, 0x4c, 0x7d, 0xb8, 0xa7, 0xcc, 0xfc, 0xfe, 0x64, 0x76, 0x7f, 0xb3, 0xf0, 0xb4, 0x28, 0x73,
+	0x51, 0xc4, 0x6e, 0x49, 0x22, 0x97, 0x34, 0x2b, 0xca, 0x5c, 0xe6, 0x08, 0x0d, 0x48, 0x72, 0x43,
+	0x75, 0xe5, 0xfc, 0x36, 0xe0, 0xf8, 0xba, 0x4c, 0x25, 0x31, 0xfa, 0x59, 0x53, 0x25, 0xf1, 0x1c,
+	0x40, 0xa6, 0x82, 0x2a, 0x2a, 0x53, 0xaa, 0x6c, 0x63, 0xd2, 0x9d, 0x1e, 0x9d, 0x3d, 0x9f, 0xb5,
+	0x8e, 0x59, 0x94, 0x0a, 0x0a, 0x15, 0xcb, 0x0e, 0x94, 0x78, 0x0e, 0x43, 0x41, 0x92, 0xdf, 0x72,
+	0xc9, 0xed, 0xae, 0x72, 0xbd, 0x38, 0x74, 0xf9, 0x24, 0xcb, 0x34, 0xf1, 0xf7, 0x0a, 0xf6, 0x4f,
+	0xfb, 0xd9, 0x1c, 0x76, 0xac, 0xae, 0xf3, 0xa7, 0x03, 0xe3, 0xff, 0x25, 0xf8, 0x0e, 0x4c, 0xb9,
+	0x2b, 0xc8, 0x36, 0x26, 0xc6, 0x74, 0x7c, 0xf6, 0xea, 0xe1, 0x9f, 0xed, 0xdb, 0x68, 0x57, 0x10,
+	0x53, 0x16, 0x3c, 0x01, 0x14, 0x0a, 0xbb, 0xb9, 0xe3, 0x22, 0xcd, 0x76, 0x37, 0x5b, 0x2e, 0xc8,
+	0xee, 0x4c, 0x8c, 0xe9, 0x88, 0x59, 0x9a, 0xb9, 0x54, 0x44, 0xc0, 0x05, 0x21, 0x82, 0xb9, 0xa1,
+	0xac, 0xb0, 0x4d, 0xc5, 0xab, 0xba, 0xc1, 0xea, 0x6d, 0x2a, 0xed, 0x9e, 0xc6, 0x9a, 0xda, 0xd9,
+	0x01, 0xb4, 0x93, 0xf0, 0x08, 0x06, 0xab, 0xe0, 0x4b, 0xb0, 0xbc, 0x0e, 0xac, 0x47, 0x4d, 0x73,
+	0xb1, 0x5c, 0x05, 0x91, 0xc7, 0x2c, 0x03, 0x47, 0xd0, 0x5b, 0xcc, 0x57, 0x0b, 0xcf, 0xea, 0xe0,
+	0x63, 0x18, 0x7d, 0xba, 0x0a, 0xa3, 0xe5, 0x82, 0xcd, 0x7d, 0xab, 0x8b, 0x08, 0x63, 0xc5, 0xb4,
+	0x98, 0xd9, 0x58, 0xc3, 0x95, 0xef, 0xcf, 0xd9, 0x37, 0xab, 0x87, 0x43, 0x30, 0xaf, 0x82, 0xcb,
+	0xa5, 0xd5, 0xc7, 0x63, 0x18, 0x86, 0xd1, 0x3c, 0xf2, 0x42, 0x2f, 0xb2, 0x06, 0xce, 0x07, 0xe8,
+	0x87, 0x5c, 0x14, 0x19, 0xe1, 0x33, 0xe8, 0xfd, 0xe2, 0x59, 0xad, 0x63, 0x31, 0x98, 0x6e, 0xf0,
+	0x25, 0x8c, 0xd4, 0x2a, 0x24, 0x17, 0x85, 0xba, 0x67, 0x97, 0xb5, 0x80, 0x43, 0x00, 0xed, 0xd2,
+	0xf0, 0x35, 0xf4, 0x33, 0x1e, 0x53, 0x76, 0xbf, 0xdc, 0x27, 0x87, 0xc9, 0x7e, 0x6d, 0x18, 0xb6,
+	0x17, 0xe0, 0x09, 0x0c, 0x2a, 0x35, 0xb6, 0xb2, 0x3b, 0x4a, 0x8b, 0x87, 0x5a, 0x7d, 0x22, 0x76,
+	0x2f, 0x71, 0xde, 0x40, 0x4f, 0xd9, 0x9b, 0xf0, 0x54, 0xe0, 0x86, 0x0e, 0xaf, 0xa9, 0xdb, 0x73,
+	0xeb, 0x2d, 0xe8, 0xe6, 0xa3, 0xf7, 0xfd, 0x62, 0x9d, 0xca, 0x4d, 0x1d, 0xcf, 0x92, 0x5c, 0xb8,
+	0x77, 0x3c, 0xa1, 0x38, 0xcf, 0x7f, 0xa4, 0xdb, 0xa4, 0x8e, 0xb9, 0xcc, 0x4b, 0xb7, 0x9d, 0x76,
+	0x4a, 0xb7, 0x6b, 0x3a, 0xdd, 0xd4, 0xb1, 0xbb, 0x2e, 0x8b, 0xc4, 0xd5, 0xcf, 0xfa, 0xbd, 0xfe,
+	0xc4, 0x7d, 0xf5, 0xae, 0xdf, 0xfe, 0x1d, 0x00, 0xc8, 0x81, 0x4d, 0x55, 0xee, 0x02, 0x00, 0x00,
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/hub"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PushLimits bounds the size of a single gRPC push. Unlike the server's max
+// receive message size, which has to be large for big batches, these keep a
+// single push from taking up most of the hub limit on its own. Deadline bounds
+// how long the hub may take to store a push, on top of the deadline of the
+// client. Values <= 0 mean no limit.
+type PushLimits struct {
+	MaxDatapoints int
+	MaxBytes      int
+	Deadline      time.Duration
+}
+
+// check returns a ResourceExhausted error with QuotaFailure details if a push
+// of families exceeds the limits
+func (l PushLimits) check(families []*dto.MetricFamily, msg proto.Message) error {
+	var violations []*errdetails.QuotaFailure_Violation
+	if l.MaxDatapoints > 0 {
+		if datapoints := countDatapoints(families); datapoints > l.MaxDatapoints {
+			violations = append(violations, &errdetails.QuotaFailure_Violation{
+				Subject:     "datapoints",
+				Description: fmt.Sprintf("push has %d datapoints, limit is %d", datapoints, l.MaxDatapoints),
+			})
+		}
+	}
+	if l.MaxBytes > 0 {
+		if size := proto.Size(msg); size > l.MaxBytes {
+			violations = append(violations, &errdetails.QuotaFailure_Violation{
+				Subject:     "bytes",
+				Description: fmt.Sprintf("push is %d bytes, limit is %d", size, l.MaxBytes),
+			})
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+
+	details := make(map[string]string, len(violations))
+	for _, violation := range violations {
+		details[violation.Subject] = violation.Description
+	}
+	return errorStatus(codes.ResourceExhausted, hub.ErrorCodeLimitExceeded, "push exceeds per-push limits", details, &errdetails.QuotaFailure{Violations: violations})
+}
+
+// admit is check followed by the grpc push rate limit of metricHub, also
+// sampling pushes exceeding the limits on metricHub for its debug page and
+// recording the size of every push
+func (l PushLimits) admit(metricHub *hub.MetricHub, families []*dto.MetricFamily, msg proto.Message) error {
+	hub.ObservePushSize("grpc", proto.Size(msg))
+	err := l.check(families, msg)
+	if err != nil {
+		for _, subject := range violationSubjects(err) {
+			hub.RecordLimitedPush("grpc", subject)
+		}
+		metricHub.SampleRejectedPush("grpc", violationsString(err), families)
+		return err
+	}
+	if err := metricHub.AdmitPushRate("grpc", countDatapoints(families)); err != nil {
+		metricHub.SampleRejectedPush("grpc", err.Error(), families)
+		return rateLimitedStatus(err)
+	}
+	return nil
+}
+
+// receive stores families in metricHub, once per batchID if it is set, giving
+// up once ctx is done or the Deadline passes. The error is a DeadlineExceeded
+// or Canceled status if the push was given up on, in which case none of it was
+// stored, and an Aborted status while another push with batchID is stored.
+func (l PushLimits) receive(ctx context.Context, metricHub *hub.MetricHub, batchID string, families []*dto.MetricFamily) (hub.ReceiveResult, error) {
+	if l.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.Deadline)
+		defer cancel()
+	}
+	result, err := metricHub.ReceiveGRPCOnce(ctx, batchID, families)
+	if err == hub.ErrBatchPending {
+		return result, errorStatus(codes.Aborted, hub.ErrorCodeBatchInProgress, err.Error(), map[string]string{"batch_id": batchID})
+	}
+	if err == context.Canceled {
+		return result, errorStatus(codes.Canceled, hub.ErrorCodeCanceled, "push canceled before it was stored", nil)
+	}
+	if err != nil {
+		return result, errorStatus(codes.DeadlineExceeded, hub.ErrorCodeDeadlineExceeded, "push deadline exceeded before it was stored", nil)
+	}
+	return result, nil
+}
+
+// push admits families of msg and stores them in metricHub, once per batchID
+// if it is set, writing the push to the access log of metricHub whether it was
+// stored or not
+func (l PushLimits) push(ctx context.Context, metricHub *hub.MetricHub, batchID string, families []*dto.MetricFamily, msg proto.Message) (result hub.ReceiveResult, err error) {
+	entry := hub.AccessLogEntry{
+		Kind:       hub.AccessKindPush,
+		Bytes:      proto.Size(msg),
+		Families:   len(families),
+		Datapoints: countDatapoints(families),
+	}
+	defer func(t0 time.Time) {
+		logAccess(ctx, metricHub, entry, t0, result, err)
+	}(time.Now())
+	if err := l.admit(metricHub, families, msg); err != nil {
+		return hub.ReceiveResult{}, err
+	}
+	return l.receive(ctx, metricHub, batchID, families)
+}
+
+// rateLimitedStatus returns a ResourceExhausted error with QuotaFailure and
+// RetryInfo details for an error from hub.AdmitPushRate
+func rateLimitedStatus(err error) error {
+	retryAfter, _ := hub.PushRateRetryAfter(err)
+	details := map[string]string{"transport": "grpc", "retry_after": retryAfter.Round(time.Millisecond).String()}
+	return errorStatus(codes.ResourceExhausted, hub.ErrorCodeRateLimited, err.Error(), details,
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{Subject: "rate", Description: err.Error()}}},
+		&errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(retryAfter)},
+	)
+}
+
+func countDatapoints(families []*dto.MetricFamily) int {
+	datapoints := 0
+	for _, fam := range families {
+		datapoints += len(fam.Metric)
+	}
+	return datapoints
+}
+
+// violationSubjects returns the subjects of the quota violations in an error
+// from check
+func violationSubjects(err error) []string {
+	var subjects []string
+	for _, detail := range status.Convert(err).Details() {
+		if failure, ok := detail.(*errdetails.QuotaFailure); ok {
+			for _, violation := range failure.GetViolations() {
+				subjects = append(subjects, violation.GetSubject())
+			}
+		}
+	}
+	return subjects
+}
+
+// violationsString describes the quota violations in an error from check
+func violationsString(err error) string {
+	st := status.Convert(err)
+	var descriptions []string
+	for _, detail := range st.Details() {
+		if failure, ok := detail.(*errdetails.QuotaFailure); ok {
+			for _, violation := range failure.GetViolations() {
+				descriptions = append(descriptions, violation.GetDescription())
+			}
+		}
+	}
+	if len(descriptions) == 0 {
+		return st.Message()
+	}
+	return st.Message() + ": " + strings.Join(descriptions, ", ")
+}
+
+// Capabilities describes a gRPC server with maxMsgSize and these limits
+// serving both hub services, for the hub's capabilities endpoint
+func (l PushLimits) Capabilities(maxMsgSize int) hub.GRPCCapabilities {
+	return hub.GRPCCapabilities{
+		Services:          []string{"edgehub.v1.EdgeHubService", "grpc.MetricsController"},
+		MaxMsgSizeBytes:   maxMsgSize,
+		MaxPushDatapoints: l.MaxDatapoints,
+		MaxPushBytes:      l.MaxBytes,
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	edgehubv1 "github.com/facebookincubator/prometheus-edge-hub/grpc/edgehub/v1"
+	"github.com/facebookincubator/prometheus-edge-hub/hub"
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPushLimits(t *testing.T) {
+	server := MetricsControllerServerImpl{
+		MetricHub: hub.NewMetricHub(0, 10),
+		Limits:    PushLimits{MaxDatapoints: 2},
+	}
+
+	_, err := server.Collect(context.Background(), &MetricFamilies{Families: []*dto.MetricFamily{makeFamily("fam1", 2)}})
+	assert.NoError(t, err)
+
+	_, err = server.Collect(context.Background(), &MetricFamilies{Families: []*dto.MetricFamily{makeFamily("fam1", 3)}})
+	st, ok := status.FromError(err)
+	assert.True(t, ok)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	assert.Equal(t, 2, len(st.Details()))
+	quotaFailure, ok := st.Details()[0].(*errdetails.QuotaFailure)
+	assert.True(t, ok)
+	assert.Equal(t, "datapoints", quotaFailure.GetViolations()[0].GetSubject())
+	resp, ok := ParseErrorResponse(err)
+	assert.True(t, ok)
+	assert.Equal(t, hub.ErrorCodeLimitExceeded, resp.Code)
+	assert.Equal(t, "push has 3 datapoints, limit is 2", resp.Details["datapoints"])
+	assert.Equal(t, 2, server.MetricHub.Status().Datapoints)
+}
+
+func TestPushLimitsRate(t *testing.T) {
+	server := MetricsControllerServerImpl{
+		MetricHub: hub.NewMetricHub(0, 100, hub.WithPushRateLimit("grpc", 1, 2), hub.WithPushRateLimit("http", 1, 1)),
+	}
+
+	_, err := server.Collect(context.Background(), &MetricFamilies{Families: []*dto.MetricFamily{makeFamily("fam1", 2)}})
+	assert.NoError(t, err)
+
+	_, err = server.Collect(context.Background(), &MetricFamilies{Families: []*dto.MetricFamily{makeFamily("fam1", 2)}})
+	st, ok := status.FromError(err)
+	assert.True(t, ok)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	assert.Equal(t, 3, len(st.Details()))
+	quotaFailure, ok := st.Details()[0].(*errdetails.QuotaFailure)
+	assert.True(t, ok)
+	assert.Equal(t, "rate", quotaFailure.GetViolations()[0].GetSubject())
+	retryInfo, ok := st.Details()[1].(*errdetails.RetryInfo)
+	assert.True(t, ok)
+	assert.True(t, retryInfo.GetRetryDelay().GetSeconds() > 0 || retryInfo.GetRetryDelay().GetNanos() > 0)
+	resp, ok := ParseErrorResponse(err)
+	assert.True(t, ok)
+	assert.Equal(t, hub.ErrorCodeRateLimited, resp.Code)
+	assert.Equal(t, 2, server.MetricHub.Status().Datapoints)
+}
+
+func TestPushLimitsBytes(t *testing.T) {
+	req := &MetricFamilies{Families: []*dto.MetricFamily{makeFamily("fam1", 10)}}
+	limits := PushLimits{MaxBytes: proto.Size(req) - 1}
+	assert.Equal(t, codes.ResourceExhausted, status.Code(limits.check(req.GetFamilies(), req)))
+
+	limits = PushLimits{MaxBytes: proto.Size(req)}
+	assert.NoError(t, limits.check(req.GetFamilies(), req))
+}
+
+func TestPushLimitsCapabilities(t *testing.T) {
+	limits := PushLimits{MaxDatapoints: 2, MaxBytes: 100}
+	server := EdgeHubServerImpl{
+		MetricHub: hub.NewMetricHub(10, 10, hub.WithGRPCCapabilities(limits.Capabilities(4096))),
+		Limits:    limits,
+	}
+
+	resp, err := server.Capabilities(context.Background(), &edgehubv1.CapabilitiesRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http", "grpc"}, resp.GetProtocols())
+	assert.Equal(t, []string{"edgehub.v1.EdgeHubService", "grpc.MetricsController"}, resp.GetGrpcServices())
+	assert.Equal(t, int64(10), resp.GetLimits().GetDatapoints())
+	assert.Equal(t, int64(4096), resp.GetLimits().GetGrpcMaxMsgSizeBytes())
+	assert.Equal(t, int64(2), resp.GetLimits().GetGrpcMaxPushDatapoints())
+	assert.Equal(t, int64(100), resp.GetLimits().GetGrpcMaxPushBytes())
+	assert.Equal(t, server.MetricHub.Capabilities().Features, resp.GetFeatures())
+}
+
+func makeFamily(name string, numMetrics int) *dto.MetricFamily {
+	metrics := make([]*dto.Metric, 0, numMetrics)
+	for i := 0; i < numMetrics; i++ {
+		metrics = append(metrics, &dto.Metric{
+			Gauge:       &dto.Gauge{Value: proto.Float64(float64(i))},
+			TimestampMs: proto.Int64(int64(i)),
+		})
+	}
+	return &dto.MetricFamily{
+		Name:   proto.String(name),
+		Type:   dto.MetricType_GAUGE.Enum(),
+		Metric: metrics,
+	}
+}
+
+func TestPushLimitsViolationsString(t *testing.T) {
+	req := &MetricFamilies{Families: []*dto.MetricFamily{makeFamily("fam1", 3)}}
+	limits := PushLimits{MaxDatapoints: 2}
+	err := limits.check(req.GetFamilies(), req)
+	assert.Equal(t, "push exceeds per-push limits: push has 3 datapoints, limit is 2", violationsString(err))
+}
+
+func TestPushDeadline(t *testing.T) {
+	metricHub := hub.NewMetricHub(0, 10)
+	server := EdgeHubServerImpl{MetricHub: metricHub, Limits: PushLimits{Deadline: time.Hour}}
+	req := &edgehubv1.CollectRequest{Families: []*dto.MetricFamily{makeFamily("fam1", 2)}}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err := server.Collect(expired, req)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	resp, ok := ParseErrorResponse(err)
+	assert.True(t, ok)
+	assert.Equal(t, hub.ErrorCodeDeadlineExceeded, resp.Code)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = server.Collect(canceled, req)
+	assert.Equal(t, codes.Canceled, status.Code(err))
+	assert.Equal(t, 0, metricHub.Status().Datapoints)
+
+	_, err = server.Collect(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, metricHub.Status().Datapoints)
+}
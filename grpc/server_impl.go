@@ -9,15 +9,76 @@ package grpc
 
 import (
 	"context"
+	"io"
 
 	"github.com/facebookincubator/prometheus-edge-hub/hub"
 )
 
 type MetricsControllerServerImpl struct {
 	MetricHub *hub.MetricHub
+	Limits    PushLimits
 }
 
 func (m *MetricsControllerServerImpl) Collect(ctx context.Context, req *MetricFamilies) (*Void, error) {
-	m.MetricHub.ReceiveGRPC(req.GetFamilies())
+	defer setThrottleTrailer(ctx, m.MetricHub)
+	if _, err := m.Limits.push(ctx, m.MetricHub, "", req.GetFamilies(), req); err != nil {
+		return nil, err
+	}
 	return &Void{}, nil
 }
+
+func (m *MetricsControllerServerImpl) CollectWithResult(ctx context.Context, req *MetricFamilies) (*CollectResult, error) {
+	defer setThrottleTrailer(ctx, m.MetricHub)
+	result, err := m.Limits.push(ctx, m.MetricHub, "", req.GetFamilies(), req)
+	if err != nil {
+		return nil, err
+	}
+	return toCollectResult(result), nil
+}
+
+// CollectStream stores each message of the stream as it arrives, so a large
+// collection can be sent in pieces under the max message size. A message over
+// the push limits ends the stream with an error, after the messages before it
+// were stored, as does a message not stored within the deadline.
+func (m *MetricsControllerServerImpl) CollectStream(stream MetricsController_CollectStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&Void{})
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := m.Limits.push(stream.Context(), m.MetricHub, "", req.GetFamilies(), req); err != nil {
+			return err
+		}
+	}
+}
+
+func toCollectResult(result hub.ReceiveResult) *CollectResult {
+	reasons := make([]RejectReason, 0, len(result.Reasons))
+	for _, reason := range result.Reasons {
+		switch reason {
+		case hub.RejectLimitExceeded:
+			reasons = append(reasons, RejectReason_LIMIT_EXCEEDED)
+		case hub.RejectQuotaExceeded:
+			reasons = append(reasons, RejectReason_QUOTA_EXCEEDED)
+		case hub.RejectUnknownTenant:
+			reasons = append(reasons, RejectReason_UNKNOWN_TENANT)
+		case hub.RejectSeriesChurn:
+			reasons = append(reasons, RejectReason_SERIES_CHURN)
+		case hub.RejectMissingTimestamp:
+			reasons = append(reasons, RejectReason_MISSING_TIMESTAMP)
+		case hub.RejectMissingIdentity:
+			reasons = append(reasons, RejectReason_MISSING_IDENTITY)
+		default:
+			reasons = append(reasons, RejectReason_UNKNOWN)
+		}
+	}
+	return &CollectResult{
+		AcceptedDatapoints: int64(result.AcceptedDatapoints),
+		RejectedDatapoints: int64(result.RejectedDatapoints),
+		Reasons:            reasons,
+		Utilization:        result.Utilization,
+	}
+}
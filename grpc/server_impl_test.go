@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/hub"
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestCollectStream(t *testing.T) {
+	piece := &MetricFamilies{Families: []*dto.MetricFamily{makeFamily("fam1", 10)}}
+	metricHub := hub.NewMetricHub(0, 10)
+	// a collection of three pieces is over the max message size
+	client, stop := startTestMetricsControllerServer(t, metricHub, PushLimits{MaxDatapoints: 10}, 2*proto.Size(piece))
+	defer stop()
+
+	whole := &MetricFamilies{Families: []*dto.MetricFamily{makeFamily("fam1", 10), makeFamily("fam2", 10), makeFamily("fam3", 10)}}
+	_, err := client.Collect(context.Background(), whole)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	stream, err := client.CollectStream(context.Background())
+	assert.NoError(t, err)
+	for _, family := range whole.Families {
+		assert.NoError(t, stream.Send(&MetricFamilies{Families: []*dto.MetricFamily{family}}))
+	}
+	_, err = stream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Equal(t, 30, metricHub.Status().Datapoints)
+}
+
+func TestCollectStreamPushLimits(t *testing.T) {
+	metricHub := hub.NewMetricHub(0, 10)
+	client, stop := startTestMetricsControllerServer(t, metricHub, PushLimits{MaxDatapoints: 2}, 1024*1024)
+	defer stop()
+
+	stream, err := client.CollectStream(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&MetricFamilies{Families: []*dto.MetricFamily{makeFamily("fam1", 2)}}))
+	assert.NoError(t, stream.Send(&MetricFamilies{Families: []*dto.MetricFamily{makeFamily("fam2", 3)}}))
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	// messages before the one over the limits are stored
+	assert.Equal(t, 2, metricHub.Status().Datapoints)
+}
+
+func startTestMetricsControllerServer(t *testing.T, metricHub *hub.MetricHub, limits PushLimits, maxMsgSize int) (MetricsControllerClient, func()) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.MaxRecvMsgSize(maxMsgSize))
+	RegisterMetricsControllerServer(server, &MetricsControllerServerImpl{MetricHub: metricHub, Limits: limits})
+	go server.Serve(listener)
+
+	dialer := func(context.Context, string) (net.Conn, error) { return listener.Dial() }
+	conn, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	assert.NoError(t, err)
+	return NewMetricsControllerClient(conn), func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func TestCollectAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	metricHub := hub.NewMetricHub(0, 10, hub.WithAccessLog(hub.NewAccessLog(&buf)))
+	client, stop := startTestMetricsControllerServer(t, metricHub, PushLimits{MaxDatapoints: 2}, 1024*1024)
+	defer stop()
+
+	accepted := &MetricFamilies{Families: []*dto.MetricFamily{makeFamily("fam1", 2)}}
+	_, err := client.Collect(context.Background(), accepted)
+	assert.NoError(t, err)
+	_, err = client.Collect(context.Background(), &MetricFamilies{Families: []*dto.MetricFamily{makeFamily("fam2", 3)}})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	decoder := json.NewDecoder(&buf)
+	var entry hub.AccessLogEntry
+	assert.NoError(t, decoder.Decode(&entry))
+	assert.Equal(t, "grpc", entry.Transport)
+	assert.Equal(t, hub.AccessKindPush, entry.Kind)
+	assert.Equal(t, "bufconn", entry.Source)
+	assert.Equal(t, proto.Size(accepted), entry.Bytes)
+	assert.Equal(t, 2, entry.Datapoints)
+	assert.Equal(t, hub.AccessResultAccepted, entry.Result)
+
+	entry = hub.AccessLogEntry{}
+	assert.NoError(t, decoder.Decode(&entry))
+	assert.Equal(t, 3, entry.Datapoints)
+	assert.Equal(t, 3, entry.RejectedDatapoints)
+	assert.Equal(t, hub.AccessResultRejected, entry.Result)
+	assert.Equal(t, hub.ErrorCodeLimitExceeded, entry.Code)
+	assert.False(t, decoder.More())
+}
+
+func TestCollectThrottleTrailer(t *testing.T) {
+	metricHub := hub.NewMetricHub(10, 10, hub.WithThrottleHints(50, 10*time.Second))
+	client, stop := startTestMetricsControllerServer(t, metricHub, PushLimits{}, 1024*1024)
+	defer stop()
+
+	var trailer metadata.MD
+	_, err := client.Collect(context.Background(), &MetricFamilies{Families: []*dto.MetricFamily{makeFamily("fam1", 4)}}, grpc.Trailer(&trailer))
+	assert.NoError(t, err)
+	_, ok := ParseThrottleHint(trailer)
+	assert.False(t, ok)
+
+	_, err = client.Collect(context.Background(), &MetricFamilies{Families: []*dto.MetricFamily{makeFamily("fam2", 4)}}, grpc.Trailer(&trailer))
+	assert.NoError(t, err)
+	hint, ok := ParseThrottleHint(trailer)
+	assert.True(t, ok)
+	assert.Equal(t, hub.ThrottleHint{Delay: 6 * time.Second, RemainingDatapoints: 2}, hint)
+
+	// a push rejected for the hub limit carries the hint too
+	result, err := client.CollectWithResult(context.Background(), &MetricFamilies{Families: []*dto.MetricFamily{makeFamily("fam3", 4)}}, grpc.Trailer(&trailer))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), result.GetRejectedDatapoints())
+	hint, ok = ParseThrottleHint(trailer)
+	assert.True(t, ok)
+	assert.Equal(t, 2, hint.RemainingDatapoints)
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package grpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	rpcTypeUnary        = "unary"
+	rpcTypeClientStream = "client_stream"
+	rpcTypeServerStream = "server_stream"
+	rpcTypeBidiStream   = "bidi_stream"
+)
+
+var (
+	rpcLabels = []string{"grpc_type", "grpc_service", "grpc_method"}
+
+	rpcsStarted         = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "grpc_server_started_total", Help: "Number of RPCs started on the server"}, rpcLabels)
+	rpcsHandled         = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "grpc_server_handled_total", Help: "Number of RPCs completed on the server, by status code"}, append(rpcLabels, "grpc_code"))
+	rpcHandlingSeconds  = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "grpc_server_handling_seconds", Help: "Time to handle RPCs on the server", Buckets: prometheus.DefBuckets}, rpcLabels)
+	rpcMsgsReceived     = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "grpc_server_msg_received_total", Help: "Number of messages received by the server"}, rpcLabels)
+	rpcMsgsSent         = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "grpc_server_msg_sent_total", Help: "Number of messages sent by the server"}, rpcLabels)
+	rpcMsgBytesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "grpc_server_msg_received_bytes_total", Help: "Size of messages received by the server"}, rpcLabels)
+	rpcMsgBytesSent     = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "grpc_server_msg_sent_bytes_total", Help: "Size of messages sent by the server"}, rpcLabels)
+)
+
+func init() {
+	prometheus.MustRegister(rpcsStarted, rpcsHandled, rpcHandlingSeconds, rpcMsgsReceived, rpcMsgsSent, rpcMsgBytesReceived, rpcMsgBytesSent)
+}
+
+// ServerMetricsOptions returns server options that record RPC counts, latency,
+// status codes and message sizes of every service on the server as internal
+// metrics
+func ServerMetricsOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(unaryServerMetrics),
+		grpc.StreamInterceptor(streamServerMetrics),
+	}
+}
+
+func unaryServerMetrics(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	labels := newRPCLabels(rpcTypeUnary, info.FullMethod)
+	t0 := time.Now()
+	rpcsStarted.WithLabelValues(labels...).Inc()
+	recordMsg(labels, rpcMsgsReceived, rpcMsgBytesReceived, req)
+
+	resp, err := handler(ctx, req)
+	if err == nil {
+		recordMsg(labels, rpcMsgsSent, rpcMsgBytesSent, resp)
+	}
+	rpcsHandled.WithLabelValues(append(labels, status.Code(err).String())...).Inc()
+	rpcHandlingSeconds.WithLabelValues(labels...).Observe(time.Since(t0).Seconds())
+	return resp, err
+}
+
+func streamServerMetrics(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	rpcType := rpcTypeBidiStream
+	if !info.IsClientStream {
+		rpcType = rpcTypeServerStream
+	} else if !info.IsServerStream {
+		rpcType = rpcTypeClientStream
+	}
+	labels := newRPCLabels(rpcType, info.FullMethod)
+	t0 := time.Now()
+	rpcsStarted.WithLabelValues(labels...).Inc()
+
+	err := handler(srv, &monitoredServerStream{ServerStream: stream, labels: labels})
+	rpcsHandled.WithLabelValues(append(labels, status.Code(err).String())...).Inc()
+	rpcHandlingSeconds.WithLabelValues(labels...).Observe(time.Since(t0).Seconds())
+	return err
+}
+
+// monitoredServerStream records the messages sent and received on a stream
+type monitoredServerStream struct {
+	grpc.ServerStream
+	labels []string
+}
+
+func (s *monitoredServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		recordMsg(s.labels, rpcMsgsSent, rpcMsgBytesSent, m)
+	}
+	return err
+}
+
+func (s *monitoredServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		recordMsg(s.labels, rpcMsgsReceived, rpcMsgBytesReceived, m)
+	}
+	return err
+}
+
+// newRPCLabels splits a full method name like /edgehub.v1.EdgeHubService/Collect
+// into the rpc label values
+func newRPCLabels(rpcType, fullMethod string) []string {
+	service, method := "unknown", "unknown"
+	if parts := strings.SplitN(strings.TrimPrefix(fullMethod, "/"), "/", 2); len(parts) == 2 {
+		service, method = parts[0], parts[1]
+	}
+	return []string{rpcType, service, method}
+}
+
+func recordMsg(labels []string, count, bytes *prometheus.CounterVec, msg interface{}) {
+	count.WithLabelValues(labels...).Inc()
+	if m, ok := msg.(proto.Message); ok {
+		bytes.WithLabelValues(labels...).Add(float64(proto.Size(m)))
+	}
+}
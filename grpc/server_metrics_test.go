@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package grpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	edgehubv1 "github.com/facebookincubator/prometheus-edge-hub/grpc/edgehub/v1"
+	"github.com/facebookincubator/prometheus-edge-hub/hub"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestServerMetrics(t *testing.T) {
+	client, stop := startTestServer(t, PushLimits{MaxDatapoints: 2})
+	defer stop()
+
+	collect := []string{rpcTypeUnary, "edgehub.v1.EdgeHubService", "Collect"}
+	collectStream := []string{rpcTypeBidiStream, "edgehub.v1.EdgeHubService", "CollectStream"}
+	startedCollects := testutil.ToFloat64(rpcsStarted.WithLabelValues(collect...))
+	okCollects := testutil.ToFloat64(rpcsHandled.WithLabelValues(append(collect, "OK")...))
+	exhaustedCollects := testutil.ToFloat64(rpcsHandled.WithLabelValues(append(collect, "ResourceExhausted")...))
+	streamMsgsReceived := testutil.ToFloat64(rpcMsgsReceived.WithLabelValues(collectStream...))
+	streamMsgsSent := testutil.ToFloat64(rpcMsgsSent.WithLabelValues(collectStream...))
+
+	_, err := client.Collect(context.Background(), &edgehubv1.CollectRequest{Families: []*dto.MetricFamily{makeFamily("fam1", 2)}})
+	assert.NoError(t, err)
+	_, err = client.Collect(context.Background(), &edgehubv1.CollectRequest{Families: []*dto.MetricFamily{makeFamily("fam1", 3)}})
+	assert.Error(t, err)
+
+	assert.Equal(t, startedCollects+2, testutil.ToFloat64(rpcsStarted.WithLabelValues(collect...)))
+	assert.Equal(t, okCollects+1, testutil.ToFloat64(rpcsHandled.WithLabelValues(append(collect, "OK")...)))
+	assert.Equal(t, exhaustedCollects+1, testutil.ToFloat64(rpcsHandled.WithLabelValues(append(collect, "ResourceExhausted")...)))
+	assert.True(t, testutil.ToFloat64(rpcMsgBytesReceived.WithLabelValues(collect...)) > 0)
+
+	stream, err := client.CollectStream(context.Background())
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, stream.Send(&edgehubv1.CollectStreamRequest{Families: []*dto.MetricFamily{makeFamily("fam1", 1)}}))
+		_, err := stream.Recv()
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, stream.CloseSend())
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+
+	assert.Equal(t, streamMsgsReceived+3, testutil.ToFloat64(rpcMsgsReceived.WithLabelValues(collectStream...)))
+	assert.Equal(t, streamMsgsSent+3, testutil.ToFloat64(rpcMsgsSent.WithLabelValues(collectStream...)))
+}
+
+func TestNewRPCLabels(t *testing.T) {
+	assert.Equal(t, []string{rpcTypeUnary, "grpc.MetricsController", "Collect"}, newRPCLabels(rpcTypeUnary, "/grpc.MetricsController/Collect"))
+	assert.Equal(t, []string{rpcTypeUnary, "unknown", "unknown"}, newRPCLabels(rpcTypeUnary, "garbage"))
+}
+
+func startTestServer(t *testing.T, limits PushLimits) (edgehubv1.EdgeHubServiceClient, func()) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(ServerMetricsOptions()...)
+	edgehubv1.RegisterEdgeHubServiceServer(server, &EdgeHubServerImpl{MetricHub: hub.NewMetricHub(0, 10), Limits: limits})
+	go server.Serve(listener)
+
+	dialer := func(context.Context, string) (net.Conn, error) { return listener.Dial() }
+	conn, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	assert.NoError(t, err)
+	return edgehubv1.NewEdgeHubServiceClient(conn), func() {
+		conn.Close()
+		server.Stop()
+	}
+}
@@ -32,6 +32,53 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+type RejectReason int32
+
+const (
+	RejectReason_UNKNOWN RejectReason = 0
+	// Accepting the datapoints would exceed the hub limit
+	RejectReason_LIMIT_EXCEEDED RejectReason = 1
+	// The datapoints were over the quota of one of their label values
+	RejectReason_QUOTA_EXCEEDED RejectReason = 2
+	// The push had datapoints without a tenant on the tenant allowlist
+	RejectReason_UNKNOWN_TENANT RejectReason = 3
+	// The datapoints were of new series of a source or family over its series
+	// churn limit
+	RejectReason_SERIES_CHURN RejectReason = 4
+	// The push had datapoints without a timestamp and the hub rejects those
+	RejectReason_MISSING_TIMESTAMP RejectReason = 5
+	// The push had datapoints without one of the identity labels of the hub
+	RejectReason_MISSING_IDENTITY RejectReason = 6
+)
+
+var RejectReason_name = map[int32]string{
+	0: "UNKNOWN",
+	1: "LIMIT_EXCEEDED",
+	2: "QUOTA_EXCEEDED",
+	3: "UNKNOWN_TENANT",
+	4: "SERIES_CHURN",
+	5: "MISSING_TIMESTAMP",
+	6: "MISSING_IDENTITY",
+}
+
+var RejectReason_value = map[string]int32{
+	"UNKNOWN":           0,
+	"LIMIT_EXCEEDED":    1,
+	"QUOTA_EXCEEDED":    2,
+	"UNKNOWN_TENANT":    3,
+	"SERIES_CHURN":      4,
+	"MISSING_TIMESTAMP": 5,
+	"MISSING_IDENTITY":  6,
+}
+
+func (x RejectReason) String() string {
+	return proto.EnumName(RejectReason_name, int32(x))
+}
+
+func (RejectReason) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_a0b84a42fa06f626, []int{0}
+}
+
 type MetricFamilies struct {
 	Families             []*_go.MetricFamily `protobuf:"bytes,1,rep,name=families,proto3" json:"families,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
@@ -102,27 +149,111 @@ func (m *Void) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_Void proto.InternalMessageInfo
 
+type CollectResult struct {
+	// Number of pushed datapoints stored in the hub
+	AcceptedDatapoints int64 `protobuf:"varint,1,opt,name=accepted_datapoints,json=acceptedDatapoints,proto3" json:"accepted_datapoints,omitempty"`
+	// Number of pushed datapoints the hub did not store
+	RejectedDatapoints int64 `protobuf:"varint,2,opt,name=rejected_datapoints,json=rejectedDatapoints,proto3" json:"rejected_datapoints,omitempty"`
+	// Why datapoints were rejected. Empty if everything was accepted
+	Reasons []RejectReason `protobuf:"varint,3,rep,packed,name=reasons,proto3,enum=grpc.RejectReason" json:"reasons,omitempty"`
+	// Hub utilization (percent of the limit) after the push. 0 if the hub has no limit
+	Utilization          float64  `protobuf:"fixed64,4,opt,name=utilization,proto3" json:"utilization,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CollectResult) Reset()         { *m = CollectResult{} }
+func (m *CollectResult) String() string { return proto.CompactTextString(m) }
+func (*CollectResult) ProtoMessage()    {}
+func (*CollectResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a0b84a42fa06f626, []int{2}
+}
+
+func (m *CollectResult) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CollectResult.Unmarshal(m, b)
+}
+func (m *CollectResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CollectResult.Marshal(b, m, deterministic)
+}
+func (m *CollectResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CollectResult.Merge(m, src)
+}
+func (m *CollectResult) XXX_Size() int {
+	return xxx_messageInfo_CollectResult.Size(m)
+}
+func (m *CollectResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_CollectResult.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CollectResult proto.InternalMessageInfo
+
+func (m *CollectResult) GetAcceptedDatapoints() int64 {
+	if m != nil {
+		return m.AcceptedDatapoints
+	}
+	return 0
+}
+
+func (m *CollectResult) GetRejectedDatapoints() int64 {
+	if m != nil {
+		return m.RejectedDatapoints
+	}
+	return 0
+}
+
+func (m *CollectResult) GetReasons() []RejectReason {
+	if m != nil {
+		return m.Reasons
+	}
+	return nil
+}
+
+func (m *CollectResult) GetUtilization() float64 {
+	if m != nil {
+		return m.Utilization
+	}
+	return 0
+}
+
 func init() {
+	proto.RegisterEnum("grpc.RejectReason", RejectReason_name, RejectReason_value)
 	proto.RegisterType((*MetricFamilies)(nil), "grpc.MetricFamilies")
 	proto.RegisterType((*Void)(nil), "grpc.Void")
+	proto.RegisterType((*CollectResult)(nil), "grpc.CollectResult")
 }
 
 func init() { proto.RegisterFile("service.proto", fileDescriptor_a0b84a42fa06f626) }
 
 var fileDescriptor_a0b84a42fa06f626 = []byte{
-	// 179 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x2d, 0x4e, 0x2d, 0x2a,
-	0xcb, 0x4c, 0x4e, 0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x49, 0x2f, 0x2a, 0x48, 0x96,
-	0x92, 0x2c, 0xc9, 0xc8, 0x2c, 0x4a, 0xd1, 0x2d, 0x48, 0x2c, 0x2a, 0xa9, 0xd4, 0xcf, 0x4d, 0x2d,
-	0x29, 0xca, 0x4c, 0x2e, 0x86, 0x28, 0x50, 0x0a, 0xe0, 0xe2, 0xf3, 0x05, 0x0b, 0xb8, 0x25, 0xe6,
-	0x66, 0xe6, 0x64, 0xa6, 0x16, 0x0b, 0xd9, 0x71, 0x71, 0xa4, 0x41, 0xd9, 0x12, 0x8c, 0x0a, 0xcc,
-	0x1a, 0xdc, 0x46, 0x4a, 0x7a, 0x99, 0xf9, 0x20, 0xe5, 0xb9, 0xa9, 0x25, 0x19, 0xa9, 0xa5, 0xc5,
-	0x7a, 0xc9, 0x39, 0x99, 0xa9, 0x79, 0x25, 0x7a, 0x48, 0xfa, 0x2a, 0x83, 0xe0, 0x7a, 0x94, 0xd8,
-	0xb8, 0x58, 0xc2, 0xf2, 0x33, 0x53, 0x8c, 0x9c, 0xb8, 0x04, 0x21, 0x2a, 0x8a, 0x9d, 0xf3, 0xf3,
-	0x4a, 0x8a, 0xf2, 0x73, 0x72, 0x52, 0x8b, 0x84, 0x74, 0xb9, 0xd8, 0x9d, 0x41, 0xac, 0xe4, 0x12,
-	0x21, 0x11, 0x3d, 0x90, 0xdb, 0xf4, 0x50, 0x6d, 0x97, 0xe2, 0x82, 0x88, 0x82, 0x4c, 0x50, 0x62,
-	0x48, 0x62, 0x03, 0x3b, 0xd2, 0x18, 0x10, 0x00, 0x00, 0xff, 0xff, 0x9e, 0xf7, 0x07, 0xc1, 0xd6,
-	0x00, 0x00, 0x00,
+	// 423 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x92, 0xcf, 0x6e, 0xd3, 0x40,
+	0x10, 0xc6, 0xb3, 0x75, 0x48, 0xd0, 0xa4, 0x8d, 0x9c, 0x6d, 0x91, 0x42, 0x4f, 0x91, 0x4f, 0x16,
+	0xa2, 0xae, 0x14, 0xc4, 0x15, 0x11, 0x25, 0x0b, 0x58, 0x60, 0xb7, 0xac, 0x1d, 0x0a, 0x27, 0xcb,
+	0x38, 0x0b, 0x59, 0xe4, 0x78, 0xad, 0xdd, 0x09, 0x52, 0x79, 0x10, 0x5e, 0x86, 0x13, 0x6f, 0x86,
+	0xfc, 0x27, 0x21, 0x45, 0x1c, 0x7a, 0xb3, 0x7e, 0xf3, 0xfd, 0x34, 0xf2, 0x7c, 0x0b, 0x27, 0x46,
+	0xe8, 0xef, 0x32, 0x13, 0x5e, 0xa9, 0x15, 0x2a, 0xda, 0xfd, 0xaa, 0xcb, 0xec, 0xfc, 0x31, 0xae,
+	0xa5, 0x5e, 0x5d, 0x94, 0xa9, 0xc6, 0xdb, 0xcb, 0x8d, 0x40, 0x2d, 0x33, 0xd3, 0x04, 0x9c, 0x6b,
+	0x18, 0x06, 0x35, 0x78, 0x95, 0x6e, 0x64, 0x2e, 0x85, 0xa1, 0x2f, 0xe0, 0xe1, 0x97, 0xf6, 0x7b,
+	0x4c, 0x26, 0x96, 0x3b, 0x98, 0x3a, 0x9e, 0x54, 0x55, 0x7c, 0x23, 0x70, 0x2d, 0xb6, 0xc6, 0xcb,
+	0x72, 0x29, 0x0a, 0xf4, 0x0e, 0xbc, 0x5b, 0xbe, 0x77, 0x9c, 0x1e, 0x74, 0x3f, 0x28, 0xb9, 0x72,
+	0x7e, 0x13, 0x38, 0x99, 0xab, 0x3c, 0x17, 0x19, 0x72, 0x61, 0xb6, 0x39, 0xd2, 0x4b, 0x38, 0x4d,
+	0xb3, 0x4c, 0x94, 0x28, 0x56, 0xc9, 0x2a, 0xc5, 0xb4, 0x54, 0xb2, 0xc0, 0x6a, 0x09, 0x71, 0x2d,
+	0x4e, 0x77, 0xa3, 0xc5, 0x7e, 0x52, 0x09, 0x5a, 0x7c, 0x13, 0xd9, 0x3f, 0xc2, 0x51, 0x23, 0xec,
+	0x46, 0x07, 0xc2, 0x53, 0xe8, 0x6b, 0x91, 0x1a, 0x55, 0x98, 0xb1, 0x35, 0xb1, 0xdc, 0xe1, 0x94,
+	0x7a, 0xd5, 0x01, 0x3c, 0x5e, 0x47, 0x79, 0x3d, 0xe2, 0xbb, 0x08, 0x9d, 0xc0, 0x60, 0x8b, 0x32,
+	0x97, 0x3f, 0x52, 0x94, 0xaa, 0x18, 0x77, 0x27, 0xc4, 0x25, 0xfc, 0x10, 0x3d, 0xf9, 0x49, 0xe0,
+	0xf8, 0xd0, 0xa5, 0x03, 0xe8, 0x2f, 0xc3, 0xb7, 0xe1, 0xd5, 0x4d, 0x68, 0x77, 0x28, 0x85, 0xe1,
+	0x3b, 0x3f, 0xf0, 0xe3, 0x84, 0x7d, 0x9c, 0x33, 0xb6, 0x60, 0x0b, 0x9b, 0x54, 0xec, 0xfd, 0xf2,
+	0x2a, 0x9e, 0xfd, 0x65, 0x47, 0x15, 0x6b, 0xa5, 0x24, 0x66, 0xe1, 0x2c, 0x8c, 0x6d, 0x8b, 0xda,
+	0x70, 0x1c, 0x31, 0xee, 0xb3, 0x28, 0x99, 0xbf, 0x59, 0xf2, 0xd0, 0xee, 0xd2, 0x47, 0x30, 0x0a,
+	0xfc, 0x28, 0xf2, 0xc3, 0xd7, 0x49, 0xec, 0x07, 0x2c, 0x8a, 0x67, 0xc1, 0xb5, 0xfd, 0x80, 0x9e,
+	0x81, 0xbd, 0xc3, 0xfe, 0x82, 0x85, 0xb1, 0x1f, 0x7f, 0xb2, 0x7b, 0xd3, 0x5f, 0x04, 0x46, 0xcd,
+	0xfd, 0xcd, 0x5c, 0x15, 0xa8, 0xab, 0x3b, 0x6b, 0x7a, 0x01, 0xfd, 0xf6, 0xe2, 0xf4, 0xac, 0xf9,
+	0xf1, 0xbb, 0xdd, 0x9e, 0x43, 0x43, 0xeb, 0x7e, 0x3a, 0xf4, 0x25, 0x8c, 0xda, 0xf8, 0x8d, 0xc4,
+	0x75, 0x5b, 0xd2, 0xff, 0xc5, 0xd3, 0x86, 0xde, 0xe9, 0xd3, 0xe9, 0xd0, 0xe7, 0xfb, 0x8a, 0x23,
+	0xd4, 0x22, 0xdd, 0xdc, 0x67, 0xad, 0x4b, 0x3e, 0xf7, 0xea, 0xb7, 0xf7, 0xec, 0xcf, 0x00, 0x70,
+	0x56, 0xc5, 0x67, 0xad, 0x02, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -139,6 +270,13 @@ const _ = grpc.SupportPackageIsVersion4
 type MetricsControllerClient interface {
 	// Report a collection of metrics from a service
 	Collect(ctx context.Context, in *MetricFamilies, opts ...grpc.CallOption) (*Void, error)
+	// Report a collection of metrics from a service, returning how much of it
+	// was accepted by the hub
+	CollectWithResult(ctx context.Context, in *MetricFamilies, opts ...grpc.CallOption) (*CollectResult, error)
+	// Report a collection of metrics from a service as a stream of smaller
+	// messages, each stored as it arrives, so large collections don't need a
+	// huge max message size
+	CollectStream(ctx context.Context, opts ...grpc.CallOption) (MetricsController_CollectStreamClient, error)
 }
 
 type metricsControllerClient struct {
@@ -158,10 +296,60 @@ func (c *metricsControllerClient) Collect(ctx context.Context, in *MetricFamilie
 	return out, nil
 }
 
+func (c *metricsControllerClient) CollectWithResult(ctx context.Context, in *MetricFamilies, opts ...grpc.CallOption) (*CollectResult, error) {
+	out := new(CollectResult)
+	err := c.cc.Invoke(ctx, "/grpc.MetricsController/CollectWithResult", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsControllerClient) CollectStream(ctx context.Context, opts ...grpc.CallOption) (MetricsController_CollectStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_MetricsController_serviceDesc.Streams[0], "/grpc.MetricsController/CollectStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricsControllerCollectStreamClient{stream}
+	return x, nil
+}
+
+type MetricsController_CollectStreamClient interface {
+	Send(*MetricFamilies) error
+	CloseAndRecv() (*Void, error)
+	grpc.ClientStream
+}
+
+type metricsControllerCollectStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *metricsControllerCollectStreamClient) Send(m *MetricFamilies) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *metricsControllerCollectStreamClient) CloseAndRecv() (*Void, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(Void)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // MetricsControllerServer is the server API for MetricsController service.
 type MetricsControllerServer interface {
 	// Report a collection of metrics from a service
 	Collect(context.Context, *MetricFamilies) (*Void, error)
+	// Report a collection of metrics from a service, returning how much of it
+	// was accepted by the hub
+	CollectWithResult(context.Context, *MetricFamilies) (*CollectResult, error)
+	// Report a collection of metrics from a service as a stream of smaller
+	// messages, each stored as it arrives, so large collections don't need a
+	// huge max message size
+	CollectStream(MetricsController_CollectStreamServer) error
 }
 
 // UnimplementedMetricsControllerServer can be embedded to have forward compatible implementations.
@@ -171,6 +359,12 @@ type UnimplementedMetricsControllerServer struct {
 func (*UnimplementedMetricsControllerServer) Collect(ctx context.Context, req *MetricFamilies) (*Void, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Collect not implemented")
 }
+func (*UnimplementedMetricsControllerServer) CollectWithResult(ctx context.Context, req *MetricFamilies) (*CollectResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CollectWithResult not implemented")
+}
+func (*UnimplementedMetricsControllerServer) CollectStream(srv MetricsController_CollectStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method CollectStream not implemented")
+}
 
 func RegisterMetricsControllerServer(s *grpc.Server, srv MetricsControllerServer) {
 	s.RegisterService(&_MetricsController_serviceDesc, srv)
@@ -194,6 +388,50 @@ func _MetricsController_Collect_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MetricsController_CollectWithResult_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MetricFamilies)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsControllerServer).CollectWithResult(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/grpc.MetricsController/CollectWithResult",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsControllerServer).CollectWithResult(ctx, req.(*MetricFamilies))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsController_CollectStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricsControllerServer).CollectStream(&metricsControllerCollectStreamServer{stream})
+}
+
+type MetricsController_CollectStreamServer interface {
+	SendAndClose(*Void) error
+	Recv() (*MetricFamilies, error)
+	grpc.ServerStream
+}
+
+type metricsControllerCollectStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *metricsControllerCollectStreamServer) SendAndClose(m *Void) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *metricsControllerCollectStreamServer) Recv() (*MetricFamilies, error) {
+	m := new(MetricFamilies)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _MetricsController_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "grpc.MetricsController",
 	HandlerType: (*MetricsControllerServer)(nil),
@@ -202,7 +440,17 @@ var _MetricsController_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Collect",
 			Handler:    _MetricsController_Collect_Handler,
 		},
+		{
+			MethodName: "CollectWithResult",
+			Handler:    _MetricsController_CollectWithResult_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CollectStream",
+			Handler:       _MetricsController_CollectStream_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "service.proto",
 }
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package grpc
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/hub"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// ThrottleDelayTrailer is the trailer of Collect responses with the
+	// milliseconds a client should wait before its next push
+	ThrottleDelayTrailer = "edgehub-throttle-delay-ms"
+	// RemainingDatapointsTrailer is the trailer of Collect responses with
+	// the number of datapoints the hub can still take
+	RemainingDatapointsTrailer = "edgehub-remaining-datapoints"
+)
+
+// setThrottleTrailer adds the throttle hint of metricHub, if any, to the
+// trailer of the unary call of ctx. It is sent whether the push succeeded or
+// not.
+func setThrottleTrailer(ctx context.Context, metricHub *hub.MetricHub) {
+	hint, ok := metricHub.ThrottleHint("grpc")
+	if !ok {
+		return
+	}
+	// fails only outside of a call, where there is no one to tell
+	_ = grpc.SetTrailer(ctx, metadata.Pairs(
+		ThrottleDelayTrailer, strconv.FormatInt(int64(hint.Delay/time.Millisecond), 10),
+		RemainingDatapointsTrailer, strconv.Itoa(hint.RemainingDatapoints),
+	))
+}
+
+// ParseThrottleHint returns the throttle hint in the trailer of a Collect
+// call, received with the grpc.Trailer call option, or false if it has none
+func ParseThrottleHint(trailer metadata.MD) (hub.ThrottleHint, bool) {
+	delays := trailer.Get(ThrottleDelayTrailer)
+	if len(delays) == 0 {
+		return hub.ThrottleHint{}, false
+	}
+	delayMs, err := strconv.ParseInt(delays[0], 10, 64)
+	if err != nil {
+		return hub.ThrottleHint{}, false
+	}
+	hint := hub.ThrottleHint{Delay: time.Duration(delayMs) * time.Millisecond}
+	if remaining := trailer.Get(RemainingDatapointsTrailer); len(remaining) > 0 {
+		hint.RemainingDatapoints, _ = strconv.Atoi(remaining[0])
+	}
+	return hint, true
+}
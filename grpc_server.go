@@ -0,0 +1,50 @@
+//go:build !nogrpc
+// +build !nogrpc
+
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net"
+
+	hubgrpc "github.com/facebookincubator/prometheus-edge-hub/grpc"
+	edgehubv1 "github.com/facebookincubator/prometheus-edge-hub/grpc/edgehub/v1"
+	"github.com/facebookincubator/prometheus-edge-hub/hub"
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"google.golang.org/grpc"
+)
+
+func (c grpcConfig) limits() hubgrpc.PushLimits {
+	return hubgrpc.PushLimits{MaxDatapoints: c.maxPushDatapoints, MaxBytes: c.maxPushBytes, Deadline: c.pushDeadline}
+}
+
+// grpcCapabilities describes the gRPC server of c for the capabilities
+// endpoint
+func grpcCapabilities(c grpcConfig) (hub.GRPCCapabilities, error) {
+	return c.limits().Capabilities(c.maxMsgSize), nil
+}
+
+func serveGRPC(c grpcConfig, metricHub *hub.MetricHub) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", c.port))
+	if err != nil {
+		logging.Fatal("Failed to listen", "port", c.port, "err", err)
+	}
+
+	metricsGrpcServer := hubgrpc.MetricsControllerServerImpl{MetricHub: metricHub, Limits: c.limits()}
+	edgeHubGrpcServer := hubgrpc.EdgeHubServerImpl{MetricHub: metricHub, Limits: c.limits()}
+	serverOpts := append([]grpc.ServerOption{grpc.MaxRecvMsgSize(c.maxMsgSize)}, hubgrpc.ServerMetricsOptions()...)
+	grpcServer := grpc.NewServer(serverOpts...)
+	hubgrpc.RegisterMetricsControllerServer(grpcServer, &metricsGrpcServer)
+	edgehubv1.RegisterEdgeHubServiceServer(grpcServer, &edgeHubGrpcServer)
+
+	logging.Info("Serving gRPC", "port", c.port)
+
+	return grpcServer.Serve(lis)
+}
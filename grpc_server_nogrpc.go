@@ -0,0 +1,29 @@
+//go:build nogrpc
+// +build nogrpc
+
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package main
+
+import (
+	"errors"
+
+	"github.com/facebookincubator/prometheus-edge-hub/hub"
+)
+
+// errNoGRPC is returned by builds with the nogrpc tag, which leave out the
+// gRPC server and its dependencies to shrink the binary for tiny devices
+var errNoGRPC = errors.New("this build has no gRPC server, rebuild without the nogrpc tag")
+
+func grpcCapabilities(grpcConfig) (hub.GRPCCapabilities, error) {
+	return hub.GRPCCapabilities{}, errNoGRPC
+}
+
+func serveGRPC(grpcConfig, *hub.MetricHub) error {
+	return errNoGRPC
+}
@@ -0,0 +1,231 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// AccessLogStdout is the access log path writing entries to stdout
+	AccessLogStdout = "-"
+
+	AccessKindPush   = "push"
+	AccessKindScrape = "scrape"
+
+	AccessResultAccepted = "accepted"
+	AccessResultPartial  = "partial"
+	AccessResultRejected = "rejected"
+	AccessResultServed   = "served"
+	AccessResultFailed   = "failed"
+
+	// errorCodeKey is where respondError keeps the code of the error
+	// response in the echo context, for the access log
+	errorCodeKey = "edgehub.error_code"
+)
+
+var accessLogErrors = prometheus.NewCounter(prometheus.CounterOpts{Name: "access_log_errors_total", Help: "Number of access log entries that failed to be written"})
+
+func init() {
+	prometheus.MustRegister(accessLogErrors)
+}
+
+// AccessLogEntry accounts for a single push or scrape
+type AccessLogEntry struct {
+	Time time.Time `json:"time"`
+	// Kind is AccessKindPush or AccessKindScrape
+	Kind      string `json:"kind"`
+	Transport string `json:"transport"`
+	// Source is the address of the client
+	Source     string `json:"source"`
+	Bytes      int    `json:"bytes"`
+	Families   int    `json:"families"`
+	Datapoints int    `json:"datapoints"`
+	// RejectedDatapoints are the datapoints of a push that weren't stored
+	RejectedDatapoints int     `json:"rejected_datapoints,omitempty"`
+	DurationSeconds    float64 `json:"duration_seconds"`
+	// Result is accepted, partial or rejected for pushes, and served or
+	// failed for scrapes
+	Result string    `json:"result"`
+	Code   ErrorCode `json:"code,omitempty"`
+}
+
+// AccessLog writes an AccessLogEntry for every push and scrape as a line of
+// JSON, to account for every batch of telemetry that went through the hub
+type AccessLog struct {
+	sync.Mutex
+	w io.Writer
+}
+
+// NewAccessLog returns an access log writing to w
+func NewAccessLog(w io.Writer) *AccessLog {
+	return &AccessLog{w: w}
+}
+
+// OpenAccessLog returns an access log writing to stdout if path is
+// AccessLogStdout, and to the file at path otherwise. Once the file reaches
+// maxBytes, it is rotated to path.1, keeping up to maxFiles rotated files.
+// maxBytes <= 0 never rotates.
+func OpenAccessLog(path string, maxBytes int64, maxFiles int) (*AccessLog, error) {
+	if path == AccessLogStdout {
+		return NewAccessLog(os.Stdout), nil
+	}
+	file, err := openRotatingFile(path, maxBytes, maxFiles)
+	if err != nil {
+		return nil, err
+	}
+	return NewAccessLog(file), nil
+}
+
+// WithAccessLog writes an entry for every push and scrape to log
+func WithAccessLog(log *AccessLog) Option {
+	return func(hub *MetricHub) {
+		hub.accessLog = log
+	}
+}
+
+// LogAccess writes entry to the access log of the hub, if it has one. The
+// time of the entry is set to now if it is zero.
+func (c *MetricHub) LogAccess(entry AccessLogEntry) {
+	if c.accessLog == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = c.clock.Now()
+	}
+	c.accessLog.write(entry)
+}
+
+func (l *AccessLog) write(entry AccessLogEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		accessLogErrors.Inc()
+		return
+	}
+	line = append(line, '\n')
+	l.Lock()
+	defer l.Unlock()
+	if _, err := l.w.Write(line); err != nil {
+		accessLogErrors.Inc()
+		logging.Error("Error writing access log", "err", err)
+	}
+}
+
+// logHTTPAccess completes entry of an HTTP request started at t0 with the
+// result of its response, and writes it to the access log
+func (c *MetricHub) logHTTPAccess(ctx echo.Context, entry *AccessLogEntry, t0 time.Time) {
+	if c.accessLog == nil {
+		return
+	}
+	entry.DurationSeconds = time.Since(t0).Seconds()
+	status := ctx.Response().Status
+	if code, ok := ctx.Get(errorCodeKey).(ErrorCode); ok {
+		entry.Code = code
+	}
+	if entry.Kind == AccessKindScrape {
+		entry.Bytes = int(ctx.Response().Size)
+		entry.Result = AccessResultServed
+		if status >= http.StatusBadRequest {
+			entry.Result = AccessResultFailed
+		}
+	} else {
+		entry.Result = pushResult(status, entry)
+	}
+	c.LogAccess(*entry)
+}
+
+// pushResult returns the access log result of a push answered with status
+func pushResult(status int, entry *AccessLogEntry) string {
+	switch {
+	case status >= http.StatusBadRequest:
+		entry.RejectedDatapoints = entry.Datapoints
+		return AccessResultRejected
+	case entry.RejectedDatapoints > 0:
+		return AccessResultPartial
+	}
+	return AccessResultAccepted
+}
+
+// rotatingFile is a file rotated to path.1, path.2... once it reaches
+// maxBytes
+type rotatingFile struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func openRotatingFile(path string, maxBytes int64, maxFiles int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxBytes: maxBytes, maxFiles: maxFiles}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size = file, info.Size()
+	return nil
+}
+
+// Write appends p, rotating the file first if p would take it over maxBytes.
+// Callers serialize writes.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.maxBytes > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			logging.Error("Error rotating access log", "path", r.path, "err", err)
+			if r.file == nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate reopens the file after moving it aside, or after removing it if no
+// rotated files are kept. If moving it fails, writes continue in the same file.
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+	r.file = nil
+	var err error
+	if r.maxFiles > 0 {
+		for i := r.maxFiles - 1; i > 0; i-- {
+			// missing older files are fine
+			_ = os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		err = os.Rename(r.path, r.path+".1")
+	} else {
+		err = os.Remove(r.path)
+	}
+	if openErr := r.open(); openErr != nil {
+		return openErr
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLogPushes(t *testing.T) {
+	var buf bytes.Buffer
+	hub := NewMetricHub(3, 10, WithAccessLog(NewAccessLog(&buf)), WithLimitPolicy(LimitPolicyPartial))
+
+	_, err := receiveString(hub, "a 1\nb{x=\"1\"} 1\nb{x=\"2\"} 1\n")
+	assert.NoError(t, err)
+	_, err = receiveString(hub, "c 1\n")
+	assert.NoError(t, err)
+	_, err = receiveString(hub, "bad metric string")
+	assert.NoError(t, err)
+
+	entries := accessLogEntries(t, &buf)
+	assert.Equal(t, 3, len(entries))
+	for _, entry := range entries {
+		assert.Equal(t, AccessKindPush, entry.Kind)
+		assert.Equal(t, "http", entry.Transport)
+		assert.Equal(t, "192.0.2.1", entry.Source)
+		assert.False(t, entry.Time.IsZero())
+	}
+	assert.Equal(t, AccessLogEntry{Bytes: 26, Families: 2, Datapoints: 3, Result: AccessResultAccepted}, withoutCommonFields(entries[0]))
+	assert.Equal(t, AccessLogEntry{Bytes: 4, Families: 1, Datapoints: 1, RejectedDatapoints: 1, Result: AccessResultPartial}, withoutCommonFields(entries[1]))
+	assert.Equal(t, AccessLogEntry{Bytes: 17, Result: AccessResultRejected, Code: ErrorCodeParseError}, withoutCommonFields(entries[2]))
+}
+
+func TestAccessLogScrapes(t *testing.T) {
+	var buf bytes.Buffer
+	hub := NewMetricHub(0, 10, WithAccessLog(NewAccessLog(&buf)))
+	_, err := receiveString(hub, "a 1\nb{x=\"1\"} 1\nb{x=\"2\"} 1\n")
+	assert.NoError(t, err)
+	buf.Reset()
+
+	body := scrape(t, hub)
+	entries := accessLogEntries(t, &buf)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, AccessKindScrape, entries[0].Kind)
+	assert.Equal(t, AccessLogEntry{Bytes: len(body), Families: 2, Datapoints: 3, Result: AccessResultServed}, withoutCommonFields(entries[0]))
+}
+
+func TestNoAccessLog(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	// doesn't panic without an access log
+	_, err := receiveString(hub, "a 1\n")
+	assert.NoError(t, err)
+	scrape(t, hub)
+}
+
+func TestAccessLogRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "access_log")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	log, err := OpenAccessLog(path, 100, 2)
+	assert.NoError(t, err)
+	hub := NewMetricHub(0, 10, WithAccessLog(log))
+	for i := 0; i < 4; i++ {
+		hub.LogAccess(AccessLogEntry{Kind: AccessKindPush, Transport: "http", Result: AccessResultAccepted})
+	}
+
+	// every entry is over half the max size, so each gets a file of its own,
+	// and the oldest is gone with 2 rotated files kept
+	for _, name := range []string{"access.log", "access.log.1", "access.log.2"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, strings.Count(string(data), "\n"), name)
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func accessLogEntries(t *testing.T, buf *bytes.Buffer) []AccessLogEntry {
+	var entries []AccessLogEntry
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		var entry AccessLogEntry
+		assert.NoError(t, decoder.Decode(&entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// withoutCommonFields clears the fields that don't depend on the push or
+// scrape, so entries can be compared
+func withoutCommonFields(entry AccessLogEntry) AccessLogEntry {
+	entry.Time, entry.Kind, entry.Transport, entry.Source, entry.DurationSeconds = time.Time{}, "", "", "", 0
+	return entry
+}
@@ -0,0 +1,316 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	// aggregatorUpFamilyName is the family added to aggregated scrapes with
+	// whether each hub was scraped successfully
+	aggregatorUpFamilyName = "edgehub_aggregator_hub_up"
+)
+
+var (
+	aggregatorScrapeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "aggregator_hub_scrape_failures_total", Help: "Number of failed scrapes of each hub by the aggregator"}, []string{"hub"})
+	aggregatorScrapeDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "aggregator_hub_scrape_seconds", Help: "Duration of the last scrape of each hub by the aggregator"}, []string{"hub"})
+	aggregatorTypeConflicts  = prometheus.NewCounter(prometheus.CounterOpts{Name: "aggregator_type_conflicts_total", Help: "Number of families dropped from a hub's scrape because another hub exposed a family with the same name and a different type"})
+)
+
+func init() {
+	prometheus.MustRegister(aggregatorScrapeFailures, aggregatorScrapeDuration, aggregatorTypeConflicts)
+}
+
+// AggregatorTarget is a hub scraped by an Aggregator
+type AggregatorTarget struct {
+	// Name is the value of the hub label added to the series of the hub
+	Name string
+	// URL is the scrape endpoint of the hub, e.g. http://site1:9091/metrics
+	URL string
+}
+
+// ParseAggregatorTarget parses a target of the form NAME=URL
+func ParseAggregatorTarget(spec string) (AggregatorTarget, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return AggregatorTarget{}, fmt.Errorf("invalid hub %q, must be NAME=URL", spec)
+	}
+	return AggregatorTarget{Name: parts[0], URL: parts[1]}, nil
+}
+
+// Aggregator scrapes a list of hubs and serves their merged contents, so a
+// central Prometheus can scrape one target per region instead of one per site.
+// Every series gets a label with the name of the hub it came from. Since
+// scraping a hub drains it, the hubs should not be scraped by anything else.
+type Aggregator struct {
+	targets []AggregatorTarget
+	label   string
+	client  *http.Client
+}
+
+// NewAggregator returns an Aggregator scraping targets with timeout, and
+// adding label to their series
+func NewAggregator(targets []AggregatorTarget, label string, timeout time.Duration) (*Aggregator, error) {
+	if label == "" {
+		return nil, fmt.Errorf("hub label must not be empty")
+	}
+	for i, r := range label {
+		if !isValidLabelNameChar(r, i == 0) {
+			return nil, fmt.Errorf("invalid hub label %q", label)
+		}
+	}
+	return &Aggregator{
+		targets: targets,
+		label:   label,
+		client:  &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// aggregatedFamily is the exposition text of a family merged from the hubs
+type aggregatedFamily struct {
+	comments   []string
+	metricType string
+	samples    []string
+}
+
+// Scrape is a handler function scraping every hub concurrently and serving
+// their families merged by name. The query of the request, e.g. min_age, is
+// passed on to the hubs. Hubs that fail are left out, and reported with
+// edgehub_aggregator_hub_up.
+func (a *Aggregator) Scrape(ctx echo.Context) error {
+	query := ctx.QueryString()
+	outputs := make([][]byte, len(a.targets))
+	waitGroup := &sync.WaitGroup{}
+	for i, target := range a.targets {
+		waitGroup.Add(1)
+		go func(i int, target AggregatorTarget) {
+			defer waitGroup.Done()
+			t0 := time.Now()
+			output, err := a.scrapeHub(target.URL, query)
+			aggregatorScrapeDuration.WithLabelValues(target.Name).Set(time.Since(t0).Seconds())
+			if err != nil {
+				aggregatorScrapeFailures.WithLabelValues(target.Name).Inc()
+				logging.Error("Error scraping hub", "hub", target.Name, "err", err)
+				return
+			}
+			outputs[i] = output
+		}(i, target)
+	}
+	waitGroup.Wait()
+
+	families := make(map[string]*aggregatedFamily)
+	up := &aggregatedFamily{
+		comments:   []string{fmt.Sprintf("# HELP %s Whether the last scrape of the hub succeeded.", aggregatorUpFamilyName), fmt.Sprintf("# TYPE %s gauge", aggregatorUpFamilyName)},
+		metricType: "gauge",
+	}
+	for i, target := range a.targets {
+		value := 0
+		if outputs[i] != nil {
+			value = 1
+			a.merge(families, target.Name, outputs[i])
+		}
+		up.samples = append(up.samples, fmt.Sprintf("%s{%s=\"%s\"} %d", aggregatorUpFamilyName, a.label, escapeLabelValue(target.Name), value))
+	}
+	families[aggregatorUpFamilyName] = up
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var resp strings.Builder
+	for _, name := range names {
+		for _, line := range families[name].comments {
+			resp.WriteString(line + "\n")
+		}
+		for _, line := range families[name].samples {
+			resp.WriteString(line + "\n")
+		}
+	}
+	return ctx.Blob(http.StatusOK, string(expfmt.FmtText), []byte(resp.String()))
+}
+
+func (a *Aggregator) scrapeHub(url, query string) ([]byte, error) {
+	if query != "" {
+		url += "?" + query
+	}
+	resp, err := a.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("hub responded %d: %s", resp.StatusCode, msg)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// merge adds the families in the exposition text of hub to families. The
+// text is merged line by line rather than parsed, since the text parser folds
+// summary and histogram datapoints of a series at different timestamps into
+// one. A family whose type differs from that of the hubs merged before is
+// dropped, and its HELP is only kept if no earlier hub had one. Malformed
+// samples are skipped.
+func (a *Aggregator) merge(families map[string]*aggregatedFamily, hub string, output []byte) {
+	// the families of this hub, and whether they conflict with earlier hubs
+	seen := make(map[string]bool)
+	var family *aggregatedFamily
+	conflict := false
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) < 3 || (fields[1] != "HELP" && fields[1] != "TYPE") {
+				continue
+			}
+			family, conflict = a.family(families, seen, fields[2])
+			if conflict {
+				continue
+			}
+			if fields[1] == "TYPE" {
+				metricType := "untyped"
+				if len(fields) > 3 {
+					metricType = fields[3]
+				}
+				if family.metricType == "" {
+					family.metricType = metricType
+					family.comments = append(family.comments, line)
+				} else if family.metricType != metricType {
+					aggregatorTypeConflicts.Inc()
+					logging.Warn("Dropping family whose type differs from other hubs", "family", fields[2], "hub", hub, "type", metricType, "other_type", family.metricType)
+					seen[fields[2]] = false
+					conflict = true
+				}
+			} else if !hasHelp(family.comments) {
+				family.comments = append([]string{line}, family.comments...)
+			}
+			continue
+		}
+
+		if family == nil {
+			// a sample without HELP or TYPE is its own untyped family
+			family, conflict = a.family(families, seen, sampleName(line))
+		}
+		if conflict {
+			continue
+		}
+		sample, err := addLabel(line, a.label, hub)
+		if err != nil {
+			logging.Warn("Skipping sample", "hub", hub, "err", err)
+			continue
+		}
+		family.samples = append(family.samples, sample)
+	}
+}
+
+// family returns the aggregated family name, creating it on the first hub
+// exposing it, and whether the family is dropped for this hub
+func (a *Aggregator) family(families map[string]*aggregatedFamily, seen map[string]bool, name string) (*aggregatedFamily, bool) {
+	family, ok := families[name]
+	if !ok {
+		family = &aggregatedFamily{}
+		families[name] = family
+	}
+	keep, ok := seen[name]
+	if !ok {
+		seen[name] = true
+		return family, false
+	}
+	return family, !keep
+}
+
+func hasHelp(comments []string) bool {
+	for _, line := range comments {
+		if strings.HasPrefix(line, "# HELP ") {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleName returns the metric name of a sample line
+func sampleName(line string) string {
+	if i := strings.IndexAny(line, "{ \t"); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+// addLabel adds name="value" to the labels of a sample line. A label with
+// the same name already on the sample is renamed exported_<name>, as
+// Prometheus does for conflicting target labels.
+func addLabel(line, name, value string) (string, error) {
+	metricName := sampleName(line)
+	rest := line[len(metricName):]
+	label := fmt.Sprintf("%s=\"%s\"", name, escapeLabelValue(value))
+	if !strings.HasPrefix(rest, "{") {
+		return metricName + "{" + label + "}" + rest, nil
+	}
+
+	// find the existing labels, skipping over quoted values
+	var labels strings.Builder
+	i := 1
+	for {
+		for i < len(rest) && (rest[i] == ' ' || rest[i] == ',') {
+			i++
+		}
+		if i >= len(rest) {
+			return "", fmt.Errorf("unterminated labels in %q", line)
+		}
+		if rest[i] == '}' {
+			break
+		}
+		start := i
+		for i < len(rest) && rest[i] != '=' && rest[i] != ' ' {
+			i++
+		}
+		labelName := rest[start:i]
+		for i < len(rest) && rest[i] != '"' {
+			i++
+		}
+		if i >= len(rest) {
+			return "", fmt.Errorf("invalid label %q in %q", labelName, line)
+		}
+		valueStart := i
+		for i++; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] == '\\' {
+				i++
+			}
+		}
+		if i >= len(rest) {
+			return "", fmt.Errorf("unterminated value of label %q in %q", labelName, line)
+		}
+		i++
+		if labelName == name {
+			labelName = "exported_" + name
+		}
+		labels.WriteString("," + labelName + "=" + rest[valueStart:i])
+	}
+	return metricName + "{" + label + labels.String() + rest[i:], nil
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
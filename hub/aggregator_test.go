@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+// startHub serves the scrapes of a new hub holding body
+func startHub(t *testing.T, body string) (*MetricHub, *httptest.Server) {
+	hub := NewMetricHub(0, 10)
+	if body != "" {
+		_, err := receiveString(hub, body)
+		assert.NoError(t, err)
+	}
+	e := echo.New()
+	e.GET("/metrics", hub.Scrape)
+	return hub, httptest.NewServer(e)
+}
+
+func aggregate(t *testing.T, aggregator *Aggregator, query string) string {
+	req := httptest.NewRequest(http.MethodGet, "/metrics?"+query, nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, aggregator.Scrape(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestAggregator(t *testing.T) {
+	hub1, server1 := startHub(t, `# HELP up Whether the target is up.
+# TYPE up gauge
+up{job="a"} 1 1000
+up{job="a"} 0 2000
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="1"} 2 1000
+latency_seconds_bucket{le="+Inf"} 3 1000
+latency_seconds_sum 1.5 1000
+latency_seconds_count 3 1000
+`)
+	defer server1.Close()
+	_, server2 := startHub(t, `# TYPE up gauge
+up{job="b",hub="pushed"} 1 1000
+# TYPE site_only counter
+site_only 5 1000
+`)
+	defer server2.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	aggregator, err := NewAggregator([]AggregatorTarget{
+		{Name: "site1", URL: server1.URL + "/metrics"},
+		{Name: "site2", URL: server2.URL + "/metrics"},
+		{Name: "site3", URL: down.URL},
+	}, "hub", time.Second)
+	assert.NoError(t, err)
+
+	output := aggregate(t, aggregator, "")
+	assert.Equal(t, `# HELP edgehub_aggregator_hub_up Whether the last scrape of the hub succeeded.
+# TYPE edgehub_aggregator_hub_up gauge
+edgehub_aggregator_hub_up{hub="site1"} 1
+edgehub_aggregator_hub_up{hub="site2"} 1
+edgehub_aggregator_hub_up{hub="site3"} 0
+# TYPE latency_seconds histogram
+latency_seconds_bucket{hub="site1",le="1"} 2 1000
+latency_seconds_bucket{hub="site1",le="+Inf"} 3 1000
+latency_seconds_sum{hub="site1"} 1.5 1000
+latency_seconds_count{hub="site1"} 3 1000
+# TYPE site_only counter
+site_only{hub="site2"} 5 1000
+# HELP up Whether the target is up.
+# TYPE up gauge
+up{hub="site1",job="a"} 1 1000
+up{hub="site1",job="a"} 0 2000
+up{hub="site2",exported_hub="pushed",job="b"} 1 1000
+`, output)
+
+	var parser expfmt.TextParser
+	_, err = parser.TextToMetricFamilies(strings.NewReader(output))
+	assert.NoError(t, err)
+
+	// the hubs were drained
+	assert.Equal(t, 0, hub1.Status().Datapoints)
+	assert.NotContains(t, aggregate(t, aggregator, ""), "latency_seconds")
+}
+
+func TestAggregatorPassesQuery(t *testing.T) {
+	hub, server := startHub(t, "")
+	defer server.Close()
+	_, err := receiveString(hub, "old_metric 1 1000\n")
+	assert.NoError(t, err)
+	_, err = receiveString(hub, "new_metric 1 "+formatMs(time.Now().UnixNano()/int64(time.Millisecond))+"\n")
+	assert.NoError(t, err)
+
+	aggregator, err := NewAggregator([]AggregatorTarget{{Name: "site1", URL: server.URL + "/metrics"}}, "hub", time.Second)
+	assert.NoError(t, err)
+	output := aggregate(t, aggregator, "min_age=1h")
+	assert.Contains(t, output, `old_metric{hub="site1"} 1 1000`)
+	assert.NotContains(t, output, "new_metric")
+	assert.Equal(t, 1, hub.Status().Datapoints)
+}
+
+func TestAggregatorTypeConflict(t *testing.T) {
+	_, server1 := startHub(t, "# TYPE requests counter\nrequests 1 1000\n")
+	defer server1.Close()
+	_, server2 := startHub(t, "# TYPE requests gauge\nrequests 2 1000\n")
+	defer server2.Close()
+
+	aggregator, err := NewAggregator([]AggregatorTarget{
+		{Name: "site1", URL: server1.URL + "/metrics"},
+		{Name: "site2", URL: server2.URL + "/metrics"},
+	}, "site", time.Second)
+	assert.NoError(t, err)
+	output := aggregate(t, aggregator, "")
+	assert.True(t, strings.HasSuffix(output, "# TYPE requests counter\nrequests{site=\"site1\"} 1 1000\n"), output)
+	assert.NotContains(t, output, `requests{site="site2"}`)
+}
+
+func TestAddLabel(t *testing.T) {
+	for line, expected := range map[string]string{
+		`up 1`:                         `up{hub="a\"b"} 1`,
+		`up{} 1 1000`:                  `up{hub="a\"b"} 1 1000`,
+		`up{job="x"} 1`:                `up{hub="a\"b",job="x"} 1`,
+		`up{job="x}, \"y\"",le="1"} 1`: `up{hub="a\"b",job="x}, \"y\"",le="1"} 1`,
+		`up{hub="x",job="y"} 1`:        `up{hub="a\"b",exported_hub="x",job="y"} 1`,
+		`up{job="y",} NaN`:             `up{hub="a\"b",job="y"} NaN`,
+		`up{path="C:\\",job="y"} +Inf`: `up{hub="a\"b",path="C:\\",job="y"} +Inf`,
+	} {
+		labeled, err := addLabel(line, "hub", `a"b`)
+		assert.NoError(t, err, line)
+		assert.Equal(t, expected, labeled, line)
+	}
+
+	for _, line := range []string{`up{job="x" 1`, `up{job} 1`, `up{job="x`} {
+		_, err := addLabel(line, "hub", "a")
+		assert.Error(t, err, line)
+	}
+}
+
+func TestParseAggregatorTarget(t *testing.T) {
+	target, err := ParseAggregatorTarget("site1=http://site1:9091/metrics")
+	assert.NoError(t, err)
+	assert.Equal(t, AggregatorTarget{Name: "site1", URL: "http://site1:9091/metrics"}, target)
+
+	for _, spec := range []string{"", "site1", "=http://site1", "site1="} {
+		_, err := ParseAggregatorTarget(spec)
+		assert.Error(t, err, spec)
+	}
+	_, err = NewAggregator(nil, "1hub", time.Second)
+	assert.Error(t, err)
+}
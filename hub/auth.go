@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var authFailures = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "auth_failures_total", Help: "Number of HTTP requests refused for missing or invalid credentials, by handler"}, []string{"handler"})
+
+func init() {
+	prometheus.MustRegister(authFailures)
+}
+
+// Credentials are the bearer tokens and basic auth users accepted on a set of
+// endpoints. Any one of them is enough to be let in.
+type Credentials struct {
+	Tokens []string          `json:"tokens,omitempty"`
+	Users  map[string]string `json:"users,omitempty"`
+}
+
+// LoadCredentials reads JSON credentials from path, e.g.
+// {"tokens": ["..."], "users": {"prometheus": "..."}}
+func LoadCredentials(path string) (*Credentials, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	creds := &Credentials{}
+	if err := json.Unmarshal(data, creds); err != nil {
+		return nil, fmt.Errorf("error parsing credentials: %v", err)
+	}
+	if len(creds.Tokens) == 0 && len(creds.Users) == 0 {
+		return nil, fmt.Errorf("no tokens or users in credentials")
+	}
+	for _, token := range creds.Tokens {
+		if token == "" {
+			return nil, fmt.Errorf("empty token in credentials")
+		}
+	}
+	for user, password := range creds.Users {
+		if user == "" || password == "" {
+			return nil, fmt.Errorf("user without a name or password in credentials")
+		}
+	}
+	return creds, nil
+}
+
+// AuthMiddleware returns echo middleware that refuses requests without one of
+// creds with a 401. With nil creds every request is let in.
+func AuthMiddleware(creds *Credentials) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if creds == nil {
+			return next
+		}
+		return func(ctx echo.Context) error {
+			if creds.allow(ctx.Request()) {
+				return next(ctx)
+			}
+			authFailures.WithLabelValues(ctx.Path()).Inc()
+			if len(creds.Users) > 0 {
+				ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="edge-hub"`)
+			} else {
+				ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="edge-hub"`)
+			}
+			return respondError(ctx, http.StatusUnauthorized, ErrorCodeUnauthorized, nil, "missing or invalid credentials")
+		}
+	}
+}
+
+// allow checks the credentials of req. Secrets are compared in constant time,
+// and every token is compared, so timing doesn't tell which one got close.
+func (c *Credentials) allow(req *http.Request) bool {
+	if user, password, ok := req.BasicAuth(); ok {
+		expected, known := c.Users[user]
+		if !known {
+			// compare anyway, so unknown users take as long as wrong
+			// passwords
+			expected = password + "\x00"
+		}
+		return subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1 && known
+	}
+	auth := req.Header.Get(echo.HeaderAuthorization)
+	const prefix = "Bearer "
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return false
+	}
+	token := []byte(auth[len(prefix):])
+	match := 0
+	for _, expected := range c.Tokens {
+		match |= subtle.ConstantTimeCompare(token, []byte(expected))
+	}
+	return match == 1
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	load := func(creds string) error {
+		path := filepath.Join(dir, "creds.json")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(creds), 0600))
+		_, err := LoadCredentials(path)
+		return err
+	}
+
+	assert.NoError(t, load(`{"tokens": ["abc"], "users": {"prometheus": "secret"}}`))
+	assert.Error(t, load(`{}`))
+	assert.Error(t, load(`{"tokens": [""]}`))
+	assert.Error(t, load(`{"users": {"prometheus": ""}}`))
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	e := echo.New()
+	e.POST("/metrics", hub.Receive, AuthMiddleware(&Credentials{Tokens: []string{"push-token"}}))
+	e.GET("/metrics", hub.Scrape, AuthMiddleware(&Credentials{Users: map[string]string{"prometheus": "secret"}}))
+
+	push := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/metrics", strings.NewReader("up 1\n"))
+		if auth != "" {
+			req.Header.Set(echo.HeaderAuthorization, auth)
+		}
+		return serve(e, req)
+	}
+	rec := push("")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Bearer realm="edge-hub"`, rec.Header().Get(echo.HeaderWWWAuthenticate))
+	assert.Equal(t, http.StatusUnauthorized, push("Bearer other-token").Code)
+	assert.Equal(t, http.StatusUnauthorized, push("Bearer push-token-and-more").Code)
+	assert.Equal(t, 0, hub.liveDatapoints())
+	assert.Equal(t, http.StatusOK, push("Bearer push-token").Code)
+	assert.Equal(t, 1, hub.liveDatapoints())
+
+	scrapeAs := func(user, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.SetBasicAuth(user, password)
+		return serve(e, req)
+	}
+	rec = scrapeAs("prometheus", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Basic realm="edge-hub"`, rec.Header().Get(echo.HeaderWWWAuthenticate))
+	assert.Equal(t, http.StatusUnauthorized, scrapeAs("nobody", "secret").Code)
+	// push credentials don't allow scrapes
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer push-token")
+	assert.Equal(t, http.StatusUnauthorized, serve(e, req).Code)
+	assert.Equal(t, 1, hub.liveDatapoints())
+
+	rec = scrapeAs("prometheus", "secret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "up 1")
+}
+
+func TestAuthMiddlewareWithoutCredentials(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	e := echo.New()
+	e.POST("/metrics", hub.Receive, AuthMiddleware(nil))
+	rec := serve(e, httptest.NewRequest(http.MethodPost, "/metrics", strings.NewReader("up 1\n")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/labstack/echo"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// GroupingLabelsHeader is a part header of a batch push holding labels to
+	// attach to every metric in the part, URL query encoded
+	// (e.g. `job=gateway&instance=gw1`)
+	GroupingLabelsHeader = "X-Grouping-Labels"
+)
+
+// batchPartResult reports what happened to one part of a batch push
+type batchPartResult struct {
+	Part       int       `json:"part"`
+	Status     int       `json:"status"`
+	Datapoints int       `json:"datapoints"`
+	Dropped    int       `json:"dropped,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Code       ErrorCode `json:"code,omitempty"`
+}
+
+// ReceiveBatch is a handler function for pushes of several independent
+// exposition documents in one multipart request, so an agent aggregating many
+// services can push them all in one round trip. Every part may carry its own
+// grouping labels in the X-Grouping-Labels header, and is accepted or rejected
+// as a whole independently of the others.
+//
+// Responds with 200 if every part was accepted, and 207 otherwise. The body
+// lists the result of each part.
+func (c *MetricHub) ReceiveBatch(ctx echo.Context) error {
+	mediaType, params, err := mime.ParseMediaType(ctx.Request().Header.Get(echo.HeaderContentType))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "batch pushes must have a multipart content type")
+	}
+
+	tenant := ctx.Request().Header.Get(TenantHeader)
+	if tenant != "" && c.tenants != nil {
+		if err := c.tenants.admitHeader(tenant); err != nil {
+			recordRejectedPush("http", receiveErrorCode(err))
+			c.SampleRejectedPush("http", err.Error(), nil)
+			return respondReceiveError(ctx, err)
+		}
+	}
+
+	reader := multipart.NewReader(ctx.Request().Body, params["boundary"])
+	results := []batchPartResult{}
+	status := http.StatusOK
+	for i := 0; ; i++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			results = append(results, batchPartResult{Part: i, Status: http.StatusBadRequest, Error: fmt.Sprintf("error reading part: %v", err), Code: ErrorCodeInvalidRequest})
+			status = http.StatusMultiStatus
+			break
+		}
+
+		entry := &AccessLogEntry{Kind: AccessKindPush, Transport: "http", Source: ctx.RealIP()}
+		t0 := time.Now()
+		result := c.receivePart(part, tenant, entry)
+		c.logPartAccess(entry, result, t0)
+		result.Part = i
+		if result.Status != http.StatusOK {
+			status = http.StatusMultiStatus
+		}
+		results = append(results, result)
+	}
+	return ctx.JSON(status, results)
+}
+
+func (c *MetricHub) receivePart(part *multipart.Part, tenant string, entry *AccessLogEntry) batchPartResult {
+	defer part.Close()
+
+	labels, err := url.ParseQuery(part.Header.Get(GroupingLabelsHeader))
+	if err != nil {
+		return batchPartResult{Status: http.StatusBadRequest, Error: fmt.Sprintf("error parsing grouping labels: %v", err), Code: ErrorCodeInvalidRequest}
+	}
+
+	body, err := ioutil.ReadAll(part)
+	if err != nil {
+		return batchPartResult{Status: http.StatusBadRequest, Error: fmt.Sprintf("error reading part: %v", err), Code: ErrorCodeInvalidRequest}
+	}
+	body, err = decompressPush(part.Header.Get(echo.HeaderContentEncoding), body)
+	if err != nil {
+		return batchPartResult{Status: decompressionErrorStatus(err), Error: err.Error(), Code: ErrorCodeInvalidRequest}
+	}
+	defer c.acquireIngestWorker()()
+	ObservePushSize("http", len(body))
+	entry.Bytes = len(body)
+
+	t0 := time.Now()
+	families, err := parseExposition(part.Header.Get(echo.HeaderContentType), body)
+	if err != nil {
+		recordParseError(part.Header.Get(echo.HeaderContentType))
+		recordRejectedPush("http", ErrorCodeParseError)
+		return batchPartResult{Status: http.StatusBadRequest, Error: fmt.Sprintf("error parsing metrics: %v", err), Code: ErrorCodeParseError}
+	}
+	for name, values := range labels {
+		for _, fam := range families {
+			addGroupingLabel(fam, name, values[len(values)-1])
+		}
+	}
+	pushed := countParsedDatapoints(families)
+	defer observePush("http", t0, pushed)
+	entry.Families, entry.Datapoints = len(families), pushed
+
+	if err := c.admitHTTPPush(pushed, len(body)); err != nil {
+		status, code, _ := pushLimitErrorResponse(err)
+		recordRejectedPush("http", code)
+		return batchPartResult{Status: status, Error: err.Error(), Code: code}
+	}
+	datapoints, dropped, err := c.receiveFamilies(families, int64(len(body)), tenant)
+	if err != nil {
+		recordRejectedPush("http", receiveErrorCode(err))
+		return batchPartResult{Status: receiveErrorStatus(err), Error: strings.TrimSpace(err.Error()), Code: receiveErrorCode(err)}
+	}
+	if dropped > 0 {
+		recordRejectedPush("http", ErrorCodeLimitExceeded)
+		entry.RejectedDatapoints = dropped
+		return batchPartResult{Status: http.StatusPartialContent, Datapoints: datapoints, Dropped: dropped}
+	}
+	return batchPartResult{Status: http.StatusOK, Datapoints: datapoints}
+}
+
+// logPartAccess writes entry of a batch part started at t0 with result to the
+// access log, as every part is a push of its own
+func (c *MetricHub) logPartAccess(entry *AccessLogEntry, result batchPartResult, t0 time.Time) {
+	if c.accessLog == nil {
+		return
+	}
+	entry.DurationSeconds = time.Since(t0).Seconds()
+	entry.Result = pushResult(result.Status, entry)
+	entry.Code = result.Code
+	c.LogAccess(*entry)
+}
+
+// addGroupingLabel sets the label name to value on every metric in family,
+// replacing a pushed label of the same name
+func addGroupingLabel(family *dto.MetricFamily, name, value string) {
+	for _, metric := range family.Metric {
+		replaced := false
+		for _, label := range metric.Label {
+			if label.GetName() == name {
+				label.Value = proto.String(value)
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			metric.Label = append(metric.Label, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+		}
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// BatchIDHeader identifies a push across retries. A hub with batch
+	// deduplication enabled stores a push with a given batch ID at most once.
+	BatchIDHeader = "X-Edge-Hub-Batch-Id"
+)
+
+// ErrBatchPending is returned for a gRPC push whose batch ID is being stored
+// by another push
+var ErrBatchPending = errors.New("batch is being stored by another push")
+
+var (
+	duplicateBatches = prometheus.NewCounter(prometheus.CounterOpts{Name: "duplicate_batches_total", Help: "Number of pushes discarded because a push with the same batch ID was already stored"})
+	trackedBatchIDs  = prometheus.NewGauge(prometheus.GaugeOpts{Name: "tracked_batch_ids", Help: "Number of batch IDs of stored pushes remembered for deduplication"})
+)
+
+func init() {
+	prometheus.MustRegister(duplicateBatches, trackedBatchIDs)
+}
+
+// WithBatchDeduplication makes the hub remember the batch IDs of pushes it
+// stored for ttl, and discard later pushes with the same ID while responding
+// as if they were stored. Senders that retry a push when they can't tell
+// whether it was stored, e.g. after a timeout, get it stored exactly once as
+// long as they retry within ttl.
+func WithBatchDeduplication(ttl time.Duration) Option {
+	return func(hub *MetricHub) {
+		if ttl <= 0 {
+			hub.batchIDs = nil
+			return
+		}
+		hub.batchIDs = &batchIDs{
+			ttl:     ttl,
+			stored:  make(map[string]time.Time),
+			pending: make(map[string]bool),
+		}
+	}
+}
+
+type batchState int
+
+const (
+	batchNew batchState = iota
+	batchStored
+	batchPending
+)
+
+// batchIDs keeps the IDs of recently stored and currently stored batches
+type batchIDs struct {
+	sync.Mutex
+	ttl time.Duration
+	// stored maps the IDs of stored batches to when they expire
+	stored map[string]time.Time
+	// pending are the IDs of batches being stored
+	pending   map[string]bool
+	lastSweep time.Time
+}
+
+// begin returns batchNew and marks id pending if no batch with id was stored
+// within the ttl or is being stored
+func (b *batchIDs) begin(id string, now time.Time) batchState {
+	b.Lock()
+	defer b.Unlock()
+
+	// sweeping once per ttl keeps expired IDs for at most twice the ttl
+	if now.Sub(b.lastSweep) >= b.ttl {
+		for storedID, expiry := range b.stored {
+			if !now.Before(expiry) {
+				delete(b.stored, storedID)
+			}
+		}
+		b.lastSweep = now
+		trackedBatchIDs.Set(float64(len(b.stored)))
+	}
+
+	if expiry, ok := b.stored[id]; ok && now.Before(expiry) {
+		return batchStored
+	}
+	if b.pending[id] {
+		return batchPending
+	}
+	b.pending[id] = true
+	return batchNew
+}
+
+// end records whether the pending batch id was stored
+func (b *batchIDs) end(id string, stored bool, now time.Time) {
+	b.Lock()
+	defer b.Unlock()
+
+	delete(b.pending, id)
+	if stored {
+		b.stored[id] = now.Add(b.ttl)
+		trackedBatchIDs.Set(float64(len(b.stored)))
+	}
+}
+
+// receiveOnce handles a push with a batch ID by passing it to receive unless
+// a push with the same ID was already stored. While another push with the ID
+// is being stored it responds with a 409, so the sender retries later and
+// learns whether that push was stored.
+func (c *MetricHub) receiveOnce(ctx echo.Context, id string, receive echo.HandlerFunc) error {
+	switch c.batchIDs.begin(id, c.clock.Now()) {
+	case batchStored:
+		duplicateBatches.Inc()
+		return ctx.NoContent(http.StatusOK)
+	case batchPending:
+		return respondError(ctx, http.StatusConflict, ErrorCodeBatchInProgress, map[string]string{"batch_id": id}, "batch %s is being stored by another push", id)
+	}
+
+	err := receive(ctx)
+	c.batchIDs.end(id, err == nil && ctx.Response().Status/100 == 2, c.clock.Now())
+	return err
+}
+
+// ReceiveGRPCOnce is ReceiveGRPCContext for a push with a batch ID. A push
+// with the ID of a stored push is acknowledged as accepted without being
+// stored, and ErrBatchPending is returned while another push with the ID is
+// being stored.
+func (c *MetricHub) ReceiveGRPCOnce(ctx context.Context, id string, families []*dto.MetricFamily) (ReceiveResult, error) {
+	if id == "" || c.batchIDs == nil {
+		return c.ReceiveGRPCContext(ctx, families)
+	}
+	switch c.batchIDs.begin(id, c.clock.Now()) {
+	case batchStored:
+		duplicateBatches.Inc()
+		datapoints := 0
+		for _, fam := range families {
+			datapoints += len(fam.Metric)
+		}
+		c.Lock()
+		defer c.Unlock()
+		return ReceiveResult{AcceptedDatapoints: datapoints, Utilization: c.utilization()}, nil
+	case batchPending:
+		return ReceiveResult{}, ErrBatchPending
+	}
+
+	result, err := c.ReceiveGRPCContext(ctx, families)
+	c.batchIDs.end(id, err == nil && result.AcceptedDatapoints > 0, c.clock.Now())
+	return result, err
+}
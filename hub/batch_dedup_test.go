@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func receiveBatchID(hub *MetricHub, id, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/metrics", strings.NewReader(body))
+	req.Header.Set(BatchIDHeader, id)
+	rec := httptest.NewRecorder()
+	hub.Receive(echo.New().NewContext(req, rec))
+	return rec
+}
+
+func TestReceiveDeduplicatesBatches(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithBatchDeduplication(time.Minute))
+
+	assert.Equal(t, http.StatusOK, receiveBatchID(hub, "a-1", sampleReceiveString).Code)
+	assert.Equal(t, 14, hub.Status().Datapoints)
+
+	// a retry is acknowledged but not stored
+	assert.Equal(t, http.StatusOK, receiveBatchID(hub, "a-1", sampleReceiveString).Code)
+	assert.Equal(t, 14, hub.Status().Datapoints)
+
+	assert.Equal(t, http.StatusOK, receiveBatchID(hub, "a-2", sampleReceiveString).Code)
+	assert.Equal(t, 28, hub.Status().Datapoints)
+
+	// pushes without an ID are always stored
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	_, err = receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, 56, hub.Status().Datapoints)
+}
+
+func TestReceiveRetriesRejectedBatches(t *testing.T) {
+	hub := NewMetricHub(20, 10, WithBatchDeduplication(time.Minute))
+
+	assert.Equal(t, http.StatusBadRequest, receiveBatchID(hub, "a-1", "not metrics{").Code)
+	assert.Equal(t, http.StatusOK, receiveBatchID(hub, "a-1", sampleReceiveString).Code)
+	assert.Equal(t, 14, hub.Status().Datapoints)
+
+	assert.Equal(t, http.StatusNotAcceptable, receiveBatchID(hub, "a-2", sampleReceiveString).Code)
+	scrape(t, hub)
+	assert.Equal(t, http.StatusOK, receiveBatchID(hub, "a-2", sampleReceiveString).Code)
+	assert.Equal(t, 14, hub.Status().Datapoints)
+}
+
+func TestReceiveRetriesPartialBatches(t *testing.T) {
+	hub := NewMetricHub(3, 10, WithBatchDeduplication(time.Minute), WithLimitPolicy(LimitPolicyPartial))
+
+	assert.Equal(t, http.StatusPartialContent, receiveBatchID(hub, "a-1", "a 1 1000\nb 1 1000\nb 2 2000\nc 1 1000\n").Code)
+	assert.Equal(t, 3, hub.Status().Datapoints)
+
+	// the stored part is not stored again by a retry
+	scrape(t, hub)
+	assert.Equal(t, http.StatusOK, receiveBatchID(hub, "a-1", "a 1 1000\nb 1 1000\nb 2 2000\nc 1 1000\n").Code)
+	assert.Equal(t, 0, hub.Status().Datapoints)
+}
+
+func TestReceivePendingBatch(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithBatchDeduplication(time.Minute))
+	assert.Equal(t, batchNew, hub.batchIDs.begin("a-1", time.Now()))
+
+	assert.Equal(t, http.StatusConflict, receiveBatchID(hub, "a-1", sampleReceiveString).Code)
+	assert.Equal(t, 0, hub.Status().Datapoints)
+}
+
+func TestReceiveGRPCDeduplicatesBatches(t *testing.T) {
+	hub := NewMetricHub(20, 10, WithBatchDeduplication(time.Minute))
+	push := func() []*dto.MetricFamily {
+		return []*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 15, []*dto.LabelPair{}, 1)}
+	}
+
+	result, err := hub.ReceiveGRPCOnce(context.Background(), "a-1", push())
+	assert.NoError(t, err)
+	assert.Equal(t, 15, result.AcceptedDatapoints)
+	// a retry is acknowledged but not stored
+	result, err = hub.ReceiveGRPCOnce(context.Background(), "a-1", push())
+	assert.NoError(t, err)
+	assert.Equal(t, 15, result.AcceptedDatapoints)
+	assert.Equal(t, 15, hub.Status().Datapoints)
+
+	// a rejected push can be retried
+	result, err = hub.ReceiveGRPCOnce(context.Background(), "a-2", push())
+	assert.NoError(t, err)
+	assert.Equal(t, 15, result.RejectedDatapoints)
+	scrape(t, hub)
+	result, err = hub.ReceiveGRPCOnce(context.Background(), "a-2", push())
+	assert.NoError(t, err)
+	assert.Equal(t, 15, result.AcceptedDatapoints)
+	assert.Equal(t, 15, hub.Status().Datapoints)
+
+	assert.Equal(t, batchNew, hub.batchIDs.begin("a-3", time.Now()))
+	_, err = hub.ReceiveGRPCOnce(context.Background(), "a-3", push())
+	assert.Equal(t, ErrBatchPending, err)
+}
+
+func TestReceiveWithoutDeduplication(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithBatchDeduplication(0))
+	assert.Nil(t, hub.batchIDs)
+
+	receiveBatchID(hub, "a-1", sampleReceiveString)
+	receiveBatchID(hub, "a-1", sampleReceiveString)
+	assert.Equal(t, 28, hub.Status().Datapoints)
+}
+
+func TestBatchIDsExpire(t *testing.T) {
+	ids := &batchIDs{ttl: time.Minute, stored: make(map[string]time.Time), pending: make(map[string]bool)}
+	t0 := time.Unix(1000, 0)
+
+	assert.Equal(t, batchNew, ids.begin("a-1", t0))
+	ids.end("a-1", true, t0)
+	assert.Equal(t, batchNew, ids.begin("a-2", t0))
+	ids.end("a-2", false, t0)
+
+	assert.Equal(t, batchStored, ids.begin("a-1", t0.Add(59*time.Second)))
+	assert.Equal(t, batchNew, ids.begin("a-2", t0.Add(59*time.Second)))
+	assert.Equal(t, batchPending, ids.begin("a-2", t0.Add(59*time.Second)))
+
+	assert.Equal(t, batchNew, ids.begin("a-1", t0.Add(time.Minute)))
+	assert.Equal(t, 0, len(ids.stored))
+}
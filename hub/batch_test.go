@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPart struct {
+	groupingLabels string
+	body           string
+	// contentType defaults to the text format
+	contentType string
+}
+
+func TestReceiveBatch(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	rec := receiveBatch(t, hub, []testPart{
+		{groupingLabels: "job=gateway&instance=gw1", body: "up 1 1000\n"},
+		{groupingLabels: "job=gateway&instance=gw2", body: "up 0 1000\n"},
+	})
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var results []batchPartResult
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+	assert.Equal(t, []batchPartResult{{Part: 0, Status: 200, Datapoints: 1}, {Part: 1, Status: 200, Datapoints: 1}}, results)
+	assert.Equal(t, "# TYPE up untyped\nup{instance=\"gw1\",job=\"gateway\"} 1 1000\nup{instance=\"gw2\",job=\"gateway\"} 0 1000\n", scrape(t, hub))
+}
+
+func TestReceiveBatchPartsAreIndependent(t *testing.T) {
+	hub := NewMetricHub(3, 10)
+	rec := receiveBatch(t, hub, []testPart{
+		{body: "bad metric string"},
+		{body: "a 1 1000\nb 1 1000\n"},
+		// would overfill the hub limit
+		{body: "c 1 1000\nd 1 1000\n"},
+	})
+
+	assert.Equal(t, http.StatusMultiStatus, rec.Code)
+	var results []batchPartResult
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+	assert.Equal(t, 3, len(results))
+	assert.Equal(t, http.StatusBadRequest, results[0].Status)
+	assert.Equal(t, http.StatusOK, results[1].Status)
+	assert.Equal(t, http.StatusNotAcceptable, results[2].Status)
+	assert.Equal(t, 2, hub.stats.currentCountDatapoints)
+}
+
+func TestReceiveBatchRequiresMultipart(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	req := httptest.NewRequest(http.MethodPost, "/metrics/batch", bytes.NewBufferString("up 1"))
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.ReceiveBatch(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func receiveBatch(t *testing.T, hub *MetricHub, parts []testPart) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set(echo.HeaderContentType, "text/plain")
+		if part.contentType != "" {
+			header.Set(echo.HeaderContentType, part.contentType)
+		}
+		if part.groupingLabels != "" {
+			header.Set(GroupingLabelsHeader, part.groupingLabels)
+		}
+		partWriter, err := writer.CreatePart(header)
+		assert.NoError(t, err)
+		_, err = partWriter.Write([]byte(part.body))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/metrics/batch", &body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.ReceiveBatch(echo.New().NewContext(req, rec)))
+	return rec
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+var (
+	canaryInjections = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "canary_injections_total", Help: "Number of times canary series were injected into the hub, by result"}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(canaryInjections)
+}
+
+// CanaryInjector periodically stores synthetic series in a hub, each with
+// value 1 and the current timestamp. They go through the same processing and
+// limit as pushed metrics, so alerting on the age of their newest timestamp in
+// the central TSDB checks the whole pipeline from the hub onwards.
+type CanaryInjector struct {
+	hub      *MetricHub
+	series   []*dto.MetricFamily
+	interval time.Duration
+}
+
+// NewCanaryInjector returns an injector storing every series in specs in hub
+// once per interval. Specs are series in text exposition format without a
+// value, e.g. `edgehub_canary{site="abc"}`.
+func NewCanaryInjector(hub *MetricHub, specs []string, interval time.Duration) (*CanaryInjector, error) {
+	if interval <= 0 {
+		return nil, errors.New("canary interval must be positive")
+	}
+	series := make([]*dto.MetricFamily, 0, len(specs))
+	for _, spec := range specs {
+		var parser expfmt.TextParser
+		families, err := parser.TextToMetricFamilies(strings.NewReader(spec + " 1\n"))
+		if err != nil || len(families) != 1 {
+			return nil, fmt.Errorf("invalid canary series %q: %v", spec, err)
+		}
+		for _, family := range families {
+			series = append(series, family)
+		}
+	}
+	return &CanaryInjector{hub: hub, series: series, interval: interval}, nil
+}
+
+// Run injects the canary series every interval until stop is closed
+func (i *CanaryInjector) Run(stop <-chan struct{}) {
+	ticks, stopTicker := i.hub.clock.NewTicker(i.interval)
+	defer stopTicker()
+	for {
+		i.inject(i.hub.clock.Now())
+		select {
+		case <-ticks:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (i *CanaryInjector) inject(now time.Time) {
+	timestamp := now.UnixNano() / int64(time.Millisecond)
+	families := make([]*dto.MetricFamily, 0, len(i.series))
+	for _, series := range i.series {
+		labels := make([]*dto.LabelPair, 0, len(series.Metric[0].Label))
+		for _, label := range series.Metric[0].Label {
+			labels = append(labels, &dto.LabelPair{Name: proto.String(label.GetName()), Value: proto.String(label.GetValue())})
+		}
+		families = append(families, &dto.MetricFamily{
+			Name: proto.String(series.GetName()),
+			Help: proto.String("Synthetic series injected by the hub to check pipeline liveness"),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{
+				Label:       labels,
+				Gauge:       &dto.Gauge{Value: proto.Float64(1)},
+				TimestampMs: proto.Int64(timestamp),
+			}},
+		})
+	}
+
+	if err := i.hub.storeCanaries(families); err != nil {
+		canaryInjections.WithLabelValues("rejected").Inc()
+		logging.Error("Not injecting canaries", "err", err)
+		return
+	}
+	canaryInjections.WithLabelValues("ok").Inc()
+}
+
+// storeCanaries stores families like a push, subject to the hub limit, but
+// without updating the push stats
+func (c *MetricHub) storeCanaries(families []*dto.MetricFamily) error {
+	datapoints := 0
+	for _, fam := range families {
+		c.prepareFamily(fam)
+		datapoints += len(fam.Metric)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if c.limit > 0 && c.liveDatapoints()+datapoints > c.limit {
+		return fmt.Errorf("would overfill hub limit of %d. Current hub size: %d", c.limit, c.stats.currentCountDatapoints)
+	}
+	for _, fam := range families {
+		c.storeFamily(fam)
+	}
+	hubSize.Set(float64(c.stats.currentCountDatapoints))
+	return nil
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanaryInjector(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	injector, err := NewCanaryInjector(hub, []string{`edgehub_canary{site="abc"}`, "edgehub_canary_bare"}, time.Minute)
+	assert.NoError(t, err)
+
+	now := time.Unix(1000, 0)
+	injector.inject(now)
+	injector.inject(now.Add(time.Minute))
+	assert.ElementsMatch(t, []string{
+		"# HELP edgehub_canary Synthetic series injected by the hub to check pipeline liveness",
+		"# TYPE edgehub_canary gauge",
+		`edgehub_canary{site="abc"} 1 1000000`,
+		`edgehub_canary{site="abc"} 1 1060000`,
+		"# HELP edgehub_canary_bare Synthetic series injected by the hub to check pipeline liveness",
+		"# TYPE edgehub_canary_bare gauge",
+		"edgehub_canary_bare 1 1000000",
+		"edgehub_canary_bare 1 1060000",
+	}, scrapedLines(scrape(t, hub)))
+}
+
+func TestCanaryInjectorRespectsLimit(t *testing.T) {
+	hub := NewMetricHub(1, 10)
+	injector, err := NewCanaryInjector(hub, []string{"edgehub_canary"}, time.Minute)
+	assert.NoError(t, err)
+
+	injector.inject(time.Unix(1000, 0))
+	injector.inject(time.Unix(1060, 0))
+	assert.Equal(t, 1, hub.Status().Datapoints)
+}
+
+func TestCanaryInjectorRun(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	injector, err := NewCanaryInjector(hub, []string{"edgehub_canary"}, time.Millisecond)
+	assert.NoError(t, err)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		injector.Run(stop)
+		close(done)
+	}()
+	for hub.Status().Datapoints < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	<-done
+}
+
+func TestNewCanaryInjectorInvalid(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := NewCanaryInjector(hub, []string{"edgehub_canary{site="}, time.Minute)
+	assert.Error(t, err)
+	_, err = NewCanaryInjector(hub, []string{"edgehub_canary"}, 0)
+	assert.Error(t, err)
+	_, err = NewCanaryInjector(hub, []string{"edgehub_canary\nsecond_line"}, time.Minute)
+	assert.Error(t, err)
+}
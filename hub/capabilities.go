@@ -0,0 +1,218 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Names of optional hub features reported by Capabilities
+const (
+	FeatureBatchPush         = "batch_push"
+	FeatureImport            = "import"
+	FeatureBufferSwap        = "buffer_swap"
+	FeatureFlush             = "admin_flush"
+	FeatureScrapeMinAge      = "scrape_min_age"
+	FeatureScrapeSummary     = "scrape_summary"
+	FeatureScrapePeek        = "scrape_peek"
+	FeatureScrapeClasses     = "scrape_classes"
+	FeatureScrapeCache       = "scrape_cache"
+	FeatureScrapeAfter       = "scrape_after"
+	FeatureScrapeConsumers   = "scrape_consumers"
+	FeatureSourceHeartbeats  = "source_heartbeats"
+	FeatureNameSanitizer     = "name_sanitizer"
+	FeatureNormalization     = "normalization_rules"
+	FeatureClockRegression   = "clock_regression_guard"
+	FeatureWarmUp            = "warm_up"
+	FeatureRuntimeDrop       = "drop_runtime_metrics"
+	FeatureLabelQuotas       = "label_quotas"
+	FeatureStaleSources      = "stale_source_cleanup"
+	FeatureHistory           = "history"
+	FeatureLastValues        = "last_value_cache"
+	FeatureBatchDedup        = "batch_deduplication"
+	FeatureWAL               = "write_ahead_log"
+	FeatureKeyLimits         = "key_limits"
+	FeatureTenants           = "tenant_allowlist"
+	FeatureSeriesChurn       = "series_churn_limit"
+	FeaturePartialAccept     = "limit_partial_accept"
+	FeatureDropOldest        = "limit_drop_oldest"
+	FeatureCounterIncrease   = "counter_increase"
+	FeatureMetricTTL         = "metric_ttl"
+	FeatureStaleSeries       = "stale_series_filter"
+	FeaturePushRateLimits    = "push_rate_limits"
+	FeatureGroupingKeyPush   = "grouping_key_push"
+	FeatureIdentityLabels    = "identity_labels"
+	FeatureSeriesOrder       = "series_order_label"
+	FeatureThrottleHints     = "throttle_hints"
+	FeatureConfigReload      = "config_reload"
+	FeatureRelabeling        = "relabeling"
+	FeatureScrapeWait        = "scrape_wait"
+	FeatureMetricFilter      = "metric_filter"
+	FeatureUntypedConversion = "untyped_conversion"
+	FeatureQuarantine        = "scrape_quarantine"
+	FeatureRollups           = "rollups"
+)
+
+// Capabilities describes what a hub supports, so distributors and clients can
+// adapt to each hub in a fleet running different versions and flags
+type Capabilities struct {
+	Protocols       []string         `json:"protocols"`
+	PushFormats     []string         `json:"push_formats"`
+	PushEncodings   []string         `json:"push_encodings"`
+	ScrapeFormats   []string         `json:"scrape_formats"`
+	ScrapeEncodings []string         `json:"scrape_encodings"`
+	ImportFormats   []string         `json:"import_formats"`
+	ImportEncodings []string         `json:"import_encodings"`
+	GRPCServices    []string         `json:"grpc_services"`
+	Limits          CapabilityLimits `json:"limits"`
+	Features        []string         `json:"features"`
+	// IdentityLabels are the labels every pushed datapoint must have, if
+	// any, which a distributor can key pushes by
+	IdentityLabels []string `json:"identity_labels,omitempty"`
+}
+
+// CapabilityLimits are the limits a hub enforces on pushes. 0 means no limit.
+type CapabilityLimits struct {
+	Datapoints            int   `json:"datapoints"`
+	SeriesDatapoints      int   `json:"series_datapoints"`
+	ImportDatapoints      int   `json:"import_datapoints"`
+	ImportMaxBytes        int64 `json:"import_max_bytes"`
+	GRPCMaxMsgSizeBytes   int   `json:"grpc_max_msg_size_bytes"`
+	GRPCMaxPushDatapoints int   `json:"grpc_max_push_datapoints"`
+	GRPCMaxPushBytes      int   `json:"grpc_max_push_bytes"`
+	HTTPMaxPushDatapoints int   `json:"http_max_push_datapoints"`
+	HTTPMaxPushBytes      int   `json:"http_max_push_bytes"`
+	// PushRates are the datapoints per second each rate limited transport
+	// may push, by transport
+	PushRates map[string]float64 `json:"push_rates,omitempty"`
+}
+
+// GRPCCapabilities describes the gRPC server in front of a hub
+type GRPCCapabilities struct {
+	Services          []string
+	MaxMsgSizeBytes   int
+	MaxPushDatapoints int
+	MaxPushBytes      int
+}
+
+// WithGRPCCapabilities reports the gRPC server serving the hub in its
+// Capabilities
+func WithGRPCCapabilities(grpc GRPCCapabilities) Option {
+	return func(hub *MetricHub) {
+		hub.grpcCapabilities = &grpc
+	}
+}
+
+// Capabilities returns the formats, protocols, limits and optional features
+// of the hub
+func (c *MetricHub) Capabilities() Capabilities {
+	c.Lock()
+	limit, metricTTL := c.limit, c.metricTTL
+	c.Unlock()
+	relabeler, metricFilter := c.ingestRules()
+	rollups := c.currentRollups()
+	capabilities := Capabilities{
+		Protocols:       []string{"http"},
+		PushFormats:     []string{string(expfmt.FmtText), string(expfmt.FmtOpenMetrics)},
+		PushEncodings:   []string{encodingIdentity, encodingGzip, encodingSnappy},
+		ScrapeFormats:   []string{string(expfmt.FmtText), string(expfmt.FmtOpenMetrics), JSONLContentType},
+		ScrapeEncodings: []string{encodingIdentity, encodingGzip},
+		ImportFormats:   []string{string(expfmt.FmtText), string(expfmt.FmtProtoDelim)},
+		ImportEncodings: []string{encodingIdentity, encodingGzip},
+		GRPCServices:    []string{},
+		Limits: CapabilityLimits{
+			Datapoints:            nonNegative(limit),
+			SeriesDatapoints:      nonNegative(c.maxSeriesDatapoints),
+			ImportDatapoints:      nonNegative(c.importLimit),
+			HTTPMaxPushDatapoints: nonNegative(c.httpMaxPushDatapoints),
+			HTTPMaxPushBytes:      nonNegative(c.httpMaxPushBytes),
+		},
+		Features: []string{FeatureBatchPush, FeatureImport, FeatureBufferSwap, FeatureFlush, FeatureScrapeMinAge, FeatureScrapeSummary, FeatureScrapePeek, FeatureLabelQuotas, FeatureGroupingKeyPush},
+	}
+	if len(c.identityLabels) > 0 {
+		capabilities.IdentityLabels = c.identityLabels
+	}
+	if c.importMaxBytes > 0 {
+		capabilities.Limits.ImportMaxBytes = c.importMaxBytes
+	}
+	if len(c.pushRates) > 0 {
+		capabilities.Limits.PushRates = make(map[string]float64, len(c.pushRates))
+		for transport, bucket := range c.pushRates {
+			capabilities.Limits.PushRates[transport] = bucket.rate
+		}
+	}
+	if c.grpcCapabilities != nil {
+		capabilities.Protocols = append(capabilities.Protocols, "grpc")
+		capabilities.GRPCServices = append(capabilities.GRPCServices, c.grpcCapabilities.Services...)
+		capabilities.Limits.GRPCMaxMsgSizeBytes = nonNegative(c.grpcCapabilities.MaxMsgSizeBytes)
+		capabilities.Limits.GRPCMaxPushDatapoints = nonNegative(c.grpcCapabilities.MaxPushDatapoints)
+		capabilities.Limits.GRPCMaxPushBytes = nonNegative(c.grpcCapabilities.MaxPushBytes)
+	}
+
+	optional := []struct {
+		name    string
+		enabled bool
+	}{
+		{FeatureScrapeClasses, c.slowFamilies != nil},
+		{FeatureCounterIncrease, c.counterIncrease != nil},
+		{FeatureScrapeCache, c.scrapeCache != nil},
+		{FeatureScrapeAfter, c.scrapeRetention != nil},
+		{FeatureScrapeConsumers, c.scrapeRetention != nil},
+		{FeatureSourceHeartbeats, c.heartbeats != nil},
+		{FeatureStaleSources, c.staleSources != nil},
+		{FeatureHistory, c.history != nil},
+		{FeatureLastValues, c.lastValues != nil},
+		{FeatureBatchDedup, c.batchIDs != nil},
+		{FeatureWAL, c.wal != nil},
+		{FeatureKeyLimits, c.labelQuotas != nil && len(c.labelQuotas.keyLimits) > 0},
+		{FeatureTenants, c.tenants != nil},
+		{FeatureSeriesChurn, c.seriesChurn != nil},
+		{FeaturePartialAccept, c.limitPolicy == LimitPolicyPartial},
+		{FeatureDropOldest, c.limitPolicy == LimitPolicyDropOldest},
+		{FeatureMetricTTL, metricTTL > 0},
+		{FeatureStaleSeries, c.staleSeries != nil},
+		{FeaturePushRateLimits, len(c.pushRates) > 0},
+		{FeatureIdentityLabels, len(c.identityLabels) > 0},
+		{FeatureSeriesOrder, c.seriesOrderLabel != ""},
+		{FeatureThrottleHints, c.throttleUtilization > 0 && limit > 0},
+		{FeatureConfigReload, c.configFile != ""},
+		{FeatureNameSanitizer, c.sanitizer != nil},
+		{FeatureNormalization, c.normalizer != nil},
+		{FeatureRelabeling, relabeler != nil},
+		{FeatureMetricFilter, metricFilter != nil},
+		{FeatureRollups, len(rollups) > 0},
+		{FeatureUntypedConversion, c.untypedConverter != nil},
+		{FeatureScrapeWait, c.scrapeMaxWait > 0},
+		{FeatureQuarantine, c.quarantine.limit > 0},
+		{FeatureClockRegression, c.clockGuard != nil},
+		{FeatureWarmUp, c.warmUp > 0},
+		{FeatureRuntimeDrop, c.dropRuntimeMetrics},
+	}
+	for _, feature := range optional {
+		if feature.enabled {
+			capabilities.Features = append(capabilities.Features, feature.name)
+		}
+	}
+	return capabilities
+}
+
+// CapabilitiesHandler is a handler function returning the Capabilities of the
+// hub as JSON
+func (c *MetricHub) CapabilitiesHandler(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, c.Capabilities())
+}
+
+func nonNegative(limit int) int {
+	if limit < 0 {
+		return 0
+	}
+	return limit
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilities(t *testing.T) {
+	hub := NewMetricHub(-1, 10)
+	capabilities := hub.Capabilities()
+	assert.Equal(t, []string{"http"}, capabilities.Protocols)
+	assert.Equal(t, []string{}, capabilities.GRPCServices)
+	assert.Equal(t, CapabilityLimits{}, capabilities.Limits)
+	assert.Equal(t, []string{FeatureBatchPush, FeatureImport, FeatureBufferSwap, FeatureFlush, FeatureScrapeMinAge, FeatureScrapeSummary, FeatureScrapePeek, FeatureLabelQuotas, FeatureGroupingKeyPush, FeatureScrapeWait, FeatureQuarantine}, capabilities.Features)
+
+	configured := NewMetricHub(1000, 10,
+		WithImportLimits(500, 1024),
+		WithMaxSeriesDatapoints(60),
+		WithWarmUp(time.Minute),
+		WithScrapeCache(time.Second),
+		WithGRPCCapabilities(GRPCCapabilities{Services: []string{"edgehub.v1.EdgeHubService"}, MaxMsgSizeBytes: 4096, MaxPushDatapoints: 100}),
+	)
+	capabilities = configured.Capabilities()
+	assert.Equal(t, []string{"http", "grpc"}, capabilities.Protocols)
+	assert.Equal(t, []string{"edgehub.v1.EdgeHubService"}, capabilities.GRPCServices)
+	assert.Equal(t, CapabilityLimits{
+		Datapoints:            1000,
+		SeriesDatapoints:      60,
+		ImportDatapoints:      500,
+		ImportMaxBytes:        1024,
+		GRPCMaxMsgSizeBytes:   4096,
+		GRPCMaxPushDatapoints: 100,
+	}, capabilities.Limits)
+	assert.Contains(t, capabilities.Features, FeatureWarmUp)
+	assert.Contains(t, capabilities.Features, FeatureScrapeCache)
+	assert.NotContains(t, capabilities.Features, FeatureSourceHeartbeats)
+}
+
+func TestCapabilitiesHandler(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/capabilities", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.CapabilitiesHandler(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var capabilities Capabilities
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &capabilities))
+	assert.Equal(t, hub.Capabilities(), capabilities)
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"time"
+)
+
+// Clock tells the hub the time and drives its periodic tasks, such as metric
+// expiry, stale source cleanup and forwarding. Tests can inject a fake clock,
+// e.g. hubtest.FakeClock, with WithClock to step through TTLs, staleness and
+// warm-up deterministically.
+type Clock interface {
+	Now() time.Time
+	// NewTicker returns a channel ticking every d on this clock like a
+	// time.Ticker, and a function stopping it
+	NewTicker(d time.Duration) (<-chan time.Time, func())
+}
+
+// WithClock makes the hub tell time with clock instead of the system clock.
+// Durations measured for monitoring, such as lock waits and scrape latency,
+// still use the system clock.
+func WithClock(clock Clock) Option {
+	return func(hub *MetricHub) {
+		hub.clock = clock
+	}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(d)
+	return ticker.C, ticker.Stop
+}
+
+// sleep blocks for d on clock
+func sleep(clock Clock, d time.Duration) {
+	ticks, stop := clock.NewTicker(d)
+	defer stop()
+	<-ticks
+}
+
+// nowMs returns the time of the hub clock in milliseconds since the epoch
+func (c *MetricHub) nowMs() int64 {
+	return c.clock.Now().UnixNano() / int64(time.Millisecond)
+}
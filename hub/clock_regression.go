@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	clockRegressions = prometheus.NewCounter(prometheus.CounterOpts{Name: "clock_regressions_total", Help: "Number of pushed datapoints older than the last scraped datapoint of their series"})
+)
+
+func init() {
+	prometheus.MustRegister(clockRegressions)
+}
+
+// ClockRegressionPolicy controls what happens to pushed datapoints that are
+// older than the newest datapoint already scraped from the same series. These
+// typically come from devices replaying old timestamps after rebooting without
+// a real-time clock, and confuse rate() calculations downstream.
+type ClockRegressionPolicy int
+
+const (
+	// ClockRegressionIgnore stores regressed datapoints as they are pushed
+	ClockRegressionIgnore ClockRegressionPolicy = iota
+	// ClockRegressionAdjust moves regressed datapoints to just after the
+	// last scraped timestamp of their series
+	ClockRegressionAdjust
+	// ClockRegressionReject drops regressed datapoints
+	ClockRegressionReject
+)
+
+// ParseClockRegressionPolicy parses "ignore", "adjust" or "reject"
+func ParseClockRegressionPolicy(policy string) (ClockRegressionPolicy, error) {
+	switch policy {
+	case "ignore":
+		return ClockRegressionIgnore, nil
+	case "adjust":
+		return ClockRegressionAdjust, nil
+	case "reject":
+		return ClockRegressionReject, nil
+	}
+	return ClockRegressionIgnore, fmt.Errorf("unknown clock regression policy %q", policy)
+}
+
+// WithClockRegressionPolicy enables tracking of the last scraped timestamp of
+// every series, and handles pushed datapoints older than it per policy
+func WithClockRegressionPolicy(policy ClockRegressionPolicy) Option {
+	return func(hub *MetricHub) {
+		if policy == ClockRegressionIgnore {
+			hub.clockGuard = nil
+			return
+		}
+		hub.clockGuard = &clockGuard{
+			policy:     policy,
+			watermarks: make(map[string]int64),
+		}
+	}
+}
+
+// clockGuard keeps the newest scraped timestamp per series
+type clockGuard struct {
+	sync.Mutex
+	policy     ClockRegressionPolicy
+	watermarks map[string]int64
+}
+
+// checkFamily adjusts or drops datapoints in family that are older than their
+// series watermark
+func (g *clockGuard) checkFamily(family *dto.MetricFamily) {
+	g.Lock()
+	defer g.Unlock()
+
+	// next adjusted timestamp per series, so datapoints adjusted in the same
+	// push don't collide
+	adjusted := make(map[string]int64)
+	kept := family.Metric[:0]
+	for _, metric := range family.Metric {
+		if metric.TimestampMs == nil {
+			kept = append(kept, metric)
+			continue
+		}
+		name := makeLabeledName(metric, family.GetName())
+		watermark, ok := g.watermarks[name]
+		if !ok || *metric.TimestampMs >= watermark {
+			kept = append(kept, metric)
+			continue
+		}
+
+		clockRegressions.Inc()
+		if g.policy == ClockRegressionReject {
+			continue
+		}
+		next, ok := adjusted[name]
+		if !ok {
+			next = watermark + 1
+		}
+		adjusted[name] = next + 1
+		metric.TimestampMs = &next
+		kept = append(kept, metric)
+	}
+	family.Metric = kept
+}
+
+// advance records the newest timestamp of every series in scraped
+func (g *clockGuard) advance(scraped map[string]*familyAndMetrics) {
+	g.Lock()
+	defer g.Unlock()
+
+	for _, family := range scraped {
+		for name, queue := range family.metrics {
+			if len(queue.samples) == 0 {
+				continue
+			}
+			// queues are sorted, so the last datapoint is the newest
+			newest := queue.newestTimestampMs()
+			if newest > g.watermarks[name] {
+				g.watermarks[name] = newest
+			}
+		}
+	}
+}
+
+// expire removes the watermarks older than cutoffMs, and returns the number
+// removed
+func (g *clockGuard) expire(cutoffMs int64) int {
+	g.Lock()
+	defer g.Unlock()
+
+	removed := 0
+	for name, watermark := range g.watermarks {
+		if watermark < cutoffMs {
+			delete(g.watermarks, name)
+			removed++
+		}
+	}
+	return removed
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockRegressionReject(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithClockRegressionPolicy(ClockRegressionReject))
+	hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 1, []*dto.LabelPair{}, 100)})
+	scrape(t, hub)
+
+	// one regressed, one duplicate of the watermark and one newer datapoint
+	old := makeFamily(dto.MetricType_GAUGE, "fam1", 1, []*dto.LabelPair{}, 50)
+	same := makeFamily(dto.MetricType_GAUGE, "fam1", 1, []*dto.LabelPair{}, 100)
+	newer := makeFamily(dto.MetricType_GAUGE, "fam1", 1, []*dto.LabelPair{}, 150)
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{old, same, newer})
+
+	assert.Equal(t, 2, result.AcceptedDatapoints)
+	assert.Equal(t, "# HELP fam1 fam1\n# TYPE fam1 gauge\nfam1 0 100\nfam1 0 150\n", scrape(t, hub))
+}
+
+func TestClockRegressionAdjust(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithClockRegressionPolicy(ClockRegressionAdjust))
+	hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 1, []*dto.LabelPair{}, 100)})
+	scrape(t, hub)
+
+	regressed := makeFamily(dto.MetricType_GAUGE, "fam1", 2, []*dto.LabelPair{}, 10)
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{regressed})
+
+	assert.Equal(t, 2, result.AcceptedDatapoints)
+	assert.Equal(t, "# HELP fam1 fam1\n# TYPE fam1 gauge\nfam1 0 101\nfam1 1 102\n", scrape(t, hub))
+}
+
+func TestClockRegressionOtherSeriesUnaffected(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithClockRegressionPolicy(ClockRegressionReject))
+	hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 1, []*dto.LabelPair{}, 100)})
+	scrape(t, hub)
+
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 1, testLabels, 50)})
+	assert.Equal(t, 1, result.AcceptedDatapoints)
+}
+
+func TestParseClockRegressionPolicy(t *testing.T) {
+	policy, err := ParseClockRegressionPolicy("adjust")
+	assert.NoError(t, err)
+	assert.Equal(t, ClockRegressionAdjust, policy)
+
+	_, err = ParseClockRegressionPolicy("bogus")
+	assert.Error(t, err)
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/hub/hubtest"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+var fakeStart = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestClockWarmUp(t *testing.T) {
+	clock := hubtest.NewFakeClock(fakeStart)
+	hub := NewMetricHub(0, 10, WithClock(clock), WithWarmUp(time.Minute))
+
+	assert.Equal(t, time.Minute, hub.warmUpRemaining())
+	clock.Advance(59 * time.Second)
+	assert.Equal(t, time.Second, hub.warmUpRemaining())
+	clock.Advance(time.Second)
+	assert.Equal(t, time.Duration(0), hub.warmUpRemaining())
+}
+
+func TestClockRunExpiry(t *testing.T) {
+	clock := hubtest.NewFakeClock(fakeStart)
+	hub := NewMetricHub(0, 10, WithClock(clock), WithMetricTTL(time.Hour))
+	pushedMs := fakeStart.UnixNano() / int64(time.Millisecond)
+	_, err := receiveString(hub, fmt.Sprintf("# TYPE up gauge\nup 1 %d\n", pushedMs))
+	assert.NoError(t, err)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		hub.RunExpiry(time.Minute, stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	// wait for the ticker of RunExpiry before advancing
+	assert.Eventually(t, func() bool { return clock.Tickers() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(time.Hour)
+	assert.Never(t, func() bool { return hub.Status().Datapoints == 0 }, 50*time.Millisecond, time.Millisecond)
+	clock.Advance(time.Minute)
+	assert.Eventually(t, func() bool { return hub.Status().Datapoints == 0 }, time.Second, time.Millisecond)
+}
+
+func TestClockReceiveTimestamp(t *testing.T) {
+	clock := hubtest.NewFakeClock(fakeStart)
+	hub := NewMetricHub(0, 10, WithClock(clock), WithDefaultTimestamp(TimestampReceive), WithSourceHeartbeats("gw"))
+	clock.Advance(time.Second)
+	_, err := receiveString(hub, "# TYPE up gauge\nup{gw=\"a\"} 1\n")
+	assert.NoError(t, err)
+
+	clock.Advance(time.Second)
+	exposition := scrape(t, hub)
+	assert.Contains(t, exposition, fmt.Sprintf(`up{gw="a"} 1 %d`, fakeStart.Add(time.Second).UnixNano()/int64(time.Millisecond)))
+	assert.Contains(t, exposition, fmt.Sprintf(`edgehub_source_last_push_timestamp_seconds{source="a"} %v %d`, float64(fakeStart.Add(time.Second).Unix()), fakeStart.Add(2*time.Second).UnixNano()/int64(time.Millisecond)))
+}
+
+func TestClockScrapeCache(t *testing.T) {
+	clock := hubtest.NewFakeClock(fakeStart)
+	hub := NewMetricHub(0, 10, WithClock(clock), WithScrapeCache(10*time.Second))
+	_, err := receiveString(hub, "# TYPE up gauge\nup 1 1000\n")
+	assert.NoError(t, err)
+
+	scrapeID := func() string {
+		rec := httptest.NewRecorder()
+		assert.NoError(t, hub.Scrape(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/metrics", nil), rec)))
+		return rec.Header().Get(ScrapeIDHeader)
+	}
+	first := scrapeID()
+	clock.Advance(9 * time.Second)
+	assert.Equal(t, first, scrapeID())
+	clock.Advance(time.Second)
+	assert.NotEqual(t, first, scrapeID())
+}
+
+func TestClockQueueAge(t *testing.T) {
+	clock := hubtest.NewFakeClock(fakeStart)
+	hub := NewMetricHub(0, 10, WithClock(clock))
+	_, err := receiveString(hub, "# TYPE up gauge\nup 1 1000\n")
+	assert.NoError(t, err)
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, []familyAge{{name: "up", age: time.Minute}}, hub.familyAges())
+}
+
+func TestClockRemoteWrite(t *testing.T) {
+	clock := hubtest.NewFakeClock(fakeStart)
+	receiver := &remoteWriteReceiver{statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	hub := NewMetricHub(0, 10, WithClock(clock), WithRemoteWrite(server.URL, time.Second))
+	_, err := receiveString(hub, "# TYPE up gauge\nup 1\n")
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		hub.flushToUpstream()
+		close(done)
+	}()
+	// the retry waits for the backoff on the hub clock
+	assert.Eventually(t, func() bool { return clock.Tickers() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, 0, receiver.samples())
+	clock.Advance(remoteWriteMinBackoff)
+	<-done
+
+	assert.Equal(t, 1, receiver.samples())
+	// datapoints without timestamps are stamped with the time of the hub clock
+	assert.Equal(t, fakeStart.UnixNano()/int64(time.Millisecond), receiver.requests[0].Timeseries[0].Samples[0].Timestamp)
+}
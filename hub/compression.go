@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	encodingIdentity = "identity"
+	encodingGzip     = "gzip"
+	encodingSnappy   = "snappy"
+
+	// maxDecompressedPushBytes bounds the size of a compressed push once
+	// decompressed, at the default gRPC and import message size limit
+	maxDecompressedPushBytes = 1 << 30
+)
+
+var (
+	pushDecompressedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "push_decompressed_bytes_total", Help: "Size of compressed pushes after decompression, by content encoding"}, []string{"encoding"})
+	scrapeCompressedBytes = prometheus.NewCounter(prometheus.CounterOpts{Name: "scrape_gzip_bytes_total", Help: "Size of gzip compressed scrape responses"})
+)
+
+func init() {
+	prometheus.MustRegister(pushDecompressedBytes, scrapeCompressedBytes)
+}
+
+// decompressPush decodes a push body sent with the Content-Encoding encoding,
+// which is either gzip or snappy in the block format also used by Prometheus
+// remote write
+func decompressPush(encoding string, body []byte) ([]byte, error) {
+	var decoded []byte
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", encodingIdentity:
+		return body, nil
+	case encodingGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing gzip push: %v", err)
+		}
+		defer reader.Close()
+		decoded, err = ioutil.ReadAll(io.LimitReader(reader, maxDecompressedPushBytes+1))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing gzip push: %v", err)
+		}
+		if len(decoded) > maxDecompressedPushBytes {
+			return nil, fmt.Errorf("decompressed push is larger than %d bytes", maxDecompressedPushBytes)
+		}
+	case encodingSnappy:
+		size, err := snappy.DecodedLen(body)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing snappy push: %v", err)
+		}
+		if size > maxDecompressedPushBytes {
+			return nil, fmt.Errorf("decompressed push is larger than %d bytes", maxDecompressedPushBytes)
+		}
+		if decoded, err = snappy.Decode(nil, body); err != nil {
+			return nil, fmt.Errorf("error decompressing snappy push: %v", err)
+		}
+	default:
+		return nil, &unsupportedEncodingError{encoding: encoding}
+	}
+	pushDecompressedBytes.WithLabelValues(encoding).Add(float64(len(decoded)))
+	return decoded, nil
+}
+
+type unsupportedEncodingError struct {
+	encoding string
+}
+
+func (e *unsupportedEncodingError) Error() string {
+	return fmt.Sprintf("unsupported content encoding %q: must be %s, %s or %s", e.encoding, encodingIdentity, encodingGzip, encodingSnappy)
+}
+
+// decompressionErrorStatus returns the HTTP status for an error from
+// decompressPush
+func decompressionErrorStatus(err error) int {
+	if _, ok := err.(*unsupportedEncodingError); ok {
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of req allows gzip
+func acceptsGzip(req *http.Request) bool {
+	for _, accepted := range strings.Split(req.Header.Get(echo.HeaderAcceptEncoding), ",") {
+		params := strings.Split(accepted, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding != encodingGzip && coding != "*" {
+			continue
+		}
+		refused := false
+		for _, param := range params[1:] {
+			param = strings.ReplaceAll(strings.TrimSpace(param), " ", "")
+			if param == "q=0" || strings.HasPrefix(param, "q=0.0") && strings.Trim(param[len("q=0."):], "0") == "" {
+				refused = true
+			}
+		}
+		return !refused
+	}
+	return false
+}
+
+// respondScrape sends a scrape response body with contentType, gzip
+// compressed if the client accepts it
+func respondScrape(ctx echo.Context, contentType string, body string) error {
+	ctx.Response().Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+	if !acceptsGzip(ctx.Request()) {
+		return ctx.Blob(http.StatusOK, contentType, []byte(body))
+	}
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := io.WriteString(writer, body); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	scrapeCompressedBytes.Add(float64(compressed.Len()))
+	ctx.Response().Header().Set(echo.HeaderContentEncoding, encodingGzip)
+	return ctx.Blob(http.StatusOK, contentType, compressed.Bytes())
+}
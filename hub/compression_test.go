@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func gzipString(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write([]byte(s))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func receiveEncoded(hub *MetricHub, encoding string, body []byte) (*httptest.ResponseRecorder, error) {
+	req := httptest.NewRequest(http.MethodPost, "/metrics", bytes.NewReader(body))
+	req.Header.Set(echo.HeaderContentEncoding, encoding)
+	rec := httptest.NewRecorder()
+	err := hub.Receive(echo.New().NewContext(req, rec))
+	return rec, err
+}
+
+func TestReceiveCompressed(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	const push = "# TYPE up gauge\nup{job=\"a\"} 1 1000\n"
+
+	rec, err := receiveEncoded(hub, "gzip", gzipString(t, push))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec, err = receiveEncoded(hub, "snappy", snappy.Encode(nil, []byte("# TYPE up gauge\nup{job=\"b\"} 1 1000\n")))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec, err = receiveEncoded(hub, "identity", []byte("# TYPE up gauge\nup{job=\"c\"} 1 1000\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	exposition := scrape(t, hub)
+	assert.Contains(t, exposition, `up{job="a"} 1 1000`)
+	assert.Contains(t, exposition, `up{job="b"} 1 1000`)
+	assert.Contains(t, exposition, `up{job="c"} 1 1000`)
+}
+
+func TestReceiveCompressedErrors(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+
+	rec, err := receiveEncoded(hub, "br", []byte("up 1\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	assert.Equal(t, ErrorCodeInvalidRequest, decodeError(t, rec).Code)
+
+	// not gzip
+	rec, err = receiveEncoded(hub, "gzip", []byte("up 1\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// truncated
+	rec, err = receiveEncoded(hub, "gzip", gzipString(t, "up 1\n")[:10])
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec, err = receiveEncoded(hub, "snappy", []byte{0xff, 0xff, 0xff})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	assert.Equal(t, 0, hub.stats.currentCountDatapoints)
+}
+
+func TestScrapeGzip(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, "# TYPE up gauge\nup 1 1000\n")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set(echo.HeaderAcceptEncoding, "deflate, gzip;q=0.5")
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.Scrape(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, echo.HeaderAcceptEncoding, rec.Header().Get(echo.HeaderVary))
+	assert.Equal(t, echo.MIMETextPlainCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+
+	reader, err := gzip.NewReader(rec.Body)
+	assert.NoError(t, err)
+	exposition, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Contains(t, string(exposition), "up 1 1000")
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, expected := range map[string]bool{
+		"":                      false,
+		"gzip":                  true,
+		"GZIP":                  true,
+		"deflate, gzip":         true,
+		"gzip;q=1.0, identity":  true,
+		"gzip;q=0.001":          true,
+		"gzip;q=0":              false,
+		"gzip; q=0.000":         false,
+		"*":                     true,
+		"deflate, br, identity": false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set(echo.HeaderAcceptEncoding, header)
+		assert.Equal(t, expected, acceptsGzip(req), header)
+	}
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	configReloads              = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "config_reloads_total", Help: "Number of reloads of the config file, by result"}, []string{"result"})
+	configLastReloadSuccessful = prometheus.NewGauge(prometheus.GaugeOpts{Name: "config_last_reload_successful", Help: "Whether the last reload of the config file succeeded"})
+)
+
+func init() {
+	prometheus.MustRegister(configReloads, configLastReloadSuccessful)
+}
+
+// Config holds the settings of the hub that can be changed without a restart,
+// read from a YAML file. Settings left out of the file keep their current
+// value, which is the value of their flag until a file sets them.
+type Config struct {
+	// Limit is the hub limit in datapoints, <= 0 is no limit
+	Limit *int `yaml:"limit"`
+	// MetricTTL is the age after which buffered datapoints expire, 0 never
+	// expires them
+	MetricTTL      *model.Duration  `yaml:"metric_ttl"`
+	RelabelConfigs *[]RelabelConfig `yaml:"relabel_configs"`
+	// MetricAllowlist and MetricDenylist are regexes matching the whole name
+	// of pushed families, empty is no list
+	MetricAllowlist *string       `yaml:"metric_allowlist"`
+	MetricDenylist  *string       `yaml:"metric_denylist"`
+	SeriesDenylist  *[]string     `yaml:"series_denylist"`
+	LabelQuotas     *[]LabelQuota `yaml:"label_quotas"`
+	Rollups         *[]Rollup     `yaml:"rollups"`
+}
+
+// LoadConfig reads and validates the YAML config file at path
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return config, fmt.Errorf("error parsing config file: %v", err)
+	}
+	if _, err := config.compile(); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// compiledConfig is a Config ready to be applied without errors
+type compiledConfig struct {
+	Config
+	relabeler  *relabeler
+	allow      *regexp.Regexp
+	deny       *regexp.Regexp
+	seriesDeny []*selector
+}
+
+func (c Config) compile() (compiledConfig, error) {
+	compiled := compiledConfig{Config: c}
+	var err error
+	if c.MetricTTL != nil && *c.MetricTTL < 0 {
+		return compiled, fmt.Errorf("negative metric_ttl %v", *c.MetricTTL)
+	}
+	if c.RelabelConfigs != nil && len(*c.RelabelConfigs) > 0 {
+		if compiled.relabeler, err = newRelabeler(*c.RelabelConfigs); err != nil {
+			return compiled, err
+		}
+	}
+	if c.MetricAllowlist != nil && *c.MetricAllowlist != "" {
+		if compiled.allow, err = regexp.Compile(anchored(*c.MetricAllowlist)); err != nil {
+			return compiled, fmt.Errorf("invalid metric_allowlist: %v", err)
+		}
+	}
+	if c.MetricDenylist != nil && *c.MetricDenylist != "" {
+		if compiled.deny, err = regexp.Compile(anchored(*c.MetricDenylist)); err != nil {
+			return compiled, fmt.Errorf("invalid metric_denylist: %v", err)
+		}
+	}
+	if c.SeriesDenylist != nil {
+		for _, s := range *c.SeriesDenylist {
+			sel, err := parseSelector(s)
+			if err != nil {
+				return compiled, fmt.Errorf("invalid series_denylist selector %q: %v", s, err)
+			}
+			compiled.seriesDeny = append(compiled.seriesDeny, sel)
+		}
+	}
+	if c.LabelQuotas != nil {
+		for _, quota := range *c.LabelQuotas {
+			if err := quota.validate(); err != nil {
+				return compiled, err
+			}
+		}
+	}
+	if c.Rollups != nil {
+		if err := validateRollups(*c.Rollups); err != nil {
+			return compiled, err
+		}
+	}
+	return compiled, nil
+}
+
+// WithConfigFile makes ReloadConfig read the config file at path. It isn't
+// read until then, so callers apply it once after creating the hub.
+func WithConfigFile(path string) Option {
+	return func(hub *MetricHub) {
+		hub.configFile = path
+	}
+}
+
+// ReloadConfig reads the config file of the hub and applies it. If the file is
+// invalid, the hub keeps its current settings and the error is returned.
+func (c *MetricHub) ReloadConfig() error {
+	if c.configFile == "" {
+		return fmt.Errorf("the hub has no config file")
+	}
+	err := c.reloadConfig()
+	if err != nil {
+		configReloads.WithLabelValues("failure").Inc()
+		configLastReloadSuccessful.Set(0)
+		return err
+	}
+	configReloads.WithLabelValues("success").Inc()
+	configLastReloadSuccessful.Set(1)
+	logging.Info("Reloaded config file", "path", c.configFile)
+	return nil
+}
+
+func (c *MetricHub) reloadConfig() error {
+	config, err := LoadConfig(c.configFile)
+	if err != nil {
+		return err
+	}
+	return c.ApplyConfig(config)
+}
+
+// ApplyConfig applies the settings config sets, leaving the others unchanged.
+// Nothing is applied if config is invalid.
+func (c *MetricHub) ApplyConfig(config Config) error {
+	compiled, err := config.compile()
+	if err != nil {
+		return err
+	}
+
+	if config.Limit != nil || config.MetricTTL != nil {
+		c.Lock()
+		if config.Limit != nil {
+			c.limit = *config.Limit
+			hubLimit.Set(float64(c.limit))
+		}
+		if config.MetricTTL != nil {
+			c.metricTTL = time.Duration(*config.MetricTTL)
+		}
+		c.Unlock()
+	}
+
+	c.configLock.Lock()
+	if config.RelabelConfigs != nil {
+		c.relabeler = compiled.relabeler
+	}
+	if config.MetricAllowlist != nil || config.MetricDenylist != nil || config.SeriesDenylist != nil {
+		filter := &metricFilter{}
+		if c.metricFilter != nil {
+			*filter = *c.metricFilter
+		}
+		if config.MetricAllowlist != nil {
+			filter.allow = compiled.allow
+		}
+		if config.MetricDenylist != nil {
+			filter.deny = compiled.deny
+		}
+		if config.SeriesDenylist != nil {
+			filter.seriesDeny = compiled.seriesDeny
+		}
+		if filter.allow == nil && filter.deny == nil && len(filter.seriesDeny) == 0 {
+			filter = nil
+		}
+		c.metricFilter = filter
+	}
+	if config.Rollups != nil {
+		c.rollups = *config.Rollups
+	}
+	c.configLock.Unlock()
+
+	if config.LabelQuotas != nil {
+		// already validated, so this can't fail
+		return c.SetLabelQuotas(*config.LabelQuotas)
+	}
+	return nil
+}
+
+// Reload is a handler function reloading the config file of the hub
+func (c *MetricHub) Reload(ctx echo.Context) error {
+	if c.configFile == "" {
+		return respondError(ctx, http.StatusNotFound, ErrorCodeNotFound, nil, "the hub has no config file")
+	}
+	if err := c.ReloadConfig(); err != nil {
+		return respondError(ctx, http.StatusInternalServerError, ErrorCodeInternal, nil, "error reloading config file, keeping the current config: %v", err)
+	}
+	return ctx.NoContent(http.StatusOK)
+}
+
+// ingestRules returns the relabeler and metric filter, which a config reload
+// may replace
+func (c *MetricHub) ingestRules() (*relabeler, *metricFilter) {
+	c.configLock.RLock()
+	defer c.configLock.RUnlock()
+	return c.relabeler, c.metricFilter
+}
+
+// currentLimit returns the hub limit, which a config reload may change
+func (c *MetricHub) currentLimit() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.limit
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFile(t *testing.T, path, config string) {
+	assert.NoError(t, ioutil.WriteFile(path, []byte(config), 0644))
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	writeConfigFile(t, path, `
+limit: 3
+metric_ttl: 1m
+metric_denylist: debug_.*
+relabel_configs:
+  - action: labeldrop
+    regex: session
+label_quotas:
+  - {label: gatewayID, value: gw1, datapoints: 10, tier: reject}
+`)
+	hub := NewMetricHub(0, 10, WithConfigFile(path), WithMetricFilter(regexp.MustCompile("^(?:a|debug_a)$"), nil))
+	assert.NoError(t, hub.ReloadConfig())
+	assert.Equal(t, 3, hub.currentLimit())
+	assert.Equal(t, []LabelQuota{{Label: "gatewayID", Value: "gw1", Datapoints: 10, Tier: QuotaTierReject}}, hub.LabelQuotas())
+	assert.Contains(t, hub.Capabilities().Features, FeatureConfigReload)
+	assert.Contains(t, hub.Capabilities().Features, FeatureMetricTTL)
+	assert.Contains(t, hub.Capabilities().Features, FeatureRelabeling)
+
+	// the allowlist of the flags is kept along with the denylist of the file
+	_, err = receiveString(hub, "a{session=\"x\"} 1\ndebug_a 1\nb 1\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "# TYPE a untyped\na 1\n", scrape(t, hub))
+
+	rec, err := receiveString(hub, "a 1\na{x=\"1\"} 1\na{x=\"2\"} 1\na{x=\"3\"} 1\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+
+	// an empty relabel_configs turns relabeling off, settings left out are
+	// kept
+	writeConfigFile(t, path, "relabel_configs: []\nmetric_allowlist: \"\"\n")
+	assert.NoError(t, hub.ReloadConfig())
+	assert.Equal(t, 3, hub.currentLimit())
+	assert.NotContains(t, hub.Capabilities().Features, FeatureRelabeling)
+	_, err = receiveString(hub, "b{session=\"x\"} 1\ndebug_a 1\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "# TYPE b untyped\nb{session=\"x\"} 1\n", scrape(t, hub))
+}
+
+func TestReloadInvalidConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	writeConfigFile(t, path, "limit: 5\n")
+	hub := NewMetricHub(0, 10, WithConfigFile(path))
+	assert.NoError(t, hub.ReloadConfig())
+
+	for _, config := range []string{
+		"limit: [",
+		"unknown: 1\n",
+		"limit: 10\nmetric_denylist: \"(\"\n",
+		"limit: 10\nseries_denylist: ['{a=']\n",
+		"limit: 10\nrelabel_configs:\n  - action: keep\n",
+		"limit: 10\nlabel_quotas:\n  - {label: gatewayID, value: gw1, datapoints: 10, tier: never}\n",
+		"metric_ttl: -1m\n",
+	} {
+		writeConfigFile(t, path, config)
+		assert.Error(t, hub.ReloadConfig(), config)
+		assert.Equal(t, 5, hub.currentLimit(), config)
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	reload := func(hub *MetricHub) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/-/reload", nil)
+		assert.NoError(t, hub.Reload(echo.New().NewContext(req, rec)))
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusNotFound, reload(NewMetricHub(0, 10)))
+
+	dir, err := ioutil.TempDir("", "config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	writeConfigFile(t, path, "metric_ttl: 1m\n")
+	hub := NewMetricHub(0, 10, WithConfigFile(path))
+	assert.Equal(t, http.StatusOK, reload(hub))
+
+	_, err = receiveString(hub, "a 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, hub.expire(time.Unix(120, 0)))
+
+	writeConfigFile(t, path, "metric_ttl: x\n")
+	assert.Equal(t, http.StatusInternalServerError, reload(hub))
+}
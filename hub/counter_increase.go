@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// counterIncreaseSuffix is appended to the name of a counter family for the
+// family of its increases, following the naming of recording rules
+const counterIncreaseSuffix = ":increase"
+
+var counterIncreaseSeries = prometheus.NewCounter(prometheus.CounterOpts{Name: "counter_increase_series_total", Help: "Number of increase series computed from buffered counters at scrape time"})
+
+func init() {
+	prometheus.MustRegister(counterIncreaseSeries)
+}
+
+// WithCounterIncrease makes every scrape include a <name>:increase gauge for
+// each counter family whose name matches families, with the increase of each
+// series over the datapoints drained by the scrape, like increase() over the
+// buffered window. Counter resets are accounted for. Dashboards built on the
+// increases keep working when the raw datapoints have to be dropped to save
+// bandwidth.
+func WithCounterIncrease(families *regexp.Regexp) Option {
+	return func(hub *MetricHub) {
+		hub.counterIncrease = families
+	}
+}
+
+// isCounterIncrease returns whether name is the family of the increases of a
+// counter family
+func (c *MetricHub) isCounterIncrease(name string) bool {
+	return c.counterIncrease != nil && strings.HasSuffix(name, counterIncreaseSuffix) && c.counterIncrease.MatchString(strings.TrimSuffix(name, counterIncreaseSuffix))
+}
+
+// counterIncreaseFamily returns the increases of the series of the counter
+// family drained, or nil if no series has two datapoints to compute one from
+func counterIncreaseFamily(drained *familyAndMetrics, now time.Time) *dto.MetricFamily {
+	var metrics []*dto.Metric
+	for _, queue := range drained.metrics {
+		if len(queue.samples) < 2 {
+			continue
+		}
+		increase := 0.0
+		for i := 1; i < len(queue.samples); i++ {
+			if queue.samples[i].value < queue.samples[i-1].value {
+				// a reset, which starts counting from 0 again
+				increase += queue.samples[i].value
+			} else {
+				increase += queue.samples[i].value - queue.samples[i-1].value
+			}
+		}
+		latest := queue.samples[len(queue.samples)-1]
+		timestampMs := now.UnixNano() / int64(time.Millisecond)
+		if latest.hasTimestamp {
+			timestampMs = latest.timestampMs
+		}
+		metrics = append(metrics, &dto.Metric{
+			Label:       queue.labels,
+			Gauge:       &dto.Gauge{Value: proto.Float64(increase)},
+			TimestampMs: proto.Int64(timestampMs),
+		})
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+	counterIncreaseSeries.Add(float64(len(metrics)))
+	name := drained.family.GetName()
+	return &dto.MetricFamily{
+		Name:   proto.String(name + counterIncreaseSuffix),
+		Help:   proto.String(fmt.Sprintf("Increase of %s over the datapoints of the scrape", name)),
+		Type:   dto.MetricType_GAUGE.Enum(),
+		Metric: metrics,
+	}
+}
+
+// addCounterIncreases adds the increases of the counter families of class in
+// drained to the scrape of drained at now
+func (c *MetricHub) addCounterIncreases(drained map[string]*familyAndMetrics, class ScrapeClass, now time.Time) {
+	var increases []*dto.MetricFamily
+	for name, fam := range drained {
+		if fam.family.GetType() != dto.MetricType_COUNTER || !c.counterIncrease.MatchString(name) || !c.inScrapeClass(name+counterIncreaseSuffix, class) {
+			continue
+		}
+		if family := counterIncreaseFamily(fam, now); family != nil {
+			increases = append(increases, family)
+		}
+	}
+	for _, family := range increases {
+		if existing, ok := drained[family.GetName()]; ok {
+			existing.addMetrics(family.Metric, false, 0)
+		} else {
+			drained[family.GetName()] = newFamilyAndMetrics(family, now)
+		}
+	}
+}
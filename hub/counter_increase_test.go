@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+const counterIncreasePush = `# TYPE bytes_total counter
+bytes_total{gatewayID="g1"} 10 1000
+bytes_total{gatewayID="g1"} 15 2000
+bytes_total{gatewayID="g1"} 4 3000
+bytes_total{gatewayID="g1"} 6 4000
+bytes_total{gatewayID="g2"} 5 1000
+bytes_total{gatewayID="g3"} 7 1000
+bytes_total{gatewayID="g3"} 9 2000
+# TYPE temperature gauge
+temperature 10 1000
+temperature 20 2000
+`
+
+// gaugeValues returns the values of the series of the gauge family in
+// exposition by their labels, e.g. "gatewayID=g1"
+func gaugeValues(t *testing.T, exposition, family string) map[string]float64 {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(exposition))
+	assert.NoError(t, err)
+	values := make(map[string]float64)
+	for _, metric := range families[family].GetMetric() {
+		var labels []string
+		for _, label := range metric.Label {
+			labels = append(labels, label.GetName()+"="+label.GetValue())
+		}
+		values[strings.Join(labels, ",")] = metric.GetGauge().GetValue()
+	}
+	return values
+}
+
+func TestCounterIncrease(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithCounterIncrease(regexp.MustCompile("^(?:bytes_total|temperature)$")))
+	_, err := receiveString(hub, counterIncreasePush)
+	assert.NoError(t, err)
+
+	exposition := scrape(t, hub)
+	assert.Contains(t, exposition, "# TYPE bytes_total:increase gauge\n")
+	// 5 up to the reset, then 4 and 2 after it; g2 has a single datapoint
+	assert.Equal(t, map[string]float64{"gatewayID=g1": 11, "gatewayID=g3": 2}, gaugeValues(t, exposition, "bytes_total:increase"))
+	assert.Contains(t, exposition, `bytes_total:increase{gatewayID="g1"} 11 4000`)
+	// gauges have no increase
+	assert.NotContains(t, exposition, "temperature:increase")
+	// the raw datapoints are still served
+	assert.Contains(t, exposition, `bytes_total{gatewayID="g2"} 5 1000`)
+	assert.Contains(t, hub.Capabilities().Features, FeatureCounterIncrease)
+
+	assert.Equal(t, "", scrape(t, hub))
+}
+
+func TestCounterIncreaseRollup(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithCounterIncrease(regexp.MustCompile("^(?:bytes_total)$")), WithRollups([]Rollup{
+		{Name: "fleet_bytes_increase", Family: "bytes_total:increase", Op: RollupSum},
+	}))
+	_, err := receiveString(hub, counterIncreasePush)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"": 13}, gaugeValues(t, scrape(t, hub), "fleet_bytes_increase"))
+}
+
+func TestCounterIncreaseNotRetained(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithScrapeRetention(2), WithCounterIncrease(regexp.MustCompile("^(?:bytes_total)$")))
+	_, err := receiveString(hub, counterIncreasePush)
+	assert.NoError(t, err)
+	assert.Contains(t, scrape(t, hub), "bytes_total:increase")
+
+	// the retained scrape is served again without its increases
+	exposition := scrapeURL(t, hub, "/metrics?after=unknown").Body.String()
+	assert.Contains(t, exposition, "bytes_total{")
+	assert.NotContains(t, exposition, "bytes_total:increase")
+	assert.NotContains(t, NewMetricHub(0, 10).Capabilities().Features, FeatureCounterIncrease)
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrorCode classifies an error response, so clients can branch on the type
+// of error instead of parsing messages
+type ErrorCode string
+
+// Codes of error responses
+const (
+	ErrorCodeInvalidRequest   ErrorCode = "invalid_request"
+	ErrorCodeParseError       ErrorCode = "parse_error"
+	ErrorCodeUnauthorized     ErrorCode = "unauthorized"
+	ErrorCodeUnknownTenant    ErrorCode = "unknown_tenant"
+	ErrorCodeLimitExceeded    ErrorCode = "limit_exceeded"
+	ErrorCodeQuotaExceeded    ErrorCode = "quota_exceeded"
+	ErrorCodeSeriesChurn      ErrorCode = "series_churn"
+	ErrorCodeMissingTimestamp ErrorCode = "missing_timestamp"
+	ErrorCodeMissingIdentity  ErrorCode = "missing_identity"
+	ErrorCodeRateLimited      ErrorCode = "rate_limited"
+	ErrorCodeBatchInProgress  ErrorCode = "batch_in_progress"
+	ErrorCodeImportInProgress ErrorCode = "import_in_progress"
+	ErrorCodeWarmingUp        ErrorCode = "warming_up"
+	ErrorCodeOverloaded       ErrorCode = "overloaded"
+	ErrorCodeShuttingDown     ErrorCode = "shutting_down"
+	ErrorCodeNotFound         ErrorCode = "not_found"
+	ErrorCodeUpstreamError    ErrorCode = "upstream_error"
+	ErrorCodeDeadlineExceeded ErrorCode = "deadline_exceeded"
+	ErrorCodeCanceled         ErrorCode = "canceled"
+	ErrorCodeInternal         ErrorCode = "internal"
+)
+
+// ErrorResponse is the body of every error response of the HTTP API, and the
+// detail of gRPC errors of the hub
+type ErrorResponse struct {
+	Code    ErrorCode         `json:"code"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+var errorResponses = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "error_responses_total", Help: "Number of error responses, by transport and error code"}, []string{"transport", "code"})
+
+func init() {
+	prometheus.MustRegister(errorResponses)
+}
+
+// RecordErrorResponse counts an error response with code sent over transport
+func RecordErrorResponse(transport string, code ErrorCode) {
+	errorResponses.WithLabelValues(transport, string(code)).Inc()
+}
+
+// respondError sends an ErrorResponse with status
+func respondError(ctx echo.Context, status int, code ErrorCode, details map[string]string, format string, args ...interface{}) error {
+	RecordErrorResponse("http", code)
+	ctx.Set(errorCodeKey, code)
+	message := strings.TrimSpace(fmt.Sprintf(format, args...))
+	return ctx.JSON(status, ErrorResponse{Code: code, Message: message, Details: details})
+}
+
+// HTTPErrorHandler sends errors returned by handlers and the router, such as
+// unknown routes, as ErrorResponses. Set it as the HTTPErrorHandler of echo.
+func HTTPErrorHandler(err error, ctx echo.Context) {
+	if ctx.Response().Committed {
+		return
+	}
+	status, code, message := http.StatusInternalServerError, ErrorCodeInternal, err.Error()
+	if httpErr, ok := err.(*echo.HTTPError); ok {
+		status, message = httpErr.Code, fmt.Sprint(httpErr.Message)
+		switch status {
+		case http.StatusNotFound:
+			code = ErrorCodeNotFound
+		case http.StatusUnauthorized:
+			code = ErrorCodeUnauthorized
+		case http.StatusServiceUnavailable:
+			code = ErrorCodeOverloaded
+		default:
+			if status < http.StatusInternalServerError {
+				code = ErrorCodeInvalidRequest
+			}
+		}
+	}
+	if ctx.Request().Method == http.MethodHead {
+		RecordErrorResponse("http", code)
+		_ = ctx.NoContent(status)
+		return
+	}
+	_ = respondError(ctx, status, code, nil, "%s", message)
+}
+
+// respondWarmingUp refuses a request to a hub in its warm-up period
+func respondWarmingUp(ctx echo.Context, remaining time.Duration) error {
+	details := map[string]string{"ready_in": remaining.Round(time.Second).String()}
+	return respondError(ctx, http.StatusServiceUnavailable, ErrorCodeWarmingUp, details, "hub is warming up, ready in %v", remaining.Round(time.Second))
+}
+
+// receiveErrorCode returns the error code for an error from receiveFamilies
+func receiveErrorCode(err error) ErrorCode {
+	switch err.(type) {
+	case *quotaError:
+		return ErrorCodeQuotaExceeded
+	case *churnError:
+		return ErrorCodeSeriesChurn
+	case *tenantError:
+		return ErrorCodeUnknownTenant
+	case *missingTimestampError:
+		return ErrorCodeMissingTimestamp
+	case *missingIdentityError:
+		return ErrorCodeMissingIdentity
+	}
+	return ErrorCodeLimitExceeded
+}
+
+// receiveErrorDetails returns the details of an error from receiveFamilies
+func receiveErrorDetails(err error) map[string]string {
+	switch e := err.(type) {
+	case *quotaError:
+		return map[string]string{"label": e.quota.Label, "value": e.quota.Value, "quota": strconv.Itoa(e.quota.Datapoints), "requested": strconv.Itoa(e.requested)}
+	case *churnError:
+		return map[string]string{"scope": e.key.scope, "value": e.key.value, "limit": strconv.Itoa(e.limit), "new_series": strconv.Itoa(e.pushed)}
+	case *tenantError:
+		return map[string]string{"reason": e.reason}
+	case *missingTimestampError:
+		return map[string]string{"family": e.family, "datapoints": strconv.Itoa(e.datapoints)}
+	case *missingIdentityError:
+		return map[string]string{"family": e.family, "label": e.label, "datapoints": strconv.Itoa(e.datapoints)}
+	}
+	return nil
+}
+
+// respondReceiveError sends the ErrorResponse for an error from
+// receiveFamilies
+func respondReceiveError(ctx echo.Context, err error) error {
+	return respondError(ctx, receiveErrorStatus(err), receiveErrorCode(err), receiveErrorDetails(err), "%v", err)
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) ErrorResponse {
+	var resp ErrorResponse
+	assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestReceiveErrorResponses(t *testing.T) {
+	hub := NewMetricHub(2, 10, WithLabelQuotas([]LabelQuota{{Label: "gatewayID", Value: "gw1", Datapoints: 1, Tier: QuotaTierReject}}))
+
+	parseErrors := errorResponses.WithLabelValues("http", string(ErrorCodeParseError))
+	before := testutil.ToFloat64(parseErrors)
+	rec, err := receiveString(hub, "up{")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, ErrorCodeParseError, decodeError(t, rec).Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(parseErrors))
+
+	rec, err = receiveString(hub, "a{gatewayID=\"gw1\"} 1 1000\na{gatewayID=\"gw1\"} 2 2000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	resp := decodeError(t, rec)
+	assert.Equal(t, ErrorCodeQuotaExceeded, resp.Code)
+	assert.Equal(t, map[string]string{"label": "gatewayID", "value": "gw1", "quota": "1", "requested": "2"}, resp.Details)
+	assert.False(t, strings.HasSuffix(resp.Message, "\n"))
+
+	rec, err = receiveString(hub, "a 1 1000\nb 1 1000\nc 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+	assert.Equal(t, ErrorCodeLimitExceeded, decodeError(t, rec).Code)
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.GET("/fails", func(ctx echo.Context) error { return echo.NewHTTPError(http.StatusBadRequest, "bad") })
+
+	rec := serve(e, httptest.NewRequest(http.MethodGet, "/no/such/path", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, ErrorCodeNotFound, decodeError(t, rec).Code)
+
+	rec = serve(e, httptest.NewRequest(http.MethodGet, "/fails", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, ErrorResponse{Code: ErrorCodeInvalidRequest, Message: "bad"}, decodeError(t, rec))
+}
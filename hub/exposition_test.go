@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+// updateGolden rewrites the golden files of TestExpositionGolden from the
+// current output, e.g. go test ./hub -run TestExpositionGolden -update
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata/exposition")
+
+// TestExpositionGolden pushes every testdata/exposition/*.prom file into a
+// hub and compares the scrapes in each format with the golden files next to
+// it, so changes to escaping, ordering or HELP and TYPE placement show up in
+// review
+func TestExpositionGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "exposition", "*.prom"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, inputs)
+
+	formats := []struct {
+		query  string
+		suffix string
+		// normalize makes the output independent of the nondeterministic
+		// parts of the format
+		normalize func(string) string
+	}{
+		{"", ".txt", sortFamilyBlocks},
+		{"format=" + ScrapeFormatJSONL, ".jsonl", func(s string) string { return s }},
+	}
+	for _, input := range inputs {
+		body, err := ioutil.ReadFile(input)
+		assert.NoError(t, err)
+		for _, format := range formats {
+			golden := strings.TrimSuffix(input, ".prom") + format.suffix
+			t.Run(filepath.Base(golden), func(t *testing.T) {
+				hub := NewMetricHub(0, 10)
+				resp, err := receiveString(hub, string(body))
+				assert.NoError(t, err)
+				assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+				req := httptest.NewRequest(http.MethodGet, "/metrics?"+format.query, nil)
+				rec := httptest.NewRecorder()
+				assert.NoError(t, hub.Scrape(echo.New().NewContext(req, rec)))
+				assert.Equal(t, http.StatusOK, rec.Code)
+				output := format.normalize(rec.Body.String())
+
+				if *updateGolden {
+					assert.NoError(t, ioutil.WriteFile(golden, []byte(output), 0644))
+					return
+				}
+				expected, err := ioutil.ReadFile(golden)
+				assert.NoError(t, err)
+				assert.Equal(t, string(expected), output)
+			})
+		}
+	}
+}
+
+// sortFamilyBlocks sorts the families of a text exposition by name, since
+// scrapes serialize families in parallel and write them in the order they
+// finish. The order of lines within a family is kept.
+func sortFamilyBlocks(text string) string {
+	blocks := make(map[string]*strings.Builder)
+	var names []string
+	var block *strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			continue
+		}
+		if name := commentFamily(line); name != "" {
+			if _, ok := blocks[name]; !ok {
+				blocks[name] = &strings.Builder{}
+				names = append(names, name)
+			}
+			block = blocks[name]
+		}
+		if block == nil {
+			// lines before the first HELP or TYPE line
+			block = &strings.Builder{}
+			blocks[""] = block
+			names = append(names, "")
+		}
+		block.WriteString(line)
+	}
+	sort.Strings(names)
+	var sorted strings.Builder
+	for _, name := range names {
+		sorted.WriteString(blocks[name].String())
+	}
+	return sorted.String()
+}
+
+// commentFamily returns the family name of a HELP or TYPE line, or "" for
+// other lines
+func commentFamily(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || fields[0] != "#" || (fields[1] != "HELP" && fields[1] != "TYPE") {
+		return ""
+	}
+	return fields[2]
+}
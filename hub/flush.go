@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var flushedDatapoints = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "flushed_datapoints_total", Help: "Number of datapoints taken out of the hub by /admin/flush, by whether they were forwarded upstream or returned in the response"}, []string{"destination"})
+
+func init() {
+	prometheus.MustRegister(flushedDatapoints)
+}
+
+// extractMatching takes the series matching any of selectors out of the hub
+func (c *MetricHub) extractMatching(selectors []*selector) map[string]*familyAndMetrics {
+	c.Lock()
+	extracted := make(map[string]*familyAndMetrics)
+	datapoints, imported := 0, 0
+	for name, family := range c.metricFamiliesByName {
+		matched := &familyAndMetrics{
+			family:        family.family,
+			metrics:       make(map[string]*series),
+			bufferedSince: family.bufferedSince,
+		}
+		for seriesName, queue := range family.metrics {
+			for _, sel := range selectors {
+				if sel.matches(name, queue.labels) {
+					matched.metrics[seriesName] = queue
+					datapoints += len(queue.samples)
+					imported += countImported(queue.samples)
+					delete(family.metrics, seriesName)
+					c.stats.currentCountSeries--
+					break
+				}
+			}
+		}
+		if len(matched.metrics) > 0 {
+			extracted[name] = matched
+		}
+		if len(family.metrics) == 0 {
+			delete(c.metricFamiliesByName, name)
+			c.stats.currentCountFamilies--
+		}
+	}
+	c.stats.currentCountDatapoints -= datapoints
+	c.stats.currentCountImportedDatapoints -= imported
+	hubSize.Set(float64(c.stats.currentCountDatapoints))
+
+	// the WAL must not replay the flushed datapoints after a restart
+	var walSegment int
+	var walRemaining []walRecord
+	if c.wal != nil && datapoints > 0 {
+		walSegment, walRemaining = c.rotateWAL()
+	}
+	c.Unlock()
+
+	if c.wal != nil && datapoints > 0 {
+		if err := c.wal.checkpoint(walSegment, walRemaining); err != nil {
+			logging.Error("Error writing write-ahead log checkpoint", "err", err)
+		}
+	}
+	if c.clockGuard != nil {
+		c.clockGuard.advance(extracted)
+	}
+	return extracted
+}
+
+// Flush handles POST /admin/flush?match[]=<selector>, which takes the series
+// matching any of the selectors out of the hub right away, without waiting for
+// the next scrape. With an upstream or remote write they are sent to it,
+// otherwise they are returned in the text format.
+func (c *MetricHub) Flush(ctx echo.Context) error {
+	params := ctx.QueryParams()["match[]"]
+	if len(params) == 0 {
+		return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "at least one match[] selector is required")
+	}
+	selectors := make([]*selector, 0, len(params))
+	for _, param := range params {
+		sel, err := parseSelector(param)
+		if err != nil {
+			return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, map[string]string{"selector": param}, "%v", err)
+		}
+		selectors = append(selectors, sel)
+	}
+
+	extracted := c.extractMatching(selectors)
+	if c.upstream == nil {
+		datapoints := 0
+		for _, fam := range extracted {
+			for _, queue := range fam.metrics {
+				datapoints += len(queue.samples)
+			}
+		}
+		exposition := c.exposeDrained(extracted, c.scrapeWorkers)
+		flushedDatapoints.WithLabelValues("response").Add(float64(datapoints))
+		ctx.Response().Header().Set(DatapointsHeader, strconv.Itoa(datapoints))
+		return ctx.String(http.StatusOK, exposition)
+	}
+
+	families := make([]*dto.MetricFamily, 0, len(extracted))
+	for _, fam := range extracted {
+		families = append(families, c.popOrdered(fam))
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].GetName() < families[j].GetName()
+	})
+	batch := c.newForwardBatch(families)
+	ctx.Response().Header().Set(DatapointsHeader, strconv.Itoa(batch.datapoints))
+	switch c.forward(batch) {
+	case forwardFailed:
+		c.requeue(extracted)
+		return respondError(ctx, http.StatusBadGateway, ErrorCodeUpstreamError, nil, "error forwarding flushed datapoints, they were put back into the hub")
+	case forwardUncertain:
+		// sent again with the next retry of the upstream
+		c.holdUnacked(batch)
+		return ctx.String(http.StatusAccepted, fmt.Sprintf("%d datapoints will be forwarded once the upstream recovers\n", batch.datapoints))
+	}
+	flushedDatapoints.WithLabelValues("upstream").Add(float64(batch.datapoints))
+	return ctx.String(http.StatusOK, fmt.Sprintf("forwarded %d datapoints\n", batch.datapoints))
+}
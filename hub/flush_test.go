@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func flush(t *testing.T, hub *MetricHub, selectors ...string) *httptest.ResponseRecorder {
+	query := url.Values{"match[]": selectors}
+	req := httptest.NewRequest(http.MethodPost, "/admin/flush?"+query.Encode(), nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.Flush(echo.New().NewContext(req, rec)))
+	return rec
+}
+
+func TestFlush(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, `alarms_total{severity="critical"} 1 1000
+alarms_total{severity="minor"} 2 1000
+up 1 1000
+`)
+	assert.NoError(t, err)
+
+	rec := flush(t, hub, `alarms_total{severity="critical"}`, `missing_total`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "# TYPE alarms_total untyped\nalarms_total{severity=\"critical\"} 1 1000\n", rec.Body.String())
+	assert.Equal(t, "1", rec.Header().Get(DatapointsHeader))
+	assert.Equal(t, 2, hub.Status().Datapoints)
+
+	// the rest is left for the next scrape
+	scraped := scrape(t, hub)
+	assert.Contains(t, scraped, "alarms_total{severity=\"minor\"} 2 1000\n")
+	assert.Contains(t, scraped, "up 1 1000\n")
+	assert.NotContains(t, scraped, "critical")
+}
+
+func TestFlushInvalidSelectors(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	assert.Equal(t, http.StatusBadRequest, flush(t, hub).Code)
+	assert.Equal(t, http.StatusBadRequest, flush(t, hub, `alarms{`).Code)
+}
+
+func TestFlushForwards(t *testing.T) {
+	upstream := NewMetricHub(0, 10)
+	down := int32(1)
+	server := startUpstream(upstream, &down)
+	defer server.Close()
+
+	hub := NewMetricHub(0, 10, WithUpstream(server.URL+"/metrics", time.Second))
+	_, err := receiveString(hub, "alarms_total 1 1000\nup 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, hub.Status().Datapoints)
+
+	// put back while the upstream is down
+	rec := flush(t, hub, "alarms_total")
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, 2, hub.Status().Datapoints)
+
+	atomic.StoreInt32(&down, 0)
+	rec = flush(t, hub, "alarms_total")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, hub.Status().Datapoints)
+	assert.Equal(t, 1, upstream.Status().Datapoints)
+	assert.Equal(t, "# TYPE alarms_total untyped\nalarms_total 1 1000\n", scrape(t, upstream))
+}
+
+func TestFlushImported(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	rec := importBody(hub, strings.NewReader("old 1 1000\nold 2 2000\n"), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	_, err := receiveString(hub, "live 1 1000\nlive 2 2000\n")
+	assert.NoError(t, err)
+
+	// only the flushed live datapoints stop counting against the hub limit
+	assert.Equal(t, http.StatusOK, flush(t, hub, "live").Code)
+	assert.Equal(t, 0, hub.liveDatapoints())
+	assert.Equal(t, 2, hub.stats.currentCountImportedDatapoints)
+
+	assert.Equal(t, http.StatusOK, flush(t, hub, "old").Code)
+	assert.Equal(t, 0, hub.stats.currentCountImportedDatapoints)
+}
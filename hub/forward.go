@@ -0,0 +1,317 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+var (
+	forwardedDatapoints   = prometheus.NewCounter(prometheus.CounterOpts{Name: "forwarded_datapoints_total", Help: "Number of datapoints forwarded to the upstream"})
+	forwardFailures       = prometheus.NewCounter(prometheus.CounterOpts{Name: "forward_failures_total", Help: "Number of failed sends to the upstream"})
+	forwardBufferedPoints = prometheus.NewCounter(prometheus.CounterOpts{Name: "forward_buffered_datapoints_total", Help: "Number of pushed datapoints buffered locally because the upstream was unreachable"})
+	forwardDroppedPoints  = prometheus.NewCounter(prometheus.CounterOpts{Name: "forward_dropped_datapoints_total", Help: "Number of datapoints dropped because the upstream refused them as invalid"})
+	forwardUpstreamUp     = prometheus.NewGauge(prometheus.GaugeOpts{Name: "forward_upstream_up", Help: "1 if the last send to the upstream succeeded, 0 otherwise"})
+)
+
+func init() {
+	prometheus.MustRegister(forwardedDatapoints, forwardFailures, forwardBufferedPoints, forwardDroppedPoints, forwardUpstreamUp)
+}
+
+// WithUpstream turns the hub into a store-and-forward proxy. Pushes are
+// forwarded to the hub at url (its push endpoint, e.g.
+// http://central:9091/metrics) as they arrive, and only buffered locally while
+// the upstream is unreachable, or while datapoints buffered before them are
+// not forwarded yet. RunForwarding sends the buffer once the upstream
+// recovers.
+func WithUpstream(url string, timeout time.Duration) Option {
+	return func(hub *MetricHub) {
+		hub.upstream = &hubUpstream{url: url, client: &http.Client{Timeout: timeout}}
+		hub.batchIDPrefix = newBatchIDPrefix()
+	}
+}
+
+// newBatchIDPrefix returns a random prefix for the IDs of batches sent
+// upstream, so they don't collide with those of other hubs pushing to it
+func newBatchIDPrefix() string {
+	prefix := make([]byte, 8)
+	if _, err := rand.Read(prefix); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(prefix)
+}
+
+// upstream receives datapoints forwarded by the hub
+type upstream interface {
+	// send forwards the families of batch, returning a permanentError if
+	// retrying them cannot succeed, and an uncertainError if the upstream may
+	// have stored them anyway
+	send(batch *forwardBatch) error
+}
+
+// forwardBatch is a set of families sent to the upstream under an ID, so an
+// upstream deduplicating batches stores them once however often they are sent
+type forwardBatch struct {
+	id         string
+	families   []*dto.MetricFamily
+	datapoints int
+}
+
+func (c *MetricHub) newForwardBatch(families []*dto.MetricFamily) *forwardBatch {
+	return &forwardBatch{
+		id:         fmt.Sprintf("%s-%d", c.batchIDPrefix, atomic.AddUint64(&c.batchSeq, 1)),
+		families:   families,
+		datapoints: countDatapoints(families),
+	}
+}
+
+// permanentError is returned by upstreams refusing datapoints as invalid
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// uncertainError is returned when a send failed without a response from the
+// upstream, e.g. on a timeout, so it may have stored the datapoints
+type uncertainError struct {
+	err error
+}
+
+func (e *uncertainError) Error() string {
+	return e.err.Error()
+}
+
+// hubUpstream forwards to the push endpoint of another hub in text format
+type hubUpstream struct {
+	url    string
+	client *http.Client
+}
+
+func (u *hubUpstream) send(batch *forwardBatch) error {
+	var body bytes.Buffer
+	for _, family := range batch.families {
+		if _, err := expfmt.MetricFamilyToText(&body, family); err != nil {
+			return &permanentError{err: fmt.Errorf("error encoding family %s: %v", family.GetName(), err)}
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u.url, &body)
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	req.Header.Set(echo.HeaderContentType, string(expfmt.FmtText))
+	req.Header.Set(BatchIDHeader, batch.id)
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return &uncertainError{err: err}
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	switch {
+	case resp.StatusCode/100 == 2:
+		return nil
+	case resp.StatusCode == http.StatusBadRequest:
+		return &permanentError{err: fmt.Errorf("upstream refused push: %s", msg)}
+	}
+	return fmt.Errorf("upstream responded %d: %s", resp.StatusCode, msg)
+}
+
+// forwardOutcome is the result of sending a batch to the upstream
+type forwardOutcome int
+
+const (
+	// forwardDone means the batch was accepted or dropped as invalid
+	forwardDone forwardOutcome = iota
+	// forwardFailed means the upstream did not store the batch
+	forwardFailed
+	// forwardUncertain means the upstream may have stored the batch
+	forwardUncertain
+)
+
+// forwardPush sends pushed families to the upstream and reports whether they
+// no longer need to be stored locally. While the upstream is down pushes are
+// buffered without trying it, so they don't wait on its timeout. Pushes are
+// also buffered until the datapoints buffered before them are forwarded, so
+// the upstream never gets newer datapoints ahead of older ones and refuses
+// those as out of order. Pushes are always stored for periodic upstreams.
+func (c *MetricHub) forwardPush(families []*dto.MetricFamily) bool {
+	if c.periodicUpstream {
+		return false
+	}
+	if atomic.LoadInt32(&c.upstreamDown) == 0 && !c.backlogged() {
+		batch := c.newForwardBatch(families)
+		switch c.forward(batch) {
+		case forwardDone:
+			return true
+		case forwardUncertain:
+			c.holdUnacked(batch)
+			return true
+		}
+	}
+	forwardBufferedPoints.Add(float64(countDatapoints(families)))
+	return false
+}
+
+// backlogged reports whether datapoints are buffered, queued, unacked or being
+// sent by RunForwarding, i.e. waiting to be forwarded ahead of a new push
+func (c *MetricHub) backlogged() bool {
+	if atomic.LoadInt32(&c.draining) != 0 {
+		return true
+	}
+	c.Lock()
+	defer c.Unlock()
+	return c.stats.currentCountDatapoints+c.queuedDatapoints+c.unackedDatapoints > 0
+}
+
+// forward sends batch to the upstream
+func (c *MetricHub) forward(batch *forwardBatch) forwardOutcome {
+	if batch.datapoints == 0 {
+		return forwardDone
+	}
+
+	err := c.upstream.send(batch)
+	if err == nil {
+		c.setUpstreamUp(true)
+		forwardedDatapoints.Add(float64(batch.datapoints))
+		return forwardDone
+	}
+	if _, ok := err.(*permanentError); ok {
+		c.setUpstreamUp(true)
+		forwardDroppedPoints.Add(float64(batch.datapoints))
+		logging.Error("Dropping datapoints that failed to forward", "datapoints", batch.datapoints, "err", err)
+		return forwardDone
+	}
+	c.setUpstreamUp(false)
+	forwardFailures.Inc()
+	logging.Error("Error forwarding datapoints", "datapoints", batch.datapoints, "err", err)
+	if _, ok := err.(*uncertainError); ok {
+		return forwardUncertain
+	}
+	return forwardFailed
+}
+
+// holdUnacked keeps batch to be sent again under the same ID. Requeuing it
+// instead would merge it with other datapoints into a batch with a new ID, and
+// store it twice if the upstream did store it.
+func (c *MetricHub) holdUnacked(batch *forwardBatch) {
+	c.Lock()
+	defer c.Unlock()
+	c.unacked = append(c.unacked, batch)
+	c.unackedDatapoints += batch.datapoints
+	forwardBufferedPoints.Add(float64(batch.datapoints))
+}
+
+// retryUnacked sends the held batches again in order, and reports whether the
+// upstream confirmed all of them
+func (c *MetricHub) retryUnacked() bool {
+	for {
+		c.Lock()
+		if len(c.unacked) == 0 {
+			c.Unlock()
+			return true
+		}
+		batch := c.unacked[0]
+		c.Unlock()
+
+		if c.forward(batch) != forwardDone {
+			return false
+		}
+		c.Lock()
+		c.unacked = c.unacked[1:]
+		c.unackedDatapoints -= batch.datapoints
+		c.Unlock()
+	}
+}
+
+func (c *MetricHub) setUpstreamUp(up bool) {
+	if up {
+		atomic.StoreInt32(&c.upstreamDown, 0)
+		forwardUpstreamUp.Set(1)
+		return
+	}
+	atomic.StoreInt32(&c.upstreamDown, 1)
+	forwardUpstreamUp.Set(0)
+}
+
+func countDatapoints(families []*dto.MetricFamily) int {
+	datapoints := 0
+	for _, family := range families {
+		datapoints += len(family.Metric)
+	}
+	return datapoints
+}
+
+// RunForwarding sends the datapoints buffered while the upstream was
+// unreachable every interval until stop is closed. Datapoints are put back in
+// the buffer if the upstream is still unreachable, and pushes are forwarded
+// directly again once the buffer is empty. Does nothing if the hub has no
+// upstream.
+func (c *MetricHub) RunForwarding(interval time.Duration, stop <-chan struct{}) {
+	if c.upstream == nil {
+		return
+	}
+	ticks, stopTicker := c.clock.NewTicker(interval)
+	defer stopTicker()
+	for {
+		select {
+		case <-ticks:
+			c.flushToUpstream()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// flushToUpstream sends the held batches again, then drains the buffer and
+// forwards it
+func (c *MetricHub) flushToUpstream() {
+	if !c.retryUnacked() {
+		return
+	}
+	if c.Status().Datapoints == 0 {
+		c.setUpstreamUp(true)
+		return
+	}
+	// pushes are buffered until the drained datapoints are forwarded or back
+	// in the hub
+	atomic.StoreInt32(&c.draining, 1)
+	defer atomic.StoreInt32(&c.draining, 0)
+	drained, _ := c.drain()
+	families := make([]*dto.MetricFamily, 0, len(drained))
+	for _, family := range drained {
+		families = append(families, c.popOrdered(family))
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].GetName() < families[j].GetName()
+	})
+	batch := c.newForwardBatch(families)
+	switch c.forward(batch) {
+	case forwardFailed:
+		c.requeue(drained)
+	case forwardUncertain:
+		c.holdUnacked(batch)
+	}
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// startUpstream serves the push endpoint of upstream, responding 503 while
+// down is set
+func startUpstream(upstream *MetricHub, down *int32) *httptest.Server {
+	e := echo.New()
+	e.POST("/metrics", func(ctx echo.Context) error {
+		if atomic.LoadInt32(down) != 0 {
+			return ctx.NoContent(http.StatusServiceUnavailable)
+		}
+		return upstream.Receive(ctx)
+	})
+	return httptest.NewServer(e)
+}
+
+func TestForwardPushes(t *testing.T) {
+	upstream := NewMetricHub(0, 10)
+	var down int32
+	server := startUpstream(upstream, &down)
+	defer server.Close()
+
+	hub := NewMetricHub(0, 10, WithUpstream(server.URL+"/metrics", time.Second))
+	resp, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, 14, upstream.Status().Datapoints)
+
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "grpc_metric", 3, testLabels, timestamp)})
+	assert.Equal(t, 3, result.AcceptedDatapoints)
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, 17, upstream.Status().Datapoints)
+}
+
+func TestForwardBuffersWhileUpstreamDown(t *testing.T) {
+	upstream := NewMetricHub(0, 10)
+	down := int32(1)
+	server := startUpstream(upstream, &down)
+	defer server.Close()
+
+	hub := NewMetricHub(0, 10, WithUpstream(server.URL+"/metrics", time.Second))
+	resp, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 14, hub.Status().Datapoints)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hub.upstreamDown))
+
+	// still down, so the buffer is kept
+	hub.flushToUpstream()
+	assert.Equal(t, 14, hub.Status().Datapoints)
+	assert.Equal(t, 0, upstream.Status().Datapoints)
+
+	// pushes are buffered without trying the upstream until the buffer is
+	// sent
+	atomic.StoreInt32(&down, 0)
+	hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "grpc_metric", 3, testLabels, timestamp)})
+	assert.Equal(t, 17, hub.Status().Datapoints)
+	assert.Equal(t, 0, upstream.Status().Datapoints)
+
+	hub.flushToUpstream()
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, 17, upstream.Status().Datapoints)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&hub.upstreamDown))
+
+	_, err = receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, 31, upstream.Status().Datapoints)
+}
+
+func TestForwardKeepsBacklogOrder(t *testing.T) {
+	upstream := NewMetricHub(0, 10)
+	down := int32(1)
+	server := startUpstream(upstream, &down)
+	defer server.Close()
+
+	hub := NewMetricHub(0, 10, WithUpstream(server.URL+"/metrics", time.Second))
+	_, err := receiveString(hub, "a 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, hub.Status().Datapoints)
+
+	// the upstream is back, e.g. after a flush succeeded, but the push is
+	// buffered behind the older datapoint
+	atomic.StoreInt32(&down, 0)
+	hub.setUpstreamUp(true)
+	_, err = receiveString(hub, "a 2 2000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, hub.Status().Datapoints)
+	assert.Equal(t, 0, upstream.Status().Datapoints)
+
+	hub.flushToUpstream()
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, "# TYPE a untyped\na 1 1000\na 2 2000\n", scrape(t, upstream))
+
+	// forwarded right away once nothing is buffered
+	_, err = receiveString(hub, "a 3 3000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, 1, upstream.Status().Datapoints)
+}
+
+func TestForwardBuffersWhileUpstreamFull(t *testing.T) {
+	upstream := NewMetricHub(10, 10)
+	var down int32
+	server := startUpstream(upstream, &down)
+	defer server.Close()
+
+	hub := NewMetricHub(0, 10, WithUpstream(server.URL+"/metrics", time.Second))
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, 14, hub.Status().Datapoints)
+}
+
+func TestForwardDropsInvalidPushes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	hub := NewMetricHub(0, 10, WithUpstream(server.URL, time.Second))
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&hub.upstreamDown))
+}
+
+func TestForwardRetriesUncertainBatches(t *testing.T) {
+	upstream := NewMetricHub(0, 10, WithBatchDeduplication(time.Minute))
+	var slow int32 = 1
+	e := echo.New()
+	e.POST("/metrics", func(ctx echo.Context) error {
+		err := upstream.Receive(ctx)
+		// store the push, but respond after the hub gave up on it
+		if atomic.LoadInt32(&slow) != 0 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return err
+	})
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	hub := NewMetricHub(0, 10, WithUpstream(server.URL+"/metrics", 50*time.Millisecond))
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, 14, upstream.Status().Datapoints)
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, 14, hub.unackedDatapoints)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hub.upstreamDown))
+
+	// pushes while the upstream is down are buffered behind the held batch
+	hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "grpc_metric", 3, testLabels, timestamp)})
+	assert.Equal(t, 3, hub.Status().Datapoints)
+
+	atomic.StoreInt32(&slow, 0)
+	hub.flushToUpstream()
+	assert.Equal(t, 0, hub.unackedDatapoints)
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, 17, upstream.Status().Datapoints)
+}
+
+func TestForwardCountsUnackedAgainstLimit(t *testing.T) {
+	hub := NewMetricHub(20, 10)
+	hub.holdUnacked(&forwardBatch{id: "a-1", datapoints: 10})
+
+	resp, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotAcceptable, resp.Code)
+}
+
+func TestRunForwardingWithoutUpstream(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	done := make(chan struct{})
+	go func() {
+		hub.RunForwarding(time.Millisecond, nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunForwarding did not return for a hub without upstream")
+	}
+}
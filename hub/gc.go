@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	gcPercent          = prometheus.NewGauge(prometheus.GaugeOpts{Name: "gc_percent", Help: "GOGC of the hub, negative if the GC is off"})
+	memoryLimitBytes   = prometheus.NewGauge(prometheus.GaugeOpts{Name: "memory_limit_bytes", Help: "Soft memory limit of the Go runtime, 0 if unset"})
+	memoryBallastBytes = prometheus.NewGauge(prometheus.GaugeOpts{Name: "memory_ballast_bytes", Help: "Size of the memory ballast"})
+	scrapeGCCycles     = prometheus.NewCounter(prometheus.CounterOpts{Name: "scrape_gc_cycles_total", Help: "Number of GC cycles that completed during scrapes"})
+	scrapeGCPause      = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "scrape_gc_pause_seconds", Help: "Total GC stop-the-world pause time during a scrape", Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8)})
+
+	// ballast is never read. It raises the heap size the GC paces against,
+	// so a large scrape doesn't trigger a collection as soon as the heap
+	// grows past twice a small live set.
+	ballast []byte
+)
+
+func init() {
+	prometheus.MustRegister(gcPercent, memoryLimitBytes, memoryBallastBytes, scrapeGCCycles, scrapeGCPause)
+}
+
+// TuneGC configures the garbage collector for the small edge boxes the hub
+// typically runs on, where a scrape allocates a large part of memory at once.
+// percent is used as GOGC and limit in bytes as the soft memory limit of the
+// runtime, unless they are 0 or the GOGC and GOMEMLIMIT environment variables
+// are set. A ballast of ballastBytes is allocated if > 0. The memory limit
+// requires the hub to be built with Go 1.19 or newer, and is ignored with a
+// warning otherwise.
+func TuneGC(percent int, limit int64, ballastBytes int64) {
+	if _, ok := os.LookupEnv("GOGC"); !ok && percent != 0 {
+		logging.Info("Setting GOGC", "percent", percent)
+		debug.SetGCPercent(percent)
+	}
+	// setting the percent returns the previous value
+	current := debug.SetGCPercent(100)
+	debug.SetGCPercent(current)
+	gcPercent.Set(float64(current))
+
+	if _, ok := os.LookupEnv("GOMEMLIMIT"); !ok && limit > 0 {
+		if err := setMemoryLimit(limit); err != nil {
+			logging.Warn("Not setting memory limit", "bytes", limit, "err", err)
+		} else {
+			logging.Info("Setting memory limit", "bytes", limit)
+		}
+	}
+	memoryLimitBytes.Set(float64(memoryLimit()))
+
+	if ballastBytes > 0 {
+		ballast = make([]byte, ballastBytes)
+		runtime.KeepAlive(ballast)
+	}
+	memoryBallastBytes.Set(float64(len(ballast)))
+}
+
+// observeScrapeGC starts recording the GC cycles and pause time of a scrape.
+// Call the returned function once the scrape is done.
+func observeScrapeGC() func() {
+	var before debug.GCStats
+	debug.ReadGCStats(&before)
+	return func() {
+		var after debug.GCStats
+		debug.ReadGCStats(&after)
+		scrapeGCCycles.Add(float64(after.NumGC - before.NumGC))
+		scrapeGCPause.Observe((after.PauseTotal - before.PauseTotal).Seconds())
+	}
+}
@@ -0,0 +1,32 @@
+//go:build go1.19
+// +build go1.19
+
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"math"
+	"runtime/debug"
+)
+
+func setMemoryLimit(limit int64) error {
+	debug.SetMemoryLimit(limit)
+	return nil
+}
+
+// memoryLimit returns the soft memory limit of the runtime, or 0 if there is
+// none
+func memoryLimit() int64 {
+	// a negative input only reads the limit
+	limit := debug.SetMemoryLimit(-1)
+	if limit == math.MaxInt64 {
+		return 0
+	}
+	return limit
+}
@@ -0,0 +1,21 @@
+//go:build !go1.19
+// +build !go1.19
+
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import "errors"
+
+func setMemoryLimit(limit int64) error {
+	return errors.New("memory limits require Go 1.19 or newer")
+}
+
+func memoryLimit() int64 {
+	return 0
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTuneGC(t *testing.T) {
+	if _, ok := os.LookupEnv("GOGC"); ok {
+		t.Skip("GOGC is set")
+	}
+	previous := debug.SetGCPercent(100)
+	defer func() {
+		debug.SetGCPercent(previous)
+		ballast = nil
+	}()
+
+	TuneGC(50, 0, 1024)
+	assert.Equal(t, 50.0, testutil.ToFloat64(gcPercent))
+	assert.Equal(t, 1024.0, testutil.ToFloat64(memoryBallastBytes))
+	assert.Equal(t, 1024, len(ballast))
+
+	// 0 keeps the current settings
+	TuneGC(0, 0, 0)
+	assert.Equal(t, 50.0, testutil.ToFloat64(gcPercent))
+	assert.Equal(t, 1024.0, testutil.ToFloat64(memoryBallastBytes))
+}
+
+func TestObserveScrapeGC(t *testing.T) {
+	cycles := testutil.ToFloat64(scrapeGCCycles)
+	done := observeScrapeGC()
+	runtime.GC()
+	done()
+	assert.True(t, testutil.ToFloat64(scrapeGCCycles) >= cycles+1)
+}
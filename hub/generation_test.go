@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	stressPushers         = 8
+	stressPushesPerPusher = 200
+)
+
+// TestConcurrentPushAndScrapeStress pushes unique datapoints over HTTP and
+// gRPC while scraping continuously, and checks that every datapoint is served
+// by exactly one scrape
+func TestConcurrentPushAndScrapeStress(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+
+	var (
+		pushers  sync.WaitGroup
+		scrapes  []string
+		scraping = make(chan struct{})
+		scraped  = make(chan struct{})
+	)
+	go func() {
+		defer close(scraped)
+		for {
+			select {
+			case <-scraping:
+				return
+			default:
+				_, text := hub.scrapeExposition(0, scrapeClassAll, expfmt.FmtText, nil)
+				scrapes = append(scrapes, text)
+			}
+		}
+	}()
+
+	for p := 0; p < stressPushers; p++ {
+		pushers.Add(1)
+		go func(pusher int) {
+			defer pushers.Done()
+			for i := 0; i < stressPushesPerPusher; i++ {
+				ts := int64(i + 1)
+				if i%2 == 0 {
+					body := fmt.Sprintf("stress_http{pusher=\"%d\"} 1 %d\n# TYPE stress_shared gauge\nstress_shared{pusher=\"%d\"} 1 %d\n", pusher, ts, pusher, ts)
+					_, err := receiveString(hub, body)
+					assert.NoError(t, err)
+					continue
+				}
+				labelName, labelValue := "pusher", fmt.Sprint(pusher)
+				labels := []*dto.LabelPair{{Name: &labelName, Value: &labelValue}}
+				hub.ReceiveGRPC([]*dto.MetricFamily{
+					makeFamily(dto.MetricType_GAUGE, "stress_grpc", 1, labels, ts),
+					makeFamily(dto.MetricType_GAUGE, "stress_shared", 1, labels, ts),
+				})
+			}
+		}(p)
+	}
+	pushers.Wait()
+	close(scraping)
+	<-scraped
+	_, text := hub.scrapeExposition(0, scrapeClassAll, expfmt.FmtText, nil)
+	scrapes = append(scrapes, text)
+
+	seen := make(map[string]int)
+	for _, text := range scrapes {
+		var parser expfmt.TextParser
+		families, err := parser.TextToMetricFamilies(strings.NewReader(text))
+		assert.NoError(t, err)
+		for _, fam := range families {
+			for _, metric := range fam.Metric {
+				seen[fmt.Sprintf("%s/%s", makeLabeledName(metric, fam.GetName()), fmt.Sprint(metric.GetTimestampMs()))]++
+			}
+		}
+	}
+
+	// every push stores two datapoints
+	assert.Equal(t, 2*stressPushers*stressPushesPerPusher, len(seen))
+	for datapoint, count := range seen {
+		assert.Equal(t, 1, count, "datapoint %s scraped more than once", datapoint)
+	}
+	assert.Equal(t, 0, hub.Status().Datapoints)
+}
+
+func TestRequeueKeepsUnservedGeneration(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+
+	drained, _ := hub.drain()
+	_, err = receiveString(hub, "late_push 1 1000\n")
+	assert.NoError(t, err)
+	hub.requeue(drained)
+	assert.Equal(t, 15, hub.Status().Datapoints)
+	assert.Equal(t, 4, hub.stats.currentCountFamilies)
+
+	text := scrape(t, hub)
+	assert.Equal(t, 15, strings.Count(text, "\n")-strings.Count(text, "#"))
+}
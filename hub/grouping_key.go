@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/labstack/echo"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// base64Suffix marks a label name of a grouping key whose value is base64url
+// encoded, so it can hold slashes or be empty, as in the pushgateway
+const base64Suffix = "@base64"
+
+// ReceiveGrouped is a handler function receiving pushes to pushgateway style
+// paths, /metrics/job/<job>{/<label>/<value>}, so existing pushgateway
+// clients can push to the hub unchanged. The labels of the path, the
+// grouping key, are attached to every pushed metric, replacing pushed labels
+// of the same name. Unlike the pushgateway, the hub has no groups, so a PUT
+// doesn't replace earlier pushes with the same grouping key.
+func (c *MetricHub) ReceiveGrouped(ctx echo.Context) error {
+	grouping, err := parseGroupingKey(strings.TrimPrefix(ctx.Request().URL.EscapedPath(), "/metrics/"))
+	if err != nil {
+		return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "invalid grouping key: %v", err)
+	}
+	return c.receiveGrouped(ctx, grouping)
+}
+
+// parseGroupingKey parses the path of a pushgateway push after /metrics/,
+// e.g. job/node/instance/gw1, into its labels. Names ending in @base64 have
+// base64url encoded values.
+func parseGroupingKey(path string) ([]*dto.LabelPair, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments)%2 != 0 {
+		return nil, fmt.Errorf("%q is not a sequence of label names and values", path)
+	}
+	var labels []*dto.LabelPair
+	seen := make(map[string]struct{}, len(segments)/2)
+	for i := 0; i < len(segments); i += 2 {
+		name, err := url.PathUnescape(segments[i])
+		if err != nil {
+			return nil, err
+		}
+		value, err := url.PathUnescape(segments[i+1])
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(name, base64Suffix) {
+			name = strings.TrimSuffix(name, base64Suffix)
+			decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 value of label %q: %v", name, err)
+			}
+			value = string(decoded)
+		}
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			return nil, fmt.Errorf("invalid label name %q", name)
+		}
+		if _, ok := seen[name]; ok {
+			return nil, fmt.Errorf("duplicate label %q", name)
+		}
+		seen[name] = struct{}{}
+		if value == "" && name != model.JobLabel {
+			// an empty label is no label
+			continue
+		}
+		labels = append(labels, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+	}
+	if labels[0].GetName() != model.JobLabel {
+		return nil, fmt.Errorf("grouping key must start with the %s label", model.JobLabel)
+	}
+	if labels[0].GetValue() == "" {
+		return nil, fmt.Errorf("%s label must not be empty", model.JobLabel)
+	}
+	return labels, nil
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func groupingServer(hub *MetricHub) *echo.Echo {
+	e := echo.New()
+	e.POST("/metrics/job/*", hub.ReceiveGrouped)
+	e.PUT("/metrics/job/*", hub.ReceiveGrouped)
+	e.POST("/metrics/job@base64/*", hub.ReceiveGrouped)
+	return e
+}
+
+func TestReceiveGrouped(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	e := groupingServer(hub)
+
+	push := "# TYPE up gauge\nup{instance=\"pushed\"} 1 1000\n"
+	rec := serve(e, httptest.NewRequest(http.MethodPut, "/metrics/job/node/instance/gw1", strings.NewReader(push)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(e, httptest.NewRequest(http.MethodPost, "/metrics/job@base64/YS9i/path@base64/=", strings.NewReader("# TYPE down gauge\ndown 1 1000\n")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	exposition := scrape(t, hub)
+	assert.Contains(t, exposition, `up{instance="gw1",job="node"} 1 1000`)
+	assert.Contains(t, exposition, `down{job="a/b"} 1 1000`)
+}
+
+func TestReceiveGroupedInvalid(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	e := groupingServer(hub)
+
+	for _, path := range []string{
+		"/metrics/job/node/instance",
+		"/metrics/job//instance/gw1",
+		"/metrics/job/node/__name__/x",
+		"/metrics/job/node/in-stance/x",
+		"/metrics/job/node/job/other",
+		"/metrics/job@base64/!!",
+	} {
+		rec := serve(e, httptest.NewRequest(http.MethodPost, path, strings.NewReader("up 1\n")))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, path)
+		assert.Equal(t, ErrorCodeInvalidRequest, decodeError(t, rec).Code, path)
+	}
+	assert.Equal(t, 0, hub.stats.currentCountDatapoints)
+}
+
+func TestParseGroupingKey(t *testing.T) {
+	labels, err := parseGroupingKey("job/node/instance/gw%2F1/")
+	assert.NoError(t, err)
+	assert.Len(t, labels, 2)
+	assert.Equal(t, "node", labels[0].GetValue())
+	assert.Equal(t, "instance", labels[1].GetName())
+	assert.Equal(t, "gw/1", labels[1].GetValue())
+
+	_, err = parseGroupingKey("instance/gw1")
+	assert.Error(t, err)
+}
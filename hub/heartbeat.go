@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	heartbeatFamilyName = "edgehub_source_last_push_timestamp_seconds"
+	heartbeatSourceName = "source"
+)
+
+// WithSourceHeartbeats makes every scrape include an
+// edgehub_source_last_push_timestamp_seconds{source="..."} series for each
+// distinct value of sourceLabel seen in pushes, set to the time that source
+// last pushed. This lets central alerting detect silent devices without the
+// devices pushing a heartbeat metric of their own.
+func WithSourceHeartbeats(sourceLabel string) Option {
+	return func(hub *MetricHub) {
+		hub.heartbeats = &sourceHeartbeats{
+			label:    sourceLabel,
+			lastPush: make(map[string]time.Time),
+		}
+	}
+}
+
+// sourceHeartbeats tracks the last push time per source. Sources are kept
+// across scrapes so a silent source keeps reporting its old timestamp.
+type sourceHeartbeats struct {
+	sync.Mutex
+	label    string
+	lastPush map[string]time.Time
+}
+
+// record marks every source with a metric in family as having pushed now.
+// Pushes are recorded even if the hub later rejects them, since the source is
+// still alive.
+func (h *sourceHeartbeats) record(family *dto.MetricFamily, now time.Time) {
+	h.Lock()
+	defer h.Unlock()
+	for _, metric := range family.Metric {
+		for _, label := range metric.Label {
+			if label.GetName() == h.label {
+				h.lastPush[label.GetValue()] = now
+				break
+			}
+		}
+	}
+}
+
+// forget stops reporting heartbeats for sources
+func (h *sourceHeartbeats) forget(sources []string) {
+	h.Lock()
+	defer h.Unlock()
+	for _, source := range sources {
+		delete(h.lastPush, source)
+	}
+}
+
+// family returns the heartbeat family to include in a scrape at now
+func (h *sourceHeartbeats) family(now time.Time) *dto.MetricFamily {
+	h.Lock()
+	defer h.Unlock()
+
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	metrics := make([]*dto.Metric, 0, len(h.lastPush))
+	for source, lastPush := range h.lastPush {
+		metrics = append(metrics, &dto.Metric{
+			Label:       []*dto.LabelPair{{Name: proto.String(heartbeatSourceName), Value: proto.String(source)}},
+			Gauge:       &dto.Gauge{Value: proto.Float64(float64(lastPush.UnixNano()) / float64(time.Second))},
+			TimestampMs: proto.Int64(nowMs),
+		})
+	}
+	return &dto.MetricFamily{
+		Name:   proto.String(heartbeatFamilyName),
+		Help:   proto.String("Time of the last push from each source"),
+		Type:   dto.MetricType_GAUGE.Enum(),
+		Metric: metrics,
+	}
+}
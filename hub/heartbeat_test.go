@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceHeartbeats(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithSourceHeartbeats("host"))
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+
+	heartbeats := scrapedHeartbeats(t, hub)
+	assert.Equal(t, 2, len(heartbeats))
+	for _, metric := range heartbeats {
+		assert.Equal(t, "source", metric.GetLabel()[0].GetName())
+		assert.InDelta(t, float64(time.Now().Unix()), metric.GetGauge().GetValue(), 5)
+	}
+
+	// sources keep being reported after they stop pushing
+	hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 1, []*dto.LabelPair{}, 1)})
+	assert.Equal(t, 2, len(scrapedHeartbeats(t, hub)))
+}
+
+func TestNoSourceHeartbeatsWithoutPushes(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithSourceHeartbeats("host"))
+	assert.Equal(t, "", scrape(t, hub))
+}
+
+func scrapedHeartbeats(t *testing.T, hub *MetricHub) []*dto.Metric {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(scrape(t, hub)))
+	assert.NoError(t, err)
+	heartbeats, ok := families[heartbeatFamilyName]
+	assert.True(t, ok)
+	return heartbeats.GetMetric()
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+var (
+	historySeries        = prometheus.NewGauge(prometheus.GaugeOpts{Name: "history_series", Help: "Number of series in the downsampled history"})
+	historySeriesDropped = prometheus.NewCounter(prometheus.CounterOpts{Name: "history_series_dropped_total", Help: "Number of new series not kept in the downsampled history because it was full"})
+)
+
+func init() {
+	prometheus.MustRegister(historySeries, historySeriesDropped)
+}
+
+// WithHistory keeps a downsampled copy of every counter, gauge and untyped
+// series stored in the hub, with one datapoint (the newest) per resolution
+// for retention, in addition to the consume-once queues. It is served by
+// GET /api/v1/history, so sites get a lightweight local history without
+// running a TSDB. At most maxSeries series are kept; values <= 0 mean no
+// limit.
+func WithHistory(resolution, retention time.Duration, maxSeries int) Option {
+	return func(hub *MetricHub) {
+		if resolution <= 0 || retention < resolution {
+			hub.history = nil
+			return
+		}
+		hub.history = &history{
+			resolutionMs: int64(resolution / time.Millisecond),
+			slots:        int(retention / resolution),
+			maxSeries:    maxSeries,
+			families:     make(map[string]*historyFamily),
+		}
+	}
+}
+
+// history is a fixed-size ring of downsampled datapoints per series
+type history struct {
+	sync.Mutex
+	resolutionMs int64
+	slots        int
+	maxSeries    int
+	numSeries    int
+	families     map[string]*historyFamily
+	lastPrune    time.Time
+}
+
+type historyFamily struct {
+	help   string
+	typ    dto.MetricType
+	series map[string]*historyRing
+}
+
+type historyRing struct {
+	labels []*dto.LabelPair
+	// points is indexed by bucket modulo its length
+	points []historyPoint
+}
+
+type historyPoint struct {
+	// bucket is the timestamp divided by the resolution, 0 if unused
+	bucket      int64
+	timestampMs int64
+	value       float64
+}
+
+// record adds the datapoints of family to the history. Datapoints without a
+// timestamp are recorded at now.
+func (h *history) record(family *dto.MetricFamily, now time.Time) {
+	typ := family.GetType()
+	if typ != dto.MetricType_COUNTER && typ != dto.MetricType_GAUGE && typ != dto.MetricType_UNTYPED {
+		return
+	}
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+
+	h.Lock()
+	defer h.Unlock()
+	fam, ok := h.families[family.GetName()]
+	if !ok {
+		fam = &historyFamily{help: family.GetHelp(), typ: typ, series: make(map[string]*historyRing)}
+		h.families[family.GetName()] = fam
+	}
+	for _, metric := range family.Metric {
+		s := newSample(metric)
+		if s.kind != sampleCounter && s.kind != sampleGauge && s.kind != sampleUntyped {
+			continue
+		}
+		if !s.hasTimestamp {
+			s.timestampMs = nowMs
+		}
+		name := makeLabeledName(metric, family.GetName())
+		ring, ok := fam.series[name]
+		if !ok {
+			if h.maxSeries > 0 && h.numSeries >= h.maxSeries && now.Sub(h.lastPrune) >= time.Duration(h.resolutionMs)*time.Millisecond {
+				h.prune(h.oldestBucket(now))
+				h.lastPrune = now
+			}
+			if h.maxSeries > 0 && h.numSeries >= h.maxSeries {
+				historySeriesDropped.Inc()
+				continue
+			}
+			ring = &historyRing{labels: sortedLabels(metric.Label), points: make([]historyPoint, h.slots)}
+			fam.series[name] = ring
+			h.numSeries++
+		}
+		bucket := h.bucket(s.timestampMs)
+		point := &ring.points[bucket%int64(h.slots)]
+		// keep the newest datapoint of the bucket, so requeued datapoints
+		// don't replace newer ones
+		if point.bucket != bucket || s.timestampMs >= point.timestampMs {
+			*point = historyPoint{bucket: bucket, timestampMs: s.timestampMs, value: s.value}
+		}
+	}
+	historySeries.Set(float64(h.numSeries))
+}
+
+// bucket returns the bucket of timestampMs. Buckets start at 1 so unused
+// points can be told apart.
+func (h *history) bucket(timestampMs int64) int64 {
+	return timestampMs/h.resolutionMs + 1
+}
+
+// oldestBucket returns the oldest bucket within the retention of now
+func (h *history) oldestBucket(now time.Time) int64 {
+	return h.bucket(now.UnixNano()/int64(time.Millisecond)) - int64(h.slots) + 1
+}
+
+// prune forgets series without datapoints from oldestBucket on. Must be called
+// with the history lock held.
+func (h *history) prune(oldestBucket int64) {
+	for familyName, fam := range h.families {
+		for seriesName, ring := range fam.series {
+			if !ring.hasPointsSince(oldestBucket) {
+				delete(fam.series, seriesName)
+				h.numSeries--
+			}
+		}
+		if len(fam.series) == 0 {
+			delete(h.families, familyName)
+		}
+	}
+	historySeries.Set(float64(h.numSeries))
+}
+
+// export returns the datapoints of families matching name, or every family
+// if name is empty, that are within the retention of now
+func (h *history) export(name string, now time.Time) []*dto.MetricFamily {
+	oldestBucket := h.oldestBucket(now)
+
+	h.Lock()
+	defer h.Unlock()
+	h.prune(oldestBucket)
+	var families []*dto.MetricFamily
+	for familyName, fam := range h.families {
+		if name != "" && familyName != name {
+			continue
+		}
+		seriesNames := make([]string, 0, len(fam.series))
+		for seriesName := range fam.series {
+			seriesNames = append(seriesNames, seriesName)
+		}
+		sort.Strings(seriesNames)
+
+		family := &dto.MetricFamily{Name: proto.String(familyName), Type: fam.typ.Enum()}
+		if fam.help != "" {
+			family.Help = proto.String(fam.help)
+		}
+		for _, seriesName := range seriesNames {
+			ring := fam.series[seriesName]
+			for _, point := range ring.within(oldestBucket) {
+				family.Metric = append(family.Metric, point.metric(ring.labels, fam.typ))
+			}
+		}
+		families = append(families, family)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].GetName() < families[j].GetName()
+	})
+	return families
+}
+
+func (r *historyRing) hasPointsSince(oldestBucket int64) bool {
+	for _, point := range r.points {
+		if point.bucket != 0 && point.bucket >= oldestBucket {
+			return true
+		}
+	}
+	return false
+}
+
+// within returns the points of buckets from oldestBucket on, oldest first
+func (r *historyRing) within(oldestBucket int64) []historyPoint {
+	points := make([]historyPoint, 0, len(r.points))
+	for _, point := range r.points {
+		if point.bucket != 0 && point.bucket >= oldestBucket {
+			points = append(points, point)
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].bucket < points[j].bucket
+	})
+	return points
+}
+
+func (p historyPoint) metric(labels []*dto.LabelPair, typ dto.MetricType) *dto.Metric {
+	kind := sampleUntyped
+	switch typ {
+	case dto.MetricType_COUNTER:
+		kind = sampleCounter
+	case dto.MetricType_GAUGE:
+		kind = sampleGauge
+	}
+	return sample{timestampMs: p.timestampMs, hasTimestamp: true, value: p.value, kind: kind}.metric(labels)
+}
+
+// History is a handler function returning the downsampled history of the
+// hub in text exposition format, without consuming any datapoints. The name
+// parameter selects a single family.
+func (c *MetricHub) History(ctx echo.Context) error {
+	if c.history == nil {
+		return respondError(ctx, http.StatusNotFound, ErrorCodeNotFound, nil, "history is not enabled on this hub")
+	}
+	var buf bytes.Buffer
+	for _, family := range c.history.export(ctx.QueryParam("name"), c.clock.Now()) {
+		if _, err := expfmt.MetricFamilyToText(&buf, family); err != nil {
+			return respondError(ctx, http.StatusInternalServerError, ErrorCodeInternal, nil, "%v", err)
+		}
+	}
+	return ctx.Blob(http.StatusOK, string(expfmt.FmtText), buf.Bytes())
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/labstack/echo"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func gaugeAt(value float64, timestampMs int64) *dto.Metric {
+	return &dto.Metric{
+		Label:       gatewayLabels("gw1"),
+		Gauge:       &dto.Gauge{Value: proto.Float64(value)},
+		TimestampMs: proto.Int64(timestampMs),
+	}
+}
+
+func gaugeFamily(name string, metrics ...*dto.Metric) *dto.MetricFamily {
+	return &dto.MetricFamily{Name: proto.String(name), Type: dto.MetricType_GAUGE.Enum(), Metric: metrics}
+}
+
+func TestHistoryDownsamples(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithHistory(time.Minute, 3*time.Minute, 0))
+	now := time.Unix(10000*60, 0)
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	minute := int64(60000)
+
+	hub.history.record(gaugeFamily("temp",
+		gaugeAt(1, nowMs-5*minute),
+		gaugeAt(2, nowMs-2*minute),
+		gaugeAt(3, nowMs-2*minute+10),
+		gaugeAt(4, nowMs-minute),
+		gaugeAt(5, nowMs),
+	), now)
+	// an older datapoint of a bucket doesn't replace the newest
+	hub.history.record(gaugeFamily("temp", gaugeAt(6, nowMs-2*minute+5)), now)
+
+	families := hub.history.export("", now)
+	assert.Equal(t, 1, len(families))
+	var values []float64
+	for _, metric := range families[0].Metric {
+		values = append(values, metric.GetGauge().GetValue())
+	}
+	assert.Equal(t, []float64{3, 4, 5}, values)
+
+	// datapoints age out of the retention, and then their series
+	assert.Equal(t, 1, len(hub.history.export("", now.Add(2*time.Minute))[0].Metric))
+	assert.Empty(t, hub.history.export("", now.Add(10*time.Minute)))
+	assert.Equal(t, 0, hub.history.numSeries)
+}
+
+func TestHistoryMaxSeries(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithHistory(time.Minute, time.Hour, 1))
+	now := time.Now()
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	hub.history.record(gaugeFamily("a", gaugeAt(1, nowMs)), now)
+	hub.history.record(gaugeFamily("b", gaugeAt(1, nowMs)), now)
+	families := hub.history.export("", now)
+	assert.Equal(t, 1, len(families))
+	assert.Equal(t, "a", families[0].GetName())
+}
+
+func TestHistoryEndpoint(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithHistory(time.Minute, time.Hour, 0))
+	nowMs := time.Now().UnixNano() / int64(time.Millisecond)
+	hub.ReceiveGRPC([]*dto.MetricFamily{gaugeFamily("temp", gaugeAt(21.5, nowMs))})
+	_, err := receiveString(hub, "# TYPE other gauge\nother 1\n")
+	assert.NoError(t, err)
+	// scraping consumes the queues but not the history
+	scrape(t, hub)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/history?name=temp", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.History(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "# TYPE temp gauge\ntemp{gatewayID=\"gw1\"} 21.5 "+formatMs(nowMs)+"\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/history", nil)
+	rec = httptest.NewRecorder()
+	assert.NoError(t, hub.History(echo.New().NewContext(req, rec)))
+	assert.Contains(t, rec.Body.String(), "# TYPE other gauge\nother 1 ")
+}
+
+func TestHistoryEndpointDisabled(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/history", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.History(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func formatMs(ms int64) string {
+	return strconv.FormatInt(ms, 10)
+}
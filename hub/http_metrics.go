@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	httpLabels = []string{"handler", "code"}
+	// 100B to 1GB, the default gRPC and import message size limit
+	httpSizeBuckets = prometheus.ExponentialBuckets(100, 10, 8)
+
+	httpRequests          = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "http_requests_total", Help: "Number of HTTP requests handled, by handler and status code"}, httpLabels)
+	httpRequestDuration   = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "http_request_duration_seconds", Help: "Time to handle HTTP requests", Buckets: prometheus.DefBuckets}, httpLabels)
+	httpRequestSizeBytes  = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "http_request_size_bytes", Help: "Size of HTTP request bodies read by handlers", Buckets: httpSizeBuckets}, httpLabels)
+	httpResponseSizeBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "http_response_size_bytes", Help: "Size of HTTP response bodies", Buckets: httpSizeBuckets}, httpLabels)
+)
+
+func init() {
+	prometheus.MustRegister(httpRequests, httpRequestDuration, httpRequestSizeBytes, httpResponseSizeBytes)
+}
+
+// HTTPMetricsMiddleware returns echo middleware that records request counts,
+// latency and request and response sizes of every route as internal metrics.
+// handler is the route path, and "unknown" for requests to paths without a
+// route, so they can't create new series.
+func HTTPMetricsMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			t0 := time.Now()
+			req := ctx.Request()
+			body := &countingReader{ReadCloser: req.Body}
+			req.Body = body
+
+			// handle the error here, so the status and size it results in
+			// are written before they are recorded
+			err := next(ctx)
+			if err != nil {
+				ctx.Error(err)
+			}
+
+			labels := []string{routeLabel(ctx, err), strconv.Itoa(ctx.Response().Status)}
+			httpRequests.WithLabelValues(labels...).Inc()
+			httpRequestDuration.WithLabelValues(labels...).Observe(time.Since(t0).Seconds())
+			httpRequestSizeBytes.WithLabelValues(labels...).Observe(float64(body.n))
+			httpResponseSizeBytes.WithLabelValues(labels...).Observe(float64(ctx.Response().Size))
+			return nil
+		}
+	}
+}
+
+// routeLabel is the handler label of a handled request
+func routeLabel(ctx echo.Context, err error) string {
+	handler := ctx.Path()
+	if err == echo.ErrNotFound || handler == "" {
+		// the router leaves the request path for unknown routes
+		return "unknown"
+	}
+	return handler
+}
+
+// countingReader counts the bytes read from a request body, which unlike
+// Content-Length is also known for chunked pushes
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
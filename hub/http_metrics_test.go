@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPMetricsMiddleware(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	e := echo.New()
+	e.Use(HTTPMetricsMiddleware())
+	e.POST("/metrics", hub.Receive)
+	e.GET("/api/v1/history", hub.History)
+
+	pushed := httpRequests.WithLabelValues("/metrics", "200")
+	rejected := httpRequests.WithLabelValues("/metrics", "400")
+	notFound := httpRequests.WithLabelValues("/api/v1/history", "404")
+	pushedBefore, rejectedBefore, notFoundBefore := testutil.ToFloat64(pushed), testutil.ToFloat64(rejected), testutil.ToFloat64(notFound)
+
+	body := "# TYPE up gauge\nup 1\n"
+	serve(e, httptest.NewRequest(http.MethodPost, "/metrics", bytes.NewBufferString(body)))
+	serve(e, httptest.NewRequest(http.MethodPost, "/metrics", bytes.NewBufferString("up{")))
+	// history is not enabled
+	serve(e, httptest.NewRequest(http.MethodGet, "/api/v1/history?name=up", nil))
+
+	assert.Equal(t, pushedBefore+1, testutil.ToFloat64(pushed))
+	assert.Equal(t, rejectedBefore+1, testutil.ToFloat64(rejected))
+	assert.Equal(t, notFoundBefore+1, testutil.ToFloat64(notFound))
+}
+
+func TestHTTPMetricsMiddlewareUnknownPath(t *testing.T) {
+	e := echo.New()
+	e.Use(HTTPMetricsMiddleware())
+
+	before := testutil.ToFloat64(httpRequests.WithLabelValues("unknown", "404"))
+	rec := serve(e, httptest.NewRequest(http.MethodGet, "/no/such/path", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(httpRequests.WithLabelValues("unknown", "404")))
+}
+
+func TestHTTPMetricsMiddlewareSizes(t *testing.T) {
+	e := echo.New()
+	e.Use(HTTPMetricsMiddleware())
+	e.POST("/sink", func(ctx echo.Context) error {
+		// only part of the body is read
+		ctx.Request().Body.Read(make([]byte, 4))
+		return ctx.String(http.StatusAccepted, "accepted")
+	})
+
+	requestSize := httpRequestSizeBytes.WithLabelValues("/sink", "202").(prometheus.Histogram)
+	responseSize := httpResponseSizeBytes.WithLabelValues("/sink", "202").(prometheus.Histogram)
+	rec := serve(e, httptest.NewRequest(http.MethodPost, "/sink", bytes.NewBufferString("0123456789")))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, 4.0, histogramSum(t, requestSize))
+	assert.Equal(t, 8.0, histogramSum(t, responseSize))
+}
+
+func histogramSum(t *testing.T, histogram prometheus.Histogram) float64 {
+	metric := &dto.Metric{}
+	assert.NoError(t, histogram.Write(metric))
+	return metric.GetHistogram().GetSampleSum()
+}
+
+func serve(e *echo.Echo, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
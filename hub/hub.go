@@ -9,16 +9,22 @@ package hub
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"github.com/golang/glog"
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/golang/protobuf/proto"
 	"github.com/labstack/echo"
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
-	"log"
+	"io"
+	"io/ioutil"
+	"math"
 	"net/http"
 	"os"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -28,6 +34,10 @@ import (
 
 const (
 	scrapeWorkerPoolSize = 100
+
+	// ScrapeIDHeader is set on scrape responses to an ID unique to the scrape.
+	// Responses served from the scrape cache carry the ID of the cached scrape.
+	ScrapeIDHeader = "X-Edge-Hub-Scrape-Id"
 )
 
 var (
@@ -42,11 +52,13 @@ var (
 	grpcReceiveTime    = prometheus.NewGauge(prometheus.GaugeOpts{Name: "grpc_receive_time", Help: "Time to ingest last GRPC receive"})
 
 	scrapeLockWait = prometheus.NewGauge(prometheus.GaugeOpts{Name: "scrape_lock_wait", Help: "Time spent waiting on lock by last scrape request"})
+
+	synthesizedNameDropped = prometheus.NewCounter(prometheus.CounterOpts{Name: "synthesized_name_dropped_datapoints_total", Help: "Number of pushed datapoints dropped because their family has the name of a heartbeat, counter increase or rollup family synthesized by scrapes"})
 )
 
 func init() {
 	prometheus.MustRegister(hubLimit, hubSize, httpReceiveSizeFam, httpReceiveSizeDP, httpReceiveTime, parseTime,
-		grpcReceiveTime, grpcReceiveSizeDP, grpcReceiveSizeFam, scrapeLockWait)
+		grpcReceiveTime, grpcReceiveSizeDP, grpcReceiveSizeFam, scrapeLockWait, synthesizedNameDropped)
 }
 
 // MetricHub serves as a replacement for the prometheus pushgateway. Accepts
@@ -55,9 +67,117 @@ func init() {
 type MetricHub struct {
 	metricFamiliesByName map[string]*familyAndMetrics
 	limit                int
+	limitPolicy          LimitPolicy
+	timestampPolicy      TimestampPolicy
+	identityLabels       []string
+	seriesOrderLabel     string
 	stats                hubStats
 	sync.Mutex
 	scrapeTimeout int
+	scrapeMaxWait time.Duration
+	// stored is closed when datapoints are stored, waking up scrapes waiting
+	// for them. It is only made while a scrape waits.
+	stored chan struct{}
+
+	sanitizer  *nameSanitizer
+	normalizer *normalizer
+	relabeler  *relabeler
+	// metricFilter drops families and series by allow and deny lists
+	metricFilter *metricFilter
+	// rollups are synthesized from the families drained by every scrape
+	rollups []Rollup
+	// configLock guards relabeler, metricFilter and rollups, which a config
+	// reload replaces while pushes are prepared outside the hub lock. limit
+	// and metricTTL are guarded by the hub lock.
+	configLock sync.RWMutex
+	configFile string
+	// untypedConverter gives pushed untyped families a type
+	untypedConverter *untypedConverter
+	clockGuard       *clockGuard
+
+	clock     Clock
+	startTime time.Time
+	warmUp    time.Duration
+
+	// pushRates holds the rate budget of each rate limited transport
+	pushRates             map[string]*tokenBucket
+	httpMaxPushDatapoints int
+	httpMaxPushBytes      int
+
+	importLimit    int
+	importMaxBytes int64
+	importSem      chan struct{}
+
+	// generation counts drains of the hub. Every push is stored under the hub
+	// lock into the generation that is open at that time, so it is served
+	// whole by exactly one scrape.
+	generation  uint64
+	scrapeCache *scrapeCache
+	swaps       pendingSwaps
+	// scrapeRetention keeps the last scrapes for scrapes after an earlier
+	// scrape ID
+	scrapeRetention *scrapeRetention
+
+	heartbeats      *sourceHeartbeats
+	staleSources    *staleSources
+	staleSeries     *staleSeriesFilter
+	rejectedSamples *rejectedSamples
+
+	ingestQueue *ingestQueue
+	history     *history
+	lastValues  *lastValues
+	wal         *WAL
+	// queuedDatapoints are accepted but not yet stored by the ingest queue
+	queuedDatapoints int
+
+	diagnosticSem            chan struct{}
+	maxDiagnosticUtilization float64
+	throttleUtilization      float64
+	throttleMaxDelay         time.Duration
+	readyUtilization         float64
+	dropRuntimeMetrics       bool
+	slowFamilies             *regexp.Regexp
+	grpcCapabilities         *GRPCCapabilities
+	labelQuotas              *labelQuotas
+	batchIDs                 *batchIDs
+	tenants                  *tenantAllowlist
+	seriesChurn              *seriesChurn
+	// rewriteTenantLabel moves the tenant label to tenantTargetLabel, or
+	// drops it if that is empty
+	rewriteTenantLabel bool
+	tenantTargetLabel  string
+	// maxSeriesDatapoints caps the datapoints queued per series, 0 is no cap
+	maxSeriesDatapoints int
+	metricTTL           time.Duration
+	// counterIncrease matches the counter families whose increases are
+	// synthesized by every scrape
+	counterIncrease *regexp.Regexp
+	// replaying and shuttingDown are set, atomically, while the hub isn't
+	// ready for pushes
+	replaying    int32
+	shuttingDown int32
+
+	upstream     upstream
+	upstreamDown int32
+	// draining is set, atomically, while RunForwarding sends the buffer, whose
+	// datapoints are then neither in the hub nor unacked
+	draining int32
+	// periodicUpstream is set for upstreams that only get the contents of the
+	// hub every RunForwarding interval, instead of every push
+	periodicUpstream bool
+	// batchIDPrefix and batchSeq make up the IDs of batches sent upstream
+	batchIDPrefix string
+	batchSeq      uint64
+	// unacked are batches the upstream may have stored even though sending
+	// them failed. They are sent again under the same ID until it confirms.
+	unacked           []*forwardBatch
+	unackedDatapoints int
+	selfMonitor       *selfMonitor
+	accessLog         *AccessLog
+	quarantine        *quarantine
+
+	scrapeWorkers int
+	ingestSem     chan struct{}
 }
 
 // hubStats are for metrics that aren't worth exposing to prometheus, and also
@@ -76,217 +196,1081 @@ type hubStats struct {
 	lastGRPCReceiveSize        int
 	lastGRPCReceiveNumFamilies int
 
-	currentCountFamilies   int
-	currentCountSeries     int
-	currentCountDatapoints int
+	lastImportTime int64
+	lastImportSize int
+
+	currentCountFamilies           int
+	currentCountSeries             int
+	currentCountDatapoints         int
+	currentCountImportedDatapoints int
 }
 
-func NewMetricHub(limit int, scrapeTimeout int) *MetricHub {
+// Option configures optional MetricHub behavior
+type Option func(*MetricHub)
+
+func NewMetricHub(limit int, scrapeTimeout int, opts ...Option) *MetricHub {
 	if limit > 0 {
-		glog.Infof("Prometheus-Edge-Hub created with a limit of %d\n", limit)
+		logging.Info("Prometheus-Edge-Hub created", "limit", limit)
 	} else {
-		glog.Info("Prometheus-Edge-Hub created with no limit\n")
+		logging.Info("Prometheus-Edge-Hub created with no limit")
 	}
 
 	hubLimit.Set(float64(limit))
 
-	return &MetricHub{
+	hub := &MetricHub{
 		metricFamiliesByName: make(map[string]*familyAndMetrics),
 		limit:                limit,
 		scrapeTimeout:        scrapeTimeout,
+		clock:                systemClock{},
+		importSem:            make(chan struct{}, 1),
+		scrapeWorkers:        scrapeWorkerPoolSize,
+		scrapeMaxWait:        DefaultScrapeMaxWait,
+		quarantine:           &quarantine{limit: DefaultQuarantineLimit},
+	}
+	for _, opt := range opts {
+		opt(hub)
 	}
+	if upstream, ok := hub.upstream.(*remoteWriteUpstream); ok {
+		upstream.clock = hub.clock
+	}
+	if hub.wal != nil {
+		// not ready until ReplayWAL restored the log
+		hub.replaying = 1
+	}
+	hub.startTime = hub.clock.Now()
+	return hub
 }
 
 // Receive is a handler function to receive metric pushes
 func (c *MetricHub) Receive(ctx echo.Context) error {
-	t0 := time.Now()
-	var (
-		err    error
-		parser expfmt.TextParser
-	)
+	return c.receiveGrouped(ctx, nil)
+}
+
+// receiveGrouped receives a push, attaching the grouping labels to every
+// pushed metric
+func (c *MetricHub) receiveGrouped(ctx echo.Context, grouping []*dto.LabelPair) error {
+	entry := &AccessLogEntry{Kind: AccessKindPush, Transport: "http", Source: ctx.RealIP()}
+	defer c.logHTTPAccess(ctx, entry, time.Now())
+	receive := func(ctx echo.Context) error {
+		return c.receive(ctx, grouping, entry)
+	}
+	if tenant := ctx.Request().Header.Get(TenantHeader); tenant != "" && c.tenants != nil {
+		if err := c.tenants.admitHeader(tenant); err != nil {
+			recordRejectedPush("http", receiveErrorCode(err))
+			c.SampleRejectedPush("http", err.Error(), nil)
+			return respondReceiveError(ctx, err)
+		}
+	}
+	if id := ctx.Request().Header.Get(BatchIDHeader); id != "" && c.batchIDs != nil {
+		return c.receiveOnce(ctx, id, receive)
+	}
+	return receive(ctx)
+}
+
+func (c *MetricHub) receive(ctx echo.Context, grouping []*dto.LabelPair, entry *AccessLogEntry) error {
+	body, err := ioutil.ReadAll(ctx.Request().Body)
+	if err != nil {
+		return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "error reading metrics: %v", err)
+	}
+	body, err = decompressPush(ctx.Request().Header.Get(echo.HeaderContentEncoding), body)
+	if err != nil {
+		return respondError(ctx, decompressionErrorStatus(err), ErrorCodeInvalidRequest, nil, "%v", err)
+	}
+	defer c.acquireIngestWorker()()
+	ObservePushSize("http", len(body))
+	entry.Bytes = len(body)
 
-	parsedFamilies, err := parser.TextToMetricFamilies(ctx.Request().Body)
+	t0 := time.Now()
+	parsedFamilies, err := parseExposition(ctx.Request().Header.Get(echo.HeaderContentType), body)
 	if err != nil {
-		return ctx.String(http.StatusBadRequest, fmt.Sprintf("error parsing metrics: %v", err))
+		recordParseError(ctx.Request().Header.Get(echo.HeaderContentType))
+		recordRejectedPush("http", ErrorCodeParseError)
+		c.SampleRejectedPush("http", fmt.Sprintf("error parsing metrics: %v", err), nil)
+		return respondError(ctx, http.StatusBadRequest, ErrorCodeParseError, nil, "error parsing metrics: %v", err)
 	}
 	parseTime.Set(time.Since(t0).Seconds())
+	for _, label := range grouping {
+		for _, fam := range parsedFamilies {
+			addGroupingLabel(fam, label.GetName(), label.GetValue())
+		}
+	}
+	datapoints := countParsedDatapoints(parsedFamilies)
+	defer observePush("http", t0, datapoints)
+	entry.Families, entry.Datapoints = len(parsedFamilies), datapoints
+
+	if err := c.admitHTTPPush(datapoints, len(body)); err != nil {
+		_, code, _ := pushLimitErrorResponse(err)
+		recordRejectedPush("http", code)
+		c.SampleRejectedPush("http", err.Error(), nil)
+		return respondPushLimitError(ctx, err)
+	}
+	stored, dropped, err := c.receiveFamilies(parsedFamilies, int64(len(body)), ctx.Request().Header.Get(TenantHeader))
+	if err != nil {
+		recordRejectedPush("http", receiveErrorCode(err))
+		return respondReceiveError(ctx, err)
+	}
+	if dropped > 0 {
+		recordRejectedPush("http", ErrorCodeLimitExceeded)
+		entry.RejectedDatapoints = dropped
+		ctx.Response().Header().Set(DroppedDatapointsHeader, strconv.Itoa(dropped))
+		return ctx.String(http.StatusPartialContent, fmt.Sprintf("Accepted %d datapoints, dropped %d over hub limit of %d\n", stored, dropped, c.currentLimit()))
+	}
+	return ctx.NoContent(http.StatusOK)
+}
+
+// receiveErrorStatus returns the HTTP status for an error from receiveFamilies
+func receiveErrorStatus(err error) int {
+	switch err.(type) {
+	case *quotaError, *churnError:
+		return http.StatusTooManyRequests
+	case *tenantError:
+		return http.StatusForbidden
+	case *missingTimestampError, *missingIdentityError:
+		return http.StatusBadRequest
+	}
+	return http.StatusNotAcceptable
+}
+
+// receiveFamilies stores families parsed from an HTTP push of size bytes, all
+// or nothing apart from datapoints dropped by throttling label quotas and the
+// limit policy. It returns the number of datapoints stored and dropped by the
+// limit policy, or an error if they would overfill the hub limit or a
+// rejecting label quota, or aren't of an allowed tenant. tenant is the tenant
+// named by the push, if any.
+func (c *MetricHub) receiveFamilies(families map[string]*dto.MetricFamily, size int64, tenant string) (int, int, error) {
+	pushed := make([]*dto.MetricFamily, 0, len(families))
+	for _, fam := range families {
+		pushed = append(pushed, fam)
+	}
+	if c.untypedConverter != nil {
+		pushed = c.untypedConverter.convert(pushed)
+		families = make(map[string]*dto.MetricFamily, len(pushed))
+		for _, fam := range pushed {
+			families[fam.GetName()] = fam
+		}
+	}
+	for _, fam := range pushed {
+		c.prepareFamily(fam)
+	}
+	if c.tenants != nil {
+		if err := c.tenants.admit(pushed, tenant); err != nil {
+			c.SampleRejectedPush("http", err.Error(), pushed)
+			return 0, 0, err
+		}
+		if c.rewriteTenantLabel {
+			c.tenants.rewrite(pushed, c.tenantTargetLabel)
+		}
+	}
+	if c.timestampPolicy == TimestampReject {
+		if err := checkTimestamps(pushed); err != nil {
+			c.SampleRejectedPush("http", err.Error(), pushed)
+			return 0, 0, err
+		}
+	}
+	if len(c.identityLabels) > 0 {
+		if err := c.checkIdentity(pushed); err != nil {
+			c.SampleRejectedPush("http", err.Error(), pushed)
+			return 0, 0, err
+		}
+	}
 
 	newDatapoints := 0
-	for _, fam := range parsedFamilies {
+	for _, fam := range families {
 		newDatapoints += len(fam.Metric)
 	}
 
+	if c.upstream != nil && c.forwardPush(pushed) {
+		c.Lock()
+		c.stats.lastHTTPReceiveTime = c.clock.Now().Unix()
+		c.stats.lastHTTPReceiveSize = size
+		c.stats.lastHTTPReceiveNumFamilies = len(families)
+		c.Unlock()
+		return newDatapoints, 0, nil
+	}
+
+	c.Lock()
 	// Check if new datapoints will exceed the specified limit
+	limitDropped := 0
 	if c.limit > 0 {
-		if c.stats.currentCountDatapoints+newDatapoints > c.limit {
-			errString := fmt.Sprintf("Not accepting push of size %d. Would overfill hub limit of %d. Current hub size: %d\n", newDatapoints, c.limit, c.stats.currentCountDatapoints)
-			glog.Error(errString)
-			return ctx.String(http.StatusNotAcceptable, errString)
+		if c.liveDatapoints()+newDatapoints > c.limit {
+			dropped, err := c.makeRoom(pushed, newDatapoints)
+			if err != nil {
+				c.Unlock()
+				logging.Error("Rejected push over hub limit", "transport", "http", "err", err)
+				c.SampleRejectedPush("http", err.Error(), pushed)
+				return 0, 0, err
+			}
+			newDatapoints -= dropped
+			limitDropped = dropped
 		}
 	}
-	httpReceiveSizeDP.Set(float64(newDatapoints))
-	httpReceiveSizeFam.Set(float64(len(parsedFamilies)))
+	if c.labelQuotas != nil {
+		dropped, err := c.labelQuotas.admit(pushed)
+		if err != nil {
+			c.Unlock()
+			c.SampleRejectedPush("http", err.Error(), pushed)
+			return 0, 0, err
+		}
+		newDatapoints -= dropped
+	}
+	if c.seriesChurn != nil {
+		dropped, err := c.seriesChurn.admit(pushed)
+		if err != nil {
+			c.Unlock()
+			c.SampleRejectedPush("http", err.Error(), pushed)
+			return 0, 0, err
+		}
+		newDatapoints -= dropped
+	}
 
 	t2 := time.Now()
-	c.hubMetrics(parsedFamilies)
-	httpReceiveTime.Set(time.Since(t2).Seconds())
+	if c.ingestQueue != nil {
+		c.queuedDatapoints += newDatapoints
+	} else {
+		for _, fam := range families {
+			c.storeFamily(fam)
+		}
+		httpReceiveTime.Set(time.Since(t2).Seconds())
+	}
 
 	c.stats.lastHTTPReceiveTime = time.Now().Unix()
-	c.stats.lastHTTPReceiveSize = ctx.Request().ContentLength
-	c.stats.lastHTTPReceiveNumFamilies = len(parsedFamilies)
-	c.stats.currentCountDatapoints += newDatapoints
+	c.stats.lastHTTPReceiveSize = size
+	c.stats.lastHTTPReceiveNumFamilies = len(families)
 	hubSize.Set(float64(c.stats.currentCountDatapoints))
+	c.Unlock()
 
-	return ctx.NoContent(http.StatusOK)
+	if c.ingestQueue != nil {
+		c.ingestQueue.enqueue(pushed, newDatapoints)
+	} else if c.wal != nil {
+		c.wal.sync()
+	}
+
+	httpReceiveSizeDP.Set(float64(newDatapoints))
+	httpReceiveSizeFam.Set(float64(len(families)))
+
+	return newDatapoints, limitDropped, nil
+}
+
+// prepareFamily applies the configured ingest processing to a pushed family
+// before it is counted and stored
+func (c *MetricHub) prepareFamily(family *dto.MetricFamily) {
+	if c.dropRuntimeMetrics {
+		dropRuntimeFamily(family)
+	}
+	if c.sanitizer != nil {
+		c.sanitizer.sanitizeFamily(family)
+	}
+	relabeler, metricFilter := c.ingestRules()
+	if relabeler != nil {
+		relabeler.relabelFamily(family)
+	}
+	if metricFilter != nil {
+		metricFilter.filterFamily(family)
+	}
+	if c.normalizer != nil {
+		c.normalizer.normalizeFamily(family)
+	}
+	if len(family.Metric) > 0 && c.synthesized(family.GetName()) {
+		// scrapes would serve them mixed into the synthesized family, and
+		// lose them whenever they are requeued or retained
+		synthesizedNameDropped.Add(float64(len(family.Metric)))
+		family.Metric = nil
+	}
+	if c.timestampPolicy == TimestampReceive {
+		stampFamily(family, c.nowMs())
+	}
+	if c.clockGuard != nil {
+		c.clockGuard.checkFamily(family)
+	}
+	if c.heartbeats != nil {
+		c.heartbeats.record(family, c.clock.Now())
+	}
+	if c.staleSources != nil {
+		c.staleSources.record(family, c.clock.Now())
+	}
 }
 
 func (c *MetricHub) hubMetrics(families map[string]*dto.MetricFamily) {
 	c.Lock()
 	defer c.Unlock()
 	for _, fam := range families {
-		if families, ok := c.metricFamiliesByName[fam.GetName()]; ok {
-			families.addMetrics(fam.Metric)
-		} else {
-			c.metricFamiliesByName[fam.GetName()] = newFamilyAndMetrics(fam)
+		c.storeFamily(fam)
+	}
+}
+
+// storeFamily adds the datapoints of family to the hub and updates the count
+// stats. Families left without datapoints by prepareFamily are skipped. Must
+// be called with the hub lock held.
+func (c *MetricHub) storeFamily(family *dto.MetricFamily) {
+	c.storeDatapoints(family, false)
+}
+
+// storeDatapoints is storeFamily, with the datapoints marked as imported if
+// imported is set
+func (c *MetricHub) storeDatapoints(family *dto.MetricFamily, imported bool) {
+	if len(family.Metric) == 0 {
+		return
+	}
+	if c.wal != nil {
+		c.wal.append(family, imported)
+	}
+	if c.history != nil {
+		c.history.record(family, c.clock.Now())
+	}
+	if c.lastValues != nil {
+		c.lastValues.record(family)
+	}
+	existing, ok := c.metricFamiliesByName[family.GetName()]
+	if !ok {
+		existing = &familyAndMetrics{
+			family:        family,
+			metrics:       make(map[string]*series),
+			bufferedSince: c.clock.Now(),
 		}
+		c.metricFamiliesByName[family.GetName()] = existing
+		c.stats.currentCountFamilies++
+	}
+	newSeries, merged, evicted := existing.addMetrics(family.Metric, imported, c.maxSeriesDatapoints)
+	c.stats.currentCountDatapoints += len(family.Metric) - merged - evicted
+	c.stats.currentCountSeries += newSeries
+	c.notifyStored()
+	if evicted > 0 {
+		seriesCapEvictedDatapoints.WithLabelValues(family.GetName()).Add(float64(evicted))
+	}
+	if !ok {
+		// clear metrics in family because we are keeping them in the queues
+		family.Metric = nil
+	}
+}
+
+// RejectReason explains why datapoints in a push were not stored
+type RejectReason int
+
+const (
+	// RejectLimitExceeded means storing the datapoints would exceed the hub limit
+	RejectLimitExceeded RejectReason = iota + 1
+	// RejectQuotaExceeded means the datapoints were over the label quota of
+	// one of their label values
+	RejectQuotaExceeded
+	// RejectUnknownTenant means the push had datapoints without a tenant on
+	// the tenant allowlist
+	RejectUnknownTenant
+	// RejectSeriesChurn means the datapoints were of new series of a source or
+	// family over its series churn limit
+	RejectSeriesChurn
+	// RejectMissingTimestamp means the push had datapoints without a timestamp
+	// and the hub rejects those
+	RejectMissingTimestamp
+	// RejectMissingIdentity means the push had datapoints without one of the
+	// identity labels of the hub
+	RejectMissingIdentity
+)
+
+// ReceiveResult describes how much of a push was stored by the hub
+type ReceiveResult struct {
+	AcceptedDatapoints int
+	RejectedDatapoints int
+	Reasons            []RejectReason
+	// Utilization is the percent of the hub limit in use after the push, or
+	// 0 if the hub has no limit
+	Utilization float64
+}
+
+// ReceiveGRPC stores pushed families and reports how much of them was accepted
+func (c *MetricHub) ReceiveGRPC(families []*dto.MetricFamily) ReceiveResult {
+	result, _ := c.ReceiveGRPCContext(context.Background(), families)
+	return result
+}
+
+// ReceiveGRPCContext is ReceiveGRPC giving up on the push once ctx is done,
+// as long as it is not stored yet, so work isn't spent on pushes whose client
+// stopped waiting and will retry them. It then returns the error of ctx with
+// every datapoint rejected.
+func (c *MetricHub) ReceiveGRPCContext(ctx context.Context, families []*dto.MetricFamily) (ReceiveResult, error) {
+	t0 := time.Now()
+	datapoints := countPushedDatapoints(families)
+	result, err := c.receiveGRPC(ctx, families)
+	observePush("grpc", t0, datapoints)
+	for _, reason := range result.Reasons {
+		recordRejectedPush("grpc", reason.errorCode())
 	}
+	return result, err
 }
 
-func (c *MetricHub) ReceiveGRPC(families []*dto.MetricFamily) {
+// receiveGRPC is ReceiveGRPCContext without recording push metrics
+func (c *MetricHub) receiveGRPC(ctx context.Context, families []*dto.MetricFamily) (ReceiveResult, error) {
+	release, err := c.acquireIngestWorkerContext(ctx)
+	if err != nil {
+		return c.abortReceive(families, err)
+	}
+	defer release()
 	t0 := time.Now()
 
-	c.Lock()
-	defer c.Unlock()
+	if c.untypedConverter != nil {
+		families = c.untypedConverter.convert(families)
+	}
+	for _, fam := range families {
+		c.prepareFamily(fam)
+	}
 
 	newDatapoints := 0
 	for _, fam := range families {
 		newDatapoints += len(fam.Metric)
 	}
 
+	if c.tenants != nil {
+		if err := c.tenants.admit(families, ""); err != nil {
+			c.SampleRejectedPush("grpc", err.Error(), families)
+			c.Lock()
+			defer c.Unlock()
+			return ReceiveResult{
+				RejectedDatapoints: newDatapoints,
+				Reasons:            []RejectReason{RejectUnknownTenant},
+				Utilization:        c.utilization(),
+			}, nil
+		}
+		if c.rewriteTenantLabel {
+			c.tenants.rewrite(families, c.tenantTargetLabel)
+		}
+	}
+	if c.timestampPolicy == TimestampReject {
+		if err := checkTimestamps(families); err != nil {
+			c.SampleRejectedPush("grpc", err.Error(), families)
+			c.Lock()
+			defer c.Unlock()
+			return ReceiveResult{
+				RejectedDatapoints: newDatapoints,
+				Reasons:            []RejectReason{RejectMissingTimestamp},
+				Utilization:        c.utilization(),
+			}, nil
+		}
+	}
+	if len(c.identityLabels) > 0 {
+		if err := c.checkIdentity(families); err != nil {
+			c.SampleRejectedPush("grpc", err.Error(), families)
+			c.Lock()
+			defer c.Unlock()
+			return ReceiveResult{
+				RejectedDatapoints: newDatapoints,
+				Reasons:            []RejectReason{RejectMissingIdentity},
+				Utilization:        c.utilization(),
+			}, nil
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return c.abortReceive(families, err)
+	}
+	if c.upstream != nil && c.forwardPush(families) {
+		c.Lock()
+		defer c.Unlock()
+		c.stats.lastGRPCReceiveTime = c.clock.Now().Unix()
+		c.stats.lastGRPCReceiveNumFamilies = len(families)
+		c.stats.lastGRPCReceiveSize = binary.Size(families)
+		return ReceiveResult{
+			AcceptedDatapoints: newDatapoints,
+			Utilization:        c.utilization(),
+		}, nil
+	}
+
+	c.Lock()
+	if err := ctx.Err(); err != nil {
+		c.Unlock()
+		return c.abortReceive(families, err)
+	}
 	// Check if new datapoints will exceed the specified limit
+	var reasons []RejectReason
+	rejected := 0
 	if c.limit > 0 {
-		if c.stats.currentCountDatapoints+newDatapoints > c.limit {
-			errString := fmt.Sprintf("Not accepting push of size %d. Would overfill hub limit of %d. Current hub size: %d\n", newDatapoints, c.limit, c.stats.currentCountDatapoints)
-			glog.Error(errString)
-			return
+		if c.liveDatapoints()+newDatapoints > c.limit {
+			dropped, err := c.makeRoom(families, newDatapoints)
+			if err != nil {
+				result := ReceiveResult{
+					RejectedDatapoints: newDatapoints,
+					Reasons:            []RejectReason{RejectLimitExceeded},
+					Utilization:        c.utilization(),
+				}
+				c.Unlock()
+				logging.Error("Rejected push over hub limit", "transport", "grpc", "err", err)
+				c.SampleRejectedPush("grpc", err.Error(), families)
+				return result, nil
+			}
+			if dropped > 0 {
+				newDatapoints -= dropped
+				rejected = dropped
+				reasons = []RejectReason{RejectLimitExceeded}
+			}
+		}
+	}
+	if c.labelQuotas != nil {
+		dropped, err := c.labelQuotas.admit(families)
+		if err != nil {
+			result := ReceiveResult{
+				RejectedDatapoints: newDatapoints + rejected,
+				Reasons:            append(reasons, RejectQuotaExceeded),
+				Utilization:        c.utilization(),
+			}
+			c.Unlock()
+			c.SampleRejectedPush("grpc", err.Error(), families)
+			return result, nil
+		}
+		if dropped > 0 {
+			newDatapoints -= dropped
+			rejected += dropped
+			reasons = append(reasons, RejectQuotaExceeded)
+		}
+	}
+	if c.seriesChurn != nil {
+		dropped, err := c.seriesChurn.admit(families)
+		if err != nil {
+			result := ReceiveResult{
+				RejectedDatapoints: newDatapoints + rejected,
+				Reasons:            append(reasons, RejectSeriesChurn),
+				Utilization:        c.utilization(),
+			}
+			c.Unlock()
+			c.SampleRejectedPush("grpc", err.Error(), families)
+			return result, nil
+		}
+		if dropped > 0 {
+			newDatapoints -= dropped
+			rejected += dropped
+			reasons = append(reasons, RejectSeriesChurn)
 		}
 	}
 
-	for _, fam := range families {
-		if families, ok := c.metricFamiliesByName[fam.GetName()]; ok {
-			families.addMetrics(fam.Metric)
-		} else {
-			c.metricFamiliesByName[fam.GetName()] = newFamilyAndMetrics(fam)
+	if c.ingestQueue != nil {
+		c.queuedDatapoints += newDatapoints
+	} else {
+		for _, fam := range families {
+			c.storeFamily(fam)
 		}
 	}
 
+	c.stats.lastGRPCReceiveTime = time.Now().Unix()
+	c.stats.lastGRPCReceiveNumFamilies = len(families)
+	c.stats.lastGRPCReceiveSize = binary.Size(families)
+	hubSize.Set(float64(c.stats.currentCountDatapoints))
+	result := ReceiveResult{
+		AcceptedDatapoints: newDatapoints,
+		RejectedDatapoints: rejected,
+		Reasons:            reasons,
+		Utilization:        c.utilization(),
+	}
+	c.Unlock()
+
+	if c.ingestQueue != nil {
+		c.ingestQueue.enqueue(families, newDatapoints)
+	} else if c.wal != nil {
+		c.wal.sync()
+	}
+
 	grpcReceiveTime.Set(time.Since(t0).Seconds())
-	log.Printf("GRPC Time: %v\n", time.Since(t0))
-	log.Printf("GRPC Time(seconds): %f\n", time.Since(t0).Seconds())
+	logging.Debug("Received gRPC push", "datapoints", newDatapoints, "rejected", rejected, "duration_seconds", time.Since(t0).Seconds())
 	grpcReceiveSizeFam.Set(float64(len(families)))
 	grpcReceiveSizeDP.Set(float64(newDatapoints))
 
-	c.stats.lastGRPCReceiveTime = time.Now().Unix()
-	c.stats.lastGRPCReceiveNumFamilies = len(families)
-	c.stats.lastGRPCReceiveSize = binary.Size(families)
-	c.stats.currentCountDatapoints += newDatapoints
+	return result, nil
+}
 
+// liveDatapoints returns the number of datapoints in the hub, its ingest
+// queue or unacknowledged forwarded batches that were not imported. Only these
+// count against the hub limit.
+func (c *MetricHub) liveDatapoints() int {
+	return c.stats.currentCountDatapoints - c.stats.currentCountImportedDatapoints + c.queuedDatapoints + c.unackedDatapoints
+}
+
+// utilization returns the percent of the hub limit currently in use, or 0 if
+// the hub has no limit
+func (c *MetricHub) utilization() float64 {
+	if c.limit <= 0 {
+		return 0
+	}
+	return float64(c.stats.currentCountDatapoints+c.queuedDatapoints+c.unackedDatapoints) * 100 / float64(c.limit)
+}
+
+// WithWarmUp makes the hub refuse scrapes for the given period after it is
+// created, while still accepting pushes. This keeps the first scrape after a
+// restart from draining a nearly empty hub.
+func WithWarmUp(warmUp time.Duration) Option {
+	return func(hub *MetricHub) {
+		hub.warmUp = warmUp
+	}
+}
+
+// warmUpRemaining returns how long the hub will keep refusing scrapes, or 0 if
+// the warm-up period is over
+func (c *MetricHub) warmUpRemaining() time.Duration {
+	remaining := c.warmUp - c.clock.Now().Sub(c.startTime)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
 }
 
 // Scrape is a handler function for prometheus scrape requests. Formats the
 // metrics for scraping.
 func (c *MetricHub) Scrape(ctx echo.Context) error {
+	return c.scrape(ctx, scrapeClassAll)
+}
+
+func (c *MetricHub) scrape(ctx echo.Context, class ScrapeClass) error {
+	peek, err := parsePeek(ctx.QueryParam("peek"))
+	if err != nil {
+		return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "%v", err)
+	}
+	if peek {
+		return c.peek(ctx, class)
+	}
+	entry := &AccessLogEntry{Kind: AccessKindScrape, Transport: "http", Source: ctx.RealIP()}
+	defer c.logHTTPAccess(ctx, entry, time.Now())
+	if remaining := c.warmUpRemaining(); remaining > 0 {
+		ctx.Response().Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())+1))
+		return respondWarmingUp(ctx, remaining)
+	}
+
+	minAge, err := parseMinAge(ctx.QueryParam("min_age"))
+	if err != nil {
+		return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "%v", err)
+	}
+	after, consumer := ctx.QueryParam("after"), ctx.QueryParam("consumer")
+	if after != "" || consumer != "" {
+		if c.scrapeRetention == nil {
+			return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "scrapes after a scrape ID or by a consumer require scrape retention to be enabled")
+		}
+		if minAge > 0 || class != scrapeClassAll || ctx.QueryParam("format") == ScrapeFormatJSONL {
+			return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "after and consumer can't be combined with min_age, scrape classes or the %s format", ScrapeFormatJSONL)
+		}
+		if after != "" && consumer != "" {
+			return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "after can't be combined with consumer, whose cursor is the scrape after")
+		}
+		if consumer != "" {
+			if err := c.scrapeRetention.checkConsumer(consumer); err != nil {
+				return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "%v", err)
+			}
+		}
+	}
+	wait, minDatapoints, err := parseWait(ctx.QueryParam("wait"), ctx.QueryParam("min_datapoints"), c.scrapeMaxWait)
+	if err != nil {
+		return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "%v", err)
+	}
+	defer observeScrapeGC()()
+	exposition := expfmt.FmtText
+	switch format := ctx.QueryParam("format"); format {
+	case "":
+		// without a format parameter, OpenMetrics is served to clients
+		// accepting it
+		if expfmt.NegotiateIncludingOpenMetrics(ctx.Request().Header) == expfmt.FmtOpenMetrics {
+			exposition = expfmt.FmtOpenMetrics
+		}
+	case "text":
+	case ScrapeFormatOpenMetrics:
+		exposition = expfmt.FmtOpenMetrics
+	case ScrapeFormatJSONL:
+		c.waitForDatapoints(ctx.Request().Context(), minDatapoints, wait)
+		defer observeScrape(ScrapeFormatJSONL)()
+		// streamed, so not served from the scrape cache
+		return c.scrapeJSONL(ctx, minAge, class, entry)
+	default:
+		return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "unknown format %q: must be text, %s or %s", format, ScrapeFormatOpenMetrics, ScrapeFormatJSONL)
+	}
+	c.waitForDatapoints(ctx.Request().Context(), minDatapoints, wait)
+	if exposition == expfmt.FmtOpenMetrics {
+		defer observeScrape(ScrapeFormatOpenMetrics)()
+	} else {
+		defer observeScrape("text")()
+	}
+	scrapeExposition := func() (string, string) { return c.scrapeExposition(minAge, class, exposition, entry) }
+
+	var scrapeID, expositionString string
+	if after != "" || consumer != "" {
+		// not served from the scrape cache, which only has the last scrape
+		var gap bool
+		scrapeID, expositionString, gap = c.scrapeAfter(after, consumer, exposition, entry)
+		if gap {
+			ctx.Response().Header().Set(ScrapeGapHeader, "1")
+		}
+	} else if c.scrapeCache != nil {
+		scrapeID, expositionString = c.scrapeCache.get(fmt.Sprintf("%s/%v/%s", class, minAge, exposition), c.clock.Now(), scrapeExposition)
+	} else {
+		// nothing needs the exposition as a whole
+		return c.streamScrape(ctx, minAge, class, exposition, entry)
+	}
+
+	ctx.Response().Header().Set(ScrapeIDHeader, scrapeID)
+	if exposition == expfmt.FmtOpenMetrics {
+		return respondScrape(ctx, string(expfmt.FmtOpenMetrics), expositionString)
+	}
+	return respondScrape(ctx, echo.MIMETextPlainCharsetUTF8, expositionString)
+}
+
+// scrapeExposition drains datapoints of class older than minAge from the hub
+// and returns the scrape ID and the exposition of the drained metrics in
+// format, either the text format or OpenMetrics. The drained metrics are
+// accounted for in entry, if not nil.
+func (c *MetricHub) scrapeExposition(minAge time.Duration, class ScrapeClass, format expfmt.Format, entry *AccessLogEntry) (string, string) {
+	scrapeMetrics, scrapeID := c.drainSelected(minAge, class)
+	observeDrained(scrapeMetrics, entry)
+	toString := familyToString
+	if format == expfmt.FmtOpenMetrics {
+		toString = familyToOpenMetrics
+	}
+	expositionString, failed, ok := c.exposeMetricsWithTimeout(scrapeMetrics, c.scrapeWorkers, toString)
+	if ok && format == expfmt.FmtOpenMetrics {
+		expositionString += openMetricsEOF + "\n"
+	}
+	if !ok {
+		// nothing from this generation was served, so keep it for the next
+		// scrape rather than losing it
+		c.requeue(scrapeMetrics)
+	} else {
+		c.quarantineFailed(failed)
+		if c.scrapeRetention != nil && class == scrapeClassAll && minAge == 0 {
+			c.retainScrape(scrapeID, scrapeMetrics)
+		}
+	}
+	c.recordScrape(int64(len(expositionString)), len(scrapeMetrics))
+	return scrapeID, expositionString
+}
+
+// ErrWarmingUp is returned when scraping a hub that is still in its warm-up
+// period
+var ErrWarmingUp = errors.New("hub is warming up")
+
+// ScrapeFamilies removes all datapoints from the hub like Scrape, and returns
+// them as metric families sorted by name
+func (c *MetricHub) ScrapeFamilies() ([]*dto.MetricFamily, error) {
+	if c.warmUpRemaining() > 0 {
+		return nil, ErrWarmingUp
+	}
+	defer observeScrape("protobuf")()
+
+	scrapeMetrics, _ := c.drain()
+	observeDrained(scrapeMetrics, nil)
+	families := make([]*dto.MetricFamily, 0, len(scrapeMetrics))
+	size := 0
+	for _, fam := range scrapeMetrics {
+		pullFamily := c.popOrdered(fam)
+		families = append(families, pullFamily)
+		size += proto.Size(pullFamily)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].GetName() < families[j].GetName()
+	})
+	c.recordScrape(int64(size), len(families))
+	return families, nil
+}
+
+// drain seals the open generation of the hub for scraping, and returns its
+// contents with a new scrape ID. Pushes arriving after the swap are stored in
+// the next generation.
+func (c *MetricHub) drain() (map[string]*familyAndMetrics, string) {
+	return c.drainSelected(0, scrapeClassAll)
+}
+
+// drainSelected is drain, except that only families of class are drained, and
+// if minAge > 0, datapoints with timestamps within minAge of now stay in the
+// hub for a later scrape
+func (c *MetricHub) drainSelected(minAge time.Duration, class ScrapeClass) (map[string]*familyAndMetrics, string) {
+	now := c.clock.Now()
+	t0 := time.Now()
 	c.Lock()
-	scrapeMetrics := c.metricFamiliesByName
-	c.clearMetrics()
+	scrapeLockWait.Set(time.Since(t0).Seconds())
+	var scrapeMetrics map[string]*familyAndMetrics
+	if minAge > 0 || class != scrapeClassAll {
+		cutoffMs := int64(math.MaxInt64)
+		if minAge > 0 {
+			cutoffMs = now.Add(-minAge).UnixNano() / int64(time.Millisecond)
+		}
+		scrapeMetrics = c.split(cutoffMs, class)
+	} else {
+		scrapeMetrics = c.metricFamiliesByName
+		c.clearMetrics()
+	}
+	if c.labelQuotas != nil {
+		c.labelQuotas.reset()
+	}
+	c.generation++
+	scrapeID := fmt.Sprintf("%x-%d", c.startTime.UnixNano(), c.generation)
+	var walSegment int
+	var walRemaining []walRecord
+	if c.wal != nil {
+		walSegment, walRemaining = c.rotateWAL()
+	}
 	c.Unlock()
 
-	expositionString := c.exposeMetrics(scrapeMetrics, scrapeWorkerPoolSize)
+	if c.wal != nil {
+		if err := c.wal.checkpoint(walSegment, walRemaining); err != nil {
+			logging.Error("Error writing write-ahead log checkpoint", "err", err)
+		}
+	}
 
+	if c.clockGuard != nil {
+		c.clockGuard.advance(scrapeMetrics)
+	}
+	if c.staleSeries != nil {
+		c.filterStaleSeries(scrapeMetrics, now)
+	}
+	if c.heartbeats != nil && c.inScrapeClass(heartbeatFamilyName, class) {
+		heartbeats := c.heartbeats.family(now)
+		if len(heartbeats.Metric) > 0 {
+			if existing, ok := scrapeMetrics[heartbeats.GetName()]; ok {
+				existing.addMetrics(heartbeats.Metric, false, 0)
+			} else {
+				scrapeMetrics[heartbeats.GetName()] = newFamilyAndMetrics(heartbeats, now)
+			}
+		}
+	}
+	if c.counterIncrease != nil {
+		c.addCounterIncreases(scrapeMetrics, class, now)
+	}
+	c.addRollups(scrapeMetrics, class, now)
+	return scrapeMetrics, scrapeID
+}
+
+// synthesized returns whether the family name is synthesized by every drain,
+// i.e. heartbeats, counter increases and rollups
+func (c *MetricHub) synthesized(name string) bool {
+	return (c.heartbeats != nil && name == heartbeatFamilyName) || c.isCounterIncrease(name) || c.isRollup(name)
+}
+
+// requeue stores the datapoints of a drained generation that could not be
+// served into the open generation. Synthesized heartbeats, counter increases
+// and rollups are skipped since the next drain adds them again.
+func (c *MetricHub) requeue(drained map[string]*familyAndMetrics) {
+	c.Lock()
+	defer c.Unlock()
+	for name, fam := range drained {
+		if c.synthesized(name) {
+			continue
+		}
+		c.storeFamily(fam.popDatapoints())
+	}
+	hubSize.Set(float64(c.stats.currentCountDatapoints))
+}
+
+func (c *MetricHub) recordScrape(size int64, numFamilies int) {
+	c.Lock()
 	c.stats.lastScrapeTime = time.Now().Unix()
-	c.stats.lastScrapeSize = int64(len(expositionString))
-	c.stats.lastScrapeNumFamilies = len(scrapeMetrics)
-	c.stats.currentCountDatapoints = 0
-	hubSize.Set(0)
+	c.stats.lastScrapeSize = size
+	c.stats.lastScrapeNumFamilies = numFamilies
+	c.Unlock()
+}
+
+// Status is a summary of the current state of the hub
+type Status struct {
+	Datapoints int
+	// Utilization is the percent of the hub limit in use, or 0 if the hub has
+	// no limit
+	Utilization     float64
+	WarmUpRemaining time.Duration
+}
 
-	return ctx.String(http.StatusOK, expositionString)
+// Status returns a summary of the current state of the hub
+func (c *MetricHub) Status() Status {
+	c.Lock()
+	defer c.Unlock()
+	return Status{
+		Datapoints:      c.stats.currentCountDatapoints,
+		Utilization:     c.utilization(),
+		WarmUpRemaining: c.warmUpRemaining(),
+	}
 }
 
+// clearMetrics empties the hub and resets the count stats. Must be called with
+// the hub lock held.
 func (c *MetricHub) clearMetrics() {
 	c.metricFamiliesByName = make(map[string]*familyAndMetrics)
+	c.stats.currentCountFamilies = 0
+	c.stats.currentCountSeries = 0
+	c.stats.currentCountDatapoints = 0
+	c.stats.currentCountImportedDatapoints = 0
+	hubSize.Set(0)
 }
 
 func (c *MetricHub) exposeMetrics(metricFamiliesByName map[string]*familyAndMetrics, workers int) string {
-	fams := make(chan *familyAndMetrics, workers)
-	results := make(chan string, workers)
-	respCh := make(chan string, 1)
+	resp, _, _ := c.exposeMetricsWithTimeout(metricFamiliesByName, workers, familyToString)
+	return resp
+}
 
-	waitGroup := &sync.WaitGroup{}
+// exposeDrained is exposeMetrics for families drained from the hub, moving
+// the ones that fail to serialize into the quarantine
+func (c *MetricHub) exposeDrained(metricFamiliesByName map[string]*familyAndMetrics, workers int) string {
+	resp, failed, _ := c.exposeMetricsWithTimeout(metricFamiliesByName, workers, familyToString)
+	c.quarantineFailed(failed)
+	return resp
+}
 
-	for i := 0; i < workers; i++ {
-		waitGroup.Add(1)
-		go processFamilyWorker(fams, results, waitGroup)
+// exposeMetricsWithTimeout builds the exposition of metricFamiliesByName with
+// toString, returning false if it was not built within the scrape timeout.
+// Families that fail to serialize are left out and returned, so that callers
+// draining them can quarantine them.
+func (c *MetricHub) exposeMetricsWithTimeout(metricFamiliesByName map[string]*familyAndMetrics, workers int, toString func(*dto.MetricFamily) (string, error)) (string, []failedFamily, bool) {
+	var resp strings.Builder
+	unwritten, failed, _ := c.writeMetrics(&resp, metricFamiliesByName, workers, toString, c.scrapeDeadline())
+	if len(unwritten) > 0 {
+		return "", failed, false
 	}
+	return resp.String(), failed, true
+}
 
-	go processFamilyStringsWorker(results, respCh)
+// scrapeDeadline returns when a scrape starting now times out
+func (c *MetricHub) scrapeDeadline() time.Time {
+	return time.Now().Add(time.Duration(c.scrapeTimeout) * time.Second)
+}
 
-	for _, fam := range metricFamiliesByName {
-		fams <- fam
-	}
+// serializedFamily is the exposition of a family
+type serializedFamily struct {
+	family *familyAndMetrics
+	text   string
+}
 
-	close(fams)
-	waitGroup.Wait()
-	close(results)
+// writeMetrics writes the exposition of metricFamiliesByName with toString to
+// w as families are serialized by workers, so it is never held in memory as a
+// whole. Families are no longer serialized once deadline has passed or writing
+// to w failed, and are returned as unwritten, keyed by name, so that callers
+// draining them can requeue them. Families that fail to serialize are left out
+// and returned as failed.
+func (c *MetricHub) writeMetrics(w io.Writer, metricFamiliesByName map[string]*familyAndMetrics, workers int, toString func(*dto.MetricFamily) (string, error), deadline time.Time) (map[string]*familyAndMetrics, []failedFamily, error) {
+	var failed []failedFamily
+	var failedLock sync.Mutex
+	fail := func(family *dto.MetricFamily, err error) {
+		logging.Error("Family failed to convert to string", "family", family.GetName(), "err", err)
+		failedLock.Lock()
+		failed = append(failed, failedFamily{family: family, err: err})
+		failedLock.Unlock()
+	}
+	unwritten := make(map[string]*familyAndMetrics)
+	var err error
+
+	if workers == 1 {
+		// serialized in the calling goroutine, for devices too small to
+		// spare the goroutines and channels of a worker pool
+		for name, fam := range metricFamiliesByName {
+			if err != nil || time.Now().After(deadline) {
+				unwritten[name] = fam
+				continue
+			}
+			pullFamily := c.popOrdered(fam)
+			familyStr, serializeErr := toString(pullFamily)
+			if serializeErr != nil {
+				fail(pullFamily, serializeErr)
+				continue
+			}
+			if _, err = io.WriteString(w, familyStr); err != nil {
+				unwritten[name] = fam
+			}
+		}
+	} else {
+		fams := make(chan *familyAndMetrics, workers)
+		results := make(chan serializedFamily, workers)
+		stop := make(chan struct{})
+		// unfed are the families the feeder stopped at, and discarded the
+		// results read after writing failed
+		unfed := make(map[string]*familyAndMetrics)
+
+		waitGroup := &sync.WaitGroup{}
+		for i := 0; i < workers; i++ {
+			waitGroup.Add(1)
+			go processFamilyWorker(fams, results, waitGroup, c.popOrdered, toString, fail)
+		}
+		go func() {
+			for name, fam := range metricFamiliesByName {
+				if time.Now().After(deadline) {
+					unfed[name] = fam
+					continue
+				}
+				select {
+				case fams <- fam:
+				case <-stop:
+					unfed[name] = fam
+				}
+			}
+			close(fams)
+			waitGroup.Wait()
+			close(results)
+		}()
+
+		for result := range results {
+			if err == nil {
+				if _, err = io.WriteString(w, result.text); err != nil {
+					close(stop)
+				}
+			}
+			if err != nil {
+				unwritten[result.family.family.GetName()] = result.family
+			}
+		}
+		// results is closed once the feeder is done with unfed
+		for name, fam := range unfed {
+			unwritten[name] = fam
+		}
+	}
 
-	select {
-	case resp := <-respCh:
-		return resp
-	case <-time.After(time.Duration(c.scrapeTimeout) * time.Second):
-		log.Print("Timeout reached for building metrics string")
-		return ""
+	if err == nil && len(unwritten) > 0 {
+		logging.Error("Timeout reached for building metrics string", "timeout_seconds", c.scrapeTimeout, "unwritten_families", len(unwritten))
 	}
+	return unwritten, failed, err
 }
 
-func processFamilyWorker(fams <-chan *familyAndMetrics, results chan<- string, waitGroup *sync.WaitGroup) {
+func processFamilyWorker(fams <-chan *familyAndMetrics, results chan<- serializedFamily, waitGroup *sync.WaitGroup, pop func(*familyAndMetrics) *dto.MetricFamily, toString func(*dto.MetricFamily) (string, error), fail func(*dto.MetricFamily, error)) {
 	defer waitGroup.Done()
 	for fam := range fams {
-		pullFamily := fam.popDatapoints()
-		familyStr, err := familyToString(pullFamily)
+		pullFamily := pop(fam)
+		familyStr, err := toString(pullFamily)
 		if err != nil {
-			log.Printf("metric %s dropped. error converting metric to string: %v", *pullFamily.Name, err)
+			fail(pullFamily, err)
 		} else {
-			results <- familyStr
+			results <- serializedFamily{family: fam, text: familyStr}
 		}
 	}
 }
 
-func processFamilyStringsWorker(results <-chan string, respCh chan<- string) {
-	var resp strings.Builder
-	for result := range results {
-		resp.WriteString(result)
-	}
-	respCh <- resp.String()
-}
-
 // Debug is a handler function to show the current state of the hub without
 // consuming any datapoints
 func (c *MetricHub) Debug(ctx echo.Context) error {
 	verbose := ctx.QueryParam("verbose")
+	if verbose != "" {
+		release, err := c.acquireDiagnostic()
+		if err != nil {
+			return c.shedDiagnostic(ctx, err)
+		}
+		defer release()
+	}
+
+	// Take a consistent snapshot of the stats, and of the exposition text if
+	// requested, so pushes and scrapes can't change them mid-read
+	var expositionText string
+	c.Lock()
+	stats := c.stats
+	limit := c.limit
+	utilization := c.utilization()
+	var oldestAge time.Duration
+	now := c.clock.Now()
+	for _, family := range c.metricFamiliesByName {
+		if age := now.Sub(family.bufferedSince); age > oldestAge {
+			oldestAge = age
+		}
+	}
+	if verbose != "" {
+		expositionText = c.exposeMetrics(c.metricFamiliesByName, c.scrapeWorkers)
+	}
+	c.Unlock()
 
-	c.updateCountStats()
 	hostname, _ := os.Hostname()
 	var limitValue, utilizationValue string
-	if c.limit <= 0 {
+	if limit <= 0 {
 		limitValue = "None"
 		utilizationValue = "0"
 	} else {
-		limitValue = strconv.Itoa(c.limit)
-		utilizationValue = strconv.FormatFloat(float64(c.stats.currentCountDatapoints)*100/float64(c.limit), 'f', 2, 64)
+		limitValue = strconv.Itoa(limit)
+		utilizationValue = strconv.FormatFloat(utilization, 'f', 2, 64)
 	}
 
 	debugString := fmt.Sprintf(`Prometheus Edge Hub running on %s
 Hub Limit:       %s
 Hub Utilization: %s%%
+Hub Warm-up Remaining: %v
 
 Last Scrape: %d
 	Scrape Size: %d
@@ -300,111 +1284,163 @@ Last GRPC Receive: %d
     Receive Size: %d
 	Number of families: %d
 
+Last Import: %d
+	Number of Datapoints: %d
+
 Current Count Families:   %d
 Current Count Series:     %d
-Current Count Datapoints: %d `, hostname, limitValue, utilizationValue,
-		c.stats.lastScrapeTime, c.stats.lastScrapeSize, c.stats.lastScrapeNumFamilies,
-		c.stats.lastHTTPReceiveTime, c.stats.lastHTTPReceiveSize, c.stats.lastHTTPReceiveNumFamilies,
-		c.stats.lastGRPCReceiveTime, c.stats.lastGRPCReceiveSize, c.stats.lastGRPCReceiveNumFamilies,
-		c.stats.currentCountFamilies, c.stats.currentCountSeries, c.stats.currentCountDatapoints)
-
+Current Count Datapoints: %d
+Oldest Datapoint Age:     %v `, hostname, limitValue, utilizationValue, c.warmUpRemaining().Round(time.Second),
+		stats.lastScrapeTime, stats.lastScrapeSize, stats.lastScrapeNumFamilies,
+		stats.lastHTTPReceiveTime, stats.lastHTTPReceiveSize, stats.lastHTTPReceiveNumFamilies,
+		stats.lastGRPCReceiveTime, stats.lastGRPCReceiveSize, stats.lastGRPCReceiveNumFamilies,
+		stats.lastImportTime, stats.lastImportSize,
+		stats.currentCountFamilies, stats.currentCountSeries, stats.currentCountDatapoints, oldestAge.Round(time.Second))
+
+	if c.rejectedSamples != nil {
+		debugString += "\n\n" + c.rejectedSamples.debugString(c.clock.Now())
+	}
 	if verbose != "" {
-		debugString += fmt.Sprintf("\n\nCurrent Exposition Text:\n%s\n", c.exposeMetrics(c.metricFamiliesByName, scrapeWorkerPoolSize))
+		debugString += fmt.Sprintf("\n\nCurrent Exposition Text:\n%s\n", expositionText)
 	}
 
 	return ctx.String(http.StatusOK, debugString)
 }
 
-func (c *MetricHub) updateCountStats() {
-	numFamilies := len(c.metricFamiliesByName)
-	numSeries := 0
-	numDatapoints := 0
-	for _, family := range c.metricFamiliesByName {
-		numSeries += len(family.metrics)
-		for _, series := range family.metrics {
-			numDatapoints += len(series)
-		}
-	}
-	c.stats.currentCountFamilies = numFamilies
-	c.stats.currentCountSeries = numSeries
-	c.stats.currentCountDatapoints = numDatapoints
-}
-
 type familyAndMetrics struct {
 	family  *dto.MetricFamily
-	metrics map[string][]*dto.Metric
+	metrics map[string]*series
+	// bufferedSince is when the oldest datapoint in the family was pushed
+	bufferedSince time.Time
 }
 
-func newFamilyAndMetrics(family *dto.MetricFamily) *familyAndMetrics {
-	metrics := make(map[string][]*dto.Metric)
-	for _, metric := range family.Metric {
-		name := makeLabeledName(metric, family.GetName())
-		if metricQueue, ok := metrics[name]; ok {
-			if *metric.TimestampMs >= *metricQueue[len(metricQueue)-1].TimestampMs {
-				metrics[name] = append(metricQueue, metric)
-			} else {
-				metrics[name] = sortedInsert(metricQueue, metric)
-			}
-		} else {
-			metrics[name] = []*dto.Metric{metric}
-		}
+// newFamilyAndMetrics returns family with its metrics queued, buffered since
+// now
+func newFamilyAndMetrics(family *dto.MetricFamily, now time.Time) *familyAndMetrics {
+	f := &familyAndMetrics{
+		family:        family,
+		metrics:       make(map[string]*series),
+		bufferedSince: now,
 	}
+	f.addMetrics(family.Metric, false, 0)
 	// clear metrics in family because we are keeping them in the queues
 	family.Metric = nil
-
-	return &familyAndMetrics{
-		family:  family,
-		metrics: metrics,
-	}
+	return f
 }
 
-func (f *familyAndMetrics) addMetrics(newMetrics []*dto.Metric) {
-	// Keep array sorted [t0, t1, t2...] each insert
+// addMetrics queues newMetrics in their series, marked as imported if imported
+// is set, and returns the number of series that did not exist yet, the number
+// of metrics merged into a queued summary or histogram datapoint, and the
+// number of datapoints evicted from series over maxDatapoints. 0 is no limit.
+func (f *familyAndMetrics) addMetrics(newMetrics []*dto.Metric, imported bool, maxDatapoints int) (int, int, int) {
+	newSeries, merged, evicted := 0, 0, 0
+	// Keep queues sorted [t0, t1, t2...] each insert
 	for _, metric := range newMetrics {
 		metricName := makeLabeledName(metric, f.family.GetName())
-		if queue, ok := f.metrics[metricName]; ok {
-			if *metric.TimestampMs >= *queue[len(queue)-1].TimestampMs {
-				f.metrics[metricName] = append(queue, metric)
-			} else {
-				f.metrics[metricName] = sortedInsert(queue, metric)
-			}
-		} else {
-			f.metrics[metricName] = []*dto.Metric{metric}
+		queue, ok := f.metrics[metricName]
+		if !ok {
+			queue = &series{labels: sortedLabels(metric.Label)}
+			f.metrics[metricName] = queue
+			newSeries++
+		}
+		s := newSample(metric)
+		s.imported = imported
+		if queue.add(s) {
+			merged++
+		}
+		if maxDatapoints > 0 {
+			evicted += queue.evictOldest(maxDatapoints)
 		}
 	}
+	return newSeries, merged, evicted
 }
 
 // Returns a prometheus MetricFamily populated with all datapoints, sorted so
-// that the earliest datapoint appears first
+// that the earliest datapoint appears first. Series are emitted in order of
+// their labeled name so the output is deterministic.
 func (f *familyAndMetrics) popDatapoints() *dto.MetricFamily {
 	pullFamily := f.copyFamily()
-	for _, queue := range f.metrics {
-		if len(queue) == 0 {
-			continue
-		}
-		pullFamily.Metric = append(pullFamily.Metric, queue...)
+	names := make([]string, 0, len(f.metrics))
+	for name := range f.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pullFamily.Metric = f.metrics[name].appendMetrics(pullFamily.Metric)
 	}
 	return &pullFamily
 }
 
+// popByOrigin is popDatapoints with the live and imported datapoints of f in
+// separate families
+func (f *familyAndMetrics) popByOrigin() (*dto.MetricFamily, *dto.MetricFamily) {
+	live, imported := f.copyFamily(), f.copyFamily()
+	names := make([]string, 0, len(f.metrics))
+	for name := range f.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		queue := f.metrics[name]
+		for _, s := range queue.samples {
+			if s.imported {
+				imported.Metric = append(imported.Metric, s.metric(queue.labels))
+			} else {
+				live.Metric = append(live.Metric, s.metric(queue.labels))
+			}
+		}
+	}
+	return &live, &imported
+}
+
 // return a copy of the MetricFamily that can be modified safely
 func (f *familyAndMetrics) copyFamily() dto.MetricFamily {
 	return *f.family
 }
 
-// makeLabeledName builds a unique name from a metric LabelPairs
+// labeledNameBuffers are reused by makeLabeledName, which runs for every
+// pushed datapoint
+var labeledNameBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 256)
+		return &buf
+	},
+}
+
+// makeLabeledName builds a unique name from a metric LabelPairs. The labels of
+// metric are not reordered, since the metric may be shared with the caller.
 func makeLabeledName(metric *dto.Metric, metricName string) string {
-	labels := metric.GetLabel()
-	sort.Slice(labels, func(i, j int) bool {
-		return labels[i].GetName() < labels[j].GetName()
-	})
+	labels := sortedLabels(metric.GetLabel())
 
-	labeledName := strings.Builder{}
-	labeledName.WriteString(metricName)
+	bufp := labeledNameBuffers.Get().(*[]byte)
+	buf := append((*bufp)[:0], metricName...)
 	for _, labelPair := range labels {
-		labeledName.WriteString(fmt.Sprintf("_%s_%s", labelPair.GetName(), labelPair.GetValue()))
+		buf = append(buf, '_')
+		buf = append(buf, labelPair.GetName()...)
+		buf = append(buf, '_')
+		buf = append(buf, labelPair.GetValue()...)
 	}
-	return labeledName.String()
+	labeledName := string(buf)
+	*bufp = buf
+	labeledNameBuffers.Put(bufp)
+	return labeledName
+}
+
+// sortedLabels returns labels sorted by name. Labels are usually pushed
+// sorted already, in which case they are returned as is, and otherwise a
+// sorted copy is returned.
+func sortedLabels(labels []*dto.LabelPair) []*dto.LabelPair {
+	for i := 1; i < len(labels); i++ {
+		if labels[i-1].GetName() > labels[i].GetName() {
+			sorted := make([]*dto.LabelPair, len(labels))
+			copy(sorted, labels)
+			sort.Slice(sorted, func(i, j int) bool {
+				return sorted[i].GetName() < sorted[j].GetName()
+			})
+			return sorted
+		}
+	}
+	return labels
 }
 
 func familyToString(family *dto.MetricFamily) (string, error) {
@@ -432,11 +1468,3 @@ func WriteInternalMetrics() (string, error) {
 	}
 	return str.String(), nil
 }
-
-func sortedInsert(data []*dto.Metric, el *dto.Metric) []*dto.Metric {
-	index := sort.Search(len(data), func(i int) bool { return *data[i].TimestampMs > *el.TimestampMs })
-	data = append(data, &dto.Metric{})
-	copy(data[index+1:], data[index:])
-	data[index] = el
-	return data
-}
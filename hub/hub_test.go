@@ -8,10 +8,14 @@
 package hub
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo"
 	"github.com/prometheus/client_golang/prometheus"
@@ -81,8 +85,9 @@ func TestReceiveGRPC(t *testing.T) {
 	hub := NewMetricHub(0, 10)
 	f1 := makeFamily(dto.MetricType_GAUGE, "fam1", 10, []*dto.LabelPair{}, 1)
 	f2 := makeFamily(dto.MetricType_GAUGE, "fam2", 10, []*dto.LabelPair{}, 1)
-	hub.ReceiveGRPC([]*dto.MetricFamily{f1, f2})
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{f1, f2})
 
+	assert.Equal(t, ReceiveResult{AcceptedDatapoints: 20}, result)
 	assert.Equal(t, 2, hub.stats.lastGRPCReceiveNumFamilies)
 	assert.Equal(t, 20, hub.stats.currentCountDatapoints)
 }
@@ -124,10 +129,28 @@ fam1{extraLabel="value"} 0 20000000
 	assert.Equal(t, expectedText, rec.Body.String())
 }
 
+func TestMakeLabeledNameKeepsLabelOrder(t *testing.T) {
+	job, jobValue, instance, instanceValue := "job", "a", "instance", "b"
+	labels := []*dto.LabelPair{{Name: &job, Value: &jobValue}, {Name: &instance, Value: &instanceValue}}
+	metric := &dto.Metric{Label: labels}
+
+	assert.Equal(t, "up_instance_b_job_a", makeLabeledName(metric, "up"))
+	assert.Equal(t, "job", metric.Label[0].GetName())
+
+	// stored series still have sorted labels
+	hub := NewMetricHub(0, 10)
+	f1 := makeFamily(dto.MetricType_GAUGE, "fam1", 1, labels, 1000)
+	hub.ReceiveGRPC([]*dto.MetricFamily{f1})
+	assert.Equal(t, "# HELP fam1 fam1\n# TYPE fam1 gauge\nfam1{instance=\"b\",job=\"a\"} 0 1000\n", scrape(t, hub))
+}
+
 func TestReceiveGRPCOverLimit(t *testing.T) {
 	hub := NewMetricHub(1, 10)
 	f1 := makeFamily(dto.MetricType_GAUGE, "fam1", 10, []*dto.LabelPair{}, 1)
-	hub.ReceiveGRPC([]*dto.MetricFamily{f1})
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{f1})
+
+	assert.Equal(t, 10, result.RejectedDatapoints)
+	assert.Equal(t, []RejectReason{RejectLimitExceeded}, result.Reasons)
 
 	assert.Equal(t, 0, hub.stats.lastGRPCReceiveNumFamilies)
 	assert.Equal(t, 0, hub.stats.currentCountDatapoints)
@@ -142,6 +165,21 @@ func receiveString(hub *MetricHub, receiveString string) (*httptest.ResponseReco
 	return rec, err
 }
 
+// scrapeURL scrapes hub with a GET request for url, e.g. /metrics?min_age=1m
+func scrapeURL(t *testing.T, hub *MetricHub, url string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.Scrape(echo.New().NewContext(req, rec)))
+	return rec
+}
+
+// scrape drains hub and returns the exposition
+func scrape(t *testing.T, hub *MetricHub) string {
+	rec := scrapeURL(t, hub, "/metrics")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
 func TestScrape(t *testing.T) {
 	hub := NewMetricHub(0, 10)
 	_, err := receiveString(hub, sampleReceiveString)
@@ -169,6 +207,58 @@ func TestScrape(t *testing.T) {
 	assert.Equal(t, 14, sum)
 }
 
+func TestScrapeFamilies(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+
+	families, err := hub.ScrapeFamilies()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(families))
+	assert.Equal(t, "cpu_usage", families[0].GetName())
+	assert.Equal(t, 5, len(families[0].GetMetric()))
+	assert.Equal(t, "http_requests_total", families[1].GetName())
+	assert.Equal(t, "memory_usage", families[2].GetName())
+	assert.Equal(t, 3, hub.stats.lastScrapeNumFamilies)
+	assert.Equal(t, Status{}, hub.Status())
+
+	warmingHub := NewMetricHub(0, 10, WithWarmUp(time.Hour))
+	_, err = warmingHub.ScrapeFamilies()
+	assert.Equal(t, ErrWarmingUp, err)
+}
+
+func TestStatus(t *testing.T) {
+	hub := NewMetricHub(28, 10)
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, Status{Datapoints: 14, Utilization: 50}, hub.Status())
+}
+
+func TestScrapeDuringWarmUp(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithWarmUp(time.Hour))
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	err = hub.Scrape(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+	// pushes are kept until the warm-up period is over
+	assert.Equal(t, 3, len(hub.metricFamiliesByName))
+
+	hub.startTime = time.Now().Add(-time.Hour)
+	rec = httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	err = hub.Scrape(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 0, len(hub.metricFamiliesByName))
+}
+
 func TestScrapeBadMetrics(t *testing.T) {
 	// check that Scrape handles errors
 	assertWorkerPoolHandlesError(t)
@@ -193,6 +283,84 @@ func TestDebugEndpoint(t *testing.T) {
 	assert.Equal(t, 3, hub.stats.lastHTTPReceiveNumFamilies)
 }
 
+func TestConcurrentPushScrapeDebug(t *testing.T) {
+	const (
+		pushers          = 4
+		pushesPerPusher  = 50
+		datapointsInPush = 14 + 10
+	)
+	hub := NewMetricHub(0, 10)
+
+	var (
+		pushWait   sync.WaitGroup
+		scrapeWait sync.WaitGroup
+		scraped    int64
+	)
+	// count the datapoints returned by every scrape, so we can verify that
+	// none are lost or duplicated at the push/scrape boundary
+	scrapeAndCount := func() {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, hub.Scrape(echo.New().NewContext(req, rec)))
+		var parser expfmt.TextParser
+		families, err := parser.TextToMetricFamilies(rec.Body)
+		assert.NoError(t, err)
+		for _, family := range families {
+			atomic.AddInt64(&scraped, int64(len(family.Metric)))
+		}
+	}
+
+	for i := 0; i < pushers; i++ {
+		pushWait.Add(1)
+		go func(pusher int) {
+			defer pushWait.Done()
+			for j := 0; j < pushesPerPusher; j++ {
+				_, err := receiveString(hub, sampleReceiveString)
+				assert.NoError(t, err)
+				fam := makeFamily(dto.MetricType_GAUGE, fmt.Sprintf("grpc_fam_%d", pusher), 10, []*dto.LabelPair{}, int64(j))
+				hub.ReceiveGRPC([]*dto.MetricFamily{fam})
+			}
+		}(i)
+	}
+
+	done := make(chan struct{})
+	scrapeWait.Add(2)
+	go func() {
+		defer scrapeWait.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				scrapeAndCount()
+			}
+		}
+	}()
+	go func() {
+		defer scrapeWait.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				req := httptest.NewRequest(http.MethodGet, "/debug?verbose=true", nil)
+				rec := httptest.NewRecorder()
+				assert.NoError(t, hub.Debug(echo.New().NewContext(req, rec)))
+			}
+		}
+	}()
+
+	pushWait.Wait()
+	close(done)
+	scrapeWait.Wait()
+	scrapeAndCount()
+
+	assert.Equal(t, int64(pushers*pushesPerPusher*datapointsInPush), scraped)
+	assert.Equal(t, 0, hub.stats.currentCountDatapoints)
+	assert.Equal(t, 0, hub.stats.currentCountSeries)
+	assert.Equal(t, 0, hub.stats.currentCountFamilies)
+}
+
 func TestHubMetrics(t *testing.T) {
 	hubSingleFamily(t, 1)
 	hubSingleFamily(t, 100)
@@ -215,7 +383,7 @@ func hubSingleFamily(t *testing.T, metricsInFamily int) {
 	for _, family := range hub.metricFamiliesByName {
 		assert.Equal(t, 1, len(family.metrics))
 		for _, metric := range family.metrics {
-			assert.Equal(t, metricsInFamily, len(metric))
+			assert.Equal(t, metricsInFamily, len(metric.samples))
 		}
 	}
 }
@@ -233,12 +401,12 @@ func hubMultipleFamilies(t *testing.T) {
 		if strings.HasPrefix(familyName, "mf1") {
 			assert.Equal(t, 1, len(family.metrics))
 			for _, metric := range family.metrics {
-				assert.Equal(t, 5, len(metric))
+				assert.Equal(t, 5, len(metric.samples))
 			}
 		} else {
 			assert.Equal(t, 1, len(family.metrics))
 			for _, metric := range family.metrics {
-				assert.Equal(t, 10, len(metric))
+				assert.Equal(t, 10, len(metric.samples))
 			}
 		}
 	}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+// Package hubtest provides utilities for testing code using the hub
+package hubtest
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock is a hub.Clock that only moves when told to, for deterministic
+// tests of TTLs, staleness, warm-up and periodic tasks. Pass it to
+// hub.WithClock.
+type FakeClock struct {
+	sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+// NewFakeClock returns a FakeClock set to now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the time of the clock
+func (c *FakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d, and ticks the tickers due in that
+// period. Like a time.Ticker, a ticker drops ticks its reader is too slow for.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+	for _, ticker := range c.tickers {
+		ticker.tick(c.now)
+	}
+}
+
+// NewTicker returns a channel ticking every d as the clock is advanced, and a
+// function stopping it
+func (c *FakeClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+	c.Lock()
+	defer c.Unlock()
+	ticker := &fakeTicker{clock: c, interval: d, next: c.now.Add(d), ch: make(chan time.Time, 1)}
+	c.tickers = append(c.tickers, ticker)
+	return ticker.ch, ticker.stop
+}
+
+// Tickers returns the number of running tickers of the clock, so a test can
+// wait for a goroutine to start its ticker before advancing the clock
+func (c *FakeClock) Tickers() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.tickers)
+}
+
+type fakeTicker struct {
+	clock    *FakeClock
+	interval time.Duration
+	next     time.Time
+	ch       chan time.Time
+}
+
+// tick sends a tick if one is due at now. Must be called with the clock lock
+// held.
+func (t *fakeTicker) tick(now time.Time) {
+	if now.Before(t.next) {
+		return
+	}
+	for !now.Before(t.next) {
+		t.next = t.next.Add(t.interval)
+	}
+	select {
+	case t.ch <- now:
+	default:
+	}
+}
+
+func (t *fakeTicker) stop() {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+	for i, ticker := range t.clock.tickers {
+		if ticker == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hubtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	assert.Equal(t, start, clock.Now())
+
+	ticks, stop := clock.NewTicker(time.Minute)
+	assert.Equal(t, 1, clock.Tickers())
+	clock.Advance(59 * time.Second)
+	assert.Len(t, ticks, 0)
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Minute), <-ticks)
+
+	// ticks the reader is too slow for are dropped
+	clock.Advance(3 * time.Minute)
+	clock.Advance(time.Minute)
+	assert.Equal(t, start.Add(4*time.Minute), <-ticks)
+	assert.Len(t, ticks, 0)
+
+	stop()
+	assert.Equal(t, 0, clock.Tickers())
+	clock.Advance(time.Hour)
+	assert.Len(t, ticks, 0)
+	assert.Equal(t, start.Add(65*time.Minute), clock.Now())
+}
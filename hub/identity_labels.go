@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var missingIdentityPushes = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "missing_identity_rejected_pushes_total", Help: "Number of pushes rejected for having datapoints without an identity label, by label"}, []string{"label"})
+
+func init() {
+	prometheus.MustRegister(missingIdentityPushes)
+}
+
+// WithIdentityLabels rejects pushes with datapoints without a value for each
+// of labels, e.g. gatewayID and networkID, so every datapoint can be traced
+// back to the device that pushed it. The labels are reported in Capabilities,
+// so a distributor can key pushes by them.
+func WithIdentityLabels(labels ...string) Option {
+	return func(hub *MetricHub) {
+		hub.identityLabels = labels
+	}
+}
+
+type missingIdentityError struct {
+	family     string
+	label      string
+	datapoints int
+}
+
+func (e *missingIdentityError) Error() string {
+	return fmt.Sprintf("%d datapoints of family %s have no %s label", e.datapoints, e.family, e.label)
+}
+
+// checkIdentity returns a missingIdentityError for the first of families with
+// metrics without one of the identity labels
+func (c *MetricHub) checkIdentity(families []*dto.MetricFamily) error {
+	for _, family := range families {
+		for _, label := range c.identityLabels {
+			missing := 0
+			for _, metric := range family.Metric {
+				if value, ok := labelValue(metric, label); !ok || value == "" {
+					missing++
+				}
+			}
+			if missing > 0 {
+				missingIdentityPushes.WithLabelValues(label).Inc()
+				return &missingIdentityError{family: family.GetName(), label: label, datapoints: missing}
+			}
+		}
+	}
+	return nil
+}
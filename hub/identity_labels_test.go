@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentityLabels(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithIdentityLabels("gatewayID", "networkID"))
+	rec, err := receiveString(hub, `# TYPE up gauge
+up{gatewayID="gw1",networkID="net1"} 1 1000
+up{gatewayID="gw2"} 1 1000
+up{gatewayID="",networkID="net1"} 1 1000
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	resp := decodeError(t, rec)
+	assert.Equal(t, ErrorCodeMissingIdentity, resp.Code)
+	assert.Equal(t, map[string]string{"family": "up", "label": "gatewayID", "datapoints": "1"}, resp.Details)
+	assert.Equal(t, 0, hub.stats.currentCountDatapoints)
+
+	rec, err = receiveString(hub, "# TYPE up gauge\nup{gatewayID=\"gw1\",networkID=\"net1\"} 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	capabilities := hub.Capabilities()
+	assert.Equal(t, []string{"gatewayID", "networkID"}, capabilities.IdentityLabels)
+	assert.Contains(t, capabilities.Features, FeatureIdentityLabels)
+}
+
+func TestIdentityLabelsGRPC(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithIdentityLabels("gatewayID"))
+	family := &dto.MetricFamily{
+		Name: proto.String("up"),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{
+			{Label: []*dto.LabelPair{{Name: proto.String("gatewayID"), Value: proto.String("gw1")}}, Gauge: &dto.Gauge{Value: proto.Float64(1)}},
+			{Gauge: &dto.Gauge{Value: proto.Float64(2)}},
+		},
+	}
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{family})
+	assert.Equal(t, 0, result.AcceptedDatapoints)
+	assert.Equal(t, 2, result.RejectedDatapoints)
+	assert.Equal(t, []RejectReason{RejectMissingIdentity}, result.Reasons)
+}
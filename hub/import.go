@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	// importBatchSize is the number of datapoints decoded before they are
+	// stored in the hub. Keeping batches small bounds how long an import holds
+	// the hub lock.
+	importBatchSize = 10000
+)
+
+var (
+	importSizeDP = prometheus.NewGauge(prometheus.GaugeOpts{Name: "import_size_dp", Help: "Size of last import (number of datapoints)"})
+	importTime   = prometheus.NewGauge(prometheus.GaugeOpts{Name: "import_time", Help: "Time to ingest last import"})
+)
+
+func init() {
+	prometheus.MustRegister(importSizeDP, importTime)
+}
+
+// WithImportLimits sets the limits for the Import endpoint. limit is the
+// maximum number of imported datapoints in the hub at one time, and maxBytes
+// is the maximum uncompressed size of a single import. Values <= 0 mean no
+// limit.
+func WithImportLimits(limit int, maxBytes int64) Option {
+	return func(hub *MetricHub) {
+		hub.importLimit = limit
+		hub.importMaxBytes = maxBytes
+	}
+}
+
+// Import is a handler function for bulk pushes of historical metrics, e.g. a
+// device uploading days of metrics it spooled locally during an outage. The
+// body may be gzip compressed and in text or delimited protobuf format.
+//
+// Imports are stored in small batches so the hub lock is never held for the
+// whole import. Delimited protobuf families are decoded one at a time, but the
+// text format is parsed as a whole on the first decode, so a text import is
+// held in memory up to the import size limit. Imported datapoints count against
+// the import limit instead of the hub limit, and only one import runs at a
+// time, so imports cannot starve live pushes.
+func (c *MetricHub) Import(ctx echo.Context) error {
+	select {
+	case c.importSem <- struct{}{}:
+		defer func() { <-c.importSem }()
+	default:
+		return respondError(ctx, http.StatusTooManyRequests, ErrorCodeImportInProgress, nil, "another import is in progress")
+	}
+
+	t0 := time.Now()
+	req := ctx.Request()
+	var body io.ReadCloser = req.Body
+	if req.Header.Get(echo.HeaderContentEncoding) == "gzip" {
+		gzipReader, err := gzip.NewReader(body)
+		if err != nil {
+			return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "error decompressing import: %v", err)
+		}
+		defer gzipReader.Close()
+		body = gzipReader
+	}
+	if c.importMaxBytes > 0 {
+		body = http.MaxBytesReader(ctx.Response(), body, c.importMaxBytes)
+	}
+
+	decoder := expfmt.NewDecoder(body, expfmt.ResponseFormat(req.Header))
+	var (
+		batch          []*dto.MetricFamily
+		batchSize      int
+		importedPoints int
+	)
+	for {
+		family := &dto.MetricFamily{}
+		err := decoder.Decode(family)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return respondError(ctx, http.StatusBadRequest, ErrorCodeParseError, map[string]string{"imported_datapoints": strconv.Itoa(importedPoints)}, "error parsing metrics after importing %d datapoints: %v", importedPoints, err)
+		}
+		c.prepareFamily(family)
+		batch = append(batch, family)
+		batchSize += len(family.Metric)
+		if batchSize < importBatchSize {
+			continue
+		}
+		if err := c.importBatch(batch, batchSize); err != nil {
+			return respondError(ctx, http.StatusNotAcceptable, ErrorCodeLimitExceeded, map[string]string{"imported_datapoints": strconv.Itoa(importedPoints)}, "imported %d datapoints before stopping: %v", importedPoints, err)
+		}
+		importedPoints += batchSize
+		batch, batchSize = nil, 0
+	}
+	if len(batch) > 0 {
+		if err := c.importBatch(batch, batchSize); err != nil {
+			return respondError(ctx, http.StatusNotAcceptable, ErrorCodeLimitExceeded, map[string]string{"imported_datapoints": strconv.Itoa(importedPoints)}, "imported %d datapoints before stopping: %v", importedPoints, err)
+		}
+		importedPoints += batchSize
+	}
+
+	importSizeDP.Set(float64(importedPoints))
+	importTime.Set(time.Since(t0).Seconds())
+	c.Lock()
+	c.stats.lastImportTime = time.Now().Unix()
+	c.stats.lastImportSize = importedPoints
+	c.Unlock()
+	return ctx.NoContent(http.StatusOK)
+}
+
+func (c *MetricHub) importBatch(families []*dto.MetricFamily, datapoints int) error {
+	if c.wal != nil {
+		// synced once the lock is released, before the import responds
+		defer c.wal.sync()
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	if c.importLimit > 0 && c.stats.currentCountImportedDatapoints+datapoints > c.importLimit {
+		errString := fmt.Sprintf("Not importing batch of size %d. Would overfill import limit of %d. Current imported size: %d", datapoints, c.importLimit, c.stats.currentCountImportedDatapoints)
+		logging.Error("Not importing batch over import limit", "datapoints", datapoints, "limit", c.importLimit, "imported", c.stats.currentCountImportedDatapoints)
+		return errors.New(errString)
+	}
+
+	for _, fam := range families {
+		c.storeDatapoints(fam, true)
+	}
+	c.stats.currentCountImportedDatapoints += datapoints
+	hubSize.Set(float64(c.stats.currentCountDatapoints))
+	return nil
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportText(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	rec := importBody(hub, strings.NewReader(sampleReceiveString), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 14, hub.stats.currentCountDatapoints)
+	assert.Equal(t, 14, hub.stats.lastImportSize)
+	assert.Equal(t, 3, len(hub.metricFamiliesByName))
+}
+
+func TestImportGzip(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	_, err := gzipWriter.Write([]byte(sampleReceiveString))
+	assert.NoError(t, err)
+	assert.NoError(t, gzipWriter.Close())
+
+	rec := importBody(hub, &buf, map[string]string{echo.HeaderContentEncoding: "gzip"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 14, hub.stats.currentCountDatapoints)
+}
+
+func TestImportProtobuf(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	var buf bytes.Buffer
+	encoder := expfmt.NewEncoder(&buf, expfmt.FmtProtoDelim)
+	assert.NoError(t, encoder.Encode(makeFamily(dto.MetricType_GAUGE, "fam1", 10, []*dto.LabelPair{}, 1)))
+	assert.NoError(t, encoder.Encode(makeFamily(dto.MetricType_GAUGE, "fam2", 5, []*dto.LabelPair{}, 1)))
+
+	rec := importBody(hub, &buf, map[string]string{echo.HeaderContentType: string(expfmt.FmtProtoDelim)})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 15, hub.stats.currentCountDatapoints)
+	assert.Equal(t, 2, len(hub.metricFamiliesByName))
+}
+
+func TestImportOverLimit(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithImportLimits(5, 0))
+	rec := importBody(hub, strings.NewReader(sampleReceiveString), nil)
+	assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+	assert.Equal(t, 0, hub.stats.currentCountDatapoints)
+}
+
+func TestImportOverMaxBytes(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithImportLimits(0, 10))
+	rec := importBody(hub, strings.NewReader(sampleReceiveString), nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, 0, hub.stats.currentCountDatapoints)
+}
+
+func TestImportDoesNotCountAgainstHubLimit(t *testing.T) {
+	hub := NewMetricHub(20, 10)
+	rec := importBody(hub, strings.NewReader(sampleReceiveString), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// 14 imported + 14 live datapoints would exceed the hub limit of 20 if
+	// imports were counted
+	resp, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 28, hub.stats.currentCountDatapoints)
+}
+
+func importBody(hub *MetricHub, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/import", body)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	_ = hub.Import(c)
+	return rec
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"mime"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+var (
+	// datapointBuckets go from 1 to 1M datapoints
+	datapointBuckets = prometheus.ExponentialBuckets(1, 4, 11)
+
+	pushDuration     = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "push_duration_seconds", Help: "Time to parse and store pushes, by transport", Buckets: prometheus.DefBuckets}, []string{"transport"})
+	pushSizeBytes    = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "push_size_bytes", Help: "Uncompressed size of pushes, by transport", Buckets: httpSizeBuckets}, []string{"transport"})
+	pushDatapoints   = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "push_size_datapoints", Help: "Number of datapoints in pushes, by transport", Buckets: datapointBuckets}, []string{"transport"})
+	pushParseErrors  = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "push_parse_errors_total", Help: "Number of HTTP pushes that failed to parse, by exposition format"}, []string{"format"})
+	rejectedPushes   = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "rejected_pushes_total", Help: "Number of pushes with datapoints that were not stored, by transport and error code"}, []string{"transport", "code"})
+	scrapeDuration   = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "scrape_duration_seconds", Help: "Time to serve scrapes, not counting long-polling for datapoints, by format", Buckets: prometheus.DefBuckets}, []string{"format"})
+	scrapeDatapoints = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "scrape_size_datapoints", Help: "Number of datapoints drained from the hub per scrape", Buckets: datapointBuckets})
+
+	familyDatapointsDesc = prometheus.NewDesc(
+		"family_datapoints",
+		"Number of datapoints of a family currently in the hub, for the largest families",
+		[]string{"family"}, nil,
+	)
+	familySeriesDesc = prometheus.NewDesc(
+		"family_series",
+		"Number of series of a family currently in the hub, for the largest families",
+		[]string{"family"}, nil,
+	)
+)
+
+func init() {
+	prometheus.MustRegister(pushDuration, pushSizeBytes, pushDatapoints, pushParseErrors, rejectedPushes, scrapeDuration, scrapeDatapoints)
+}
+
+// ObservePushSize records the uncompressed size of a push over transport, for
+// transports whose payload isn't read by the hub package
+func ObservePushSize(transport string, bytes int) {
+	pushSizeBytes.WithLabelValues(transport).Observe(float64(bytes))
+}
+
+// observePush records the duration since t0 and the number of datapoints of
+// a push over transport
+func observePush(transport string, t0 time.Time, datapoints int) {
+	pushDuration.WithLabelValues(transport).Observe(time.Since(t0).Seconds())
+	pushDatapoints.WithLabelValues(transport).Observe(float64(datapoints))
+}
+
+// recordRejectedPush counts a push over transport that had datapoints
+// rejected with code, whether all of them or only some
+func recordRejectedPush(transport string, code ErrorCode) {
+	rejectedPushes.WithLabelValues(transport, string(code)).Inc()
+}
+
+// recordParseError counts an HTTP push of contentType that failed to parse
+func recordParseError(contentType string) {
+	pushParseErrors.WithLabelValues(expositionFormat(contentType)).Inc()
+}
+
+// expositionFormat returns the format pushes of contentType are parsed as,
+// either the text format or OpenMetrics
+func expositionFormat(contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType == expfmt.OpenMetricsType {
+		return ScrapeFormatOpenMetrics
+	}
+	return "text"
+}
+
+// observeScrape starts timing a scrape in format. Call the returned function
+// once the scrape is served.
+func observeScrape(format string) func() {
+	t0 := time.Now()
+	return func() {
+		scrapeDuration.WithLabelValues(format).Observe(time.Since(t0).Seconds())
+	}
+}
+
+// errorCode returns the error code of HTTP pushes rejected for reason
+func (r RejectReason) errorCode() ErrorCode {
+	switch r {
+	case RejectQuotaExceeded:
+		return ErrorCodeQuotaExceeded
+	case RejectUnknownTenant:
+		return ErrorCodeUnknownTenant
+	case RejectSeriesChurn:
+		return ErrorCodeSeriesChurn
+	case RejectMissingTimestamp:
+		return ErrorCodeMissingTimestamp
+	case RejectMissingIdentity:
+		return ErrorCodeMissingIdentity
+	}
+	return ErrorCodeLimitExceeded
+}
+
+// observeDrained records the number of datapoints drained by a scrape, and
+// accounts for the drained families in entry if it isn't nil
+func observeDrained(drained map[string]*familyAndMetrics, entry *AccessLogEntry) {
+	datapoints := countDrainedDatapoints(drained)
+	scrapeDatapoints.Observe(float64(datapoints))
+	if entry != nil {
+		entry.Families += len(drained)
+		entry.Datapoints += datapoints
+	}
+}
+
+// countDrainedDatapoints returns the number of datapoints of drained families
+func countDrainedDatapoints(drained map[string]*familyAndMetrics) int {
+	datapoints := 0
+	for _, family := range drained {
+		datapoints += family.datapoints()
+	}
+	return datapoints
+}
+
+func (f *familyAndMetrics) datapoints() int {
+	datapoints := 0
+	for _, s := range f.metrics {
+		datapoints += len(s.samples)
+	}
+	return datapoints
+}
+
+// familySizeCollector exposes the datapoints and series buffered for the
+// families taking up most of the hub, to tell which clients fill it up
+type familySizeCollector struct {
+	hub  *MetricHub
+	topN int
+}
+
+// NewFamilySizeCollector returns a collector exposing the number of datapoints
+// and series of the topN families with the most datapoints in hub
+func NewFamilySizeCollector(hub *MetricHub, topN int) prometheus.Collector {
+	return &familySizeCollector{hub: hub, topN: topN}
+}
+
+func (f *familySizeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- familyDatapointsDesc
+	ch <- familySeriesDesc
+}
+
+func (f *familySizeCollector) Collect(ch chan<- prometheus.Metric) {
+	sizes := f.hub.familySizes()
+	for i := 0; i < len(sizes) && i < f.topN; i++ {
+		ch <- prometheus.MustNewConstMetric(familyDatapointsDesc, prometheus.GaugeValue, float64(sizes[i].datapoints), sizes[i].name)
+		ch <- prometheus.MustNewConstMetric(familySeriesDesc, prometheus.GaugeValue, float64(sizes[i].series), sizes[i].name)
+	}
+}
+
+type familySize struct {
+	name       string
+	datapoints int
+	series     int
+}
+
+// familySizes returns the number of datapoints and series of each family in
+// the hub, largest first
+func (c *MetricHub) familySizes() []familySize {
+	c.Lock()
+	sizes := make([]familySize, 0, len(c.metricFamiliesByName))
+	for name, family := range c.metricFamiliesByName {
+		sizes = append(sizes, familySize{name: name, datapoints: family.datapoints(), series: len(family.metrics)})
+	}
+	c.Unlock()
+
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].datapoints != sizes[j].datapoints {
+			return sizes[i].datapoints > sizes[j].datapoints
+		}
+		return sizes[i].name < sizes[j].name
+	})
+	return sizes
+}
+
+// countPushedDatapoints returns the number of datapoints of pushed families
+func countPushedDatapoints(families []*dto.MetricFamily) int {
+	datapoints := 0
+	for _, family := range families {
+		datapoints += len(family.Metric)
+	}
+	return datapoints
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushMetrics(t *testing.T) {
+	hub := NewMetricHub(2, 10)
+	httpDatapoints := pushDatapoints.WithLabelValues("http").(prometheus.Histogram)
+	grpcDatapoints := pushDatapoints.WithLabelValues("grpc").(prometheus.Histogram)
+	httpBytes := pushSizeBytes.WithLabelValues("http").(prometheus.Histogram)
+	openMetricsErrors := pushParseErrors.WithLabelValues(ScrapeFormatOpenMetrics)
+	parseRejections := rejectedPushes.WithLabelValues("http", string(ErrorCodeParseError))
+	httpLimitRejections := rejectedPushes.WithLabelValues("http", string(ErrorCodeLimitExceeded))
+	grpcLimitRejections := rejectedPushes.WithLabelValues("grpc", string(ErrorCodeLimitExceeded))
+
+	datapointsBefore, bytesBefore := histogramSum(t, httpDatapoints), histogramSum(t, httpBytes)
+	rec, err := receiveString(hub, "a 1\nb 1\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, datapointsBefore+2, histogramSum(t, httpDatapoints))
+	assert.Equal(t, bytesBefore+8, histogramSum(t, httpBytes))
+
+	// a failed parse is counted by the format it was parsed as
+	parseErrorsBefore, parseRejectionsBefore := testutil.ToFloat64(openMetricsErrors), testutil.ToFloat64(parseRejections)
+	req := httptest.NewRequest(http.MethodPost, "/metrics", strings.NewReader("a{"))
+	req.Header.Set(echo.HeaderContentType, string(expfmt.FmtOpenMetrics))
+	rec = httptest.NewRecorder()
+	assert.NoError(t, hub.Receive(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, parseErrorsBefore+1, testutil.ToFloat64(openMetricsErrors))
+	assert.Equal(t, parseRejectionsBefore+1, testutil.ToFloat64(parseRejections))
+
+	limitRejectionsBefore := testutil.ToFloat64(httpLimitRejections)
+	rec, err = receiveString(hub, "c 1\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+	assert.Equal(t, limitRejectionsBefore+1, testutil.ToFloat64(httpLimitRejections))
+
+	grpcDatapointsBefore, grpcRejectionsBefore := histogramSum(t, grpcDatapoints), testutil.ToFloat64(grpcLimitRejections)
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "d", 3, nil, 1)})
+	assert.Equal(t, 3, result.RejectedDatapoints)
+	assert.Equal(t, grpcDatapointsBefore+3, histogramSum(t, grpcDatapoints))
+	assert.Equal(t, grpcRejectionsBefore+1, testutil.ToFloat64(grpcLimitRejections))
+}
+
+func TestScrapeMetrics(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	textScrapes := scrapeDuration.WithLabelValues("text").(prometheus.Histogram)
+	_, err := receiveString(hub, "a 1\na{x=\"y\"} 1\n")
+	assert.NoError(t, err)
+
+	scrapesBefore, datapointsBefore := histogramCount(t, textScrapes), histogramSum(t, scrapeDatapoints)
+	scrape(t, hub)
+	assert.Equal(t, scrapesBefore+1, histogramCount(t, textScrapes))
+	assert.Equal(t, datapointsBefore+2, histogramSum(t, scrapeDatapoints))
+}
+
+func TestFamilySizeCollector(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewFamilySizeCollector(hub, 1))
+
+	// empty hub exposes no families
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	assert.Empty(t, families)
+
+	_, err = receiveString(hub, "small 1\nlarge{x=\"1\"} 1 1000\nlarge{x=\"1\"} 2 2000\nlarge{x=\"2\"} 1 1000\n")
+	assert.NoError(t, err)
+
+	families, err = registry.Gather()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(families))
+	for _, family := range families {
+		// only the largest family is exposed with topN = 1
+		assert.Equal(t, 1, len(family.GetMetric()))
+		assert.Equal(t, "large", family.GetMetric()[0].GetLabel()[0].GetValue())
+		switch family.GetName() {
+		case "family_datapoints":
+			assert.Equal(t, 3.0, family.GetMetric()[0].GetGauge().GetValue())
+		case "family_series":
+			assert.Equal(t, 2.0, family.GetMetric()[0].GetGauge().GetValue())
+		default:
+			t.Errorf("unexpected family %s", family.GetName())
+		}
+	}
+}
+
+func histogramCount(t *testing.T, histogram prometheus.Histogram) uint64 {
+	metric := &dto.Metric{}
+	assert.NoError(t, histogram.Write(metric))
+	return metric.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// ingestWriteBatch is the maximum number of queued pushes a writer
+	// stores per hold of the hub lock
+	ingestWriteBatch = 64
+)
+
+var (
+	ingestQueueDepth      = prometheus.NewGauge(prometheus.GaugeOpts{Name: "ingest_queue_depth", Help: "Number of accepted pushes waiting in the ingest queue to be stored"})
+	ingestQueuedPoints    = prometheus.NewGauge(prometheus.GaugeOpts{Name: "ingest_queue_datapoints", Help: "Number of accepted datapoints waiting in the ingest queue to be stored"})
+	ingestQueueFull       = prometheus.NewCounter(prometheus.CounterOpts{Name: "ingest_queue_full_total", Help: "Number of pushes that waited because their ingest queue shard was full"})
+	ingestWriteBatchSizes = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "ingest_write_batch_size", Help: "Number of queued pushes stored per hold of the hub lock", Buckets: prometheus.ExponentialBuckets(1, 2, 7)})
+)
+
+func init() {
+	prometheus.MustRegister(ingestQueueDepth, ingestQueuedPoints, ingestQueueFull, ingestWriteBatchSizes)
+}
+
+// WithIngestQueue decouples parsing pushes from storing them. Pushes are
+// still parsed and checked against the hub limit and label quotas before the
+// client gets its response, but are then handed to one of writers writer
+// goroutines through a queue of depth pushes each, and stored in batches.
+// Under bursts of pushes the hub lock is then taken once per batch instead
+// of once per push. Families are always stored by the same writer, so pushes
+// of a family are stored in order. Pushes wait for room when a writer's queue
+// is full. Datapoints accepted but not yet stored count against the hub limit
+// and are scraped once stored. Close stops the writers.
+func WithIngestQueue(depth, writers int) Option {
+	return func(hub *MetricHub) {
+		if hub.ingestQueue != nil {
+			hub.ingestQueue.close()
+		}
+		if depth <= 0 {
+			hub.ingestQueue = nil
+			return
+		}
+		if writers <= 0 {
+			writers = 1
+		}
+		hub.ingestQueue = newIngestQueue(hub, depth, writers)
+	}
+}
+
+// ingestItem is the part of an accepted push stored by one writer
+type ingestItem struct {
+	families   []*dto.MetricFamily
+	datapoints int
+	// synced is closed once the item is stored and synced to the write-ahead
+	// log, if the hub has one
+	synced chan struct{}
+}
+
+type ingestQueue struct {
+	hub    *MetricHub
+	shards []chan ingestItem
+	// pending counts items enqueued but not yet stored
+	pending sync.WaitGroup
+	// closeLock is held for reading while items are enqueued, so the shards
+	// are not closed under them. Once closed is set, pushes are stored
+	// without the queue.
+	closeLock sync.RWMutex
+	closed    bool
+}
+
+func newIngestQueue(hub *MetricHub, depth, writers int) *ingestQueue {
+	q := &ingestQueue{hub: hub, shards: make([]chan ingestItem, writers)}
+	for i := range q.shards {
+		q.shards[i] = make(chan ingestItem, depth)
+		go q.write(q.shards[i])
+	}
+	return q
+}
+
+// enqueue hands accepted families with datapoints in total to the writers,
+// waiting while the queue of a writer is full. The datapoints must already be
+// counted in queuedDatapoints. With a write-ahead log, it also waits until the
+// families are stored and synced to it, so the push is durable once
+// acknowledged.
+func (q *ingestQueue) enqueue(families []*dto.MetricFamily, datapoints int) {
+	q.closeLock.RLock()
+	defer q.closeLock.RUnlock()
+	if q.closed {
+		q.store(families, datapoints)
+		return
+	}
+
+	items := make([]ingestItem, len(q.shards))
+	for _, family := range families {
+		if len(family.Metric) == 0 {
+			continue
+		}
+		shard := q.shard(family.GetName())
+		items[shard].families = append(items[shard].families, family)
+		items[shard].datapoints += len(family.Metric)
+	}
+	for shard, item := range items {
+		if len(item.families) == 0 {
+			continue
+		}
+		if q.hub.wal != nil {
+			items[shard].synced = make(chan struct{})
+			item.synced = items[shard].synced
+		}
+		q.pending.Add(1)
+		ingestQueueDepth.Inc()
+		ingestQueuedPoints.Add(float64(item.datapoints))
+		select {
+		case q.shards[shard] <- item:
+		default:
+			ingestQueueFull.Inc()
+			q.shards[shard] <- item
+		}
+		datapoints -= item.datapoints
+	}
+	if datapoints != 0 {
+		// datapoints of empty families, nothing to store
+		q.hub.Lock()
+		q.hub.queuedDatapoints -= datapoints
+		q.hub.Unlock()
+	}
+	for _, item := range items {
+		if item.synced != nil {
+			<-item.synced
+		}
+	}
+}
+
+func (q *ingestQueue) shard(family string) int {
+	if len(q.shards) == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(family))
+	return int(h.Sum32() % uint32(len(q.shards)))
+}
+
+// write stores the items of shard in batches, as long as the hub exists
+func (q *ingestQueue) write(shard <-chan ingestItem) {
+	batch := make([]ingestItem, 0, ingestWriteBatch)
+	for item := range shard {
+		batch = append(batch[:0], item)
+	collect:
+		for len(batch) < ingestWriteBatch {
+			select {
+			case item := <-shard:
+				batch = append(batch, item)
+			default:
+				break collect
+			}
+		}
+
+		datapoints := 0
+		q.hub.Lock()
+		for _, item := range batch {
+			for _, family := range item.families {
+				q.hub.storeFamily(family)
+			}
+			datapoints += item.datapoints
+		}
+		q.hub.queuedDatapoints -= datapoints
+		hubSize.Set(float64(q.hub.stats.currentCountDatapoints))
+		q.hub.Unlock()
+		if q.hub.wal != nil {
+			// one sync for the whole batch
+			q.hub.wal.sync()
+			for _, item := range batch {
+				close(item.synced)
+			}
+		}
+
+		ingestWriteBatchSizes.Observe(float64(len(batch)))
+		ingestQueueDepth.Sub(float64(len(batch)))
+		ingestQueuedPoints.Sub(float64(datapoints))
+		for range batch {
+			q.pending.Done()
+		}
+	}
+}
+
+// store stores families with datapoints in total right away, for pushes
+// accepted after the queue was closed
+func (q *ingestQueue) store(families []*dto.MetricFamily, datapoints int) {
+	q.hub.Lock()
+	for _, family := range families {
+		q.hub.storeFamily(family)
+	}
+	q.hub.queuedDatapoints -= datapoints
+	hubSize.Set(float64(q.hub.stats.currentCountDatapoints))
+	q.hub.Unlock()
+	if q.hub.wal != nil {
+		q.hub.wal.sync()
+	}
+}
+
+// wait blocks until every item enqueued so far is stored
+func (q *ingestQueue) wait() {
+	q.pending.Wait()
+}
+
+// close stops the writers once the items enqueued so far are stored
+func (q *ingestQueue) close() {
+	q.closeLock.Lock()
+	defer q.closeLock.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.wait()
+	for _, shard := range q.shards {
+		close(shard)
+	}
+}
+
+// Close stops the writers of the ingest queue, if the hub has one, once the
+// pushes queued so far are stored. Pushes accepted afterwards are stored
+// right away.
+func (c *MetricHub) Close() {
+	if c.ingestQueue != nil {
+		c.ingestQueue.close()
+	}
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIngestQueue(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithIngestQueue(4, 2))
+	defer hub.Close()
+	resp, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "grpc_metric", 3, testLabels, timestamp)})
+	assert.Equal(t, 3, result.AcceptedDatapoints)
+
+	hub.ingestQueue.wait()
+	assert.Equal(t, 17, hub.Status().Datapoints)
+	assert.Equal(t, 4, hub.stats.currentCountFamilies)
+	assert.Equal(t, 0, hub.queuedDatapoints)
+}
+
+func TestIngestQueueClose(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithIngestQueue(4, 2))
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+
+	// queued pushes are stored before the writers stop
+	hub.Close()
+	assert.Equal(t, 14, hub.Status().Datapoints)
+	for _, shard := range hub.ingestQueue.shards {
+		_, open := <-shard
+		assert.False(t, open)
+	}
+
+	// later pushes are stored right away
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "grpc_metric", 3, testLabels, timestamp)})
+	assert.Equal(t, 3, result.AcceptedDatapoints)
+	assert.Equal(t, 17, hub.Status().Datapoints)
+	assert.Equal(t, 0, hub.queuedDatapoints)
+	hub.Close()
+}
+
+func TestIngestQueueCountsAgainstLimit(t *testing.T) {
+	hub := NewMetricHub(20, 10, WithIngestQueue(4, 1))
+	defer hub.Close()
+	resp, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// rejected whether or not the first push has been stored yet
+	resp, err = receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotAcceptable, resp.Code)
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "grpc_metric", 7, testLabels, timestamp)})
+	assert.Equal(t, 7, result.RejectedDatapoints)
+
+	hub.ingestQueue.wait()
+	assert.Equal(t, 14, hub.Status().Datapoints)
+}
+
+func TestIngestQueueScrapesEveryDatapointOnce(t *testing.T) {
+	const (
+		pushers = 8
+		pushes  = 100
+	)
+	hub := NewMetricHub(0, 10, WithIngestQueue(2, 3))
+	defer hub.Close()
+
+	var scraped int
+	scrapeAll := func() {
+		families, err := hub.ScrapeFamilies()
+		assert.NoError(t, err)
+		for _, family := range families {
+			scraped += len(family.Metric)
+		}
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	scraperDone := make(chan struct{})
+	go func() {
+		defer close(scraperDone)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				scrapeAll()
+			}
+		}
+	}()
+	for p := 0; p < pushers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < pushes; i++ {
+				family := makeFamily(dto.MetricType_GAUGE, fmt.Sprintf("queued_%d", i%5), 2, gatewayLabels(fmt.Sprint(p)), int64(i))
+				hub.ReceiveGRPC([]*dto.MetricFamily{family})
+			}
+		}(p)
+	}
+	wg.Wait()
+	close(stop)
+	<-scraperDone
+
+	hub.ingestQueue.wait()
+	scrapeAll()
+	assert.Equal(t, pushers*pushes*2, scraped)
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/labstack/echo"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// ScrapeFormatJSONL is the value of the format scrape parameter that
+	// returns one JSON object per sample instead of the text exposition
+	ScrapeFormatJSONL = "jsonl"
+	// JSONLContentType is the content type of JSON lines scrapes
+	JSONLContentType = "application/x-ndjson"
+
+	// jsonlFlushFamilies is the number of families written between flushes
+	// of a JSON lines scrape
+	jsonlFlushFamilies = 100
+)
+
+// jsonlSample is a single line of a JSON lines scrape
+type jsonlSample struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+	Value  jsonlValue        `json:"value"`
+	// Timestamp is in milliseconds since the epoch, omitted for datapoints
+	// pushed without a timestamp
+	Timestamp *int64 `json:"timestamp,omitempty"`
+}
+
+// jsonlValue is a sample value, encoded as a JSON number, or as the string
+// "NaN", "+Inf" or "-Inf" since JSON numbers can't represent them
+type jsonlValue float64
+
+func (v jsonlValue) MarshalJSON() ([]byte, error) {
+	f := float64(v)
+	switch {
+	case math.IsNaN(f):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(f, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(f, -1):
+		return []byte(`"-Inf"`), nil
+	}
+	return json.Marshal(f)
+}
+
+// scrapeJSONL drains datapoints of class older than minAge from the hub and
+// streams them as JSON lines. Families are written in name order as they are
+// serialized, so the whole scrape is never held in memory as a string.
+func (c *MetricHub) scrapeJSONL(ctx echo.Context, minAge time.Duration, class ScrapeClass, entry *AccessLogEntry) error {
+	drained, scrapeID := c.drainSelected(minAge, class)
+	observeDrained(drained, entry)
+	names := make([]string, 0, len(drained))
+	for name := range drained {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resp := ctx.Response()
+	resp.Header().Set(ScrapeIDHeader, scrapeID)
+	resp.Header().Set(echo.HeaderContentType, JSONLContentType)
+	resp.WriteHeader(http.StatusOK)
+
+	writer := bufio.NewWriter(resp)
+	encoder := json.NewEncoder(writer)
+	var err error
+	for i, name := range names {
+		if err = writeJSONLFamily(encoder, c.popOrdered(drained[name])); err != nil {
+			break
+		}
+		if (i+1)%jsonlFlushFamilies == 0 {
+			if err = writer.Flush(); err != nil {
+				break
+			}
+			resp.Flush()
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	c.recordScrape(resp.Size, len(drained))
+	if err != nil {
+		logging.Error("Error writing JSON lines scrape", "scrape_id", scrapeID, "err", err)
+	}
+	return nil
+}
+
+// writeJSONLFamily writes every sample of family
+func writeJSONLFamily(encoder *json.Encoder, family *dto.MetricFamily) error {
+	return forEachJSONLSample(family, func(sample jsonlSample) error {
+		return encoder.Encode(sample)
+	})
+}
+
+// forEachJSONLSample calls fn with every sample of family
+func forEachJSONLSample(family *dto.MetricFamily, fn func(jsonlSample) error) error {
+	name := family.GetName()
+	for _, metric := range family.Metric {
+		err := flattenMetric(family.GetType(), metric, func(suffix string, value float64, extraLabel, extraValue string) error {
+			labels := make(map[string]string, len(metric.Label)+1)
+			for _, label := range metric.Label {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if extraLabel != "" {
+				labels[extraLabel] = extraValue
+			}
+			return fn(jsonlSample{
+				Name:      name + suffix,
+				Labels:    labels,
+				Value:     jsonlValue(value),
+				Timestamp: metric.TimestampMs,
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flattenMetric calls sample for every sample of metric, flattening summaries
+// and histograms into samples the same way the text exposition does. suffix
+// is appended to the family name, and extraLabel is set for quantiles and
+// buckets. Metrics of unknown types are dropped.
+func flattenMetric(metricType dto.MetricType, metric *dto.Metric, sample func(suffix string, value float64, extraLabel, extraValue string) error) error {
+	switch metricType {
+	case dto.MetricType_COUNTER:
+		return sample("", metric.GetCounter().GetValue(), "", "")
+	case dto.MetricType_GAUGE:
+		return sample("", metric.GetGauge().GetValue(), "", "")
+	case dto.MetricType_UNTYPED:
+		return sample("", metric.GetUntyped().GetValue(), "", "")
+	case dto.MetricType_SUMMARY:
+		summary := metric.GetSummary()
+		for _, quantile := range summary.Quantile {
+			if err := sample("", quantile.GetValue(), "quantile", formatFloat(quantile.GetQuantile())); err != nil {
+				return err
+			}
+		}
+		if err := sample("_sum", summary.GetSampleSum(), "", ""); err != nil {
+			return err
+		}
+		return sample("_count", float64(summary.GetSampleCount()), "", "")
+	case dto.MetricType_HISTOGRAM:
+		histogram := metric.GetHistogram()
+		infSeen := false
+		for _, bucket := range histogram.Bucket {
+			if math.IsInf(bucket.GetUpperBound(), 1) {
+				infSeen = true
+			}
+			if err := sample("_bucket", float64(bucket.GetCumulativeCount()), "le", formatFloat(bucket.GetUpperBound())); err != nil {
+				return err
+			}
+		}
+		if !infSeen {
+			if err := sample("_bucket", float64(histogram.GetSampleCount()), "le", "+Inf"); err != nil {
+				return err
+			}
+		}
+		if err := sample("_sum", histogram.GetSampleSum(), "", ""); err != nil {
+			return err
+		}
+		return sample("_count", float64(histogram.GetSampleCount()), "", "")
+	}
+	logging.Error("Dropped metric of unknown type", "type", metricType)
+	return nil
+}
+
+// formatFloat formats quantiles and bucket bounds like the text exposition
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
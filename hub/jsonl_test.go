@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrapeJSONL(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, `
+# TYPE cpu_usage gauge
+cpu_usage{host="B"} 3 1395066363100
+cpu_usage{host="A"} 1027 1395066363000
+cpu_usage{host="A"} 1028 1395066363010
+# TYPE errors_total counter
+errors_total NaN
+`)
+	assert.NoError(t, err)
+
+	rec := scrapeURL(t, hub, "/metrics?format=jsonl")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, JSONLContentType, rec.Header().Get(echo.HeaderContentType))
+	assert.NotEmpty(t, rec.Header().Get(ScrapeIDHeader))
+	assert.Equal(t, `{"name":"cpu_usage","labels":{"host":"A"},"value":1027,"timestamp":1395066363000}
+{"name":"cpu_usage","labels":{"host":"A"},"value":1028,"timestamp":1395066363010}
+{"name":"cpu_usage","labels":{"host":"B"},"value":3,"timestamp":1395066363100}
+{"name":"errors_total","labels":{},"value":"NaN"}
+`, rec.Body.String())
+
+	// the scrape consumed the datapoints
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, "", scrapeURL(t, hub, "/metrics?format=jsonl").Body.String())
+}
+
+func TestScrapeJSONLHistogramAndSummary(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, `
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.5"} 2 1000
+latency_seconds_bucket{le="+Inf"} 3 1000
+latency_seconds_sum 1.5 1000
+latency_seconds_count 3 1000
+# TYPE rpc_seconds summary
+rpc_seconds{quantile="0.99"} 0.2 1000
+rpc_seconds_sum 4 1000
+rpc_seconds_count 20 1000
+`)
+	assert.NoError(t, err)
+
+	rec := scrapeURL(t, hub, "/metrics?format=jsonl")
+	assert.Equal(t, `{"name":"latency_seconds_bucket","labels":{"le":"0.5"},"value":2,"timestamp":1000}
+{"name":"latency_seconds_bucket","labels":{"le":"+Inf"},"value":3,"timestamp":1000}
+{"name":"latency_seconds_sum","labels":{},"value":1.5,"timestamp":1000}
+{"name":"latency_seconds_count","labels":{},"value":3,"timestamp":1000}
+{"name":"rpc_seconds","labels":{"quantile":"0.99"},"value":0.2,"timestamp":1000}
+{"name":"rpc_seconds_sum","labels":{},"value":4,"timestamp":1000}
+{"name":"rpc_seconds_count","labels":{},"value":20,"timestamp":1000}
+`, rec.Body.String())
+}
+
+func TestScrapeJSONLWithMinAge(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics?format=jsonl&min_age=1s", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.Scrape(echo.New().NewContext(req, rec)))
+	assert.Equal(t, 14, strings.Count(rec.Body.String(), "\n"))
+}
+
+func TestScrapeUnknownFormat(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics?format=xml", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.Scrape(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, 14, hub.Status().Datapoints)
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KeyLimit limits the datapoints pushed with each value of a label (e.g.
+// every networkID) between two scrapes, so a single tenant can't use up the
+// hub limit for everyone else. Pushes that would exceed it are rejected like
+// those over a reject tier label quota.
+type KeyLimit struct {
+	Label      string
+	Datapoints int
+}
+
+// ParseKeyLimit parses a key limit of the form label=NAME,limit=N
+func ParseKeyLimit(spec string) (KeyLimit, error) {
+	var limit KeyLimit
+	hasLimit := false
+	for _, field := range strings.Split(spec, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return limit, fmt.Errorf("invalid key limit %q, must be label=NAME,limit=N", spec)
+		}
+		switch strings.TrimSpace(parts[0]) {
+		case "label":
+			limit.Label = strings.TrimSpace(parts[1])
+		case "limit":
+			datapoints, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil || datapoints < 0 {
+				return limit, fmt.Errorf("invalid limit %q in key limit %q, must be a non-negative number of datapoints", parts[1], spec)
+			}
+			limit.Datapoints = datapoints
+			hasLimit = true
+		default:
+			return limit, fmt.Errorf("unknown field %q in key limit %q, must be label=NAME,limit=N", parts[0], spec)
+		}
+	}
+	if limit.Label == "" || !hasLimit {
+		return limit, fmt.Errorf("invalid key limit %q, must be label=NAME,limit=N", spec)
+	}
+	return limit, nil
+}
+
+// WithKeyLimits enforces limits on the datapoints pushed with each value of
+// their labels. A label quota for a specific value overrides the key limit of
+// its label, e.g. to give a large tenant more room.
+func WithKeyLimits(limits []KeyLimit) Option {
+	return func(hub *MetricHub) {
+		if len(limits) == 0 {
+			return
+		}
+		if hub.labelQuotas == nil {
+			hub.labelQuotas = newLabelQuotas(nil)
+		}
+		hub.labelQuotas.keyLimits = make(map[string]int, len(limits))
+		for _, limit := range limits {
+			hub.labelQuotas.keyLimits[limit.Label] = limit.Datapoints
+		}
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyLimit(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithKeyLimits([]KeyLimit{{Label: "gatewayID", Datapoints: 2}}))
+
+	// every value gets its own limit
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 2, gatewayLabels("gw1"), timestamp)})
+	assert.Equal(t, 2, result.AcceptedDatapoints)
+	result = hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 2, gatewayLabels("gw2"), timestamp)})
+	assert.Equal(t, 2, result.AcceptedDatapoints)
+
+	resp, err := receiveString(hub, "fam1{gatewayID=\"gw1\"} 1 3000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	result = hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam2", 1, gatewayLabels("gw2"), timestamp)})
+	assert.Equal(t, 1, result.RejectedDatapoints)
+	assert.Equal(t, []RejectReason{RejectQuotaExceeded}, result.Reasons)
+
+	// datapoints without the label aren't limited
+	resp, err = receiveString(hub, "fam1{host=\"A\"} 1 3000\nfam1{host=\"B\"} 1 3000\nfam1{host=\"C\"} 1 3000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 7, hub.Status().Datapoints)
+
+	// the values pushed are forgotten on scrape
+	scrape(t, hub)
+	assert.Equal(t, 0, len(hub.labelQuotas.perKey))
+	result = hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 2, gatewayLabels("gw1"), timestamp)})
+	assert.Equal(t, 2, result.AcceptedDatapoints)
+}
+
+func TestLabelQuotaOverridesKeyLimit(t *testing.T) {
+	hub := NewMetricHub(0, 10,
+		WithKeyLimits([]KeyLimit{{Label: "gatewayID", Datapoints: 2}}),
+		WithLabelQuotas([]LabelQuota{{Label: "gatewayID", Value: "gw1", Datapoints: 5, Tier: QuotaTierWarn}}),
+	)
+
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 6, gatewayLabels("gw1"), timestamp)})
+	assert.Equal(t, 6, result.AcceptedDatapoints)
+	result = hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 3, gatewayLabels("gw2"), timestamp)})
+	assert.Equal(t, 3, result.RejectedDatapoints)
+
+	// key limits are kept when the label quotas are replaced
+	assert.NoError(t, hub.SetLabelQuotas(nil))
+	result = hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam2", 3, gatewayLabels("gw1"), timestamp)})
+	assert.Equal(t, 3, result.RejectedDatapoints)
+	assert.Contains(t, hub.Capabilities().Features, FeatureKeyLimits)
+}
+
+func TestParseKeyLimit(t *testing.T) {
+	limit, err := ParseKeyLimit("label=networkID,limit=50000")
+	assert.NoError(t, err)
+	assert.Equal(t, KeyLimit{Label: "networkID", Datapoints: 50000}, limit)
+
+	for _, spec := range []string{"", "label=networkID", "limit=5", "label=networkID,limit=-1", "label=networkID,limit=many", "label=networkID,limit=5,tier=warn", "networkID"} {
+		_, err := ParseKeyLimit(spec)
+		assert.Error(t, err, spec)
+	}
+}
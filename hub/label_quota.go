@@ -0,0 +1,312 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// QuotaTier is how a label quota is enforced once it is used up
+type QuotaTier string
+
+const (
+	// QuotaTierWarn stores datapoints over the quota and only counts them
+	QuotaTierWarn QuotaTier = "warn"
+	// QuotaTierThrottle drops the datapoints of a push that are over the
+	// quota and stores the rest
+	QuotaTierThrottle QuotaTier = "throttle"
+	// QuotaTierReject rejects whole pushes that would exceed the quota
+	QuotaTierReject QuotaTier = "reject"
+)
+
+var (
+	labelQuotaExceeded = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "label_quota_exceeded_datapoints_total", Help: "Number of pushed datapoints over their label quota, by quota and enforcement tier"}, []string{"label", "value", "tier"})
+	labelQuotaUsage    = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "label_quota_usage_datapoints", Help: "Datapoints pushed since the last scrape counted against each label quota"}, []string{"label", "value"})
+)
+
+func init() {
+	prometheus.MustRegister(labelQuotaExceeded, labelQuotaUsage)
+}
+
+// LabelQuota limits the datapoints pushed with a label value (e.g.
+// gatewayID=gw42) between two scrapes. Usage is reset on every scrape.
+type LabelQuota struct {
+	Label      string    `json:"label"`
+	Value      string    `json:"value"`
+	Datapoints int       `json:"datapoints"`
+	Tier       QuotaTier `json:"tier"`
+}
+
+func (q LabelQuota) validate() error {
+	if q.Label == "" {
+		return fmt.Errorf("quota for value %q has no label", q.Value)
+	}
+	if q.Datapoints < 0 {
+		return fmt.Errorf("quota for %s=%q has negative datapoints", q.Label, q.Value)
+	}
+	switch q.Tier {
+	case QuotaTierWarn, QuotaTierThrottle, QuotaTierReject:
+		return nil
+	}
+	return fmt.Errorf("quota for %s=%q has unknown tier %q, must be warn, throttle or reject", q.Label, q.Value, q.Tier)
+}
+
+// LoadLabelQuotas reads a JSON list of label quotas from path
+func LoadLabelQuotas(path string) ([]LabelQuota, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var quotas []LabelQuota
+	if err := json.Unmarshal(data, &quotas); err != nil {
+		return nil, fmt.Errorf("error parsing label quotas: %v", err)
+	}
+	for _, quota := range quotas {
+		if err := quota.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return quotas, nil
+}
+
+// WithLabelQuotas enforces quotas on pushes. Quotas can be replaced later with
+// SetLabelQuotas.
+func WithLabelQuotas(quotas []LabelQuota) Option {
+	return func(hub *MetricHub) {
+		q := newLabelQuotas(quotas)
+		if hub.labelQuotas != nil {
+			q.keyLimits = hub.labelQuotas.keyLimits
+		}
+		hub.labelQuotas = q
+	}
+}
+
+// SetLabelQuotas replaces the label quotas of the hub. Usage of quotas that
+// are kept is carried over.
+func (c *MetricHub) SetLabelQuotas(quotas []LabelQuota) error {
+	for _, quota := range quotas {
+		if err := quota.validate(); err != nil {
+			return err
+		}
+	}
+	updated := newLabelQuotas(quotas)
+
+	c.Lock()
+	defer c.Unlock()
+	if c.labelQuotas != nil {
+		updated.keyLimits = c.labelQuotas.keyLimits
+		updated.perKey = c.labelQuotas.perKey
+		for key, state := range updated.quotas {
+			if old, ok := c.labelQuotas.quotas[key]; ok {
+				state.used = old.used
+			}
+		}
+		for key := range c.labelQuotas.quotas {
+			if _, ok := updated.quotas[key]; !ok {
+				labelQuotaUsage.DeleteLabelValues(key.label, key.value)
+			}
+		}
+	}
+	c.labelQuotas = updated
+	return nil
+}
+
+// LabelQuotas returns the label quotas of the hub
+func (c *MetricHub) LabelQuotas() []LabelQuota {
+	c.Lock()
+	defer c.Unlock()
+	quotas := []LabelQuota{}
+	if c.labelQuotas != nil {
+		quotas = append(quotas, c.labelQuotas.list...)
+	}
+	return quotas
+}
+
+// GetLabelQuotas is a handler function returning the label quotas as JSON
+func (c *MetricHub) GetLabelQuotas(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, c.LabelQuotas())
+}
+
+// PutLabelQuotas is a handler function replacing the label quotas with the
+// JSON list in the request body
+func (c *MetricHub) PutLabelQuotas(ctx echo.Context) error {
+	var quotas []LabelQuota
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&quotas); err != nil {
+		return respondError(ctx, http.StatusBadRequest, ErrorCodeParseError, nil, "error parsing label quotas: %v", err)
+	}
+	if err := c.SetLabelQuotas(quotas); err != nil {
+		return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "%v", err)
+	}
+	return ctx.JSON(http.StatusOK, c.LabelQuotas())
+}
+
+// quotaError is returned for pushes rejected by a reject tier label quota
+type quotaError struct {
+	quota     LabelQuota
+	requested int
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("Not accepting push with %d datapoints for %s=%q. Would exceed its quota of %d datapoints\n", e.requested, e.quota.Label, e.quota.Value, e.quota.Datapoints)
+}
+
+type quotaKey struct {
+	label string
+	value string
+}
+
+type labelQuotaState struct {
+	LabelQuota
+	used int
+}
+
+type labelQuotas struct {
+	list   []LabelQuota
+	quotas map[quotaKey]*labelQuotaState
+	// keyLimits are the per value limits of labels set with WithKeyLimits,
+	// and perKey the quotas of the values pushed since the last scrape
+	keyLimits map[string]int
+	perKey    map[quotaKey]*labelQuotaState
+}
+
+func newLabelQuotas(quotas []LabelQuota) *labelQuotas {
+	q := &labelQuotas{
+		list:   quotas,
+		quotas: make(map[quotaKey]*labelQuotaState, len(quotas)),
+		perKey: make(map[quotaKey]*labelQuotaState),
+	}
+	for _, quota := range quotas {
+		q.quotas[quotaKey{label: quota.Label, value: quota.Value}] = &labelQuotaState{LabelQuota: quota}
+	}
+	return q
+}
+
+// matching returns the quotas that apply to metric. A label quota for a
+// value takes precedence over the key limit of its label.
+func (q *labelQuotas) matching(metric *dto.Metric) []*labelQuotaState {
+	var states []*labelQuotaState
+	for _, label := range metric.Label {
+		key := quotaKey{label: label.GetName(), value: label.GetValue()}
+		if state, ok := q.quotas[key]; ok {
+			states = append(states, state)
+		} else if state := q.keyQuota(key); state != nil {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+// keyQuota returns the quota of key under the key limit of its label, if any
+func (q *labelQuotas) keyQuota(key quotaKey) *labelQuotaState {
+	limit, ok := q.keyLimits[key.label]
+	if !ok {
+		return nil
+	}
+	state, ok := q.perKey[key]
+	if !ok {
+		state = &labelQuotaState{LabelQuota: LabelQuota{Label: key.label, Value: key.value, Datapoints: limit, Tier: QuotaTierReject}}
+		q.perKey[key] = state
+	}
+	return state
+}
+
+// admit enforces the quotas on a push of families. It returns a quotaError,
+// without using any quota, if the push would exceed a reject tier quota.
+// Otherwise it drops the datapoints over throttle tier quotas from families,
+// counts the rest against their quotas, and returns the number of datapoints
+// dropped. Must be called with the hub lock held.
+func (q *labelQuotas) admit(families []*dto.MetricFamily) (int, error) {
+	requested := make(map[*labelQuotaState]int)
+	for _, fam := range families {
+		for _, metric := range fam.Metric {
+			for _, state := range q.matching(metric) {
+				requested[state]++
+			}
+		}
+	}
+	for state, n := range requested {
+		if state.Tier == QuotaTierReject && state.used+n > state.Datapoints {
+			labelQuotaExceeded.WithLabelValues(state.Label, state.Value, string(QuotaTierReject)).Add(float64(n))
+			err := &quotaError{quota: state.LabelQuota, requested: n}
+			logging.Error("Rejected push over label quota", "err", err)
+			return 0, err
+		}
+	}
+
+	dropped := 0
+	for _, fam := range families {
+		kept := fam.Metric[:0]
+		for _, metric := range fam.Metric {
+			states := q.matching(metric)
+			if throttled := exhaustedThrottle(states); throttled != nil {
+				labelQuotaExceeded.WithLabelValues(throttled.Label, throttled.Value, string(QuotaTierThrottle)).Inc()
+				dropped++
+				continue
+			}
+			for _, state := range states {
+				state.used++
+				if state.used > state.Datapoints {
+					labelQuotaExceeded.WithLabelValues(state.Label, state.Value, string(state.Tier)).Inc()
+				}
+			}
+			kept = append(kept, metric)
+		}
+		fam.Metric = kept
+	}
+	for state := range requested {
+		labelQuotaUsage.WithLabelValues(state.Label, state.Value).Set(float64(state.used))
+	}
+	return dropped, nil
+}
+
+// exhaustedThrottle returns the first used up throttle tier quota in states
+func exhaustedThrottle(states []*labelQuotaState) *labelQuotaState {
+	for _, state := range states {
+		if state.Tier == QuotaTierThrottle && state.used >= state.Datapoints {
+			return state
+		}
+	}
+	return nil
+}
+
+// reset clears the usage of every quota. Must be called with the hub lock
+// held.
+func (q *labelQuotas) reset() {
+	for _, state := range q.quotas {
+		state.used = 0
+		labelQuotaUsage.WithLabelValues(state.Label, state.Value).Set(0)
+	}
+	// values under key limits are forgotten, so departed tenants don't
+	// accumulate
+	for key := range q.perKey {
+		labelQuotaUsage.DeleteLabelValues(key.label, key.value)
+	}
+	q.perKey = make(map[quotaKey]*labelQuotaState)
+}
+
+// forget clears the usage of the quota on label=value, if any. Must be called
+// with the hub lock held.
+func (q *labelQuotas) forget(label, value string) {
+	key := quotaKey{label: label, value: value}
+	if state, ok := q.quotas[key]; ok {
+		state.used = 0
+		labelQuotaUsage.WithLabelValues(state.Label, state.Value).Set(0)
+	}
+	if _, ok := q.perKey[key]; ok {
+		delete(q.perKey, key)
+		labelQuotaUsage.DeleteLabelValues(label, value)
+	}
+}
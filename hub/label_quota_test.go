@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelQuotaWarn(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithLabelQuotas([]LabelQuota{{Label: "gatewayID", Value: "gw1", Datapoints: 2, Tier: QuotaTierWarn}}))
+	exceeded := testutil.ToFloat64(labelQuotaExceeded.WithLabelValues("gatewayID", "gw1", "warn"))
+
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 3, gatewayLabels("gw1"), timestamp)})
+	assert.Equal(t, 3, result.AcceptedDatapoints)
+	assert.Empty(t, result.Reasons)
+	assert.Equal(t, exceeded+1, testutil.ToFloat64(labelQuotaExceeded.WithLabelValues("gatewayID", "gw1", "warn")))
+}
+
+func TestLabelQuotaThrottle(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithLabelQuotas([]LabelQuota{{Label: "gatewayID", Value: "gw1", Datapoints: 2, Tier: QuotaTierThrottle}}))
+
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{
+		makeFamily(dto.MetricType_GAUGE, "fam1", 3, gatewayLabels("gw1"), timestamp),
+		makeFamily(dto.MetricType_GAUGE, "fam2", 3, gatewayLabels("gw2"), timestamp),
+	})
+	assert.Equal(t, 5, result.AcceptedDatapoints)
+	assert.Equal(t, 1, result.RejectedDatapoints)
+	assert.Equal(t, []RejectReason{RejectQuotaExceeded}, result.Reasons)
+	assert.Equal(t, 5, hub.Status().Datapoints)
+
+	// usage is reset by scrapes
+	scrape(t, hub)
+	result = hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 2, gatewayLabels("gw1"), timestamp)})
+	assert.Equal(t, 2, result.AcceptedDatapoints)
+}
+
+func TestLabelQuotaReject(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithLabelQuotas([]LabelQuota{{Label: "gatewayID", Value: "gw1", Datapoints: 2, Tier: QuotaTierReject}}))
+
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 3, gatewayLabels("gw1"), timestamp)})
+	assert.Equal(t, 0, result.AcceptedDatapoints)
+	assert.Equal(t, 3, result.RejectedDatapoints)
+	assert.Equal(t, []RejectReason{RejectQuotaExceeded}, result.Reasons)
+
+	// a rejected push uses no quota
+	resp, err := receiveString(hub, "fam1{gatewayID=\"gw1\"} 1 1000\nfam1{gatewayID=\"gw1\"} 1 2000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp, err = receiveString(hub, "fam1{gatewayID=\"gw1\"} 1 3000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, 2, hub.Status().Datapoints)
+}
+
+func TestSetLabelQuotas(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithLabelQuotas([]LabelQuota{{Label: "gatewayID", Value: "gw1", Datapoints: 2, Tier: QuotaTierReject}}))
+	hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 2, gatewayLabels("gw1"), timestamp)})
+
+	assert.Error(t, hub.SetLabelQuotas([]LabelQuota{{Label: "gatewayID", Value: "gw1", Datapoints: 2, Tier: "block"}}))
+	assert.NoError(t, hub.SetLabelQuotas([]LabelQuota{{Label: "gatewayID", Value: "gw1", Datapoints: 3, Tier: QuotaTierReject}}))
+	assert.Equal(t, []LabelQuota{{Label: "gatewayID", Value: "gw1", Datapoints: 3, Tier: QuotaTierReject}}, hub.LabelQuotas())
+
+	// usage carries over
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam2", 2, gatewayLabels("gw1"), timestamp)})
+	assert.Equal(t, 0, result.AcceptedDatapoints)
+	result = hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam2", 1, gatewayLabels("gw1"), timestamp)})
+	assert.Equal(t, 1, result.AcceptedDatapoints)
+}
+
+func TestLabelQuotasAPI(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	e := echo.New()
+
+	body, _ := json.Marshal([]LabelQuota{{Label: "gatewayID", Value: "gw1", Datapoints: 100, Tier: QuotaTierThrottle}})
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/quotas", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.PutLabelQuotas(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/quotas", nil)
+	rec = httptest.NewRecorder()
+	assert.NoError(t, hub.GetLabelQuotas(e.NewContext(req, rec)))
+	var quotas []LabelQuota
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &quotas))
+	assert.Equal(t, []LabelQuota{{Label: "gatewayID", Value: "gw1", Datapoints: 100, Tier: QuotaTierThrottle}}, quotas)
+
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/quotas", bytes.NewBufferString(`[{"value": "gw1", "datapoints": 1, "tier": "warn"}]`))
+	rec = httptest.NewRecorder()
+	assert.NoError(t, hub.PutLabelQuotas(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestLoadLabelQuotas(t *testing.T) {
+	file, err := ioutil.TempFile("", "quotas")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(`[{"label": "gatewayID", "value": "gw42", "datapoints": 50000, "tier": "warn"}]`)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	quotas, err := LoadLabelQuotas(file.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, []LabelQuota{{Label: "gatewayID", Value: "gw42", Datapoints: 50000, Tier: QuotaTierWarn}}, quotas)
+
+	_, err = LoadLabelQuotas(file.Name() + ".missing")
+	assert.Error(t, err)
+}
+
+func gatewayLabels(gatewayID string) []*dto.LabelPair {
+	return []*dto.LabelPair{{Name: proto.String("gatewayID"), Value: proto.String(gatewayID)}}
+}
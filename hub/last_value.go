@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+var (
+	lastValueSeries        = prometheus.NewGauge(prometheus.GaugeOpts{Name: "last_value_series", Help: "Number of series in the last-value cache"})
+	lastValueSeriesDropped = prometheus.NewCounter(prometheus.CounterOpts{Name: "last_value_series_dropped_total", Help: "Number of new series not kept in the last-value cache because it was full"})
+)
+
+func init() {
+	prometheus.MustRegister(lastValueSeries, lastValueSeriesDropped)
+}
+
+// WithLastValues keeps the newest datapoint of every series stored in the
+// hub, in addition to the consume-once queues. It is served by
+// GET /metrics/current, so local tooling can read the current state of a
+// device even right after a scrape emptied the queues. At most maxSeries
+// series are kept; values <= 0 disable the cache.
+func WithLastValues(maxSeries int) Option {
+	return func(hub *MetricHub) {
+		if maxSeries <= 0 {
+			hub.lastValues = nil
+			return
+		}
+		hub.lastValues = &lastValues{
+			maxSeries: maxSeries,
+			families:  make(map[string]*lastValueFamily),
+		}
+	}
+}
+
+// lastValues is the newest datapoint of each series
+type lastValues struct {
+	sync.Mutex
+	maxSeries int
+	numSeries int
+	families  map[string]*lastValueFamily
+}
+
+type lastValueFamily struct {
+	help   string
+	typ    dto.MetricType
+	series map[string]*lastValue
+}
+
+type lastValue struct {
+	labels []*dto.LabelPair
+	sample sample
+}
+
+// record keeps the datapoints of family that are newer than the last value of
+// their series. Datapoints without a timestamp are always newer.
+func (l *lastValues) record(family *dto.MetricFamily) {
+	l.Lock()
+	defer l.Unlock()
+	fam, ok := l.families[family.GetName()]
+	if !ok {
+		fam = &lastValueFamily{help: family.GetHelp(), typ: family.GetType(), series: make(map[string]*lastValue)}
+		l.families[family.GetName()] = fam
+	}
+	for _, metric := range family.Metric {
+		s := newSample(metric)
+		if s.kind == sampleNone {
+			continue
+		}
+		name := makeLabeledName(metric, family.GetName())
+		last, ok := fam.series[name]
+		if !ok {
+			if l.numSeries >= l.maxSeries {
+				lastValueSeriesDropped.Inc()
+				continue
+			}
+			fam.series[name] = &lastValue{labels: sortedLabels(metric.Label), sample: s}
+			l.numSeries++
+			continue
+		}
+		switch {
+		case last.sample.mergeable(s):
+			// the rest of the buckets or quantiles of the last value
+			last.sample.merge(s)
+		case !s.hasTimestamp || !last.sample.hasTimestamp || s.timestampMs >= last.sample.timestampMs:
+			last.sample = s
+		}
+	}
+	if len(fam.series) == 0 {
+		delete(l.families, family.GetName())
+	}
+	lastValueSeries.Set(float64(l.numSeries))
+}
+
+// export returns the last values of families matching name, or of every
+// family if name is empty, sorted by family and series name
+func (l *lastValues) export(name string) []*dto.MetricFamily {
+	l.Lock()
+	defer l.Unlock()
+	var families []*dto.MetricFamily
+	for familyName, fam := range l.families {
+		if name != "" && familyName != name {
+			continue
+		}
+		seriesNames := make([]string, 0, len(fam.series))
+		for seriesName := range fam.series {
+			seriesNames = append(seriesNames, seriesName)
+		}
+		sort.Strings(seriesNames)
+
+		family := &dto.MetricFamily{Name: proto.String(familyName), Type: fam.typ.Enum()}
+		if fam.help != "" {
+			family.Help = proto.String(fam.help)
+		}
+		for _, seriesName := range seriesNames {
+			last := fam.series[seriesName]
+			family.Metric = append(family.Metric, last.sample.metric(last.labels))
+		}
+		families = append(families, family)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].GetName() < families[j].GetName()
+	})
+	return families
+}
+
+// CurrentValues is a handler function returning the newest datapoint of every
+// series pushed to the hub in text exposition format, without consuming any
+// datapoints. The name parameter selects a single family.
+func (c *MetricHub) CurrentValues(ctx echo.Context) error {
+	if c.lastValues == nil {
+		return respondError(ctx, http.StatusNotFound, ErrorCodeNotFound, nil, "the last-value cache is not enabled on this hub")
+	}
+	var buf bytes.Buffer
+	for _, family := range c.lastValues.export(ctx.QueryParam("name")) {
+		if _, err := expfmt.MetricFamilyToText(&buf, family); err != nil {
+			return respondError(ctx, http.StatusInternalServerError, ErrorCodeInternal, nil, "%v", err)
+		}
+	}
+	return ctx.Blob(http.StatusOK, string(expfmt.FmtText), buf.Bytes())
+}
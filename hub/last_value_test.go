@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLastValuesKeepNewest(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithLastValues(10))
+	hub.ReceiveGRPC([]*dto.MetricFamily{gaugeFamily("temp", gaugeAt(1, 1000), gaugeAt(3, 3000))})
+	// an older datapoint doesn't replace the last value
+	hub.ReceiveGRPC([]*dto.MetricFamily{gaugeFamily("temp", gaugeAt(2, 2000))})
+
+	families := hub.lastValues.export("")
+	assert.Equal(t, 1, len(families))
+	assert.Equal(t, 1, len(families[0].Metric))
+	assert.Equal(t, 3.0, families[0].Metric[0].GetGauge().GetValue())
+	assert.Equal(t, int64(3000), families[0].Metric[0].GetTimestampMs())
+
+	hub.ReceiveGRPC([]*dto.MetricFamily{gaugeFamily("temp", gaugeAt(4, 4000))})
+	assert.Equal(t, 4.0, hub.lastValues.export("temp")[0].Metric[0].GetGauge().GetValue())
+}
+
+func TestLastValuesMaxSeries(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithLastValues(1))
+	hub.ReceiveGRPC([]*dto.MetricFamily{gaugeFamily("a", gaugeAt(1, 1000))})
+	hub.ReceiveGRPC([]*dto.MetricFamily{gaugeFamily("b", gaugeAt(1, 1000))})
+	families := hub.lastValues.export("")
+	assert.Equal(t, 1, len(families))
+	assert.Equal(t, "a", families[0].GetName())
+}
+
+func TestCurrentValuesEndpoint(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithLastValues(10))
+	_, err := receiveString(hub, "# TYPE temp gauge\ntemp{gatewayID=\"gw1\"} 21.5 1000\ntemp{gatewayID=\"gw1\"} 22 2000\nother 1\n")
+	assert.NoError(t, err)
+	// scraping consumes the queues but not the last values
+	scrape(t, hub)
+	assert.Equal(t, "", scrape(t, hub))
+
+	rec := currentValues(t, hub, "/metrics/current?name=temp")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "# TYPE temp gauge\ntemp{gatewayID=\"gw1\"} 22 2000\n", rec.Body.String())
+
+	rec = currentValues(t, hub, "/metrics/current")
+	assert.Equal(t, "# TYPE other untyped\nother 1\n# TYPE temp gauge\ntemp{gatewayID=\"gw1\"} 22 2000\n", rec.Body.String())
+}
+
+func TestCurrentValuesEndpointDisabled(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	rec := currentValues(t, hub, "/metrics/current")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func currentValues(t *testing.T, hub *MetricHub, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.CurrentValues(echo.New().NewContext(req, rec)))
+	return rec
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// LimitPolicy decides what happens to a push that would exceed the hub limit
+type LimitPolicy string
+
+const (
+	// LimitPolicyReject rejects the whole push
+	LimitPolicyReject LimitPolicy = "reject"
+	// LimitPolicyPartial stores the push up to the limit and drops the rest
+	LimitPolicyPartial LimitPolicy = "partial"
+	// LimitPolicyDropOldest evicts the oldest buffered datapoints to make room
+	// for the push
+	LimitPolicyDropOldest LimitPolicy = "drop-oldest"
+
+	// DroppedDatapointsHeader is set on responses to HTTP pushes that were
+	// only partially stored because of the hub limit, to the number of
+	// datapoints dropped
+	DroppedDatapointsHeader = "X-Edge-Hub-Dropped-Datapoints"
+)
+
+var (
+	limitDroppedDatapoints = prometheus.NewCounter(prometheus.CounterOpts{Name: "limit_dropped_datapoints_total", Help: "Number of pushed datapoints dropped by partially accepting pushes over the hub limit"})
+	limitEvictedDatapoints = prometheus.NewCounter(prometheus.CounterOpts{Name: "limit_evicted_datapoints_total", Help: "Number of buffered datapoints evicted to make room for pushes over the hub limit"})
+)
+
+func init() {
+	prometheus.MustRegister(limitDroppedDatapoints, limitEvictedDatapoints)
+}
+
+// ParseLimitPolicy returns the limit policy named by policy
+func ParseLimitPolicy(policy string) (LimitPolicy, error) {
+	switch p := LimitPolicy(policy); p {
+	case LimitPolicyReject, LimitPolicyPartial, LimitPolicyDropOldest:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid limit policy %q, must be partial, reject or drop-oldest", policy)
+}
+
+// WithLimitPolicy sets what happens to pushes that would exceed the hub limit.
+// By default they are rejected whole, which makes clients resend the same
+// oversized push forever. With LimitPolicyPartial the datapoints up to the
+// limit are stored and the rest dropped. With LimitPolicyDropOldest the
+// datapoints with the oldest timestamps are evicted from the hub to make
+// room, and only a push larger than the room that can be freed is partially
+// stored.
+func WithLimitPolicy(policy LimitPolicy) Option {
+	return func(hub *MetricHub) {
+		hub.limitPolicy = policy
+	}
+}
+
+// makeRoom applies the limit policy to a push of families with datapoints
+// that would exceed the hub limit. It returns the number of pushed datapoints
+// dropped, or an error if the push should be rejected whole. Must be called
+// with the hub lock held.
+func (c *MetricHub) makeRoom(families []*dto.MetricFamily, datapoints int) (int, error) {
+	over := c.liveDatapoints() + datapoints - c.limit
+	switch c.limitPolicy {
+	case LimitPolicyPartial:
+	case LimitPolicyDropOldest:
+		evicted := c.evictOldest(over)
+		limitEvictedDatapoints.Add(float64(evicted))
+		logging.Warn("Evicted datapoints to make room for push", "evicted", evicted, "datapoints", datapoints)
+		over -= evicted
+	default:
+		return 0, fmt.Errorf("Not accepting push of size %d. Would overfill hub limit of %d. Current hub size: %d\n", datapoints, c.limit, c.stats.currentCountDatapoints)
+	}
+	if over <= 0 {
+		return 0, nil
+	}
+	dropped := truncateFamilies(families, datapoints-over)
+	limitDroppedDatapoints.Add(float64(dropped))
+	logging.Warn("Dropped datapoints of push over hub limit", "dropped", dropped, "datapoints", datapoints, "limit", c.limit)
+	return dropped, nil
+}
+
+// truncateFamilies drops the datapoints of families after the first keep, in
+// order of family name, and returns the number dropped
+func truncateFamilies(families []*dto.MetricFamily, keep int) int {
+	if keep < 0 {
+		keep = 0
+	}
+	sorted := make([]*dto.MetricFamily, len(families))
+	copy(sorted, families)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].GetName() < sorted[j].GetName() })
+
+	dropped := 0
+	for _, fam := range sorted {
+		if keep >= len(fam.Metric) {
+			keep -= len(fam.Metric)
+			continue
+		}
+		dropped += len(fam.Metric) - keep
+		fam.Metric = fam.Metric[:keep]
+		keep = 0
+	}
+	return dropped
+}
+
+// evictOldest removes up to n of the buffered datapoints with the oldest
+// timestamps, and returns the number removed. Datapoints not stored yet, such
+// as those in the ingest queue, can't be evicted. Imported datapoints aren't
+// evicted either, since they don't count against the hub limit. Must be called
+// with the hub lock held.
+func (c *MetricHub) evictOldest(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	var timestamps []int64
+	for _, family := range c.metricFamiliesByName {
+		for _, queue := range family.metrics {
+			for _, s := range queue.samples {
+				if !s.imported {
+					timestamps = append(timestamps, s.timestampMs)
+				}
+			}
+		}
+	}
+	if len(timestamps) == 0 {
+		return 0
+	}
+	if n > len(timestamps) {
+		n = len(timestamps)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	cutoff := timestamps[n-1]
+
+	// datapoints older than the cutoff are all evicted, those at the cutoff
+	// only until n are
+	atCutoff := 0
+	for _, ts := range timestamps[:n] {
+		if ts == cutoff {
+			atCutoff++
+		}
+	}
+	evicted, evictedSeries := 0, 0
+	for name, family := range c.metricFamiliesByName {
+		for labeledName, queue := range family.metrics {
+			kept := queue.samples[:0:0]
+			for i, s := range queue.samples {
+				if s.timestampMs > cutoff || (s.timestampMs == cutoff && atCutoff == 0) {
+					kept = append(kept, queue.samples[i:]...)
+					break
+				}
+				if s.imported {
+					kept = append(kept, s)
+					continue
+				}
+				if s.timestampMs == cutoff {
+					atCutoff--
+				}
+				evicted++
+			}
+			if len(kept) == len(queue.samples) {
+				continue
+			}
+			if len(kept) == 0 {
+				delete(family.metrics, labeledName)
+				evictedSeries++
+				continue
+			}
+			queue.samples = kept
+		}
+		if len(family.metrics) == 0 {
+			delete(c.metricFamiliesByName, name)
+			c.stats.currentCountFamilies--
+		}
+	}
+
+	c.stats.currentCountSeries -= evictedSeries
+	c.stats.currentCountDatapoints -= evicted
+	hubSize.Set(float64(c.stats.currentCountDatapoints))
+	return evicted
+}
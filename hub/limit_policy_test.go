@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLimitPolicy(t *testing.T) {
+	policy, err := ParseLimitPolicy("drop-oldest")
+	assert.NoError(t, err)
+	assert.Equal(t, LimitPolicyDropOldest, policy)
+	_, err = ParseLimitPolicy("drop-newest")
+	assert.Error(t, err)
+}
+
+func TestLimitPolicyReject(t *testing.T) {
+	hub := NewMetricHub(3, 10, WithLimitPolicy(LimitPolicyReject))
+
+	resp, err := receiveString(hub, "a 1 1000\nb 1 1000\nc 1 1000\nd 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotAcceptable, resp.Code)
+	assert.Equal(t, 0, hub.Status().Datapoints)
+}
+
+func TestLimitPolicyPartial(t *testing.T) {
+	hub := NewMetricHub(3, 10, WithLimitPolicy(LimitPolicyPartial))
+	dropped := testutil.ToFloat64(limitDroppedDatapoints)
+
+	resp, err := receiveString(hub, "a 1 1000\nb 1 1000\nb 2 2000\nc 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, resp.Code)
+	assert.Equal(t, "1", resp.Header().Get(DroppedDatapointsHeader))
+	scraped := scrape(t, hub)
+	assert.Contains(t, scraped, "a 1 1000\n")
+	assert.Contains(t, scraped, "b 1 1000\nb 2 2000\n")
+	assert.NotContains(t, scraped, "c 1 1000\n")
+	assert.Equal(t, dropped+1, testutil.ToFloat64(limitDroppedDatapoints))
+
+	hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 2, nil, timestamp)})
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam2", 2, nil, timestamp)})
+	assert.Equal(t, 1, result.AcceptedDatapoints)
+	assert.Equal(t, 1, result.RejectedDatapoints)
+	assert.Equal(t, []RejectReason{RejectLimitExceeded}, result.Reasons)
+	assert.Equal(t, 3, hub.Status().Datapoints)
+	assert.Contains(t, hub.Capabilities().Features, FeaturePartialAccept)
+}
+
+func TestLimitPolicyDropOldest(t *testing.T) {
+	hub := NewMetricHub(3, 10, WithLimitPolicy(LimitPolicyDropOldest))
+	evicted := testutil.ToFloat64(limitEvictedDatapoints)
+
+	resp, err := receiveString(hub, "a 1 1000\na 2 3000\nb 1 2000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp, err = receiveString(hub, "c 1 4000\nc 2 5000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	scraped := scrape(t, hub)
+	assert.Contains(t, scraped, "# TYPE a untyped\na 2 3000\n")
+	assert.Contains(t, scraped, "c 1 4000\nc 2 5000\n")
+	assert.NotContains(t, scraped, "b 1 2000\n")
+	assert.Equal(t, evicted+2, testutil.ToFloat64(limitEvictedDatapoints))
+
+	// a push larger than the limit is partially stored
+	resp, err = receiveString(hub, "d 1 1000\nd 2 2000\nd 3 3000\nd 4 4000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, resp.Code)
+	assert.Equal(t, "1", resp.Header().Get(DroppedDatapointsHeader))
+	assert.Equal(t, 3, hub.Status().Datapoints)
+}
+
+func TestEvictOldestAtSameTimestamp(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, "a 1 1000\nb 1 1000\nc 1 1000\nc 2 2000\n")
+	assert.NoError(t, err)
+
+	hub.Lock()
+	assert.Equal(t, 2, hub.evictOldest(2))
+	hub.Unlock()
+	status := hub.Status()
+	assert.Equal(t, 2, status.Datapoints)
+	assert.Contains(t, scrape(t, hub), "c 2 2000\n")
+}
+
+func TestEvictOldestSkipsImported(t *testing.T) {
+	hub := NewMetricHub(3, 10, WithLimitPolicy(LimitPolicyDropOldest))
+	rec := importBody(hub, strings.NewReader("old 1 500\nold 2 600\n"), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	_, err := receiveString(hub, "a 1 1000\nb 1 2000\nc 1 3000\n")
+	assert.NoError(t, err)
+	resp, err := receiveString(hub, "d 1 4000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// the older imported datapoints are kept and still counted as imported
+	assert.Equal(t, 5, hub.Status().Datapoints)
+	assert.Equal(t, 2, hub.stats.currentCountImportedDatapoints)
+	scraped := scrape(t, hub)
+	assert.Contains(t, scraped, "old 1 500\nold 2 600\n")
+	assert.NotContains(t, scraped, "a 1 1000\n")
+}
+
+func TestReceiveBatchPartial(t *testing.T) {
+	hub := NewMetricHub(2, 10, WithLimitPolicy(LimitPolicyPartial))
+	rec := receiveBatch(t, hub, []testPart{
+		{body: "a 1 1000\n"},
+		{body: "b 1 1000\nb 2 2000\n"},
+	})
+	assert.Equal(t, http.StatusMultiStatus, rec.Code)
+	assert.Contains(t, rec.Body.String(), `{"part":1,"status":206,"datapoints":1,"dropped":1}`)
+	assert.Equal(t, 2, hub.Status().Datapoints)
+}
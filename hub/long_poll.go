@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultScrapeMaxWait is the longest a scrape may wait for datapoints unless
+// set with WithScrapeMaxWait
+const DefaultScrapeMaxWait = time.Minute
+
+var (
+	scrapeLongPolls   = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "scrape_long_polls_total", Help: "Number of scrapes that waited for datapoints, by outcome: ready, timeout or canceled"}, []string{"outcome"})
+	scrapeLongPolling = prometheus.NewGauge(prometheus.GaugeOpts{Name: "scrape_long_polls_waiting", Help: "Number of scrapes currently waiting for datapoints"})
+)
+
+func init() {
+	prometheus.MustRegister(scrapeLongPolls, scrapeLongPolling)
+}
+
+// WithScrapeMaxWait caps the wait of scrapes waiting for datapoints with
+// ?wait= to maxWait. 0 refuses such scrapes.
+func WithScrapeMaxWait(maxWait time.Duration) Option {
+	return func(hub *MetricHub) {
+		hub.scrapeMaxWait = maxWait
+	}
+}
+
+// parseWait parses the wait and min_datapoints params of a scrape. wait is
+// capped at maxWait, and min_datapoints defaults to 1.
+func parseWait(wait, minDatapoints string, maxWait time.Duration) (time.Duration, int, error) {
+	if wait == "" {
+		if minDatapoints != "" {
+			return 0, 0, fmt.Errorf("min_datapoints requires wait")
+		}
+		return 0, 0, nil
+	}
+	if maxWait <= 0 {
+		return 0, 0, fmt.Errorf("waiting scrapes are disabled")
+	}
+	d, err := time.ParseDuration(wait)
+	if err != nil || d < 0 {
+		return 0, 0, fmt.Errorf("invalid wait %q: must be a non-negative duration such as 30s", wait)
+	}
+	if d > maxWait {
+		d = maxWait
+	}
+	n := 1
+	if minDatapoints != "" {
+		n, err = strconv.Atoi(minDatapoints)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid min_datapoints %q: must be a positive integer", minDatapoints)
+		}
+	}
+	return d, n, nil
+}
+
+// waitForDatapoints blocks until at least n datapoints are buffered, wait
+// elapses on the hub clock or ctx is done, and returns whether there are n
+// datapoints. It returns false right away if wait is 0.
+func (c *MetricHub) waitForDatapoints(ctx context.Context, n int, wait time.Duration) bool {
+	if wait <= 0 {
+		return false
+	}
+	scrapeLongPolling.Inc()
+	defer scrapeLongPolling.Dec()
+	timeout, stop := c.clock.NewTicker(wait)
+	defer stop()
+	for {
+		c.Lock()
+		if c.stats.currentCountDatapoints >= n {
+			c.Unlock()
+			scrapeLongPolls.WithLabelValues("ready").Inc()
+			return true
+		}
+		if c.stored == nil {
+			c.stored = make(chan struct{})
+		}
+		stored := c.stored
+		c.Unlock()
+
+		select {
+		case <-stored:
+		case <-timeout:
+			scrapeLongPolls.WithLabelValues("timeout").Inc()
+			return false
+		case <-ctx.Done():
+			scrapeLongPolls.WithLabelValues("canceled").Inc()
+			return false
+		}
+	}
+}
+
+// notifyStored wakes up scrapes waiting for datapoints. Must be called with
+// the hub lock held.
+func (c *MetricHub) notifyStored() {
+	if c.stored != nil {
+		close(c.stored)
+		c.stored = nil
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/hub/hubtest"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+// startWaitingScrape scrapes hub with the query in the background, and waits
+// for the scrape to start waiting on clock
+func startWaitingScrape(t *testing.T, hub *MetricHub, clock *hubtest.FakeClock, query string) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		assert.NoError(t, hub.Scrape(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/metrics?"+query, nil), rec)))
+		done <- rec
+	}()
+	assert.Eventually(t, func() bool { return clock.Tickers() == 1 }, time.Second, time.Millisecond)
+	return done
+}
+
+func TestScrapeWaitReturnsOnPush(t *testing.T) {
+	clock := hubtest.NewFakeClock(fakeStart)
+	hub := NewMetricHub(0, 10, WithClock(clock))
+	done := startWaitingScrape(t, hub, clock, "wait=30s&min_datapoints=2")
+
+	_, err := receiveString(hub, "# TYPE up gauge\nup{gw=\"a\"} 1 1000\n")
+	assert.NoError(t, err)
+	assert.Never(t, func() bool { return len(done) > 0 }, 50*time.Millisecond, time.Millisecond)
+
+	_, err = receiveString(hub, "# TYPE up gauge\nup{gw=\"b\"} 1 1000\n")
+	assert.NoError(t, err)
+	select {
+	case rec := <-done:
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `up{gw="a"} 1 1000`)
+		assert.Contains(t, rec.Body.String(), `up{gw="b"} 1 1000`)
+	case <-time.After(time.Second):
+		t.Fatal("scrape still waiting after enough datapoints were pushed")
+	}
+}
+
+func TestScrapeWaitTimeout(t *testing.T) {
+	clock := hubtest.NewFakeClock(fakeStart)
+	hub := NewMetricHub(0, 10, WithClock(clock), WithScrapeMaxWait(10*time.Second))
+	// wait is capped at the max wait
+	done := startWaitingScrape(t, hub, clock, "wait=1h")
+
+	clock.Advance(9 * time.Second)
+	assert.Never(t, func() bool { return len(done) > 0 }, 50*time.Millisecond, time.Millisecond)
+	clock.Advance(time.Second)
+	select {
+	case rec := <-done:
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Body.String())
+	case <-time.After(time.Second):
+		t.Fatal("scrape still waiting after the max wait")
+	}
+}
+
+func TestParseWait(t *testing.T) {
+	wait, n, err := parseWait("", "", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+
+	wait, n, err = parseWait("30s", "", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, wait)
+	assert.Equal(t, 1, n)
+
+	for _, params := range [][2]string{{"", "5"}, {"soon", ""}, {"-1s", ""}, {"30s", "0"}, {"30s", "x"}} {
+		_, _, err := parseWait(params[0], params[1], time.Minute)
+		assert.Error(t, err, params)
+	}
+	_, _, err = parseWait("30s", "", 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// unlimitedMemoryMax is the cgroup v2 memory.max of an unlimited cgroup
+	unlimitedMemoryMax = "max"
+	// unlimitedMemoryThreshold is above any real memory limit. cgroup v1
+	// reports no limit as the largest int64 rounded down to the page size,
+	// which differs between architectures.
+	unlimitedMemoryThreshold = 1 << 62
+	// addressSpaceLimit32 is the most memory a 32-bit process can reliably
+	// use, as the kernel reserves part of the 4 GiB address space
+	addressSpaceLimit32 = 2 << 30
+	// autoMemoryLimitPercent is the share of the cgroup memory limit used
+	// as soft memory limit, leaving room for memory not managed by the Go
+	// runtime
+	autoMemoryLimitPercent = 90
+)
+
+var (
+	cgroupMemoryLimitBytes = prometheus.NewGauge(prometheus.GaugeOpts{Name: "cgroup_memory_limit_bytes", Help: "Memory limit of the hub's cgroup, 0 if unlimited"})
+
+	errNoMemoryLimit = errors.New("no cgroup memory limit")
+)
+
+func init() {
+	prometheus.MustRegister(cgroupMemoryLimitBytes)
+}
+
+// AutoMemoryLimit returns a soft memory limit for the runtime of 90% of the
+// memory limit of the cgroup the hub runs in, so the GC collects harder
+// before the container is OOM killed, or limit if that is lower and > 0. On
+// 32-bit platforms, such as older ARM devices, the result is also capped to
+// what the address space can hold.
+func AutoMemoryLimit(limit int64) int64 {
+	cgroupLimit, err := memoryMax()
+	if err == nil {
+		cgroupMemoryLimitBytes.Set(float64(cgroupLimit))
+		if auto := cgroupLimit / 100 * autoMemoryLimitPercent; limit <= 0 || auto < limit {
+			limit = auto
+		}
+	}
+	if unsafe.Sizeof(uintptr(0)) == 4 && (limit <= 0 || limit > addressSpaceLimit32) {
+		limit = addressSpaceLimit32
+	}
+	return limit
+}
+
+// memoryMax returns the memory limit in bytes of the current cgroup, trying
+// the cgroup v2 interface first and then v1
+func memoryMax() (int64, error) {
+	if data, err := ioutil.ReadFile(filepath.Join(cgroupFSRoot, "memory.max")); err == nil {
+		return parseMemoryMax(string(data))
+	}
+	data, err := ioutil.ReadFile(filepath.Join(cgroupFSRoot, "memory", "memory.limit_in_bytes"))
+	if err != nil {
+		return 0, errNoMemoryLimit
+	}
+	return parseMemoryMax(string(data))
+}
+
+// parseMemoryMax parses a cgroup v2 memory.max or a cgroup v1
+// memory.limit_in_bytes
+func parseMemoryMax(memoryMax string) (int64, error) {
+	memoryMax = strings.TrimSpace(memoryMax)
+	if memoryMax == unlimitedMemoryMax {
+		return 0, errNoMemoryLimit
+	}
+	limit, err := strconv.ParseInt(memoryMax, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory limit %q: %v", memoryMax, err)
+	}
+	if limit <= 0 || limit >= unlimitedMemoryThreshold {
+		return 0, errNoMemoryLimit
+	}
+	return limit, nil
+}
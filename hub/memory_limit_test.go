@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMemoryMax(t *testing.T) {
+	limit, err := parseMemoryMax("67108864\n")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(64<<20), limit)
+
+	_, err = parseMemoryMax("max\n")
+	assert.Equal(t, errNoMemoryLimit, err)
+	// cgroup v1 without a limit on 4K and 64K page architectures
+	_, err = parseMemoryMax("9223372036854771712\n")
+	assert.Equal(t, errNoMemoryLimit, err)
+	_, err = parseMemoryMax("9223372036854710272\n")
+	assert.Equal(t, errNoMemoryLimit, err)
+	_, err = parseMemoryMax("garbage")
+	assert.Error(t, err)
+}
+
+func TestAutoMemoryLimit(t *testing.T) {
+	if unsafe.Sizeof(uintptr(0)) == 4 {
+		t.Skip("limits are capped on 32-bit platforms")
+	}
+	root, err := ioutil.TempDir("", "cgroup")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	defer func(old string) { cgroupFSRoot = old }(cgroupFSRoot)
+	cgroupFSRoot = root
+
+	// without a cgroup limit, the configured limit is kept
+	assert.Equal(t, int64(0), AutoMemoryLimit(0))
+	assert.Equal(t, int64(1000), AutoMemoryLimit(1000))
+
+	// cgroup v1
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "memory"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "memory", "memory.limit_in_bytes"), []byte("1000000\n"), 0644))
+	assert.Equal(t, int64(900000), AutoMemoryLimit(0))
+
+	// cgroup v2 takes precedence, and a lower configured limit wins
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "memory.max"), []byte("2000000\n"), 0644))
+	assert.Equal(t, int64(1800000), AutoMemoryLimit(0))
+	assert.Equal(t, int64(1800000), AutoMemoryLimit(5000000))
+	assert.Equal(t, int64(1000), AutoMemoryLimit(1000))
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var metricFilterDropped = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "metric_filter_dropped_datapoints_total", Help: "Number of pushed datapoints dropped by the metric allowlist, metric denylist or series denylist, by filter"}, []string{"filter"})
+
+func init() {
+	prometheus.MustRegister(metricFilterDropped)
+}
+
+// WithMetricFilter drops pushed families whose whole name doesn't match allow,
+// if set, or matches deny, if set, such as debug metrics devices push but
+// that are never wanted centrally
+func WithMetricFilter(allow, deny *regexp.Regexp) Option {
+	return func(hub *MetricHub) {
+		if hub.metricFilter == nil {
+			hub.metricFilter = &metricFilter{}
+		}
+		hub.metricFilter.allow = allow
+		hub.metricFilter.deny = deny
+	}
+}
+
+// WithSeriesDenylist drops pushed series matching any of selectors, such as
+// {debug="true"}. It panics on selectors ValidateSelector refuses.
+func WithSeriesDenylist(selectors ...string) Option {
+	return func(hub *MetricHub) {
+		if hub.metricFilter == nil {
+			hub.metricFilter = &metricFilter{}
+		}
+		for _, s := range selectors {
+			sel, err := parseSelector(s)
+			if err != nil {
+				panic(err)
+			}
+			hub.metricFilter.seriesDeny = append(hub.metricFilter.seriesDeny, sel)
+		}
+	}
+}
+
+// ValidateSelector returns an error if s is not a valid series selector, e.g.
+// alarms_total{severity=~"major|critical"}
+func ValidateSelector(s string) error {
+	_, err := parseSelector(s)
+	return err
+}
+
+type metricFilter struct {
+	allow      *regexp.Regexp
+	deny       *regexp.Regexp
+	seriesDeny []*selector
+}
+
+// filterFamily empties family if its name isn't allowed, and otherwise
+// removes its denied series
+func (f *metricFilter) filterFamily(family *dto.MetricFamily) {
+	if len(family.Metric) == 0 {
+		return
+	}
+	if f.allow != nil && !f.allow.MatchString(family.GetName()) {
+		metricFilterDropped.WithLabelValues("allowlist").Add(float64(len(family.Metric)))
+		family.Metric = nil
+		return
+	}
+	if f.deny != nil && f.deny.MatchString(family.GetName()) {
+		metricFilterDropped.WithLabelValues("denylist").Add(float64(len(family.Metric)))
+		family.Metric = nil
+		return
+	}
+	if len(f.seriesDeny) == 0 {
+		return
+	}
+	kept := family.Metric[:0]
+	for _, metric := range family.Metric {
+		if !f.seriesDenied(family.GetName(), metric) {
+			kept = append(kept, metric)
+		}
+	}
+	if dropped := len(family.Metric) - len(kept); dropped > 0 {
+		metricFilterDropped.WithLabelValues("series_denylist").Add(float64(dropped))
+		for i := len(kept); i < len(family.Metric); i++ {
+			family.Metric[i] = nil
+		}
+	}
+	family.Metric = kept
+}
+
+func (f *metricFilter) seriesDenied(family string, metric *dto.Metric) bool {
+	for _, sel := range f.seriesDeny {
+		if sel.matches(family, metric.Label) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricFilter(t *testing.T) {
+	hub := NewMetricHub(0, 10,
+		WithMetricFilter(regexp.MustCompile("^(?:up|debug_.*|rpc_.*)$"), regexp.MustCompile("^(?:debug_.*)$")),
+		WithSeriesDenylist(`{debug="true"}`, `rpc_latency_seconds{method=~"Debug.*"}`),
+	)
+
+	rec, err := receiveString(hub, `# TYPE up gauge
+up{gatewayID="gw1"} 1 1000
+up{gatewayID="gw2",debug="true"} 1 1000
+# TYPE debug_queue_length gauge
+debug_queue_length 3 1000
+# TYPE other gauge
+other 1 1000
+# TYPE rpc_latency_seconds gauge
+rpc_latency_seconds{method="Push"} 0.1 1000
+rpc_latency_seconds{method="DebugDump"} 2 1000
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, rec.Code)
+	assert.ElementsMatch(t, []string{
+		`# TYPE rpc_latency_seconds gauge`,
+		`rpc_latency_seconds{method="Push"} 0.1 1000`,
+		`# TYPE up gauge`,
+		`up{gatewayID="gw1"} 1 1000`,
+	}, scrapedLines(scrape(t, hub)))
+	assert.Contains(t, hub.Capabilities().Features, FeatureMetricFilter)
+	assert.NotContains(t, NewMetricHub(0, 10).Capabilities().Features, FeatureMetricFilter)
+}
+
+func TestValidateSelector(t *testing.T) {
+	assert.NoError(t, ValidateSelector(`{debug="true"}`))
+	assert.NoError(t, ValidateSelector(`up{method!~"Debug.*"}`))
+	assert.Error(t, ValidateSelector(`{debug="true"`))
+	assert.Error(t, ValidateSelector(`{debug=~"("}`))
+	assert.Panics(t, func() { NewMetricHub(0, 10, WithSeriesDenylist(`{debug`)) })
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// parseMinAge parses the min_age scrape parameter, e.g. "30s". An empty
+// parameter means no minimum age.
+func parseMinAge(param string) (time.Duration, error) {
+	if param == "" {
+		return 0, nil
+	}
+	minAge, err := time.ParseDuration(param)
+	if err != nil || minAge < 0 {
+		return 0, fmt.Errorf("invalid min_age %q: must be a non-negative duration such as 30s\n", param)
+	}
+	return minAge, nil
+}
+
+// split removes the datapoints of families in class with timestamps up to
+// cutoffMs from the hub and returns them. Fresher datapoints stay buffered, so
+// delayed pushes of the same batch still get scraped together with it. Must
+// be called with the hub lock held.
+func (c *MetricHub) split(cutoffMs int64, class ScrapeClass) map[string]*familyAndMetrics {
+	scraped := make(map[string]*familyAndMetrics)
+	drainedDatapoints, drainedImported := 0, 0
+	for name, family := range c.metricFamiliesByName {
+		if !c.inScrapeClass(name, class) {
+			continue
+		}
+		old := &familyAndMetrics{
+			family:        family.family,
+			metrics:       make(map[string]*series),
+			bufferedSince: family.bufferedSince,
+		}
+		for seriesName, queue := range family.metrics {
+			// queues are sorted, so the old datapoints are a prefix
+			n := sort.Search(len(queue.samples), func(i int) bool {
+				return queue.samples[i].timestampMs > cutoffMs
+			})
+			if n == 0 {
+				continue
+			}
+			old.metrics[seriesName] = &series{labels: queue.labels, samples: queue.samples[:n]}
+			drainedDatapoints += n
+			drainedImported += countImported(queue.samples[:n])
+			if n == len(queue.samples) {
+				delete(family.metrics, seriesName)
+				c.stats.currentCountSeries--
+			} else {
+				queue.samples = queue.samples[n:]
+			}
+		}
+		if len(old.metrics) > 0 {
+			scraped[name] = old
+		}
+		if len(family.metrics) == 0 {
+			delete(c.metricFamiliesByName, name)
+			c.stats.currentCountFamilies--
+		}
+	}
+
+	c.stats.currentCountDatapoints -= drainedDatapoints
+	c.stats.currentCountImportedDatapoints -= drainedImported
+	hubSize.Set(float64(c.stats.currentCountDatapoints))
+	return scraped
+}
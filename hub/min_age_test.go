@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrapeMinAgeKeepsFreshDatapoints(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	nowMs := time.Now().UnixNano() / int64(time.Millisecond)
+	old, fresh := nowMs-int64(time.Minute/time.Millisecond), nowMs
+	_, err := receiveString(hub, fmt.Sprintf("a 1 %d\na 2 %d\nb 1 %d\nc 1 %d\n", old, fresh, old, fresh))
+	assert.NoError(t, err)
+
+	rec := scrapeURL(t, hub, "/metrics?min_age=30s")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.ElementsMatch(t, []string{"# TYPE a untyped", fmt.Sprintf("a 1 %d", old), "# TYPE b untyped", fmt.Sprintf("b 1 %d", old)}, scrapedLines(rec.Body.String()))
+	assert.Equal(t, 2, hub.stats.currentCountDatapoints)
+	assert.Equal(t, 2, hub.stats.currentCountSeries)
+	assert.Equal(t, 2, hub.stats.currentCountFamilies)
+
+	// a delayed push of the fresh batch merges with it
+	_, err = receiveString(hub, fmt.Sprintf("b 2 %d\n", fresh))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"# TYPE a untyped", fmt.Sprintf("a 2 %d", fresh),
+		"# TYPE b untyped", fmt.Sprintf("b 2 %d", fresh),
+		"# TYPE c untyped", fmt.Sprintf("c 1 %d", fresh),
+	}, scrapedLines(scrape(t, hub)))
+	assert.Equal(t, 0, hub.stats.currentCountDatapoints)
+}
+
+func TestScrapeMinAgeImported(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	nowMs := time.Now().UnixNano() / int64(time.Millisecond)
+	old, fresh := nowMs-int64(time.Minute/time.Millisecond), nowMs
+	rec := importBody(hub, strings.NewReader(fmt.Sprintf("imported 1 %d\nimported 2 %d\n", old, fresh)), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	_, err := receiveString(hub, fmt.Sprintf("live 1 %d\nlive 2 %d\n", old, old))
+	assert.NoError(t, err)
+
+	// only the scraped imported datapoint stops counting against the import
+	// limit
+	assert.Equal(t, http.StatusOK, scrapeURL(t, hub, "/metrics?min_age=30s").Code)
+	assert.Equal(t, 1, hub.stats.currentCountDatapoints)
+	assert.Equal(t, 1, hub.stats.currentCountImportedDatapoints)
+	assert.Equal(t, 0, hub.liveDatapoints())
+}
+
+func TestScrapeMinAgeInvalid(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	assert.Equal(t, http.StatusBadRequest, scrapeURL(t, hub, "/metrics?min_age=soon").Code)
+	assert.Equal(t, http.StatusBadRequest, scrapeURL(t, hub, "/metrics?min_age=-5s").Code)
+}
+
+// scrapedLines splits exposition text into lines, since families are exposed
+// in no particular order
+func scrapedLines(text string) []string {
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
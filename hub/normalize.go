@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var normalizedDatapoints = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "normalized_datapoints_total", Help: "Number of pushed datapoints rewritten by a normalization rule, by pushed family name"}, []string{"family"})
+
+func init() {
+	prometheus.MustRegister(normalizedDatapoints)
+}
+
+// unitFactors are the units a normalization rule can convert between, as
+// multiples of the base unit of their dimension
+var unitFactors = map[string]struct {
+	dimension string
+	factor    float64
+}{
+	"nanoseconds":  {"time", 1e-9},
+	"microseconds": {"time", 1e-6},
+	"milliseconds": {"time", 1e-3},
+	"seconds":      {"time", 1},
+	"minutes":      {"time", 60},
+	"hours":        {"time", 3600},
+	"bits":         {"bytes", 1.0 / 8},
+	"bytes":        {"bytes", 1},
+	"kilobytes":    {"bytes", 1e3},
+	"megabytes":    {"bytes", 1e6},
+	"gigabytes":    {"bytes", 1e9},
+	"kibibytes":    {"bytes", 1 << 10},
+	"mebibytes":    {"bytes", 1 << 20},
+	"gibibytes":    {"bytes", 1 << 30},
+}
+
+// NormalizationRule rewrites a family pushed under a known name, so devices
+// with different firmwares produce consistent series centrally. Values are
+// converted from FromUnit to ToUnit, or multiplied by Scale if no units are
+// given. Name and Help replace the family name and HELP text if set.
+type NormalizationRule struct {
+	Family   string  `json:"family"`
+	Name     string  `json:"name,omitempty"`
+	Help     string  `json:"help,omitempty"`
+	FromUnit string  `json:"from_unit,omitempty"`
+	ToUnit   string  `json:"to_unit,omitempty"`
+	Scale    float64 `json:"scale,omitempty"`
+}
+
+// scale returns the factor values of the family are multiplied by
+func (r NormalizationRule) scale() (float64, error) {
+	if r.FromUnit == "" && r.ToUnit == "" {
+		if r.Scale == 0 {
+			return 1, nil
+		}
+		return r.Scale, nil
+	}
+	if r.Scale != 0 {
+		return 0, fmt.Errorf("rule for %q has both units and a scale", r.Family)
+	}
+	from, ok := unitFactors[r.FromUnit]
+	if !ok {
+		return 0, fmt.Errorf("rule for %q has unknown from_unit %q", r.Family, r.FromUnit)
+	}
+	to, ok := unitFactors[r.ToUnit]
+	if !ok {
+		return 0, fmt.Errorf("rule for %q has unknown to_unit %q", r.Family, r.ToUnit)
+	}
+	if from.dimension != to.dimension {
+		return 0, fmt.Errorf("rule for %q can't convert %s to %s", r.Family, r.FromUnit, r.ToUnit)
+	}
+	return from.factor / to.factor, nil
+}
+
+// LoadNormalizationRules reads a JSON list of normalization rules from path
+func LoadNormalizationRules(path string) ([]NormalizationRule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []NormalizationRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("error parsing normalization rules: %v", err)
+	}
+	seen := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if rule.Family == "" {
+			return nil, fmt.Errorf("normalization rule without a family")
+		}
+		if seen[rule.Family] {
+			return nil, fmt.Errorf("several normalization rules for %q", rule.Family)
+		}
+		seen[rule.Family] = true
+		if _, err := rule.scale(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// WithNormalizationRules rewrites the name, HELP text and values of pushed
+// families with a rule for their name. Rules apply to names after
+// sanitizing.
+func WithNormalizationRules(rules []NormalizationRule) Option {
+	return func(hub *MetricHub) {
+		n := &normalizer{rules: make(map[string]normalization, len(rules))}
+		for _, rule := range rules {
+			// validated by LoadNormalizationRules
+			scale, _ := rule.scale()
+			n.rules[rule.Family] = normalization{rule: rule, scale: scale}
+		}
+		hub.normalizer = n
+	}
+}
+
+type normalizer struct {
+	rules map[string]normalization
+}
+
+type normalization struct {
+	rule  NormalizationRule
+	scale float64
+}
+
+// normalizeFamily applies the rule for the name of family to it in place
+func (n *normalizer) normalizeFamily(family *dto.MetricFamily) {
+	norm, ok := n.rules[family.GetName()]
+	if !ok {
+		return
+	}
+	normalizedDatapoints.WithLabelValues(family.GetName()).Add(float64(len(family.Metric)))
+	if norm.rule.Name != "" {
+		family.Name = proto.String(norm.rule.Name)
+	}
+	if norm.rule.Help != "" {
+		family.Help = proto.String(norm.rule.Help)
+	}
+	if norm.scale == 1 {
+		return
+	}
+	for _, metric := range family.Metric {
+		scaleMetric(metric, norm.scale)
+	}
+}
+
+// scaleMetric multiplies the values of metric by scale. Quantile values,
+// bucket bounds and sums are scaled along with the observations, while
+// quantile levels and counts are left as they are.
+func scaleMetric(metric *dto.Metric, scale float64) {
+	scaleValue := func(value *float64) *float64 {
+		if value == nil {
+			return nil
+		}
+		return proto.Float64(*value * scale)
+	}
+	scaleExemplar := func(exemplar *dto.Exemplar) {
+		if exemplar != nil {
+			exemplar.Value = scaleValue(exemplar.Value)
+		}
+	}
+	switch {
+	case metric.Counter != nil:
+		metric.Counter.Value = scaleValue(metric.Counter.Value)
+		scaleExemplar(metric.Counter.Exemplar)
+	case metric.Gauge != nil:
+		metric.Gauge.Value = scaleValue(metric.Gauge.Value)
+	case metric.Untyped != nil:
+		metric.Untyped.Value = scaleValue(metric.Untyped.Value)
+	case metric.Summary != nil:
+		metric.Summary.SampleSum = scaleValue(metric.Summary.SampleSum)
+		for _, quantile := range metric.Summary.Quantile {
+			quantile.Value = scaleValue(quantile.Value)
+		}
+	case metric.Histogram != nil:
+		metric.Histogram.SampleSum = scaleValue(metric.Histogram.SampleSum)
+		for _, bucket := range metric.Histogram.Bucket {
+			bucket.UpperBound = scaleValue(bucket.UpperBound)
+			scaleExemplar(bucket.Exemplar)
+		}
+	}
+}
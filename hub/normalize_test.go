@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadNormalizationRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "normalize")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	load := func(rules string) error {
+		path := filepath.Join(dir, "rules.json")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(rules), 0644))
+		_, err := LoadNormalizationRules(path)
+		return err
+	}
+
+	assert.NoError(t, load(`[{"family": "latency_ms", "from_unit": "milliseconds", "to_unit": "seconds"}]`))
+	assert.Error(t, load(`[{"name": "latency_seconds"}]`))
+	assert.Error(t, load(`[{"family": "a", "scale": 2}, {"family": "a", "scale": 3}]`))
+	assert.Error(t, load(`[{"family": "latency_ms", "from_unit": "milliseconds", "to_unit": "bytes"}]`))
+	assert.Error(t, load(`[{"family": "latency_ms", "from_unit": "fortnights", "to_unit": "seconds"}]`))
+	assert.Error(t, load(`[{"family": "latency_ms", "from_unit": "milliseconds", "to_unit": "seconds", "scale": 2}]`))
+}
+
+func TestNormalizeFamilies(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithNormalizationRules([]NormalizationRule{
+		{Family: "latency_ms", Name: "latency_seconds", Help: "Latency of requests", FromUnit: "milliseconds", ToUnit: "seconds"},
+		{Family: "size_kib", Scale: 1024},
+	}))
+
+	_, err := receiveString(hub, `# HELP latency_ms Latency in ms
+# TYPE latency_ms histogram
+latency_ms_bucket{le="100"} 1 1000
+latency_ms_bucket{le="+Inf"} 2 1000
+latency_ms_sum 1500 1000
+latency_ms_count 2 1000
+size_kib 2 1000
+other 2 1000
+`)
+	assert.NoError(t, err)
+	scraped := scrape(t, hub)
+	assert.Contains(t, scraped, `# HELP latency_seconds Latency of requests
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1 1000
+latency_seconds_bucket{le="+Inf"} 2 1000
+latency_seconds_sum 1.5 1000
+latency_seconds_count 2 1000
+`)
+	assert.Contains(t, scraped, "size_kib 2048 1000\n")
+	assert.Contains(t, scraped, "other 2 1000\n")
+	assert.Contains(t, hub.Capabilities().Features, FeatureNormalization)
+}
@@ -0,0 +1,491 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	// ScrapeFormatOpenMetrics is the value of the format scrape parameter
+	// that returns the OpenMetrics exposition, e.g. for clients that can't
+	// set an Accept header
+	ScrapeFormatOpenMetrics = "openmetrics"
+
+	openMetricsEOF = "# EOF"
+)
+
+// parseExposition parses a pushed body of contentType, in the OpenMetrics
+// format for application/openmetrics-text and the text format otherwise
+func parseExposition(contentType string, body []byte) (map[string]*dto.MetricFamily, error) {
+	if expositionFormat(contentType) == ScrapeFormatOpenMetrics {
+		return parseOpenMetrics(body)
+	}
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(bytes.NewReader(body))
+}
+
+// openMetricsSuffixes are the sample name suffixes of each OpenMetrics type
+var openMetricsSuffixes = map[string][]string{
+	"counter":        {"_total", "_created"},
+	"gauge":          {""},
+	"summary":        {"", "_sum", "_count", "_created"},
+	"histogram":      {"_bucket", "_sum", "_count", "_created"},
+	"gaugehistogram": {"_bucket", "_gsum", "_gcount"},
+	"info":           {"_info"},
+	"stateset":       {""},
+	"unknown":        {""},
+}
+
+// openMetricsParser builds metric families from an OpenMetrics exposition
+type openMetricsParser struct {
+	families map[string]*dto.MetricFamily
+	// name and metricType are those of the family being parsed, as in its
+	// metadata
+	name       string
+	metricType string
+	help       *string
+	family     *dto.MetricFamily
+	// seen are the names of the families parsed so far, which can't appear
+	// again
+	seen map[string]bool
+	// grouped are the summary or histogram datapoints of family by labels
+	// and timestamp, since each of them is spread over several samples
+	grouped map[string]*dto.Metric
+}
+
+// parseOpenMetrics parses an OpenMetrics text exposition. Counters are named
+// with their _total suffix, info metrics become gauges named with their _info
+// suffix, statesets become gauges and gauge histograms histograms, so they are
+// stored the same as if pushed in the text format. _created samples and UNIT
+// metadata are dropped. Exemplars of counters and histogram buckets are kept.
+func parseOpenMetrics(body []byte) (map[string]*dto.MetricFamily, error) {
+	p := &openMetricsParser{
+		families: make(map[string]*dto.MetricFamily),
+		seen:     make(map[string]bool),
+	}
+	lines := strings.Split(string(body), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 || lines[len(lines)-1] != openMetricsEOF {
+		return nil, fmt.Errorf("OpenMetrics exposition must end with %q", openMetricsEOF)
+	}
+	for i, line := range lines[:len(lines)-1] {
+		var err error
+		if strings.HasPrefix(line, "#") {
+			err = p.parseMetadata(line)
+		} else {
+			err = p.parseSample(line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+	}
+	return p.families, nil
+}
+
+func (p *openMetricsParser) parseMetadata(line string) error {
+	parts := strings.SplitN(line, " ", 4)
+	if len(parts) < 3 || parts[0] != "#" {
+		return fmt.Errorf("invalid metadata line %q", line)
+	}
+	keyword, name := parts[1], parts[2]
+	if !isValidMetricName(name) {
+		return fmt.Errorf("invalid metric name %q", name)
+	}
+	if name != p.name {
+		if err := p.startFamily(name, "unknown"); err != nil {
+			return err
+		}
+	} else if p.family != nil {
+		return fmt.Errorf("metadata of %s after its samples", name)
+	}
+	value := ""
+	if len(parts) == 4 {
+		value = parts[3]
+	}
+
+	switch keyword {
+	case "HELP":
+		help := unescapeOpenMetrics(value)
+		p.help = &help
+	case "TYPE":
+		if _, ok := openMetricsSuffixes[value]; !ok {
+			return fmt.Errorf("unknown type %q of %s", value, name)
+		}
+		p.metricType = value
+	case "UNIT":
+	default:
+		return fmt.Errorf("unknown metadata %q", keyword)
+	}
+	return nil
+}
+
+// startFamily starts parsing the family name
+func (p *openMetricsParser) startFamily(name, metricType string) error {
+	if p.seen[name] {
+		return fmt.Errorf("samples of %s are interleaved with other families", name)
+	}
+	p.seen[name] = true
+	p.name = name
+	p.metricType = metricType
+	p.help = nil
+	p.family = nil
+	p.grouped = make(map[string]*dto.Metric)
+	return nil
+}
+
+// suffix returns the suffix of sample name in the family being parsed, or
+// false if the sample belongs to another family
+func (p *openMetricsParser) suffix(name string) (string, bool) {
+	if !strings.HasPrefix(name, p.name) {
+		return "", false
+	}
+	for _, suffix := range openMetricsSuffixes[p.metricType] {
+		if name == p.name+suffix {
+			return suffix, true
+		}
+	}
+	return "", false
+}
+
+func (p *openMetricsParser) parseSample(line string) error {
+	name, labels, value, timestampMs, exemplar, err := parseOpenMetricsSample(line)
+	if err != nil {
+		return err
+	}
+	suffix, ok := p.suffix(name)
+	if !ok {
+		// a sample without metadata is a family of unknown type
+		if err := p.startFamily(name, "unknown"); err != nil {
+			return err
+		}
+	}
+	if p.family == nil {
+		p.family = p.newFamily()
+		p.families[p.family.GetName()] = p.family
+	}
+	if exemplar != nil && !(p.metricType == "counter" && suffix == "_total") && suffix != "_bucket" {
+		return fmt.Errorf("exemplar on %s, only counters and histogram buckets can have exemplars", name)
+	}
+
+	switch p.metricType {
+	case "counter":
+		if suffix == "_created" {
+			return nil
+		}
+		p.family.Metric = append(p.family.Metric, &dto.Metric{Label: labels, Counter: &dto.Counter{Value: proto.Float64(value), Exemplar: exemplar}, TimestampMs: timestampMs})
+	case "gauge", "info", "stateset":
+		p.family.Metric = append(p.family.Metric, &dto.Metric{Label: labels, Gauge: &dto.Gauge{Value: proto.Float64(value)}, TimestampMs: timestampMs})
+	case "unknown":
+		p.family.Metric = append(p.family.Metric, &dto.Metric{Label: labels, Untyped: &dto.Untyped{Value: proto.Float64(value)}, TimestampMs: timestampMs})
+	case "summary":
+		return p.addSummarySample(suffix, labels, value, timestampMs)
+	case "histogram", "gaugehistogram":
+		return p.addHistogramSample(suffix, labels, value, timestampMs, exemplar)
+	}
+	return nil
+}
+
+// newFamily returns the dto family of the family being parsed
+func (p *openMetricsParser) newFamily() *dto.MetricFamily {
+	family := &dto.MetricFamily{Name: proto.String(p.name), Help: p.help}
+	switch p.metricType {
+	case "counter":
+		family.Name = proto.String(p.name + "_total")
+		family.Type = dto.MetricType_COUNTER.Enum()
+	case "gauge", "stateset":
+		family.Type = dto.MetricType_GAUGE.Enum()
+	case "info":
+		family.Name = proto.String(p.name + "_info")
+		family.Type = dto.MetricType_GAUGE.Enum()
+	case "summary":
+		family.Type = dto.MetricType_SUMMARY.Enum()
+	case "histogram", "gaugehistogram":
+		family.Type = dto.MetricType_HISTOGRAM.Enum()
+	default:
+		family.Type = dto.MetricType_UNTYPED.Enum()
+	}
+	return family
+}
+
+// groupedMetric returns the datapoint of the family being parsed with labels,
+// except for the label named except, and timestampMs
+func (p *openMetricsParser) groupedMetric(labels []*dto.LabelPair, except string, timestampMs *int64) (*dto.Metric, string, error) {
+	var kept []*dto.LabelPair
+	exceptValue, found := "", false
+	for _, label := range labels {
+		if label.GetName() == except {
+			exceptValue, found = label.GetValue(), true
+			continue
+		}
+		kept = append(kept, label)
+	}
+	if except != "" && !found {
+		return nil, "", fmt.Errorf("sample of %s without %s label", p.name, except)
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].GetName() < kept[j].GetName()
+	})
+
+	var key strings.Builder
+	for _, label := range kept {
+		key.WriteString(label.GetName() + "\xff" + label.GetValue() + "\xff")
+	}
+	if timestampMs != nil {
+		key.WriteString(strconv.FormatInt(*timestampMs, 10))
+	}
+	metric, ok := p.grouped[key.String()]
+	if !ok {
+		metric = &dto.Metric{Label: kept, TimestampMs: timestampMs}
+		p.grouped[key.String()] = metric
+		p.family.Metric = append(p.family.Metric, metric)
+	}
+	return metric, exceptValue, nil
+}
+
+func (p *openMetricsParser) addSummarySample(suffix string, labels []*dto.LabelPair, value float64, timestampMs *int64) error {
+	if suffix == "_created" {
+		return nil
+	}
+	except := ""
+	if suffix == "" {
+		except = "quantile"
+	}
+	metric, quantile, err := p.groupedMetric(labels, except, timestampMs)
+	if err != nil {
+		return err
+	}
+	if metric.Summary == nil {
+		metric.Summary = &dto.Summary{}
+	}
+	switch suffix {
+	case "":
+		q, err := strconv.ParseFloat(quantile, 64)
+		if err != nil {
+			return fmt.Errorf("invalid quantile %q", quantile)
+		}
+		metric.Summary.Quantile = append(metric.Summary.Quantile, &dto.Quantile{Quantile: proto.Float64(q), Value: proto.Float64(value)})
+	case "_sum":
+		metric.Summary.SampleSum = proto.Float64(value)
+	case "_count":
+		metric.Summary.SampleCount = proto.Uint64(uint64(value))
+	}
+	return nil
+}
+
+func (p *openMetricsParser) addHistogramSample(suffix string, labels []*dto.LabelPair, value float64, timestampMs *int64, exemplar *dto.Exemplar) error {
+	if suffix == "_created" {
+		return nil
+	}
+	except := ""
+	if suffix == "_bucket" {
+		except = "le"
+	}
+	metric, le, err := p.groupedMetric(labels, except, timestampMs)
+	if err != nil {
+		return err
+	}
+	if metric.Histogram == nil {
+		metric.Histogram = &dto.Histogram{}
+	}
+	switch suffix {
+	case "_bucket":
+		bound, err := strconv.ParseFloat(le, 64)
+		if err != nil {
+			return fmt.Errorf("invalid bucket bound %q", le)
+		}
+		metric.Histogram.Bucket = append(metric.Histogram.Bucket, &dto.Bucket{UpperBound: proto.Float64(bound), CumulativeCount: proto.Uint64(uint64(value)), Exemplar: exemplar})
+	case "_sum", "_gsum":
+		metric.Histogram.SampleSum = proto.Float64(value)
+	case "_count", "_gcount":
+		metric.Histogram.SampleCount = proto.Uint64(uint64(value))
+	}
+	return nil
+}
+
+// parseOpenMetricsSample parses a sample line into its metric name, labels,
+// value, timestamp and exemplar, if any
+func parseOpenMetricsSample(line string) (string, []*dto.LabelPair, float64, *int64, *dto.Exemplar, error) {
+	i := strings.IndexAny(line, "{ ")
+	if i <= 0 {
+		return "", nil, 0, nil, nil, fmt.Errorf("invalid sample %q", line)
+	}
+	name := line[:i]
+	if !isValidMetricName(name) {
+		return "", nil, 0, nil, nil, fmt.Errorf("invalid metric name %q", name)
+	}
+	rest := line[i:]
+	var labels []*dto.LabelPair
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		labels, rest, err = parseOpenMetricsLabels(rest)
+		if err != nil {
+			return "", nil, 0, nil, nil, err
+		}
+	}
+
+	var exemplarText string
+	if i := strings.Index(rest, " # "); i >= 0 {
+		rest, exemplarText = rest[:i], rest[i+3:]
+	}
+	fields := strings.Split(rest, " ")
+	if len(fields) < 2 || len(fields) > 3 || fields[0] != "" {
+		return "", nil, 0, nil, nil, fmt.Errorf("invalid sample %q", line)
+	}
+	value, timestampMs, err := parseOpenMetricsValue(fields[1:])
+	if err != nil {
+		return "", nil, 0, nil, nil, err
+	}
+	if exemplarText == "" {
+		return name, labels, value, timestampMs, nil, nil
+	}
+
+	exemplarLabels, exemplarRest, err := parseOpenMetricsLabels(exemplarText)
+	if err != nil {
+		return "", nil, 0, nil, nil, fmt.Errorf("invalid exemplar: %v", err)
+	}
+	fields = strings.Split(exemplarRest, " ")
+	if len(fields) < 2 || len(fields) > 3 || fields[0] != "" {
+		return "", nil, 0, nil, nil, fmt.Errorf("invalid exemplar %q", exemplarText)
+	}
+	exemplarValue, exemplarMs, err := parseOpenMetricsValue(fields[1:])
+	if err != nil {
+		return "", nil, 0, nil, nil, fmt.Errorf("invalid exemplar: %v", err)
+	}
+	exemplar := &dto.Exemplar{Label: exemplarLabels, Value: proto.Float64(exemplarValue)}
+	if exemplarMs != nil {
+		exemplar.Timestamp, err = ptypes.TimestampProto(time.Unix(0, *exemplarMs*int64(time.Millisecond)))
+		if err != nil {
+			return "", nil, 0, nil, nil, fmt.Errorf("invalid exemplar: %v", err)
+		}
+	}
+	return name, labels, value, timestampMs, exemplar, nil
+}
+
+// parseOpenMetricsValue parses a value and an optional timestamp in seconds
+func parseOpenMetricsValue(fields []string) (float64, *int64, error) {
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid value %q", fields[0])
+	}
+	if len(fields) == 1 {
+		return value, nil, nil
+	}
+	seconds, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, nil, fmt.Errorf("invalid timestamp %q", fields[1])
+	}
+	return value, proto.Int64(int64(math.Round(seconds * 1000))), nil
+}
+
+// parseOpenMetricsLabels parses the label set at the start of text, and
+// returns the labels and the rest of text
+func parseOpenMetricsLabels(text string) ([]*dto.LabelPair, string, error) {
+	if !strings.HasPrefix(text, "{") {
+		return nil, "", fmt.Errorf("expected labels in %q", text)
+	}
+	labels := []*dto.LabelPair{}
+	i := 1
+	for {
+		if i < len(text) && text[i] == '}' {
+			return labels, text[i+1:], nil
+		}
+		eq := strings.Index(text[i:], "=\"")
+		if eq < 0 {
+			return nil, "", fmt.Errorf("invalid labels %q", text)
+		}
+		name := text[i : i+eq]
+		if !isValidLabelName(name) {
+			return nil, "", fmt.Errorf("invalid label name %q", name)
+		}
+		i += eq + 2
+		start := i
+		for ; i < len(text) && text[i] != '"'; i++ {
+			if text[i] == '\\' {
+				i++
+			}
+		}
+		if i >= len(text) {
+			return nil, "", fmt.Errorf("unterminated value of label %s", name)
+		}
+		labels = append(labels, &dto.LabelPair{Name: proto.String(name), Value: proto.String(unescapeOpenMetrics(text[start:i]))})
+		i++
+		if i < len(text) && text[i] == ',' {
+			i++
+		} else if i >= len(text) || text[i] != '}' {
+			return nil, "", fmt.Errorf("invalid labels %q", text)
+		}
+	}
+}
+
+// unescapeOpenMetrics replaces the escape sequences of HELP texts and label
+// values
+func unescapeOpenMetrics(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var unescaped strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			unescaped.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch {
+		case s[i] == 'n':
+			unescaped.WriteByte('\n')
+		case s[i] == '\\', s[i] == '"':
+			unescaped.WriteByte(s[i])
+		default:
+			unescaped.WriteByte('\\')
+			unescaped.WriteByte(s[i])
+		}
+	}
+	return unescaped.String()
+}
+
+func isValidMetricName(name string) bool {
+	for i, r := range name {
+		if !isValidMetricNameChar(r, i == 0) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+func isValidLabelName(name string) bool {
+	for i, r := range name {
+		if !isValidLabelNameChar(r, i == 0) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// familyToOpenMetrics returns the OpenMetrics exposition of family, without
+// the final EOF line
+func familyToOpenMetrics(family *dto.MetricFamily) (string, error) {
+	var buf bytes.Buffer
+	if _, err := expfmt.MetricFamilyToOpenMetrics(&buf, family); err != nil {
+		return "", fmt.Errorf("error writing family string: %v", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+func receiveOpenMetrics(hub *MetricHub, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/metrics", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, string(expfmt.FmtOpenMetrics))
+	rec := httptest.NewRecorder()
+	hub.Receive(echo.New().NewContext(req, rec))
+	return rec
+}
+
+func scrapeOpenMetrics(t *testing.T, hub *MetricHub, query, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/metrics?"+query, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.Scrape(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	return rec
+}
+
+func TestParseOpenMetrics(t *testing.T) {
+	families, err := parseOpenMetrics([]byte(`# HELP requests Requests \"served\"\nby path.
+# TYPE requests counter
+# UNIT requests requests
+requests_total{path="/a\\b"} 10 1.5 # {trace_id="abc"} 1 1.25
+requests_created{path="/a\\b"} 1
+# TYPE temperature gauge
+temperature{room="kitchen"} 21.5
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="1"} 2 1 # {trace_id="def"} 0.5
+latency_seconds_bucket{le="+Inf"} 3 1
+latency_seconds_sum 1.5 1
+latency_seconds_count 3 1
+latency_seconds_bucket{le="1"} 4 2
+latency_seconds_bucket{le="+Inf"} 5 2
+latency_seconds_sum 2.5 2
+latency_seconds_count 5 2
+# TYPE rpc_seconds summary
+rpc_seconds{quantile="0.5"} 0.1
+rpc_seconds_sum 3
+rpc_seconds_count 20
+# TYPE build info
+build_info{version="1.0"} 1
+untyped_thing 7
+# EOF
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(families))
+
+	requests := families["requests_total"]
+	assert.Equal(t, "COUNTER", requests.GetType().String())
+	assert.Equal(t, "Requests \"served\"\nby path.", requests.GetHelp())
+	assert.Equal(t, 1, len(requests.Metric))
+	assert.Equal(t, `/a\b`, requests.Metric[0].Label[0].GetValue())
+	assert.Equal(t, 10.0, requests.Metric[0].Counter.GetValue())
+	assert.Equal(t, int64(1500), requests.Metric[0].GetTimestampMs())
+	assert.Equal(t, "abc", requests.Metric[0].Counter.Exemplar.Label[0].GetValue())
+	assert.Equal(t, int64(1), requests.Metric[0].Counter.Exemplar.Timestamp.GetSeconds())
+	assert.Equal(t, int32(250000000), requests.Metric[0].Counter.Exemplar.Timestamp.GetNanos())
+
+	assert.Equal(t, "GAUGE", families["temperature"].GetType().String())
+	assert.Equal(t, "GAUGE", families["build_info"].GetType().String())
+	assert.Equal(t, "UNTYPED", families["untyped_thing"].GetType().String())
+
+	latency := families["latency_seconds"]
+	assert.Equal(t, 2, len(latency.Metric))
+	assert.Equal(t, int64(1000), latency.Metric[0].GetTimestampMs())
+	assert.Equal(t, uint64(3), latency.Metric[0].Histogram.GetSampleCount())
+	assert.Equal(t, 2, len(latency.Metric[0].Histogram.Bucket))
+	assert.Equal(t, 0.5, latency.Metric[0].Histogram.Bucket[0].Exemplar.GetValue())
+	assert.Equal(t, uint64(5), latency.Metric[1].Histogram.Bucket[1].GetCumulativeCount())
+
+	rpc := families["rpc_seconds"]
+	assert.Equal(t, 1, len(rpc.Metric))
+	assert.Equal(t, 0.5, rpc.Metric[0].Summary.Quantile[0].GetQuantile())
+	assert.Equal(t, uint64(20), rpc.Metric[0].Summary.GetSampleCount())
+}
+
+func TestParseOpenMetricsErrors(t *testing.T) {
+	for _, body := range []string{
+		"up 1\n",
+		"up 1\n# EOF\nup 2\n",
+		"# TYPE up gauge\nup 1\n# TYPE down gauge\ndown 1\nup 2\n# EOF\n",
+		"# TYPE up gauge\nup 1 # {trace_id=\"a\"} 1\n# EOF\n",
+		"# TYPE up nonsense\n# EOF\n",
+		"# TYPE latency histogram\nlatency_bucket 1\n# EOF\n",
+		"up{job=\"a} 1\n# EOF\n",
+		"up{1job=\"a\"} 1\n# EOF\n",
+		"up one\n# EOF\n",
+		"up 1 later\n# EOF\n",
+	} {
+		_, err := parseOpenMetrics([]byte(body))
+		assert.Error(t, err, body)
+	}
+}
+
+func TestOpenMetricsPush(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	assert.Equal(t, http.StatusOK, receiveOpenMetrics(hub, "# TYPE requests counter\nrequests_total 10 1\n# EOF\n").Code)
+	assert.Equal(t, "# TYPE requests_total counter\nrequests_total 10 1000\n", scrape(t, hub))
+
+	// a text push is rejected as OpenMetrics for its missing EOF
+	rec := receiveOpenMetrics(hub, "# TYPE requests counter\nrequests_total 10 1000\n")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "# EOF")
+	assert.Equal(t, 0, hub.Status().Datapoints)
+
+	rec = receiveBatch(t, hub, []testPart{
+		{groupingLabels: "job=a", body: "up 1 1\n# EOF\n", contentType: string(expfmt.FmtOpenMetrics)},
+		{groupingLabels: "job=b", body: "up 1 1\n", contentType: string(expfmt.FmtOpenMetrics)},
+	})
+	assert.Equal(t, http.StatusMultiStatus, rec.Code)
+	assert.Equal(t, 1, hub.Status().Datapoints)
+	assert.Contains(t, hub.Capabilities().PushFormats, string(expfmt.FmtOpenMetrics))
+}
+
+func TestOpenMetricsScrape(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	assert.Equal(t, http.StatusOK, receiveOpenMetrics(hub, "# TYPE requests counter\nrequests_total 10 1.5 # {trace_id=\"abc\"} 1 1.25\n# EOF\n").Code)
+
+	rec := scrapeOpenMetrics(t, hub, "", "application/openmetrics-text; version=0.0.1,text/plain;version=0.0.4;q=0.5")
+	assert.Equal(t, string(expfmt.FmtOpenMetrics), rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, "# TYPE requests counter\nrequests_total 10.0 1.5 # {trace_id=\"abc\"} 1.0 1.25\n# EOF\n", rec.Body.String())
+
+	_, err := receiveString(hub, "up 1 1000\n")
+	assert.NoError(t, err)
+	rec = scrapeOpenMetrics(t, hub, "format=openmetrics", "")
+	assert.Equal(t, "# TYPE up unknown\nup 1.0 1.0\n# EOF\n", rec.Body.String())
+	assert.Equal(t, "# EOF\n", scrapeOpenMetrics(t, hub, "format=openmetrics", "").Body.String())
+
+	// other clients still get the text format
+	_, err = receiveString(hub, "up 1 1000\n")
+	assert.NoError(t, err)
+	rec = scrapeOpenMetrics(t, hub, "", "text/plain")
+	assert.Equal(t, "# TYPE up untyped\nup 1 1000\n", rec.Body.String())
+	assert.Contains(t, hub.Capabilities().ScrapeFormats, string(expfmt.FmtOpenMetrics))
+}
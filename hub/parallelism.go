@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// unlimitedCPUMax is the cgroup v2 cpu.max quota of an unlimited cgroup
+	unlimitedCPUMax = "max"
+)
+
+var (
+	gomaxprocs    = prometheus.NewGauge(prometheus.GaugeOpts{Name: "gomaxprocs", Help: "Effective GOMAXPROCS of the hub"})
+	cpuQuotaCores = prometheus.NewGauge(prometheus.GaugeOpts{Name: "cpu_quota_cores", Help: "CPU quota of the hub's cgroup in cores, 0 if unlimited"})
+	scrapeWorkers = prometheus.NewGauge(prometheus.GaugeOpts{Name: "scrape_workers", Help: "Number of workers serializing families during a scrape"})
+	ingestWorkers = prometheus.NewGauge(prometheus.GaugeOpts{Name: "ingest_workers", Help: "Maximum number of pushes parsed and stored concurrently, 0 if unbounded"})
+
+	// cgroupFSRoot is where the cgroup filesystem is mounted
+	cgroupFSRoot  = "/sys/fs/cgroup"
+	errNoCPUQuota = errors.New("no cgroup cpu quota")
+)
+
+func init() {
+	prometheus.MustRegister(gomaxprocs, cpuQuotaCores, scrapeWorkers, ingestWorkers)
+	gomaxprocs.Set(float64(runtime.GOMAXPROCS(0)))
+	scrapeWorkers.Set(scrapeWorkerPoolSize)
+}
+
+// TuneGOMAXPROCS lowers GOMAXPROCS to the CPU quota of the cgroup the hub runs
+// in, rounded down to at least 1. By default Go uses every CPU of the host,
+// which in a CPU limited container gets the hub throttled during scrapes. An
+// explicit GOMAXPROCS environment variable is always respected. Returns the
+// effective GOMAXPROCS.
+func TuneGOMAXPROCS() int {
+	quota, err := cpuQuota()
+	if err == nil {
+		cpuQuotaCores.Set(quota)
+	}
+	if _, ok := os.LookupEnv("GOMAXPROCS"); !ok && err == nil {
+		procs := int(math.Max(1, math.Floor(quota)))
+		if procs < runtime.GOMAXPROCS(0) {
+			logging.Info("Setting GOMAXPROCS to match cgroup cpu quota", "gomaxprocs", procs, "quota_cores", quota)
+			runtime.GOMAXPROCS(procs)
+		}
+	}
+	procs := runtime.GOMAXPROCS(0)
+	gomaxprocs.Set(float64(procs))
+	return procs
+}
+
+// cpuQuota returns the CPU quota in cores of the current cgroup, trying the
+// cgroup v2 interface first and then v1
+func cpuQuota() (float64, error) {
+	if data, err := ioutil.ReadFile(filepath.Join(cgroupFSRoot, "cpu.max")); err == nil {
+		return parseCPUMax(string(data))
+	}
+	quota, err := ioutil.ReadFile(filepath.Join(cgroupFSRoot, "cpu", "cpu.cfs_quota_us"))
+	if err != nil {
+		return 0, errNoCPUQuota
+	}
+	period, err := ioutil.ReadFile(filepath.Join(cgroupFSRoot, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, errNoCPUQuota
+	}
+	return parseCFSQuota(string(quota), string(period))
+}
+
+// parseCPUMax parses the cgroup v2 cpu.max format "<quota> <period>"
+func parseCPUMax(cpuMax string) (float64, error) {
+	fields := strings.Fields(cpuMax)
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("invalid cpu.max %q", cpuMax)
+	}
+	if fields[0] == unlimitedCPUMax {
+		return 0, errNoCPUQuota
+	}
+	return parseCFSQuota(fields[0], fields[1])
+}
+
+// parseCFSQuota returns quota/period, where a quota of -1 means unlimited
+func parseCFSQuota(quota, period string) (float64, error) {
+	q, err := strconv.ParseFloat(strings.TrimSpace(quota), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cpu quota %q: %v", quota, err)
+	}
+	p, err := strconv.ParseFloat(strings.TrimSpace(period), 64)
+	if err != nil || p <= 0 {
+		return 0, fmt.Errorf("invalid cpu period %q", period)
+	}
+	if q <= 0 {
+		return 0, errNoCPUQuota
+	}
+	return q / p, nil
+}
+
+// WithScrapeWorkers sets the number of workers serializing families in
+// parallel during a scrape. Values <= 0 keep the default.
+func WithScrapeWorkers(workers int) Option {
+	return func(hub *MetricHub) {
+		if workers > 0 {
+			hub.scrapeWorkers = workers
+			scrapeWorkers.Set(float64(workers))
+		}
+	}
+}
+
+// WithIngestWorkers bounds the number of pushes parsed and stored at the same
+// time, so bursts of pushes cannot use more CPU than the hub has. Bodies are
+// read before waiting for a worker, so slow clients do not hold one. Values
+// <= 0 mean unbounded.
+func WithIngestWorkers(workers int) Option {
+	return func(hub *MetricHub) {
+		if workers <= 0 {
+			hub.ingestSem = nil
+			ingestWorkers.Set(0)
+			return
+		}
+		hub.ingestSem = make(chan struct{}, workers)
+		ingestWorkers.Set(float64(workers))
+	}
+}
+
+// acquireIngestWorker blocks until an ingest worker is free, and returns a
+// function releasing it
+func (c *MetricHub) acquireIngestWorker() func() {
+	release, _ := c.acquireIngestWorkerContext(context.Background())
+	return release
+}
+
+// acquireIngestWorkerContext is acquireIngestWorker giving up with the error
+// of ctx once it is done
+func (c *MetricHub) acquireIngestWorkerContext(ctx context.Context) (func(), error) {
+	if c.ingestSem == nil {
+		return func() {}, nil
+	}
+	select {
+	case c.ingestSem <- struct{}{}:
+		return func() { <-c.ingestSem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
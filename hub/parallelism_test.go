@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCPUQuota(t *testing.T) {
+	quota, err := parseCPUMax("150000 100000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, quota)
+
+	_, err = parseCPUMax("max 100000\n")
+	assert.Equal(t, errNoCPUQuota, err)
+	_, err = parseCPUMax("garbage")
+	assert.Error(t, err)
+
+	quota, err = parseCFSQuota("50000\n", "100000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, quota)
+	_, err = parseCFSQuota("-1\n", "100000\n")
+	assert.Equal(t, errNoCPUQuota, err)
+}
+
+func TestCPUQuotaReadsCgroupFS(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	defer func(old string) { cgroupFSRoot = old }(cgroupFSRoot)
+	cgroupFSRoot = root
+
+	_, err = cpuQuota()
+	assert.Equal(t, errNoCPUQuota, err)
+
+	// cgroup v1
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "cpu"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"), []byte("200000\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "cpu", "cpu.cfs_period_us"), []byte("100000\n"), 0644))
+	quota, err := cpuQuota()
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, quota)
+
+	// cgroup v2 takes precedence
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "cpu.max"), []byte("400000 100000\n"), 0644))
+	quota, err = cpuQuota()
+	assert.NoError(t, err)
+	assert.Equal(t, 4.0, quota)
+}
+
+func TestWithScrapeWorkers(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithScrapeWorkers(2))
+	assert.Equal(t, 2, hub.scrapeWorkers)
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, 14, strings.Count(scrape(t, hub), "1395066363"))
+
+	assert.Equal(t, scrapeWorkerPoolSize, NewMetricHub(0, 10, WithScrapeWorkers(0)).scrapeWorkers)
+}
+
+func TestSingleScrapeWorkerSerializesSerially(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithScrapeWorkers(1))
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, 14, strings.Count(scrape(t, hub), "1395066363"))
+
+	// a scrape over the timeout serves nothing and keeps the datapoints
+	_, err = receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	hub.scrapeTimeout = -1
+	assert.Equal(t, "", scrape(t, hub))
+	hub.scrapeTimeout = 10
+	assert.Equal(t, 14, strings.Count(scrape(t, hub), "1395066363"))
+}
+
+func TestIngestWorkersBoundConcurrentPushes(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithIngestWorkers(1))
+	release := hub.acquireIngestWorker()
+
+	done := make(chan struct{})
+	go func() {
+		hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "a", 1, testLabels, timestamp)})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("push was stored while no ingest worker was free")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	<-done
+	assert.Equal(t, 1, hub.Status().Datapoints)
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+var peekScrapes = prometheus.NewCounter(prometheus.CounterOpts{Name: "peek_scrapes_total", Help: "Number of scrapes with peek=true, which leave the datapoints in the hub"})
+
+func init() {
+	prometheus.MustRegister(peekScrapes)
+}
+
+// parsePeek returns whether the peek parameter of a scrape is set
+func parsePeek(peek string) (bool, error) {
+	if peek == "" {
+		return false, nil
+	}
+	ok, err := strconv.ParseBool(peek)
+	if err != nil {
+		return false, fmt.Errorf("invalid peek %q: must be true or false", peek)
+	}
+	return ok, nil
+}
+
+// peek serves the datapoints of class buffered in the hub like a scrape, but
+// without draining them, so the exposition can be inspected without taking
+// datapoints away from Prometheus. Since every datapoint is copied under the
+// hub lock, peeks are shed like other diagnostic requests.
+func (c *MetricHub) peek(ctx echo.Context, class ScrapeClass) error {
+	for _, param := range []string{"after", "consumer", "min_age", "wait", "min_datapoints"} {
+		if ctx.QueryParam(param) != "" {
+			return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "peek can't be combined with %s", param)
+		}
+	}
+	format := expfmt.FmtText
+	switch f := ctx.QueryParam("format"); f {
+	case "":
+		if expfmt.NegotiateIncludingOpenMetrics(ctx.Request().Header) == expfmt.FmtOpenMetrics {
+			format = expfmt.FmtOpenMetrics
+		}
+	case "text":
+	case ScrapeFormatOpenMetrics:
+		format = expfmt.FmtOpenMetrics
+	default:
+		return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "unknown format %q for peek: must be text or %s", f, ScrapeFormatOpenMetrics)
+	}
+	release, err := c.acquireDiagnostic()
+	if err != nil {
+		return c.shedDiagnostic(ctx, err)
+	}
+	defer release()
+	peekScrapes.Inc()
+
+	c.Lock()
+	families := make([]*dto.MetricFamily, 0, len(c.metricFamiliesByName))
+	for name, fam := range c.metricFamiliesByName {
+		if c.inScrapeClass(name, class) {
+			families = append(families, c.popOrdered(fam))
+		}
+	}
+	c.Unlock()
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].GetName() < families[j].GetName()
+	})
+
+	toString, contentType := familyToString, echo.MIMETextPlainCharsetUTF8
+	if format == expfmt.FmtOpenMetrics {
+		toString, contentType = familyToOpenMetrics, string(expfmt.FmtOpenMetrics)
+	}
+	var exposition strings.Builder
+	for _, family := range families {
+		s, err := toString(family)
+		if err != nil {
+			return respondError(ctx, http.StatusInternalServerError, ErrorCodeInternal, nil, "%v", err)
+		}
+		exposition.WriteString(s)
+	}
+	if format == expfmt.FmtOpenMetrics {
+		exposition.WriteString(openMetricsEOF + "\n")
+	}
+	return respondScrape(ctx, contentType, exposition.String())
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeek(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, "b 1 1000\na{x=\"2\"} 2 2000\na{x=\"1\"} 1 1000\n")
+	assert.NoError(t, err)
+
+	expected := "# TYPE a untyped\na{x=\"1\"} 1 1000\na{x=\"2\"} 2 2000\n# TYPE b untyped\nb 1 1000\n"
+	peeked := scrapeURL(t, hub, "/metrics?peek=true")
+	assert.Equal(t, http.StatusOK, peeked.Code)
+	assert.Equal(t, expected, peeked.Body.String())
+	assert.Equal(t, expected, scrapeURL(t, hub, "/metrics?peek=1").Body.String())
+	assert.Equal(t, 3, hub.Status().Datapoints)
+
+	openMetrics := scrapeURL(t, hub, "/metrics?peek=true&format=openmetrics").Body.String()
+	assert.Contains(t, openMetrics, "a{x=\"1\"} 1.0 1.0\n")
+	assert.Contains(t, openMetrics, "# EOF\n")
+
+	// a real scrape still gets every datapoint
+	assert.ElementsMatch(t, scrapedLines(expected), scrapedLines(scrape(t, hub)))
+	assert.Equal(t, "", scrapeURL(t, hub, "/metrics?peek=true").Body.String())
+	assert.Contains(t, hub.Capabilities().Features, FeatureScrapePeek)
+}
+
+func TestPeekScrapeClass(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithSlowFamilies(regexp.MustCompile("^slow_.*$")))
+	_, err := receiveString(hub, "slow_a 1\nfast_a 1\n")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics/slow?peek=true", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.ScrapeClassHandler(ScrapeClassSlow)(echo.New().NewContext(req, rec)))
+	assert.Equal(t, "# TYPE slow_a untyped\nslow_a 1\n", rec.Body.String())
+	assert.Equal(t, 2, hub.Status().Datapoints)
+}
+
+func TestPeekInvalid(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithScrapeRetention(2))
+	for _, url := range []string{
+		"/metrics?peek=maybe",
+		"/metrics?peek=true&min_age=30s",
+		"/metrics?peek=true&consumer=prom-0",
+		"/metrics?peek=true&format=jsonl",
+	} {
+		assert.Equal(t, http.StatusBadRequest, scrapeURL(t, hub, url).Code, url)
+	}
+	assert.Equal(t, http.StatusOK, scrapeURL(t, hub, "/metrics?peek=false").Code)
+}
+
+func TestPeekShed(t *testing.T) {
+	hub := NewMetricHub(2, 10, WithDiagnosticLimits(0, 50))
+	_, err := receiveString(hub, "a 1\nb 1\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, scrapeURL(t, hub, "/metrics?peek=true").Code)
+	assert.Equal(t, 2, hub.Status().Datapoints)
+}
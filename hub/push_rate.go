@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	transportLimitedPushes     = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "transport_limited_pushes_total", Help: "Number of pushes refused by the limits of their transport, by transport and limit"}, []string{"transport", "limit"})
+	transportAdmittedDatapoint = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "transport_admitted_datapoints_total", Help: "Number of pushed datapoints let in by the limits of their transport, by transport"}, []string{"transport"})
+	transportRateTokens        = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "transport_push_rate_tokens", Help: "Datapoints that can currently be pushed over a rate limited transport without waiting, by transport"}, []string{"transport"})
+)
+
+func init() {
+	prometheus.MustRegister(transportLimitedPushes, transportAdmittedDatapoint, transportRateTokens)
+}
+
+// RecordLimitedPush counts a push over transport refused by its limit, e.g.
+// rate, datapoints or bytes
+func RecordLimitedPush(transport, limit string) {
+	transportLimitedPushes.WithLabelValues(transport, limit).Inc()
+}
+
+// WithPushRateLimit limits pushes over transport, http or grpc, to
+// datapointsPerSecond on average, with bursts of up to burst datapoints. Each
+// transport has its own budget, so devices pushing over HTTP can be held back
+// without throttling a trusted sender using gRPC, or the other way around.
+// A push larger than burst is let in once the budget is full.
+func WithPushRateLimit(transport string, datapointsPerSecond float64, burst int) Option {
+	return func(hub *MetricHub) {
+		if hub.pushRates == nil {
+			hub.pushRates = make(map[string]*tokenBucket)
+		}
+		if burst < 1 {
+			burst = int(math.Ceil(datapointsPerSecond))
+		}
+		hub.pushRates[transport] = &tokenBucket{rate: datapointsPerSecond, burst: float64(burst), tokens: float64(burst)}
+	}
+}
+
+// WithHTTPPushLimits bounds the size of a single HTTP push, or batch part, to
+// maxDatapoints datapoints and maxBytes uncompressed bytes, like the push
+// limits of the gRPC server. Values <= 0 mean no limit.
+func WithHTTPPushLimits(maxDatapoints, maxBytes int) Option {
+	return func(hub *MetricHub) {
+		hub.httpMaxPushDatapoints = maxDatapoints
+		hub.httpMaxPushBytes = maxBytes
+	}
+}
+
+// tokenBucket holds the datapoints a transport may push without waiting
+type tokenBucket struct {
+	sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// take takes n tokens at now if there are enough, or the bucket is full.
+// Otherwise it returns how long until there are.
+func (b *tokenBucket) take(n int, now time.Time) (bool, time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	if b.last.IsZero() || now.After(b.last) {
+		b.last = now
+	}
+	needed := math.Min(float64(n), b.burst)
+	if b.tokens < needed {
+		return false, time.Duration((needed - b.tokens) / b.rate * float64(time.Second))
+	}
+	// a push larger than the burst leaves the bucket in debt
+	b.tokens -= float64(n)
+	return true, 0
+}
+
+func (b *tokenBucket) available() float64 {
+	b.Lock()
+	defer b.Unlock()
+	return b.tokens
+}
+
+// pushRateError is returned for pushes over the rate limit of their
+// transport
+type pushRateError struct {
+	transport  string
+	rate       float64
+	retryAfter time.Duration
+}
+
+func (e *pushRateError) Error() string {
+	return fmt.Sprintf("%s pushes are over the rate limit of %g datapoints per second, retry in %v", e.transport, e.rate, e.retryAfter.Round(time.Millisecond))
+}
+
+// pushSizeError is returned for HTTP pushes over the size limits
+type pushSizeError struct {
+	limit string
+	size  int
+	max   int
+}
+
+func (e *pushSizeError) Error() string {
+	return fmt.Sprintf("push has %d %s, limit is %d", e.size, e.limit, e.max)
+}
+
+// AdmitPushRate takes datapoints from the rate budget of transport, or
+// returns an error with how long to wait if the budget is used up. Every push
+// is let in over transports without a rate limit.
+func (c *MetricHub) AdmitPushRate(transport string, datapoints int) error {
+	bucket, ok := c.pushRates[transport]
+	if !ok {
+		transportAdmittedDatapoint.WithLabelValues(transport).Add(float64(datapoints))
+		return nil
+	}
+	allowed, retryAfter := bucket.take(datapoints, c.clock.Now())
+	transportRateTokens.WithLabelValues(transport).Set(bucket.available())
+	if !allowed {
+		RecordLimitedPush(transport, "rate")
+		return &pushRateError{transport: transport, rate: bucket.rate, retryAfter: retryAfter}
+	}
+	transportAdmittedDatapoint.WithLabelValues(transport).Add(float64(datapoints))
+	return nil
+}
+
+// PushRateRetryAfter returns how long a push refused by AdmitPushRate should
+// wait before retrying, and false for other errors
+func PushRateRetryAfter(err error) (time.Duration, bool) {
+	if rateErr, ok := err.(*pushRateError); ok {
+		return rateErr.retryAfter, true
+	}
+	return 0, false
+}
+
+// admitHTTPPush checks an HTTP push of datapoints and bytes against the HTTP
+// size and rate limits
+func (c *MetricHub) admitHTTPPush(datapoints, bytes int) error {
+	if c.httpMaxPushDatapoints > 0 && datapoints > c.httpMaxPushDatapoints {
+		RecordLimitedPush("http", "datapoints")
+		return &pushSizeError{limit: "datapoints", size: datapoints, max: c.httpMaxPushDatapoints}
+	}
+	if c.httpMaxPushBytes > 0 && bytes > c.httpMaxPushBytes {
+		RecordLimitedPush("http", "bytes")
+		return &pushSizeError{limit: "bytes", size: bytes, max: c.httpMaxPushBytes}
+	}
+	return c.AdmitPushRate("http", datapoints)
+}
+
+// respondPushLimitError sends the ErrorResponse for an error from
+// admitHTTPPush
+func respondPushLimitError(ctx echo.Context, err error) error {
+	status, code, details := pushLimitErrorResponse(err)
+	if retryAfter, ok := PushRateRetryAfter(err); ok {
+		ctx.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	return respondError(ctx, status, code, details, "%v", err)
+}
+
+// pushLimitErrorResponse returns the HTTP status, error code and details for
+// an error from admitHTTPPush
+func pushLimitErrorResponse(err error) (int, ErrorCode, map[string]string) {
+	switch e := err.(type) {
+	case *pushRateError:
+		return http.StatusTooManyRequests, ErrorCodeRateLimited, map[string]string{"transport": e.transport, "retry_after": e.retryAfter.Round(time.Millisecond).String()}
+	case *pushSizeError:
+		return http.StatusRequestEntityTooLarge, ErrorCodeLimitExceeded, map[string]string{e.limit: strconv.Itoa(e.size), "limit": strconv.Itoa(e.max)}
+	}
+	return http.StatusInternalServerError, ErrorCodeInternal, nil
+}
+
+func countParsedDatapoints(families map[string]*dto.MetricFamily) int {
+	datapoints := 0
+	for _, family := range families {
+		datapoints += len(family.Metric)
+	}
+	return datapoints
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/hub/hubtest"
+	"github.com/stretchr/testify/assert"
+)
+
+const threeDatapointPush = `# TYPE up gauge
+up{gw="a"} 1 1000
+up{gw="b"} 1 1000
+up{gw="c"} 1 1000
+`
+
+func TestPushRateLimitHTTP(t *testing.T) {
+	clock := hubtest.NewFakeClock(fakeStart)
+	hub := NewMetricHub(0, 100, WithClock(clock), WithPushRateLimit("http", 2, 4))
+
+	rec, err := receiveString(hub, threeDatapointPush)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// 1 datapoint left of the burst
+	rec, err = receiveString(hub, threeDatapointPush)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	resp := decodeError(t, rec)
+	assert.Equal(t, ErrorCodeRateLimited, resp.Code)
+	assert.Equal(t, map[string]string{"transport": "http", "retry_after": "1s"}, resp.Details)
+	assert.Equal(t, 3, hub.stats.currentCountDatapoints)
+
+	clock.Advance(time.Second)
+	rec, err = receiveString(hub, threeDatapointPush)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestPushRateLimitIndependentTransports(t *testing.T) {
+	clock := hubtest.NewFakeClock(fakeStart)
+	hub := NewMetricHub(0, 100, WithClock(clock), WithPushRateLimit("http", 1, 3))
+
+	assert.NoError(t, hub.AdmitPushRate("http", 3))
+	assert.Error(t, hub.AdmitPushRate("http", 1))
+	// grpc has no rate limit, and isn't held back by http
+	assert.NoError(t, hub.AdmitPushRate("grpc", 1000))
+}
+
+func TestPushRateLimitLargerThanBurst(t *testing.T) {
+	clock := hubtest.NewFakeClock(fakeStart)
+	hub := NewMetricHub(0, 100, WithClock(clock), WithPushRateLimit("grpc", 10, 10))
+
+	// let in when the bucket is full, leaving it in debt
+	assert.NoError(t, hub.AdmitPushRate("grpc", 30))
+	err := hub.AdmitPushRate("grpc", 1)
+	retryAfter, ok := PushRateRetryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, 2100*time.Millisecond, retryAfter)
+
+	clock.Advance(3 * time.Second)
+	assert.NoError(t, hub.AdmitPushRate("grpc", 10))
+}
+
+func TestHTTPPushLimits(t *testing.T) {
+	hub := NewMetricHub(0, 100, WithHTTPPushLimits(2, 0))
+	rec, err := receiveString(hub, threeDatapointPush)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	resp := decodeError(t, rec)
+	assert.Equal(t, ErrorCodeLimitExceeded, resp.Code)
+	assert.Equal(t, map[string]string{"datapoints": "3", "limit": "2"}, resp.Details)
+
+	hub = NewMetricHub(0, 100, WithHTTPPushLimits(0, len(threeDatapointPush)-1))
+	rec, err = receiveString(hub, threeDatapointPush)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Equal(t, 0, hub.stats.currentCountDatapoints)
+}
+
+func TestPushRateLimitCapabilities(t *testing.T) {
+	hub := NewMetricHub(0, 100, WithPushRateLimit("http", 50, 0), WithHTTPPushLimits(10, 1000))
+	capabilities := hub.Capabilities()
+	assert.Equal(t, map[string]float64{"http": 50}, capabilities.Limits.PushRates)
+	assert.Equal(t, 10, capabilities.Limits.HTTPMaxPushDatapoints)
+	assert.Equal(t, 1000, capabilities.Limits.HTTPMaxPushBytes)
+	assert.Contains(t, capabilities.Features, FeaturePushRateLimits)
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// DefaultQuarantineLimit is the number of datapoints of families that failed
+// to serialize kept in the quarantine unless set with WithQuarantineLimit
+const DefaultQuarantineLimit = 10000
+
+var (
+	quarantinedDatapoints       = prometheus.NewCounter(prometheus.CounterOpts{Name: "quarantined_datapoints_total", Help: "Number of scraped datapoints moved to the quarantine because their family failed to serialize"})
+	quarantineDroppedDatapoints = prometheus.NewCounter(prometheus.CounterOpts{Name: "quarantine_dropped_datapoints_total", Help: "Number of scraped datapoints of families that failed to serialize dropped because the quarantine was full"})
+	quarantinePurgedDatapoints  = prometheus.NewCounter(prometheus.CounterOpts{Name: "quarantine_purged_datapoints_total", Help: "Number of quarantined datapoints purged with DELETE /api/v1/quarantine"})
+	quarantineDatapoints        = prometheus.NewGauge(prometheus.GaugeOpts{Name: "quarantine_datapoints", Help: "Number of datapoints in the quarantine"})
+)
+
+func init() {
+	prometheus.MustRegister(quarantinedDatapoints, quarantineDroppedDatapoints, quarantinePurgedDatapoints, quarantineDatapoints)
+}
+
+// WithQuarantineLimit keeps up to limit datapoints of scraped families that
+// failed to serialize in the quarantine, where operators can inspect them on
+// /api/v1/quarantine. Values <= 0 drop such families, only counting them.
+func WithQuarantineLimit(limit int) Option {
+	return func(hub *MetricHub) {
+		hub.quarantine.limit = limit
+	}
+}
+
+// failedFamily is a family that failed to serialize
+type failedFamily struct {
+	family *dto.MetricFamily
+	err    error
+}
+
+// quarantinedFamily is a family in the quarantine
+type quarantinedFamily struct {
+	failedFamily
+	time time.Time
+}
+
+// quarantine holds the datapoints of scraped families that failed to
+// serialize, so they don't disappear without a trace
+type quarantine struct {
+	sync.Mutex
+	limit      int
+	families   []quarantinedFamily
+	datapoints int
+}
+
+// add moves failed into the quarantine, dropping the families that no longer
+// fit under the limit
+func (q *quarantine) add(now time.Time, failed []failedFamily) {
+	q.Lock()
+	defer q.Unlock()
+	for _, f := range failed {
+		datapoints := len(f.family.Metric)
+		if q.datapoints+datapoints > q.limit {
+			logging.Error("Dropped family that failed to serialize, quarantine is full", "family", f.family.GetName(), "datapoints", datapoints, "err", f.err)
+			quarantineDroppedDatapoints.Add(float64(datapoints))
+			continue
+		}
+		q.families = append(q.families, quarantinedFamily{failedFamily: f, time: now})
+		q.datapoints += datapoints
+		quarantinedDatapoints.Add(float64(datapoints))
+	}
+	quarantineDatapoints.Set(float64(q.datapoints))
+}
+
+// purge empties the quarantine and returns the number of datapoints it held
+func (q *quarantine) purge() int {
+	q.Lock()
+	defer q.Unlock()
+	purged := q.datapoints
+	q.families = nil
+	q.datapoints = 0
+	quarantinePurgedDatapoints.Add(float64(purged))
+	quarantineDatapoints.Set(0)
+	return purged
+}
+
+// quarantineFailed moves scraped families that failed to serialize into the
+// quarantine
+func (c *MetricHub) quarantineFailed(failed []failedFamily) {
+	if len(failed) > 0 {
+		c.quarantine.add(c.clock.Now(), failed)
+	}
+}
+
+// QuarantinedFamily is a family in the quarantine, as listed by
+// /api/v1/quarantine
+type QuarantinedFamily struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+	// Time is when the family was quarantined
+	Time    time.Time     `json:"time"`
+	Samples []jsonlSample `json:"samples"`
+}
+
+// Quarantine is the content of the quarantine
+type Quarantine struct {
+	Datapoints int                 `json:"datapoints"`
+	Limit      int                 `json:"limit"`
+	Families   []QuarantinedFamily `json:"families"`
+}
+
+// Quarantine returns the families in the quarantine, oldest first, with their
+// samples flattened like in JSON lines scrapes
+func (c *MetricHub) Quarantine() Quarantine {
+	q := c.quarantine
+	q.Lock()
+	defer q.Unlock()
+	quarantine := Quarantine{
+		Datapoints: q.datapoints,
+		Limit:      q.limit,
+		Families:   make([]QuarantinedFamily, 0, len(q.families)),
+	}
+	for _, f := range q.families {
+		family := QuarantinedFamily{Name: f.family.GetName(), Error: f.err.Error(), Time: f.time}
+		_ = forEachJSONLSample(f.family, func(sample jsonlSample) error {
+			family.Samples = append(family.Samples, sample)
+			return nil
+		})
+		quarantine.Families = append(quarantine.Families, family)
+	}
+	return quarantine
+}
+
+// GetQuarantine is a handler function listing the quarantined families
+func (c *MetricHub) GetQuarantine(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, c.Quarantine())
+}
+
+// PurgeQuarantine is a handler function emptying the quarantine. Returns the
+// number of purged datapoints.
+func (c *MetricHub) PurgeQuarantine(ctx echo.Context) error {
+	purged := c.quarantine.purge()
+	logging.Info("Purged quarantine", "datapoints", purged)
+	return ctx.JSON(http.StatusOK, map[string]int{"purged_datapoints": purged})
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/labstack/echo"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// blankFamily is a family that fails to serialize, since it has no name
+func blankFamily(values ...float64) *dto.MetricFamily {
+	family := &dto.MetricFamily{Name: proto.String(""), Type: dto.MetricType_GAUGE.Enum()}
+	for i, value := range values {
+		family.Metric = append(family.Metric, &dto.Metric{
+			Label:       []*dto.LabelPair{{Name: proto.String("x"), Value: proto.String("1")}},
+			Gauge:       &dto.Gauge{Value: proto.Float64(value)},
+			TimestampMs: proto.Int64(int64(i + 1)),
+		})
+	}
+	return family
+}
+
+func getQuarantine(t *testing.T, hub *MetricHub) Quarantine {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/quarantine", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.GetQuarantine(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var quarantine Quarantine
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &quarantine))
+	return quarantine
+}
+
+func TestQuarantine(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		hub := NewMetricHub(0, 10, WithScrapeWorkers(workers))
+		hub.hubMetrics(map[string]*dto.MetricFamily{"": blankFamily(1, 2)})
+		_, err := receiveString(hub, "a 1\n")
+		assert.NoError(t, err)
+
+		// peeking and debugging don't drain, so don't quarantine
+		assert.Equal(t, http.StatusInternalServerError, scrapeURL(t, hub, "/metrics?peek=true").Code)
+		req := httptest.NewRequest(http.MethodGet, "/debug?verbose=1", nil)
+		assert.NoError(t, hub.Debug(echo.New().NewContext(req, httptest.NewRecorder())))
+		assert.Equal(t, 0, getQuarantine(t, hub).Datapoints)
+
+		assert.Equal(t, "# TYPE a untyped\na 1\n", scrape(t, hub))
+		quarantine := getQuarantine(t, hub)
+		assert.Equal(t, 2, quarantine.Datapoints)
+		assert.Equal(t, DefaultQuarantineLimit, quarantine.Limit)
+		if assert.Len(t, quarantine.Families, 1) {
+			assert.Equal(t, "", quarantine.Families[0].Name)
+			assert.Contains(t, quarantine.Families[0].Error, "no name")
+			assert.Len(t, quarantine.Families[0].Samples, 2)
+			assert.Equal(t, map[string]string{"x": "1"}, quarantine.Families[0].Samples[0].Labels)
+		}
+
+		req = httptest.NewRequest(http.MethodDelete, "/api/v1/quarantine", nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, hub.PurgeQuarantine(echo.New().NewContext(req, rec)))
+		assert.JSONEq(t, `{"purged_datapoints": 2}`, rec.Body.String())
+		assert.Equal(t, 0, getQuarantine(t, hub).Datapoints)
+		assert.Empty(t, getQuarantine(t, hub).Families)
+	}
+}
+
+func TestQuarantineLimit(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithQuarantineLimit(3))
+	hub.hubMetrics(map[string]*dto.MetricFamily{"": blankFamily(1, 2)})
+	scrape(t, hub)
+	hub.hubMetrics(map[string]*dto.MetricFamily{"": blankFamily(1, 2)})
+	scrape(t, hub)
+	// the second family doesn't fit
+	assert.Equal(t, 2, getQuarantine(t, hub).Datapoints)
+	assert.Len(t, getQuarantine(t, hub).Families, 1)
+
+	hub = NewMetricHub(0, 10, WithQuarantineLimit(0))
+	hub.hubMetrics(map[string]*dto.MetricFamily{"": blankFamily(1)})
+	scrape(t, hub)
+	assert.Equal(t, 0, getQuarantine(t, hub).Datapoints)
+}
+
+func TestQuarantineScrapeRetention(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithScrapeRetention(2))
+	hub.hubMetrics(map[string]*dto.MetricFamily{"": blankFamily(1)})
+	scrapeURL(t, hub, "/metrics?consumer=prom-0")
+	assert.Equal(t, 1, getQuarantine(t, hub).Datapoints)
+
+	// the retained datapoints failing again for another consumer aren't
+	// quarantined twice
+	hub.hubMetrics(map[string]*dto.MetricFamily{"": blankFamily(2)})
+	scrapeURL(t, hub, "/metrics?consumer=prom-1")
+	assert.Equal(t, 2, getQuarantine(t, hub).Datapoints)
+}
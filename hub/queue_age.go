@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	oldestDatapointAgeDesc = prometheus.NewDesc(
+		"hub_oldest_datapoint_age_seconds",
+		"Time since the oldest datapoint currently in the hub was pushed",
+		nil, nil,
+	)
+	familyOldestDatapointAgeDesc = prometheus.NewDesc(
+		"family_oldest_datapoint_age_seconds",
+		"Time since the oldest datapoint of a family was pushed, for the families that have waited longest",
+		[]string{"family"}, nil,
+	)
+)
+
+// queueAgeCollector exposes how long datapoints have been waiting in the hub
+// to be scraped. Ages are computed when the collector is gathered, so they
+// keep growing while nobody scrapes the hub.
+type queueAgeCollector struct {
+	hub  *MetricHub
+	topN int
+}
+
+// NewQueueAgeCollector returns a collector exposing the age of the oldest
+// datapoint in hub, and of the oldest datapoint of the topN families that have
+// waited longest
+func NewQueueAgeCollector(hub *MetricHub, topN int) prometheus.Collector {
+	return &queueAgeCollector{hub: hub, topN: topN}
+}
+
+func (q *queueAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- oldestDatapointAgeDesc
+	ch <- familyOldestDatapointAgeDesc
+}
+
+func (q *queueAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	ages := q.hub.familyAges()
+	oldest := 0.0
+	if len(ages) > 0 {
+		oldest = ages[0].age.Seconds()
+	}
+	ch <- prometheus.MustNewConstMetric(oldestDatapointAgeDesc, prometheus.GaugeValue, oldest)
+	for i := 0; i < len(ages) && i < q.topN; i++ {
+		ch <- prometheus.MustNewConstMetric(familyOldestDatapointAgeDesc, prometheus.GaugeValue, ages[i].age.Seconds(), ages[i].name)
+	}
+}
+
+type familyAge struct {
+	name string
+	age  time.Duration
+}
+
+// familyAges returns how long each family in the hub has been buffered,
+// oldest first
+func (c *MetricHub) familyAges() []familyAge {
+	now := c.clock.Now()
+	c.Lock()
+	ages := make([]familyAge, 0, len(c.metricFamiliesByName))
+	for name, family := range c.metricFamiliesByName {
+		ages = append(ages, familyAge{name: name, age: now.Sub(family.bufferedSince)})
+	}
+	c.Unlock()
+
+	sort.Slice(ages, func(i, j int) bool {
+		return ages[i].age > ages[j].age
+	})
+	return ages
+}
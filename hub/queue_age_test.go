@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueAgeCollector(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewQueueAgeCollector(hub, 1))
+
+	// empty hub reports an age of 0 and no families
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(families))
+	assert.Equal(t, 0.0, families[0].GetMetric()[0].GetGauge().GetValue())
+
+	f1 := makeFamily(dto.MetricType_GAUGE, "fam1", 1, []*dto.LabelPair{}, 1)
+	f2 := makeFamily(dto.MetricType_GAUGE, "fam2", 1, []*dto.LabelPair{}, 1)
+	hub.ReceiveGRPC([]*dto.MetricFamily{f1, f2})
+	hub.metricFamiliesByName["fam1"].bufferedSince = time.Now().Add(-time.Minute)
+	hub.metricFamiliesByName["fam2"].bufferedSince = time.Now().Add(-time.Hour)
+
+	families, err = registry.Gather()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(families))
+	for _, family := range families {
+		switch family.GetName() {
+		case "hub_oldest_datapoint_age_seconds":
+			assert.InDelta(t, time.Hour.Seconds(), family.GetMetric()[0].GetGauge().GetValue(), 5)
+		case "family_oldest_datapoint_age_seconds":
+			// only the oldest family is exposed with topN = 1
+			assert.Equal(t, 1, len(family.GetMetric()))
+			assert.Equal(t, "fam2", family.GetMetric()[0].GetLabel()[0].GetValue())
+			assert.InDelta(t, time.Hour.Seconds(), family.GetMetric()[0].GetGauge().GetValue(), 5)
+		default:
+			t.Errorf("unexpected family %s", family.GetName())
+		}
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var notReadyResponses = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "not_ready_responses_total", Help: "Number of readiness probes answered with not ready, by reason"}, []string{"reason"})
+
+func init() {
+	prometheus.MustRegister(notReadyResponses)
+}
+
+// WithReadyUtilization makes the hub report not ready once it is over
+// utilization percent of its limit, so load balancers route pushes to other
+// hubs until a scrape drains it. Values <= 0 never report a full hub.
+func WithReadyUtilization(utilization float64) Option {
+	return func(hub *MetricHub) {
+		hub.readyUtilization = utilization
+	}
+}
+
+// ShutDown makes the hub report not ready from now on, so load balancers stop
+// routing pushes to it before it stops serving them
+func (c *MetricHub) ShutDown() {
+	atomic.StoreInt32(&c.shuttingDown, 1)
+}
+
+// Ready is a handler function for readiness probes. It answers 503 while the
+// hub replays its write-ahead log, while it is over the ready utilization and
+// once it shuts down. Unlike the liveness handler, a failure means pushes
+// should go elsewhere for now, not that the hub needs a restart.
+func (c *MetricHub) Ready(ctx echo.Context) error {
+	if atomic.LoadInt32(&c.shuttingDown) != 0 {
+		notReadyResponses.WithLabelValues("shutting_down").Inc()
+		return respondError(ctx, http.StatusServiceUnavailable, ErrorCodeShuttingDown, nil, "hub is shutting down")
+	}
+	if atomic.LoadInt32(&c.replaying) != 0 {
+		notReadyResponses.WithLabelValues("replaying").Inc()
+		return respondError(ctx, http.StatusServiceUnavailable, ErrorCodeWarmingUp, nil, "hub is replaying its write-ahead log")
+	}
+	if c.readyUtilization > 0 {
+		c.Lock()
+		utilization := c.utilization()
+		c.Unlock()
+		if utilization >= c.readyUtilization {
+			notReadyResponses.WithLabelValues("utilization").Inc()
+			details := map[string]string{
+				"utilization":       strconv.FormatFloat(utilization, 'f', 2, 64),
+				"ready_utilization": strconv.FormatFloat(c.readyUtilization, 'f', 2, 64),
+			}
+			return respondError(ctx, http.StatusServiceUnavailable, ErrorCodeOverloaded, details, "hub is %.2f%% full", utilization)
+		}
+	}
+	return ctx.NoContent(http.StatusOK)
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+// ready returns the status and error code of a readiness probe of hub
+func ready(t *testing.T, hub *MetricHub) (int, ErrorCode) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/-/ready", nil)
+	assert.NoError(t, hub.Ready(echo.New().NewContext(req, rec)))
+	if rec.Code == http.StatusOK {
+		return rec.Code, ""
+	}
+	var resp ErrorResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return rec.Code, resp.Code
+}
+
+func TestReadyUtilization(t *testing.T) {
+	hub := NewMetricHub(10, 10, WithReadyUtilization(80))
+	status, _ := ready(t, hub)
+	assert.Equal(t, http.StatusOK, status)
+
+	_, err := receiveString(hub, "a{x=\"1\"} 1\na{x=\"2\"} 1\na{x=\"3\"} 1\na{x=\"4\"} 1\na{x=\"5\"} 1\na{x=\"6\"} 1\na{x=\"7\"} 1\na{x=\"8\"} 1\n")
+	assert.NoError(t, err)
+	status, code := ready(t, hub)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, ErrorCodeOverloaded, code)
+
+	// ready again once a scrape drained it
+	scrape(t, hub)
+	status, _ = ready(t, hub)
+	assert.Equal(t, http.StatusOK, status)
+
+	// no high-water mark is ready whatever the utilization
+	full := NewMetricHub(1, 10)
+	_, err = receiveString(full, "a 1\n")
+	assert.NoError(t, err)
+	status, _ = ready(t, full)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestReadyWhileReplaying(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	wal, err := OpenWAL(dir)
+	assert.NoError(t, err)
+	hub := NewMetricHub(0, 10, WithWAL(wal))
+
+	status, code := ready(t, hub)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, ErrorCodeWarmingUp, code)
+
+	_, err = hub.ReplayWAL()
+	assert.NoError(t, err)
+	status, _ = ready(t, hub)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestReadyShuttingDown(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	hub.ShutDown()
+	status, code := ready(t, hub)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, ErrorCodeShuttingDown, code)
+}
@@ -0,0 +1,36 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var abortedPushes = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "aborted_pushes_total", Help: "Number of pushes given up on before they were stored because their context was done, by transport and reason: deadline_exceeded or canceled"}, []string{"transport", "reason"})
+
+func init() {
+	prometheus.MustRegister(abortedPushes)
+}
+
+// abortReceive rejects every datapoint of a gRPC push given up on because of
+// err, the error of its context
+func (c *MetricHub) abortReceive(families []*dto.MetricFamily, err error) (ReceiveResult, error) {
+	reason := "canceled"
+	if err == context.DeadlineExceeded {
+		reason = "deadline_exceeded"
+	}
+	abortedPushes.WithLabelValues("grpc", reason).Inc()
+	datapoints := 0
+	for _, fam := range families {
+		datapoints += len(fam.Metric)
+	}
+	return ReceiveResult{RejectedDatapoints: datapoints}, err
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiveGRPCContextCanceled(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := hub.ReceiveGRPCContext(ctx, []*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "a", 2, testLabels, timestamp)})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, ReceiveResult{RejectedDatapoints: 2}, result)
+	assert.Equal(t, 0, hub.Status().Datapoints)
+}
+
+func TestReceiveGRPCContextDeadlineWaitingForWorker(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithIngestWorkers(1))
+	release := hub.acquireIngestWorker()
+	aborted := abortedPushes.WithLabelValues("grpc", "deadline_exceeded")
+	before := testutil.ToFloat64(aborted)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := hub.ReceiveGRPCContext(ctx, []*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "a", 1, testLabels, timestamp)})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, before+1, testutil.ToFloat64(aborted))
+
+	// the worker isn't leaked by the aborted push
+	release()
+	result, err := hub.ReceiveGRPCContext(context.Background(), []*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "a", 1, testLabels, timestamp)})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.AcceptedDatapoints)
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// rejectedSampleInterval is the minimum time between two sampled
+	// rejections, so sampling stays cheap when every push is rejected
+	rejectedSampleInterval = time.Second
+	// rejectedSampleFamilies is the number of largest families kept per
+	// sampled rejection
+	rejectedSampleFamilies = 10
+	// rejectedSampleReasonLength is the maximum length of a sampled reason
+	rejectedSampleReasonLength = 256
+)
+
+// WithRejectedPushSamples keeps an excerpt of up to capacity recently
+// rejected pushes for ttl, shown on /debug. Excerpts have the names and
+// datapoint counts of the largest families in the push, but no values, so
+// operators can tell what a device was trying to push after the fact.
+func WithRejectedPushSamples(capacity int, ttl time.Duration) Option {
+	return func(hub *MetricHub) {
+		if capacity <= 0 {
+			hub.rejectedSamples = nil
+			return
+		}
+		hub.rejectedSamples = &rejectedSamples{
+			capacity: capacity,
+			ttl:      ttl,
+		}
+	}
+}
+
+// rejectedPush is the excerpt of a rejected push
+type rejectedPush struct {
+	time       time.Time
+	protocol   string
+	reason     string
+	datapoints int
+	// families are the largest families of the push, largest first
+	families        []rejectedFamily
+	omittedFamilies int
+}
+
+type rejectedFamily struct {
+	name       string
+	datapoints int
+}
+
+// rejectedSamples is a ring of recently rejected pushes
+type rejectedSamples struct {
+	sync.Mutex
+	capacity int
+	ttl      time.Duration
+	samples  []rejectedPush
+	next     int
+	last     time.Time
+}
+
+// SampleRejectedPush records families of a push over protocol rejected for
+// reason, if rejected push sampling is enabled and no other rejection was
+// sampled within the last second
+func (c *MetricHub) SampleRejectedPush(protocol, reason string, families []*dto.MetricFamily) {
+	if c.rejectedSamples == nil {
+		return
+	}
+	c.rejectedSamples.add(c.clock.Now(), protocol, reason, families)
+}
+
+func (s *rejectedSamples) add(now time.Time, protocol, reason string, families []*dto.MetricFamily) {
+	s.Lock()
+	if now.Sub(s.last) < rejectedSampleInterval {
+		s.Unlock()
+		return
+	}
+	s.last = now
+	s.Unlock()
+
+	reason = strings.TrimSpace(reason)
+	if len(reason) > rejectedSampleReasonLength {
+		reason = reason[:rejectedSampleReasonLength] + "..."
+	}
+	sample := rejectedPush{time: now, protocol: protocol, reason: reason}
+	for _, family := range families {
+		sample.datapoints += len(family.Metric)
+		sample.families = append(sample.families, rejectedFamily{name: family.GetName(), datapoints: len(family.Metric)})
+	}
+	sort.Slice(sample.families, func(i, j int) bool {
+		if sample.families[i].datapoints != sample.families[j].datapoints {
+			return sample.families[i].datapoints > sample.families[j].datapoints
+		}
+		return sample.families[i].name < sample.families[j].name
+	})
+	if len(sample.families) > rejectedSampleFamilies {
+		sample.omittedFamilies = len(sample.families) - rejectedSampleFamilies
+		sample.families = sample.families[:rejectedSampleFamilies]
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if len(s.samples) < s.capacity {
+		s.samples = append(s.samples, sample)
+		return
+	}
+	s.samples[s.next] = sample
+	s.next = (s.next + 1) % s.capacity
+}
+
+// recent returns the samples younger than the TTL, newest first
+func (s *rejectedSamples) recent(now time.Time) []rejectedPush {
+	s.Lock()
+	defer s.Unlock()
+	recent := make([]rejectedPush, 0, len(s.samples))
+	for _, sample := range s.samples {
+		if now.Sub(sample.time) <= s.ttl {
+			recent = append(recent, sample)
+		}
+	}
+	sort.Slice(recent, func(i, j int) bool {
+		return recent[i].time.After(recent[j].time)
+	})
+	return recent
+}
+
+// debugString formats the recent samples for /debug
+func (s *rejectedSamples) debugString(now time.Time) string {
+	recent := s.recent(now)
+	var str strings.Builder
+	str.WriteString(fmt.Sprintf("Recently Rejected Pushes (last %v): %d\n", s.ttl, len(recent)))
+	for _, sample := range recent {
+		str.WriteString(fmt.Sprintf("\t%s %s push of %d datapoints: %s\n", sample.time.Format(time.RFC3339), sample.protocol, sample.datapoints, sample.reason))
+		for _, family := range sample.families {
+			str.WriteString(fmt.Sprintf("\t\t%s: %d\n", family.name, family.datapoints))
+		}
+		if sample.omittedFamilies > 0 {
+			str.WriteString(fmt.Sprintf("\t\t(%d more families)\n", sample.omittedFamilies))
+		}
+	}
+	return str.String()
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleRejectedPushOverLimit(t *testing.T) {
+	hub := NewMetricHub(5, 10, WithRejectedPushSamples(4, time.Minute))
+	resp, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotAcceptable, resp.Code)
+
+	recent := hub.rejectedSamples.recent(time.Now())
+	assert.Equal(t, 1, len(recent))
+	assert.Equal(t, "http", recent[0].protocol)
+	assert.Equal(t, 14, recent[0].datapoints)
+	assert.Equal(t, []rejectedFamily{
+		{name: "cpu_usage", datapoints: 5},
+		{name: "http_requests_total", datapoints: 5},
+		{name: "memory_usage", datapoints: 4},
+	}, recent[0].families)
+	assert.Contains(t, recent[0].reason, "Would overfill hub limit of 5")
+
+	req := httptest.NewRequest(http.MethodGet, "/debug", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.Debug(echo.New().NewContext(req, rec)))
+	assert.Contains(t, rec.Body.String(), "Recently Rejected Pushes (last 1m0s): 1")
+	assert.Contains(t, rec.Body.String(), "\t\tcpu_usage: 5\n")
+}
+
+func TestSampleRejectedPushInvalid(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithRejectedPushSamples(4, time.Minute))
+	_, err := receiveString(hub, "bad metric string")
+	assert.NoError(t, err)
+
+	recent := hub.rejectedSamples.recent(time.Now())
+	assert.Equal(t, 1, len(recent))
+	assert.Contains(t, recent[0].reason, "error parsing metrics")
+	assert.Empty(t, recent[0].families)
+}
+
+func TestRejectedSamplesRingAndTTL(t *testing.T) {
+	samples := &rejectedSamples{capacity: 2, ttl: time.Minute}
+	t0 := time.Now()
+	for i := 0; i < 3; i++ {
+		family := makeFamily(dto.MetricType_GAUGE, fmt.Sprintf("fam%d", i), 1, testLabels, timestamp)
+		samples.add(t0.Add(time.Duration(i)*time.Second), "grpc", "rejected", []*dto.MetricFamily{family})
+	}
+	// rejections within a second of the last sample are not sampled
+	samples.add(t0.Add(2500*time.Millisecond), "grpc", "rejected", nil)
+
+	recent := samples.recent(t0.Add(2 * time.Second))
+	assert.Equal(t, 2, len(recent))
+	assert.Equal(t, "fam2", recent[0].families[0].name)
+	assert.Equal(t, "fam1", recent[1].families[0].name)
+
+	recent = samples.recent(t0.Add(time.Minute + 1500*time.Millisecond))
+	assert.Equal(t, 1, len(recent))
+	assert.Equal(t, "fam2", recent[0].families[0].name)
+}
+
+func TestRejectedSampleFamiliesAreCapped(t *testing.T) {
+	samples := &rejectedSamples{capacity: 1, ttl: time.Minute}
+	var families []*dto.MetricFamily
+	for i := 0; i < rejectedSampleFamilies+3; i++ {
+		families = append(families, makeFamily(dto.MetricType_GAUGE, fmt.Sprintf("fam%02d", i), i+1, testLabels, timestamp))
+	}
+	samples.add(time.Now(), "grpc", "rejected", families)
+
+	sample := samples.recent(time.Now())[0]
+	assert.Equal(t, rejectedSampleFamilies, len(sample.families))
+	assert.Equal(t, 3, sample.omittedFamilies)
+	assert.Equal(t, fmt.Sprintf("fam%02d", rejectedSampleFamilies+2), sample.families[0].name)
+}
@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+var relabelDroppedDatapoints = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "relabel_dropped_datapoints_total", Help: "Number of pushed datapoints dropped by a keep or drop relabel config, by family"}, []string{"family"})
+
+func init() {
+	prometheus.MustRegister(relabelDroppedDatapoints)
+}
+
+// RelabelAction is what a relabel config does with the datapoints it applies
+// to
+type RelabelAction string
+
+const (
+	// RelabelReplace sets TargetLabel to Replacement, expanded with the
+	// groups of Regex, if Regex matches the source labels. An empty result
+	// removes TargetLabel.
+	RelabelReplace RelabelAction = "replace"
+	// RelabelKeep drops datapoints whose source labels don't match Regex
+	RelabelKeep RelabelAction = "keep"
+	// RelabelDrop drops datapoints whose source labels match Regex
+	RelabelDrop RelabelAction = "drop"
+	// RelabelLabelDrop removes the labels whose name matches Regex
+	RelabelLabelDrop RelabelAction = "labeldrop"
+)
+
+// RelabelConfig rewrites the labels of pushed datapoints like a Prometheus
+// relabel_config. The values of SourceLabels are joined with Separator and
+// matched against Regex, which is anchored at both ends. __name__ is the
+// family name, which can be matched but not replaced.
+type RelabelConfig struct {
+	SourceLabels []string      `yaml:"source_labels,flow,omitempty"`
+	Separator    string        `yaml:"separator,omitempty"`
+	Regex        string        `yaml:"regex,omitempty"`
+	TargetLabel  string        `yaml:"target_label,omitempty"`
+	Replacement  string        `yaml:"replacement,omitempty"`
+	Action       RelabelAction `yaml:"action,omitempty"`
+}
+
+// DefaultRelabelConfig holds the defaults of fields not set in a relabel
+// config file, as in Prometheus
+var DefaultRelabelConfig = RelabelConfig{
+	Separator:   ";",
+	Regex:       "(.*)",
+	Replacement: "$1",
+	Action:      RelabelReplace,
+}
+
+// UnmarshalYAML fills in DefaultRelabelConfig for fields not set
+func (c *RelabelConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultRelabelConfig
+	type plain RelabelConfig
+	return unmarshal((*plain)(c))
+}
+
+// validate returns an error if c can't be applied
+func (c RelabelConfig) validate() error {
+	if _, err := regexp.Compile(anchored(c.Regex)); err != nil {
+		return fmt.Errorf("invalid regex %q: %v", c.Regex, err)
+	}
+	switch c.Action {
+	case RelabelReplace:
+		if c.TargetLabel == "" {
+			return fmt.Errorf("replace relabel config without a target_label")
+		}
+		if c.TargetLabel == model.MetricNameLabel {
+			return fmt.Errorf("relabel configs can't replace %s", model.MetricNameLabel)
+		}
+		if !strings.Contains(c.TargetLabel, "$") && !model.LabelName(c.TargetLabel).IsValid() {
+			return fmt.Errorf("invalid target_label %q", c.TargetLabel)
+		}
+	case RelabelKeep, RelabelDrop:
+		if len(c.SourceLabels) == 0 {
+			return fmt.Errorf("%s relabel config without source_labels", c.Action)
+		}
+	case RelabelLabelDrop:
+		if len(c.SourceLabels) > 0 || c.TargetLabel != "" {
+			return fmt.Errorf("labeldrop relabel config with source_labels or a target_label")
+		}
+	default:
+		return fmt.Errorf("unknown relabel action %q", c.Action)
+	}
+	return nil
+}
+
+// LoadRelabelConfigs reads the relabel_configs list of the YAML file at path,
+// written like the relabel_configs of a Prometheus scrape config
+func LoadRelabelConfigs(path string) ([]RelabelConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		RelabelConfigs []RelabelConfig `yaml:"relabel_configs"`
+	}
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing relabel configs: %v", err)
+	}
+	for i, config := range file.RelabelConfigs {
+		if err := config.validate(); err != nil {
+			return nil, fmt.Errorf("relabel config %d: %v", i, err)
+		}
+	}
+	return file.RelabelConfigs, nil
+}
+
+// WithRelabelConfigs rewrites the labels of pushed datapoints with configs,
+// in order, dropping datapoints and labels at the edge instead of in every
+// client. Configs apply to names after sanitizing and before normalization.
+// It panics on configs that LoadRelabelConfigs would refuse.
+func WithRelabelConfigs(configs []RelabelConfig) Option {
+	return func(hub *MetricHub) {
+		r, err := newRelabeler(configs)
+		if err != nil {
+			panic(err)
+		}
+		hub.relabeler = r
+	}
+}
+
+func newRelabeler(configs []RelabelConfig) (*relabeler, error) {
+	r := &relabeler{}
+	for i, config := range configs {
+		if err := config.validate(); err != nil {
+			return nil, fmt.Errorf("relabel config %d: %v", i, err)
+		}
+		r.configs = append(r.configs, compiledRelabelConfig{RelabelConfig: config, regex: regexp.MustCompile(anchored(config.Regex))})
+	}
+	return r, nil
+}
+
+func anchored(regex string) string {
+	return "^(?:" + regex + ")$"
+}
+
+type relabeler struct {
+	configs []compiledRelabelConfig
+}
+
+type compiledRelabelConfig struct {
+	RelabelConfig
+	regex *regexp.Regexp
+}
+
+// relabelFamily applies the configs to the metrics of family in place,
+// removing the metrics they drop
+func (r *relabeler) relabelFamily(family *dto.MetricFamily) {
+	kept := family.Metric[:0]
+	for _, metric := range family.Metric {
+		if r.relabelMetric(family.GetName(), metric) {
+			kept = append(kept, metric)
+		}
+	}
+	if dropped := len(family.Metric) - len(kept); dropped > 0 {
+		relabelDroppedDatapoints.WithLabelValues(family.GetName()).Add(float64(dropped))
+		for i := len(kept); i < len(family.Metric); i++ {
+			family.Metric[i] = nil
+		}
+	}
+	family.Metric = kept
+}
+
+// relabelMetric applies the configs to the labels of metric of the family
+// name, and returns whether it is kept
+func (r *relabeler) relabelMetric(name string, metric *dto.Metric) bool {
+	for _, config := range r.configs {
+		switch config.Action {
+		case RelabelReplace:
+			value := sourceValue(name, metric, config.SourceLabels, config.Separator)
+			indexes := config.regex.FindStringSubmatchIndex(value)
+			if indexes == nil {
+				continue
+			}
+			target := string(config.regex.ExpandString(nil, config.TargetLabel, value, indexes))
+			replacement := string(config.regex.ExpandString(nil, config.Replacement, value, indexes))
+			if !model.LabelName(target).IsValid() || target == model.MetricNameLabel || replacement == "" {
+				metric.Label = removeLabels(metric.Label, func(label string) bool { return label == target })
+				continue
+			}
+			setLabel(metric, target, replacement)
+		case RelabelKeep:
+			if !config.regex.MatchString(sourceValue(name, metric, config.SourceLabels, config.Separator)) {
+				return false
+			}
+		case RelabelDrop:
+			if config.regex.MatchString(sourceValue(name, metric, config.SourceLabels, config.Separator)) {
+				return false
+			}
+		case RelabelLabelDrop:
+			metric.Label = removeLabels(metric.Label, config.regex.MatchString)
+		}
+	}
+	return true
+}
+
+// sourceValue joins the values of labels of metric of the family name with
+// separator. Labels the metric doesn't have are empty.
+func sourceValue(name string, metric *dto.Metric, labels []string, separator string) string {
+	values := make([]string, len(labels))
+	for i, label := range labels {
+		if label == model.MetricNameLabel {
+			values[i] = name
+			continue
+		}
+		values[i], _ = labelValue(metric, label)
+	}
+	return strings.Join(values, separator)
+}
+
+func setLabel(metric *dto.Metric, name, value string) {
+	for _, label := range metric.Label {
+		if label.GetName() == name {
+			label.Value = proto.String(value)
+			return
+		}
+	}
+	metric.Label = append(metric.Label, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+}
+
+// removeLabels returns labels without those whose name matches
+func removeLabels(labels []*dto.LabelPair, matches func(string) bool) []*dto.LabelPair {
+	kept := labels[:0]
+	for _, label := range labels {
+		if !matches(label.GetName()) {
+			kept = append(kept, label)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRelabelConfigs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "relabel")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	load := func(configs string) ([]RelabelConfig, error) {
+		path := filepath.Join(dir, "relabel.yml")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(configs), 0644))
+		return LoadRelabelConfigs(path)
+	}
+
+	configs, err := load(`relabel_configs:
+  - source_labels: [gateway_id]
+    target_label: gatewayID
+  - action: labeldrop
+    regex: gateway_id
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []RelabelConfig{
+		{SourceLabels: []string{"gateway_id"}, Separator: ";", Regex: "(.*)", TargetLabel: "gatewayID", Replacement: "$1", Action: RelabelReplace},
+		{Separator: ";", Regex: "gateway_id", Replacement: "$1", Action: RelabelLabelDrop},
+	}, configs)
+
+	for _, invalid := range []string{
+		"relabel_configs:\n  - source_labels: [a]\n",
+		"relabel_configs:\n  - source_labels: [a]\n    target_label: __name__\n",
+		"relabel_configs:\n  - action: keep\n",
+		"relabel_configs:\n  - action: labeldrop\n    target_label: a\n",
+		"relabel_configs:\n  - action: hashmod\n    source_labels: [a]\n",
+		"relabel_configs:\n  - action: drop\n    source_labels: [a]\n    regex: '('\n",
+		"relabel_configs:\n  - action: drop\n    source_label: [a]\n",
+	} {
+		_, err := load(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRelabel(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithRelabelConfigs([]RelabelConfig{
+		{SourceLabels: []string{"gateway_id"}, Separator: ";", Regex: "(.+)", TargetLabel: "gatewayID", Replacement: "$1", Action: RelabelReplace},
+		{SourceLabels: []string{"__name__", "env"}, Separator: ";", Regex: "up;test", Action: RelabelDrop},
+		{SourceLabels: []string{"region"}, Separator: ";", Regex: "us-(.*)", TargetLabel: "zone", Replacement: "${1}-zone", Action: RelabelReplace},
+		{Regex: "gateway_id|session_.*", Action: RelabelLabelDrop},
+		{SourceLabels: []string{"__name__"}, Regex: "up|requests_total", Action: RelabelKeep},
+	}))
+
+	rec, err := receiveString(hub, `# TYPE up gauge
+up{gateway_id="gw1",session_id="123"} 1 1000
+up{gatewayID="gw2",env="test"} 1 1000
+up{gatewayID="gw3",region="us-east"} 1 1000
+# TYPE other gauge
+other 1 1000
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, `# TYPE up gauge
+up{gatewayID="gw1"} 1 1000
+up{gatewayID="gw3",region="us-east",zone="east-zone"} 1 1000
+`, scrape(t, hub))
+	assert.Contains(t, hub.Capabilities().Features, FeatureRelabeling)
+}
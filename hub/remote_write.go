@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/grpc/prompb"
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// remoteWriteMaxSamples is the max number of samples in a single remote
+	// write request, so a full hub doesn't exceed the request size limits of
+	// remote storage
+	remoteWriteMaxSamples = 5000
+	remoteWriteMaxRetries = 3
+	remoteWriteMinBackoff = 100 * time.Millisecond
+	remoteWriteMaxBackoff = 5 * time.Second
+)
+
+var (
+	remoteWriteRetries        = prometheus.NewCounter(prometheus.CounterOpts{Name: "remote_write_retries_total", Help: "Number of remote write requests retried after a recoverable error"})
+	remoteWriteDroppedSamples = prometheus.NewCounter(prometheus.CounterOpts{Name: "remote_write_dropped_samples_total", Help: "Number of samples dropped because the remote write endpoint refused them as invalid"})
+)
+
+func init() {
+	prometheus.MustRegister(remoteWriteRetries, remoteWriteDroppedSamples)
+}
+
+// WithRemoteWrite makes the hub send its contents to a Prometheus remote_write
+// endpoint at url (e.g. http://cortex/api/v1/push) every RunForwarding
+// interval, for deployments without a Prometheus scraping the hub. Unlike
+// with WithUpstream, pushes are stored in the hub until the next send.
+func WithRemoteWrite(url string, timeout time.Duration) Option {
+	return func(hub *MetricHub) {
+		hub.upstream = &remoteWriteUpstream{
+			url:        url,
+			client:     &http.Client{Timeout: timeout},
+			minBackoff: remoteWriteMinBackoff,
+			maxBackoff: remoteWriteMaxBackoff,
+		}
+		hub.periodicUpstream = true
+	}
+}
+
+// remoteWriteUpstream sends families as snappy compressed protobuf
+// WriteRequests, retrying recoverable errors with exponential backoff
+type remoteWriteUpstream struct {
+	url        string
+	client     *http.Client
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	// clock is the hub clock, which stamps datapoints without timestamps and
+	// times the backoff
+	clock Clock
+}
+
+func (u *remoteWriteUpstream) send(batch *forwardBatch) error {
+	requests := toWriteRequests(batch.families, u.clock.Now(), remoteWriteMaxSamples)
+	var dropped error
+	for i, req := range requests {
+		err := u.write(req)
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(*permanentError); ok {
+			// the other requests may still be valid
+			remoteWriteDroppedSamples.Add(float64(countSamples(req)))
+			logging.Error("Dropping remote write request", "request", i+1, "requests", len(requests), "err", err)
+			dropped = err
+			continue
+		}
+		if i > 0 {
+			// resending the requests already written is harmless, since
+			// remote storage ignores samples identical to stored ones
+			return &uncertainError{err: err}
+		}
+		return err
+	}
+	if dropped != nil && len(requests) == 1 {
+		return dropped
+	}
+	return nil
+}
+
+// write sends req, retrying on network errors, 5xx and 429 responses
+func (u *remoteWriteUpstream) write(req *prompb.WriteRequest) error {
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return &permanentError{err: fmt.Errorf("error encoding write request: %v", err)}
+	}
+	body := snappy.Encode(nil, data)
+
+	backoff := u.minBackoff
+	for attempt := 0; ; attempt++ {
+		err = u.post(body)
+		if _, ok := err.(*permanentError); ok || err == nil || attempt == remoteWriteMaxRetries {
+			return err
+		}
+		remoteWriteRetries.Inc()
+		logging.Warn("Retrying remote write", "backoff", backoff, "err", err)
+		sleep(u.clock, backoff)
+		backoff *= 2
+		if backoff > u.maxBackoff {
+			backoff = u.maxBackoff
+		}
+	}
+}
+
+func (u *remoteWriteUpstream) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, u.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	req.Header.Set(echo.HeaderContentEncoding, "snappy")
+	req.Header.Set(echo.HeaderContentType, "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return &uncertainError{err: err}
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	switch {
+	case resp.StatusCode/100 == 2:
+		return nil
+	case resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests:
+		return &permanentError{err: fmt.Errorf("remote write endpoint refused samples: %d %s", resp.StatusCode, msg)}
+	}
+	return fmt.Errorf("remote write endpoint responded %d: %s", resp.StatusCode, msg)
+}
+
+// toWriteRequests converts families to WriteRequests of at most maxSamples
+// samples each. Datapoints of the same series become samples of one time
+// series, and datapoints without a timestamp get now.
+func toWriteRequests(families []*dto.MetricFamily, now time.Time, maxSamples int) []*prompb.WriteRequest {
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	req := &prompb.WriteRequest{}
+	requests := []*prompb.WriteRequest{req}
+	samples := 0
+	for _, family := range families {
+		if len(family.Metric) == 0 {
+			continue
+		}
+		req.Metadata = append(req.Metadata, &prompb.MetricMetadata{
+			Type:             remoteWriteType(family.GetType()),
+			MetricFamilyName: family.GetName(),
+			Help:             family.GetHelp(),
+		})
+
+		series := make(map[string]*prompb.TimeSeries)
+		var order []*prompb.TimeSeries
+		for _, metric := range family.Metric {
+			timestampMs := nowMs
+			if metric.TimestampMs != nil {
+				timestampMs = metric.GetTimestampMs()
+			}
+			flattenMetric(family.GetType(), metric, func(suffix string, value float64, extraLabel, extraValue string) error {
+				labels := remoteWriteLabels(family.GetName()+suffix, metric.Label, extraLabel, extraValue)
+				key := labelsKey(labels)
+				ts, ok := series[key]
+				if !ok {
+					ts = &prompb.TimeSeries{Labels: labels}
+					series[key] = ts
+					order = append(order, ts)
+				}
+				ts.Samples = append(ts.Samples, &prompb.Sample{Value: value, Timestamp: timestampMs})
+				return nil
+			})
+		}
+
+		for _, ts := range order {
+			sort.Slice(ts.Samples, func(i, j int) bool {
+				return ts.Samples[i].Timestamp < ts.Samples[j].Timestamp
+			})
+			if samples > 0 && samples+len(ts.Samples) > maxSamples {
+				req = &prompb.WriteRequest{}
+				requests = append(requests, req)
+				samples = 0
+			}
+			req.Timeseries = append(req.Timeseries, ts)
+			samples += len(ts.Samples)
+		}
+	}
+	return requests
+}
+
+// remoteWriteLabels returns the labels of a sample sorted by name, as remote
+// storage expects
+func remoteWriteLabels(name string, pairs []*dto.LabelPair, extraLabel, extraValue string) []*prompb.Label {
+	labels := make([]*prompb.Label, 0, len(pairs)+2)
+	labels = append(labels, &prompb.Label{Name: "__name__", Value: name})
+	for _, pair := range pairs {
+		labels = append(labels, &prompb.Label{Name: pair.GetName(), Value: pair.GetValue()})
+	}
+	if extraLabel != "" {
+		labels = append(labels, &prompb.Label{Name: extraLabel, Value: extraValue})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	return labels
+}
+
+func labelsKey(labels []*prompb.Label) string {
+	var key bytes.Buffer
+	for _, label := range labels {
+		key.WriteString(label.Name)
+		key.WriteByte(0)
+		key.WriteString(label.Value)
+		key.WriteByte(0)
+	}
+	return key.String()
+}
+
+func remoteWriteType(metricType dto.MetricType) prompb.MetricMetadata_MetricType {
+	switch metricType {
+	case dto.MetricType_COUNTER:
+		return prompb.MetricMetadata_COUNTER
+	case dto.MetricType_GAUGE:
+		return prompb.MetricMetadata_GAUGE
+	case dto.MetricType_SUMMARY:
+		return prompb.MetricMetadata_SUMMARY
+	case dto.MetricType_HISTOGRAM:
+		return prompb.MetricMetadata_HISTOGRAM
+	}
+	return prompb.MetricMetadata_UNKNOWN
+}
+
+func countSamples(req *prompb.WriteRequest) int {
+	samples := 0
+	for _, ts := range req.Timeseries {
+		samples += len(ts.Samples)
+	}
+	return samples
+}
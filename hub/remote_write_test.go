@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/grpc/prompb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+// remoteWriteReceiver decodes the remote write requests it receives,
+// responding with the next of statuses, or 200 once they are used up
+type remoteWriteReceiver struct {
+	sync.Mutex
+	statuses []int
+	requests []*prompb.WriteRequest
+}
+
+func (r *remoteWriteReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+	}
+
+	compressed, _ := ioutil.ReadAll(req.Body)
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil || req.Header.Get("Content-Encoding") != "snappy" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	writeRequest := &prompb.WriteRequest{}
+	if err := proto.Unmarshal(data, writeRequest); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.requests = append(r.requests, writeRequest)
+}
+
+func (r *remoteWriteReceiver) samples() int {
+	r.Lock()
+	defer r.Unlock()
+	samples := 0
+	for _, req := range r.requests {
+		samples += countSamples(req)
+	}
+	return samples
+}
+
+func startRemoteWrite(statuses ...int) (*remoteWriteReceiver, *httptest.Server, *MetricHub) {
+	receiver := &remoteWriteReceiver{statuses: statuses}
+	server := httptest.NewServer(receiver)
+	hub := NewMetricHub(0, 10, WithRemoteWrite(server.URL, time.Second))
+	hub.upstream.(*remoteWriteUpstream).minBackoff = time.Millisecond
+	return receiver, server, hub
+}
+
+func TestRemoteWrite(t *testing.T) {
+	receiver, server, hub := startRemoteWrite()
+	defer server.Close()
+
+	// pushes are stored until the next flush
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, 14, hub.Status().Datapoints)
+	assert.Equal(t, 0, receiver.samples())
+
+	hub.flushToUpstream()
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, 14, receiver.samples())
+
+	assert.Equal(t, 1, len(receiver.requests))
+	req := receiver.requests[0]
+	assert.Equal(t, 3, len(req.Metadata))
+	// one time series per series, with its datapoints in timestamp order
+	assert.Equal(t, 5, len(req.Timeseries))
+	for _, ts := range req.Timeseries {
+		for i := 1; i < len(ts.Samples); i++ {
+			assert.True(t, ts.Samples[i-1].Timestamp <= ts.Samples[i].Timestamp)
+		}
+	}
+}
+
+func TestRemoteWriteRetries(t *testing.T) {
+	receiver, server, hub := startRemoteWrite(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	defer server.Close()
+
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	hub.flushToUpstream()
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, 14, receiver.samples())
+}
+
+func TestRemoteWriteRequeuesAfterRetries(t *testing.T) {
+	statuses := make([]int, remoteWriteMaxRetries+1)
+	for i := range statuses {
+		statuses[i] = http.StatusInternalServerError
+	}
+	receiver, server, hub := startRemoteWrite(statuses...)
+	defer server.Close()
+
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	hub.flushToUpstream()
+	assert.Equal(t, 14, hub.Status().Datapoints)
+	assert.Equal(t, 0, receiver.samples())
+
+	hub.flushToUpstream()
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, 14, receiver.samples())
+}
+
+func TestRemoteWriteDropsInvalidSamples(t *testing.T) {
+	receiver, server, hub := startRemoteWrite(http.StatusBadRequest)
+	defer server.Close()
+
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	hub.flushToUpstream()
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, 0, receiver.samples())
+}
+
+func TestToWriteRequests(t *testing.T) {
+	var parser expfmt.TextParser
+	parsed, err := parser.TextToMetricFamilies(strings.NewReader(`# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.5",host="A"} 2 1000
+latency_seconds_bucket{le="1",host="A"} 3 1000
+latency_seconds_sum{host="A"} 1.5 1000
+latency_seconds_count{host="A"} 3 1000
+# TYPE up gauge
+up{host="A"} 1
+`))
+	assert.NoError(t, err)
+	now := time.Unix(5, 0)
+
+	requests := toWriteRequests([]*dto.MetricFamily{parsed["latency_seconds"], parsed["up"]}, now, 3)
+	assert.Equal(t, 2, len(requests))
+	var series []*prompb.TimeSeries
+	for _, req := range requests {
+		assert.True(t, countSamples(req) <= 3)
+		series = append(series, req.Timeseries...)
+	}
+
+	assert.Equal(t, 6, len(series))
+	assert.Equal(t, []*prompb.Label{
+		{Name: "__name__", Value: "latency_seconds_bucket"},
+		{Name: "host", Value: "A"},
+		{Name: "le", Value: "0.5"},
+	}, series[0].Labels)
+	assert.Equal(t, []*prompb.Sample{{Value: 2, Timestamp: 1000}}, series[0].Samples)
+	assert.Equal(t, "+Inf", series[2].Labels[2].Value)
+	assert.Equal(t, []*prompb.Sample{{Value: 3, Timestamp: 1000}}, series[2].Samples)
+	assert.Equal(t, "latency_seconds_count", series[4].Labels[0].Value)
+	assert.Equal(t, prompb.MetricMetadata_HISTOGRAM, requests[0].Metadata[0].Type)
+
+	// datapoints without a timestamp get the time of the flush
+	assert.Equal(t, "up", series[5].Labels[0].Value)
+	assert.Equal(t, []*prompb.Sample{{Value: 1, Timestamp: 5000}}, series[5].Samples)
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/labstack/echo"
+)
+
+// RequestLogMiddleware returns echo middleware that logs every request with
+// its method, route, status, latency and sizes. Requests are logged at debug
+// level, client errors at warn and server errors at error, so a busy hub only
+// logs failures at the default level. It must come before the other
+// middleware, so the status it logs is the one they produced.
+func RequestLogMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			t0 := time.Now()
+			req := ctx.Request()
+			body := &countingReader{ReadCloser: req.Body}
+			req.Body = body
+
+			err := next(ctx)
+			if err != nil {
+				ctx.Error(err)
+			}
+
+			status := ctx.Response().Status
+			level := logging.LevelDebug
+			switch {
+			case status >= http.StatusInternalServerError:
+				level = logging.LevelError
+			case status >= http.StatusBadRequest:
+				level = logging.LevelWarn
+			}
+			if !logging.Enabled(level) {
+				return nil
+			}
+			keyvals := []interface{}{
+				"method", req.Method,
+				"handler", ctx.Path(),
+				"uri", req.RequestURI,
+				"remote", ctx.RealIP(),
+				"status", status,
+				"latency_seconds", time.Since(t0).Seconds(),
+				"bytes_in", body.n,
+				"bytes_out", ctx.Response().Size,
+			}
+			if err != nil {
+				keyvals = append(keyvals, "err", err)
+			}
+			logging.Log(level, "Handled HTTP request", keyvals...)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLogMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	defer logging.SetOutput(os.Stderr)
+	defer logging.Configure(logging.LevelInfo, logging.FormatConsole)
+
+	logging.Configure(logging.LevelWarn, logging.FormatJSON)
+	hub := NewMetricHub(0, 10)
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.Use(RequestLogMiddleware())
+	e.Use(HTTPMetricsMiddleware())
+	e.POST("/metrics", hub.Receive)
+
+	serve(e, httptest.NewRequest(http.MethodPost, "/metrics", bytes.NewBufferString("up 1\n")))
+	assert.Empty(t, buf.String())
+	serve(e, httptest.NewRequest(http.MethodPost, "/metrics?x=1", bytes.NewBufferString("up{")))
+	serve(e, httptest.NewRequest(http.MethodGet, "/nope", nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !assert.Len(t, lines, 2) {
+		return
+	}
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "warn", entry["level"])
+	assert.Equal(t, "Handled HTTP request", entry["msg"])
+	assert.Equal(t, "POST", entry["method"])
+	assert.Equal(t, "/metrics", entry["handler"])
+	assert.Equal(t, "/metrics?x=1", entry["uri"])
+	assert.Equal(t, float64(400), entry["status"])
+	assert.Equal(t, float64(3), entry["bytes_in"])
+	assert.Contains(t, entry, "latency_seconds")
+	assert.Contains(t, entry, "bytes_out")
+
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, float64(404), entry["status"])
+
+	buf.Reset()
+	logging.Configure(logging.LevelDebug, logging.FormatJSON)
+	serve(e, httptest.NewRequest(http.MethodPost, "/metrics", bytes.NewBufferString("up 1\n")))
+	assert.Contains(t, buf.String(), `"level":"debug"`)
+	assert.Contains(t, buf.String(), `"status":200`)
+}
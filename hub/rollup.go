@@ -0,0 +1,251 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+var rollupSeries = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "rollup_series", Help: "Number of series emitted by each rollup in the last scrape"}, []string{"rollup"})
+
+func init() {
+	prometheus.MustRegister(rollupSeries)
+}
+
+// RollupOp is how a rollup combines the series of its family
+type RollupOp string
+
+const (
+	// RollupSum adds up the latest value of every series
+	RollupSum RollupOp = "sum"
+	// RollupMin is the lowest latest value of any series
+	RollupMin RollupOp = "min"
+	// RollupMax is the highest latest value of any series
+	RollupMax RollupOp = "max"
+	// RollupCount is the number of series
+	RollupCount RollupOp = "count"
+	// RollupCountDistinct is the number of distinct values of Label, e.g. the
+	// number of gateways that pushed the family
+	RollupCountDistinct RollupOp = "count_distinct"
+)
+
+// Rollup emits a gauge family Name in every scrape, with one series per
+// distinct value of the By labels, combining the series of Family drained by
+// the scrape with Op. Central Prometheus can then alert on fleet-level
+// signals without ingesting the series of every device.
+type Rollup struct {
+	Name   string   `yaml:"name"`
+	Family string   `yaml:"family"`
+	Op     RollupOp `yaml:"op"`
+	// Label is the label whose values count_distinct counts
+	Label string   `yaml:"label,omitempty"`
+	By    []string `yaml:"by,flow,omitempty"`
+}
+
+// validate returns an error if r can't be evaluated
+func (r Rollup) validate() error {
+	if !model.IsValidMetricName(model.LabelValue(r.Name)) {
+		return fmt.Errorf("invalid rollup name %q", r.Name)
+	}
+	if r.Family == "" {
+		return fmt.Errorf("rollup %s without a family", r.Name)
+	}
+	if r.Family == r.Name {
+		return fmt.Errorf("rollup %s can't have the name of its family", r.Name)
+	}
+	switch r.Op {
+	case RollupSum, RollupMin, RollupMax, RollupCount:
+	case RollupCountDistinct:
+		if r.Label == "" {
+			return fmt.Errorf("count_distinct rollup %s without a label", r.Name)
+		}
+	default:
+		return fmt.Errorf("unknown op %q of rollup %s: must be sum, min, max, count or count_distinct", r.Op, r.Name)
+	}
+	for _, label := range r.By {
+		if !model.LabelName(label).IsValid() {
+			return fmt.Errorf("invalid by label %q of rollup %s", label, r.Name)
+		}
+	}
+	return nil
+}
+
+// validateRollups returns an error if any of rollups is invalid, two of them
+// have the same name, or one rolls up another, which would depend on the
+// order they are evaluated in
+func validateRollups(rollups []Rollup) error {
+	names := make(map[string]bool, len(rollups))
+	for _, rollup := range rollups {
+		if err := rollup.validate(); err != nil {
+			return err
+		}
+		if names[rollup.Name] {
+			return fmt.Errorf("duplicate rollup %s", rollup.Name)
+		}
+		names[rollup.Name] = true
+	}
+	for _, rollup := range rollups {
+		if names[rollup.Family] {
+			return fmt.Errorf("rollup %s can't roll up rollup %s", rollup.Name, rollup.Family)
+		}
+	}
+	return nil
+}
+
+// WithRollups emits the rollups in every scrape. Panics if any of them is
+// invalid.
+func WithRollups(rollups []Rollup) Option {
+	if err := validateRollups(rollups); err != nil {
+		panic(err)
+	}
+	return func(hub *MetricHub) {
+		hub.rollups = rollups
+	}
+}
+
+// currentRollups returns the rollups, which a config reload may replace
+func (c *MetricHub) currentRollups() []Rollup {
+	c.configLock.RLock()
+	defer c.configLock.RUnlock()
+	return c.rollups
+}
+
+// isRollup returns whether name is the family of a rollup
+func (c *MetricHub) isRollup(name string) bool {
+	for _, rollup := range c.currentRollups() {
+		if rollup.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// rollupGroup is the state of a series of a rollup
+type rollupGroup struct {
+	labels   []*dto.LabelPair
+	value    float64
+	count    int
+	distinct map[string]bool
+}
+
+// family returns the family r emits for the series of drained at now, or nil
+// if drained has no series of its family
+func (r Rollup) family(drained *familyAndMetrics, now time.Time) *dto.MetricFamily {
+	groups := make(map[string]*rollupGroup)
+	for _, queue := range drained.metrics {
+		if len(queue.samples) == 0 {
+			continue
+		}
+		latest := queue.samples[len(queue.samples)-1]
+		if r.Op != RollupCount && r.Op != RollupCountDistinct && latest.kind != sampleCounter && latest.kind != sampleGauge && latest.kind != sampleUntyped {
+			// summaries and histograms have no single value to combine
+			continue
+		}
+		var key strings.Builder
+		labels := make([]*dto.LabelPair, 0, len(r.By))
+		distinct := ""
+		for _, name := range r.By {
+			value, _ := seriesLabelValue(queue, name)
+			key.WriteString(value)
+			key.WriteByte(0)
+			if value != "" {
+				labels = append(labels, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+			}
+		}
+		if r.Op == RollupCountDistinct {
+			if distinct, _ = seriesLabelValue(queue, r.Label); distinct == "" {
+				continue
+			}
+		}
+		group, ok := groups[key.String()]
+		if !ok {
+			group = &rollupGroup{labels: sortedLabels(labels), distinct: make(map[string]bool)}
+			groups[key.String()] = group
+		}
+		switch r.Op {
+		case RollupSum:
+			group.value += latest.value
+		case RollupMin:
+			if group.count == 0 || latest.value < group.value {
+				group.value = latest.value
+			}
+		case RollupMax:
+			if group.count == 0 || latest.value > group.value {
+				group.value = latest.value
+			}
+		case RollupCountDistinct:
+			group.distinct[distinct] = true
+		}
+		group.count++
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	family := &dto.MetricFamily{
+		Name: proto.String(r.Name),
+		Help: proto.String(fmt.Sprintf("Rollup %s of %s", r.Op, r.Family)),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+	for _, key := range keys {
+		group := groups[key]
+		value := group.value
+		switch r.Op {
+		case RollupCount:
+			value = float64(group.count)
+		case RollupCountDistinct:
+			value = float64(len(group.distinct))
+		}
+		family.Metric = append(family.Metric, &dto.Metric{
+			Label:       group.labels,
+			Gauge:       &dto.Gauge{Value: proto.Float64(value)},
+			TimestampMs: proto.Int64(nowMs),
+		})
+	}
+	return family
+}
+
+// addRollups adds the families of the rollups of class to the scrape of
+// drained at now
+func (c *MetricHub) addRollups(drained map[string]*familyAndMetrics, class ScrapeClass, now time.Time) {
+	for _, rollup := range c.currentRollups() {
+		if !c.inScrapeClass(rollup.Name, class) {
+			continue
+		}
+		source, ok := drained[rollup.Family]
+		if !ok {
+			rollupSeries.WithLabelValues(rollup.Name).Set(0)
+			continue
+		}
+		family := rollup.family(source, now)
+		if family == nil {
+			rollupSeries.WithLabelValues(rollup.Name).Set(0)
+			continue
+		}
+		rollupSeries.WithLabelValues(rollup.Name).Set(float64(len(family.Metric)))
+		if existing, ok := drained[rollup.Name]; ok {
+			existing.addMetrics(family.Metric, false, 0)
+		} else {
+			drained[rollup.Name] = newFamilyAndMetrics(family, now)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const rollupPush = `bytes_total{networkID="n1",gatewayID="g1"} 10 1000
+bytes_total{networkID="n1",gatewayID="g1"} 15 2000
+bytes_total{networkID="n1",gatewayID="g2"} 5 1000
+bytes_total{networkID="n2",gatewayID="g3"} 7 1000
+`
+
+func TestRollups(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithRollups([]Rollup{
+		{Name: "site_gateways", Family: "bytes_total", Op: RollupCountDistinct, Label: "gatewayID", By: []string{"networkID"}},
+		{Name: "site_bytes_total", Family: "bytes_total", Op: RollupSum, By: []string{"networkID"}},
+		{Name: "fleet_bytes_total", Family: "bytes_total", Op: RollupSum},
+		{Name: "fleet_bytes_max", Family: "bytes_total", Op: RollupMax},
+		{Name: "fleet_bytes_min", Family: "bytes_total", Op: RollupMin},
+		{Name: "fleet_series", Family: "bytes_total", Op: RollupCount},
+		{Name: "absent", Family: "missing", Op: RollupCount},
+	}))
+	_, err := receiveString(hub, rollupPush)
+	assert.NoError(t, err)
+
+	exposition := scrape(t, hub)
+	assert.Contains(t, exposition, "# TYPE site_gateways gauge\n")
+	assert.Equal(t, map[string]float64{"networkID=n1": 2, "networkID=n2": 1}, gaugeValues(t, exposition, "site_gateways"))
+	// only the latest datapoint of a series counts
+	assert.Equal(t, map[string]float64{"networkID=n1": 20, "networkID=n2": 7}, gaugeValues(t, exposition, "site_bytes_total"))
+	assert.Equal(t, map[string]float64{"": 27}, gaugeValues(t, exposition, "fleet_bytes_total"))
+	assert.Equal(t, map[string]float64{"": 15}, gaugeValues(t, exposition, "fleet_bytes_max"))
+	assert.Equal(t, map[string]float64{"": 5}, gaugeValues(t, exposition, "fleet_bytes_min"))
+	assert.Equal(t, map[string]float64{"": 3}, gaugeValues(t, exposition, "fleet_series"))
+	assert.NotContains(t, exposition, "absent")
+	// the device series are still served
+	assert.Contains(t, exposition, `bytes_total{gatewayID="g3",networkID="n2"} 7 1000`)
+	assert.Contains(t, hub.Capabilities().Features, FeatureRollups)
+
+	// rollups are of what each scrape drains
+	assert.Equal(t, "", scrape(t, hub))
+}
+
+func TestRollupsDropPushedNames(t *testing.T) {
+	hub := NewMetricHub(0, 10,
+		WithRollups([]Rollup{{Name: "fleet_bytes_total", Family: "bytes_total", Op: RollupSum}}),
+		WithCounterIncrease(regexp.MustCompile("^bytes_total$")),
+		WithSourceHeartbeats("gatewayID"),
+	)
+	dropped := testutil.ToFloat64(synthesizedNameDropped)
+	_, err := receiveString(hub, rollupPush+"fleet_bytes_total 100 1000\nbytes_total:increase 100 1000\n"+heartbeatFamilyName+" 100 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, hub.Status().Datapoints)
+	assert.Equal(t, dropped+3, testutil.ToFloat64(synthesizedNameDropped))
+
+	// only the synthesized families are served under their names
+	exposition := scrape(t, hub)
+	assert.Equal(t, map[string]float64{"": 27}, gaugeValues(t, exposition, "fleet_bytes_total"))
+	assert.NotContains(t, exposition, "bytes_total:increase 100")
+	assert.NotContains(t, exposition, heartbeatFamilyName+" 100")
+}
+
+func TestRollupsNotRetained(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithScrapeRetention(2), WithRollups([]Rollup{
+		{Name: "fleet_bytes_total", Family: "bytes_total", Op: RollupSum},
+	}))
+	_, err := receiveString(hub, rollupPush)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"": 27}, gaugeValues(t, scrapeURL(t, hub, "/metrics?consumer=prom-0").Body.String(), "fleet_bytes_total"))
+
+	// the retained datapoints are served again, but not rolled up again
+	exposition := scrapeURL(t, hub, "/metrics?consumer=prom-1").Body.String()
+	assert.Contains(t, exposition, "bytes_total{")
+	assert.NotContains(t, exposition, "fleet_bytes_total")
+}
+
+func TestRollupsConfig(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	rollups := []Rollup{{Name: "fleet_series", Family: "bytes_total", Op: RollupCount}}
+	assert.NoError(t, hub.ApplyConfig(Config{Rollups: &rollups}))
+	_, err := receiveString(hub, rollupPush)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"": 3}, gaugeValues(t, scrape(t, hub), "fleet_series"))
+
+	invalid := []Rollup{{Name: "fleet_series", Family: "bytes_total", Op: "avg"}}
+	assert.Error(t, hub.ApplyConfig(Config{Rollups: &invalid}))
+	assert.Equal(t, rollups, hub.currentRollups())
+
+	assert.NoError(t, hub.ApplyConfig(Config{Rollups: &[]Rollup{}}))
+	assert.NotContains(t, hub.Capabilities().Features, FeatureRollups)
+}
+
+func TestRollupsConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rollups")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yml")
+	writeConfigFile(t, path, `
+rollups:
+  - name: site_gateways
+    family: bytes_total
+    op: count_distinct
+    label: gatewayID
+    by: [networkID]
+`)
+	config, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, &[]Rollup{{Name: "site_gateways", Family: "bytes_total", Op: RollupCountDistinct, Label: "gatewayID", By: []string{"networkID"}}}, config.Rollups)
+
+	writeConfigFile(t, path, "rollups: [{name: fleet, family: bytes_total, op: avg}]\n")
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+}
+
+func TestRollupHistograms(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithRollups([]Rollup{
+		{Name: "fleet_latency_sum", Family: "latency", Op: RollupSum},
+		{Name: "latency_series", Family: "latency", Op: RollupCount},
+	}))
+	_, err := receiveString(hub, "# TYPE latency histogram\nlatency_bucket{le=\"1\"} 1\nlatency_bucket{le=\"+Inf\"} 2\nlatency_sum 3\nlatency_count 2\n")
+	assert.NoError(t, err)
+	exposition := scrape(t, hub)
+	// histograms have no value to sum, but can be counted
+	assert.NotContains(t, exposition, "fleet_latency_sum")
+	assert.Equal(t, map[string]float64{"": 1}, gaugeValues(t, exposition, "latency_series"))
+}
+
+func TestRollupValidate(t *testing.T) {
+	for _, rollup := range []Rollup{
+		{Name: "", Family: "a", Op: RollupSum},
+		{Name: "b", Family: "", Op: RollupSum},
+		{Name: "a", Family: "a", Op: RollupSum},
+		{Name: "b", Family: "a", Op: "avg"},
+		{Name: "b", Family: "a", Op: RollupCountDistinct},
+		{Name: "b", Family: "a", Op: RollupSum, By: []string{"not-a-label"}},
+	} {
+		assert.Error(t, rollup.validate(), rollup.Name)
+	}
+	assert.Error(t, validateRollups([]Rollup{{Name: "b", Family: "a", Op: RollupSum}, {Name: "b", Family: "c", Op: RollupSum}}))
+	assert.Error(t, validateRollups([]Rollup{{Name: "c", Family: "b", Op: RollupSum}, {Name: "b", Family: "a", Op: RollupSum}}))
+	assert.Panics(t, func() { WithRollups([]Rollup{{Name: "a", Family: "a", Op: RollupSum}}) })
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	// runtimeFamilyPrefixes are the prefixes of the families registered by
+	// the default Go and process collectors of client_golang
+	runtimeFamilyPrefixes = []string{"go_", "process_"}
+
+	droppedRuntimeDatapoints = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "dropped_runtime_datapoints_total", Help: "Number of pushed Go and process collector datapoints dropped"}, []string{"prefix"})
+)
+
+func init() {
+	prometheus.MustRegister(droppedRuntimeDatapoints)
+}
+
+// WithRuntimeMetricsDropped makes the hub drop the go_* and process_* families
+// that client_golang pushes by default. They take up a lot of the hub but are
+// rarely looked at centrally.
+func WithRuntimeMetricsDropped() Option {
+	return func(hub *MetricHub) {
+		hub.dropRuntimeMetrics = true
+	}
+}
+
+// dropRuntimeFamily empties family if it comes from a Go or process collector
+func dropRuntimeFamily(family *dto.MetricFamily) {
+	for _, prefix := range runtimeFamilyPrefixes {
+		if strings.HasPrefix(family.GetName(), prefix) {
+			droppedRuntimeDatapoints.WithLabelValues(prefix).Add(float64(len(family.Metric)))
+			family.Metric = nil
+			return
+		}
+	}
+}
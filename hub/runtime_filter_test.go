@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropRuntimeMetrics(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithRuntimeMetricsDropped())
+	droppedBefore := testutil.ToFloat64(droppedRuntimeDatapoints.WithLabelValues("go_"))
+
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{
+		makeFamily(dto.MetricType_GAUGE, "go_goroutines", 3, []*dto.LabelPair{}, 1),
+		makeFamily(dto.MetricType_GAUGE, "process_open_fds", 1, []*dto.LabelPair{}, 1),
+		makeFamily(dto.MetricType_GAUGE, "gateway_cpu", 2, []*dto.LabelPair{}, 1),
+	})
+
+	assert.Equal(t, 2, result.AcceptedDatapoints)
+	assert.Equal(t, 1, len(hub.metricFamiliesByName))
+	assert.Equal(t, 1, hub.stats.currentCountFamilies)
+	assert.Equal(t, droppedBefore+3, testutil.ToFloat64(droppedRuntimeDatapoints.WithLabelValues("go_")))
+	assert.Equal(t, "# HELP gateway_cpu gateway_cpu\n# TYPE gateway_cpu gauge\ngateway_cpu 0 1\ngateway_cpu 1 1\n", scrape(t, hub))
+}
+
+func TestKeepRuntimeMetricsByDefault(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "go_goroutines", 3, []*dto.LabelPair{}, 1)})
+	assert.Equal(t, 3, result.AcceptedDatapoints)
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// originalNameLabel records the metric name as it was pushed when the
+	// sanitizer had to rewrite it. Names starting with __ are reserved by
+	// Prometheus, which drops such labels at ingestion.
+	originalNameLabel = "original_name"
+	// originalLabelPrefix is prepended to a rewritten label name for the label
+	// recording the original name
+	originalLabelPrefix = "original_"
+)
+
+// WithNameSanitizer enables rewriting of metric and label names that contain
+// characters not allowed by Prometheus. Invalid characters are replaced with
+// replacement, and the original names are kept in labels so nothing is lost.
+// Only protobuf pushes, over HTTP or gRPC, and imports can carry such names,
+// since the text format parser rejects them before they are sanitized. Panics
+// if replacement is invalid.
+func WithNameSanitizer(replacement string) Option {
+	if err := ValidateNameReplacement(replacement); err != nil {
+		panic(err)
+	}
+	return func(hub *MetricHub) {
+		hub.sanitizer = &nameSanitizer{replacement: replacement}
+	}
+}
+
+// ValidateNameReplacement returns an error if names sanitized with
+// replacement could still be invalid, i.e. unless it is empty or a valid label
+// name
+func ValidateNameReplacement(replacement string) error {
+	for i, r := range replacement {
+		if !isValidLabelNameChar(r, i == 0) {
+			return fmt.Errorf("invalid name replacement %q: must be empty or a valid label name", replacement)
+		}
+	}
+	return nil
+}
+
+type nameSanitizer struct {
+	replacement string
+}
+
+// sanitizeFamily rewrites the family name and all label names in place. A
+// rewritten metric name is recorded in the original_name label, and a
+// rewritten label name `foo.bar` is recorded as original_foo_bar="foo.bar".
+// Names that would clash with another label of the datapoint, e.g. `foo.bar`
+// and `foo-bar` both rewritten to foo_bar, get a numeric suffix, e.g. foo_bar_2.
+func (s *nameSanitizer) sanitizeFamily(family *dto.MetricFamily) {
+	name := family.GetName()
+	sanitizedName := s.sanitize(name, isValidMetricNameChar)
+	if sanitizedName != name {
+		family.Name = proto.String(sanitizedName)
+	}
+
+	for _, metric := range family.Metric {
+		used := make(map[string]bool, len(metric.Label))
+		for _, label := range metric.Label {
+			used[label.GetName()] = true
+		}
+		var originals []*dto.LabelPair
+		for _, label := range metric.Label {
+			labelName := label.GetName()
+			sanitizedLabel := s.sanitize(labelName, isValidLabelNameChar)
+			if sanitizedLabel == labelName {
+				continue
+			}
+			sanitizedLabel = uniqueLabelName(sanitizedLabel, used)
+			label.Name = proto.String(sanitizedLabel)
+			originals = append(originals, &dto.LabelPair{
+				Name:  proto.String(uniqueLabelName(originalLabelPrefix+sanitizedLabel, used)),
+				Value: proto.String(labelName),
+			})
+		}
+		if sanitizedName != name {
+			originals = append(originals, &dto.LabelPair{
+				Name:  proto.String(uniqueLabelName(originalNameLabel, used)),
+				Value: proto.String(name),
+			})
+		}
+		metric.Label = append(metric.Label, originals...)
+	}
+}
+
+// uniqueLabelName returns name, or name with the lowest numeric suffix from 2
+// that makes it unique, if it is in used, and adds it to used
+func uniqueLabelName(name string, used map[string]bool) string {
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = name + "_" + strconv.Itoa(i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// sanitize replaces every character rejected by isValid with the configured
+// replacement. Names starting with a digit are prefixed with the replacement
+// (or an underscore if the replacement is empty).
+func (s *nameSanitizer) sanitize(name string, isValid func(r rune, first bool) bool) string {
+	valid := true
+	for i, r := range name {
+		if !isValid(r, i == 0) {
+			valid = false
+			break
+		}
+	}
+	if valid {
+		return name
+	}
+
+	var sanitized strings.Builder
+	for i, r := range name {
+		switch {
+		case isValid(r, i == 0):
+			sanitized.WriteRune(r)
+		case i == 0 && r >= '0' && r <= '9':
+			if s.replacement == "" {
+				sanitized.WriteRune('_')
+			} else {
+				sanitized.WriteString(s.replacement)
+			}
+			sanitized.WriteRune(r)
+		default:
+			sanitized.WriteString(s.replacement)
+		}
+	}
+	if sanitized.Len() == 0 {
+		// every character was dropped by an empty replacement
+		return "_"
+	}
+	return sanitized.String()
+}
+
+func isValidMetricNameChar(r rune, first bool) bool {
+	return r == ':' || isValidLabelNameChar(r, first)
+}
+
+func isValidLabelNameChar(r rune, first bool) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_' || (!first && r >= '0' && r <= '9')
+}
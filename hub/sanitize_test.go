@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeNames(t *testing.T) {
+	s := nameSanitizer{replacement: "_"}
+	assert.Equal(t, "valid_name:total", s.sanitize("valid_name:total", isValidMetricNameChar))
+	assert.Equal(t, "my_metric_name", s.sanitize("my.metric-name", isValidMetricNameChar))
+	assert.Equal(t, "_5xx_count", s.sanitize("5xx.count", isValidMetricNameChar))
+	assert.Equal(t, "label_name", s.sanitize("label:name", isValidLabelNameChar))
+
+	empty := nameSanitizer{replacement: ""}
+	assert.Equal(t, "mymetric", empty.sanitize("my.metric", isValidMetricNameChar))
+	assert.Equal(t, "_1metric", empty.sanitize("1metric", isValidMetricNameChar))
+	assert.Equal(t, "_", empty.sanitize("...", isValidMetricNameChar))
+}
+
+func TestValidateNameReplacement(t *testing.T) {
+	for _, replacement := range []string{"", "_", "x", "_0"} {
+		assert.NoError(t, ValidateNameReplacement(replacement), replacement)
+	}
+	for _, replacement := range []string{".", "-", ":", "0"} {
+		assert.Error(t, ValidateNameReplacement(replacement), replacement)
+	}
+	assert.Panics(t, func() { WithNameSanitizer("-") })
+}
+
+func TestSanitizeDuplicateLabels(t *testing.T) {
+	s := nameSanitizer{replacement: "_"}
+	family := makeFamily(dto.MetricType_GAUGE, "m", 1, []*dto.LabelPair{
+		{Name: proto.String("a.b"), Value: proto.String("1")},
+		{Name: proto.String("a-b"), Value: proto.String("2")},
+		{Name: proto.String("original_a_b"), Value: proto.String("3")},
+	}, 1)
+	s.sanitizeFamily(family)
+
+	labels := make(map[string]string)
+	for _, label := range family.Metric[0].Label {
+		_, dup := labels[label.GetName()]
+		assert.False(t, dup, label.GetName())
+		labels[label.GetName()] = label.GetValue()
+	}
+	assert.Equal(t, map[string]string{
+		"a_b": "1", "original_a_b_2": "a.b",
+		"a_b_2": "2", "original_a_b_2_2": "a-b",
+		"original_a_b": "3",
+	}, labels)
+}
+
+func TestSanitizerSkipsTextPushes(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithNameSanitizer("_"))
+	// the text format parser rejects the name before it can be sanitized
+	resp, err := receiveString(hub, "cpu.usage 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, 0, hub.Status().Datapoints)
+}
+
+func TestReceiveGRPCSanitizesNames(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithNameSanitizer("_"))
+	labelName := "host.name"
+	labelValue := "A"
+	fam := makeFamily(dto.MetricType_GAUGE, "cpu.usage", 1, []*dto.LabelPair{{Name: &labelName, Value: &labelValue}}, 1)
+	hub.ReceiveGRPC([]*dto.MetricFamily{fam})
+
+	expectedText := `# HELP cpu_usage cpu.usage
+# TYPE cpu_usage gauge
+cpu_usage{host_name="A",original_host_name="host.name",original_name="cpu.usage"} 0 1
+`
+	assert.Equal(t, expectedText, hub.exposeMetrics(hub.metricFamiliesByName, 1))
+}
+
+func TestReceiveWithoutSanitizerKeepsNames(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	fam := makeFamily(dto.MetricType_GAUGE, "cpu.usage", 1, []*dto.LabelPair{}, 1)
+	hub.ReceiveGRPC([]*dto.MetricFamily{fam})
+
+	_, ok := hub.metricFamiliesByName["cpu.usage"]
+	assert.True(t, ok)
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"sync"
+	"time"
+)
+
+// WithScrapeCache makes the hub serve the output of the last scrape again to
+// any scrape arriving within ttl of it, with the same scrape ID. This lets
+// both Prometheus servers of an HA pair receive identical data, instead of the
+// first one draining the hub and the second one getting whatever was pushed in
+// between.
+func WithScrapeCache(ttl time.Duration) Option {
+	return func(hub *MetricHub) {
+		hub.scrapeCache = &scrapeCache{ttl: ttl, entries: make(map[string]*cachedScrape)}
+	}
+}
+
+type scrapeCache struct {
+	sync.Mutex
+	ttl time.Duration
+
+	// entries holds the last scrape per key, so scrapes of different parts of
+	// the hub are cached separately
+	entries map[string]*cachedScrape
+}
+
+type cachedScrape struct {
+	id         string
+	exposition string
+	scrapedAt  time.Time
+}
+
+// get returns the cached scrape for key if it is younger than the ttl, and
+// otherwise runs scrape and caches its result. The lock is held while
+// scraping so a second scraper arriving at the same time waits for and gets
+// the same output.
+func (s *scrapeCache) get(key string, now time.Time, scrape func() (id string, exposition string)) (string, string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if entry, ok := s.entries[key]; ok && now.Sub(entry.scrapedAt) < s.ttl {
+		return entry.id, entry.exposition
+	}
+	id, exposition := scrape()
+	s.entries[key] = &cachedScrape{id: id, exposition: exposition, scrapedAt: now}
+	return id, exposition
+}
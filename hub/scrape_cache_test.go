@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrapeCache(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithScrapeCache(time.Hour))
+	hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 1, []*dto.LabelPair{}, 1)})
+
+	first := scrapeURL(t, hub, "/metrics")
+	// pushed after the first scrape, so stays in the hub until the cache expires
+	hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam2", 1, []*dto.LabelPair{}, 1)})
+	second := scrapeURL(t, hub, "/metrics")
+
+	assert.NotEmpty(t, first.Header().Get(ScrapeIDHeader))
+	assert.Equal(t, first.Header().Get(ScrapeIDHeader), second.Header().Get(ScrapeIDHeader))
+	assert.Equal(t, "# HELP fam1 fam1\n# TYPE fam1 gauge\nfam1 0 1\n", second.Body.String())
+	assert.Equal(t, 1, hub.Status().Datapoints)
+
+	for _, entry := range hub.scrapeCache.entries {
+		entry.scrapedAt = time.Now().Add(-2 * time.Hour)
+	}
+	third := scrapeURL(t, hub, "/metrics")
+	assert.NotEqual(t, first.Header().Get(ScrapeIDHeader), third.Header().Get(ScrapeIDHeader))
+	assert.Equal(t, "# HELP fam2 fam2\n# TYPE fam2 gauge\nfam2 0 1\n", third.Body.String())
+}
+
+func TestScrapeIDsAreUnique(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	first := scrapeURL(t, hub, "/metrics")
+	second := scrapeURL(t, hub, "/metrics")
+	assert.NotEqual(t, first.Header().Get(ScrapeIDHeader), second.Header().Get(ScrapeIDHeader))
+}
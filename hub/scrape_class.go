@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"regexp"
+
+	"github.com/labstack/echo"
+)
+
+// ScrapeClass selects the families returned by a scrape, so cheap high value
+// families can be scraped more often than bulky ones
+type ScrapeClass string
+
+const (
+	// ScrapeClassFast is every family not in ScrapeClassSlow
+	ScrapeClassFast ScrapeClass = "fast"
+	// ScrapeClassSlow is the families matching the pattern set by
+	// WithSlowFamilies
+	ScrapeClassSlow ScrapeClass = "slow"
+
+	scrapeClassAll ScrapeClass = ""
+)
+
+// WithSlowFamilies puts the families whose name matches pattern in
+// ScrapeClassSlow, and every other family in ScrapeClassFast
+func WithSlowFamilies(pattern *regexp.Regexp) Option {
+	return func(hub *MetricHub) {
+		hub.slowFamilies = pattern
+	}
+}
+
+// inScrapeClass returns whether the family name belongs to class
+func (c *MetricHub) inScrapeClass(name string, class ScrapeClass) bool {
+	switch class {
+	case ScrapeClassFast:
+		return c.slowFamilies == nil || !c.slowFamilies.MatchString(name)
+	case ScrapeClassSlow:
+		return c.slowFamilies != nil && c.slowFamilies.MatchString(name)
+	}
+	return true
+}
+
+// ScrapeClassHandler returns a handler function for prometheus scrape
+// requests that returns and removes only the datapoints of families in class
+func (c *MetricHub) ScrapeClassHandler(class ScrapeClass) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		return c.scrape(ctx, class)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrapeClasses(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithSlowFamilies(regexp.MustCompile("^(memory_usage|http_.*)$")))
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+
+	fast := scrapeClass(t, hub, ScrapeClassFast)
+	assert.Contains(t, fast, "cpu_usage")
+	assert.NotContains(t, fast, "memory_usage")
+	assert.NotContains(t, fast, "http_requests_total")
+	assert.Equal(t, 9, hub.stats.currentCountDatapoints)
+	assert.Equal(t, 2, hub.stats.currentCountFamilies)
+	assert.Equal(t, 3, hub.stats.currentCountSeries)
+
+	// nothing left in the fast class
+	assert.Equal(t, "", scrapeClass(t, hub, ScrapeClassFast))
+
+	slow := scrapeClass(t, hub, ScrapeClassSlow)
+	assert.Contains(t, slow, "memory_usage")
+	assert.Contains(t, slow, "http_requests_total")
+	assert.Equal(t, 0, hub.Status().Datapoints)
+}
+
+func TestScrapeClassesWithoutSlowFamilies(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "", scrapeClass(t, hub, ScrapeClassSlow))
+	assert.Contains(t, scrapeClass(t, hub, ScrapeClassFast), "memory_usage")
+	assert.Equal(t, 0, hub.Status().Datapoints)
+}
+
+func TestScrapeClassesAreCachedSeparately(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithSlowFamilies(regexp.MustCompile("^memory_usage$")), WithScrapeCache(time.Hour))
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+
+	fast := scrapeClass(t, hub, ScrapeClassFast)
+	slow := scrapeClass(t, hub, ScrapeClassSlow)
+	assert.NotEqual(t, fast, slow)
+	assert.Contains(t, slow, "memory_usage")
+	assert.Equal(t, fast, scrapeClass(t, hub, ScrapeClassFast))
+}
+
+func scrapeClass(t *testing.T, hub *MetricHub, class ScrapeClass) string {
+	req := httptest.NewRequest(http.MethodGet, "/metrics/"+string(class), nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.ScrapeClassHandler(class)(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxScrapeConsumers bounds the cursors kept, since consumers are named by
+// scrapers
+const maxScrapeConsumers = 64
+
+var scrapeConsumers = prometheus.NewGauge(prometheus.GaugeOpts{Name: "scrape_consumers", Help: "Number of named scrape consumers with a cursor"})
+
+func init() {
+	prometheus.MustRegister(scrapeConsumers)
+}
+
+// checkConsumer returns an error if consumer is new and there are already
+// maxScrapeConsumers consumers
+func (r *scrapeRetention) checkConsumer(consumer string) error {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.cursors[consumer]; !ok && len(r.cursors) >= maxScrapeConsumers {
+		return fmt.Errorf("too many scrape consumers: at most %d are kept", maxScrapeConsumers)
+	}
+	return nil
+}
+
+// cursor returns the ID of the last scrape served to consumer, or false if it
+// wasn't served one yet
+func (r *scrapeRetention) cursor(consumer string) (string, bool) {
+	r.Lock()
+	defer r.Unlock()
+	id, ok := r.cursors[consumer]
+	return id, ok
+}
+
+// advance moves the cursor of consumer to the scrape with id
+func (r *scrapeRetention) advance(consumer, id string) {
+	r.Lock()
+	defer r.Unlock()
+	if r.cursors == nil {
+		r.cursors = make(map[string]string)
+	}
+	if _, ok := r.cursors[consumer]; !ok && len(r.cursors) >= maxScrapeConsumers {
+		// another new consumer took the last place since checkConsumer
+		return
+	}
+	r.cursors[consumer] = id
+	scrapeConsumers.Set(float64(len(r.cursors)))
+}
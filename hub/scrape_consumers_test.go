@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrapeConsumers(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithScrapeRetention(2))
+
+	// an HA pair scraping in turns both get every datapoint
+	_, err := receiveString(hub, "a 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "# TYPE a untyped\na 1 1000\n", scrapeURL(t, hub, "/metrics?consumer=prom-0").Body.String())
+
+	_, err = receiveString(hub, "a 2 2000\n")
+	assert.NoError(t, err)
+	first := scrapeURL(t, hub, "/metrics?consumer=prom-1")
+	assert.Equal(t, "# TYPE a untyped\na 1 1000\na 2 2000\n", first.Body.String())
+	// the first scrape of a consumer is no gap
+	assert.Empty(t, first.Header().Get(ScrapeGapHeader))
+
+	_, err = receiveString(hub, "a 3 3000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "# TYPE a untyped\na 2 2000\na 3 3000\n", scrapeURL(t, hub, "/metrics?consumer=prom-0").Body.String())
+	assert.Equal(t, "# TYPE a untyped\na 3 3000\n", scrapeURL(t, hub, "/metrics?consumer=prom-1").Body.String())
+
+	// prom-0 fell behind the 2 retained scrapes
+	scrapeURL(t, hub, "/metrics")
+	_, err = receiveString(hub, "a 4 4000\n")
+	assert.NoError(t, err)
+	scrapeURL(t, hub, "/metrics")
+	gap := scrapeURL(t, hub, "/metrics?consumer=prom-0")
+	assert.Equal(t, "1", gap.Header().Get(ScrapeGapHeader))
+	assert.Equal(t, "# TYPE a untyped\na 4 4000\n", gap.Body.String())
+	assert.Contains(t, hub.Capabilities().Features, FeatureScrapeConsumers)
+}
+
+func TestScrapeConsumersInvalid(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	assert.Equal(t, http.StatusBadRequest, scrapeURL(t, hub, "/metrics?consumer=prom-0").Code)
+
+	hub = NewMetricHub(0, 10, WithScrapeRetention(2))
+	assert.Equal(t, http.StatusBadRequest, scrapeURL(t, hub, "/metrics?consumer=prom-0&after=1-1").Code)
+	assert.Equal(t, http.StatusBadRequest, scrapeURL(t, hub, "/metrics?consumer=prom-0&min_age=30s").Code)
+
+	for i := 0; i < maxScrapeConsumers; i++ {
+		assert.Equal(t, http.StatusOK, scrapeURL(t, hub, fmt.Sprintf("/metrics?consumer=prom-%d", i)).Code)
+	}
+	assert.Equal(t, http.StatusBadRequest, scrapeURL(t, hub, "/metrics?consumer=one-too-many").Code)
+	assert.Equal(t, http.StatusOK, scrapeURL(t, hub, "/metrics?consumer=prom-0").Code)
+}
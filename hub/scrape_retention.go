@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// ScrapeGapHeader is set on responses to scrapes after a scrape ID the hub no
+// longer retains, since datapoints scraped between that scrape and the oldest
+// retained one can't be served again
+const ScrapeGapHeader = "X-Edge-Hub-Scrape-Gap"
+
+var (
+	retainedScrapes     = prometheus.NewGauge(prometheus.GaugeOpts{Name: "retained_scrapes", Help: "Number of scrapes retained to be served again to scrapes after an earlier scrape ID"})
+	retainedDatapoints  = prometheus.NewGauge(prometheus.GaugeOpts{Name: "retained_scrape_datapoints", Help: "Number of datapoints in retained scrapes"})
+	differentialScrapes = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "differential_scrapes_total", Help: "Number of scrapes after an earlier scrape ID, by whether that scrape was still retained"}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(retainedScrapes, retainedDatapoints, differentialScrapes)
+}
+
+// WithScrapeRetention keeps the datapoints of the last scrapes, so a scraper
+// can pass the ID of the last scrape it ingested as the after parameter and
+// be served every scrape since then again along with new datapoints. This
+// makes retries of scrapes whose response was lost, and handing off between
+// HA scrapers, lossless.
+func WithScrapeRetention(scrapes int) Option {
+	return func(hub *MetricHub) {
+		hub.scrapeRetention = &scrapeRetention{size: scrapes}
+	}
+}
+
+// scrapeRetention is a ring of the last scrapes, oldest first
+type scrapeRetention struct {
+	sync.Mutex
+	size    int
+	scrapes []retainedScrape
+	// cursors are the IDs of the last scrapes served to named consumers
+	cursors map[string]string
+}
+
+type retainedScrape struct {
+	id         string
+	families   []*dto.MetricFamily
+	datapoints int
+}
+
+// add retains the families served by the scrape with id, dropping the oldest
+// retained scrape if there are too many
+func (r *scrapeRetention) add(id string, families []*dto.MetricFamily) {
+	datapoints := 0
+	for _, fam := range families {
+		datapoints += len(fam.Metric)
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.scrapes = append(r.scrapes, retainedScrape{id: id, families: families, datapoints: datapoints})
+	if len(r.scrapes) > r.size {
+		r.scrapes = append(r.scrapes[:0:0], r.scrapes[len(r.scrapes)-r.size:]...)
+	}
+	r.updateMetrics()
+}
+
+// since returns the families of the scrapes retained after the scrape with
+// id, oldest first. If that scrape is not retained, every retained scrape is
+// returned, and ok is false.
+func (r *scrapeRetention) since(id string) ([][]*dto.MetricFamily, bool) {
+	r.Lock()
+	defer r.Unlock()
+	start, ok := 0, false
+	for i, scrape := range r.scrapes {
+		if scrape.id == id {
+			start, ok = i+1, true
+			break
+		}
+	}
+	var since [][]*dto.MetricFamily
+	for _, scrape := range r.scrapes[start:] {
+		since = append(since, scrape.families)
+	}
+	return since, ok
+}
+
+func (r *scrapeRetention) updateMetrics() {
+	datapoints := 0
+	for _, scrape := range r.scrapes {
+		datapoints += scrape.datapoints
+	}
+	retainedScrapes.Set(float64(len(r.scrapes)))
+	retainedDatapoints.Set(float64(datapoints))
+}
+
+// retainScrape keeps the datapoints of a served scrape for later scrapes after
+// it. Synthesized heartbeats, counter increases and rollups are skipped, since
+// every scrape has the current ones.
+func (c *MetricHub) retainScrape(id string, drained map[string]*familyAndMetrics) {
+	families := make([]*dto.MetricFamily, 0, len(drained))
+	for name, fam := range drained {
+		if c.synthesized(name) {
+			continue
+		}
+		families = append(families, fam.popDatapoints())
+	}
+	c.scrapeRetention.add(id, families)
+}
+
+// scrapeAfter drains the hub like a full scrape, and returns the new scrape
+// ID with the exposition in format of both the drained datapoints and those
+// of every retained scrape after the scrape with id. If consumer is set, id
+// is the cursor of the consumer instead, which moves to the new scrape once
+// it is served, and the first scrape of a consumer gets every retained scrape.
+// gap is set if the scrape with id is no longer retained.
+func (c *MetricHub) scrapeAfter(id, consumer string, format expfmt.Format, entry *AccessLogEntry) (scrapeID string, exposition string, gap bool) {
+	drained, scrapeID := c.drain()
+	observeDrained(drained, entry)
+	known := true
+	if consumer != "" {
+		id, known = c.scrapeRetention.cursor(consumer)
+	}
+	retained, ok := c.scrapeRetention.since(id)
+	switch {
+	case !known:
+		differentialScrapes.WithLabelValues("first").Inc()
+	case ok:
+		differentialScrapes.WithLabelValues("retained").Inc()
+	default:
+		differentialScrapes.WithLabelValues("gap").Inc()
+	}
+
+	merged := make(map[string]*familyAndMetrics, len(drained))
+	now := c.clock.Now()
+	add := func(fam *dto.MetricFamily) {
+		if existing, ok := merged[fam.GetName()]; ok {
+			existing.addMetrics(fam.Metric, false, 0)
+			return
+		}
+		// newFamilyAndMetrics takes the metrics out of the family it is
+		// given, which must not be the retained one
+		copied := *fam
+		merged[fam.GetName()] = newFamilyAndMetrics(&copied, now)
+	}
+	for _, families := range retained {
+		for _, fam := range families {
+			add(fam)
+		}
+	}
+	for _, fam := range drained {
+		add(fam.popDatapoints())
+	}
+
+	toString := familyToString
+	if format == expfmt.FmtOpenMetrics {
+		toString = familyToOpenMetrics
+	}
+	exposition, failed, served := c.exposeMetricsWithTimeout(merged, c.scrapeWorkers, toString)
+	if !served {
+		// only the drained datapoints go back into the hub, the retained
+		// ones are still retained
+		c.requeue(drained)
+	} else {
+		// only the drained datapoints of a failed family go into the
+		// quarantine, the retained ones got there when they were drained
+		var quarantined []failedFamily
+		for _, f := range failed {
+			if fam, ok := drained[f.family.GetName()]; ok {
+				quarantined = append(quarantined, failedFamily{family: c.popOrdered(fam), err: f.err})
+			}
+		}
+		c.quarantineFailed(quarantined)
+		c.retainScrape(scrapeID, drained)
+		if consumer != "" {
+			c.scrapeRetention.advance(consumer, scrapeID)
+		}
+		if format == expfmt.FmtOpenMetrics {
+			exposition += openMetricsEOF + "\n"
+		}
+	}
+	c.recordScrape(int64(len(exposition)), len(merged))
+	return scrapeID, exposition, known && !ok
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrapeAfter(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithScrapeRetention(2))
+
+	_, err := receiveString(hub, "a 1 1000\n")
+	assert.NoError(t, err)
+	first := scrapeURL(t, hub, "/metrics")
+	assert.Equal(t, "# TYPE a untyped\na 1 1000\n", first.Body.String())
+
+	// the response of the second scrape is lost
+	_, err = receiveString(hub, "a 2 2000\n")
+	assert.NoError(t, err)
+	scrapeURL(t, hub, "/metrics")
+
+	_, err = receiveString(hub, "a 3 3000\n")
+	assert.NoError(t, err)
+	retry := scrapeURL(t, hub, "/metrics?after="+first.Header().Get(ScrapeIDHeader))
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, "# TYPE a untyped\na 2 2000\na 3 3000\n", retry.Body.String())
+	assert.Empty(t, retry.Header().Get(ScrapeGapHeader))
+
+	// after the latest scrape, only new datapoints are served
+	_, err = receiveString(hub, "a 4 4000\n")
+	assert.NoError(t, err)
+	latest := scrapeURL(t, hub, "/metrics?after="+retry.Header().Get(ScrapeIDHeader))
+	assert.Equal(t, "# TYPE a untyped\na 4 4000\n", latest.Body.String())
+
+	// the first scrape is no longer retained
+	gap := scrapeURL(t, hub, "/metrics?after="+first.Header().Get(ScrapeIDHeader))
+	assert.Equal(t, "1", gap.Header().Get(ScrapeGapHeader))
+	assert.Equal(t, "# TYPE a untyped\na 3 3000\na 4 4000\n", gap.Body.String())
+	assert.Contains(t, hub.Capabilities().Features, FeatureScrapeAfter)
+}
+
+func TestScrapeAfterRequiresRetention(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	assert.Equal(t, http.StatusBadRequest, scrapeURL(t, hub, "/metrics?after=1-1").Code)
+
+	hub = NewMetricHub(0, 10, WithScrapeRetention(2))
+	assert.Equal(t, http.StatusBadRequest, scrapeURL(t, hub, "/metrics?after=1-1&min_age=30s").Code)
+	assert.Equal(t, http.StatusBadRequest, scrapeURL(t, hub, "/metrics?after=1-1&format=jsonl").Code)
+}
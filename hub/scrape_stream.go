@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/labstack/echo"
+	"github.com/prometheus/common/expfmt"
+)
+
+// countingWriter counts the bytes written to a scrape response before it is
+// compressed
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// streamScrape drains datapoints of class older than minAge from the hub like
+// scrapeExposition, but writes the exposition in format to the response as
+// families are serialized, with chunked transfer encoding, instead of
+// building it as a string first. This keeps scrapes of millions of datapoints
+// from holding them twice in memory. Families not written once the scrape
+// timeout is reached, or once writing to the client fails, are put back into
+// the hub for the next scrape.
+func (c *MetricHub) streamScrape(ctx echo.Context, minAge time.Duration, class ScrapeClass, format expfmt.Format, entry *AccessLogEntry) error {
+	drained, scrapeID := c.drainSelected(minAge, class)
+	observeDrained(drained, entry)
+	toString, contentType := familyToString, echo.MIMETextPlainCharsetUTF8
+	if format == expfmt.FmtOpenMetrics {
+		toString, contentType = familyToOpenMetrics, string(expfmt.FmtOpenMetrics)
+	}
+
+	resp := ctx.Response()
+	resp.Header().Set(ScrapeIDHeader, scrapeID)
+	resp.Header().Set(echo.HeaderContentType, contentType)
+	resp.Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+	var compressed *gzip.Writer
+	writer := &countingWriter{Writer: resp}
+	if acceptsGzip(ctx.Request()) {
+		resp.Header().Set(echo.HeaderContentEncoding, encodingGzip)
+		compressed = gzip.NewWriter(resp)
+		writer.Writer = compressed
+	}
+	resp.WriteHeader(http.StatusOK)
+
+	unwritten, failed, err := c.writeMetrics(writer, drained, c.scrapeWorkers, toString, c.scrapeDeadline())
+	if err == nil && format == expfmt.FmtOpenMetrics {
+		// a scrape cut short by the timeout is still a valid exposition
+		_, err = io.WriteString(writer, openMetricsEOF+"\n")
+	}
+	if compressed != nil {
+		closeErr := compressed.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if closeErr != nil {
+			// the families still buffered by the gzip writer never reached
+			// the client, and without the gzip trailer it can't trust the
+			// rest either
+			unwritten = unserved(drained, failed)
+		}
+		scrapeCompressedBytes.Add(float64(resp.Size))
+	}
+	if err != nil {
+		logging.Error("Error writing scrape", "scrape_id", scrapeID, "err", err)
+	}
+
+	if len(unwritten) > 0 {
+		c.requeue(unwritten)
+		for name := range unwritten {
+			delete(drained, name)
+		}
+	}
+	c.quarantineFailed(failed)
+	if c.scrapeRetention != nil && class == scrapeClassAll && minAge == 0 {
+		c.retainScrape(scrapeID, drained)
+	}
+	c.recordScrape(writer.n, len(drained))
+	return nil
+}
+
+// unserved returns the families of drained that didn't fail to serialize, to
+// requeue when none of a scrape reached the client
+func unserved(drained map[string]*familyAndMetrics, failed []failedFamily) map[string]*familyAndMetrics {
+	unwritten := make(map[string]*familyAndMetrics, len(drained))
+	for name, fam := range drained {
+		unwritten[name] = fam
+	}
+	for _, f := range failed {
+		delete(unwritten, f.family.GetName())
+	}
+	return unwritten
+}
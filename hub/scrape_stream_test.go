@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+// receiveFamilies pushes n families with a datapoint each
+func receiveFamilies(t *testing.T, hub *MetricHub, n int) {
+	var push strings.Builder
+	for i := 0; i < n; i++ {
+		push.WriteString(fmt.Sprintf("family_%d{label=\"value\"} %d 1000\n", i, i))
+	}
+	_, err := receiveString(hub, push.String())
+	assert.NoError(t, err)
+}
+
+func TestStreamScrape(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	receiveFamilies(t, hub, 2000)
+	e := echo.New()
+	e.GET("/metrics", hub.Scrape)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	assert.Equal(t, echo.MIMETextPlainCharsetUTF8, resp.Header.Get(echo.HeaderContentType))
+	assert.NotEmpty(t, resp.Header.Get(ScrapeIDHeader))
+	assert.Equal(t, 2000, strings.Count(string(body), "# TYPE"))
+	assert.Contains(t, string(body), "family_1999{label=\"value\"} 1999 1000\n")
+	assert.Equal(t, 0, hub.Status().Datapoints)
+}
+
+func TestStreamScrapeGzip(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	receiveFamilies(t, hub, 100)
+	req := httptest.NewRequest(http.MethodGet, "/metrics?format=openmetrics", nil)
+	req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.Scrape(echo.New().NewContext(req, rec)))
+
+	assert.Equal(t, "gzip", rec.Header().Get(echo.HeaderContentEncoding))
+	reader, err := gzip.NewReader(rec.Body)
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, strings.Count(string(body), "# TYPE"))
+	assert.True(t, strings.HasSuffix(string(body), "# EOF\n"))
+}
+
+// failingWriter is a response writer failing every write after the first
+// limit bytes
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	limit int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.Body.Len()+len(p) > w.limit {
+		return 0, errors.New("connection reset by peer")
+	}
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestStreamScrapeWriteError(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		hub := NewMetricHub(0, 10, WithScrapeWorkers(workers))
+		receiveFamilies(t, hub, 100)
+		writer := &failingWriter{ResponseRecorder: httptest.NewRecorder(), limit: 1000}
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		assert.NoError(t, hub.Scrape(echo.New().NewContext(req, writer)))
+
+		// the families that weren't written are kept for the next scrape
+		written := strings.Count(writer.Body.String(), "# TYPE")
+		assert.True(t, written < 100)
+		assert.Equal(t, 100-written, hub.Status().Datapoints, "workers=%d", workers)
+		assert.Equal(t, 100-written, strings.Count(scrape(t, hub), "# TYPE"))
+	}
+}
+
+func TestStreamScrapeGzipCloseError(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	receiveFamilies(t, hub, 100)
+	// the gzip header fits, but the compressed families are only written
+	// when the gzip writer is closed
+	writer := &failingWriter{ResponseRecorder: httptest.NewRecorder(), limit: 10}
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+	assert.NoError(t, hub.Scrape(echo.New().NewContext(req, writer)))
+
+	// every family is kept for the next scrape
+	assert.Equal(t, 100, hub.Status().Datapoints)
+	assert.Equal(t, 100, strings.Count(scrape(t, hub), "# TYPE"))
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+const metricNameLabel = "__name__"
+
+// matchOp is the operator of a label matcher
+type matchOp string
+
+const (
+	matchEqual     matchOp = "="
+	matchNotEqual  matchOp = "!="
+	matchRegexp    matchOp = "=~"
+	matchNotRegexp matchOp = "!~"
+)
+
+// labelMatcher matches the value of one label, which is "" for series
+// without it, like in Prometheus
+type labelMatcher struct {
+	name  string
+	op    matchOp
+	value string
+	re    *regexp.Regexp
+}
+
+func (m labelMatcher) matches(value string) bool {
+	switch m.op {
+	case matchEqual:
+		return value == m.value
+	case matchNotEqual:
+		return value != m.value
+	case matchRegexp:
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+// selector is a Prometheus series selector, e.g.
+// alarms_total{severity=~"major|critical"}. The metric name is matched against
+// family names.
+type selector struct {
+	matchers []labelMatcher
+}
+
+// parseSelector parses a series selector of an optional metric name and
+// optional label matchers in braces
+func parseSelector(s string) (*selector, error) {
+	s = strings.TrimSpace(s)
+	sel := &selector{}
+	brace := strings.IndexByte(s, '{')
+	name := s
+	if brace >= 0 {
+		name = strings.TrimSpace(s[:brace])
+	}
+	if name != "" {
+		if !model.IsValidMetricName(model.LabelValue(name)) {
+			return nil, fmt.Errorf("invalid metric name %q in selector %q", name, s)
+		}
+		sel.matchers = append(sel.matchers, labelMatcher{name: metricNameLabel, op: matchEqual, value: name})
+	}
+	if brace >= 0 {
+		if !strings.HasSuffix(s, "}") {
+			return nil, fmt.Errorf("selector %q is missing a closing brace", s)
+		}
+		matchers, err := parseMatchers(s[brace+1 : len(s)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %v", s, err)
+		}
+		sel.matchers = append(sel.matchers, matchers...)
+	}
+	if len(sel.matchers) == 0 {
+		return nil, fmt.Errorf("empty selector")
+	}
+	return sel, nil
+}
+
+// parseMatchers parses comma separated label matchers, e.g.
+// severity="major",site!~"lab-.*"
+func parseMatchers(s string) ([]labelMatcher, error) {
+	var matchers []labelMatcher
+	for {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return matchers, nil
+		}
+		end := strings.IndexAny(s, "=!")
+		if end <= 0 {
+			return nil, fmt.Errorf("expected a label matcher at %q", s)
+		}
+		m := labelMatcher{name: strings.TrimSpace(s[:end])}
+		if !model.LabelName(m.name).IsValid() {
+			return nil, fmt.Errorf("invalid label name %q", m.name)
+		}
+		s = s[end:]
+		switch {
+		case strings.HasPrefix(s, string(matchRegexp)):
+			m.op = matchRegexp
+		case strings.HasPrefix(s, string(matchNotRegexp)):
+			m.op = matchNotRegexp
+		case strings.HasPrefix(s, string(matchNotEqual)):
+			m.op = matchNotEqual
+		case strings.HasPrefix(s, string(matchEqual)):
+			m.op = matchEqual
+		default:
+			return nil, fmt.Errorf("expected an operator at %q", s)
+		}
+		s = strings.TrimSpace(s[len(m.op):])
+
+		quoted := quotedPrefix(s)
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("expected a quoted value at %q", s)
+		}
+		m.value = value
+		s = strings.TrimSpace(s[len(quoted):])
+		if m.op == matchRegexp || m.op == matchNotRegexp {
+			// anchored like in Prometheus
+			if m.re, err = regexp.Compile("^(?:" + m.value + ")$"); err != nil {
+				return nil, fmt.Errorf("invalid regex for label %q: %v", m.name, err)
+			}
+		}
+		matchers = append(matchers, m)
+
+		if s != "" {
+			if s[0] != ',' {
+				return nil, fmt.Errorf("expected a comma at %q", s)
+			}
+			s = s[1:]
+		}
+	}
+}
+
+// quotedPrefix returns the double quoted string s starts with, or "" if it
+// doesn't start with one
+func quotedPrefix(s string) string {
+	if s == "" || s[0] != '"' {
+		return ""
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return s[:i+1]
+		}
+	}
+	return ""
+}
+
+// matches reports whether the series with labels of the family named family
+// is selected
+func (sel *selector) matches(family string, labels []*dto.LabelPair) bool {
+	for _, m := range sel.matchers {
+		value := ""
+		if m.name == metricNameLabel {
+			value = family
+		} else {
+			for _, label := range labels {
+				if label.GetName() == m.name {
+					value = label.GetValue()
+					break
+				}
+			}
+		}
+		if !m.matches(value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSelector(t *testing.T) {
+	labels := []*dto.LabelPair{
+		{Name: proto.String("severity"), Value: proto.String("critical")},
+		{Name: proto.String("site"), Value: proto.String(`lab "1", east`)},
+	}
+	for selector, matches := range map[string]bool{
+		`alarms_total`:                           true,
+		`other_total`:                            false,
+		`alarms_total{}`:                         true,
+		`alarms_total{severity="critical"}`:      true,
+		`alarms_total{severity="major"}`:         false,
+		`alarms_total{severity!="major"}`:        true,
+		`{severity=~"major|critical"}`:           true,
+		`{severity=~"crit"}`:                     false,
+		`{severity!~"crit.*"}`:                   false,
+		`{__name__=~"alarms_.*", missing=""}`:    true,
+		`{site="lab \"1\", east", severity!=""}`: true,
+	} {
+		sel, err := parseSelector(selector)
+		if assert.NoError(t, err, selector) {
+			assert.Equal(t, matches, sel.matches("alarms_total", labels), selector)
+		}
+	}
+
+	for _, selector := range []string{
+		``,
+		`{}`,
+		`1alarms`,
+		`alarms{severity="critical"`,
+		`alarms{severity}`,
+		`alarms{severity=critical}`,
+		`alarms{severity="critical" site="a"}`,
+		`alarms{severity=~"("}`,
+	} {
+		_, err := parseSelector(selector)
+		assert.Error(t, err, selector)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// selfMonitoringPrefix keeps internal metrics of the hub apart from
+	// pushed metrics of the same name once they are upstream
+	selfMonitoringPrefix = "edgehub_"
+	// SelfMonitoringLabel is the label naming the hub that pushed its
+	// internal metrics
+	SelfMonitoringLabel = "hub"
+)
+
+var selfMonitoringPushes = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "self_monitoring_pushes_total", Help: "Number of pushes of the hub's internal metrics to the upstream, by result"}, []string{"result"})
+
+func init() {
+	prometheus.MustRegister(selfMonitoringPushes)
+}
+
+// WithSelfMonitoring makes RunSelfMonitoring push the internal metrics of
+// gatherer to the upstream, named edgehub_<name> and labeled with
+// hub=instance, so the health of the hub is visible centrally even while the
+// scrape of the hub is broken
+func WithSelfMonitoring(gatherer prometheus.Gatherer, instance string) Option {
+	return func(hub *MetricHub) {
+		hub.selfMonitor = &selfMonitor{gatherer: gatherer, instance: instance}
+	}
+}
+
+type selfMonitor struct {
+	gatherer prometheus.Gatherer
+	instance string
+}
+
+// RunSelfMonitoring pushes the internal metrics of the hub to its upstream
+// every interval until stop is closed. Pushes that fail are not retried, since
+// the next one has newer values. Does nothing without self monitoring or an
+// upstream.
+func (c *MetricHub) RunSelfMonitoring(interval time.Duration, stop <-chan struct{}) {
+	if c.selfMonitor == nil || c.upstream == nil {
+		return
+	}
+	ticks, stopTicker := c.clock.NewTicker(interval)
+	defer stopTicker()
+	for {
+		select {
+		case <-ticks:
+			c.pushSelfMonitoring()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (c *MetricHub) pushSelfMonitoring() {
+	families, err := c.selfMonitor.families(c.clock.Now())
+	if err != nil {
+		// Gather returns what it could collect along with the error
+		logging.Warn("Error gathering internal metrics for self monitoring", "err", err)
+	}
+	if err := c.upstream.send(c.newForwardBatch(families)); err != nil {
+		selfMonitoringPushes.WithLabelValues("failure").Inc()
+		logging.Warn("Error pushing internal metrics upstream", "err", err)
+		return
+	}
+	selfMonitoringPushes.WithLabelValues("success").Inc()
+}
+
+// families returns the internal metrics along with build info, renamed,
+// labeled with the instance and timestamped with now
+func (s *selfMonitor) families(now time.Time) ([]*dto.MetricFamily, error) {
+	families, err := s.gatherer.Gather()
+	families = append(families, buildInfoFamily())
+	timestampMs := now.UnixNano() / int64(time.Millisecond)
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), selfMonitoringPrefix) {
+			family.Name = proto.String(selfMonitoringPrefix + family.GetName())
+		}
+		for _, metric := range family.Metric {
+			metric.Label = append(metric.Label, &dto.LabelPair{Name: proto.String(SelfMonitoringLabel), Value: proto.String(s.instance)})
+			sort.Slice(metric.Label, func(i, j int) bool {
+				return metric.Label[i].GetName() < metric.Label[j].GetName()
+			})
+			metric.TimestampMs = proto.Int64(timestampMs)
+		}
+	}
+	return families, err
+}
+
+// buildInfoFamily describes the build of the hub, which isn't exposed on
+// /internal
+func buildInfoFamily() *dto.MetricFamily {
+	return &dto.MetricFamily{
+		Name: proto.String("build_info"),
+		Help: proto.String("Go version and platform the hub was built with"),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{
+			Label: []*dto.LabelPair{
+				{Name: proto.String("goarch"), Value: proto.String(runtime.GOARCH)},
+				{Name: proto.String("goos"), Value: proto.String(runtime.GOOS)},
+				{Name: proto.String("goversion"), Value: proto.String(runtime.Version())},
+			},
+			Gauge: &dto.Gauge{Value: proto.Float64(1)},
+		}},
+	}
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfMonitoringPushesInternalMetrics(t *testing.T) {
+	upstream := NewMetricHub(0, 10)
+	var down int32
+	server := startUpstream(upstream, &down)
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "hub_size", Help: "Number of datapoints in hub"})
+	gauge.Set(42)
+	registry.MustRegister(gauge)
+	hub := NewMetricHub(0, 10, WithUpstream(server.URL+"/metrics", time.Second), WithSelfMonitoring(registry, "site1"))
+
+	successes := selfMonitoringPushes.WithLabelValues("success")
+	before := testutil.ToFloat64(successes)
+	hub.pushSelfMonitoring()
+	assert.Equal(t, before+1, testutil.ToFloat64(successes))
+
+	scraped := scrape(t, upstream)
+	assert.Contains(t, scraped, `edgehub_hub_size{hub="site1"} 42 `)
+	assert.Contains(t, scraped, "edgehub_build_info{")
+	// the metrics go to the upstream, not into the hub itself
+	assert.Equal(t, 0, hub.Status().Datapoints)
+}
+
+func TestSelfMonitoringPushFailure(t *testing.T) {
+	upstream := NewMetricHub(0, 10)
+	down := int32(1)
+	server := startUpstream(upstream, &down)
+	defer server.Close()
+
+	hub := NewMetricHub(0, 10, WithUpstream(server.URL+"/metrics", time.Second), WithSelfMonitoring(prometheus.NewRegistry(), "site1"))
+	failures := selfMonitoringPushes.WithLabelValues("failure")
+	before := testutil.ToFloat64(failures)
+	hub.pushSelfMonitoring()
+	assert.Equal(t, before+1, testutil.ToFloat64(failures))
+	// failed pushes are not buffered for a retry
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	assert.Equal(t, 0, upstream.Status().Datapoints)
+}
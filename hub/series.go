@@ -0,0 +1,215 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"sort"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// sampleKind tags which value of a dto.Metric a sample was pushed with
+type sampleKind uint8
+
+const (
+	// sampleNone is a datapoint pushed without any value
+	sampleNone sampleKind = iota
+	sampleCounter
+	sampleGauge
+	sampleUntyped
+	sampleSummary
+	sampleHistogram
+)
+
+// sample is a queued datapoint. Counter, gauge and untyped values are stored
+// inline, so a queue is a flat slice rather than a slice of pointers to
+// dto.Metric and its nested pointers. Datapoints are converted from and to
+// dto.Metric only when they are stored and scraped.
+type sample struct {
+	timestampMs int64
+	value       float64
+	// complex is the original metric of summary and histogram datapoints,
+	// whose values don't fit in a float, and of counters with an exemplar
+	complex      *dto.Metric
+	kind         sampleKind
+	hasTimestamp bool
+	// imported is set for datapoints stored by Import, which count against
+	// the import limit instead of the hub limit
+	imported bool
+}
+
+// series is the queue of datapoints with the same labels, sorted by timestamp
+type series struct {
+	// labels are shared by every datapoint of the series
+	labels  []*dto.LabelPair
+	samples []sample
+}
+
+func newSample(metric *dto.Metric) sample {
+	s := sample{
+		timestampMs:  metric.GetTimestampMs(),
+		hasTimestamp: metric.TimestampMs != nil,
+	}
+	switch {
+	case metric.Counter != nil:
+		s.kind, s.value = sampleCounter, metric.Counter.GetValue()
+		if metric.Counter.Exemplar != nil {
+			s.complex = metric
+		}
+	case metric.Gauge != nil:
+		s.kind, s.value = sampleGauge, metric.Gauge.GetValue()
+	case metric.Untyped != nil:
+		s.kind, s.value = sampleUntyped, metric.Untyped.GetValue()
+	case metric.Summary != nil:
+		s.kind, s.complex = sampleSummary, metric
+	case metric.Histogram != nil:
+		s.kind, s.complex = sampleHistogram, metric
+	}
+	return s
+}
+
+// metric converts s back to a dto.Metric with labels
+func (s sample) metric(labels []*dto.LabelPair) *dto.Metric {
+	metric := &dto.Metric{Label: labels}
+	if s.hasTimestamp {
+		timestampMs := s.timestampMs
+		metric.TimestampMs = &timestampMs
+	}
+	value := s.value
+	switch s.kind {
+	case sampleCounter:
+		metric.Counter = &dto.Counter{Value: &value}
+		if s.complex != nil {
+			metric.Counter.Exemplar = s.complex.Counter.Exemplar
+		}
+	case sampleGauge:
+		metric.Gauge = &dto.Gauge{Value: &value}
+	case sampleUntyped:
+		metric.Untyped = &dto.Untyped{Value: &value}
+	case sampleSummary:
+		metric.Summary = s.complex.Summary
+	case sampleHistogram:
+		metric.Histogram = s.complex.Histogram
+	}
+	return metric
+}
+
+// add inserts s in timestamp order. A summary or histogram datapoint with the
+// same timestamp as one already queued is merged into it instead, since
+// exporters pushing through the same hub may split the buckets or quantiles
+// of one datapoint across pushes. Returns whether s was merged.
+func (q *series) add(s sample) bool {
+	if len(q.samples) == 0 || s.timestampMs > q.samples[len(q.samples)-1].timestampMs {
+		q.samples = append(q.samples, s)
+		return false
+	}
+	index := sort.Search(len(q.samples), func(i int) bool { return q.samples[i].timestampMs > s.timestampMs })
+	if index > 0 && q.samples[index-1].mergeable(s) {
+		q.samples[index-1].merge(s)
+		return true
+	}
+	if index == len(q.samples) {
+		q.samples = append(q.samples, s)
+		return false
+	}
+	q.samples = append(q.samples, sample{})
+	copy(q.samples[index+1:], q.samples[index:])
+	q.samples[index] = s
+	return false
+}
+
+// mergeable returns whether other is part of the same summary or histogram
+// datapoint as s
+func (s sample) mergeable(other sample) bool {
+	return (s.kind == sampleSummary || s.kind == sampleHistogram) &&
+		s.kind == other.kind &&
+		s.hasTimestamp == other.hasTimestamp &&
+		s.timestampMs == other.timestampMs
+}
+
+// merge adds the buckets or quantiles of other to s, replacing those with the
+// same bound. The count and sum of other replace those of s if set. The
+// queued metric is copied rather than modified, since scraped families may
+// still refer to it.
+func (s *sample) merge(other sample) {
+	merged := &dto.Metric{Label: s.complex.Label, TimestampMs: s.complex.TimestampMs}
+	switch s.kind {
+	case sampleSummary:
+		merged.Summary = mergeSummaries(s.complex.Summary, other.complex.Summary)
+	case sampleHistogram:
+		merged.Histogram = mergeHistograms(s.complex.Histogram, other.complex.Histogram)
+	}
+	s.complex = merged
+}
+
+func mergeSummaries(old, update *dto.Summary) *dto.Summary {
+	merged := &dto.Summary{SampleCount: old.SampleCount, SampleSum: old.SampleSum}
+	if update.SampleCount != nil {
+		merged.SampleCount = update.SampleCount
+	}
+	if update.SampleSum != nil {
+		merged.SampleSum = update.SampleSum
+	}
+	quantiles := make(map[float64]*dto.Quantile, len(old.Quantile)+len(update.Quantile))
+	for _, quantile := range append(append([]*dto.Quantile{}, old.Quantile...), update.Quantile...) {
+		quantiles[quantile.GetQuantile()] = quantile
+	}
+	for _, quantile := range quantiles {
+		merged.Quantile = append(merged.Quantile, quantile)
+	}
+	sort.Slice(merged.Quantile, func(i, j int) bool {
+		return merged.Quantile[i].GetQuantile() < merged.Quantile[j].GetQuantile()
+	})
+	return merged
+}
+
+func mergeHistograms(old, update *dto.Histogram) *dto.Histogram {
+	merged := &dto.Histogram{SampleCount: old.SampleCount, SampleSum: old.SampleSum}
+	if update.SampleCount != nil {
+		merged.SampleCount = update.SampleCount
+	}
+	if update.SampleSum != nil {
+		merged.SampleSum = update.SampleSum
+	}
+	buckets := make(map[float64]*dto.Bucket, len(old.Bucket)+len(update.Bucket))
+	for _, bucket := range append(append([]*dto.Bucket{}, old.Bucket...), update.Bucket...) {
+		buckets[bucket.GetUpperBound()] = bucket
+	}
+	for _, bucket := range buckets {
+		merged.Bucket = append(merged.Bucket, bucket)
+	}
+	sort.Slice(merged.Bucket, func(i, j int) bool {
+		return merged.Bucket[i].GetUpperBound() < merged.Bucket[j].GetUpperBound()
+	})
+	return merged
+}
+
+// countImported returns the number of imported datapoints in samples
+func countImported(samples []sample) int {
+	imported := 0
+	for _, s := range samples {
+		if s.imported {
+			imported++
+		}
+	}
+	return imported
+}
+
+// newestTimestampMs returns the timestamp of the last datapoint of a non-empty
+// series
+func (q *series) newestTimestampMs() int64 {
+	return q.samples[len(q.samples)-1].timestampMs
+}
+
+// appendMetrics appends the datapoints of the series to metrics as dto.Metric
+func (q *series) appendMetrics(metrics []*dto.Metric) []*dto.Metric {
+	for _, s := range q.samples {
+		metrics = append(metrics, s.metric(q.labels))
+	}
+	return metrics
+}
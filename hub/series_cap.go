@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var seriesCapEvictedDatapoints = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "series_cap_evicted_datapoints_total", Help: "Number of datapoints evicted from series over the max datapoints per series, by family"}, []string{"family"})
+
+func init() {
+	prometheus.MustRegister(seriesCapEvictedDatapoints)
+}
+
+// WithMaxSeriesDatapoints keeps only the newest maxDatapoints datapoints of
+// each series between scrapes, evicting the oldest, so a single client pushing
+// one series fast can't take up the whole hub limit
+func WithMaxSeriesDatapoints(maxDatapoints int) Option {
+	return func(hub *MetricHub) {
+		hub.maxSeriesDatapoints = maxDatapoints
+	}
+}
+
+// evictOldest drops the oldest datapoints of the series over maxDatapoints,
+// and returns the number dropped. Imported datapoints don't count against the
+// hub limit, so they are neither counted nor dropped.
+func (q *series) evictOldest(maxDatapoints int) int {
+	live := 0
+	for _, s := range q.samples {
+		if !s.imported {
+			live++
+		}
+	}
+	over := live - maxDatapoints
+	if over <= 0 {
+		return 0
+	}
+	if live == len(q.samples) {
+		// release summaries and histograms before the array is reallocated
+		for i := range q.samples[:over] {
+			q.samples[i] = sample{}
+		}
+		q.samples = q.samples[over:]
+		return over
+	}
+	kept := make([]sample, 0, len(q.samples)-over)
+	dropped := 0
+	for _, s := range q.samples {
+		if dropped < over && !s.imported {
+			dropped++
+			continue
+		}
+		kept = append(kept, s)
+	}
+	q.samples = kept
+	return over
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxSeriesDatapoints(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithMaxSeriesDatapoints(2))
+	_, err := receiveString(hub, "fast 1 1000\nfast 2 2000\nfast 3 3000\nslow 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, hub.Status().Datapoints)
+
+	// a late datapoint older than the queued ones is evicted right away
+	_, err = receiveString(hub, "fast 0 500\nfast 4 4000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, hub.Status().Datapoints)
+
+	scraped := scrape(t, hub)
+	assert.Contains(t, scraped, "fast 3 3000\nfast 4 4000\n")
+	assert.NotContains(t, scraped, "fast 2 2000")
+	assert.Contains(t, scraped, "slow 1 1000\n")
+}
+
+func TestMaxSeriesDatapointsSkipsImported(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithMaxSeriesDatapoints(2))
+	rec := importBody(hub, strings.NewReader("fast 0 500\nfast 1 1000\nfast 2 2000\n"), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	_, err := receiveString(hub, "fast 3 3000\nfast 4 4000\nfast 5 5000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, hub.Status().Datapoints)
+	assert.Equal(t, 3, hub.stats.currentCountImportedDatapoints)
+
+	scraped := scrape(t, hub)
+	assert.Contains(t, scraped, "fast 0 500\nfast 1 1000\nfast 2 2000\nfast 4 4000\nfast 5 5000\n")
+	assert.NotContains(t, scraped, "fast 3 3000")
+}
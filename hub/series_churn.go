@@ -0,0 +1,298 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// seriesChurnMemory is how long a series is remembered after its last
+	// push, so that it doesn't count as new when pushed again
+	seriesChurnMemory = time.Hour
+
+	churnScopeSource = "source"
+	churnScopeFamily = "family"
+)
+
+var (
+	seriesChurnExceeded = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "series_churn_exceeded_series_total", Help: "Number of new series pushed over the series churn limit of a source or family, by enforcement tier"}, []string{"scope", "value", "tier"})
+	seriesChurnFlagged  = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "series_churn_flagged", Help: "New series per minute of the sources and families over the series churn limit"}, []string{"scope", "value"})
+	seriesChurnKnown    = prometheus.NewGauge(prometheus.GaugeOpts{Name: "series_churn_known_series", Help: "Number of series remembered to tell new series apart"})
+)
+
+func init() {
+	prometheus.MustRegister(seriesChurnExceeded, seriesChurnFlagged, seriesChurnKnown)
+}
+
+// WithSeriesChurnLimit limits the rate at which each source, the values of
+// sourceLabel, and each family create series the hub hasn't seen within the
+// last hour, to perSource and perFamily new series per minute. Cardinality
+// explosions from label bugs ramp up over minutes, so catching them early
+// keeps them from filling the hub. Over a limit, tier warn only flags the
+// source or family, throttle drops the datapoints of its new series, and
+// reject rejects whole pushes creating them. Datapoints of known series are
+// never affected. A limit of 0 disables it.
+func WithSeriesChurnLimit(sourceLabel string, perSource, perFamily int, tier QuotaTier) Option {
+	return func(hub *MetricHub) {
+		hub.seriesChurn = newSeriesChurn(sourceLabel, perSource, perFamily, tier)
+	}
+}
+
+// churnError is returned for pushes rejected by a reject tier series churn
+// limit
+type churnError struct {
+	key    churnKey
+	rate   float64
+	limit  int
+	pushed int
+}
+
+func (e *churnError) Error() string {
+	return fmt.Sprintf("Not accepting push with %d new series for %s %q. Would exceed its churn limit of %d new series per minute, at %.0f\n", e.pushed, e.key.scope, e.key.value, e.limit, e.rate)
+}
+
+type churnKey struct {
+	scope string
+	value string
+}
+
+// churnRate counts new series in the current and previous minute
+type churnRate struct {
+	minute   int64
+	current  int
+	previous int
+}
+
+// rate estimates the new series in the minute before now, weighting the
+// previous minute by how much of it is within that minute
+func (r *churnRate) rate(now time.Time) float64 {
+	minute := now.Unix() / 60
+	switch minute - r.minute {
+	case 0:
+		elapsed := float64(now.Unix()%60) / 60
+		return float64(r.previous)*(1-elapsed) + float64(r.current)
+	case 1:
+		elapsed := float64(now.Unix()%60) / 60
+		return float64(r.current) * (1 - elapsed)
+	}
+	return 0
+}
+
+func (r *churnRate) add(now time.Time, n int) {
+	minute := now.Unix() / 60
+	switch minute - r.minute {
+	case 0:
+	case 1:
+		r.previous, r.current = r.current, 0
+	default:
+		r.previous, r.current = 0, 0
+	}
+	r.minute = minute
+	r.current += n
+}
+
+type seriesChurn struct {
+	label     string
+	perSource int
+	perFamily int
+	tier      QuotaTier
+	// known are the series pushed within seriesChurnMemory, by family and
+	// labeled name, with the time of their last push
+	known     map[string]time.Time
+	rates     map[churnKey]*churnRate
+	flagged   map[churnKey]bool
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newSeriesChurn(label string, perSource, perFamily int, tier QuotaTier) *seriesChurn {
+	return &seriesChurn{
+		label:     label,
+		perSource: perSource,
+		perFamily: perFamily,
+		tier:      tier,
+		known:     make(map[string]time.Time),
+		rates:     make(map[churnKey]*churnRate),
+		flagged:   make(map[churnKey]bool),
+		now:       time.Now,
+	}
+}
+
+// keys returns the limited churn keys a new series of metric in family counts
+// against
+func (s *seriesChurn) keys(family string, metric *dto.Metric) []churnKey {
+	var keys []churnKey
+	if s.perFamily > 0 {
+		keys = append(keys, churnKey{scope: churnScopeFamily, value: family})
+	}
+	if s.perSource > 0 {
+		if source, ok := labelValue(metric, s.label); ok {
+			keys = append(keys, churnKey{scope: churnScopeSource, value: source})
+		}
+	}
+	return keys
+}
+
+func (s *seriesChurn) limit(key churnKey) int {
+	if key.scope == churnScopeSource {
+		return s.perSource
+	}
+	return s.perFamily
+}
+
+func (s *seriesChurn) rate(key churnKey, now time.Time) float64 {
+	if r, ok := s.rates[key]; ok {
+		return r.rate(now)
+	}
+	return 0
+}
+
+// admit enforces the churn limit on a push of families. It returns a
+// churnError, without remembering any series, if the push would take a source
+// or family over a reject tier limit. Otherwise it drops the datapoints of new
+// series over a throttle tier limit from families, remembers the rest, and
+// returns the number of datapoints dropped. Must be called with the hub lock
+// held.
+func (s *seriesChurn) admit(families []*dto.MetricFamily) (int, error) {
+	now := s.now()
+	if now.Sub(s.lastSweep) >= time.Minute {
+		s.sweep(now)
+	}
+
+	// new series of the push, counted once however many datapoints they have
+	newSeries := make(map[string]bool)
+	requested := make(map[churnKey]int)
+	for _, fam := range families {
+		for _, metric := range fam.Metric {
+			name := makeLabeledName(metric, fam.GetName())
+			if _, ok := s.known[name]; ok || newSeries[name] {
+				continue
+			}
+			newSeries[name] = true
+			for _, key := range s.keys(fam.GetName(), metric) {
+				requested[key]++
+			}
+		}
+	}
+	for key, n := range requested {
+		rate := s.rate(key, now)
+		if rate+float64(n) <= float64(s.limit(key)) {
+			continue
+		}
+		s.flag(key, rate+float64(n))
+		if s.tier == QuotaTierReject {
+			seriesChurnExceeded.WithLabelValues(key.scope, key.value, string(QuotaTierReject)).Add(float64(n))
+			err := &churnError{key: key, rate: rate, limit: s.limit(key), pushed: n}
+			logging.Error("Rejected push over series churn limit", "err", err)
+			return 0, err
+		}
+	}
+
+	dropped := 0
+	admitted := make(map[string]bool, len(newSeries))
+	throttled := make(map[string]bool)
+	for _, fam := range families {
+		kept := fam.Metric[:0]
+		for _, metric := range fam.Metric {
+			name := makeLabeledName(metric, fam.GetName())
+			if throttled[name] {
+				dropped++
+				continue
+			}
+			if newSeries[name] && !admitted[name] {
+				keys := s.keys(fam.GetName(), metric)
+				if over := s.over(keys, now); over != nil {
+					seriesChurnExceeded.WithLabelValues(over.scope, over.value, string(s.tier)).Inc()
+					if s.tier == QuotaTierThrottle {
+						throttled[name] = true
+						dropped++
+						continue
+					}
+				}
+				admitted[name] = true
+				for _, key := range keys {
+					s.addRate(key, now)
+				}
+			}
+			s.known[name] = now
+			kept = append(kept, metric)
+		}
+		fam.Metric = kept
+	}
+	seriesChurnKnown.Set(float64(len(s.known)))
+	return dropped, nil
+}
+
+// over returns the first of keys whose churn rate is used up
+func (s *seriesChurn) over(keys []churnKey, now time.Time) *churnKey {
+	for i, key := range keys {
+		if s.rate(key, now)+1 > float64(s.limit(key)) {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+func (s *seriesChurn) addRate(key churnKey, now time.Time) {
+	r, ok := s.rates[key]
+	if !ok {
+		r = &churnRate{}
+		s.rates[key] = r
+	}
+	r.add(now, 1)
+}
+
+// flag marks key as over its churn limit at rate
+func (s *seriesChurn) flag(key churnKey, rate float64) {
+	if !s.flagged[key] {
+		logging.Warn("Creating new series over the churn limit", "scope", key.scope, "value", key.value, "per_minute", int(rate), "limit", s.limit(key))
+	}
+	s.flagged[key] = true
+	seriesChurnFlagged.WithLabelValues(key.scope, key.value).Set(rate)
+}
+
+// sweep forgets series not pushed within seriesChurnMemory and the rates of
+// keys without new series in the last minutes, and unflags keys that are back
+// under the limit
+func (s *seriesChurn) sweep(now time.Time) {
+	s.lastSweep = now
+	for name, lastPush := range s.known {
+		if now.Sub(lastPush) > seriesChurnMemory {
+			delete(s.known, name)
+		}
+	}
+	seriesChurnKnown.Set(float64(len(s.known)))
+	for key := range s.flagged {
+		if s.rate(key, now) <= float64(s.limit(key)) {
+			delete(s.flagged, key)
+			seriesChurnFlagged.DeleteLabelValues(key.scope, key.value)
+		}
+	}
+	for key, r := range s.rates {
+		if r.rate(now) == 0 {
+			delete(s.rates, key)
+		}
+	}
+}
+
+// forget removes the churn rate of source. Must be called with the hub lock
+// held.
+func (s *seriesChurn) forget(source string) {
+	key := churnKey{scope: churnScopeSource, value: source}
+	delete(s.rates, key)
+	if s.flagged[key] {
+		delete(s.flagged, key)
+		seriesChurnFlagged.DeleteLabelValues(key.scope, key.value)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// churnFamily returns a family with a series for each of ids pushed by
+// gateway
+func churnFamily(name, gateway string, ids ...int) *dto.MetricFamily {
+	fam := &dto.MetricFamily{Name: proto.String(name), Type: dto.MetricType_GAUGE.Enum()}
+	for _, id := range ids {
+		fam.Metric = append(fam.Metric, &dto.Metric{
+			Label: []*dto.LabelPair{
+				{Name: proto.String("gatewayID"), Value: proto.String(gateway)},
+				{Name: proto.String("id"), Value: proto.String(fmt.Sprint(id))},
+			},
+			Gauge:       &dto.Gauge{Value: proto.Float64(1)},
+			TimestampMs: proto.Int64(timestamp),
+		})
+	}
+	return fam
+}
+
+func TestSeriesChurnWarn(t *testing.T) {
+	hub := NewMetricHub(0, 100, WithSeriesChurnLimit("gatewayID", 2, 0, QuotaTierWarn))
+	exceeded := testutil.ToFloat64(seriesChurnExceeded.WithLabelValues(churnScopeSource, "gwWarn", "warn"))
+
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{churnFamily("fam1", "gwWarn", 1, 2, 3)})
+	assert.Equal(t, 3, result.AcceptedDatapoints)
+	assert.Empty(t, result.Reasons)
+	assert.Equal(t, exceeded+1, testutil.ToFloat64(seriesChurnExceeded.WithLabelValues(churnScopeSource, "gwWarn", "warn")))
+	assert.Equal(t, float64(3), testutil.ToFloat64(seriesChurnFlagged.WithLabelValues(churnScopeSource, "gwWarn")))
+}
+
+func TestSeriesChurnThrottle(t *testing.T) {
+	hub := NewMetricHub(0, 100, WithSeriesChurnLimit("gatewayID", 2, 0, QuotaTierThrottle))
+
+	// the third new series of gw1 is dropped, gw2 has its own rate
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{
+		churnFamily("fam1", "gw1", 1, 2, 3),
+		churnFamily("fam2", "gw2", 1, 2),
+	})
+	assert.Equal(t, 4, result.AcceptedDatapoints)
+	assert.Equal(t, 1, result.RejectedDatapoints)
+	assert.Equal(t, []RejectReason{RejectSeriesChurn}, result.Reasons)
+
+	// known series are always accepted
+	result = hub.ReceiveGRPC([]*dto.MetricFamily{churnFamily("fam1", "gw1", 1, 2, 4)})
+	assert.Equal(t, 2, result.AcceptedDatapoints)
+	assert.Equal(t, 1, result.RejectedDatapoints)
+	assert.Equal(t, 6, hub.Status().Datapoints)
+}
+
+func TestSeriesChurnReject(t *testing.T) {
+	hub := NewMetricHub(0, 100, WithSeriesChurnLimit("", 0, 2, QuotaTierReject))
+
+	resp, err := receiveString(hub, "fam1{id=\"1\"} 1 1000\nfam1{id=\"1\"} 1 2000\nfam1{id=\"2\"} 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp, err = receiveString(hub, "fam1{id=\"1\"} 1 3000\nfam1{id=\"3\"} 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, 3, hub.Status().Datapoints)
+
+	// other families are not affected
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{churnFamily("fam2", "gw1", 1, 2)})
+	assert.Equal(t, 2, result.AcceptedDatapoints)
+	result = hub.ReceiveGRPC([]*dto.MetricFamily{churnFamily("fam1", "gw1", 1)})
+	assert.Equal(t, 0, result.AcceptedDatapoints)
+	assert.Equal(t, []RejectReason{RejectSeriesChurn}, result.Reasons)
+	assert.Contains(t, hub.Capabilities().Features, FeatureSeriesChurn)
+}
+
+func TestSeriesChurnRecovers(t *testing.T) {
+	hub := NewMetricHub(0, 100, WithSeriesChurnLimit("gatewayID", 2, 0, QuotaTierThrottle))
+	now := time.Unix(6000, 0)
+	hub.seriesChurn.now = func() time.Time { return now }
+
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{churnFamily("fam1", "gwRecover", 1, 2, 3)})
+	assert.Equal(t, 2, result.AcceptedDatapoints)
+
+	// the rate of the previous minute fades out
+	now = now.Add(time.Minute + 30*time.Second)
+	result = hub.ReceiveGRPC([]*dto.MetricFamily{churnFamily("fam1", "gwRecover", 3)})
+	assert.Equal(t, 1, result.AcceptedDatapoints)
+	now = now.Add(2 * time.Minute)
+	result = hub.ReceiveGRPC([]*dto.MetricFamily{churnFamily("fam1", "gwRecover", 4, 5)})
+	assert.Equal(t, 2, result.AcceptedDatapoints)
+	assert.Empty(t, hub.seriesChurn.flagged)
+
+	// series not pushed for an hour are new again
+	now = now.Add(seriesChurnMemory + 2*time.Minute)
+	hub.seriesChurn.sweep(now)
+	assert.Empty(t, hub.seriesChurn.known)
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"sort"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// WithSeriesOrderLabel emits the datapoints of the series of a family that
+// share a value of label, e.g. gatewayID, in timestamp order relative to each
+// other, instead of series by series, so consumers processing datapoints per
+// device see each device's datapoints of a family in order. Families are
+// still emitted one after the other, as the exposition formats require.
+func WithSeriesOrderLabel(label string) Option {
+	return func(hub *MetricHub) {
+		hub.seriesOrderLabel = label
+	}
+}
+
+// popOrdered is popDatapoints for families leaving the hub, ordering their
+// datapoints by the series order label if the hub has one
+func (c *MetricHub) popOrdered(fam *familyAndMetrics) *dto.MetricFamily {
+	family := fam.popDatapoints()
+	if c.seriesOrderLabel != "" {
+		orderByLabel(family.Metric, c.seriesOrderLabel)
+	}
+	return family
+}
+
+type orderedMetric struct {
+	value  string
+	metric *dto.Metric
+}
+
+// orderByLabel groups metrics by their value of label, and merges the series
+// of each group in timestamp order. Metrics without the label stay first, in
+// their original order, as do metrics of a group with the same timestamp.
+func orderByLabel(metrics []*dto.Metric, label string) {
+	ordered := make([]orderedMetric, len(metrics))
+	for i, metric := range metrics {
+		value, _ := labelValue(metric, label)
+		ordered[i] = orderedMetric{value: value, metric: metric}
+	}
+	// series are already in timestamp order, so this is a merge of sorted
+	// runs
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].value != ordered[j].value {
+			return ordered[i].value < ordered[j].value
+		}
+		return ordered[i].value != "" && ordered[i].metric.GetTimestampMs() < ordered[j].metric.GetTimestampMs()
+	})
+	for i := range ordered {
+		metrics[i] = ordered[i].metric
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const seriesOrderPush = `# TYPE temp gauge
+temp{gatewayID="gw2",sensor="a"} 1 3000
+temp{gatewayID="gw1",sensor="a"} 1 1000
+temp{gatewayID="gw1",sensor="a"} 2 4000
+temp{gatewayID="gw1",sensor="b"} 3 2000
+temp{gatewayID="gw1",sensor="b"} 4 5000
+temp{sensor="c"} 5 6000
+temp{sensor="c"} 6 500
+`
+
+func TestSeriesOrderLabel(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithSeriesOrderLabel("gatewayID"))
+	_, err := receiveString(hub, seriesOrderPush)
+	assert.NoError(t, err)
+
+	// series of gw1 are merged by timestamp, series without the label come
+	// first in series order
+	expected := `# TYPE temp gauge
+temp{sensor="c"} 6 500
+temp{sensor="c"} 5 6000
+temp{gatewayID="gw1",sensor="a"} 1 1000
+temp{gatewayID="gw1",sensor="b"} 3 2000
+temp{gatewayID="gw1",sensor="a"} 2 4000
+temp{gatewayID="gw1",sensor="b"} 4 5000
+temp{gatewayID="gw2",sensor="a"} 1 3000
+`
+	assert.Equal(t, expected, scrape(t, hub))
+}
+
+func TestNoSeriesOrderLabel(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, seriesOrderPush)
+	assert.NoError(t, err)
+
+	expected := `# TYPE temp gauge
+temp{gatewayID="gw1",sensor="a"} 1 1000
+temp{gatewayID="gw1",sensor="a"} 2 4000
+temp{gatewayID="gw1",sensor="b"} 3 2000
+temp{gatewayID="gw1",sensor="b"} 4 5000
+temp{gatewayID="gw2",sensor="a"} 1 3000
+temp{sensor="c"} 6 500
+temp{sensor="c"} 5 6000
+`
+	assert.Equal(t, expected, scrape(t, hub))
+}
+
+func TestSeriesOrderLabelGRPCScrape(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithSeriesOrderLabel("gatewayID"))
+	_, err := receiveString(hub, seriesOrderPush)
+	assert.NoError(t, err)
+
+	families, err := hub.ScrapeFamilies()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(families))
+	var timestamps []int64
+	for _, metric := range families[0].Metric {
+		timestamps = append(timestamps, metric.GetTimestampMs())
+	}
+	assert.Equal(t, []int64{500, 6000, 1000, 2000, 4000, 5000, 3000}, timestamps)
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleRoundTrip(t *testing.T) {
+	metrics := []*dto.Metric{
+		{Counter: &dto.Counter{Value: proto.Float64(1)}, TimestampMs: proto.Int64(10)},
+		{Gauge: &dto.Gauge{Value: proto.Float64(2)}, TimestampMs: proto.Int64(20)},
+		{Untyped: &dto.Untyped{Value: proto.Float64(3)}},
+		{Summary: &dto.Summary{SampleCount: proto.Uint64(4), SampleSum: proto.Float64(5)}, TimestampMs: proto.Int64(30)},
+		{Histogram: &dto.Histogram{SampleCount: proto.Uint64(6), SampleSum: proto.Float64(7)}, TimestampMs: proto.Int64(40)},
+		{TimestampMs: proto.Int64(50)},
+	}
+	for _, metric := range metrics {
+		metric.Label = testLabels
+		assert.True(t, proto.Equal(metric, newSample(metric).metric(testLabels)), metric.String())
+	}
+}
+
+func TestSeriesKeepsTimestampOrder(t *testing.T) {
+	queue := &series{}
+	for _, ts := range []int64{3, 1, 2, 5, 4} {
+		queue.add(sample{timestampMs: ts, hasTimestamp: true})
+	}
+	var timestamps []int64
+	for _, s := range queue.samples {
+		timestamps = append(timestamps, s.timestampMs)
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, timestamps)
+	assert.Equal(t, int64(5), queue.newestTimestampMs())
+}
+
+func TestReceiveDatapointsWithoutTimestamp(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	family := &dto.MetricFamily{
+		Name: proto.String("no_timestamp"),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{
+			{Gauge: &dto.Gauge{Value: proto.Float64(1)}, TimestampMs: proto.Int64(5)},
+			{Gauge: &dto.Gauge{Value: proto.Float64(2)}},
+		},
+	}
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{family})
+	assert.Equal(t, 2, result.AcceptedDatapoints)
+
+	assert.Equal(t, `# TYPE no_timestamp gauge
+no_timestamp 2
+no_timestamp 1 5
+`, scrape(t, hub))
+}
+
+func TestReceiveSplitHistogramBuckets(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, `# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.5"} 2 1000
+latency_seconds_bucket{le="1"} 3 1000
+`)
+	assert.NoError(t, err)
+	_, err = receiveString(hub, `# TYPE latency_seconds histogram
+latency_seconds_bucket{le="1"} 4 1000
+latency_seconds_bucket{le="+Inf"} 4 1000
+latency_seconds_sum 2 1000
+latency_seconds_count 4 1000
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, hub.Status().Datapoints)
+	assert.Equal(t, 1, hub.stats.currentCountSeries)
+
+	assert.Equal(t, `# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.5"} 2 1000
+latency_seconds_bucket{le="1"} 4 1000
+latency_seconds_bucket{le="+Inf"} 4 1000
+latency_seconds_sum 2 1000
+latency_seconds_count 4 1000
+`, scrape(t, hub))
+}
+
+func TestReceiveSplitSummaryQuantiles(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, `# TYPE rpc_seconds summary
+rpc_seconds{quantile="0.5"} 0.1 1000
+rpc_seconds_sum 4 1000
+`)
+	assert.NoError(t, err)
+	_, err = receiveString(hub, `# TYPE rpc_seconds summary
+rpc_seconds{quantile="0.99"} 0.3 1000
+rpc_seconds_count 20 1000
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, hub.Status().Datapoints)
+
+	assert.Equal(t, `# TYPE rpc_seconds summary
+rpc_seconds{quantile="0.5"} 0.1 1000
+rpc_seconds{quantile="0.99"} 0.3 1000
+rpc_seconds_sum 4 1000
+rpc_seconds_count 20 1000
+`, scrape(t, hub))
+}
+
+func TestSplitHistogramsAtDifferentTimestamps(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, `# TYPE latency_seconds histogram
+latency_seconds_bucket{le="+Inf"} 2 1000
+latency_seconds_count 2 1000
+`)
+	assert.NoError(t, err)
+	_, err = receiveString(hub, `# TYPE latency_seconds histogram
+latency_seconds_bucket{le="+Inf"} 3 2000
+latency_seconds_count 3 2000
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, hub.Status().Datapoints)
+	assert.Equal(t, 1, hub.stats.currentCountSeries)
+}
+
+func TestMergeKeepsQueuedMetric(t *testing.T) {
+	queued := &dto.Metric{
+		Histogram: &dto.Histogram{
+			SampleCount: proto.Uint64(1),
+			Bucket:      []*dto.Bucket{{UpperBound: proto.Float64(1), CumulativeCount: proto.Uint64(1)}},
+		},
+		TimestampMs: proto.Int64(1),
+	}
+	update := &dto.Metric{
+		Histogram: &dto.Histogram{
+			SampleCount: proto.Uint64(2),
+			Bucket:      []*dto.Bucket{{UpperBound: proto.Float64(2), CumulativeCount: proto.Uint64(2)}},
+		},
+		TimestampMs: proto.Int64(1),
+	}
+	queue := &series{}
+	assert.False(t, queue.add(newSample(queued)))
+	assert.True(t, queue.add(newSample(update)))
+
+	assert.Equal(t, 1, len(queue.samples))
+	merged := queue.samples[0].metric(nil).GetHistogram()
+	assert.Equal(t, uint64(2), merged.GetSampleCount())
+	assert.Equal(t, 2, len(merged.Bucket))
+	assert.Equal(t, uint64(1), queued.GetHistogram().GetSampleCount())
+	assert.Equal(t, 1, len(queued.GetHistogram().Bucket))
+}
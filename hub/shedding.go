@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	diagnosticsShed = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "diagnostic_requests_shed_total", Help: "Number of expensive diagnostic requests refused to protect the hub"}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(diagnosticsShed)
+}
+
+// WithDiagnosticLimits protects the hub from expensive diagnostic requests,
+// such as /debug?verbose which serializes every buffered datapoint while
+// holding the hub lock. At most maxConcurrent of them run at a time, and
+// none run while the hub is over maxUtilization percent of its limit. Values
+// <= 0 mean no limit.
+func WithDiagnosticLimits(maxConcurrent int, maxUtilization float64) Option {
+	return func(hub *MetricHub) {
+		hub.diagnosticSem = nil
+		if maxConcurrent > 0 {
+			hub.diagnosticSem = make(chan struct{}, maxConcurrent)
+		}
+		hub.maxDiagnosticUtilization = maxUtilization
+	}
+}
+
+// acquireDiagnostic returns a function releasing the diagnostic slot it
+// acquired, or an error if the request should be shed
+func (c *MetricHub) acquireDiagnostic() (func(), error) {
+	if c.maxDiagnosticUtilization > 0 {
+		c.Lock()
+		utilization := c.utilization()
+		c.Unlock()
+		if utilization > c.maxDiagnosticUtilization {
+			diagnosticsShed.WithLabelValues("utilization").Inc()
+			return nil, fmt.Errorf("hub utilization %.2f%% is over %.2f%%", utilization, c.maxDiagnosticUtilization)
+		}
+	}
+	if c.diagnosticSem == nil {
+		return func() {}, nil
+	}
+	select {
+	case c.diagnosticSem <- struct{}{}:
+		return func() { <-c.diagnosticSem }, nil
+	default:
+		diagnosticsShed.WithLabelValues("concurrency").Inc()
+		return nil, fmt.Errorf("%d diagnostic requests already running", cap(c.diagnosticSem))
+	}
+}
+
+// shedDiagnostic responds to a shed diagnostic request with a 503 and the
+// current utilization of the hub
+func (c *MetricHub) shedDiagnostic(ctx echo.Context, err error) error {
+	status := c.Status()
+	ctx.Response().Header().Set("Retry-After", "10")
+	details := map[string]string{
+		"utilization": strconv.FormatFloat(status.Utilization, 'f', 2, 64),
+		"datapoints":  strconv.Itoa(status.Datapoints),
+	}
+	return respondError(ctx, http.StatusServiceUnavailable, ErrorCodeOverloaded, details, "refusing expensive diagnostic request: %v", err)
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func debugRequest(t *testing.T, hub *MetricHub, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.Debug(echo.New().NewContext(req, rec)))
+	return rec
+}
+
+func TestVerboseDebugShedOverUtilization(t *testing.T) {
+	hub := NewMetricHub(20, 10, WithDiagnosticLimits(0, 50))
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+
+	rec := debugRequest(t, hub, "/debug?verbose=true")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	resp := decodeError(t, rec)
+	assert.Equal(t, ErrorCodeOverloaded, resp.Code)
+	assert.Equal(t, "70.00", resp.Details["utilization"])
+	assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+
+	// the plain debug page is cheap and always served
+	assert.Equal(t, http.StatusOK, debugRequest(t, hub, "/debug").Code)
+
+	hub = NewMetricHub(20, 10, WithDiagnosticLimits(0, 80))
+	_, err = receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, debugRequest(t, hub, "/debug?verbose=true").Code)
+}
+
+func TestVerboseDebugShedOverConcurrency(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithDiagnosticLimits(1, 0))
+	release, err := hub.acquireDiagnostic()
+	assert.NoError(t, err)
+
+	rec := debugRequest(t, hub, "/debug?verbose=true")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "1 diagnostic requests already running")
+
+	release()
+	assert.Equal(t, http.StatusOK, debugRequest(t, hub, "/debug?verbose=true").Code)
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	directionRead  = "read"
+	directionWrite = "write"
+)
+
+var (
+	// 1ms to ~16min, since a WAN client can hold a large scrape open for
+	// minutes
+	socketDurationBuckets = prometheus.ExponentialBuckets(0.001, 4, 11)
+
+	httpBodyReadDuration      = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "http_body_read_duration_seconds", Help: "Time spent waiting on the client to send HTTP request bodies", Buckets: socketDurationBuckets}, []string{"handler"})
+	httpResponseWriteDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "http_response_write_duration_seconds", Help: "Time spent waiting on the client to receive HTTP response bodies", Buckets: socketDurationBuckets}, []string{"handler"})
+	slowClients               = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "slow_clients_total", Help: "Number of HTTP requests whose client took longer than the slow client threshold to send the request body or receive the response, by direction"}, []string{"handler", "direction"})
+	slowClientsClosed         = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "slow_clients_closed_total", Help: "Number of connections closed because the client took longer than the slow client threshold, by direction"}, []string{"handler", "direction"})
+)
+
+func init() {
+	prometheus.MustRegister(httpBodyReadDuration, httpResponseWriteDuration, slowClients, slowClientsClosed)
+}
+
+// SlowClientThresholds are how long a client may take to send a request body
+// or receive a response before it is counted as slow. 0 means no threshold.
+// With Close, the connections of slow clients are closed once they reach the
+// threshold instead, so a slow WAN reader can't hold a scrape response, and
+// with it the drained datapoints, open for everyone else.
+type SlowClientThresholds struct {
+	Read  time.Duration
+	Write time.Duration
+	Close bool
+}
+
+type connContextKey struct{}
+
+// SlowClientConnContext keeps the connection of each request in its context,
+// so SlowClientMiddleware can set deadlines on it. Set it as the ConnContext
+// of the HTTP server.
+func SlowClientConnContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, conn)
+}
+
+// SlowClientMiddleware returns echo middleware that records how long clients
+// take to send request bodies and receive responses, and counts, or with
+// thresholds.Close disconnects, clients slower than the thresholds.
+func SlowClientMiddleware(thresholds SlowClientThresholds) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			body := &timedReader{ReadCloser: req.Body}
+			req.Body = body
+			writer := &timedWriter{ResponseWriter: ctx.Response().Writer}
+			ctx.Response().Writer = writer
+
+			conn, _ := req.Context().Value(connContextKey{}).(net.Conn)
+			if thresholds.Close && conn != nil {
+				now := time.Now()
+				if thresholds.Read > 0 {
+					_ = conn.SetReadDeadline(now.Add(thresholds.Read))
+				}
+				if thresholds.Write > 0 {
+					_ = conn.SetWriteDeadline(now.Add(thresholds.Write))
+					// the server doesn't reset write deadlines for the next
+					// request on the connection
+					defer func() { _ = conn.SetWriteDeadline(time.Time{}) }()
+				}
+			}
+
+			err := next(ctx)
+
+			handler := routeLabel(ctx, err)
+			httpBodyReadDuration.WithLabelValues(handler).Observe(body.duration.Seconds())
+			httpResponseWriteDuration.WithLabelValues(handler).Observe(writer.duration.Seconds())
+			checkSlowClient(handler, directionRead, thresholds.Read, body.duration, body.timedOut)
+			checkSlowClient(handler, directionWrite, thresholds.Write, writer.duration, writer.timedOut)
+			return err
+		}
+	}
+}
+
+func checkSlowClient(handler, direction string, threshold, duration time.Duration, timedOut bool) {
+	if timedOut {
+		logging.Warn("Closed connection of slow client", "handler", handler, "threshold", threshold, "direction", direction)
+		slowClientsClosed.WithLabelValues(handler, direction).Inc()
+		slowClients.WithLabelValues(handler, direction).Inc()
+		return
+	}
+	if threshold > 0 && duration > threshold {
+		slowClients.WithLabelValues(handler, direction).Inc()
+	}
+}
+
+// timedReader sums the time spent waiting on reads of a request body
+type timedReader struct {
+	io.ReadCloser
+	duration time.Duration
+	timedOut bool
+}
+
+func (r *timedReader) Read(p []byte) (int, error) {
+	t0 := time.Now()
+	n, err := r.ReadCloser.Read(p)
+	r.duration += time.Since(t0)
+	if isTimeout(err) {
+		r.timedOut = true
+	}
+	return n, err
+}
+
+// timedWriter sums the time spent waiting on writes of a response body. Once
+// the response outgrows the buffer of the server, writes wait for the client
+// to receive earlier parts of it.
+type timedWriter struct {
+	http.ResponseWriter
+	duration time.Duration
+	timedOut bool
+}
+
+func (w *timedWriter) Write(p []byte) (int, error) {
+	t0 := time.Now()
+	n, err := w.ResponseWriter.Write(p)
+	w.duration += time.Since(t0)
+	if isTimeout(err) {
+		w.timedOut = true
+	}
+	return n, err
+}
+
+// Flush is needed for streamed responses, which echo flushes through the
+// writer
+func (w *timedWriter) Flush() {
+	t0 := time.Now()
+	w.ResponseWriter.(http.Flusher).Flush()
+	w.duration += time.Since(t0)
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
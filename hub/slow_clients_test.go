@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowBody sleeps before returning the body, like a client on a slow link
+type slowBody struct {
+	io.Reader
+	delay time.Duration
+}
+
+func (b *slowBody) Read(p []byte) (int, error) {
+	time.Sleep(b.delay)
+	return b.Reader.Read(p)
+}
+
+func TestSlowClientMiddleware(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	e := echo.New()
+	e.Use(SlowClientMiddleware(SlowClientThresholds{Read: 10 * time.Millisecond}))
+	e.POST("/metrics", hub.Receive)
+
+	slow := slowClients.WithLabelValues("/metrics", directionRead)
+	before := testutil.ToFloat64(slow)
+
+	rec := serve(e, httptest.NewRequest(http.MethodPost, "/metrics", strings.NewReader("up 1\n")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, before, testutil.ToFloat64(slow))
+
+	body := &slowBody{Reader: strings.NewReader("up 1\n"), delay: 20 * time.Millisecond}
+	rec = serve(e, httptest.NewRequest(http.MethodPost, "/metrics", body))
+	// slow clients are only counted without Close
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(slow))
+}
+
+func TestSlowClientMiddlewareClose(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	e := echo.New()
+	e.Use(SlowClientMiddleware(SlowClientThresholds{Read: 50 * time.Millisecond, Close: true}))
+	e.POST("/metrics", hub.Receive)
+	server := httptest.NewUnstartedServer(e)
+	server.Config.ConnContext = SlowClientConnContext
+	server.Start()
+	defer server.Close()
+
+	closed := slowClientsClosed.WithLabelValues("/metrics", directionRead)
+	before := testutil.ToFloat64(closed)
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.Write([]byte("up 1\n"))
+		time.Sleep(200 * time.Millisecond)
+		writer.Write([]byte("down 1\n"))
+		writer.Close()
+	}()
+	resp, err := http.Post(server.URL+"/metrics", "text/plain", reader)
+	if err == nil {
+		resp.Body.Close()
+		assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+	}
+	assert.Equal(t, before+1, testutil.ToFloat64(closed))
+	assert.Equal(t, 0, hub.liveDatapoints())
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// StaleSeriesPolicy decides what happens to stale series at scrape time
+type StaleSeriesPolicy string
+
+const (
+	// StaleSeriesDrop drops stale series
+	StaleSeriesDrop StaleSeriesPolicy = "drop"
+	// StaleSeriesDivert moves stale series to /metrics/stale
+	StaleSeriesDivert StaleSeriesPolicy = "divert"
+)
+
+var (
+	staleSeriesFiltered = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "stale_series_filtered_datapoints_total", Help: "Number of scraped datapoints of stale series left out of scrapes, by whether they were dropped or diverted"}, []string{"outcome"})
+	staleSeriesDiverted = prometheus.NewGauge(prometheus.GaugeOpts{Name: "stale_series_diverted_datapoints", Help: "Number of datapoints of stale series waiting to be scraped from /metrics/stale"})
+)
+
+func init() {
+	prometheus.MustRegister(staleSeriesFiltered, staleSeriesDiverted)
+}
+
+// ParseStaleSeriesPolicy returns the stale series policy named by policy
+func ParseStaleSeriesPolicy(policy string) (StaleSeriesPolicy, error) {
+	switch p := StaleSeriesPolicy(policy); p {
+	case StaleSeriesDrop, StaleSeriesDivert:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid stale series policy %q, must be drop or divert", policy)
+}
+
+// WithStaleSeriesFilter leaves series whose newest datapoint is older than
+// threshold out of scrapes, so the backlog of a device that comes back after
+// a long outage doesn't resurrect ancient data in the central TSDB. With
+// StaleSeriesDrop they are dropped. With StaleSeriesDivert they are kept for
+// ScrapeStale instead, up to the hub limit. Series with a datapoint pushed
+// without a timestamp are never stale.
+func WithStaleSeriesFilter(threshold time.Duration, policy StaleSeriesPolicy) Option {
+	return func(hub *MetricHub) {
+		hub.staleSeries = &staleSeriesFilter{
+			threshold: threshold,
+			policy:    policy,
+			diverted:  make(map[string]*familyAndMetrics),
+		}
+	}
+}
+
+// staleSeriesFilter holds the series diverted from scrapes for being stale
+type staleSeriesFilter struct {
+	sync.Mutex
+	threshold          time.Duration
+	policy             StaleSeriesPolicy
+	diverted           map[string]*familyAndMetrics
+	divertedDatapoints int
+}
+
+// isStale reports whether every datapoint of q has a timestamp before cutoffMs
+func (q *series) isStale(cutoffMs int64) bool {
+	for _, s := range q.samples {
+		if !s.hasTimestamp || s.timestampMs >= cutoffMs {
+			return false
+		}
+	}
+	return len(q.samples) > 0
+}
+
+// filterStaleSeries removes the stale series of now from drained, and drops
+// or diverts them. Diverted datapoints beyond the hub limit are dropped.
+func (c *MetricHub) filterStaleSeries(drained map[string]*familyAndMetrics, now time.Time) {
+	filter := c.staleSeries
+	limit := c.currentLimit()
+	cutoffMs := now.Add(-filter.threshold).UnixNano() / int64(time.Millisecond)
+	filter.Lock()
+	defer filter.Unlock()
+	dropped, diverted := 0, 0
+	for name, family := range drained {
+		for seriesName, queue := range family.metrics {
+			if !queue.isStale(cutoffMs) {
+				continue
+			}
+			delete(family.metrics, seriesName)
+			if filter.policy != StaleSeriesDivert || (limit > 0 && filter.divertedDatapoints+len(queue.samples) > limit) {
+				dropped += len(queue.samples)
+				continue
+			}
+			held, ok := filter.diverted[name]
+			if !ok {
+				held = &familyAndMetrics{family: family.family, metrics: make(map[string]*series), bufferedSince: family.bufferedSince}
+				filter.diverted[name] = held
+			}
+			diverted += len(queue.samples)
+			existing, ok := held.metrics[seriesName]
+			if !ok {
+				held.metrics[seriesName] = queue
+				filter.divertedDatapoints += len(queue.samples)
+				continue
+			}
+			for _, s := range queue.samples {
+				if !existing.add(s) {
+					filter.divertedDatapoints++
+				}
+			}
+		}
+		if len(family.metrics) == 0 {
+			delete(drained, name)
+		}
+	}
+	staleSeriesFiltered.WithLabelValues("dropped").Add(float64(dropped))
+	staleSeriesFiltered.WithLabelValues("diverted").Add(float64(diverted))
+	staleSeriesDiverted.Set(float64(filter.divertedDatapoints))
+}
+
+// ScrapeStale is a handler function for scrapes of the stale series diverted
+// from regular scrapes. Formats them in the text format and removes them.
+func (c *MetricHub) ScrapeStale(ctx echo.Context) error {
+	if c.staleSeries == nil || c.staleSeries.policy != StaleSeriesDivert {
+		return respondError(ctx, http.StatusNotFound, ErrorCodeNotFound, nil, "stale series are not diverted")
+	}
+	filter := c.staleSeries
+	filter.Lock()
+	diverted := filter.diverted
+	filter.diverted = make(map[string]*familyAndMetrics)
+	filter.divertedDatapoints = 0
+	staleSeriesDiverted.Set(0)
+	filter.Unlock()
+
+	return respondScrape(ctx, echo.MIMETextPlainCharsetUTF8, c.exposeDrained(diverted, c.scrapeWorkers))
+}
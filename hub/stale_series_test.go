@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrapeStale(hub *MetricHub) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/metrics/stale", nil)
+	rec := httptest.NewRecorder()
+	_ = hub.ScrapeStale(echo.New().NewContext(req, rec))
+	return rec
+}
+
+func stalePush(now time.Time) string {
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	hourAgoMs := now.Add(-time.Hour).UnixNano() / int64(time.Millisecond)
+	return fmt.Sprintf(`# TYPE up gauge
+up{gw="fresh"} 1 %d
+up{gw="dead"} 1 %d
+up{gw="dead"} 2 %d
+up{gw="mixed"} 1 %d
+up{gw="mixed"} 2 %d
+up{gw="untimestamped"} 1
+`, nowMs, hourAgoMs-1000, hourAgoMs, hourAgoMs, nowMs)
+}
+
+func TestStaleSeriesDrop(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithStaleSeriesFilter(10*time.Minute, StaleSeriesDrop))
+	_, err := receiveString(hub, stalePush(time.Now()))
+	assert.NoError(t, err)
+
+	exposition := scrape(t, hub)
+	assert.Contains(t, exposition, `up{gw="fresh"}`)
+	assert.Contains(t, exposition, `up{gw="mixed"}`)
+	assert.Contains(t, exposition, `up{gw="untimestamped"} 1`)
+	assert.NotContains(t, exposition, `gw="dead"`)
+	assert.Equal(t, 0, hub.stats.currentCountDatapoints)
+
+	rec := scrapeStale(hub)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestStaleSeriesDivert(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithStaleSeriesFilter(10*time.Minute, StaleSeriesDivert))
+	now := time.Now()
+	_, err := receiveString(hub, stalePush(now))
+	assert.NoError(t, err)
+
+	exposition := scrape(t, hub)
+	assert.Contains(t, exposition, `up{gw="fresh"}`)
+	assert.NotContains(t, exposition, `gw="dead"`)
+
+	// diverted series accumulate across scrapes
+	_, err = receiveString(hub, fmt.Sprintf("# TYPE up gauge\nup{gw=\"dead\"} 3 %d\n", now.Add(-30*time.Minute).UnixNano()/int64(time.Millisecond)))
+	assert.NoError(t, err)
+	assert.NotContains(t, scrape(t, hub), `gw="dead"`)
+	assert.Equal(t, 3, hub.staleSeries.divertedDatapoints)
+
+	rec := scrapeStale(hub)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `up{gw="dead"} 1`)
+	assert.Contains(t, rec.Body.String(), `up{gw="dead"} 2`)
+	assert.Contains(t, rec.Body.String(), `up{gw="dead"} 3`)
+	assert.NotContains(t, rec.Body.String(), `gw="fresh"`)
+
+	rec = scrapeStale(hub)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Body.String())
+}
+
+func TestStaleSeriesDivertLimit(t *testing.T) {
+	hub := NewMetricHub(2, 10, WithStaleSeriesFilter(10*time.Minute, StaleSeriesDivert))
+	hourAgoMs := time.Now().Add(-time.Hour).UnixNano() / int64(time.Millisecond)
+	_, err := receiveString(hub, fmt.Sprintf("up{gw=\"a\"} 1 %d\nup{gw=\"a\"} 2 %d\n", hourAgoMs, hourAgoMs+1))
+	assert.NoError(t, err)
+	scrape(t, hub)
+	_, err = receiveString(hub, fmt.Sprintf("up{gw=\"b\"} 1 %d\n", hourAgoMs))
+	assert.NoError(t, err)
+	scrape(t, hub)
+
+	// the second series didn't fit
+	rec := scrapeStale(hub)
+	assert.Contains(t, rec.Body.String(), `up{gw="a"}`)
+	assert.NotContains(t, rec.Body.String(), `gw="b"`)
+}
+
+func TestParseStaleSeriesPolicy(t *testing.T) {
+	policy, err := ParseStaleSeriesPolicy("divert")
+	assert.NoError(t, err)
+	assert.Equal(t, StaleSeriesDivert, policy)
+	_, err = ParseStaleSeriesPolicy("keep")
+	assert.Error(t, err)
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	trackedSources        = prometheus.NewGauge(prometheus.GaugeOpts{Name: "tracked_sources", Help: "Number of sources that pushed within the stale source period"})
+	staleSourcesRemoved   = prometheus.NewCounter(prometheus.CounterOpts{Name: "stale_sources_removed_total", Help: "Number of sources forgotten because they stopped pushing"})
+	stalePurgedSeries     = prometheus.NewCounter(prometheus.CounterOpts{Name: "stale_source_purged_series_total", Help: "Number of buffered series of stale sources purged from the hub"})
+	stalePurgedDatapoints = prometheus.NewCounter(prometheus.CounterOpts{Name: "stale_source_purged_datapoints_total", Help: "Number of buffered datapoints of stale sources purged from the hub"})
+	staleWatermarks       = prometheus.NewCounter(prometheus.CounterOpts{Name: "stale_clock_watermarks_removed_total", Help: "Number of clock regression watermarks removed because their series stopped being scraped"})
+)
+
+func init() {
+	prometheus.MustRegister(trackedSources, staleSourcesRemoved, stalePurgedSeries, stalePurgedDatapoints, staleWatermarks)
+}
+
+// WithStaleSourceCleanup tracks the last push of each distinct value of
+// sourceLabel, and makes RunStaleSourceCleanup forget sources that haven't
+// pushed for staleAfter: their heartbeats, label quota usage, series churn
+// rates and clock regression watermarks are removed, so bookkeeping doesn't
+// grow forever as devices are decommissioned. If purge is set, their series
+// still buffered in the hub are dropped as well.
+func WithStaleSourceCleanup(sourceLabel string, staleAfter time.Duration, purge bool) Option {
+	return func(hub *MetricHub) {
+		hub.staleSources = &staleSources{
+			label:      sourceLabel,
+			staleAfter: staleAfter,
+			purge:      purge,
+			lastPush:   make(map[string]time.Time),
+		}
+	}
+}
+
+// staleSources tracks the last push time per source
+type staleSources struct {
+	sync.Mutex
+	label      string
+	staleAfter time.Duration
+	purge      bool
+	lastPush   map[string]time.Time
+}
+
+// record marks every source with a metric in family as having pushed at now
+func (s *staleSources) record(family *dto.MetricFamily, now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	for _, metric := range family.Metric {
+		if source, ok := labelValue(metric, s.label); ok {
+			s.lastPush[source] = now
+		}
+	}
+	trackedSources.Set(float64(len(s.lastPush)))
+}
+
+// expire removes and returns the sources that last pushed before now minus
+// the stale period
+func (s *staleSources) expire(now time.Time) []string {
+	s.Lock()
+	defer s.Unlock()
+	var stale []string
+	for source, lastPush := range s.lastPush {
+		if now.Sub(lastPush) > s.staleAfter {
+			stale = append(stale, source)
+			delete(s.lastPush, source)
+		}
+	}
+	trackedSources.Set(float64(len(s.lastPush)))
+	return stale
+}
+
+func labelValue(metric *dto.Metric, name string) (string, bool) {
+	return findLabel(metric.Label, name)
+}
+
+func seriesLabelValue(queue *series, name string) (string, bool) {
+	return findLabel(queue.labels, name)
+}
+
+func findLabel(labels []*dto.LabelPair, name string) (string, bool) {
+	for _, label := range labels {
+		if label.GetName() == name {
+			return label.GetValue(), true
+		}
+	}
+	return "", false
+}
+
+// RunStaleSourceCleanup forgets stale sources every interval until stop is
+// closed. Does nothing if stale source cleanup is not enabled.
+func (c *MetricHub) RunStaleSourceCleanup(interval time.Duration, stop <-chan struct{}) {
+	if c.staleSources == nil {
+		return
+	}
+	ticks, stopTicker := c.clock.NewTicker(interval)
+	defer stopTicker()
+	for {
+		select {
+		case <-ticks:
+			c.cleanupStaleSources(c.clock.Now())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// cleanupStaleSources removes the bookkeeping of sources that haven't pushed
+// within the stale period of now, and returns the number of sources removed
+func (c *MetricHub) cleanupStaleSources(now time.Time) int {
+	stale := c.staleSources.expire(now)
+	if c.clockGuard != nil {
+		// watermarks are per series rather than per source, so expire those
+		// of series that haven't been scraped within the stale period
+		cutoffMs := now.Add(-c.staleSources.staleAfter).UnixNano() / int64(time.Millisecond)
+		staleWatermarks.Add(float64(c.clockGuard.expire(cutoffMs)))
+	}
+	if len(stale) == 0 {
+		return 0
+	}
+
+	label := c.staleSources.label
+	if c.heartbeats != nil && c.heartbeats.label == label {
+		c.heartbeats.forget(stale)
+	}
+	c.Lock()
+	if c.labelQuotas != nil {
+		for _, source := range stale {
+			c.labelQuotas.forget(label, source)
+		}
+	}
+	if c.seriesChurn != nil && c.seriesChurn.label == label {
+		for _, source := range stale {
+			c.seriesChurn.forget(source)
+		}
+	}
+	if c.staleSources.purge {
+		series, datapoints := c.purgeSources(label, stale)
+		stalePurgedSeries.Add(float64(series))
+		stalePurgedDatapoints.Add(float64(datapoints))
+	}
+	c.Unlock()
+
+	staleSourcesRemoved.Add(float64(len(stale)))
+	logging.Info("Removed stale sources", "sources", len(stale))
+	return len(stale)
+}
+
+// purgeSources drops the buffered series with label set to one of sources,
+// and returns the number of series and datapoints dropped. Must be called
+// with the hub lock held.
+func (c *MetricHub) purgeSources(label string, sources []string) (int, int) {
+	purge := make(map[string]bool, len(sources))
+	for _, source := range sources {
+		purge[source] = true
+	}
+	purgedSeries, purgedDatapoints, purgedImported := 0, 0, 0
+	for name, family := range c.metricFamiliesByName {
+		for name, queue := range family.metrics {
+			source, ok := seriesLabelValue(queue, label)
+			if !ok || !purge[source] {
+				continue
+			}
+			delete(family.metrics, name)
+			purgedSeries++
+			purgedDatapoints += len(queue.samples)
+			purgedImported += countImported(queue.samples)
+		}
+		if len(family.metrics) == 0 {
+			delete(c.metricFamiliesByName, name)
+			c.stats.currentCountFamilies--
+		}
+	}
+
+	c.stats.currentCountSeries -= purgedSeries
+	c.stats.currentCountDatapoints -= purgedDatapoints
+	c.stats.currentCountImportedDatapoints -= purgedImported
+	hubSize.Set(float64(c.stats.currentCountDatapoints))
+	return purgedSeries, purgedDatapoints
+}
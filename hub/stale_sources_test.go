@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanupStaleSources(t *testing.T) {
+	hub := NewMetricHub(0, 10,
+		WithSourceHeartbeats("gatewayID"),
+		WithStaleSourceCleanup("gatewayID", time.Hour, false),
+	)
+	hub.ReceiveGRPC([]*dto.MetricFamily{
+		makeFamily(dto.MetricType_GAUGE, "fam1", 2, gatewayLabels("gw1"), timestamp),
+		makeFamily(dto.MetricType_GAUGE, "fam2", 2, gatewayLabels("gw2"), timestamp),
+	})
+
+	assert.Equal(t, 0, hub.cleanupStaleSources(time.Now()))
+	assert.Equal(t, 2, hub.cleanupStaleSources(time.Now().Add(2*time.Hour)))
+	assert.Empty(t, hub.staleSources.lastPush)
+	assert.Empty(t, hub.heartbeats.lastPush)
+	// buffered series are kept without purge
+	assert.Equal(t, 4, hub.Status().Datapoints)
+}
+
+func TestCleanupStaleSourcesPurge(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithStaleSourceCleanup("gatewayID", time.Hour, true))
+	hub.ReceiveGRPC([]*dto.MetricFamily{
+		makeFamily(dto.MetricType_GAUGE, "fam1", 2, gatewayLabels("gw1"), timestamp),
+		makeFamily(dto.MetricType_GAUGE, "fam2", 3, gatewayLabels("gw2"), timestamp),
+	})
+	hub.staleSources.lastPush["gw2"] = time.Now().Add(-2 * time.Hour)
+
+	assert.Equal(t, 1, hub.cleanupStaleSources(time.Now()))
+	assert.Equal(t, 2, hub.Status().Datapoints)
+	assert.Equal(t, 1, hub.stats.currentCountFamilies)
+	assert.Equal(t, 1, hub.stats.currentCountSeries)
+	_, ok := hub.metricFamiliesByName["fam2"]
+	assert.False(t, ok)
+	_, ok = hub.staleSources.lastPush["gw1"]
+	assert.True(t, ok)
+}
+
+func TestCleanupStaleSourcesPurgeImported(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithStaleSourceCleanup("gatewayID", time.Hour, true))
+	rec := importBody(hub, strings.NewReader("fam1{gatewayID=\"gw2\"} 1 1000\nfam1{gatewayID=\"gw2\"} 2 2000\n"), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam2", 2, gatewayLabels("gw1"), timestamp)})
+	hub.staleSources.lastPush["gw2"] = time.Now().Add(-2 * time.Hour)
+
+	// the purged imported datapoints stop counting against the import limit,
+	// and the live ones still count against the hub limit
+	assert.Equal(t, 1, hub.cleanupStaleSources(time.Now()))
+	assert.Equal(t, 2, hub.Status().Datapoints)
+	assert.Equal(t, 0, hub.stats.currentCountImportedDatapoints)
+	assert.Equal(t, 2, hub.liveDatapoints())
+}
+
+func TestCleanupStaleSourcesClearsQuotaUsage(t *testing.T) {
+	hub := NewMetricHub(0, 10,
+		WithLabelQuotas([]LabelQuota{{Label: "gatewayID", Value: "gw1", Datapoints: 10, Tier: QuotaTierReject}}),
+		WithStaleSourceCleanup("gatewayID", time.Hour, false),
+	)
+	hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 8, gatewayLabels("gw1"), timestamp)})
+
+	hub.cleanupStaleSources(time.Now().Add(2 * time.Hour))
+	// the quota is available again although no scrape reset it
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam2", 8, gatewayLabels("gw1"), timestamp)})
+	assert.Equal(t, 8, result.AcceptedDatapoints)
+}
+
+func TestCleanupStaleWatermarks(t *testing.T) {
+	hub := NewMetricHub(0, 10,
+		WithClockRegressionPolicy(ClockRegressionReject),
+		WithStaleSourceCleanup("gatewayID", time.Hour, false),
+	)
+	now := time.Now()
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	hub.ReceiveGRPC([]*dto.MetricFamily{
+		makeFamily(dto.MetricType_GAUGE, "old", 1, gatewayLabels("gw1"), nowMs-2*time.Hour.Milliseconds()),
+		makeFamily(dto.MetricType_GAUGE, "fresh", 1, gatewayLabels("gw1"), nowMs),
+	})
+	scrape(t, hub)
+	assert.Equal(t, 2, len(hub.clockGuard.watermarks))
+
+	hub.cleanupStaleSources(now)
+	assert.Equal(t, 1, len(hub.clockGuard.watermarks))
+}
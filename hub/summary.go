@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	// DatapointsHeader is set on HEAD /metrics responses to the number of
+	// datapoints a scrape would return
+	DatapointsHeader = "X-Edge-Hub-Datapoints"
+	// ContentHashHeader is set on HEAD /metrics responses to the content hash
+	// of the hub
+	ContentHashHeader = "X-Edge-Hub-Content-Hash"
+)
+
+// Summary describes what a scrape of the hub would return, without
+// serializing it
+type Summary struct {
+	Families   int `json:"families"`
+	Series     int `json:"series"`
+	Datapoints int `json:"datapoints"`
+	// Utilization is the percent of the hub limit in use, or 0 if the hub has
+	// no limit
+	Utilization float64 `json:"utilization"`
+	// ContentHash is a hash of every series in the hub with its number of
+	// datapoints and newest timestamp. It changes whenever datapoints are
+	// pushed or scraped, so scrapers can skip hubs whose content they have
+	// already seen.
+	ContentHash string `json:"content_hash"`
+}
+
+// Summary returns a Summary of the datapoints currently in the hub
+func (c *MetricHub) Summary() Summary {
+	c.Lock()
+	defer c.Unlock()
+
+	// Sum the hashes of the series so the result doesn't depend on map order
+	// and nothing has to be sorted while holding the lock
+	var contentHash uint64
+	for _, family := range c.metricFamiliesByName {
+		for name, queue := range family.metrics {
+			if len(queue.samples) == 0 {
+				continue
+			}
+			h := fnv.New64a()
+			fmt.Fprintf(h, "%s/%d/%d", name, len(queue.samples), queue.newestTimestampMs())
+			contentHash += h.Sum64()
+		}
+	}
+	return Summary{
+		Families:    c.stats.currentCountFamilies,
+		Series:      c.stats.currentCountSeries,
+		Datapoints:  c.stats.currentCountDatapoints,
+		Utilization: c.utilization(),
+		ContentHash: fmt.Sprintf("%016x", contentHash),
+	}
+}
+
+// ScrapeSummary is a handler function returning the Summary of the hub as
+// JSON, without consuming any datapoints
+func (c *MetricHub) ScrapeSummary(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, c.Summary())
+}
+
+// ScrapeHead is a handler function for HEAD requests on the scrape endpoint.
+// It sets the datapoint count and content hash headers without consuming any
+// datapoints, and responds with 204 if a scrape would return nothing.
+func (c *MetricHub) ScrapeHead(ctx echo.Context) error {
+	if remaining := c.warmUpRemaining(); remaining > 0 {
+		ctx.Response().Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())+1))
+		return ctx.NoContent(http.StatusServiceUnavailable)
+	}
+
+	summary := c.Summary()
+	ctx.Response().Header().Set(DatapointsHeader, strconv.Itoa(summary.Datapoints))
+	ctx.Response().Header().Set(ContentHashHeader, summary.ContentHash)
+	if summary.Datapoints == 0 {
+		return ctx.NoContent(http.StatusNoContent)
+	}
+	return ctx.NoContent(http.StatusOK)
+}
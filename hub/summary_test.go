@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummary(t *testing.T) {
+	hub := NewMetricHub(28, 10)
+	empty := hub.Summary()
+	assert.Equal(t, Summary{ContentHash: "0000000000000000"}, empty)
+
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	summary := hub.Summary()
+	assert.Equal(t, 3, summary.Families)
+	assert.Equal(t, 5, summary.Series)
+	assert.Equal(t, 14, summary.Datapoints)
+	assert.Equal(t, 50.0, summary.Utilization)
+	assert.NotEqual(t, empty.ContentHash, summary.ContentHash)
+	assert.Equal(t, summary, hub.Summary())
+
+	_, err = receiveString(hub, "cpu_usage{host=\"A\"} 1 1395066364000\n")
+	assert.NoError(t, err)
+	assert.NotEqual(t, summary.ContentHash, hub.Summary().ContentHash)
+
+	scrape(t, hub)
+	assert.Equal(t, empty, hub.Summary())
+}
+
+func TestScrapeSummary(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics/summary", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.ScrapeSummary(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var summary Summary
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &summary))
+	assert.Equal(t, hub.Summary(), summary)
+	// nothing was consumed
+	assert.Equal(t, 14, hub.Status().Datapoints)
+}
+
+func TestScrapeHead(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	rec := scrapeHead(t, hub)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get(DatapointsHeader))
+
+	_, err := receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	rec = scrapeHead(t, hub)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "14", rec.Header().Get(DatapointsHeader))
+	assert.Equal(t, hub.Summary().ContentHash, rec.Header().Get(ContentHashHeader))
+	assert.Equal(t, 14, hub.Status().Datapoints)
+
+	warming := NewMetricHub(0, 10, WithWarmUp(time.Hour))
+	assert.Equal(t, http.StatusServiceUnavailable, scrapeHead(t, warming).Code)
+}
+
+func scrapeHead(t *testing.T, hub *MetricHub) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodHead, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.ScrapeHead(echo.New().NewContext(req, rec)))
+	return rec
+}
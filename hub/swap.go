@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/golang/protobuf/proto"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// SwapIDHeader is set on responses to buffer swaps to the handle that
+	// commits or rolls back the swap
+	SwapIDHeader = "X-Edge-Hub-Swap-Id"
+
+	defaultSwapTimeout = time.Minute
+
+	swapResultCommitted  = "committed"
+	swapResultRolledBack = "rolled_back"
+	swapResultExpired    = "expired"
+)
+
+var (
+	bufferSwaps     = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "buffer_swaps_total", Help: "Number of buffer swaps by how they ended: committed, rolled_back or expired"}, []string{"result"})
+	bufferSwapsOpen = prometheus.NewGauge(prometheus.GaugeOpts{Name: "buffer_swaps_open", Help: "Number of buffer swaps neither committed nor rolled back yet"})
+)
+
+func init() {
+	prometheus.MustRegister(bufferSwaps, bufferSwapsOpen)
+}
+
+// ErrUnknownSwap is returned when committing or rolling back a swap that was
+// already committed, rolled back or expired
+var ErrUnknownSwap = errors.New("unknown buffer swap")
+
+// BufferSwap is the contents of the hub handed to an external processor.
+// Until it is committed, its datapoints can still be put back into the hub.
+type BufferSwap struct {
+	// ID is the handle to commit or roll back the swap with. It is also the
+	// scrape ID of the swapped generation.
+	ID       string
+	Families []*dto.MetricFamily
+}
+
+// pendingSwaps are the swapped generations not committed or rolled back yet,
+// by swap ID
+type pendingSwaps struct {
+	sync.Mutex
+	swaps map[string]*pendingSwap
+}
+
+type pendingSwap struct {
+	drained map[string]*familyAndMetrics
+	// size is the size of the swapped families in bytes
+	size  int
+	timer *time.Timer
+}
+
+// SwapBuffer takes the contents of the hub out for an external processor,
+// with the same exactly-once semantics as a scrape: the open generation is
+// sealed, and pushes arriving after the swap go to the next one. The swap
+// must be committed with CommitSwap once the processor has consumed it, or
+// rolled back with RollbackSwap to put its datapoints back into the hub. A
+// swap neither committed nor rolled back within timeout is rolled back.
+func (c *MetricHub) SwapBuffer(timeout time.Duration) (*BufferSwap, error) {
+	if c.warmUpRemaining() > 0 {
+		return nil, ErrWarmingUp
+	}
+
+	drained, id := c.drain()
+	families := make([]*dto.MetricFamily, 0, len(drained))
+	size := 0
+	for _, fam := range drained {
+		pullFamily := c.popOrdered(fam)
+		families = append(families, pullFamily)
+		size += proto.Size(pullFamily)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].GetName() < families[j].GetName()
+	})
+
+	c.swaps.Lock()
+	if c.swaps.swaps == nil {
+		c.swaps.swaps = make(map[string]*pendingSwap)
+	}
+	c.swaps.swaps[id] = &pendingSwap{
+		drained: drained,
+		size:    size,
+		timer: time.AfterFunc(timeout, func() {
+			if c.endSwap(id, swapResultExpired) {
+				logging.Warn("Rolled back buffer swap that was not committed in time", "swap_id", id, "timeout", timeout)
+			}
+		}),
+	}
+	bufferSwapsOpen.Set(float64(len(c.swaps.swaps)))
+	c.swaps.Unlock()
+	return &BufferSwap{ID: id, Families: families}, nil
+}
+
+// CommitSwap drops the datapoints of the swap with id for good
+func (c *MetricHub) CommitSwap(id string) error {
+	if !c.endSwap(id, swapResultCommitted) {
+		return ErrUnknownSwap
+	}
+	return nil
+}
+
+// RollbackSwap puts the datapoints of the swap with id back into the hub, to
+// be served by a later scrape or swap
+func (c *MetricHub) RollbackSwap(id string) error {
+	if !c.endSwap(id, swapResultRolledBack) {
+		return ErrUnknownSwap
+	}
+	return nil
+}
+
+// endSwap removes the swap with id, putting its datapoints back into the hub
+// unless it is committed. Returns false if there is no such swap.
+func (c *MetricHub) endSwap(id string, result string) bool {
+	c.swaps.Lock()
+	swap, ok := c.swaps.swaps[id]
+	if ok {
+		delete(c.swaps.swaps, id)
+		swap.timer.Stop()
+	}
+	bufferSwapsOpen.Set(float64(len(c.swaps.swaps)))
+	c.swaps.Unlock()
+	if !ok {
+		return false
+	}
+
+	if result == swapResultCommitted {
+		c.recordScrape(int64(swap.size), len(swap.drained))
+	} else {
+		c.requeue(swap.drained)
+	}
+	bufferSwaps.WithLabelValues(result).Inc()
+	return true
+}
+
+// SwapHandler is a handler function swapping out the contents of the hub, see
+// SwapBuffer. The response has the datapoints in the text format, and the
+// swap ID in the X-Edge-Hub-Swap-Id header. The timeout query parameter sets
+// how long the swap may stay open, one minute by default.
+func (c *MetricHub) SwapHandler(ctx echo.Context) error {
+	timeout := defaultSwapTimeout
+	if param := ctx.QueryParam("timeout"); param != "" {
+		parsed, err := time.ParseDuration(param)
+		if err != nil || parsed <= 0 {
+			return respondError(ctx, http.StatusBadRequest, ErrorCodeInvalidRequest, nil, "invalid timeout %q: must be a positive duration such as 30s", param)
+		}
+		timeout = parsed
+	}
+
+	swap, err := c.SwapBuffer(timeout)
+	if err != nil {
+		remaining := c.warmUpRemaining()
+		ctx.Response().Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())+1))
+		return respondWarmingUp(ctx, remaining)
+	}
+	var exposition []byte
+	for _, fam := range swap.Families {
+		familyString, err := familyToString(fam)
+		if err != nil {
+			logging.Error("Dropped family from buffer swap that failed to convert to string", "family", fam.GetName(), "err", err)
+			continue
+		}
+		exposition = append(exposition, familyString...)
+	}
+	ctx.Response().Header().Set(SwapIDHeader, swap.ID)
+	ctx.Response().Header().Set(ScrapeIDHeader, swap.ID)
+	return ctx.Blob(http.StatusOK, echo.MIMETextPlainCharsetUTF8, exposition)
+}
+
+// CommitSwapHandler is a handler function committing the swap with the id
+// path parameter
+func (c *MetricHub) CommitSwapHandler(ctx echo.Context) error {
+	if err := c.CommitSwap(ctx.Param("id")); err != nil {
+		return respondError(ctx, http.StatusNotFound, ErrorCodeNotFound, map[string]string{"swap_id": ctx.Param("id")}, "%v %q: it was already committed, rolled back or expired", err, ctx.Param("id"))
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// RollbackSwapHandler is a handler function rolling back the swap with the id
+// path parameter
+func (c *MetricHub) RollbackSwapHandler(ctx echo.Context) error {
+	if err := c.RollbackSwap(ctx.Param("id")); err != nil {
+		return respondError(ctx, http.StatusNotFound, ErrorCodeNotFound, map[string]string{"swap_id": ctx.Param("id")}, "%v %q: it was already committed, rolled back or expired", err, ctx.Param("id"))
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSwapBufferCommit(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, "b 1 1000\na 1 1000\n")
+	assert.NoError(t, err)
+
+	swap, err := hub.SwapBuffer(time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, swap.Families, 2)
+	assert.Equal(t, "a", swap.Families[0].GetName())
+
+	// pushes after the swap go to the next generation
+	_, err = receiveString(hub, "c 1 1000\n")
+	assert.NoError(t, err)
+	assert.NoError(t, hub.CommitSwap(swap.ID))
+	assert.Equal(t, ErrUnknownSwap, hub.CommitSwap(swap.ID))
+	assert.Equal(t, ErrUnknownSwap, hub.RollbackSwap(swap.ID))
+	assert.Equal(t, "# TYPE c untyped\nc 1 1000\n", scrape(t, hub))
+}
+
+func TestSwapBufferRollback(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, "a 1 1000\n")
+	assert.NoError(t, err)
+
+	swap, err := hub.SwapBuffer(time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, hub.Status().Datapoints)
+	_, err = receiveString(hub, "a 2 2000\n")
+	assert.NoError(t, err)
+	assert.NoError(t, hub.RollbackSwap(swap.ID))
+	assert.Equal(t, "# TYPE a untyped\na 1 1000\na 2 2000\n", scrape(t, hub))
+}
+
+func TestSwapBufferExpires(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	expired := testutil.ToFloat64(bufferSwaps.WithLabelValues(swapResultExpired))
+	_, err := receiveString(hub, "a 1 1000\n")
+	assert.NoError(t, err)
+
+	swap, err := hub.SwapBuffer(10 * time.Millisecond)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return hub.Status().Datapoints == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, ErrUnknownSwap, hub.CommitSwap(swap.ID))
+	assert.Equal(t, expired+1, testutil.ToFloat64(bufferSwaps.WithLabelValues(swapResultExpired)))
+}
+
+func TestSwapHandlers(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	_, err := receiveString(hub, "a 1 1000\n")
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	assert.NoError(t, hub.SwapHandler(echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/api/v1/swap?timeout=1m", nil), rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "# TYPE a untyped\na 1 1000\n", rec.Body.String())
+	id := rec.Header().Get(SwapIDHeader)
+	assert.NotEmpty(t, id)
+
+	commit := func() int {
+		rec := httptest.NewRecorder()
+		ctx := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(id)
+		assert.NoError(t, hub.CommitSwapHandler(ctx))
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusNoContent, commit())
+	assert.Equal(t, http.StatusNotFound, commit())
+
+	rec = httptest.NewRecorder()
+	assert.NoError(t, hub.SwapHandler(echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/api/v1/swap?timeout=soon", nil), rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
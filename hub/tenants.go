@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// TenantHeader names the tenant of an HTTP push. With a tenant allowlist,
+	// pushes for a tenant not on it are rejected before their body is read.
+	TenantHeader = "X-Edge-Hub-Tenant"
+
+	tenantReasonUnknown  = "unknown_tenant"
+	tenantReasonMissing  = "missing_tenant"
+	tenantReasonMismatch = "tenant_mismatch"
+)
+
+var (
+	rejectedTenantPushes = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "rejected_tenant_pushes_total", Help: "Number of pushes rejected by the tenant allowlist, by reason"}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(rejectedTenantPushes)
+}
+
+// WithTenants only accepts pushes whose datapoints all have one of tenants as
+// value of label, e.g. networkID, so a misconfigured device can't push into
+// another tenant or invent new ones. An HTTP push with a TenantHeader must
+// carry that tenant on all datapoints, and datapoints without label get it.
+func WithTenants(label string, tenants []string) Option {
+	return func(hub *MetricHub) {
+		allowed := make(map[string]bool, len(tenants))
+		for _, tenant := range tenants {
+			allowed[tenant] = true
+		}
+		hub.tenants = &tenantAllowlist{label: label, allowed: allowed}
+	}
+}
+
+// WithTenantLabelRewrite moves the tenant of pushed datapoints from the label
+// of WithTenants to target once the push is admitted, or drops the label if
+// target is empty. Devices that can't send a TenantHeader can then name their
+// tenant in a label of their own, e.g. networkID, without it ending up in the
+// stored series.
+func WithTenantLabelRewrite(target string) Option {
+	return func(hub *MetricHub) {
+		hub.rewriteTenantLabel = true
+		hub.tenantTargetLabel = target
+	}
+}
+
+// tenantError is returned for pushes rejected by the tenant allowlist
+type tenantError struct {
+	reason string
+	msg    string
+}
+
+func (e *tenantError) Error() string {
+	return e.msg
+}
+
+type tenantAllowlist struct {
+	label   string
+	allowed map[string]bool
+}
+
+// admitHeader returns a tenantError if the tenant of a push header is not
+// allowed
+func (t *tenantAllowlist) admitHeader(tenant string) error {
+	if !t.allowed[tenant] {
+		return t.reject(tenantReasonUnknown, "Not accepting push for unknown tenant %q\n", tenant)
+	}
+	return nil
+}
+
+// admit returns a tenantError unless every datapoint in families has an
+// allowed tenant. If the push names tenant, datapoints must have that tenant,
+// and those without a tenant label are given it.
+func (t *tenantAllowlist) admit(families []*dto.MetricFamily, tenant string) error {
+	if tenant != "" {
+		if err := t.admitHeader(tenant); err != nil {
+			return err
+		}
+	}
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			value, ok := labelValue(metric, t.label)
+			switch {
+			case !ok && tenant != "":
+				continue
+			case !ok:
+				return t.reject(tenantReasonMissing, "Not accepting push with datapoints of %s without a %s label\n", family.GetName(), t.label)
+			case tenant != "" && value != tenant:
+				return t.reject(tenantReasonMismatch, "Not accepting push for tenant %q with datapoints of %s for %s=%q\n", tenant, family.GetName(), t.label, value)
+			case !t.allowed[value]:
+				return t.reject(tenantReasonUnknown, "Not accepting push with datapoints of %s for unknown tenant %s=%q\n", family.GetName(), t.label, value)
+			}
+		}
+	}
+	if tenant != "" {
+		for _, family := range families {
+			for _, metric := range family.Metric {
+				if _, ok := labelValue(metric, t.label); !ok {
+					metric.Label = append(metric.Label, &dto.LabelPair{Name: proto.String(t.label), Value: proto.String(tenant)})
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// rewrite moves the tenant label of every datapoint in families to target, or
+// drops it if target is empty. A target label already on a datapoint is
+// replaced.
+func (t *tenantAllowlist) rewrite(families []*dto.MetricFamily, target string) {
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			labels := metric.Label[:0]
+			var tenant *dto.LabelPair
+			for _, label := range metric.Label {
+				switch label.GetName() {
+				case t.label:
+					tenant = label
+				case target:
+				default:
+					labels = append(labels, label)
+				}
+			}
+			if tenant != nil && target != "" {
+				labels = append(labels, &dto.LabelPair{Name: proto.String(target), Value: tenant.Value})
+			}
+			metric.Label = labels
+		}
+	}
+}
+
+func (t *tenantAllowlist) reject(reason string, format string, args ...interface{}) error {
+	rejectedTenantPushes.WithLabelValues(reason).Inc()
+	return &tenantError{reason: reason, msg: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func receiveTenant(hub *MetricHub, tenant, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/metrics", strings.NewReader(body))
+	req.Header.Set(TenantHeader, tenant)
+	rec := httptest.NewRecorder()
+	hub.Receive(echo.New().NewContext(req, rec))
+	return rec
+}
+
+func networkLabels(networkID string) []*dto.LabelPair {
+	return []*dto.LabelPair{{Name: proto.String("networkID"), Value: proto.String(networkID)}}
+}
+
+func TestTenantsRejectUnknownTenants(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithTenants("networkID", []string{"net1", "net2"}))
+	unknown := testutil.ToFloat64(rejectedTenantPushes.WithLabelValues(tenantReasonUnknown))
+	missing := testutil.ToFloat64(rejectedTenantPushes.WithLabelValues(tenantReasonMissing))
+
+	resp, err := receiveString(hub, "up{networkID=\"net1\"} 1 1000\nup{networkID=\"net2\"} 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// one datapoint of an unknown or no tenant rejects the whole push
+	resp, err = receiveString(hub, "up{networkID=\"net1\"} 1 2000\nup{networkID=\"net3\"} 1 2000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	resp, err = receiveString(hub, "up{networkID=\"net1\"} 1 2000\nup 1 2000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Equal(t, 2, hub.Status().Datapoints)
+	assert.Equal(t, unknown+1, testutil.ToFloat64(rejectedTenantPushes.WithLabelValues(tenantReasonUnknown)))
+	assert.Equal(t, missing+1, testutil.ToFloat64(rejectedTenantPushes.WithLabelValues(tenantReasonMissing)))
+
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 3, networkLabels("net3"), timestamp)})
+	assert.Equal(t, 0, result.AcceptedDatapoints)
+	assert.Equal(t, 3, result.RejectedDatapoints)
+	assert.Equal(t, []RejectReason{RejectUnknownTenant}, result.Reasons)
+	result = hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 3, networkLabels("net2"), timestamp)})
+	assert.Equal(t, 3, result.AcceptedDatapoints)
+}
+
+func TestTenantHeader(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithTenants("networkID", []string{"net1", "net2"}))
+	mismatch := testutil.ToFloat64(rejectedTenantPushes.WithLabelValues(tenantReasonMismatch))
+
+	// unknown tenants are rejected before the body is parsed
+	assert.Equal(t, http.StatusForbidden, receiveTenant(hub, "net3", "not metrics{").Code)
+
+	// datapoints of another tenant are rejected, and those without a tenant
+	// get the one of the push
+	assert.Equal(t, http.StatusForbidden, receiveTenant(hub, "net1", "up{networkID=\"net2\"} 1 1000\n").Code)
+	assert.Equal(t, mismatch+1, testutil.ToFloat64(rejectedTenantPushes.WithLabelValues(tenantReasonMismatch)))
+	assert.Equal(t, http.StatusOK, receiveTenant(hub, "net1", "up{networkID=\"net1\",job=\"a\"} 1 1000\nup{job=\"b\"} 1 1000\n").Code)
+	assert.Equal(t, "# TYPE up untyped\nup{job=\"a\",networkID=\"net1\"} 1 1000\nup{job=\"b\",networkID=\"net1\"} 1 1000\n", scrape(t, hub))
+}
+
+func TestTenantHeaderWithoutAllowlist(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	assert.Equal(t, http.StatusOK, receiveTenant(hub, "net3", "up 1 1000\n").Code)
+	assert.Equal(t, "# TYPE up untyped\nup 1 1000\n", scrape(t, hub))
+}
+
+func TestTenantsInBatches(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithTenants("networkID", []string{"net1"}))
+	rec := receiveBatch(t, hub, []testPart{
+		{groupingLabels: "networkID=net1", body: "up 1 1000\n"},
+		{groupingLabels: "networkID=net2", body: "up 1 1000\n"},
+	})
+	assert.Equal(t, http.StatusMultiStatus, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"status":403`)
+	assert.Equal(t, 1, hub.Status().Datapoints)
+	assert.Contains(t, hub.Capabilities().Features, FeatureTenants)
+}
+
+func TestTenantLabelRewrite(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithTenants("networkID", []string{"net1"}), WithTenantLabelRewrite("tenant"))
+	resp, err := receiveString(hub, "up{networkID=\"net1\",tenant=\"spoofed\",job=\"a\"} 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, http.StatusOK, receiveTenant(hub, "net1", "up{job=\"b\"} 1 1000\n").Code)
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{makeFamily(dto.MetricType_GAUGE, "fam1", 1, networkLabels("net1"), timestamp)})
+	assert.Equal(t, 1, result.AcceptedDatapoints)
+	assert.ElementsMatch(t, []string{
+		"# TYPE up untyped", "up{job=\"a\",tenant=\"net1\"} 1 1000", "up{job=\"b\",tenant=\"net1\"} 1 1000",
+		"# HELP fam1 fam1", "# TYPE fam1 gauge", "fam1{tenant=\"net1\"} 0 1559953047",
+	}, scrapedLines(scrape(t, hub)))
+
+	// unknown tenants are still rejected
+	resp, err = receiveString(hub, "up{networkID=\"net2\"} 1 2000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
+
+func TestTenantLabelDropped(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithTenants("networkID", []string{"net1"}), WithTenantLabelRewrite(""))
+	_, err := receiveString(hub, "up{networkID=\"net1\",job=\"a\"} 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "# TYPE up untyped\nup{job=\"a\"} 1 1000\n", scrape(t, hub))
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var throttleHints = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "throttle_hints_total", Help: "Number of push responses with a hint to slow down, by transport"}, []string{"transport"})
+
+func init() {
+	prometheus.MustRegister(throttleHints)
+}
+
+// ThrottleHint asks a client to slow down its pushes to a hub close to its
+// limit
+type ThrottleHint struct {
+	// Delay is how long to wait before the next push
+	Delay time.Duration
+	// RemainingDatapoints is how many more datapoints the hub can take
+	RemainingDatapoints int
+}
+
+// WithThrottleHints makes ThrottleHint suggest a delay once the hub is over
+// utilization percent of its limit, growing from 0 to maxDelay as the hub
+// fills up, so clients slow down before pushes are rejected rather than
+// retrying them blindly. Has no effect without a limit.
+func WithThrottleHints(utilization float64, maxDelay time.Duration) Option {
+	return func(hub *MetricHub) {
+		hub.throttleUtilization = utilization
+		hub.throttleMaxDelay = maxDelay
+	}
+}
+
+// ThrottleHint returns the hint for a client that pushed over transport, or
+// false if the hub isn't over the throttle utilization
+func (c *MetricHub) ThrottleHint(transport string) (ThrottleHint, bool) {
+	if c.throttleUtilization <= 0 {
+		return ThrottleHint{}, false
+	}
+	c.Lock()
+	limit := c.limit
+	utilization := c.utilization()
+	used := c.stats.currentCountDatapoints + c.queuedDatapoints + c.unackedDatapoints
+	c.Unlock()
+	if limit <= 0 || utilization < c.throttleUtilization {
+		return ThrottleHint{}, false
+	}
+
+	throttleHints.WithLabelValues(transport).Inc()
+	hint := ThrottleHint{Delay: c.throttleMaxDelay}
+	if c.throttleUtilization < 100 && utilization < 100 {
+		share := (utilization - c.throttleUtilization) / (100 - c.throttleUtilization)
+		hint.Delay = time.Duration(share * float64(c.throttleMaxDelay))
+	}
+	if remaining := limit - used; remaining > 0 {
+		hint.RemainingDatapoints = remaining
+	}
+	return hint, true
+}
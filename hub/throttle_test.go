@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottleHint(t *testing.T) {
+	hub := NewMetricHub(10, 10, WithThrottleHints(50, 10*time.Second))
+	_, err := receiveString(hub, "a 1 1000\nb 1 1000\nc 1 1000\nd 1 1000\n")
+	assert.NoError(t, err)
+	_, ok := hub.ThrottleHint("grpc")
+	assert.False(t, ok)
+
+	// 80% is 60% of the way from 50% to full
+	_, err = receiveString(hub, "e 1 1000\nf 1 1000\ng 1 1000\nh 1 1000\n")
+	assert.NoError(t, err)
+	hint, ok := hub.ThrottleHint("grpc")
+	assert.True(t, ok)
+	assert.Equal(t, ThrottleHint{Delay: 6 * time.Second, RemainingDatapoints: 2}, hint)
+
+	_, err = receiveString(hub, "i 1 1000\nj 1 1000\n")
+	assert.NoError(t, err)
+	hint, ok = hub.ThrottleHint("grpc")
+	assert.True(t, ok)
+	assert.Equal(t, ThrottleHint{Delay: 10 * time.Second}, hint)
+}
+
+func TestNoThrottleHintWithoutLimit(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithThrottleHints(50, 10*time.Second))
+	_, err := receiveString(hub, "a 1 1000\n")
+	assert.NoError(t, err)
+	_, ok := hub.ThrottleHint("grpc")
+	assert.False(t, ok)
+}
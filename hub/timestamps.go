@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// TimestampPolicy decides what happens to pushed datapoints without a
+// timestamp
+type TimestampPolicy string
+
+const (
+	// TimestampPassthrough stores them without a timestamp, so the scraper
+	// stamps them with the scrape time
+	TimestampPassthrough TimestampPolicy = "passthrough"
+	// TimestampReceive stamps them with the time the hub received them
+	TimestampReceive TimestampPolicy = "receive"
+	// TimestampReject rejects pushes with any of them
+	TimestampReject TimestampPolicy = "reject"
+)
+
+var (
+	receiveTimestampedDatapoints = prometheus.NewCounter(prometheus.CounterOpts{Name: "receive_timestamped_datapoints_total", Help: "Number of pushed datapoints without a timestamp stamped with their receive time"})
+	missingTimestampPushes       = prometheus.NewCounter(prometheus.CounterOpts{Name: "missing_timestamp_rejected_pushes_total", Help: "Number of pushes rejected for having datapoints without a timestamp"})
+)
+
+func init() {
+	prometheus.MustRegister(receiveTimestampedDatapoints, missingTimestampPushes)
+}
+
+// ParseTimestampPolicy returns the timestamp policy named by policy
+func ParseTimestampPolicy(policy string) (TimestampPolicy, error) {
+	switch p := TimestampPolicy(policy); p {
+	case TimestampPassthrough, TimestampReceive, TimestampReject:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid timestamp policy %q, must be receive, reject or passthrough", policy)
+}
+
+// WithDefaultTimestamp sets what happens to pushed datapoints without a
+// timestamp. By default they are stored without one and get the time of the
+// scrape that serves them, which can be long after they were measured. With
+// TimestampReceive they get the time the hub received them instead, and with
+// TimestampReject pushes with any of them are rejected.
+func WithDefaultTimestamp(policy TimestampPolicy) Option {
+	return func(hub *MetricHub) {
+		hub.timestampPolicy = policy
+	}
+}
+
+type missingTimestampError struct {
+	family     string
+	datapoints int
+}
+
+func (e *missingTimestampError) Error() string {
+	return fmt.Sprintf("%d datapoints of family %s have no timestamp", e.datapoints, e.family)
+}
+
+// stampFamily sets the timestamp of the metrics of family without one to
+// nowMs
+func stampFamily(family *dto.MetricFamily, nowMs int64) {
+	stamped := 0
+	for _, metric := range family.Metric {
+		if metric.TimestampMs == nil {
+			timestampMs := nowMs
+			metric.TimestampMs = &timestampMs
+			stamped++
+		}
+	}
+	receiveTimestampedDatapoints.Add(float64(stamped))
+}
+
+// checkTimestamps returns a missingTimestampError for the first of families
+// with metrics without a timestamp
+func checkTimestamps(families []*dto.MetricFamily) error {
+	for _, family := range families {
+		missing := 0
+		for _, metric := range family.Metric {
+			if metric.TimestampMs == nil {
+				missing++
+			}
+		}
+		if missing > 0 {
+			missingTimestampPushes.Inc()
+			return &missingTimestampError{family: family.GetName(), datapoints: missing}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+const mixedTimestampPush = `# TYPE up gauge
+up{gw="a"} 1 1000
+up{gw="b"} 1
+`
+
+func TestDefaultTimestampPassthrough(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	rec, err := receiveString(hub, mixedTimestampPush)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	exposition := scrape(t, hub)
+	assert.Contains(t, exposition, `up{gw="a"} 1 1000`)
+	assert.Contains(t, exposition, "up{gw=\"b\"} 1\n")
+}
+
+func TestDefaultTimestampReceive(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithDefaultTimestamp(TimestampReceive))
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	_, err := receiveString(hub, mixedTimestampPush)
+	assert.NoError(t, err)
+	after := time.Now().UnixNano() / int64(time.Millisecond)
+
+	families, err := hub.ScrapeFamilies()
+	assert.NoError(t, err)
+	assert.Len(t, families, 1)
+	assert.Len(t, families[0].Metric, 2)
+	for _, metric := range families[0].Metric {
+		gw, _ := labelValue(metric, "gw")
+		if gw == "a" {
+			assert.Equal(t, int64(1000), metric.GetTimestampMs())
+			continue
+		}
+		assert.NotNil(t, metric.TimestampMs)
+		assert.True(t, metric.GetTimestampMs() >= before && metric.GetTimestampMs() <= after)
+	}
+}
+
+func TestDefaultTimestampReject(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithDefaultTimestamp(TimestampReject))
+	rec, err := receiveString(hub, mixedTimestampPush)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	resp := decodeError(t, rec)
+	assert.Equal(t, ErrorCodeMissingTimestamp, resp.Code)
+	assert.Equal(t, map[string]string{"family": "up", "datapoints": "1"}, resp.Details)
+	assert.Equal(t, 0, hub.stats.currentCountDatapoints)
+
+	rec, err = receiveString(hub, "# TYPE up gauge\nup 1 1000\n")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestDefaultTimestampRejectGRPC(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithDefaultTimestamp(TimestampReject))
+	family := &dto.MetricFamily{
+		Name: proto.String("up"),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{
+			{Gauge: &dto.Gauge{Value: proto.Float64(1)}, TimestampMs: proto.Int64(1000)},
+			{Gauge: &dto.Gauge{Value: proto.Float64(2)}},
+		},
+	}
+	result := hub.ReceiveGRPC([]*dto.MetricFamily{family})
+	assert.Equal(t, 0, result.AcceptedDatapoints)
+	assert.Equal(t, 2, result.RejectedDatapoints)
+	assert.Equal(t, []RejectReason{RejectMissingTimestamp}, result.Reasons)
+	assert.Equal(t, 0, hub.stats.currentCountDatapoints)
+}
+
+func TestParseTimestampPolicy(t *testing.T) {
+	for _, name := range []string{"passthrough", "receive", "reject"} {
+		policy, err := ParseTimestampPolicy(name)
+		assert.NoError(t, err)
+		assert.Equal(t, TimestampPolicy(name), policy)
+	}
+	_, err := ParseTimestampPolicy("now")
+	assert.Error(t, err)
+}
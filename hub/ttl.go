@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var expiredDatapoints = prometheus.NewCounter(prometheus.CounterOpts{Name: "expired_datapoints_total", Help: "Number of buffered datapoints dropped for being older than the metric TTL"})
+
+func init() {
+	prometheus.MustRegister(expiredDatapoints)
+}
+
+// WithMetricTTL drops buffered datapoints with timestamps older than ttl, so
+// while nothing scrapes the hub, stale datapoints expire instead of piling up
+// until the limit blocks new pushes. RunExpiry drops them. Datapoints pushed
+// without a timestamp have no age and never expire.
+func WithMetricTTL(ttl time.Duration) Option {
+	return func(hub *MetricHub) {
+		hub.metricTTL = ttl
+	}
+}
+
+// RunExpiry drops expired datapoints every interval until stop is closed.
+// Does nothing if the hub has no metric TTL and no config file that may set
+// one.
+func (c *MetricHub) RunExpiry(interval time.Duration, stop <-chan struct{}) {
+	c.Lock()
+	metricTTL := c.metricTTL
+	c.Unlock()
+	if metricTTL <= 0 && c.configFile == "" {
+		return
+	}
+	ticks, stopTicker := c.clock.NewTicker(interval)
+	defer stopTicker()
+	for {
+		select {
+		case <-ticks:
+			c.expire(c.clock.Now())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// expire drops the datapoints with timestamps older than the metric TTL
+// before now, and returns the number dropped
+func (c *MetricHub) expire(now time.Time) int {
+	c.Lock()
+	defer c.Unlock()
+	if c.metricTTL <= 0 {
+		return 0
+	}
+	cutoffMs := now.Add(-c.metricTTL).UnixNano() / int64(time.Millisecond)
+	expired, expiredImported := 0, 0
+	for name, family := range c.metricFamiliesByName {
+		for seriesName, queue := range family.metrics {
+			// queues are sorted, so expired datapoints are a prefix, along
+			// with those without timestamps
+			if len(queue.samples) == 0 || queue.samples[0].timestampMs >= cutoffMs {
+				continue
+			}
+			kept := queue.samples[:0]
+			for _, s := range queue.samples {
+				if s.hasTimestamp && s.timestampMs < cutoffMs {
+					expired++
+					if s.imported {
+						expiredImported++
+					}
+					continue
+				}
+				kept = append(kept, s)
+			}
+			for i := len(kept); i < len(queue.samples); i++ {
+				queue.samples[i] = sample{}
+			}
+			queue.samples = kept
+			if len(kept) == 0 {
+				delete(family.metrics, seriesName)
+				c.stats.currentCountSeries--
+			}
+		}
+		if len(family.metrics) == 0 {
+			delete(c.metricFamiliesByName, name)
+			c.stats.currentCountFamilies--
+		}
+	}
+	if expired == 0 {
+		return 0
+	}
+
+	c.stats.currentCountDatapoints -= expired
+	c.stats.currentCountImportedDatapoints -= expiredImported
+	hubSize.Set(float64(c.stats.currentCountDatapoints))
+	expiredDatapoints.Add(float64(expired))
+	logging.Info("Expired datapoints", "datapoints", expired, "ttl", c.metricTTL)
+	return expired
+}
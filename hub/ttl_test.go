@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpire(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithMetricTTL(time.Minute))
+	_, err := receiveString(hub, `a 1 1000
+a 2 100000
+b 1 1000
+untimestamped 1
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, hub.Status().Datapoints)
+
+	// 2 minutes after the epoch, so datapoints before 60000 are expired
+	assert.Equal(t, 2, hub.expire(time.Unix(120, 0)))
+	assert.Equal(t, 2, hub.Status().Datapoints)
+	assert.Equal(t, 0, hub.expire(time.Unix(120, 0)))
+
+	scraped := scrape(t, hub)
+	assert.Contains(t, scraped, "a 2 100000\n")
+	assert.Contains(t, scraped, "untimestamped 1\n")
+	assert.NotContains(t, scraped, "b 1")
+	assert.NotContains(t, scraped, "a 1 1000")
+	assert.Contains(t, hub.Capabilities().Features, FeatureMetricTTL)
+}
+
+func TestExpireImported(t *testing.T) {
+	hub := NewMetricHub(0, 10, WithMetricTTL(time.Minute))
+	rec := importBody(hub, strings.NewReader("old 1 1000\nold 2 100000\n"), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	_, err := receiveString(hub, "a 1 1000\na 2 100000\n")
+	assert.NoError(t, err)
+
+	// only the expired imported datapoint stops counting against the import
+	// limit
+	assert.Equal(t, 2, hub.expire(time.Unix(120, 0)))
+	assert.Equal(t, 2, hub.Status().Datapoints)
+	assert.Equal(t, 1, hub.stats.currentCountImportedDatapoints)
+}
+
+func TestRunExpiryWithoutTTL(t *testing.T) {
+	hub := NewMetricHub(0, 10)
+	// returns right away
+	hub.RunExpiry(time.Millisecond, nil)
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+var coercedUntypedFamilies = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "untyped_coerced_families_total", Help: "Number of pushed untyped families given a type, by type"}, []string{"type"})
+
+func init() {
+	prometheus.MustRegister(coercedUntypedFamilies)
+}
+
+// WithUntypedConversion gives pushed untyped families a type, so recording
+// rules and functions relying on types work on metrics of clients that push
+// without TYPE lines. Families whose whole name matches gauges become gauges,
+// and those matching counters or ending in _total become counters. Untyped
+// name_bucket, name_sum and name_count families with matching series become a
+// name histogram. gauges and counters may be nil.
+func WithUntypedConversion(gauges, counters *regexp.Regexp) Option {
+	return func(hub *MetricHub) {
+		hub.untypedConverter = &untypedConverter{gauges: gauges, counters: counters}
+	}
+}
+
+type untypedConverter struct {
+	gauges   *regexp.Regexp
+	counters *regexp.Regexp
+}
+
+// convert types the untyped families of a push, returning families with the
+// parts of converted histograms replaced by the histogram
+func (u *untypedConverter) convert(families []*dto.MetricFamily) []*dto.MetricFamily {
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		if _, ok := byName[family.GetName()]; ok {
+			// Pushes over gRPC may repeat a family, which makes it
+			// ambiguous which one a histogram part belongs to
+			byName[family.GetName()] = nil
+			continue
+		}
+		byName[family.GetName()] = family
+	}
+
+	merged := map[*dto.MetricFamily]bool{}
+	var histograms []*dto.MetricFamily
+	for _, family := range families {
+		if family.GetType() != dto.MetricType_UNTYPED || !strings.HasSuffix(family.GetName(), "_bucket") || u.forced(family.GetName()) {
+			continue
+		}
+		name := strings.TrimSuffix(family.GetName(), "_bucket")
+		if _, ok := byName[name]; ok {
+			continue
+		}
+		sum, count := byName[name+"_sum"], byName[name+"_count"]
+		if !u.histogramPart(sum) || !u.histogramPart(count) || byName[family.GetName()] == nil {
+			continue
+		}
+		histogram, ok := mergeHistogram(name, family, sum, count)
+		if !ok {
+			continue
+		}
+		merged[family], merged[sum], merged[count] = true, true, true
+		histograms = append(histograms, histogram)
+		coercedUntypedFamilies.WithLabelValues("histogram").Inc()
+	}
+
+	converted := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		if merged[family] {
+			continue
+		}
+		if family.GetType() == dto.MetricType_UNTYPED {
+			u.convertFamily(family)
+		}
+		converted = append(converted, family)
+	}
+	return append(converted, histograms...)
+}
+
+// forced returns whether name is given a type by the gauges or counters
+// regexes, which takes precedence over the suffix heuristics
+func (u *untypedConverter) forced(name string) bool {
+	return (u.gauges != nil && u.gauges.MatchString(name)) || (u.counters != nil && u.counters.MatchString(name))
+}
+
+func (u *untypedConverter) histogramPart(family *dto.MetricFamily) bool {
+	return family != nil && family.GetType() == dto.MetricType_UNTYPED && !u.forced(family.GetName())
+}
+
+// convertFamily makes family a gauge or counter if its name says so
+func (u *untypedConverter) convertFamily(family *dto.MetricFamily) {
+	name := family.GetName()
+	switch {
+	case u.gauges != nil && u.gauges.MatchString(name):
+		family.Type = dto.MetricType_GAUGE.Enum()
+		for _, metric := range family.Metric {
+			if metric.Untyped != nil {
+				metric.Gauge = &dto.Gauge{Value: metric.Untyped.Value}
+				metric.Untyped = nil
+			}
+		}
+		coercedUntypedFamilies.WithLabelValues("gauge").Inc()
+	case (u.counters != nil && u.counters.MatchString(name)) || strings.HasSuffix(name, "_total"):
+		family.Type = dto.MetricType_COUNTER.Enum()
+		for _, metric := range family.Metric {
+			if metric.Untyped != nil {
+				metric.Counter = &dto.Counter{Value: metric.Untyped.Value}
+				metric.Untyped = nil
+			}
+		}
+		coercedUntypedFamilies.WithLabelValues("counter").Inc()
+	}
+}
+
+// mergeHistogram builds the name histogram from its untyped parts. It returns
+// false if they don't describe the same series, or a bucket has no valid le
+// label, leaving the parts untouched.
+func mergeHistogram(name string, buckets, sum, count *dto.MetricFamily) (*dto.MetricFamily, bool) {
+	histogram := &dto.MetricFamily{
+		Name: proto.String(name),
+		Help: buckets.Help,
+		Type: dto.MetricType_HISTOGRAM.Enum(),
+	}
+	byKey := map[string]*dto.Metric{}
+	for _, metric := range buckets.Metric {
+		var le string
+		labels := make([]*dto.LabelPair, 0, len(metric.Label))
+		for _, label := range metric.Label {
+			if label.GetName() == model.BucketLabel {
+				le = label.GetValue()
+				continue
+			}
+			labels = append(labels, label)
+		}
+		bound, err := strconv.ParseFloat(le, 64)
+		if err != nil || metric.Untyped == nil {
+			return nil, false
+		}
+		key := histogramKey(labels, metric.TimestampMs)
+		merged, ok := byKey[key]
+		if !ok {
+			merged = &dto.Metric{Label: labels, TimestampMs: metric.TimestampMs, Histogram: &dto.Histogram{}}
+			byKey[key] = merged
+			histogram.Metric = append(histogram.Metric, merged)
+		}
+		cumulative := uint64(metric.Untyped.GetValue())
+		merged.Histogram.Bucket = append(merged.Histogram.Bucket, &dto.Bucket{UpperBound: proto.Float64(bound), CumulativeCount: &cumulative})
+	}
+	if len(sum.Metric) != len(byKey) || len(count.Metric) != len(byKey) {
+		return nil, false
+	}
+	for _, metric := range sum.Metric {
+		merged, ok := byKey[histogramKey(metric.Label, metric.TimestampMs)]
+		if !ok || metric.Untyped == nil || merged.Histogram.SampleSum != nil {
+			return nil, false
+		}
+		merged.Histogram.SampleSum = metric.Untyped.Value
+	}
+	for _, metric := range count.Metric {
+		merged, ok := byKey[histogramKey(metric.Label, metric.TimestampMs)]
+		if !ok || metric.Untyped == nil || merged.Histogram.SampleCount != nil {
+			return nil, false
+		}
+		sampleCount := uint64(metric.Untyped.GetValue())
+		merged.Histogram.SampleCount = &sampleCount
+	}
+	for _, metric := range histogram.Metric {
+		sort.Slice(metric.Histogram.Bucket, func(i, j int) bool {
+			return metric.Histogram.Bucket[i].GetUpperBound() < metric.Histogram.Bucket[j].GetUpperBound()
+		})
+	}
+	return histogram, true
+}
+
+// histogramKey identifies a histogram datapoint by its labels, in any order,
+// and timestamp
+func histogramKey(labels []*dto.LabelPair, timestampMs *int64) string {
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		pairs = append(pairs, label.GetName()+"\x00"+label.GetValue())
+	}
+	sort.Strings(pairs)
+	key := strings.Join(pairs, "\x00")
+	if timestampMs != nil {
+		key += fmt.Sprintf("\x00@%d", *timestampMs)
+	}
+	return key
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUntypedConversion(t *testing.T) {
+	hub := NewMetricHub(0, 100, WithUntypedConversion(regexp.MustCompile("^(?:queue_count)$"), regexp.MustCompile("^(?:restarts)$")))
+
+	rec, err := receiveString(hub, `requests_total{code="200"} 3 1000
+restarts 2 1000
+queue_count 5 1000
+temperature 21 1000
+latency_seconds_bucket{path="/",le="0.5"} 2 1000
+latency_seconds_bucket{path="/",le="+Inf"} 3 1000
+latency_seconds_bucket{path="/",le="0.1"} 1 1000
+latency_seconds_sum{path="/"} 1.2 1000
+latency_seconds_count{path="/"} 3 1000
+size_bucket{le="1"} 1 1000
+size_count 1 1000
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, rec.Code)
+	assert.ElementsMatch(t, []string{
+		`# TYPE latency_seconds histogram`,
+		`latency_seconds_bucket{path="/",le="0.1"} 1 1000`,
+		`latency_seconds_bucket{path="/",le="0.5"} 2 1000`,
+		`latency_seconds_bucket{path="/",le="+Inf"} 3 1000`,
+		`latency_seconds_sum{path="/"} 1.2 1000`,
+		`latency_seconds_count{path="/"} 3 1000`,
+		`# TYPE queue_count gauge`,
+		`queue_count 5 1000`,
+		`# TYPE requests_total counter`,
+		`requests_total{code="200"} 3 1000`,
+		`# TYPE restarts counter`,
+		`restarts 2 1000`,
+		`# TYPE size_bucket untyped`,
+		`size_bucket{le="1"} 1 1000`,
+		`# TYPE size_count untyped`,
+		`size_count 1 1000`,
+		`# TYPE temperature untyped`,
+		`temperature 21 1000`,
+	}, scrapedLines(scrape(t, hub)))
+	assert.Contains(t, hub.Capabilities().Features, FeatureUntypedConversion)
+}
+
+func TestUntypedConversionMismatchedHistogram(t *testing.T) {
+	untyped := func(name string, value float64, labels ...string) *dto.MetricFamily {
+		metric := &dto.Metric{Untyped: &dto.Untyped{Value: proto.Float64(value)}}
+		for i := 0; i < len(labels); i += 2 {
+			metric.Label = append(metric.Label, &dto.LabelPair{Name: proto.String(labels[i]), Value: proto.String(labels[i+1])})
+		}
+		return &dto.MetricFamily{Name: proto.String(name), Type: dto.MetricType_UNTYPED.Enum(), Metric: []*dto.Metric{metric}}
+	}
+	converter := &untypedConverter{}
+
+	families := converter.convert([]*dto.MetricFamily{
+		untyped("rtt_bucket", 1, "le", "1", "path", "/a"),
+		untyped("rtt_sum", 1, "path", "/b"),
+		untyped("rtt_count", 1, "path", "/a"),
+	})
+	assert.Len(t, families, 3)
+	for _, family := range families {
+		assert.Equal(t, dto.MetricType_UNTYPED, family.GetType())
+	}
+
+	families = converter.convert([]*dto.MetricFamily{
+		untyped("rtt_bucket", 1, "le", "fast"),
+		untyped("rtt_sum", 1),
+		untyped("rtt_count", 1),
+	})
+	assert.Len(t, families, 3)
+
+	families = converter.convert([]*dto.MetricFamily{
+		untyped("rtt_bucket", 1, "le", "1"),
+		untyped("rtt_sum", 1),
+		untyped("rtt_count", 1),
+	})
+	if assert.Len(t, families, 1) {
+		assert.Equal(t, dto.MetricType_HISTOGRAM, families[0].GetType())
+		assert.Equal(t, uint64(1), families[0].Metric[0].Histogram.GetSampleCount())
+	}
+}
@@ -0,0 +1,432 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	walSegmentSuffix    = ".segment"
+	walCheckpointSuffix = ".checkpoint"
+	// walHeaderSize is the size of the length and CRC32 before every record
+	walHeaderSize = 8
+	// walMaxRecordSize bounds the allocation for a record read back, so a
+	// corrupt length can't exhaust memory
+	walMaxRecordSize = 1024 * 1024 * 1024
+	// walImportedFlag is set in the length of records of imported datapoints.
+	// Records are never larger than walMaxRecordSize, so the bit is free.
+	walImportedFlag = 1 << 31
+)
+
+var (
+	walAppendedBytes     = prometheus.NewCounter(prometheus.CounterOpts{Name: "wal_appended_bytes_total", Help: "Number of bytes appended to the write-ahead log"})
+	walWriteErrors       = prometheus.NewCounter(prometheus.CounterOpts{Name: "wal_write_errors_total", Help: "Number of failed writes to the write-ahead log"})
+	walCorruptRecords    = prometheus.NewCounter(prometheus.CounterOpts{Name: "wal_corrupt_records_total", Help: "Number of write-ahead log files whose replay stopped at a torn or corrupt record"})
+	walReplayedPoints    = prometheus.NewGauge(prometheus.GaugeOpts{Name: "wal_replayed_datapoints", Help: "Number of datapoints restored from the write-ahead log at startup"})
+	walCheckpointSeconds = prometheus.NewGauge(prometheus.GaugeOpts{Name: "wal_checkpoint_seconds", Help: "Time to write the last write-ahead log checkpoint"})
+	walSyncs             = prometheus.NewCounter(prometheus.CounterOpts{Name: "wal_syncs_total", Help: "Number of syncs of the write-ahead log to disk, each covering the appends of every push waiting for it"})
+
+	errCorruptRecord = errors.New("corrupt write-ahead log record")
+)
+
+func init() {
+	prometheus.MustRegister(walAppendedBytes, walWriteErrors, walCorruptRecords, walReplayedPoints, walCheckpointSeconds, walSyncs)
+}
+
+// walRecord is a family of datapoints in the write-ahead log, marked as
+// imported if they were stored by Import
+type walRecord struct {
+	family   *dto.MetricFamily
+	imported bool
+}
+
+// WAL is a write-ahead log of the datapoints stored in a hub, so they survive
+// a restart of the hub. Every family stored is appended to the current
+// segment, which is synced to disk before the push is acknowledged. Each
+// drain of the hub starts a new segment and writes the datapoints it left in
+// the hub to a checkpoint, after which older segments are deleted.
+type WAL struct {
+	dir string
+
+	sync.Mutex
+	segment *os.File
+	index   int
+	// appended counts the records appended
+	appended int64
+
+	// syncLock serializes syncs, so pushes waiting for one are covered by the
+	// next one together. synced counts the records synced to disk.
+	syncLock sync.Mutex
+	synced   int64
+
+	checkpointLock sync.Mutex
+	lastCheckpoint int
+}
+
+// OpenWAL opens the write-ahead log in dir, creating dir if needed. New
+// records go to a new segment, so the existing ones can be replayed with
+// ReplayWAL.
+func OpenWAL(dir string) (*WAL, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	segments, checkpoints, err := listWAL(dir)
+	if err != nil {
+		return nil, err
+	}
+	wal := &WAL{dir: dir}
+	for _, index := range append(segments, checkpoints...) {
+		if index > wal.index {
+			wal.index = index
+		}
+	}
+	if len(checkpoints) > 0 {
+		wal.lastCheckpoint = checkpoints[len(checkpoints)-1]
+	}
+	if _, err := wal.rotate(); err != nil {
+		return nil, err
+	}
+	return wal, nil
+}
+
+// WithWAL makes the hub append every family it stores to wal, and sync it to
+// disk before acknowledging the push. Pushes accepted into the ingest queue are
+// acknowledged once a writer has stored and synced them.
+func WithWAL(wal *WAL) Option {
+	return func(hub *MetricHub) {
+		hub.wal = wal
+	}
+}
+
+// ReplayWAL stores the datapoints of the last checkpoint and the segments
+// written after it into the hub, and returns the number of datapoints
+// restored. Requests wait for it, and the hub reports not ready until it
+// returns.
+func (c *MetricHub) ReplayWAL() (int, error) {
+	if c.wal == nil {
+		return 0, nil
+	}
+	defer atomic.StoreInt32(&c.replaying, 0)
+	c.Lock()
+	defer c.Unlock()
+
+	// the replayed datapoints are already in the log
+	wal := c.wal
+	c.wal = nil
+	defer func() { c.wal = wal }()
+
+	datapoints := 0
+	err := wal.replay(func(record walRecord) {
+		datapoints += len(record.family.Metric)
+		if record.imported {
+			c.stats.currentCountImportedDatapoints += len(record.family.Metric)
+		}
+		c.storeDatapoints(record.family, record.imported)
+	})
+	hubSize.Set(float64(c.stats.currentCountDatapoints))
+	walReplayedPoints.Set(float64(datapoints))
+	return datapoints, err
+}
+
+// rotateWAL starts a new WAL segment when the hub is drained, and returns the
+// index of the closed segment and the datapoints left in the hub. Once those
+// are checkpointed, the closed segment and those before it are obsolete. Must
+// be called with the hub lock held.
+func (c *MetricHub) rotateWAL() (int, []walRecord) {
+	closed, err := c.wal.rotate()
+	if err != nil {
+		logging.Error("Error starting write-ahead log segment", "err", err)
+	}
+	remaining := make([]walRecord, 0, len(c.metricFamiliesByName))
+	for _, family := range c.metricFamiliesByName {
+		live, imported := family.popByOrigin()
+		for _, record := range []walRecord{{family: live}, {family: imported, imported: true}} {
+			if len(record.family.Metric) > 0 {
+				remaining = append(remaining, record)
+			}
+		}
+	}
+	return closed, remaining
+}
+
+// append writes family to the current segment, marked as imported if imported
+// is set. Errors are logged rather than failing the push, so a full disk
+// doesn't stop the hub.
+func (w *WAL) append(family *dto.MetricFamily, imported bool) {
+	record, err := encodeRecord(walRecord{family: family, imported: imported})
+	if err != nil {
+		walWriteErrors.Inc()
+		logging.Error("Error encoding family for the write-ahead log", "family", family.GetName(), "err", err)
+		return
+	}
+
+	w.Lock()
+	defer w.Unlock()
+	if w.segment == nil {
+		walWriteErrors.Inc()
+		return
+	}
+	if _, err := w.segment.Write(record); err != nil {
+		walWriteErrors.Inc()
+		logging.Error("Error appending to write-ahead log segment", "segment", w.segment.Name(), "err", err)
+		return
+	}
+	w.appended++
+	walAppendedBytes.Add(float64(len(record)))
+}
+
+// sync syncs the records appended so far to disk. Concurrent callers wait for
+// each other, and a caller whose records were synced while it waited returns
+// without syncing again, so pushes arriving together share one sync. Errors
+// are logged rather than failing the push, like those of append.
+func (w *WAL) sync() {
+	w.syncLock.Lock()
+	defer w.syncLock.Unlock()
+
+	w.Lock()
+	target, segment := w.appended, w.segment
+	w.Unlock()
+	if target <= w.synced || segment == nil {
+		return
+	}
+	// appends go on while the segment syncs, and are covered by the next sync
+	if err := segment.Sync(); err != nil {
+		walWriteErrors.Inc()
+		logging.Error("Error syncing write-ahead log segment", "segment", segment.Name(), "err", err)
+		return
+	}
+	walSyncs.Inc()
+	w.synced = target
+}
+
+// rotate closes the current segment and opens the next one, returning the
+// index of the closed segment
+func (w *WAL) rotate() (int, error) {
+	w.syncLock.Lock()
+	defer w.syncLock.Unlock()
+	w.Lock()
+	defer w.Unlock()
+
+	closed := w.index
+	if w.segment != nil {
+		// pushes waiting for a sync of the closed segment are covered by this one
+		if err := w.segment.Sync(); err != nil {
+			walWriteErrors.Inc()
+			logging.Error("Error syncing write-ahead log segment", "segment", w.segment.Name(), "err", err)
+		}
+		w.synced = w.appended
+		if err := w.segment.Close(); err != nil {
+			logging.Error("Error closing write-ahead log segment", "segment", w.segment.Name(), "err", err)
+		}
+	}
+	segment, err := os.OpenFile(w.path(closed+1, walSegmentSuffix), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		// appends fail until a later rotation opens a segment
+		w.segment = nil
+		walWriteErrors.Inc()
+		return closed, err
+	}
+	w.segment = segment
+	w.index = closed + 1
+	return closed, nil
+}
+
+// checkpoint writes records, the contents of the hub right after segment
+// upTo was closed, and deletes segment upTo and everything before it
+func (w *WAL) checkpoint(upTo int, records []walRecord) error {
+	w.checkpointLock.Lock()
+	defer w.checkpointLock.Unlock()
+	if upTo <= w.lastCheckpoint {
+		// a later drain already checkpointed
+		return nil
+	}
+	t0 := time.Now()
+
+	path := w.path(upTo, walCheckpointSuffix)
+	if err := writeRecords(path+".tmp", records); err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	w.lastCheckpoint = upTo
+
+	segments, checkpoints, err := listWAL(w.dir)
+	if err != nil {
+		return err
+	}
+	for _, index := range segments {
+		if index <= upTo {
+			os.Remove(w.path(index, walSegmentSuffix))
+		}
+	}
+	for _, index := range checkpoints {
+		if index < upTo {
+			os.Remove(w.path(index, walCheckpointSuffix))
+		}
+	}
+	walCheckpointSeconds.Set(time.Since(t0).Seconds())
+	return nil
+}
+
+// writeRecords writes records to a new file at path and syncs it to disk
+func writeRecords(path string, records []walRecord) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, record := range records {
+		encoded, err := encodeRecord(record)
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(encoded); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// replay calls store with every record of the last checkpoint and the
+// segments after it, in the order they were written. A torn record, e.g. from
+// a crash during a write, ends the replay of its file.
+func (w *WAL) replay(store func(walRecord)) error {
+	segments, checkpoints, err := listWAL(w.dir)
+	if err != nil {
+		return err
+	}
+	var paths []string
+	checkpoint := 0
+	if len(checkpoints) > 0 {
+		checkpoint = checkpoints[len(checkpoints)-1]
+		paths = append(paths, w.path(checkpoint, walCheckpointSuffix))
+	}
+	for _, index := range segments {
+		if index > checkpoint && index < w.index {
+			paths = append(paths, w.path(index, walSegmentSuffix))
+		}
+	}
+
+	for _, path := range paths {
+		if err := replayFile(path, store); err != nil {
+			walCorruptRecords.Inc()
+			logging.Warn("Stopped replaying write-ahead log file", "path", path, "err", err)
+		}
+	}
+	return nil
+}
+
+func replayFile(path string, store func(walRecord)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header := make([]byte, walHeaderSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errCorruptRecord
+		}
+		size := binary.BigEndian.Uint32(header[:4])
+		imported := size&walImportedFlag != 0
+		size &^= walImportedFlag
+		if size > walMaxRecordSize {
+			return errCorruptRecord
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return errCorruptRecord
+		}
+		if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) {
+			return errCorruptRecord
+		}
+		family := &dto.MetricFamily{}
+		if err := proto.Unmarshal(data, family); err != nil {
+			return errCorruptRecord
+		}
+		store(walRecord{family: family, imported: imported})
+	}
+}
+
+// encodeRecord returns the family of record prefixed by its length, with
+// walImportedFlag set if it is imported, and CRC32
+func encodeRecord(record walRecord) ([]byte, error) {
+	data, err := proto.Marshal(record.family)
+	if err != nil {
+		return nil, err
+	}
+	size := uint32(len(data))
+	if record.imported {
+		size |= walImportedFlag
+	}
+	encoded := make([]byte, walHeaderSize, walHeaderSize+len(data))
+	binary.BigEndian.PutUint32(encoded[:4], size)
+	binary.BigEndian.PutUint32(encoded[4:], crc32.ChecksumIEEE(data))
+	return append(encoded, data...), nil
+}
+
+func (w *WAL) path(index int, suffix string) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%08d%s", index, suffix))
+}
+
+// listWAL returns the sorted indexes of the segments and checkpoints in dir
+func listWAL(dir string) ([]int, []int, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var segments, checkpoints []int
+	for _, file := range files {
+		name := file.Name()
+		for suffix, indexes := range map[string]*[]int{walSegmentSuffix: &segments, walCheckpointSuffix: &checkpoints} {
+			if !strings.HasSuffix(name, suffix) {
+				continue
+			}
+			if index, err := strconv.Atoi(strings.TrimSuffix(name, suffix)); err == nil {
+				*indexes = append(*indexes, index)
+			}
+		}
+	}
+	sort.Ints(segments)
+	sort.Ints(checkpoints)
+	return segments, checkpoints, nil
+}
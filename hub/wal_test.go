@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package hub
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// restartWithWAL opens the WAL in dir again and replays it into a new hub,
+// like a hub restarting
+func restartWithWAL(t *testing.T, dir string) (*MetricHub, int) {
+	wal, err := OpenWAL(dir)
+	assert.NoError(t, err)
+	hub := NewMetricHub(0, 10, WithWAL(wal))
+	replayed, err := hub.ReplayWAL()
+	assert.NoError(t, err)
+	return hub, replayed
+}
+
+func walFiles(t *testing.T, dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	return names
+}
+
+func TestWALReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hub, replayed := restartWithWAL(t, dir)
+	assert.Equal(t, 0, replayed)
+	_, err = receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	expected := scrapedLines(hub.exposeMetrics(hub.metricFamiliesByName, 1))
+
+	restarted, replayed := restartWithWAL(t, dir)
+	assert.Equal(t, 14, replayed)
+	assert.Equal(t, 14, restarted.Status().Datapoints)
+	assert.Equal(t, 5, restarted.stats.currentCountSeries)
+	assert.ElementsMatch(t, expected, scrapedLines(scrape(t, restarted)))
+
+	// scraped datapoints are not replayed again
+	restarted, replayed = restartWithWAL(t, dir)
+	assert.Equal(t, 0, replayed)
+	assert.Equal(t, 0, restarted.Status().Datapoints)
+}
+
+func TestWALCheckpointsPartialDrains(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hub, _ := restartWithWAL(t, dir)
+	nowMs := time.Now().UnixNano() / int64(time.Millisecond)
+	old, fresh := nowMs-int64(time.Minute/time.Millisecond), nowMs
+	_, err = receiveString(hub, fmt.Sprintf("a 1 %d\na 2 %d\nb 1 %d\nc 1 %d\n", old, fresh, old, fresh))
+	assert.NoError(t, err)
+	scrapeURL(t, hub, "/metrics?min_age=30s")
+	_, err = receiveString(hub, fmt.Sprintf("d 1 %d\n", fresh))
+	assert.NoError(t, err)
+
+	// the fresh datapoints are in the checkpoint, the later push in a segment
+	assert.Equal(t, []string{"00000001.checkpoint", "00000002.segment"}, walFiles(t, dir))
+	restarted, replayed := restartWithWAL(t, dir)
+	assert.Equal(t, 3, replayed)
+	assert.ElementsMatch(t, []string{
+		"# TYPE a untyped", fmt.Sprintf("a 2 %d", fresh),
+		"# TYPE c untyped", fmt.Sprintf("c 1 %d", fresh),
+		"# TYPE d untyped", fmt.Sprintf("d 1 %d", fresh),
+	}, scrapedLines(scrape(t, restarted)))
+}
+
+func TestWALReplayImported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hub, _ := restartWithWAL(t, dir)
+	nowMs := time.Now().UnixNano() / int64(time.Millisecond)
+	old, fresh := nowMs-int64(time.Minute/time.Millisecond), nowMs
+	rec := importBody(hub, strings.NewReader(fmt.Sprintf("a 1 %d\nb 1 %d\n", old, fresh)), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	_, err = receiveString(hub, fmt.Sprintf("a 2 %d\nc 1 %d\n", fresh, old))
+	assert.NoError(t, err)
+
+	// imported datapoints replayed from a segment still count against the
+	// import limit instead of the hub limit
+	restarted, replayed := restartWithWAL(t, dir)
+	assert.Equal(t, 4, replayed)
+	assert.Equal(t, 2, restarted.stats.currentCountImportedDatapoints)
+	assert.Equal(t, 2, restarted.liveDatapoints())
+
+	// and so do those replayed from a checkpoint
+	scrapeURL(t, restarted, "/metrics?min_age=30s")
+	restarted, replayed = restartWithWAL(t, dir)
+	assert.Equal(t, 2, replayed)
+	assert.Equal(t, 1, restarted.stats.currentCountImportedDatapoints)
+	assert.Equal(t, 1, restarted.liveDatapoints())
+	for _, queue := range restarted.metricFamiliesByName["b"].metrics {
+		assert.True(t, queue.samples[0].imported)
+	}
+}
+
+func TestWALReplayStopsAtTornRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hub, _ := restartWithWAL(t, dir)
+	_, err = receiveString(hub, "a 1 1000\n")
+	assert.NoError(t, err)
+	segment, err := os.OpenFile(filepath.Join(dir, "00000001.segment"), os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err)
+	// a record cut short by a crash
+	_, err = segment.Write([]byte{0, 0, 1, 0, 1, 2})
+	assert.NoError(t, err)
+	assert.NoError(t, segment.Close())
+
+	corrupt := testutil.ToFloat64(walCorruptRecords)
+	_, replayed := restartWithWAL(t, dir)
+	assert.Equal(t, 1, replayed)
+	assert.Equal(t, corrupt+1, testutil.ToFloat64(walCorruptRecords))
+}
+
+func TestWALIgnoresStaleCheckpoints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	wal, err := OpenWAL(dir)
+	assert.NoError(t, err)
+	assert.NoError(t, wal.checkpoint(3, nil))
+	assert.NoError(t, wal.checkpoint(2, nil))
+	assert.Equal(t, 3, wal.lastCheckpoint)
+	_, err = os.Stat(filepath.Join(dir, "00000002.checkpoint"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWALSyncsBeforeAcknowledging(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	wal, err := OpenWAL(dir)
+	assert.NoError(t, err)
+	hub := NewMetricHub(0, 10, WithWAL(wal))
+	syncs := testutil.ToFloat64(walSyncs)
+	_, err = receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	assert.Equal(t, syncs+1, testutil.ToFloat64(walSyncs))
+	assert.Equal(t, wal.appended, wal.synced)
+
+	// nothing new to sync
+	wal.sync()
+	assert.Equal(t, syncs+1, testutil.ToFloat64(walSyncs))
+}
+
+func TestWALSyncsIngestQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	wal, err := OpenWAL(dir)
+	assert.NoError(t, err)
+	hub := NewMetricHub(0, 10, WithWAL(wal), WithIngestQueue(8, 2))
+	defer hub.Close()
+	_, err = receiveString(hub, sampleReceiveString)
+	assert.NoError(t, err)
+	// the push is acknowledged once stored and synced
+	assert.Equal(t, 14, hub.Status().Datapoints)
+	wal.Lock()
+	appended := wal.appended
+	wal.Unlock()
+	wal.syncLock.Lock()
+	assert.Equal(t, appended, wal.synced)
+	wal.syncLock.Unlock()
+
+	_, replayed := restartWithWAL(t, dir)
+	assert.Equal(t, 14, replayed)
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+// Package logging is the leveled, structured logger of the hub. Entries are a
+// message and key value pairs, written as JSON objects or as console lines.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry
+type Level int8
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	// LevelFatal entries are always written, before the process exits
+	LevelFatal
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	case LevelFatal:
+		return "fatal"
+	}
+	return fmt.Sprintf("level(%d)", int8(l))
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(s string) (Level, error) {
+	for l := LevelDebug; l <= LevelError; l++ {
+		if s == l.String() {
+			return l, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, must be debug, info, warn or error", s)
+}
+
+// Format is how log entries are written
+type Format string
+
+const (
+	// FormatConsole writes a line with the time, level, message and
+	// key=value pairs
+	FormatConsole Format = "console"
+	// FormatJSON writes a JSON object per line with ts, level and msg keys
+	// along with the key value pairs
+	FormatJSON Format = "json"
+)
+
+// ParseFormat parses console or json
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatConsole, FormatJSON:
+		return f, nil
+	}
+	return FormatConsole, fmt.Errorf("unknown log format %q, must be console or json", s)
+}
+
+var (
+	mu     sync.Mutex
+	out    io.Writer = os.Stderr
+	level            = LevelInfo
+	format           = FormatConsole
+	now              = time.Now
+	exit             = os.Exit
+)
+
+// Configure sets the lowest level written and the format of entries
+func Configure(l Level, f Format) {
+	mu.Lock()
+	defer mu.Unlock()
+	level, format = l, f
+}
+
+// SetOutput sets where entries are written, stderr by default
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	out = w
+}
+
+// Enabled returns whether entries of l are written, so callers can skip
+// building expensive fields
+func Enabled(l Level) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return l >= level
+}
+
+// Debug logs msg with the key value pairs keyvals at debug level
+func Debug(msg string, keyvals ...interface{}) {
+	write(LevelDebug, msg, keyvals)
+}
+
+// Info logs msg with the key value pairs keyvals at info level
+func Info(msg string, keyvals ...interface{}) {
+	write(LevelInfo, msg, keyvals)
+}
+
+// Warn logs msg with the key value pairs keyvals at warn level
+func Warn(msg string, keyvals ...interface{}) {
+	write(LevelWarn, msg, keyvals)
+}
+
+// Error logs msg with the key value pairs keyvals at error level
+func Error(msg string, keyvals ...interface{}) {
+	write(LevelError, msg, keyvals)
+}
+
+// Fatal logs msg with the key value pairs keyvals and exits with status 1
+func Fatal(msg string, keyvals ...interface{}) {
+	write(LevelFatal, msg, keyvals)
+	exit(1)
+}
+
+// Log logs msg with the key value pairs keyvals at l
+func Log(l Level, msg string, keyvals ...interface{}) {
+	write(l, msg, keyvals)
+}
+
+// Writer returns a writer logging each line written to it at l, to route the
+// output of the standard log package and of libraries through the logger
+func Writer(l Level) io.Writer {
+	return lineWriter(l)
+}
+
+type lineWriter Level
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		write(Level(w), line, nil)
+	}
+	return len(p), nil
+}
+
+func write(l Level, msg string, keyvals []interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	if l < level {
+		return
+	}
+	if len(keyvals)%2 != 0 {
+		keyvals = append(keyvals, "MISSING")
+	}
+	var buf bytes.Buffer
+	ts := now().UTC().Format("2006-01-02T15:04:05.000Z07:00")
+	if format == FormatJSON {
+		buf.WriteString(`{"ts":`)
+		writeJSON(&buf, ts)
+		buf.WriteString(`,"level":`)
+		writeJSON(&buf, l.String())
+		buf.WriteString(`,"msg":`)
+		writeJSON(&buf, msg)
+		for i := 0; i < len(keyvals); i += 2 {
+			buf.WriteByte(',')
+			writeJSON(&buf, fmt.Sprint(keyvals[i]))
+			buf.WriteByte(':')
+			writeJSON(&buf, value(keyvals[i+1]))
+		}
+		buf.WriteString("}\n")
+	} else {
+		fmt.Fprintf(&buf, "%s %-5s %s", ts, strings.ToUpper(l.String()), msg)
+		for i := 0; i < len(keyvals); i += 2 {
+			fmt.Fprintf(&buf, " %s=%s", keyvals[i], consoleValue(value(keyvals[i+1])))
+		}
+		buf.WriteByte('\n')
+	}
+	out.Write(buf.Bytes())
+}
+
+// value converts errors, durations and other stringers to strings, leaving
+// other values to be written as they are
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(data)
+}
+
+// consoleValue quotes strings that would be ambiguous unquoted
+func consoleValue(v interface{}) string {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func capture(t *testing.T, l Level, f Format) *bytes.Buffer {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	Configure(l, f)
+	now = func() time.Time { return time.Date(2020, 6, 1, 12, 0, 0, 5e6, time.UTC) }
+	t.Cleanup(func() {
+		SetOutput(os.Stderr)
+		Configure(LevelInfo, FormatConsole)
+		now = time.Now
+	})
+	return &buf
+}
+
+func TestJSON(t *testing.T) {
+	buf := capture(t, LevelInfo, FormatJSON)
+
+	Debug("not written")
+	Info("Replayed datapoints", "datapoints", 12, "path", "/var/wal")
+	Error("Error forwarding", "err", errors.New(`upstream said "no"`), "backoff", 2*time.Second, "odd")
+
+	assert.Equal(t, `{"ts":"2020-06-01T12:00:00.005Z","level":"info","msg":"Replayed datapoints","datapoints":12,"path":"/var/wal"}
+{"ts":"2020-06-01T12:00:00.005Z","level":"error","msg":"Error forwarding","err":"upstream said \"no\"","backoff":"2s","odd":"MISSING"}
+`, buf.String())
+}
+
+func TestConsole(t *testing.T) {
+	buf := capture(t, LevelDebug, FormatConsole)
+
+	Debug("Received gRPC push", "datapoints", 3, "handler", "")
+	Warn("Closed connection", "direction", "to client")
+
+	assert.Equal(t, `2020-06-01T12:00:00.005Z DEBUG Received gRPC push datapoints=3 handler=""
+2020-06-01T12:00:00.005Z WARN  Closed connection direction="to client"
+`, buf.String())
+	assert.True(t, Enabled(LevelDebug))
+}
+
+func TestWriter(t *testing.T) {
+	buf := capture(t, LevelInfo, FormatJSON)
+	logger := log.New(Writer(LevelWarn), "", 0)
+
+	logger.Print("first\nsecond")
+
+	assert.Equal(t, `{"ts":"2020-06-01T12:00:00.005Z","level":"warn","msg":"first"}
+{"ts":"2020-06-01T12:00:00.005Z","level":"warn","msg":"second"}
+`, buf.String())
+}
+
+func TestFatal(t *testing.T) {
+	buf := capture(t, LevelError, FormatJSON)
+	code := 0
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+
+	Fatal("invalid -log-level")
+
+	assert.Equal(t, 1, code)
+	assert.Contains(t, buf.String(), `"level":"fatal"`)
+}
+
+func TestParse(t *testing.T) {
+	level, err := ParseLevel("warn")
+	assert.NoError(t, err)
+	assert.Equal(t, LevelWarn, level)
+	_, err = ParseLevel("fatal")
+	assert.Error(t, err)
+
+	format, err := ParseFormat("json")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatJSON, format)
+	_, err = ParseFormat("logfmt")
+	assert.Error(t, err)
+}
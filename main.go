@@ -8,16 +8,23 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"google.golang.org/grpc"
 	"log"
-	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
-	hubgrpc "github.com/facebookincubator/prometheus-edge-hub/grpc"
 	"github.com/facebookincubator/prometheus-edge-hub/hub"
+	"github.com/facebookincubator/prometheus-edge-hub/logging"
 	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
@@ -26,57 +33,662 @@ const (
 	defaultLimit               = -1
 	defaultScrapeTimeout       = 10                 // seconds
 	defaultMaxGRPCMsgSizeBytes = 1024 * 1024 * 1024 //1 GB
+	defaultSanitizeReplacement = "_"
+	defaultImportLimit         = -1
+	defaultImportMaxBytes      = 1024 * 1024 * 1024 //1 GB
+	defaultQueueAgeTopN        = 10
+	defaultFamilySizeTopN      = 10
+	defaultCanaryInterval      = 30 * time.Second
+	defaultUpstreamTimeout     = 10 * time.Second
+	defaultUpstreamRetry       = 15 * time.Second
+	staleSourceCheckInterval   = time.Minute
+	expiryCheckInterval        = 15 * time.Second
+	defaultRejectedSampleTTL   = 10 * time.Minute
+	defaultDebugMaxConcurrent  = 2
+	defaultDebugMaxUtilization = 90
+	defaultHistoryResolution   = time.Minute
+	defaultHistoryMaxSeries    = 100000
+	defaultBatchIDTTL          = 10 * time.Minute
+	defaultRemoteWriteInterval = 15 * time.Second
+	defaultRemoteWriteTimeout  = 30 * time.Second
+	defaultAggregatorTimeout   = 30 * time.Second
+	defaultAggregatorLabel     = "hub"
+	defaultLogLevel            = "info"
+	defaultAccessLogMaxBytes   = 100 << 20
+	defaultAccessLogMaxFiles   = 5
+	defaultThrottleMaxDelay    = 10 * time.Second
+	shutdownTimeout            = 30 * time.Second // for in-flight requests
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "aggregator" {
+		runAggregator(os.Args[2:])
+		return
+	}
+
 	port := flag.Int("port", defaultPort, fmt.Sprintf("Port to listen for requests. Default is %d", defaultPort))
 	totalMetricsLimit := flag.Int("limit", defaultLimit, fmt.Sprintf("Limit the total metrics in the hub at one time. Will reject a push if hub is full. Default is %d which is no limit.", defaultLimit))
 	scrapeTimeout := flag.Int("scrapeTimeout", defaultScrapeTimeout, fmt.Sprintf("Timeout for scrape calls. Default is %d", defaultScrapeTimeout))
 	grpcPort := flag.Int("grpc-port", defaultGRPCPort, fmt.Sprintf("Port to listen for GRPC requests"))
 	grpcMaxGRPCMsgSizeBytes := flag.Int("grpc-max-msg-size", defaultMaxGRPCMsgSizeBytes, fmt.Sprintf("Max message size (bytes) for GRPC receives"))
+	sanitizeNames := flag.Bool("sanitize-names", false, "Rewrite invalid characters in pushed metric and label names instead of storing them as-is. Original names are kept in original_<name> labels. Text format pushes with such names are rejected by the parser before they can be sanitized")
+	sanitizeReplacement := flag.String("sanitize-replacement", defaultSanitizeReplacement, fmt.Sprintf("Replacement for invalid characters when -sanitize-names is set, empty or a valid label name. Default is %q", defaultSanitizeReplacement))
+	warmUp := flag.Duration("warm-up", 0, "Period after startup during which scrapes are refused with 503 while pushes are still accepted. Default is 0 (no warm-up)")
+	metricTTL := flag.Duration("metric-ttl", 0, "Drop buffered datapoints with timestamps older than this, so they don't pile up while nothing scrapes the hub. Default is 0 (never)")
+	staleSeriesThreshold := flag.Duration("stale-series-threshold", 0, "Leave series whose newest datapoint is older than this out of scrapes, so the backlog of devices coming back from long outages isn't ingested. Default is 0 (never)")
+	staleSeriesPolicy := flag.String("stale-series-policy", string(hub.StaleSeriesDrop), "What to do with series left out of scrapes by -stale-series-threshold: drop, or divert to be scraped from /metrics/stale. Default is drop")
+	maxSeriesDatapoints := flag.Int("max-datapoints-per-series", 0, "Max datapoints kept per series between scrapes. The oldest datapoints of a series are evicted beyond it. Default is 0 which is no limit")
+	limitPolicy := flag.String("limit-policy", string(hub.LimitPolicyReject), "What to do with a push that would exceed -limit: reject (reject the whole push), partial (store it up to the limit and drop the rest) or drop-oldest (evict the oldest buffered datapoints to make room). Default is reject")
+	importLimit := flag.Int("import-limit", defaultImportLimit, fmt.Sprintf("Limit the total imported metrics in the hub at one time. Imported metrics do not count against -limit. Default is %d which is no limit.", defaultImportLimit))
+	importMaxBytes := flag.Int64("import-max-bytes", defaultImportMaxBytes, fmt.Sprintf("Max uncompressed size (bytes) of a single import. Default is %d", defaultImportMaxBytes))
+	defaultTimestamp := flag.String("default-timestamp", string(hub.TimestampPassthrough), "What to do with pushed datapoints without a timestamp: passthrough (store them without one, so they get the scrape time), receive (stamp them with the receive time) or reject (reject the whole push). Default is passthrough")
+	clockRegressionPolicy := flag.String("clock-regression-policy", "ignore", "What to do with pushed datapoints older than the last scraped datapoint of their series: ignore, adjust (move to just after it) or reject. Default is ignore")
+	queueAgeTopN := flag.Int("queue-age-top-n", defaultQueueAgeTopN, fmt.Sprintf("Number of families with the oldest buffered datapoints to expose ages for on /internal. Default is %d", defaultQueueAgeTopN))
+	familySizeTopN := flag.Int("family-size-top-n", defaultFamilySizeTopN, fmt.Sprintf("Number of families with the most buffered datapoints to expose datapoint and series counts for on /internal. Default is %d", defaultFamilySizeTopN))
+	grpcMaxPushDatapoints := flag.Int("grpc-max-push-datapoints", 0, "Max datapoints in a single GRPC push, independent of -grpc-max-msg-size. Default is 0 which is no limit")
+	grpcPushDeadline := flag.Duration("grpc-push-deadline", 0, "Longest the hub may take to store a GRPC push, on top of the deadline set by the client. Pushes not stored in time fail with DEADLINE_EXCEEDED and none of their datapoints are stored. Default is 0 which is only the client deadline")
+	grpcMaxPushBytes := flag.Int("grpc-max-push-bytes", 0, "Max size (bytes) of a single GRPC push, independent of -grpc-max-msg-size. Default is 0 which is no limit")
+	grpcPushRate := flag.Float64("grpc-push-rate", 0, "Max datapoints per second pushed over GRPC, independent of -http-push-rate. Default is 0 which is no limit")
+	grpcPushBurst := flag.Int("grpc-push-burst", 0, "Max datapoints pushed over GRPC at once when under -grpc-push-rate. Default is 0 which is one second of -grpc-push-rate")
+	httpMaxPushDatapoints := flag.Int("http-max-push-datapoints", 0, "Max datapoints in a single HTTP push or batch part. Default is 0 which is no limit")
+	httpMaxPushBytes := flag.Int("http-max-push-bytes", 0, "Max uncompressed size (bytes) of a single HTTP push or batch part. Default is 0 which is no limit")
+	httpPushRate := flag.Float64("http-push-rate", 0, "Max datapoints per second pushed over HTTP, independent of -grpc-push-rate. Default is 0 which is no limit")
+	httpPushBurst := flag.Int("http-push-burst", 0, "Max datapoints pushed over HTTP at once when under -http-push-rate. Default is 0 which is one second of -http-push-rate")
+	scrapeCacheTTL := flag.Duration("scrape-cache-ttl", 0, "Serve the last scrape again to scrapes arriving within this period of it, so both servers of an HA Prometheus pair get the same data. Default is 0 (no caching)")
+	scrapeMaxWait := flag.Duration("scrape-max-wait", hub.DefaultScrapeMaxWait, fmt.Sprintf("Longest a scrape with ?wait= may wait for datapoints to be pushed. Default is %v, 0 refuses waiting scrapes", hub.DefaultScrapeMaxWait))
+	quarantineLimit := flag.Int("quarantine-limit", hub.DefaultQuarantineLimit, fmt.Sprintf("Max datapoints of scraped families that failed to serialize kept for inspection on /api/v1/quarantine. Default is %d, 0 drops them", hub.DefaultQuarantineLimit))
+	scrapeRetention := flag.Int("scrape-retention", 0, "Number of full scrapes to keep, so a scraper passing the ID of the last scrape it ingested as ?after=, or its name as ?consumer=, gets every scrape since then again. Default is 0 (none)")
+	heartbeatSourceLabel := flag.String("heartbeat-source-label", "", "If set, every scrape includes edgehub_source_last_push_timestamp_seconds{source=...} for each distinct value of this label seen in pushes. Default is no heartbeats")
+	dropRuntimeMetrics := flag.Bool("drop-runtime-metrics", false, "Drop pushed go_* and process_* families registered by default by Prometheus client libraries")
+	autoGOMAXPROCS := flag.Bool("auto-gomaxprocs", true, "Lower GOMAXPROCS to the cgroup CPU quota of the container unless the GOMAXPROCS environment variable is set. Default is true")
+	scrapeWorkers := flag.Int("scrape-workers", 0, "Number of workers serializing families during a scrape. Default is 0 which is GOMAXPROCS")
+	ingestWorkers := flag.Int("ingest-workers", 0, "Max pushes parsed and stored concurrently. Default is 0 which is GOMAXPROCS, negative is no limit")
+	var canaries stringsFlag
+	flag.Var(&canaries, "canary", "Series to inject into the hub every -canary-interval with value 1 and the current timestamp, e.g. 'edgehub_canary{site=\"abc\"}'. Can be repeated. Default is no canaries")
+	canaryInterval := flag.Duration("canary-interval", defaultCanaryInterval, fmt.Sprintf("Interval between canary injections. Default is %v", defaultCanaryInterval))
+	slowFamilies := flag.String("slow-families", "", "Regex matching the whole name of families served by /metrics/slow instead of /metrics/fast. Default is no slow families")
+	counterIncreaseFamilies := flag.String("counter-increase-families", "", "Regex matching the whole name of counter families for which every scrape includes a <name>:increase gauge with the increase of each series over the datapoints it drains. Default is none")
+	var keyLimits stringsFlag
+	flag.Var(&keyLimits, "limit-per-key", "Max datapoints pushed with each value of a label between two scrapes, e.g. 'label=networkID,limit=50000'. Pushes that would exceed it are rejected. Can be repeated. Default is no per-key limits")
+	tenantLabel := flag.String("tenant-label", "", "Label identifying the tenant of pushed datapoints, e.g. networkID. If set, pushes with datapoints of tenants not in -tenants are rejected. Default is no tenant checks")
+	tenants := flag.String("tenants", "", "Comma separated allowlist of tenants for -tenant-label. Default is none")
+	tenantTargetLabel := flag.String("tenant-target-label", "", "Label to move the tenant of pushed datapoints to from -tenant-label once the push is admitted, e.g. tenant, or - to drop -tenant-label. Default is to keep -tenant-label as pushed")
+	labelQuotasFile := flag.String("label-quotas-file", "", "JSON file with a list of label quotas, e.g. [{\"label\": \"gatewayID\", \"value\": \"gw42\", \"datapoints\": 50000, \"tier\": \"warn\"}]. Default is no quotas")
+	normalizationFile := flag.String("normalization-file", "", "JSON file with a list of rules normalizing the name, HELP text and unit of pushed families, e.g. [{\"family\": \"latency_ms\", \"name\": \"latency_seconds\", \"from_unit\": \"milliseconds\", \"to_unit\": \"seconds\"}]. Default is no rules")
+	relabelConfigFile := flag.String("relabel-config-file", "", "YAML file with relabel_configs rewriting the labels of pushed datapoints like Prometheus relabeling, with the replace, keep, drop and labeldrop actions. Default is the relabel configs of -profile, if any")
+	metricAllowlist := flag.String("metric-allowlist", "", "Regex matching the whole name of the only pushed families to keep, after sanitizing and relabeling. Other families are dropped. Default is all families")
+	metricDenylist := flag.String("metric-denylist", "", "Regex matching the whole name of pushed families to drop, after sanitizing and relabeling, e.g. 'debug_.*'. Default is none")
+	convertUntyped := flag.Bool("convert-untyped", true, "Give pushed untyped families a type: families ending in _total become counters, and matching _bucket, _sum and _count families become a histogram. Default is true")
+	untypedGauges := flag.String("untyped-gauges", "", "Regex matching the whole name of pushed untyped families to make gauges with -convert-untyped, overriding the suffix rules. Default is none")
+	untypedCounters := flag.String("untyped-counters", "", "Regex matching the whole name of pushed untyped families to make counters with -convert-untyped, overriding the suffix rules. Default is none")
+	var seriesDenylist stringsFlag
+	flag.Var(&seriesDenylist, "series-denylist", "Selector of pushed series to drop, e.g. '{debug=\"true\"}' or 'rpc_latency_seconds{method=~\"Debug.*\"}'. Can be repeated. Default is none")
+	upstreamURL := flag.String("upstream-url", "", "Push endpoint of an upstream hub, e.g. http://central:9091/metrics. If set, pushes are forwarded to it and only buffered locally while it is unreachable. Default is no upstream")
+	upstreamTimeout := flag.Duration("upstream-timeout", defaultUpstreamTimeout, fmt.Sprintf("Timeout for sends to -upstream-url. Default is %v", defaultUpstreamTimeout))
+	upstreamRetryInterval := flag.Duration("upstream-retry-interval", defaultUpstreamRetry, fmt.Sprintf("Interval between attempts to send datapoints buffered while -upstream-url was unreachable. Default is %v", defaultUpstreamRetry))
+	staleSourceLabel := flag.String("stale-source-label", "", "Label identifying the source of pushed datapoints, e.g. gatewayID. If set with -stale-source-after, sources that stop pushing are forgotten. Default is -heartbeat-source-label")
+	staleSourceAfter := flag.Duration("stale-source-after", 0, "Forget the heartbeats, label quota usage, series churn rates and clock regression watermarks of sources that haven't pushed for this period. Default is 0 (never)")
+	staleSourcePurge := flag.Bool("stale-source-purge", false, "Also drop the series of stale sources still buffered in the hub")
+	seriesChurnLabel := flag.String("series-churn-source-label", "", "Label identifying the source of pushed datapoints for -max-source-series-churn. Default is -stale-source-label")
+	maxSourceChurn := flag.Int("max-source-series-churn", 0, "Max new series per minute created by each source. Default is 0 which is no limit")
+	maxFamilyChurn := flag.Int("max-family-series-churn", 0, "Max new series per minute created in each family. Default is 0 which is no limit")
+	seriesChurnTier := flag.String("series-churn-tier", string(hub.QuotaTierWarn), "What to do with new series over -max-source-series-churn or -max-family-series-churn: warn (only flag the source or family), throttle (drop them) or reject (reject the whole push). Default is warn")
+	rejectedPushSamples := flag.Int("rejected-push-samples", 0, "Number of recently rejected pushes to show the largest families of on /debug. Default is 0 (none)")
+	rejectedPushSampleTTL := flag.Duration("rejected-push-sample-ttl", defaultRejectedSampleTTL, fmt.Sprintf("How long rejected pushes are shown on /debug. Default is %v", defaultRejectedSampleTTL))
+	debugMaxConcurrent := flag.Int("debug-max-concurrent", defaultDebugMaxConcurrent, fmt.Sprintf("Max concurrent /debug?verbose requests. Further requests get a 503. Default is %d, 0 is no limit", defaultDebugMaxConcurrent))
+	debugMaxUtilization := flag.Float64("debug-max-utilization", defaultDebugMaxUtilization, fmt.Sprintf("Refuse /debug?verbose requests with a 503 while the hub is over this percent of -limit. Default is %d, 0 is no limit", defaultDebugMaxUtilization))
+	ingestQueueDepth := flag.Int("ingest-queue-depth", 0, "If set, accepted pushes are handed to writer goroutines through queues of this many pushes and stored in batches, so clients don't wait on the hub lock. Default is 0 (pushes are stored before responding)")
+	ingestWriters := flag.Int("ingest-writers", 1, "Number of writer goroutines for -ingest-queue-depth. Default is 1")
+	historyRetention := flag.Duration("history-retention", 0, "If set, keep a downsampled history of pushed series for this period, served by /api/v1/history. Default is 0 (no history)")
+	historyResolution := flag.Duration("history-resolution", defaultHistoryResolution, fmt.Sprintf("Interval between datapoints of a series in the history. Default is %v", defaultHistoryResolution))
+	historyMaxSeries := flag.Int("history-max-series", defaultHistoryMaxSeries, fmt.Sprintf("Max series in the history. Default is %d, 0 is no limit", defaultHistoryMaxSeries))
+	lastValueMaxSeries := flag.Int("last-value-max-series", 0, "If set, keep the newest datapoint of up to this many pushed series, served by /metrics/current whether or not they were scraped. Default is 0 (no last-value cache)")
+	remoteWriteURL := flag.String("remote-write-url", "", "Prometheus remote_write endpoint, e.g. http://cortex/api/v1/push. If set, the contents of the hub are sent to it every -remote-write-interval instead of waiting for a scrape. Default is no remote write")
+	remoteWriteInterval := flag.Duration("remote-write-interval", defaultRemoteWriteInterval, fmt.Sprintf("Interval between sends to -remote-write-url. Default is %v", defaultRemoteWriteInterval))
+	selfMonitoringInterval := flag.Duration("self-monitoring-interval", 0, "If set, push the internal metrics of the hub to -upstream-url or -remote-write-url at this interval, named edgehub_<name> and labeled with hub=<-self-monitoring-instance>. Default is 0 (no self monitoring)")
+	selfMonitoringInstance := flag.String("self-monitoring-instance", "", "Value of the hub label of internal metrics pushed by -self-monitoring-interval. Default is the hostname")
+	remoteWriteTimeout := flag.Duration("remote-write-timeout", defaultRemoteWriteTimeout, fmt.Sprintf("Timeout for requests to -remote-write-url. Default is %v", defaultRemoteWriteTimeout))
+	gogc := flag.Int("gogc", 0, "GOGC to run with unless the GOGC environment variable is set, e.g. 50 to collect garbage more often on boxes with little memory. Default is 0 which is the Go default")
+	memoryLimit := flag.Int64("memory-limit-bytes", 0, "Soft memory limit of the Go runtime unless the GOMEMLIMIT environment variable is set, so the GC collects more aggressively close to it. Requires a build with Go 1.19 or newer. Default is 0 which is no limit")
+	autoMemoryLimit := flag.Bool("auto-memory-limit", false, "Set the soft memory limit of the Go runtime to 90% of the cgroup memory limit of the container when that is lower than -memory-limit-bytes, and at most 2 GiB on 32-bit platforms. Requires a build with Go 1.19 or newer. Default is false")
+	memoryBallast := flag.Int64("memory-ballast-bytes", 0, "Size of a memory ballast allocated at startup, which makes the GC run less often while the live heap is small. Default is 0 which is no ballast")
+	walDir := flag.String("wal-dir", "", "Directory for a write-ahead log of buffered datapoints, replayed at startup so a restart doesn't lose them. Default is no write-ahead log")
+	batchIDTTL := flag.Duration("batch-id-ttl", defaultBatchIDTTL, fmt.Sprintf("How long the batch IDs of stored pushes are remembered, so retries of them are not stored again. Default is %v, 0 disables deduplication", defaultBatchIDTTL))
+	pushAuthFile := flag.String("push-auth-file", "", "JSON file with the credentials accepted on push endpoints, e.g. {\"tokens\": [\"...\"], \"users\": {\"gateway\": \"...\"}}. Default is no authentication")
+	scrapeAuthFile := flag.String("scrape-auth-file", "", "JSON file with the credentials accepted on scrape, debug and admin endpoints, in the format of -push-auth-file. Default is no authentication")
+	slowReadThreshold := flag.Duration("slow-client-read-threshold", 0, "Count clients that take longer than this to send a push body as slow. Default is 0 (none)")
+	slowWriteThreshold := flag.Duration("slow-client-write-threshold", 0, "Count clients that take longer than this to receive a response, e.g. a scrape, as slow. Default is 0 (none)")
+	slowClientClose := flag.Bool("slow-client-close", false, "Close the connections of clients once they reach -slow-client-read-threshold or -slow-client-write-threshold")
+	throttleUtilization := flag.Float64("throttle-utilization", 0, "If set, gRPC Collect responses carry a hint to slow down once the hub is over this percent of -limit. Default is 0 (no hints)")
+	throttleMaxDelay := flag.Duration("throttle-max-delay", defaultThrottleMaxDelay, fmt.Sprintf("Delay hinted by -throttle-utilization when the hub is full, scaled down for a hub less full. Default is %v", defaultThrottleMaxDelay))
+	readyUtilization := flag.Float64("ready-utilization", 0, "If set, /-/ready reports the hub not ready while it is over this percent of -limit, so load balancers route pushes elsewhere. Default is 0 (ready whatever the utilization)")
+	shutdownDelay := flag.Duration("shutdown-delay", 0, "How long to keep serving after SIGTERM while /-/ready reports the hub not ready, so load balancers stop routing pushes to it first. Default is 0 (stop right away)")
+	seriesOrderLabel := flag.String("series-order-label", "", "Label, e.g. gatewayID, whose series are scraped in timestamp order relative to the other series of their family with the same value, instead of series by series. Default is none")
+	identityLabels := flag.String("identity-labels", "", "Comma separated labels every pushed datapoint must have, e.g. gatewayID,networkID. Pushes with datapoints without them are rejected. Default is none")
+	logLevel := flag.String("log-level", defaultLogLevel, fmt.Sprintf("Lowest level of log entries to write: debug, info, warn or error. Requests are logged at debug, or at warn or error if they fail. Default is %s", defaultLogLevel))
+	logFormat := flag.String("log-format", string(logging.FormatConsole), "Format of log entries: console (one human readable line) or json (one JSON object per line, with ts, level and msg keys). Default is console")
+	accessLogPath := flag.String("access-log", "", "File to write a JSON line to for every push and scrape, with its source, transport, bytes, families, datapoints, duration and result, or - for stdout. Default is no access log")
+	accessLogMaxBytes := flag.Int64("access-log-max-bytes", defaultAccessLogMaxBytes, fmt.Sprintf("Size at which the -access-log file is rotated. Default is %d, 0 never rotates", defaultAccessLogMaxBytes))
+	accessLogMaxFiles := flag.Int("access-log-max-files", defaultAccessLogMaxFiles, fmt.Sprintf("Number of rotated -access-log files kept. Default is %d", defaultAccessLogMaxFiles))
+	configFile := flag.String("config.file", "", "YAML file with the limit, metric_ttl, relabel_configs, metric_allowlist, metric_denylist, series_denylist and label_quotas, overriding their flags, and rollups. Reloaded on SIGHUP and POST /-/reload. Default is no config file")
+	profile := flag.String("profile", "", "Deployment profile setting the flags it tunes that aren't set on the command line: magma or tiny. Default is no profile")
 	flag.Parse()
+	configureLogging(*logLevel, *logFormat)
+	if *profile != "" {
+		if err := applyProfile(*profile); err != nil {
+			logging.Fatal("invalid -profile", "err", err)
+		}
+	}
+
+	if *autoMemoryLimit {
+		*memoryLimit = hub.AutoMemoryLimit(*memoryLimit)
+	}
+	hub.TuneGC(*gogc, *memoryLimit, *memoryBallast)
+	procs := runtime.GOMAXPROCS(0)
+	if *autoGOMAXPROCS {
+		procs = hub.TuneGOMAXPROCS()
+	}
+	if *scrapeWorkers == 0 {
+		*scrapeWorkers = procs
+	}
+	if *ingestWorkers == 0 {
+		*ingestWorkers = procs
+	}
+
+	regressionPolicy, err := hub.ParseClockRegressionPolicy(*clockRegressionPolicy)
+	if err != nil {
+		logging.Fatal("invalid -clock-regression-policy", "err", err)
+	}
+
+	hubOpts := []hub.Option{
+		hub.WithImportLimits(*importLimit, *importMaxBytes),
+		hub.WithClockRegressionPolicy(regressionPolicy),
+		hub.WithScrapeWorkers(*scrapeWorkers),
+		hub.WithIngestWorkers(*ingestWorkers),
+		hub.WithDiagnosticLimits(*debugMaxConcurrent, *debugMaxUtilization),
+		hub.WithIngestQueue(*ingestQueueDepth, *ingestWriters),
+		hub.WithBatchDeduplication(*batchIDTTL),
+		hub.WithHTTPPushLimits(*httpMaxPushDatapoints, *httpMaxPushBytes),
+		hub.WithScrapeMaxWait(*scrapeMaxWait),
+		hub.WithQuarantineLimit(*quarantineLimit),
+	}
+	if *httpPushRate > 0 {
+		hubOpts = append(hubOpts, hub.WithPushRateLimit("http", *httpPushRate, *httpPushBurst))
+	}
+	if *grpcPushRate > 0 {
+		hubOpts = append(hubOpts, hub.WithPushRateLimit("grpc", *grpcPushRate, *grpcPushBurst))
+	}
+	grpcServer := grpcConfig{
+		port:              *grpcPort,
+		maxMsgSize:        *grpcMaxGRPCMsgSizeBytes,
+		maxPushDatapoints: *grpcMaxPushDatapoints,
+		maxPushBytes:      *grpcMaxPushBytes,
+		pushDeadline:      *grpcPushDeadline,
+	}
+	if *grpcPort != 0 {
+		capabilities, err := grpcCapabilities(grpcServer)
+		if err != nil {
+			logging.Fatal("invalid -grpc-port", "err", err)
+		}
+		hubOpts = append(hubOpts, hub.WithGRPCCapabilities(capabilities))
+	}
+	if *warmUp > 0 {
+		hubOpts = append(hubOpts, hub.WithWarmUp(*warmUp))
+	}
+	if *scrapeCacheTTL > 0 {
+		hubOpts = append(hubOpts, hub.WithScrapeCache(*scrapeCacheTTL))
+	}
+	if *scrapeRetention > 0 {
+		hubOpts = append(hubOpts, hub.WithScrapeRetention(*scrapeRetention))
+	}
+	if *heartbeatSourceLabel != "" {
+		hubOpts = append(hubOpts, hub.WithSourceHeartbeats(*heartbeatSourceLabel))
+	}
+	if *dropRuntimeMetrics {
+		hubOpts = append(hubOpts, hub.WithRuntimeMetricsDropped())
+	}
+	if *slowFamilies != "" {
+		pattern, err := regexp.Compile("^(?:" + *slowFamilies + ")$")
+		if err != nil {
+			logging.Fatal("invalid -slow-families", "err", err)
+		}
+		hubOpts = append(hubOpts, hub.WithSlowFamilies(pattern))
+	}
+	if *counterIncreaseFamilies != "" {
+		pattern, err := regexp.Compile("^(?:" + *counterIncreaseFamilies + ")$")
+		if err != nil {
+			logging.Fatal("invalid -counter-increase-families", "err", err)
+		}
+		hubOpts = append(hubOpts, hub.WithCounterIncrease(pattern))
+	}
+	policy, err := hub.ParseLimitPolicy(*limitPolicy)
+	if err != nil {
+		logging.Fatal("invalid -limit-policy", "err", err)
+	}
+	hubOpts = append(hubOpts, hub.WithLimitPolicy(policy))
+	timestampPolicy, err := hub.ParseTimestampPolicy(*defaultTimestamp)
+	if err != nil {
+		logging.Fatal("invalid -default-timestamp", "err", err)
+	}
+	hubOpts = append(hubOpts, hub.WithDefaultTimestamp(timestampPolicy))
+	if *metricTTL > 0 {
+		hubOpts = append(hubOpts, hub.WithMetricTTL(*metricTTL))
+	}
+	if *staleSeriesThreshold > 0 {
+		policy, err := hub.ParseStaleSeriesPolicy(*staleSeriesPolicy)
+		if err != nil {
+			logging.Fatal("invalid -stale-series-policy", "err", err)
+		}
+		hubOpts = append(hubOpts, hub.WithStaleSeriesFilter(*staleSeriesThreshold, policy))
+	}
+	if *throttleUtilization > 0 {
+		hubOpts = append(hubOpts, hub.WithThrottleHints(*throttleUtilization, *throttleMaxDelay))
+	}
+	if *seriesOrderLabel != "" {
+		hubOpts = append(hubOpts, hub.WithSeriesOrderLabel(*seriesOrderLabel))
+	}
+	if *identityLabels != "" {
+		hubOpts = append(hubOpts, hub.WithIdentityLabels(strings.Split(*identityLabels, ",")...))
+	}
+	if *maxSeriesDatapoints > 0 {
+		hubOpts = append(hubOpts, hub.WithMaxSeriesDatapoints(*maxSeriesDatapoints))
+	}
+	if len(keyLimits) > 0 {
+		var limits []hub.KeyLimit
+		for _, spec := range keyLimits {
+			limit, err := hub.ParseKeyLimit(spec)
+			if err != nil {
+				logging.Fatal("invalid -limit-per-key", "err", err)
+			}
+			limits = append(limits, limit)
+		}
+		hubOpts = append(hubOpts, hub.WithKeyLimits(limits))
+	}
+	if *tenantLabel != "" {
+		if *tenants == "" {
+			logging.Fatal("-tenant-label needs a -tenants allowlist")
+		}
+		hubOpts = append(hubOpts, hub.WithTenants(*tenantLabel, strings.Split(*tenants, ",")))
+	}
+	if *tenantTargetLabel != "" && *tenantLabel == "" {
+		logging.Fatal("-tenant-target-label needs a -tenant-label")
+	}
+	switch *tenantTargetLabel {
+	case "", *tenantLabel:
+	case "-":
+		hubOpts = append(hubOpts, hub.WithTenantLabelRewrite(""))
+	default:
+		hubOpts = append(hubOpts, hub.WithTenantLabelRewrite(*tenantTargetLabel))
+	}
+	if *labelQuotasFile != "" {
+		quotas, err := hub.LoadLabelQuotas(*labelQuotasFile)
+		if err != nil {
+			logging.Fatal("invalid -label-quotas-file", "err", err)
+		}
+		hubOpts = append(hubOpts, hub.WithLabelQuotas(quotas))
+	}
+	if *sanitizeNames {
+		if err := hub.ValidateNameReplacement(*sanitizeReplacement); err != nil {
+			logging.Fatal("invalid -sanitize-replacement", "err", err)
+		}
+		hubOpts = append(hubOpts, hub.WithNameSanitizer(*sanitizeReplacement))
+	}
+	if *relabelConfigFile != "" {
+		configs, err := hub.LoadRelabelConfigs(*relabelConfigFile)
+		if err != nil {
+			logging.Fatal("invalid -relabel-config-file", "err", err)
+		}
+		hubOpts = append(hubOpts, hub.WithRelabelConfigs(configs))
+	} else if configs, ok := profileRelabelConfigs[*profile]; ok {
+		hubOpts = append(hubOpts, hub.WithRelabelConfigs(configs))
+	}
+	if *metricAllowlist != "" || *metricDenylist != "" {
+		var allow, deny *regexp.Regexp
+		if *metricAllowlist != "" {
+			allow, err = regexp.Compile("^(?:" + *metricAllowlist + ")$")
+			if err != nil {
+				logging.Fatal("invalid -metric-allowlist", "err", err)
+			}
+		}
+		if *metricDenylist != "" {
+			deny, err = regexp.Compile("^(?:" + *metricDenylist + ")$")
+			if err != nil {
+				logging.Fatal("invalid -metric-denylist", "err", err)
+			}
+		}
+		hubOpts = append(hubOpts, hub.WithMetricFilter(allow, deny))
+	}
+	if *convertUntyped {
+		var gauges, counters *regexp.Regexp
+		if *untypedGauges != "" {
+			gauges, err = regexp.Compile("^(?:" + *untypedGauges + ")$")
+			if err != nil {
+				logging.Fatal("invalid -untyped-gauges", "err", err)
+			}
+		}
+		if *untypedCounters != "" {
+			counters, err = regexp.Compile("^(?:" + *untypedCounters + ")$")
+			if err != nil {
+				logging.Fatal("invalid -untyped-counters", "err", err)
+			}
+		}
+		hubOpts = append(hubOpts, hub.WithUntypedConversion(gauges, counters))
+	}
+	if len(seriesDenylist) > 0 {
+		for _, s := range seriesDenylist {
+			if err := hub.ValidateSelector(s); err != nil {
+				logging.Fatal("invalid -series-denylist", "selector", s, "err", err)
+			}
+		}
+		hubOpts = append(hubOpts, hub.WithSeriesDenylist(seriesDenylist...))
+	}
+	if *normalizationFile != "" {
+		rules, err := hub.LoadNormalizationRules(*normalizationFile)
+		if err != nil {
+			logging.Fatal("invalid -normalization-file", "err", err)
+		}
+		hubOpts = append(hubOpts, hub.WithNormalizationRules(rules))
+	}
+	if *staleSourceLabel == "" {
+		*staleSourceLabel = *heartbeatSourceLabel
+	}
+	if *staleSourceAfter > 0 {
+		if *staleSourceLabel == "" {
+			logging.Fatal("-stale-source-after requires -stale-source-label or -heartbeat-source-label")
+		}
+		hubOpts = append(hubOpts, hub.WithStaleSourceCleanup(*staleSourceLabel, *staleSourceAfter, *staleSourcePurge))
+	}
+	if *seriesChurnLabel == "" {
+		*seriesChurnLabel = *staleSourceLabel
+	}
+	if *maxSourceChurn > 0 || *maxFamilyChurn > 0 {
+		if *maxSourceChurn > 0 && *seriesChurnLabel == "" {
+			logging.Fatal("-max-source-series-churn requires -series-churn-source-label, -stale-source-label or -heartbeat-source-label")
+		}
+		tier := hub.QuotaTier(*seriesChurnTier)
+		if tier != hub.QuotaTierWarn && tier != hub.QuotaTierThrottle && tier != hub.QuotaTierReject {
+			logging.Fatal("invalid -series-churn-tier, must be warn, throttle or reject", "tier", *seriesChurnTier)
+		}
+		hubOpts = append(hubOpts, hub.WithSeriesChurnLimit(*seriesChurnLabel, *maxSourceChurn, *maxFamilyChurn, tier))
+	}
+	if *rejectedPushSamples > 0 {
+		hubOpts = append(hubOpts, hub.WithRejectedPushSamples(*rejectedPushSamples, *rejectedPushSampleTTL))
+	}
+	if *historyRetention > 0 {
+		hubOpts = append(hubOpts, hub.WithHistory(*historyResolution, *historyRetention, *historyMaxSeries))
+	}
+	if *lastValueMaxSeries > 0 {
+		hubOpts = append(hubOpts, hub.WithLastValues(*lastValueMaxSeries))
+	}
+	forwardInterval := *upstreamRetryInterval
+	if *walDir != "" {
+		wal, err := hub.OpenWAL(*walDir)
+		if err != nil {
+			logging.Fatal("invalid -wal-dir", "err", err)
+		}
+		hubOpts = append(hubOpts, hub.WithWAL(wal))
+	}
+	if *upstreamURL != "" && *remoteWriteURL != "" {
+		logging.Fatal("-upstream-url and -remote-write-url can't both be set")
+	}
+	if *upstreamURL != "" {
+		hubOpts = append(hubOpts, hub.WithUpstream(*upstreamURL, *upstreamTimeout))
+	}
+	if *remoteWriteURL != "" {
+		hubOpts = append(hubOpts, hub.WithRemoteWrite(*remoteWriteURL, *remoteWriteTimeout))
+		forwardInterval = *remoteWriteInterval
+	}
+	if *selfMonitoringInterval > 0 {
+		if *upstreamURL == "" && *remoteWriteURL == "" {
+			logging.Fatal("-self-monitoring-interval requires -upstream-url or -remote-write-url")
+		}
+		if *selfMonitoringInstance == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				logging.Fatal("Error getting hostname for -self-monitoring-instance", "err", err)
+			}
+			*selfMonitoringInstance = hostname
+		}
+		hubOpts = append(hubOpts, hub.WithSelfMonitoring(prometheus.DefaultGatherer, *selfMonitoringInstance))
+	}
+	if *accessLogPath != "" {
+		accessLog, err := hub.OpenAccessLog(*accessLogPath, *accessLogMaxBytes, *accessLogMaxFiles)
+		if err != nil {
+			logging.Fatal("invalid -access-log", "err", err)
+		}
+		hubOpts = append(hubOpts, hub.WithAccessLog(accessLog))
+	}
+	if *configFile != "" {
+		hubOpts = append(hubOpts, hub.WithConfigFile(*configFile))
+	}
+	if *readyUtilization > 0 {
+		hubOpts = append(hubOpts, hub.WithReadyUtilization(*readyUtilization))
+	}
+
+	metricHub := hub.NewMetricHub(*totalMetricsLimit, *scrapeTimeout, hubOpts...)
+	if *configFile != "" {
+		if err := metricHub.ReloadConfig(); err != nil {
+			logging.Fatal("invalid -config.file", "err", err)
+		}
+		go reloadOnSIGHUP(metricHub)
+	}
+	prometheus.MustRegister(hub.NewQueueAgeCollector(metricHub, *queueAgeTopN))
+	prometheus.MustRegister(hub.NewFamilySizeCollector(metricHub, *familySizeTopN))
+	if len(canaries) > 0 {
+		injector, err := hub.NewCanaryInjector(metricHub, canaries, *canaryInterval)
+		if err != nil {
+			logging.Fatal("invalid -canary", "err", err)
+		}
+		go injector.Run(nil)
+	}
+	go metricHub.RunForwarding(forwardInterval, nil)
+	go metricHub.RunSelfMonitoring(*selfMonitoringInterval, nil)
+	go metricHub.RunStaleSourceCleanup(staleSourceCheckInterval, nil)
+	go metricHub.RunExpiry(expiryCheckInterval, nil)
+	pushAuth := hub.AuthMiddleware(loadCredentials(*pushAuthFile, "-push-auth-file"))
+	scrapeAuth := hub.AuthMiddleware(loadCredentials(*scrapeAuthFile, "-scrape-auth-file"))
 
-	metricHub := hub.NewMetricHub(*totalMetricsLimit, *scrapeTimeout)
 	e := echo.New()
+	e.HideBanner, e.HidePort = true, true
+	e.HTTPErrorHandler = hub.HTTPErrorHandler
+	e.Server.ConnContext = hub.SlowClientConnContext
+	e.Use(hub.RequestLogMiddleware())
+	e.Use(hub.HTTPMetricsMiddleware())
+	e.Use(hub.SlowClientMiddleware(hub.SlowClientThresholds{Read: *slowReadThreshold, Write: *slowWriteThreshold, Close: *slowClientClose}))
 
-	e.POST("/metrics", metricHub.Receive)
-	e.GET("/metrics", metricHub.Scrape)
+	e.POST("/metrics", metricHub.Receive, pushAuth)
+	e.GET("/metrics", metricHub.Scrape, scrapeAuth)
+	e.HEAD("/metrics", metricHub.ScrapeHead, scrapeAuth)
+	e.GET("/metrics/summary", metricHub.ScrapeSummary, scrapeAuth)
+	e.POST("/metrics/batch", metricHub.ReceiveBatch, pushAuth)
+	e.POST("/metrics/job/*", metricHub.ReceiveGrouped, pushAuth)
+	e.PUT("/metrics/job/*", metricHub.ReceiveGrouped, pushAuth)
+	e.POST("/metrics/job@base64/*", metricHub.ReceiveGrouped, pushAuth)
+	e.PUT("/metrics/job@base64/*", metricHub.ReceiveGrouped, pushAuth)
+	e.GET("/metrics/fast", metricHub.ScrapeClassHandler(hub.ScrapeClassFast), scrapeAuth)
+	e.GET("/metrics/slow", metricHub.ScrapeClassHandler(hub.ScrapeClassSlow), scrapeAuth)
+	e.GET("/metrics/stale", metricHub.ScrapeStale, scrapeAuth)
+	e.GET("/metrics/current", metricHub.CurrentValues, scrapeAuth)
 
-	e.GET("/debug", metricHub.Debug)
+	e.POST("/api/v1/import", metricHub.Import, pushAuth)
+	e.POST("/api/v1/swap", metricHub.SwapHandler, scrapeAuth)
+	e.POST("/api/v1/swap/:id/commit", metricHub.CommitSwapHandler, scrapeAuth)
+	e.POST("/api/v1/swap/:id/rollback", metricHub.RollbackSwapHandler, scrapeAuth)
+	e.GET("/api/v1/capabilities", metricHub.CapabilitiesHandler)
+	e.GET("/api/v1/history", metricHub.History, scrapeAuth)
+	e.GET("/api/v1/quotas", metricHub.GetLabelQuotas, scrapeAuth)
+	e.PUT("/api/v1/quotas", metricHub.PutLabelQuotas, scrapeAuth)
+	e.GET("/api/v1/quarantine", metricHub.GetQuarantine, scrapeAuth)
+	e.DELETE("/api/v1/quarantine", metricHub.PurgeQuarantine, scrapeAuth)
+
+	e.GET("/debug", metricHub.Debug, scrapeAuth)
+	e.POST("/admin/flush", metricHub.Flush, scrapeAuth)
+	e.POST("/-/reload", metricHub.Reload, scrapeAuth)
 
 	// For liveness probe
 	e.GET("/", func(ctx echo.Context) error { return ctx.NoContent(http.StatusOK) })
+	// For readiness probe
+	e.GET("/-/ready", metricHub.Ready)
 
-	e.GET("/internal", serveInternalMetrics)
+	e.GET("/internal", serveInternalMetrics, scrapeAuth)
 
 	if *grpcPort != 0 {
 		go func() {
-			log.Fatal(serveGRPC(*grpcPort, *grpcMaxGRPCMsgSizeBytes, metricHub))
+			logging.Fatal("Error serving gRPC", "err", serveGRPC(grpcServer, metricHub))
 		}()
 	}
 
-	go e.Logger.Fatal(e.Start(fmt.Sprintf(":%d", *port)))
+	// replay while serving, so probes see the hub alive but not ready
+	go func() {
+		replayed, err := metricHub.ReplayWAL()
+		if err != nil {
+			logging.Fatal("Error replaying write-ahead log", "err", err)
+		}
+		if replayed > 0 {
+			logging.Info("Replayed datapoints from the write-ahead log", "datapoints", replayed)
+		}
+	}()
+
+	shutDown := make(chan struct{})
+	go func() {
+		shutDownOnSignal(e, metricHub, *shutdownDelay)
+		close(shutDown)
+	}()
+
+	logging.Info("Serving HTTP", "port", *port)
+	if err := e.Start(fmt.Sprintf(":%d", *port)); err != http.ErrServerClosed {
+		logging.Fatal("Error serving HTTP", "err", err)
+	}
+	<-shutDown
 }
 
-func serveInternalMetrics(ctx echo.Context) error {
-	text, err := hub.WriteInternalMetrics()
+// shutDownOnSignal waits for SIGTERM or SIGINT, then keeps serving for delay
+// while metricHub reports not ready, and shuts the HTTP server down once its
+// in-flight requests are done. The ingest queue of metricHub is stopped last.
+func shutDownOnSignal(e *echo.Echo, metricHub *hub.MetricHub, delay time.Duration) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	sig := <-stop
+	logging.Info("Shutting down", "signal", sig.String(), "delay", delay)
+	metricHub.ShutDown()
+	time.Sleep(delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		logging.Error("Error shutting down HTTP server", "err", err)
+	}
+	metricHub.Close()
+}
+
+// loadCredentials loads the credentials file passed as flagName, or returns
+// nil if it is not set
+func loadCredentials(path, flagName string) *hub.Credentials {
+	if path == "" {
+		return nil
+	}
+	creds, err := hub.LoadCredentials(path)
 	if err != nil {
-		return ctx.NoContent(http.StatusInternalServerError)
+		logging.Fatal("invalid "+flagName, "err", err)
 	}
-	return ctx.String(http.StatusOK, text)
+	return creds
 }
 
-func serveGRPC(port, maxMsgSize int, metricHub *hub.MetricHub) error {
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+// reloadOnSIGHUP reloads the config file of metricHub on every SIGHUP. A
+// failed reload keeps the current config.
+func reloadOnSIGHUP(metricHub *hub.MetricHub) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := metricHub.ReloadConfig(); err != nil {
+			logging.Error("Error reloading config file, keeping the current config", "err", err)
+		}
+	}
+}
+
+// runAggregator serves the merged scrapes of several hubs, for the aggregator
+// subcommand
+func runAggregator(args []string) {
+	flags := flag.NewFlagSet("aggregator", flag.ExitOnError)
+	port := flags.Int("port", defaultPort, fmt.Sprintf("Port to serve the merged scrapes on. Default is %d", defaultPort))
+	var hubs stringsFlag
+	flags.Var(&hubs, "hub", "Hub to scrape, as NAME=URL, e.g. 'site1=http://site1:9091/metrics'. Can be repeated")
+	label := flags.String("hub-label", defaultAggregatorLabel, fmt.Sprintf("Label added to every series with the NAME of the hub it was scraped from. Default is %q", defaultAggregatorLabel))
+	timeout := flags.Duration("hub-timeout", defaultAggregatorTimeout, fmt.Sprintf("Timeout for scrapes of each hub. Default is %v", defaultAggregatorTimeout))
+	logLevel := flags.String("log-level", defaultLogLevel, fmt.Sprintf("Lowest level of log entries to write: debug, info, warn or error. Default is %s", defaultLogLevel))
+	logFormat := flags.String("log-format", string(logging.FormatConsole), "Format of log entries: console or json. Default is console")
+	flags.Parse(args)
+	configureLogging(*logLevel, *logFormat)
+
+	if len(hubs) == 0 {
+		logging.Fatal("aggregator needs at least one -hub")
+	}
+	var targets []hub.AggregatorTarget
+	for _, spec := range hubs {
+		target, err := hub.ParseAggregatorTarget(spec)
+		if err != nil {
+			logging.Fatal("invalid -hub", "err", err)
+		}
+		targets = append(targets, target)
+	}
+	aggregator, err := hub.NewAggregator(targets, *label, *timeout)
+	if err != nil {
+		logging.Fatal("invalid -hub-label", "err", err)
+	}
+
+	e := echo.New()
+	e.HideBanner, e.HidePort = true, true
+	e.HTTPErrorHandler = hub.HTTPErrorHandler
+	e.Use(hub.RequestLogMiddleware())
+	e.Use(hub.HTTPMetricsMiddleware())
+	e.GET("/metrics", aggregator.Scrape)
+	e.GET("/", func(ctx echo.Context) error { return ctx.NoContent(http.StatusOK) })
+	e.GET("/internal", serveInternalMetrics)
+	logging.Info("Serving HTTP", "port", *port)
+	logging.Fatal("Error serving HTTP", "err", e.Start(fmt.Sprintf(":%d", *port)))
+}
+
+// configureLogging sets the level and format of the logger from flags, and
+// routes the standard logger through it
+func configureLogging(levelFlag, formatFlag string) {
+	level, err := logging.ParseLevel(levelFlag)
+	if err != nil {
+		logging.Fatal("invalid -log-level", "err", err)
+	}
+	format, err := logging.ParseFormat(formatFlag)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		logging.Fatal("invalid -log-format", "err", err)
 	}
+	logging.Configure(level, format)
+	log.SetFlags(0)
+	log.SetOutput(logging.Writer(logging.LevelInfo))
+}
+
+// grpcConfig is the gRPC server of the hub, served unless port is 0
+type grpcConfig struct {
+	port              int
+	maxMsgSize        int
+	maxPushDatapoints int
+	maxPushBytes      int
+	pushDeadline      time.Duration
+}
 
-	metricsGrpcServer := hubgrpc.MetricsControllerServerImpl{MetricHub: metricHub}
-	grpcServer := grpc.NewServer(grpc.MaxRecvMsgSize(maxMsgSize))
-	hubgrpc.RegisterMetricsControllerServer(grpcServer, &metricsGrpcServer)
+// stringsFlag is a flag that can be repeated to collect several values
+type stringsFlag []string
 
-	log.Printf("Serving GRPC on: %d\n", port)
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
 
-	return grpcServer.Serve(lis)
+func serveInternalMetrics(ctx echo.Context) error {
+	text, err := hub.WriteInternalMetrics()
+	if err != nil {
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+	return ctx.String(http.StatusOK, text)
 }
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) Facebook, Inc. and its affiliates.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/facebookincubator/prometheus-edge-hub/hub"
+)
+
+// profiles are flag values tuned for a kind of deployment, selected with
+// -profile. Flags set on the command line override them.
+var profiles = map[string]map[string]string{
+	// magma is for hubs behind the orc8r of a Magma deployment, which push
+	// over HTTP from each access gateway
+	"magma": {
+		"identity-labels":           "gatewayID,networkID",
+		"heartbeat-source-label":    "gatewayID",
+		"stale-source-after":        "1h",
+		"limit":                     "500000",
+		"limit-policy":              "partial",
+		"max-datapoints-per-series": "60",
+		"max-source-series-churn":   "5000",
+	},
+	// tiny is for sites with a single small, often ARM, device, keeping the
+	// hub under 64 MB RSS: one goroutine each parses pushes and serializes
+	// scrapes, and buffers and pushes are kept small
+	"tiny": {
+		"scrape-workers":            "1",
+		"ingest-workers":            "1",
+		"gogc":                      "50",
+		"memory-limit-bytes":        "50331648",
+		"auto-memory-limit":         "true",
+		"limit":                     "50000",
+		"limit-policy":              "partial",
+		"max-datapoints-per-series": "10",
+		"grpc-max-msg-size":         "4194304",
+		"http-max-push-bytes":       "4194304",
+		"import-max-bytes":          "4194304",
+		"history-max-series":        "5000",
+	},
+}
+
+// profileRelabelConfigs are the relabel configs of profiles, used unless
+// -relabel-config-file is set
+var profileRelabelConfigs = map[string][]hub.RelabelConfig{
+	// move identity labels pushed under the keys of older gateway releases
+	"magma": {
+		{SourceLabels: []string{"gateway_id"}, Separator: ";", Regex: "(.+)", TargetLabel: "gatewayID", Replacement: "$1", Action: hub.RelabelReplace},
+		{SourceLabels: []string{"network_id"}, Separator: ";", Regex: "(.+)", TargetLabel: "networkID", Replacement: "$1", Action: hub.RelabelReplace},
+		{Regex: "gateway_id|network_id", Action: hub.RelabelLabelDrop},
+	},
+}
+
+// applyProfile sets the flags of the profile name that weren't set on the
+// command line. It must be called after flag.Parse.
+func applyProfile(name string) error {
+	profile, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q, must be one of %s", name, strings.Join(profileNames(), ", "))
+	}
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for flagName, value := range profile {
+		if set[flagName] {
+			continue
+		}
+		if err := flag.Set(flagName, value); err != nil {
+			return fmt.Errorf("profile %s: -%s: %v", name, flagName, err)
+		}
+	}
+	return nil
+}
+
+func profileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}